@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+// extractFrom submits video n to /extract from remoteAddr with the given headers
+func extractFrom(remoteAddr string, n int, headers ...string) *httptest.ResponseRecorder {
+	body := fmt.Sprintf(`{"url":"https://www.youtube.com/watch?v=video%06d"}`, n)
+	req := httptest.NewRequest(http.MethodPost, "/extract", strings.NewReader(body))
+	req.RemoteAddr = remoteAddr
+	req.Header.Set("Content-Type", "application/json")
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	rec := httptest.NewRecorder()
+	handleExtract(rec, req)
+	return rec
+}
+
+func TestExtractLimitsActiveJobsPerIP(t *testing.T) {
+	setupGateway(t)
+	cfg.MaxActiveJobsPerIP = 2
+
+	var ids []string
+	for i := 0; i < 2; i++ {
+		rec := extractFrom("203.0.113.5:1000", i)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("job %d: status %d: %s", i, rec.Code, rec.Body)
+		}
+		var resp struct {
+			JobID string `json:"job_id"`
+		}
+		decodeBody(t, rec, &resp)
+		ids = append(ids, resp.JobID)
+	}
+	rec := extractFrom("203.0.113.5:1000", 2)
+	if rec.Code != http.StatusTooManyRequests || errorCode(t, rec) != shared.ErrCodeTooManyJobs {
+		t.Fatalf("over the limit: status %d: %s", rec.Code, rec.Body)
+	}
+	if rec := extractFrom("203.0.113.6:1000", 3); rec.Code != http.StatusOK {
+		t.Errorf("another client: status %d: %s", rec.Code, rec.Body)
+	}
+
+	setJobStatus(t, ids[0], shared.JobStatusCompleted)
+	if rec := extractFrom("203.0.113.5:1000", 4); rec.Code != http.StatusOK {
+		t.Errorf("after a job finished: status %d: %s", rec.Code, rec.Body)
+	}
+	if rec := extractFrom("203.0.113.5:1000", 5); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("freed slot reused twice: status %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestActiveJobLimitIgnoresSpoofedHeaders(t *testing.T) {
+	setupGateway(t)
+	cfg.MaxActiveJobsPerIP = 1
+
+	if rec := extractFrom("203.0.113.5:1000", 0); rec.Code != http.StatusOK {
+		t.Fatalf("first job: status %d: %s", rec.Code, rec.Body)
+	}
+	for i, header := range []string{"X-Forwarded-For", "X-Real-IP"} {
+		rec := extractFrom("203.0.113.5:1000", i+1, header, "198.51.100.1")
+		if rec.Code != http.StatusTooManyRequests {
+			t.Errorf("%s from an untrusted client: status %d: %s", header, rec.Code, rec.Body)
+		}
+	}
+
+	// Behind a trusted proxy the forwarded address is the client
+	var err error
+	if trustedProxies, err = shared.ParseIPNets([]string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	if rec := extractFrom("10.0.0.2:1000", 3, "X-Forwarded-For", "198.51.100.1"); rec.Code != http.StatusOK {
+		t.Errorf("first job via proxy: status %d: %s", rec.Code, rec.Body)
+	}
+	if rec := extractFrom("10.0.0.2:1000", 4, "X-Forwarded-For", "198.51.100.1"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("second job via proxy: status %d: %s", rec.Code, rec.Body)
+	}
+	if rec := extractFrom("10.0.0.2:1000", 5, "X-Forwarded-For", "198.51.100.2"); rec.Code != http.StatusOK {
+		t.Errorf("another client via proxy: status %d: %s", rec.Code, rec.Body)
+	}
+}
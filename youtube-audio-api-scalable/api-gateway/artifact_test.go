@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+// writeArtifactFile stores content under key in the output directory
+func writeArtifactFile(t *testing.T, key, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(cfg.OutputDir, key), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDownloadAudioAndThumbnailArtifacts(t *testing.T) {
+	setupGateway(t)
+	seedJob(t, &shared.Job{ID: "job-1", Status: shared.JobStatusCompleted, OutputExt: "mp3",
+		StorageKey: "job-1.mp3", ThumbnailFile: "job-1_thumb.jpg", Metadata: &shared.Metadata{Title: "Song"},
+		Artifacts: []shared.Artifact{
+			{Type: shared.ArtifactAudio, Key: "job-1.mp3", ContentType: "audio/mpeg"},
+			{Type: shared.ArtifactThumbnail, Key: "job-1_thumb.jpg", ContentType: "image/jpeg"},
+		}})
+	writeArtifactFile(t, "job-1.mp3", "ID3 audio bytes")
+	writeArtifactFile(t, "job-1_thumb.jpg", "\xff\xd8\xff jpeg bytes")
+
+	for _, tc := range []struct{ path, wantBody, wantType, wantName string }{
+		{"/download/job-1", "ID3 audio bytes", "audio/mpeg", "Song.mp3"},
+		{"/download/job-1/audio", "ID3 audio bytes", "audio/mpeg", "Song.mp3"},
+		{"/download/job-1/thumbnail", "\xff\xd8\xff jpeg bytes", "image/jpeg", "Song.jpg"},
+	} {
+		rec := serve(handleDownload, http.MethodGet, tc.path, "")
+		if rec.Code != http.StatusOK || rec.Body.String() != tc.wantBody {
+			t.Errorf("%s: status %d, body %q", tc.path, rec.Code, rec.Body)
+			continue
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != tc.wantType {
+			t.Errorf("%s: Content-Type %q, want %q", tc.path, ct, tc.wantType)
+		}
+		if cd := rec.Header().Get("Content-Disposition"); !strings.Contains(cd, tc.wantName) {
+			t.Errorf("%s: Content-Disposition %q, want %s", tc.path, cd, tc.wantName)
+		}
+	}
+	rec := serve(handleDownload, http.MethodGet, "/download/job-1/subtitles", "")
+	if rec.Code != http.StatusNotFound || errorCode(t, rec) != shared.ErrCodeNotFound {
+		t.Errorf("missing artifact: status %d: %s", rec.Code, rec.Body)
+	}
+
+	// The status lists every artifact with its own link
+	var job shared.Job
+	decodeBody(t, serve(handleStatus, http.MethodGet, "/status/job-1", ""), &job)
+	if len(job.Artifacts) != 2 || !strings.HasSuffix(job.Artifacts[1].DownloadEndpoint, "/download/job-1/thumbnail") {
+		t.Errorf("status artifacts = %+v", job.Artifacts)
+	}
+}
+
+func TestDownloadLegacySingleFileJob(t *testing.T) {
+	setupGateway(t)
+	// Completed before artifacts were recorded
+	seedJob(t, &shared.Job{ID: "old", Status: shared.JobStatusCompleted, OutputExt: "mp3", ThumbnailFile: "old_thumb.jpg"})
+	writeArtifactFile(t, "old.mp3", "legacy audio")
+	writeArtifactFile(t, "old_thumb.jpg", "legacy thumbnail")
+
+	for path, want := range map[string]string{
+		"/download/old":           "legacy audio",
+		"/download/old/audio":     "legacy audio",
+		"/download/old/thumbnail": "legacy thumbnail",
+	} {
+		if rec := serve(handleDownload, http.MethodGet, path, ""); rec.Code != http.StatusOK || rec.Body.String() != want {
+			t.Errorf("%s: status %d, body %q", path, rec.Code, rec.Body)
+		}
+	}
+
+	var job shared.Job
+	decodeBody(t, serve(handleStatus, http.MethodGet, "/status/old", ""), &job)
+	if len(job.Artifacts) != 2 || job.Artifacts[0].Type != shared.ArtifactAudio || !strings.HasSuffix(job.Artifacts[0].DownloadEndpoint, "/download/old/audio") {
+		t.Errorf("legacy status artifacts = %+v", job.Artifacts)
+	}
+}
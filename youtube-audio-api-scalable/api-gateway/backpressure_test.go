@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+// fillQueue publishes n jobs nobody consumes
+func fillQueue(t *testing.T, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if err := mq.Publish(context.Background(), shared.JobMessage{JobID: fmt.Sprintf("queued-%d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestExtractBackpressureWhenQueueIsFull(t *testing.T) {
+	setupGateway(t)
+	cfg.MaxQueueDepth = 3
+	fillQueue(t, 2)
+
+	if rec := extractFrom("203.0.113.5:1000", 0); rec.Code != http.StatusOK {
+		t.Fatalf("job filling the queue: status %d: %s", rec.Code, rec.Body)
+	}
+	rec := extractFrom("203.0.113.5:1000", 1)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("job over the limit: status %d: %s", rec.Code, rec.Body)
+	}
+	var env shared.ErrorResponse
+	decodeBody(t, rec, &env)
+	if env.Error.Code != shared.ErrCodeQueueFull || env.Error.Details["queue_depth"] != float64(3) || env.Error.Details["limit"] != float64(3) {
+		t.Errorf("error = %+v", env.Error)
+	}
+	// Nothing to estimate the drain from yet
+	if got := rec.Header().Get("Retry-After"); got != "60" {
+		t.Errorf("Retry-After = %q, want 60", got)
+	}
+	if jobs, _ := db.GetAllJobs(context.Background()); len(jobs) != 1 {
+		t.Errorf("%d jobs stored, want only the accepted one", len(jobs))
+	}
+
+	// A batch is refused as a whole when it doesn't fit
+	cfg.MaxQueueDepth = 5
+	rec = serve(handleExtractBatch, http.MethodPost, "/extract/batch",
+		`{"urls":["https://youtu.be/dQw4w9WgXcQ","https://youtu.be/9bZkp7q19f0","https://youtu.be/kJQP7kiw5Fk"]}`)
+	if rec.Code != http.StatusServiceUnavailable || errorCode(t, rec) != shared.ErrCodeQueueFull {
+		t.Errorf("batch over the limit: status %d: %s", rec.Code, rec.Body)
+	}
+
+	// Disabled limit
+	cfg.MaxQueueDepth = 0
+	if rec := extractFrom("203.0.113.5:1000", 2); rec.Code != http.StatusOK {
+		t.Errorf("without a limit: status %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestExtractBackpressureEstimatesRetryAfter(t *testing.T) {
+	setupGateway(t)
+	cfg.MaxQueueDepth = 4
+	cfg.MaxWorkers = 2
+	db.RecordProcessingTime(context.Background(), 30*time.Second)
+	fillQueue(t, 7)
+
+	rec := extractFrom("203.0.113.5:1000", 0)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	// 4 jobs over the limit, 2 workers at 30s each
+	if got := rec.Header().Get("Retry-After"); got != "60" {
+		t.Errorf("Retry-After = %q, want 60", got)
+	}
+
+	// Once workers take jobs off the queue, submissions are accepted again
+	messages, err := mq.Consume(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		<-messages
+	}
+	// The queue counts a message as taken just after handing it over
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if depth, _ := mq.Depth(context.Background()); depth == 3 || time.Now().After(deadline) {
+			break
+		}
+	}
+	if rec := extractFrom("203.0.113.5:1000", 1); rec.Code != http.StatusOK {
+		t.Errorf("after the queue drained: status %d: %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,137 @@
+// api-gateway/batch.go
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+// batchRequest is the body of POST /extract/batch: the URLs to convert and
+// the options of shared.Request, which apply to every URL
+type batchRequest struct {
+	URLs []string `json:"urls"`
+	shared.Request
+}
+
+// batchResult reports what happened to one URL of a batch
+type batchResult struct {
+	URL    string              `json:"url"`
+	JobID  string              `json:"job_id,omitempty"`
+	Status shared.JobStatus    `json:"status,omitempty"`
+	Cached bool                `json:"cached,omitempty"`
+	Error  *shared.ErrorDetail `json:"error,omitempty"`
+}
+
+// handleExtractBatch: Starts one job per URL. Invalid URLs get an error entry
+// instead of failing the whole batch. The batch counts as one request per URL
+// against the extract rate limit.
+func handleExtractBatch(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w, r)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPost {
+		shared.WriteError(w, http.StatusMethodNotAllowed, shared.ErrCodeMethodNotAllowed, "Invalid request method")
+		return
+	}
+
+	ctx, span := shared.Tracer().Start(r.Context(), "extract_batch")
+	defer span.End()
+	r = r.WithContext(ctx)
+
+	var req batchRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.URL != "" {
+		shared.WriteError(w, http.StatusBadRequest, shared.ErrCodeInvalidRequest, "Use 'urls' for batch submissions")
+		return
+	}
+	if len(req.URLs) == 0 {
+		shared.WriteError(w, http.StatusBadRequest, shared.ErrCodeInvalidURL, "Missing YouTube URLs")
+		return
+	}
+	if len(req.URLs) > cfg.MaxBatchSize {
+		shared.WriteError(w, http.StatusBadRequest, shared.ErrCodeInvalidRequest,
+			fmt.Sprintf("A batch may contain at most %d URLs", cfg.MaxBatchSize))
+		return
+	}
+	if !allowRequests(w, r, shared.RateLimitBucketExtract, len(req.URLs)) {
+		return
+	}
+	opts, ok := validateExtractOptions(w, r, &req.Request, true)
+	if !ok {
+		return
+	}
+	// Cache hits don't need a slot, but every URL is counted up front
+	if !allowQueueDepth(w, r, len(req.URLs)) || !allowActiveJobs(w, r, len(req.URLs)) {
+		return
+	}
+
+	results := make([]batchResult, 0, len(req.URLs))
+	queued := 0
+	for _, videoURL := range req.URLs {
+		res := batchResult{URL: videoURL}
+		if err := shared.ValidateVideoURL(videoURL, cfg.AllowedVideoHosts); err != nil {
+			res.Error = &shared.ErrorDetail{Code: shared.ErrCodeInvalidURL, Message: fmt.Sprintf("URL not allowed: %v", err)}
+			results = append(results, res)
+			continue
+		}
+		if shared.IsPlaylistURL(videoURL) {
+			res.Error = &shared.ErrorDetail{Code: shared.ErrCodeInvalidURL, Message: "Playlists are not supported in batches"}
+			results = append(results, res)
+			continue
+		}
+		urlReq := req.Request
+		urlReq.URL = videoURL
+		if cached := findCachedJob(ctx, urlReq, opts); cached != nil {
+			res.JobID, res.Status, res.Cached = cached.ID, cached.Status, true
+			results = append(results, res)
+			continue
+		}
+		var job *shared.Job
+		err := withFreshJobID(func(jobID string) (err error) {
+			job, err = submitJob(ctx, jobID, videoURL, urlReq, opts)
+			return err
+		})
+		if err != nil {
+			res.Error = &shared.ErrorDetail{Code: shared.ErrCodeInternal, Message: "Failed to submit job"}
+			if errors.Is(err, shared.ErrStorageUnavailable) {
+				res.Error = &shared.ErrorDetail{Code: shared.ErrCodeStorageUnavailable, Message: "Storage temporarily unavailable"}
+			}
+			if job != nil {
+				res.JobID, res.Status = job.ID, job.Status
+			}
+			results = append(results, res)
+			continue
+		}
+		trackActiveJob(r, job.ID)
+		res.JobID, res.Status = job.ID, job.Status
+		results = append(results, res)
+		queued++
+	}
+	logger.Info("Batch submitted", "urls", len(req.URLs), "queued", queued)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"jobs":   results,
+		"queued": queued,
+		"failed": len(results) - queued - countCached(results),
+	})
+}
+
+// countCached counts the results served from the result cache
+func countCached(results []batchResult) int {
+	n := 0
+	for _, res := range results {
+		if res.Cached {
+			n++
+		}
+	}
+	return n
+}
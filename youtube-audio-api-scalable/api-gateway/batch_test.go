@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+func TestExtractBatchMixedURLs(t *testing.T) {
+	setupGateway(t)
+	rec := serve(handleExtractBatch, http.MethodPost, "/extract/batch", `{"urls":[
+		"https://youtu.be/dQw4w9WgXcQ",
+		"https://youtube.com.evil.com/watch?v=dQw4w9WgXcQ",
+		"https://www.youtube.com/watch?v=9bZkp7q19f0",
+		"https://www.youtube.com/playlist?list=PLtest",
+		"not a url"
+	],"format":"opus"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var resp struct {
+		Jobs   []batchResult `json:"jobs"`
+		Queued int           `json:"queued"`
+		Failed int           `json:"failed"`
+	}
+	decodeBody(t, rec, &resp)
+	if len(resp.Jobs) != 5 || resp.Queued != 2 || resp.Failed != 3 {
+		t.Fatalf("got %d results, %d queued, %d failed; want 5, 2, 3", len(resp.Jobs), resp.Queued, resp.Failed)
+	}
+	for i, res := range resp.Jobs {
+		valid := i == 0 || i == 2
+		if valid && (res.JobID == "" || res.Status != shared.JobStatusPending || res.Error != nil) {
+			t.Errorf("%s: %+v, want a pending job", res.URL, res)
+		}
+		if !valid && (res.JobID != "" || res.Error == nil || res.Error.Code != shared.ErrCodeInvalidURL) {
+			t.Errorf("%s: %+v, want an invalid_url error", res.URL, res)
+		}
+	}
+
+	// The shared options apply to every queued job
+	for _, i := range []int{0, 2} {
+		job, err := db.GetJob(context.Background(), resp.Jobs[i].JobID)
+		if err != nil || job.Format != "opus" || job.OriginalURL != resp.Jobs[i].URL {
+			t.Errorf("job for %s: %+v, %v", resp.Jobs[i].URL, job, err)
+		}
+	}
+	if depth, _ := mq.Depth(context.Background()); depth != 2 {
+		t.Errorf("queue depth %d, want 2", depth)
+	}
+}
+
+func TestExtractBatchLimits(t *testing.T) {
+	setupGateway(t)
+	cfg.MaxBatchSize = 2
+	rec := serve(handleExtractBatch, http.MethodPost, "/extract/batch",
+		`{"urls":["https://youtu.be/dQw4w9WgXcQ","https://youtu.be/9bZkp7q19f0","https://youtu.be/kJQP7kiw5Fk"]}`)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "at most 2") {
+		t.Errorf("oversized batch: status %d: %s", rec.Code, rec.Body)
+	}
+
+	// A batch counts as one request per URL against the extract limit
+	cfg.MaxBatchSize = 10
+	cfg.RateLimitExtractRPM = 3
+	body := `{"urls":["https://youtu.be/dQw4w9WgXcQ","https://youtu.be/9bZkp7q19f0"]}`
+	if rec := serve(handleExtractBatch, http.MethodPost, "/extract/batch", body); rec.Code != http.StatusOK {
+		t.Fatalf("first batch: status %d: %s", rec.Code, rec.Body)
+	}
+	if rec := serve(handleExtractBatch, http.MethodPost, "/extract/batch", body); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("second batch past the limit: status %d", rec.Code)
+	}
+	for _, body := range []string{`{"urls":[]}`, `{"url":"https://youtu.be/dQw4w9WgXcQ"}`} {
+		if rec := serve(handleExtractBatch, http.MethodPost, "/extract/batch", body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", body, rec.Code)
+		}
+	}
+}
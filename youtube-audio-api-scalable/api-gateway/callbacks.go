@@ -0,0 +1,98 @@
+// api-gateway/callbacks.go
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+// handleAdminListCallbacks: GET /admin/callbacks/dlq lists the job callbacks
+// that failed every delivery attempt, newest first
+func handleAdminListCallbacks(w http.ResponseWriter, r *http.Request) {
+	// Auth handled by middleware
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodGet {
+		shared.WriteError(w, http.StatusMethodNotAllowed, shared.ErrCodeMethodNotAllowed, "Invalid request method")
+		return
+	}
+
+	entries, err := callbackDLQ.List(r.Context())
+	if err != nil {
+		logger.Error("Failed to list undelivered callbacks", "error", err)
+		shared.WriteError(w, http.StatusInternalServerError, shared.ErrCodeInternal, "Failed to retrieve undelivered callbacks")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"total":   len(entries),
+		"entries": entries,
+	})
+}
+
+// handleAdminRedeliverCallback: POST /admin/callbacks/dlq/{job_id}/redeliver
+// sends a job's undelivered callback again, once. It stays in the dead-letter
+// queue, with the new attempt recorded, if it fails again.
+func handleAdminRedeliverCallback(w http.ResponseWriter, r *http.Request) {
+	// Auth handled by middleware
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/callbacks/dlq/"), "/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] != "redeliver" {
+		shared.WriteError(w, http.StatusNotFound, shared.ErrCodeNotFound, "Not found")
+		return
+	}
+	if r.Method != http.MethodPost {
+		shared.WriteError(w, http.StatusMethodNotAllowed, shared.ErrCodeMethodNotAllowed, "Invalid request method")
+		return
+	}
+	jobID := parts[0]
+	jl := shared.WithJob(logger, jobID)
+
+	entry, err := callbackDLQ.Remove(r.Context(), jobID)
+	if err != nil {
+		shared.WriteError(w, http.StatusNotFound, shared.ErrCodeNotFound, "Job has no undelivered callback")
+		return
+	}
+	result, deliveryErr := shared.DeliverWebhook(cfg, entry.CallbackURL, entry.Payload, 0)
+	if job, err := db.GetJob(r.Context(), jobID); err == nil {
+		job.CallbackStatus = result.LastStatus
+		job.CallbackError = ""
+		if deliveryErr != nil {
+			job.CallbackError = deliveryErr.Error()
+		}
+		if err := db.UpdateJob(r.Context(), job); err != nil {
+			jl.Warn("Failed to record callback result", "error", err)
+		}
+	}
+	if deliveryErr != nil {
+		entry.LastStatus = result.LastStatus
+		entry.Error = deliveryErr.Error()
+		entry.Attempts += result.Attempts
+		entry.FailedAt = time.Now()
+		if err := callbackDLQ.Add(r.Context(), *entry); err != nil {
+			jl.Error("Failed to put undelivered callback back", "error", err)
+		}
+		jl.Warn("Callback redelivery failed", "callback_url", entry.CallbackURL, "error", deliveryErr)
+		shared.WriteErrorDetails(w, http.StatusBadGateway, shared.ErrCodeUpstream, "Callback delivery failed again",
+			map[string]any{"last_status": result.LastStatus, "error": deliveryErr.Error()})
+		return
+	}
+	jl.Info("Redelivered callback", "callback_url", entry.CallbackURL)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"job_id":      jobID,
+		"delivered":   true,
+		"last_status": result.LastStatus,
+	})
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+func TestRedeliverCallbackToFlappingServer(t *testing.T) {
+	setupGateway(t)
+	cfg.CallbackHostAllowlist = []string{"127.0.0.1"}
+	cfg.WebhookSecret = "s3cret"
+	var up atomic.Bool
+	var received atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !up.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		received.Store(r.Header.Get(shared.WebhookSignatureHeader))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+	seedJob(t, &shared.Job{ID: "job-1", Status: shared.JobStatusCompleted, CallbackURL: srv.URL, CallbackStatus: http.StatusBadGateway})
+	payload := []byte(`{"id":"job-1","status":"completed"}`)
+	callbackDLQ.Add(ctx, shared.UndeliveredCallback{JobID: "job-1", CallbackURL: srv.URL, Payload: payload,
+		LastStatus: http.StatusBadGateway, Error: "callback returned 502 Bad Gateway", Attempts: 4})
+
+	var list struct {
+		Total   int                          `json:"total"`
+		Entries []shared.UndeliveredCallback `json:"entries"`
+	}
+	decodeBody(t, serve(handleAdminListCallbacks, http.MethodGet, "/admin/callbacks/dlq", ""), &list)
+	if list.Total != 1 || list.Entries[0].JobID != "job-1" {
+		t.Fatalf("dead-lettered callbacks %+v", list)
+	}
+
+	// Still down: the callback goes back into the queue with the attempt counted
+	rec := serve(handleAdminRedeliverCallback, http.MethodPost, "/admin/callbacks/dlq/job-1/redeliver", "")
+	if rec.Code != http.StatusBadGateway || errorCode(t, rec) != shared.ErrCodeUpstream {
+		t.Fatalf("redelivery to a failing server: status %d: %s", rec.Code, rec.Body)
+	}
+	entries, _ := callbackDLQ.List(ctx)
+	if len(entries) != 1 || entries[0].Attempts != 5 || entries[0].LastStatus != http.StatusBadGateway {
+		t.Fatalf("dead-lettered callbacks after a failed redelivery %+v", entries)
+	}
+
+	// Back up: delivered once and recorded on the job
+	up.Store(true)
+	rec = serve(handleAdminRedeliverCallback, http.MethodPost, "/admin/callbacks/dlq/job-1/redeliver", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("redelivery: status %d: %s", rec.Code, rec.Body)
+	}
+	if entries, _ := callbackDLQ.List(ctx); len(entries) != 0 {
+		t.Errorf("delivered callback still dead-lettered: %+v", entries)
+	}
+	if sig, _ := received.Load().(string); sig != shared.SignWebhookPayload(cfg.WebhookSecret, payload) {
+		t.Errorf("signature %q does not match the stored payload", sig)
+	}
+	job, _ := db.GetJob(ctx, "job-1")
+	if job.CallbackStatus != http.StatusOK || job.CallbackError != "" {
+		t.Errorf("job callback status %d, error %q", job.CallbackStatus, job.CallbackError)
+	}
+
+	rec = serve(handleAdminRedeliverCallback, http.MethodPost, "/admin/callbacks/dlq/job-1/redeliver", "")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("second redelivery: status %d, want 404", rec.Code)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+// extractAndConsume submits body to /extract and returns the job and the URL
+// the worker was told to fetch
+func extractAndConsume(t *testing.T, body string) (*shared.Job, string) {
+	t.Helper()
+	rec := serve(handleExtract, http.MethodPost, "/extract", body)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var resp struct {
+		JobID string `json:"job_id"`
+	}
+	decodeBody(t, rec, &resp)
+	job, err := db.GetJob(context.Background(), resp.JobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs, err := mq.Consume(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return job, (<-msgs).OriginalURL
+}
+
+func TestExtractFetchesCanonicalURL(t *testing.T) {
+	const watch = "https://www.youtube.com/watch?v=dQw4w9WgXcQ"
+	tests := []struct {
+		name, url, wantFetch string
+	}{
+		{"tracking parameters", "https://youtu.be/dQw4w9WgXcQ?si=abc123&feature=share", watch},
+		{"playlist reference", "https://www.youtube.com/watch?v=dQw4w9WgXcQ&list=PL123&index=4", watch},
+		{"timestamp", "https://www.youtube.com/watch?v=dQw4w9WgXcQ&t=1m30s", watch + "&t=90"},
+		{"short", "https://www.youtube.com/shorts/dQw4w9WgXcQ", watch},
+		{"already canonical", watch, watch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupGateway(t)
+			job, fetched := extractAndConsume(t, `{"url":"`+tt.url+`"}`)
+			if job.OriginalURL != tt.url || job.FetchURL() != tt.wantFetch || fetched != tt.wantFetch {
+				t.Errorf("original %q, canonical %q, fetched %q; want %q fetched", job.OriginalURL, job.CanonicalURL, fetched, tt.wantFetch)
+			}
+			if job.CanonicalURL != "" && job.CanonicalURL == job.OriginalURL {
+				t.Error("canonical_url repeats original_url")
+			}
+		})
+	}
+}
+
+func TestExtractClipDropsTimestamp(t *testing.T) {
+	setupGateway(t)
+	job, fetched := extractAndConsume(t, `{"url":"https://youtu.be/dQw4w9WgXcQ?t=42","start_time":"10","end_time":"20"}`)
+	if want := "https://www.youtube.com/watch?v=dQw4w9WgXcQ"; fetched != want || job.CanonicalURL != want {
+		t.Errorf("clip fetched %q (canonical %q), want %q", fetched, job.CanonicalURL, want)
+	}
+}
+
+func TestExtractKeepsURLWhenCanonicalizationIsOff(t *testing.T) {
+	t.Setenv("CANONICALIZE_URLS", "false")
+	setupGateway(t)
+	const raw = "https://youtu.be/dQw4w9WgXcQ?si=abc123"
+	job, fetched := extractAndConsume(t, `{"url":"`+raw+`"}`)
+	if fetched != raw || job.CanonicalURL != "" {
+		t.Errorf("fetched %q (canonical %q), want the submitted URL", fetched, job.CanonicalURL)
+	}
+}
+
+func TestExtractCacheMatchesAcrossURLShapes(t *testing.T) {
+	setupGateway(t)
+	cached := seedJob(t, &shared.Job{ID: "cached", Status: shared.JobStatusCompleted, VideoID: "dQw4w9WgXcQ",
+		OriginalURL: "https://www.youtube.com/watch?v=dQw4w9WgXcQ", Format: "mp3", Bitrate: shared.DefaultBitrate, OutputExt: "mp3"})
+	writeOutput(t, cached, "audio")
+
+	for _, u := range []string{
+		"https://youtu.be/dQw4w9WgXcQ?si=abc123",
+		"https://m.youtube.com/watch?v=dQw4w9WgXcQ&feature=share",
+		"https://music.youtube.com/watch?v=dQw4w9WgXcQ&list=RDAMVMdQw4w9WgXcQ",
+		"https://www.youtube.com/embed/dQw4w9WgXcQ?autoplay=1",
+	} {
+		rec := serve(handleExtract, http.MethodPost, "/extract", `{"url":"`+u+`"}`)
+		var resp struct {
+			JobID  string `json:"job_id"`
+			Cached bool   `json:"cached"`
+		}
+		decodeBody(t, rec, &resp)
+		if resp.JobID != "cached" || !resp.Cached {
+			t.Errorf("%s: response %+v, want the cached job", u, resp)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"maps"
+	"net/http"
+	"strings"
+	"testing"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+func TestClientMetadataRoundTripsThroughStatus(t *testing.T) {
+	setupGateway(t)
+	rec := serve(handleExtract, http.MethodPost, "/extract",
+		`{"url":"https://youtu.be/dQw4w9WgXcQ","client_metadata":{"user_id":"42","order_id":"A-1001 é"}}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var created struct {
+		JobID string `json:"job_id"`
+	}
+	decodeBody(t, rec, &created)
+
+	rec = serve(handleStatus, http.MethodGet, "/status/"+created.JobID, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var status struct {
+		ClientMetadata map[string]string `json:"client_metadata"`
+	}
+	decodeBody(t, rec, &status)
+	want := map[string]string{"user_id": "42", "order_id": "A-1001 é"}
+	if !maps.Equal(status.ClientMetadata, want) {
+		t.Errorf("client_metadata = %v, want %v", status.ClientMetadata, want)
+	}
+}
+
+func TestClientMetadataSkipsCachedJob(t *testing.T) {
+	setupGateway(t)
+	cached := seedJob(t, &shared.Job{ID: "cached", Status: shared.JobStatusCompleted, VideoID: "dQw4w9WgXcQ",
+		Format: "mp3", Bitrate: shared.DefaultBitrate, OutputExt: "mp3"})
+	writeOutput(t, cached, "audio")
+
+	rec := serve(handleExtract, http.MethodPost, "/extract", `{"url":"https://youtu.be/dQw4w9WgXcQ","client_metadata":{"user_id":"42"}}`)
+	var resp struct {
+		JobID  string `json:"job_id"`
+		Cached bool   `json:"cached"`
+	}
+	decodeBody(t, rec, &resp)
+	if rec.Code != http.StatusOK || resp.Cached || resp.JobID == "cached" {
+		t.Errorf("status %d, response %+v; want a new job", rec.Code, resp)
+	}
+}
+
+func TestClientMetadataRejectsOversized(t *testing.T) {
+	setupGateway(t)
+	var keys []string
+	for i := 0; i <= shared.MaxClientMetadataKeys; i++ {
+		keys = append(keys, `"k`+strings.Repeat("x", i)+`":"v"`)
+	}
+	for name, metadata := range map[string]string{
+		"too many keys": "{" + strings.Join(keys, ",") + "}",
+		"too large":     `{"blob":"` + strings.Repeat("x", shared.MaxClientMetadataSize) + `"}`,
+		"empty key":     `{"":"v"}`,
+	} {
+		rec := serve(handleExtract, http.MethodPost, "/extract", `{"url":"https://youtu.be/dQw4w9WgXcQ","client_metadata":`+metadata+`}`)
+		if rec.Code != http.StatusUnprocessableEntity || errorCode(t, rec) != shared.ErrCodeValidationFailed {
+			t.Errorf("%s: status %d: %s", name, rec.Code, rec.Body)
+		}
+	}
+	if depth, _ := mq.Depth(context.Background()); depth != 0 {
+		t.Errorf("rejected metadata queued %d jobs", depth)
+	}
+}
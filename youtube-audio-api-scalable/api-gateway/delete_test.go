@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+// seedFinishedJob stores a completed job with an output file and returns the file's path
+func seedFinishedJob(t *testing.T, id string) string {
+	t.Helper()
+	path := filepath.Join(cfg.OutputDir, id+".mp3")
+	if err := os.WriteFile(path, []byte("audio"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	completedAt := time.Now()
+	seedJob(t, &shared.Job{ID: id, Status: shared.JobStatusCompleted, CompletedAt: &completedAt,
+		FilePath: path, DownloadEndpoint: "/download/" + id})
+	return path
+}
+
+// listedIDs returns the IDs of the jobs listed by GET /admin/jobs?query
+func listedIDs(t *testing.T, query string) []string {
+	t.Helper()
+	var list jobList
+	decodeBody(t, serve(handleAdminListJobs, http.MethodGet, "/admin/jobs?"+query, ""), &list)
+	ids := make([]string, len(list.Jobs))
+	for i, job := range list.Jobs {
+		ids[i] = job.ID
+	}
+	return ids
+}
+
+func TestAdminSoftDeleteKeepsRecord(t *testing.T) {
+	setupGateway(t)
+	path := seedFinishedJob(t, "done")
+	seedJob(t, &shared.Job{ID: "other", Status: shared.JobStatusFailed, CreatedAt: time.Now().Add(-time.Minute)})
+
+	rec := serve(handleAdminDeleteJob, http.MethodDelete, "/admin/delete/done?soft=true", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("soft delete: status %d: %s", rec.Code, rec.Body)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("the output file was kept")
+	}
+	job, err := db.GetJob(context.Background(), "done")
+	if err != nil {
+		t.Fatalf("the record is gone: %v", err)
+	}
+	if job.Status != shared.JobStatusDeleted || job.DeletedAt == nil || job.DownloadEndpoint != "" || job.FilePath != "" {
+		t.Errorf("soft-deleted job = %+v", job)
+	}
+
+	if ids := listedIDs(t, ""); len(ids) != 1 || ids[0] != "other" {
+		t.Errorf("default listing = %v, want only other", ids)
+	}
+	if ids := listedIDs(t, "include_deleted=true"); len(ids) != 2 || ids[0] != "done" {
+		t.Errorf("include_deleted listing = %v, want done and other", ids)
+	}
+	if ids := listedIDs(t, "status=deleted"); len(ids) != 1 || ids[0] != "done" {
+		t.Errorf("status=deleted listing = %v, want only done", ids)
+	}
+	if rec := serve(handleAdminListJobs, http.MethodGet, "/admin/jobs?include_deleted=maybe", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid include_deleted: status %d, want 400", rec.Code)
+	}
+
+	if rec := serve(handleAdminDeleteJob, http.MethodDelete, "/admin/delete/done?soft=true", ""); rec.Code != http.StatusConflict {
+		t.Errorf("second soft delete: status %d, want 409", rec.Code)
+	}
+	// A hard delete still removes a soft-deleted record
+	if rec := serve(handleAdminDeleteJob, http.MethodDelete, "/admin/delete/done", ""); rec.Code != http.StatusOK {
+		t.Fatalf("hard delete after soft delete: status %d: %s", rec.Code, rec.Body)
+	}
+	if _, err := db.GetJob(context.Background(), "done"); err == nil {
+		t.Error("the record survived a hard delete")
+	}
+}
+
+func TestAdminHardDeleteRemovesRecord(t *testing.T) {
+	setupGateway(t)
+	path := seedFinishedJob(t, "done")
+
+	rec := serve(handleAdminDeleteJob, http.MethodDelete, "/admin/delete/done", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("hard delete: status %d: %s", rec.Code, rec.Body)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("the output file was kept")
+	}
+	if _, err := db.GetJob(context.Background(), "done"); err == nil {
+		t.Error("the record was kept")
+	}
+	if ids := listedIDs(t, "include_deleted=true"); len(ids) != 0 {
+		t.Errorf("include_deleted listing = %v, want nothing", ids)
+	}
+}
+
+func TestAdminSoftDeleteRejectsBadRequests(t *testing.T) {
+	setupGateway(t)
+	seedJob(t, &shared.Job{ID: "running", Status: shared.JobStatusProcessing})
+
+	if rec := serve(handleAdminDeleteJob, http.MethodDelete, "/admin/delete/running?soft=true", ""); rec.Code != http.StatusConflict {
+		t.Errorf("soft-deleting a processing job: status %d, want 409", rec.Code)
+	}
+	if job, _ := db.GetJob(context.Background(), "running"); job == nil || job.Status != shared.JobStatusProcessing {
+		t.Errorf("processing job after a rejected soft delete = %+v", job)
+	}
+	if rec := serve(handleAdminDeleteJob, http.MethodDelete, "/admin/delete/running?soft=sometimes", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid soft: status %d, want 400", rec.Code)
+	}
+	if rec := serve(handleAdminDeleteJob, http.MethodDelete, "/admin/delete/missing?soft=true", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("soft-deleting an unknown job: status %d, want 404", rec.Code)
+	}
+}
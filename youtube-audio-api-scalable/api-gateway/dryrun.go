@@ -0,0 +1,86 @@
+// api-gateway/dryrun.go
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+// dryRunResult is the response to a dry-run /extract: whether the video
+// would be accepted, and if not why, without a job being created
+type dryRunResult struct {
+	DryRun        bool                 `json:"dry_run"`
+	Accepted      bool                 `json:"accepted"`
+	Reason        string               `json:"reason,omitempty"`
+	FailureReason shared.FailureReason `json:"failure_reason,omitempty"`
+	Title         string               `json:"title,omitempty"`
+	Uploader      string               `json:"uploader,omitempty"`
+	Duration      float64              `json:"duration,omitempty"`
+	Cached        bool                 `json:"cached"` // Metadata came from the metadata cache
+}
+
+// isDryRun reports whether an /extract request only asks to be validated,
+// via "dry_run" in the body or ?dry_run=. On a bad query value it writes
+// the error response and returns ok false.
+func isDryRun(w http.ResponseWriter, r *http.Request, req *shared.Request) (dryRun, ok bool) {
+	if req.DryRun {
+		return true, true
+	}
+	v := r.URL.Query().Get("dry_run")
+	if v == "" {
+		return false, true
+	}
+	dryRun, err := strconv.ParseBool(v)
+	if err != nil {
+		shared.WriteError(w, http.StatusBadRequest, shared.ErrCodeInvalidRequest, "dry_run must be true or false")
+		return false, false
+	}
+	return dryRun, true
+}
+
+// handleExtractDryRun checks a validated /extract request against the video
+// itself, the way the worker would before downloading: it must exist, not be
+// live, fit the duration limit and contain the requested clip. Nothing is
+// queued or converted.
+func handleExtractDryRun(w http.ResponseWriter, r *http.Request, req shared.Request, opts extractOptions) {
+	if shared.IsPlaylistURL(req.URL) {
+		shared.WriteError(w, http.StatusBadRequest, shared.ErrCodeInvalidRequest, "dry_run is not supported for playlists")
+		return
+	}
+	result := dryRunResult{DryRun: true}
+	meta, cached, err := lookupMetadata(r.Context(), req.URL)
+	if err != nil {
+		reason := shared.ClassifyYtDlpError(err)
+		if reason != shared.FailureURLInvalid && reason != shared.FailureVideoUnavailable {
+			// Not the video's fault, so no verdict either way
+			logger.Warn("Dry run failed to fetch metadata", "url", req.URL, "error", err)
+			shared.WriteError(w, http.StatusBadGateway, shared.ErrCodeUpstream, "Failed to check the video")
+			return
+		}
+		result.FailureReason, result.Reason = reason, err.Error()
+		writeDryRunResult(w, result)
+		return
+	}
+	result.Title, result.Uploader, result.Duration, result.Cached = meta.Title, meta.Uploader, meta.Duration, cached
+
+	if err := shared.CheckNotLive(meta); err != nil {
+		result.FailureReason, result.Reason = shared.FailureVideoUnavailable, err.Error()
+	} else if cfg.MaxVideoDurationSeconds > 0 && int(meta.Duration) > cfg.MaxVideoDurationSeconds {
+		result.FailureReason = shared.FailureTooLong
+		result.Reason = fmt.Sprintf("video duration %ds exceeds the limit of %ds", int(meta.Duration), cfg.MaxVideoDurationSeconds)
+	} else if err := shared.CheckClipWithinDuration(opts.ClipStart, opts.ClipEnd, meta.Duration); err != nil {
+		result.FailureReason, result.Reason = shared.FailureConvertFailed, err.Error()
+	} else {
+		result.Accepted = true
+	}
+	writeDryRunResult(w, result)
+}
+
+func writeDryRunResult(w http.ResponseWriter, result dryRunResult) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
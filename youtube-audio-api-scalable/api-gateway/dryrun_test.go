@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+// assertNothingQueued fails the test if a job was created or queued
+func assertNothingQueued(t *testing.T) {
+	t.Helper()
+	if jobs, _ := db.GetAllJobs(context.Background()); len(jobs) != 0 {
+		t.Errorf("dry run created %d jobs", len(jobs))
+	}
+	if depth, _ := mq.Depth(context.Background()); depth != 0 {
+		t.Errorf("dry run queued %d jobs", depth)
+	}
+}
+
+func TestExtractDryRunAcceptsVideo(t *testing.T) {
+	t.Setenv("YTDLP_PATH", stubYtDlp(t, fakeVideoInfo))
+	setupGateway(t)
+
+	for _, tc := range []struct{ name, target, body string }{
+		{"body field", "/extract", `{"url":"https://www.youtube.com/watch?v=dQw4w9WgXcQ","dry_run":true}`},
+		{"query parameter", "/extract?dry_run=true", `{"url":"https://www.youtube.com/watch?v=dQw4w9WgXcQ"}`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := serve(handleExtract, http.MethodPost, tc.target, tc.body)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", rec.Code, rec.Body)
+			}
+			var result dryRunResult
+			decodeBody(t, rec, &result)
+			if !result.DryRun || !result.Accepted || result.Title != "Test Song" || result.Duration != 212 || result.Reason != "" {
+				t.Errorf("result = %+v", result)
+			}
+			assertNothingQueued(t)
+		})
+	}
+}
+
+func TestExtractDryRunRejections(t *testing.T) {
+	t.Setenv("MAX_VIDEO_DURATION_SECONDS", "100")
+	ytDlp := stubYtDlp(t, fakeVideoInfo)
+	t.Setenv("YTDLP_PATH", ytDlp)
+	setupGateway(t)
+
+	// A disallowed host is rejected before yt-dlp runs
+	rec := serve(handleExtract, http.MethodPost, "/extract?dry_run=true", `{"url":"https://youtube.com.evil.com/watch?v=dQw4w9WgXcQ"}`)
+	if rec.Code != http.StatusUnprocessableEntity || errorCode(t, rec) != shared.ErrCodeValidationFailed {
+		t.Errorf("disallowed host: status %d: %s", rec.Code, rec.Body)
+	}
+	if _, err := os.Stat(ytDlp + ".args"); err == nil {
+		t.Error("yt-dlp ran for a disallowed host")
+	}
+
+	// The video is over MAX_VIDEO_DURATION_SECONDS
+	rec = serve(handleExtract, http.MethodPost, "/extract?dry_run=true", `{"url":"https://www.youtube.com/watch?v=dQw4w9WgXcQ"}`)
+	var result dryRunResult
+	decodeBody(t, rec, &result)
+	if rec.Code != http.StatusOK || result.Accepted || result.FailureReason != shared.FailureTooLong || result.Title != "Test Song" {
+		t.Errorf("too long: status %d, result %+v", rec.Code, result)
+	}
+
+	// yt-dlp reports the video gone
+	unavailable := filepath.Join(t.TempDir(), "yt-dlp")
+	script := "#!/bin/sh\necho 'ERROR: [youtube] 9bZkp7q19f0: Video unavailable' >&2\nexit 1\n"
+	if err := os.WriteFile(unavailable, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	cfg.YtDlpPath = unavailable
+	rec = serve(handleExtract, http.MethodPost, "/extract?dry_run=true", `{"url":"https://www.youtube.com/watch?v=9bZkp7q19f0"}`)
+	result = dryRunResult{}
+	decodeBody(t, rec, &result)
+	if rec.Code != http.StatusOK || result.Accepted || result.FailureReason != shared.FailureVideoUnavailable {
+		t.Errorf("unavailable video: status %d, result %+v", rec.Code, result)
+	}
+
+	if rec := serve(handleExtract, http.MethodPost, "/extract?dry_run=perhaps", `{"url":"https://www.youtube.com/watch?v=dQw4w9WgXcQ"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid dry_run: status %d, want 400", rec.Code)
+	}
+	assertNothingQueued(t)
+}
@@ -0,0 +1,95 @@
+// api-gateway/force_status.go
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+// forceStatusTargets are the statuses an admin may force a job into
+var forceStatusTargets = map[shared.JobStatus]bool{
+	shared.JobStatusFailed:    true,
+	shared.JobStatusCompleted: true,
+	shared.JobStatusCancelled: true,
+}
+
+// forceStatusRequest is the body of POST /admin/jobs/{job_id}/force-status
+type forceStatusRequest struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"` // Recorded on the job when forcing it to failed
+}
+
+// handleAdminForceStatus: POST /admin/jobs/{job_id}/force-status resolves a
+// job stuck in pending or processing by writing a final status directly. A
+// worker still running the job notices the change the way it notices a
+// cancellation, kills its command and leaves the forced status in place.
+func handleAdminForceStatus(w http.ResponseWriter, r *http.Request) {
+	// Auth handled by middleware
+	if r.Method != http.MethodPost {
+		shared.WriteError(w, http.StatusMethodNotAllowed, shared.ErrCodeMethodNotAllowed, "Invalid request method")
+		return
+	}
+	jobID := filepath.Base(strings.TrimSuffix(r.URL.Path, "/force-status"))
+
+	var req forceStatusRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	target := shared.JobStatus(strings.ToLower(strings.TrimSpace(req.Status)))
+	if !forceStatusTargets[target] {
+		shared.WriteError(w, http.StatusBadRequest, shared.ErrCodeInvalidRequest,
+			fmt.Sprintf("status must be %s, %s or %s", shared.JobStatusFailed, shared.JobStatusCompleted, shared.JobStatusCancelled))
+		return
+	}
+
+	job, err := db.GetJob(r.Context(), jobID)
+	if err != nil {
+		writeStoreError(w, err, http.StatusNotFound, shared.ErrCodeNotFound, "Job not found")
+		return
+	}
+	if job.IsPlaylist() {
+		shared.WriteError(w, http.StatusConflict, shared.ErrCodeConflict, "A playlist's status follows from its entries; force those instead")
+		return
+	}
+	if job.Status.IsTerminal() {
+		shared.WriteError(w, http.StatusConflict, shared.ErrCodeConflict, fmt.Sprintf("Job is already finished (status: %s)", job.Status))
+		return
+	}
+
+	previous := job.Status
+	now := time.Now()
+	job.Status = target
+	job.CompletedAt = &now
+	job.Progress = 100
+	switch target {
+	case shared.JobStatusFailed:
+		job.Error = req.Error
+		if job.Error == "" {
+			job.Error = "failed by an admin"
+		}
+	case shared.JobStatusCompleted:
+		job.Error = ""
+		job.FailureReason = ""
+		job.ExpiresAt = shared.ExpiryAfter(now, cfg.JobTTL)
+	case shared.JobStatusCancelled:
+		job.FailureReason = shared.FailureCancelled
+		job.CancelRequestedAt = &now
+	}
+	jl := shared.WithJob(logger, jobID)
+	if err := db.UpdateJob(r.Context(), job); err != nil {
+		jl.Error("Failed to force job status", "error", err)
+		writeStoreError(w, err, http.StatusInternalServerError, shared.ErrCodeInternal, "Failed to update job")
+		return
+	}
+	recordJobEvent(r.Context(), job, fmt.Sprintf("forced to %s by an admin while %s", target, previous))
+	jl.Warn("Job status forced by admin", "previous_status", previous, "status", target)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
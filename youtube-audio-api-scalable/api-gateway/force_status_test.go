@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+func TestForceFailProcessingJob(t *testing.T) {
+	setupGateway(t)
+	seedJob(t, &shared.Job{ID: "stuck", Status: shared.JobStatusProcessing, Progress: 40})
+
+	rec := serve(handleAdminForceStatus, http.MethodPost, "/admin/jobs/stuck/force-status",
+		`{"status":"failed","error":"ffmpeg hung on a broken stream"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	job, err := db.GetJob(context.Background(), "stuck")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != shared.JobStatusFailed || job.Error != "ffmpeg hung on a broken stream" || job.CompletedAt == nil {
+		t.Errorf("job %s (%q), completed at %v; want failed with the given error", job.Status, job.Error, job.CompletedAt)
+	}
+	history, _ := db.GetJobHistory(context.Background(), "stuck")
+	if len(history) == 0 || history[len(history)-1].Status != shared.JobStatusFailed ||
+		!strings.Contains(history[len(history)-1].Reason, "forced to failed") {
+		t.Errorf("history %+v, want the forced status recorded", history)
+	}
+}
+
+func TestForceStatusTargets(t *testing.T) {
+	setupGateway(t)
+	seedJob(t, &shared.Job{ID: "pending"})
+
+	rec := serve(handleAdminForceStatus, http.MethodPost, "/admin/jobs/pending/force-status", `{"status":"Completed"}`)
+	job, _ := db.GetJob(context.Background(), "pending")
+	if rec.Code != http.StatusOK || job.Status != shared.JobStatusCompleted || job.ExpiresAt == nil {
+		t.Errorf("force completed: status %d, job %s expiring %v", rec.Code, job.Status, job.ExpiresAt)
+	}
+
+	seedJob(t, &shared.Job{ID: "queued"})
+	rec = serve(handleAdminForceStatus, http.MethodPost, "/admin/jobs/queued/force-status", `{"status":"cancelled"}`)
+	job, _ = db.GetJob(context.Background(), "queued")
+	if rec.Code != http.StatusOK || job.Status != shared.JobStatusCancelled || job.FailureReason != shared.FailureCancelled {
+		t.Errorf("force cancelled: status %d, job %s (%s)", rec.Code, job.Status, job.FailureReason)
+	}
+}
+
+func TestForceStatusRejectsInvalidTargets(t *testing.T) {
+	setupGateway(t)
+	seedJob(t, &shared.Job{ID: "stuck", Status: shared.JobStatusProcessing})
+	for _, body := range []string{
+		`{"status":"processing"}`,
+		`{"status":"pending"}`,
+		`{"status":"deleted"}`,
+		`{"status":"done"}`,
+		`{}`,
+	} {
+		rec := serve(handleAdminForceStatus, http.MethodPost, "/admin/jobs/stuck/force-status", body)
+		if rec.Code != http.StatusBadRequest || errorCode(t, rec) != shared.ErrCodeInvalidRequest {
+			t.Errorf("%s: status %d: %s", body, rec.Code, rec.Body)
+		}
+	}
+	if job, _ := db.GetJob(context.Background(), "stuck"); job.Status != shared.JobStatusProcessing {
+		t.Errorf("rejected requests changed the job to %s", job.Status)
+	}
+}
+
+func TestForceStatusConflicts(t *testing.T) {
+	setupGateway(t)
+	seedJob(t, &shared.Job{ID: "done", Status: shared.JobStatusCompleted})
+	seedJob(t, &shared.Job{ID: "list", Status: shared.JobStatusProcessing, ChildIDs: []string{"a", "b"}})
+	for _, tt := range []struct {
+		id   string
+		want int
+	}{
+		{"done", http.StatusConflict},
+		{"list", http.StatusConflict},
+		{"missing", http.StatusNotFound},
+	} {
+		rec := serve(handleAdminForceStatus, http.MethodPost, "/admin/jobs/"+tt.id+"/force-status", `{"status":"failed"}`)
+		if rec.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.id, rec.Code, tt.want)
+		}
+	}
+	if job, _ := db.GetJob(context.Background(), "done"); job.Status != shared.JobStatusCompleted {
+		t.Errorf("finished job forced to %s", job.Status)
+	}
+	if rec := serve(handleAdminForceStatus, http.MethodGet, "/admin/jobs/done/force-status", ""); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: status %d, want 405", rec.Code)
+	}
+}
@@ -2,19 +2,32 @@
 package main
 
 import (
+    "context"
     "encoding/json"
+    "errors"
     "fmt"
     "log"
+    "log/slog"
+    "math"
+    "mime"
+    "net"
     "net/http"
-    "net/url"
     "os"
+    "os/signal"
     "path/filepath"
+    "slices"
+    "strconv"
     "strings"
+    "syscall"
     "time"
 
     "youtube-audio-api-scalable/shared" // Import shared package
 
     "github.com/google/uuid"
+    "github.com/prometheus/client_golang/prometheus/promhttp"
+    redis "github.com/redis/go-redis/v9"
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/trace"
 )
 
 // Global instances for our conceptual database and message queue
@@ -23,76 +36,230 @@ var (
 	db  shared.DatabaseClient
 	mq  shared.MessageQueueClient
     rl  *shared.RateLimiter
+    redisClient *redis.Client // nil when Redis is not configured
+    store       shared.Storage
+    apiKeys     shared.APIKeyStore
+    metadataCache shared.MetadataCache
+    activeJobs  shared.ActiveJobTracker
+    trustedProxies []*net.IPNet // May set the client IP via X-Forwarded-For
+    progressFeed shared.ProgressFeed // ffmpeg status lines published by workers
+    callbackDLQ  shared.CallbackDLQ  // Callbacks workers failed to deliver
+    logger      *slog.Logger
 )
 
 func main() {
 	cfg = shared.LoadConfig()
+	logger = shared.NewLogger("api-gateway", cfg.LogLevel)
+	shutdownTracing, err := shared.InitTracing("api-gateway")
+	if err != nil {
+		log.Fatalf("Failed to initialize tracing: %v", err)
+	}
 	if cfg.APIGatewayPort == "" {
 		cfg.APIGatewayPort = shared.DefaultAPIGatewayPort
 	}
 	log.Printf("API Gateway starting on port %s", cfg.APIGatewayPort)
 
-    // Try Redis-backed DB and Queue first; fallback to in-memory
-    redisClient := shared.NewRedisClient(cfg)
-    if err := shared.PingRedis(redisClient); err == nil && redisClient != nil {
-        db = shared.NewRedisDB(redisClient)
-        mq = shared.NewRedisQueue(redisClient, cfg.QueueName, cfg.QueueMaxLength)
-        log.Println("Initialized Redis-backed DB and Queue.")
-    } else {
-        db = shared.NewInMemoryDB()
-        mq = shared.NewInMemoryQueue(100)
-        log.Println("Initialized in-memory DB and Queue (Redis not configured/reachable).")
+    // Select DB and Queue backends from config (Redis when REDIS_ADDR is set)
+    if db, err = shared.NewDatabaseClient(cfg); err != nil {
+        log.Fatalf("Failed to initialize database: %v", err)
+    }
+    if mq, err = shared.NewMessageQueueClient(cfg); err != nil {
+        log.Fatalf("Failed to initialize message queue: %v", err)
+    }
+    log.Printf("Initialized DB (%T) and Queue (%T).", db, mq)
+    if store, err = shared.NewStorage(cfg); err != nil {
+        log.Fatalf("Failed to initialize storage: %v", err)
     }
-    defer mq.Close() // Ensure the queue is closed on shutdown
 
     // Rate limiter
+    redisClient = shared.NewRedisClient(cfg)
+    // REDIS_ADDR was set explicitly, so don't limp along without it
+    if err := shared.PingRedis(redisClient); err != nil {
+        log.Fatalf("FATAL: Redis at %s unreachable (REDIS_ADDR): %v", cfg.RedisAddr, err)
+    }
     rl = shared.NewRateLimiter(cfg, redisClient)
+    if err := rl.SetAllowlist(cfg.RateLimitAllowlist); err != nil {
+        log.Fatalf("FATAL: Invalid RATE_LIMIT_ALLOWLIST: %v", err)
+    }
+    if len(cfg.RateLimitAllowlist) > 0 {
+        log.Printf("INFO: Not rate limiting %d allowlisted IP range(s)", len(cfg.RateLimitAllowlist))
+    }
+    if trustedProxies, err = shared.ParseIPNets(cfg.TrustedProxies); err != nil {
+        log.Fatalf("FATAL: Invalid TRUSTED_PROXIES: %v", err)
+    }
+    apiKeys = shared.NewAPIKeyStore(redisClient)
+    metadataCache = shared.NewMetadataCache(redisClient)
+    activeJobs = shared.NewActiveJobTracker(redisClient)
+    progressFeed = shared.NewProgressFeed(redisClient)
+    callbackDLQ = shared.NewCallbackDLQ(redisClient)
+
+    if cfg.DownloadSecret == "" {
+        log.Printf("WARNING: DOWNLOAD_SECRET is not set; anyone with a job ID can download its file")
+    }
 
     // Ensure output directory exists for downloads
-    if err := os.MkdirAll(shared.OutputDir, os.ModePerm); err != nil {
-        log.Fatalf("Failed to create output dir: %v", err)
+    if err := shared.EnsureOutputDir(cfg.OutputDir); err != nil {
+        log.Fatalf("Failed to prepare output dir (OUTPUT_DIR): %v", err)
     }
 
-	http.HandleFunc("/extract", handleExtract)
-    http.HandleFunc("/status/", handleStatus)
-    http.HandleFunc("/download/", handleDownload)
+	http.HandleFunc("/extract", apiKeyMiddleware(rateLimitMiddleware(shared.RateLimitBucketExtract, handleExtract)))
+    // Metadata and formats run yt-dlp like a submission, so they share the extract bucket
+    // Batches are rate limited per URL by the handler itself
+    http.HandleFunc("/extract/batch", apiKeyMiddleware(handleExtractBatch))
+    http.HandleFunc("/metadata", rateLimitMiddleware(shared.RateLimitBucketExtract, handleMetadata))
+    http.HandleFunc("/formats", rateLimitMiddleware(shared.RateLimitBucketExtract, handleFormats))
+    http.HandleFunc("/status/", rateLimitMiddleware(shared.RateLimitBucketStatus, handleStatus))
+    http.HandleFunc("/ws/status/", rateLimitMiddleware(shared.RateLimitBucketStatus, handleStatusWebSocket))
+    http.HandleFunc("/download/", rateLimitMiddleware(shared.RateLimitBucketDownload, handleDownload))
+    http.HandleFunc("/thumbnail/", rateLimitMiddleware(shared.RateLimitBucketDownload, handleThumbnail))
+    http.HandleFunc("/cancel/", rateLimitMiddleware(shared.RateLimitBucketStatus, handleCancel))
+    http.HandleFunc("/jobs/", apiKeyMiddleware(rateLimitMiddleware(shared.RateLimitBucketExtract, handleRerun)))
 	http.HandleFunc("/health", handleHealth)
+	http.HandleFunc("/openapi.json", handleOpenAPI)
+	http.Handle("/metrics", promhttp.Handler())
+	shared.RegisterQueueDepthMetric(mq)
 
 	// Admin endpoints (with a simple middleware for auth)
 	adminRouter := http.NewServeMux()
 	adminRouter.HandleFunc("/admin/jobs", handleAdminListJobs)
 	adminRouter.HandleFunc("/admin/jobs/", handleAdminGetJob)
+	adminRouter.HandleFunc("/admin/jobs/bulk-delete", handleAdminBulkDelete)
+	adminRouter.HandleFunc("/admin/jobs/search", handleAdminSearchJobs)
 	adminRouter.HandleFunc("/admin/delete/", handleAdminDeleteJob)
+	adminRouter.HandleFunc("/admin/apikeys", handleAdminCreateAPIKey)
+	adminRouter.HandleFunc("/admin/stats", handleAdminStats)
+	adminRouter.HandleFunc("/admin/dlq", handleAdminListDeadLetters)
+	adminRouter.HandleFunc("/admin/dlq/", handleAdminRequeueDeadLetter)
+	adminRouter.HandleFunc("/admin/callbacks/dlq", handleAdminListCallbacks)
+	adminRouter.HandleFunc("/admin/callbacks/dlq/", handleAdminRedeliverCallback)
+	adminRouter.HandleFunc("/admin/apikeys/", handleAdminRevokeAPIKey)
+	adminRouter.HandleFunc("/admin/ratelimit/", handleAdminRateLimit)
 	// adminRouter.HandleFunc("/admin/cache", handleAdminGetCache) // Cache endpoints for later
 	// adminRouter.HandleFunc("/admin/cache/clear", handleAdminClearCache)
 
 	http.Handle("/admin/", adminAuthMiddleware(adminRouter))
 
+	// Long-lived requests (status streams) derive from baseCtx and end when shutdown begins
+	baseCtx, cancelBase := context.WithCancel(context.Background())
+	server := &http.Server{
+		Addr:        ":" + cfg.APIGatewayPort,
+		Handler:     shared.CompressionMiddleware(http.DefaultServeMux),
+		BaseContext: func(net.Listener) context.Context { return baseCtx },
+	}
+	server.RegisterOnShutdown(cancelBase)
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("API Gateway server failed: %v", err)
+		}
+	}()
 	fmt.Printf("🚀 API Gateway Server running on http://localhost:%s\n", cfg.APIGatewayPort)
-	log.Fatal(http.ListenAndServe(":"+cfg.APIGatewayPort, nil))
+
+	// Wait for SIGINT/SIGTERM, then let in-flight requests finish
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	s := <-sig
+	log.Printf("INFO: Received %s, shutting down API Gateway...", s)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("WARN: HTTP server shutdown: %v", err)
+	}
+	mq.Close()
+	if err := shutdownTracing(ctx); err != nil {
+		log.Printf("WARN: Failed to flush traces: %v", err)
+	}
+	log.Println("INFO: API Gateway stopped.")
+}
+
+// Enable CORS for browser requests. The request's Origin is echoed back only
+// if it is in AllowedOrigins; '*' is sent only when the allowlist contains '*'.
+// Preflight requests also get the methods and headers of the route.
+func enableCORS(w http.ResponseWriter, r *http.Request) {
+    w.Header().Add("Vary", "Origin")
+    origin := r.Header.Get("Origin")
+    switch {
+    case originAllowed("*"):
+        w.Header().Set("Access-Control-Allow-Origin", "*")
+    case origin != "" && originAllowed(origin):
+        w.Header().Set("Access-Control-Allow-Origin", origin)
+        w.Header().Set("Access-Control-Allow-Credentials", "true")
+    default:
+        return // Not allowed: omit CORS headers so the browser blocks the response
+    }
+    if r.Method != http.MethodOptions {
+        return // The rest only matters to preflight requests
+    }
+    route, ok := corsRouteFor(r.URL.Path)
+    if !ok {
+        return
+    }
+    w.Header().Set("Access-Control-Allow-Methods", route.methods)
+    if route.headers != "" {
+        w.Header().Set("Access-Control-Allow-Headers", route.headers)
+    }
+    w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(cfg.CORSMaxAge.Seconds())))
+}
+
+// corsRoute is what a route accepts from browsers, for preflight responses
+type corsRoute struct {
+    path    string // Exact path, or a prefix when it ends in /
+    methods string
+    headers string // Non-safelisted request headers the route reads
 }
 
-// Enable CORS for browser requests
-func enableCORS(w http.ResponseWriter) {
-    // For simplicity, allow '*' unless specific origins configured
-    origin := "*"
-    if len(cfg.AllowedOrigins) == 1 && cfg.AllowedOrigins[0] == "*" {
-        origin = "*"
-    } else {
-        // In production, you would reflect the Origin if it's in the allowlist
-        origin = strings.Join(cfg.AllowedOrigins, ",")
+// corsRoutes mirrors the handlers registered in main; the first match wins,
+// so exact paths go before prefixes that cover them
+var corsRoutes = []corsRoute{
+    {"/extract", "POST, OPTIONS", "Content-Type, " + shared.APIKeyHeader + ", " + idempotencyKeyHeader},
+    {"/extract/batch", "POST, OPTIONS", "Content-Type, " + shared.APIKeyHeader},
+    {"/metadata", "POST, OPTIONS", "Content-Type"},
+    {"/formats", "POST, OPTIONS", "Content-Type"},
+    {"/status/", "GET, OPTIONS", ""},
+    {"/download/", "GET, HEAD, OPTIONS", "Range, If-Range, If-None-Match, If-Modified-Since"},
+    {"/thumbnail/", "GET, HEAD, OPTIONS", "If-None-Match, If-Modified-Since"},
+    {"/cancel/", "POST, OPTIONS", ""},
+    {"/jobs/", "POST, OPTIONS", shared.APIKeyHeader},
+    {"/health", "GET, OPTIONS", ""},
+    {"/openapi.json", "GET, HEAD, OPTIONS", ""},
+    {"/admin/jobs", "GET, OPTIONS", "Authorization"},
+    {"/admin/jobs/bulk-delete", "POST, OPTIONS", "Content-Type, Authorization"},
+    {"/admin/jobs/", "GET, POST, OPTIONS", "Content-Type, Authorization"},
+    {"/admin/delete/", "DELETE, OPTIONS", "Authorization"},
+    {"/admin/apikeys", "POST, OPTIONS", "Content-Type, Authorization"},
+    {"/admin/apikeys/", "DELETE, OPTIONS", "Authorization"},
+    {"/admin/stats", "GET, OPTIONS", "Authorization"},
+    {"/admin/dlq", "GET, OPTIONS", "Authorization"},
+    {"/admin/dlq/", "POST, OPTIONS", "Authorization"},
+    {"/admin/callbacks/dlq", "GET, OPTIONS", "Authorization"},
+    {"/admin/callbacks/dlq/", "POST, OPTIONS", "Authorization"},
+    {"/admin/ratelimit/", "GET, DELETE, OPTIONS", "Authorization"},
+}
+
+// corsRouteFor returns the corsRoute matching path
+func corsRouteFor(path string) (corsRoute, bool) {
+    for _, route := range corsRoutes {
+        if route.path == path || (strings.HasSuffix(route.path, "/") && strings.HasPrefix(path, route.path)) {
+            return route, true
+        }
+    }
+    return corsRoute{}, false
+}
+
+// originAllowed reports whether origin is in AllowedOrigins (case-insensitive, ignoring a trailing slash)
+func originAllowed(origin string) bool {
+    origin = strings.TrimRight(strings.ToLower(origin), "/")
+    for _, o := range cfg.AllowedOrigins {
+        if strings.TrimRight(strings.ToLower(o), "/") == origin {
+            return true
+        }
     }
-    w.Header().Set("Access-Control-Allow-Origin", origin)
-    w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS, DELETE")
-    w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-    w.Header().Set("Vary", "Origin")
-    w.Header().Set("Access-Control-Max-Age", "600")
+    return false
 }
 
 // adminAuthMiddleware provides a basic bearer token authentication for admin routes
 func adminAuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		enableCORS(w) // CORS for admin too
+		enableCORS(w, r) // CORS for admin too
 		if r.Method == http.MethodOptions {
             w.WriteHeader(http.StatusOK)
 			return
@@ -100,283 +267,1633 @@ func adminAuthMiddleware(next http.Handler) http.Handler {
 
 		token := r.Header.Get("Authorization")
         if strings.TrimSpace(cfg.AdminToken) == "" {
-            http.Error(w, "Admin token not configured", http.StatusServiceUnavailable)
+            shared.WriteError(w, http.StatusServiceUnavailable, shared.ErrCodeUnavailable, "Admin token not configured")
             return
         }
         if token != "Bearer "+cfg.AdminToken { // Simple bearer token auth
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			shared.WriteError(w, http.StatusUnauthorized, shared.ErrCodeUnauthorized, "Unauthorized")
 			return
 		}
 		next.ServeHTTP(w, r)
 	})
 }
 
+// decodeJSON decodes the request body into v, strictly and up to
+// shared.MaxJSONBodySize bytes. On failure it writes the error response and returns false.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+    if err := shared.DecodeJSONBody(w, r, v, shared.MaxJSONBodySize); err != nil {
+        err.Write(w)
+        return false
+    }
+    return true
+}
+
+// rateLimitMiddleware enforces the per-IP request limit of bucket before calling next
+func rateLimitMiddleware(bucket string, next http.HandlerFunc) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        if r.Method == http.MethodOptions {
+            next(w, r)
+            return
+        }
+        if !allowRequests(w, r, bucket, 1) {
+            return
+        }
+        next(w, r)
+    }
+}
+
+// allowRequests counts n requests from the client against bucket. Over the
+// limit, it writes the 429 response and returns false.
+func allowRequests(w http.ResponseWriter, r *http.Request, bucket string, n int) bool {
+    ok, remaining := rl.AllowN(bucket, clientIP(r), n)
+    if remaining < 0 {
+        remaining = 0
+    }
+    w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+    if ok {
+        return true
+    }
+    enableCORS(w, r)
+    // Fixed one-minute windows: retry once the current window rolls over.
+    // A sliding window frees up within a minute at most.
+    retryAfter := 60 - int(time.Now().Unix()%60)
+    if cfg.RateLimitStrategy == shared.RateLimitStrategySliding {
+        retryAfter = 60
+    }
+    w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+    shared.WriteErrorDetails(w, http.StatusTooManyRequests, shared.ErrCodeRateLimited, "Rate limit exceeded", map[string]any{
+        "remaining":   remaining,
+        "retry_after": retryAfter,
+    })
+    return false
+}
+
+// clientIP is the IP rate and job limits apply to; proxy headers count only
+// from trustedProxies
+func clientIP(r *http.Request) string {
+    return shared.ClientIP(r, trustedProxies)
+}
+
+// allowActiveJobs checks that the client may start n more jobs without going
+// over cfg.MaxActiveJobsPerIP. Over the limit, it writes the 429 response and
+// returns false. Concurrent submissions may overshoot the limit slightly.
+func allowActiveJobs(w http.ResponseWriter, r *http.Request, n int) bool {
+    if cfg.MaxActiveJobsPerIP <= 0 {
+        return true
+    }
+    ip := clientIP(r)
+    active, err := activeJobs.Count(r.Context(), db, ip)
+    if err != nil {
+        logger.Warn("Failed to count active jobs, allowing request", "ip", ip, "error", err)
+        return true
+    }
+    if active+n <= cfg.MaxActiveJobsPerIP {
+        return true
+    }
+    enableCORS(w, r)
+    shared.WriteErrorDetails(w, http.StatusTooManyRequests, shared.ErrCodeTooManyJobs,
+        "Too many active jobs; wait for some to finish", map[string]any{
+            "active_jobs": active,
+            "limit":       cfg.MaxActiveJobsPerIP,
+        })
+    return false
+}
+
+// queueFullRetryAfter is the Retry-After sent when the queue is full and
+// there is no processing time average to estimate the drain from
+const queueFullRetryAfter = 60 * time.Second
+
+// allowQueueDepth refuses n new jobs while the queue holds more than
+// cfg.MaxQueueDepth. It writes a 503 with a Retry-After estimating when the
+// backlog will have drained enough, and returns false.
+func allowQueueDepth(w http.ResponseWriter, r *http.Request, n int) bool {
+    if cfg.MaxQueueDepth <= 0 {
+        return true
+    }
+    depth, err := mq.Depth(r.Context())
+    if err != nil {
+        logger.Warn("Failed to read queue depth, allowing request", "error", err)
+        return true
+    }
+    if depth+int64(n) <= int64(cfg.MaxQueueDepth) {
+        return true
+    }
+    retryAfter := queueFullRetryAfter
+    if avg, ok, err := db.AverageProcessingTime(r.Context()); err == nil && ok {
+        retryAfter = shared.EstimateWait(depth+int64(n)-int64(cfg.MaxQueueDepth), cfg.MaxWorkers, avg)
+    }
+    seconds := int(math.Max(1, math.Ceil(retryAfter.Seconds())))
+    enableCORS(w, r)
+    w.Header().Set("Retry-After", strconv.Itoa(seconds))
+    shared.WriteErrorDetails(w, http.StatusServiceUnavailable, shared.ErrCodeQueueFull,
+        "Too many jobs are queued; try again later", map[string]any{
+            "queue_depth": depth,
+            "limit":       cfg.MaxQueueDepth,
+            "retry_after": seconds,
+        })
+    return false
+}
+
+// writeStoreError responds with a retryable 503 when err means the job store
+// or queue is unreachable for now, and with status, code and msg otherwise
+func writeStoreError(w http.ResponseWriter, err error, status int, code, msg string) {
+    if errors.Is(err, shared.ErrStorageUnavailable) {
+        w.Header().Set("Retry-After", "5")
+        shared.WriteError(w, http.StatusServiceUnavailable, shared.ErrCodeStorageUnavailable, "Storage temporarily unavailable")
+        return
+    }
+    shared.WriteError(w, status, code, msg)
+}
+
+// trackActiveJob counts a submitted job against the client's active job limit
+func trackActiveJob(r *http.Request, jobID string) {
+    if cfg.MaxActiveJobsPerIP <= 0 {
+        return
+    }
+    if err := activeJobs.Add(r.Context(), clientIP(r), jobID); err != nil {
+        shared.WithJob(logger, jobID).Warn("Failed to track active job", "error", err)
+    }
+}
+
+// apiKeyMiddleware validates the X-API-Key header and enforces the key's daily
+// quota. The header is optional unless RequireAPIKey is set, but a key that is
+// sent must be valid.
+func apiKeyMiddleware(next http.HandlerFunc) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        if r.Method == http.MethodOptions {
+            next(w, r)
+            return
+        }
+        plaintext := strings.TrimSpace(r.Header.Get(shared.APIKeyHeader))
+        if plaintext == "" {
+            if cfg.RequireAPIKey {
+                enableCORS(w, r)
+                shared.WriteError(w, http.StatusUnauthorized, shared.ErrCodeUnauthorized, "API key required")
+                return
+            }
+            next(w, r)
+            return
+        }
+        key, err := apiKeys.Lookup(plaintext)
+        if err != nil {
+            enableCORS(w, r)
+            shared.WriteError(w, http.StatusUnauthorized, shared.ErrCodeUnauthorized, "Invalid API key")
+            return
+        }
+        if key.DailyQuota > 0 {
+            used, err := apiKeys.IncrementUsage(key)
+            if err != nil {
+                logger.Warn("Failed to count API key usage", "key_id", key.ID, "error", err)
+            } else {
+                remaining := key.DailyQuota - used
+                if remaining < 0 {
+                    remaining = 0
+                }
+                w.Header().Set("X-Quota-Remaining", strconv.Itoa(remaining))
+                if used > key.DailyQuota {
+                    enableCORS(w, r)
+                    shared.WriteErrorDetails(w, http.StatusTooManyRequests, shared.ErrCodeQuotaExceeded, "Daily quota exceeded", map[string]any{
+                        "daily_quota": key.DailyQuota,
+                    })
+                    return
+                }
+            }
+        }
+        next(w, r)
+    }
+}
+
 // handleExtract: Starts a job, pushes to queue, and returns immediately
 func handleExtract(w http.ResponseWriter, r *http.Request) {
-	enableCORS(w)
+	enableCORS(w, r)
 	if r.Method == http.MethodOptions {
         w.WriteHeader(http.StatusOK)
         return
 	}
 	if r.Method != http.MethodPost {
-		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		shared.WriteError(w, http.StatusMethodNotAllowed, shared.ErrCodeMethodNotAllowed, "Invalid request method")
 		return
 	}
 
+	// Root span for the submission; the worker continues it via JobMessage.TraceContext
+	ctx, span := shared.Tracer().Start(r.Context(), "extract")
+	defer span.End()
+	r = r.WithContext(ctx)
+
 	var req shared.Request // Use shared.Request
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
-		return
-	}
-    if req.URL == "" {
-		http.Error(w, "Missing YouTube URL", http.StatusBadRequest)
+	if !decodeJSON(w, r, &req) {
 		return
 	}
+    opts, ok := validateExtractOptions(w, r, &req, false)
+    if !ok {
+        return
+    }
+    format, bitrate := opts.Format, opts.Bitrate
 
-    // Basic URL validation and allowed host check
-    parsed, err := url.Parse(req.URL)
-    if err != nil || parsed.Scheme == "" || parsed.Host == "" {
-        http.Error(w, "Invalid URL", http.StatusBadRequest)
+    if dryRun, ok := isDryRun(w, r, &req); !ok {
+        return
+    } else if dryRun {
+        handleExtractDryRun(w, r, req, opts)
         return
     }
-    allowed := false
-    host := strings.ToLower(parsed.Host)
-    for _, h := range cfg.AllowedVideoHosts {
-        if h == "*" || strings.HasSuffix(host, strings.ToLower(h)) {
-            allowed = true
-            break
+
+    // Playlists fan out into one child job per entry
+    if shared.IsPlaylistURL(req.URL) {
+        if opts.IsClip() {
+            shared.WriteError(w, http.StatusBadRequest, shared.ErrCodeInvalidRequest, "start_time and end_time are not supported for playlists")
+            return
         }
-    }
-    if !allowed {
-        http.Error(w, "Host not allowed", http.StatusBadRequest)
+        handlePlaylistExtract(w, r, req, format, bitrate)
         return
     }
 
-    // Simple rate limiting per IP
-    ip := shared.GetClientIP(r)
-    if ok, _ := rl.Allow(ip); !ok {
-        http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+    // Result cache: reuse a completed job for the same video and output settings
+    if cached := findCachedJob(r.Context(), req, opts); cached != nil {
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(map[string]any{
+            "job_id":            cached.ID,
+            "status":            string(cached.Status),
+            "download_endpoint": downloadURL(cached.ID),
+            "cached":            true,
+            "message":           "This video was already converted. Download it from download_endpoint.",
+        })
         return
     }
 
-	jobID := uuid.New().String()
-	now := time.Now()
+	if !allowQueueDepth(w, r, 1) || !allowActiveJobs(w, r, 1) {
+		return
+	}
+	var job *shared.Job
+	responded := false
+	err := withFreshJobID(func(jobID string) (err error) {
+		// Each ID tried gets its own claim on the Idempotency-Key
+		release, ok := claimIdempotencyKey(w, r, jobID)
+		if !ok {
+			responded = true
+			return nil
+		}
+		if job, err = submitJob(ctx, jobID, req.URL, req, opts); job == nil {
+			release() // Nothing was created, so a retry may claim the key again
+		}
+		return err
+	})
+	if responded {
+		return // Replayed or rejected by claimIdempotencyKey
+	}
+	if err != nil {
+		if job == nil {
+			writeStoreError(w, err, http.StatusInternalServerError, shared.ErrCodeInternal, "Failed to initialize job")
+		} else {
+			writeStoreError(w, err, http.StatusInternalServerError, shared.ErrCodeInternal, "Failed to submit job to processing queue")
+		}
+		return
+	}
+	jobID := job.ID
+	span.SetAttributes(attribute.String("job.id", jobID))
+	trackActiveJob(r, jobID)
+
+	// Respond immediately to client
+	resp := map[string]any{
+        "job_id":       jobID,
+        "status":       string(job.Status),
+        "message":      "Audio extraction started. Check status at /status/" + jobID,
+        "instructions": "A worker service will process this job and update its status. Polling /status/{job_id} is recommended.",
+    }
+    if wait, ok := estimatedWaitSeconds(r.Context()); ok {
+        resp["estimated_wait_seconds"] = wait
+    }
+	w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(resp)
+}
+
+// extractOptions are the validated output settings of a submission; a batch
+// applies them to every URL
+type extractOptions struct {
+	Format    string
+	Bitrate   string
+	ClipStart float64
+	ClipEnd   float64
+	Priority  shared.Priority
+}
+
+// IsClip reports whether only part of each video is converted
+func (o extractOptions) IsClip() bool {
+	return o.ClipStart > 0 || o.ClipEnd > 0
+}
+
+// validateExtractOptions checks every field of req with shared.ValidateRequest
+// and normalizes it in place. A batch's URLs are checked one by one by its
+// handler, so its empty url field is ignored. On failure it writes the error
+// response, listing every invalid field, and returns false.
+func validateExtractOptions(w http.ResponseWriter, r *http.Request, req *shared.Request, batch bool) (extractOptions, bool) {
+	var opts extractOptions
+	errs := shared.ValidateRequest(req, cfg)
+	if batch {
+		errs = slices.DeleteFunc(errs, func(e shared.FieldError) bool { return e.Field == "url" })
+	}
+	if len(errs) > 0 {
+		writeValidationErrors(w, errs)
+		return opts, false
+	}
+	opts.Format, opts.Bitrate = req.Format, req.Bitrate
+	opts.ClipStart, opts.ClipEnd, _ = shared.ValidateClipRange(req.StartTime, req.EndTime) // Already checked
+	opts.Priority = shared.Priority(req.Priority)
+	// Jumping the queue is reserved for API key holders (validated by apiKeyMiddleware)
+	if opts.Priority == shared.PriorityHigh && strings.TrimSpace(r.Header.Get(shared.APIKeyHeader)) == "" {
+		shared.WriteError(w, http.StatusForbidden, shared.ErrCodeForbidden, "priority high requires an API key")
+		return opts, false
+	}
+	return opts, true
+}
+
+// writeValidationErrors writes a 422 response listing every invalid field
+func writeValidationErrors(w http.ResponseWriter, errs []shared.FieldError) {
+	msgs := make([]string, len(errs))
+	for i, e := range errs {
+		msgs[i] = e.Field + ": " + e.Message
+	}
+	shared.WriteErrorDetails(w, http.StatusUnprocessableEntity, shared.ErrCodeValidationFailed, strings.Join(msgs, "; "),
+		map[string]any{"fields": errs})
+}
+
+// canonicalURL returns the URL to fetch videoURL from: its canonical form when
+// cfg.CanonicalizeURLs is set, without a timestamp for clips, which carry
+// their own range. URLs that aren't YouTube videos are returned unchanged.
+func canonicalURL(videoURL string, clip bool) string {
+	if !cfg.CanonicalizeURLs {
+		return videoURL
+	}
+	if clip {
+		if videoID, err := shared.NormalizeVideoID(videoURL); err == nil {
+			return shared.WatchURL(videoID)
+		}
+		return videoURL
+	}
+	if canonical, err := shared.CanonicalizeURL(videoURL); err == nil {
+		return canonical
+	}
+	return videoURL
+}
+
+// findCachedJob returns a completed job whose output can be served for
+// req.URL with opts, or nil if there is none
+func findCachedJob(ctx context.Context, req shared.Request, opts extractOptions) *shared.Job {
+	videoID, _ := shared.NormalizeVideoID(canonicalURL(req.URL, opts.IsClip()))
+	customLayout := req.SampleRate != 0 || req.Channels != ""
+	if videoID == "" || opts.IsClip() || req.Normalize || customLayout || req.FormatID != "" {
+		return nil
+	}
+	if len(req.ClientMetadata) > 0 {
+		return nil // A shared job can't carry this caller's metadata
+	}
+	cached, err := db.FindCompletedJob(ctx, videoID, opts.Format, opts.Bitrate)
+	if err != nil || !outputAvailable(cached) {
+		return nil
+	}
+	if _, ok := cached.Artifact(shared.ArtifactSubtitles); req.WithSubtitles && !ok && !cached.WithSubtitles {
+		return nil // Its captions were never fetched; a video without any is fine to reuse
+	}
+	shared.WithJob(logger, cached.ID).Info("Cache hit", "video_id", videoID, "format", opts.Format, "bitrate", opts.Bitrate)
+	return cached
+}
+
+// maxJobIDAttempts bounds how many fresh IDs are tried for a new job whose ID
+// is already taken, e.g. by a UUID collision
+const maxJobIDAttempts = 3
+
+// newJobID returns a random ID for a new job; tests replace it to force collisions
+var newJobID = func() string { return uuid.New().String() }
+
+// withFreshJobID calls create with a new job ID, and again with another one
+// while it fails with shared.ErrJobExists, up to maxJobIDAttempts times
+func withFreshJobID(create func(jobID string) error) error {
+	var err error
+	for attempt := 1; attempt <= maxJobIDAttempts; attempt++ {
+		jobID := newJobID()
+		if err = create(jobID); !errors.Is(err, shared.ErrJobExists) {
+			return err
+		}
+		shared.WithJob(logger, jobID).Warn("Job ID already taken, retrying with a new one", "attempt", attempt)
+	}
+	return err
+}
+
+// submitJob creates job jobID for videoURL in the DB and publishes it to the
+// queue. If the job can't be created it returns a nil job; if it can't be
+// queued, it returns the job marked failed along with the error.
+func submitJob(ctx context.Context, jobID string, videoURL string, req shared.Request, opts extractOptions) (*shared.Job, error) {
+	fetchURL := canonicalURL(videoURL, opts.IsClip())
+	videoID, _ := shared.NormalizeVideoID(fetchURL)
+	embedTags := cfg.EmbedTags
+	if req.EmbedTags != nil {
+		embedTags = *req.EmbedTags
+	}
 	job := &shared.Job{ // Use shared.Job
-		ID:          jobID,
-		OriginalURL: req.URL,
-		Status:      shared.JobStatusPending,
-		CreatedAt:   now,
+		ID:             jobID,
+		OriginalURL:    videoURL,
+		Status:         shared.JobStatusPending,
+		CreatedAt:      time.Now(),
+		Format:         opts.Format,
+		Bitrate:        opts.Bitrate,
+		OutputExt:      shared.AudioFormats[opts.Format].Ext,
+		VideoID:        videoID,
+		CallbackURL:    req.CallbackURL,
+		ClipStart:      opts.ClipStart,
+		ClipEnd:        opts.ClipEnd,
+		Normalize:      req.Normalize,
+		SampleRate:     req.SampleRate,
+		Channels:       req.Channels,
+		FormatID:       req.FormatID,
+		EmbedTags:      embedTags,
+		Priority:       opts.Priority,
+		WithSubtitles:  req.WithSubtitles,
+		ClientMetadata: req.ClientMetadata,
 	}
+	if fetchURL != videoURL {
+		job.CanonicalURL = fetchURL
+	}
+	jl := shared.WithJob(logger, jobID)
 
 	// 1. Store initial job status in DB
-	if err := db.CreateJob(job); err != nil {
-		log.Printf("ERROR: Failed to create job %s in DB: %v", jobID, err)
-		http.Error(w, "Failed to initialize job", http.StatusInternalServerError)
-		return
+	if err := db.CreateJob(ctx, job); err != nil {
+		jl.Error("Failed to create job in DB", "error", err)
+		return nil, err
 	}
-	log.Printf("INFO: Job %s created in DB with status %s", jobID, job.Status)
+	jl.Info("Job created in DB", "status", job.Status, "url", videoURL)
+	recordJobEvent(ctx, job, "submitted")
 
-    // 2. Publish job to message queue
+	// 2. Publish job to message queue
 	jobMessage := shared.JobMessage{
-		JobID:       jobID,
-		OriginalURL: req.URL,
+		JobID:         jobID,
+		OriginalURL:   fetchURL,
+		Format:        opts.Format,
+		Bitrate:       opts.Bitrate,
+		EmbedTags:     embedTags,
+		ClipStart:     opts.ClipStart,
+		ClipEnd:       opts.ClipEnd,
+		Normalize:     req.Normalize,
+		SampleRate:    req.SampleRate,
+		Channels:      req.Channels,
+		FormatID:      req.FormatID,
+		Cookies:       req.Cookies,
+		Priority:      opts.Priority,
+		WithSubtitles: req.WithSubtitles,
 	}
-	if err := mq.Publish(jobMessage); err != nil {
-		log.Printf("ERROR: Failed to publish job %s to queue: %v", jobID, err)
+	jobMessage.TraceContext = shared.InjectTraceContext(ctx)
+	if err := mq.Publish(ctx, jobMessage); err != nil {
+		jl.Error("Failed to publish job to queue", "error", err)
+		trace.SpanFromContext(ctx).RecordError(err)
 		// Mark job as failed in DB since it couldn't be queued
 		job.Status = shared.JobStatusFailed
 		job.Error = fmt.Sprintf("Failed to queue job: %v", err)
-		db.UpdateJob(job) // Attempt to update status in DB
-		http.Error(w, "Failed to submit job to processing queue", http.StatusInternalServerError)
-		return
+		if db.UpdateJob(ctx, job) == nil { // Attempt to update status in DB
+			recordJobEvent(ctx, job, job.Error)
+		}
+		return job, err
 	}
-	log.Printf("INFO: Job %s published to message queue", jobID)
+	jl.Info("Job published to message queue")
+	shared.JobsCreatedTotal.Inc()
+	return job, nil
+}
 
-	// 3. Respond immediately to client
-	w.Header().Set("Content-Type", "application/json")
+// recordJobEvent adds the job's new status to its history
+func recordJobEvent(ctx context.Context, job *shared.Job, reason string) {
+	shared.RecordJobEvent(ctx, db, logger, "api-gateway", job, reason)
+}
+
+// idempotencyKeyHeader lets clients retry /extract without creating duplicate jobs
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// claimIdempotencyKey reserves the request's Idempotency-Key for jobID. If the
+// key was used before, it writes the earlier job as the response and returns
+// false. The returned release func frees the key if the job is not created.
+func claimIdempotencyKey(w http.ResponseWriter, r *http.Request, jobID string) (func(), bool) {
+    noop := func() {}
+    key := strings.TrimSpace(r.Header.Get(idempotencyKeyHeader))
+    if key == "" {
+        return noop, true
+    }
+    if len(key) > 255 {
+        shared.WriteError(w, http.StatusBadRequest, shared.ErrCodeInvalidRequest, "Idempotency-Key must be at most 255 characters")
+        return noop, false
+    }
+    // Scope keys to the API key (or client IP) so clients can't collide with each other
+    scope := clientIP(r)
+    if apiKey := r.Header.Get(shared.APIKeyHeader); apiKey != "" {
+        scope = shared.HashAPIKey(apiKey)
+    }
+    scoped := scope + ":" + key
+
+    existingID, claimed, err := db.ClaimIdempotencyKey(r.Context(), scoped, jobID, cfg.IdempotencyTTL)
+    if err != nil {
+        logger.Error("Failed to claim idempotency key", "error", err)
+        shared.WriteError(w, http.StatusInternalServerError, shared.ErrCodeInternal, "Failed to initialize job")
+        return noop, false
+    }
+    if claimed {
+        return func() {
+            if err := db.ReleaseIdempotencyKey(r.Context(), scoped); err != nil {
+                logger.Warn("Failed to release idempotency key", "error", err)
+            }
+        }, true
+    }
+
+    existing, err := db.GetJob(r.Context(), existingID)
+    if err != nil {
+        // The first request holds the key but hasn't stored its job yet
+        shared.WriteError(w, http.StatusConflict, shared.ErrCodeConflict, "A request with this Idempotency-Key is still in progress")
+        return noop, false
+    }
+    shared.WithJob(logger, existing.ID).Info("Idempotent replay", "idempotency_key", key)
+    w.Header().Set("Idempotent-Replayed", "true")
+    w.Header().Set("Content-Type", "application/json")
     json.NewEncoder(w).Encode(map[string]string{
-        "job_id":       jobID,
-        "status":       string(job.Status),
-        "message":      "Audio extraction started. Check status at /status/" + jobID,
-        "instructions": "A worker service will process this job and update its status. Polling /status/{job_id} is recommended.",
+        "job_id":  existing.ID,
+        "status":  string(existing.Status),
+        "message": "A job was already created for this Idempotency-Key. Check status at /status/" + existing.ID,
     })
-	fmt.Printf("🎬 API Gateway received job %s for URL: %s\n", jobID, req.URL)
+    return noop, false
 }
 
-// handleDownload: Streams the generated MP3 file to the client
+// handleDownload: Streams the converted audio file to the client, or another
+// of the job's artifacts at /download/{job_id}/{artifact}
 func handleDownload(w http.ResponseWriter, r *http.Request) {
-    enableCORS(w)
+    enableCORS(w, r)
     if r.Method == http.MethodOptions {
         w.WriteHeader(http.StatusOK)
         return
     }
-    if r.Method != http.MethodGet {
-        http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+    if r.Method != http.MethodGet && r.Method != http.MethodHead {
+        shared.WriteError(w, http.StatusMethodNotAllowed, shared.ErrCodeMethodNotAllowed, "Invalid request method")
         return
     }
-    jobID := filepath.Base(r.URL.Path)
-    job, err := db.GetJob(jobID)
-    if err != nil || job.Status != shared.JobStatusCompleted || job.FilePath == "" {
-        http.Error(w, "File not available", http.StatusNotFound)
+    // Extract job ID and artifact from /download/{job_id}[/{artifact}]
+    jobID, artifact, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/download/"), "/")
+    if !verifyDownloadLink(w, r, jobID) {
         return
     }
-    // Serve file with appropriate headers
-    w.Header().Set("Content-Type", "audio/mpeg")
-    w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.mp3\"", jobID))
-    // Let http.ServeFile handle range requests and efficient serving
-    http.ServeFile(w, r, job.FilePath)
-}
-
-// handleStatus: Checks job status from the database
-func handleStatus(w http.ResponseWriter, r *http.Request) {
-	enableCORS(w)
-	if r.Method == http.MethodOptions {
-        w.WriteHeader(http.StatusOK)
+    job, err := db.GetJob(r.Context(), jobID)
+    if err != nil {
+        writeStoreError(w, err, http.StatusNotFound, shared.ErrCodeNotFound, "Job not found")
         return
-	}
-    if r.Method != http.MethodGet {
-        http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+    }
+    if job.Status != shared.JobStatusCompleted {
+        shared.WriteError(w, http.StatusConflict, shared.ErrCodeConflict, fmt.Sprintf("Job is not completed (status: %s)", job.Status))
+        return
+    }
+    if artifact != "" && artifact != string(shared.ArtifactAudio) {
+        a, ok := job.Artifact(shared.ArtifactType(artifact))
+        if !ok {
+            shared.WriteError(w, http.StatusNotFound, shared.ErrCodeNotFound, fmt.Sprintf("Job has no %q artifact", artifact))
+            return
+        }
+        serveArtifact(w, r, job, a)
+        return
+    }
+    if key := job.AudioKey(); key != "" && cfg.StorageBackend != shared.StorageBackendLocal {
+        // Remote storage: hand out a fresh signed URL instead of proxying the bytes
+        signed, err := store.SignedURL(key, cfg.SignedURLTTL)
+        if err != nil {
+            shared.WithJob(logger, jobID).Error("Failed to sign download URL", "error", err)
+            shared.WriteError(w, http.StatusInternalServerError, shared.ErrCodeInternal, "File not available")
+            return
+        }
+        http.Redirect(w, r, signed, http.StatusFound)
         return
     }
 
-	jobID := filepath.Base(r.URL.Path) // Extract job ID from /status/{job_id}
+    af := shared.FormatForExt(job.OutputExt)
+    f, err := os.Open(filepath.Join(cfg.OutputDir, shared.OutputFileName(jobID, af.Ext, job.ClipStart, job.ClipEnd)))
+    if err != nil {
+        shared.WriteError(w, http.StatusNotFound, shared.ErrCodeNotFound, "File not available")
+        return
+    }
+    defer f.Close()
+    info, err := f.Stat()
+    if err != nil || info.IsDir() {
+        shared.WriteError(w, http.StatusNotFound, shared.ErrCodeNotFound, "File not available")
+        return
+    }
 
-	job, err := db.GetJob(jobID)
-	if err != nil {
-		http.Error(w, "Job not found", http.StatusNotFound)
-		return
-	}
+    name := shared.DownloadFilename(cfg.FilenameTemplate, job)
+    w.Header().Set("Content-Type", af.ContentType)
+    w.Header().Set("Content-Disposition", shared.ContentDisposition(name+"."+af.Ext))
+    w.Header().Set("ETag", fileETag(info))
+    // ServeContent handles HEAD, range requests and conditional headers
+    // (If-None-Match against the ETag, If-Modified-Since against Last-Modified)
+    http.ServeContent(w, r, name+"."+af.Ext, info.ModTime(), f)
+}
 
-    // For completed jobs, include a direct download URL if not set
-    if job.Status == shared.JobStatusCompleted && job.DownloadEndpoint == "" {
-        base := cfg.PublicAPIBaseURL
-        if strings.TrimSpace(base) == "" {
-            base = fmt.Sprintf("http://localhost:%s", cfg.APIGatewayPort)
+// verifyDownloadLink checks the token of a link to jobID's files when
+// cfg.DownloadSecret is set. On failure it writes a 403 and returns false.
+func verifyDownloadLink(w http.ResponseWriter, r *http.Request, jobID string) bool {
+    if cfg.DownloadSecret == "" {
+        return true
+    }
+    if err := shared.VerifyDownloadToken(cfg.DownloadSecret, jobID, r.URL.Query(), time.Now()); err != nil {
+        msg := "Invalid download link"
+        if errors.Is(err, shared.ErrDownloadTokenExpired) {
+            msg = "Download link expired"
         }
-        job.DownloadEndpoint = fmt.Sprintf("%s/download/%s", strings.TrimRight(base, "/"), jobID)
+        shared.WriteError(w, http.StatusForbidden, shared.ErrCodeForbidden, msg)
+        return false
     }
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(job)
+    return true
 }
 
-// handleHealth: Basic health check for the API Gateway
-func handleHealth(w http.ResponseWriter, r *http.Request) {
-	enableCORS(w)
-	if r.Method == http.MethodOptions {
-        w.WriteHeader(http.StatusOK)
-        return
-	}
-
-    // Perform lightweight dependency checks
-    status := "ok"
-    details := map[string]string{}
-    if rc := shared.NewRedisClient(cfg); rc != nil {
-        if err := shared.PingRedis(rc); err != nil {
-            status = "degraded"
-            details["redis"] = "unreachable"
-        } else {
-            details["redis"] = "ok"
+// serveArtifact streams one of a completed job's files other than the audio,
+// or redirects to it when it is in remote storage
+func serveArtifact(w http.ResponseWriter, r *http.Request, job *shared.Job, a shared.Artifact) {
+    if cfg.StorageBackend != shared.StorageBackendLocal {
+        signed, err := store.SignedURL(a.Key, cfg.SignedURLTTL)
+        if err != nil {
+            shared.WithJob(logger, job.ID).Error("Failed to sign artifact URL", "artifact", a.Type, "error", err)
+            shared.WriteError(w, http.StatusInternalServerError, shared.ErrCodeInternal, "File not available")
+            return
         }
-    } else {
-        details["redis"] = "not_configured"
+        http.Redirect(w, r, signed, http.StatusFound)
+        return
     }
-	w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(map[string]any{
-        "status":  status,
-        "details": details,
-    })
-}
 
-// handleAdminListJobs: Lists all jobs from the database
-func handleAdminListJobs(w http.ResponseWriter, r *http.Request) {
-	// Auth handled by middleware
-    enableCORS(w)
-    if r.Method == http.MethodOptions {
-        w.WriteHeader(http.StatusOK)
+    f, err := os.Open(filepath.Join(cfg.OutputDir, filepath.Base(a.Key)))
+    if err != nil {
+        shared.WriteError(w, http.StatusNotFound, shared.ErrCodeNotFound, "File not available")
         return
     }
-    if r.Method != http.MethodGet {
-        http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+    defer f.Close()
+    info, err := f.Stat()
+    if err != nil || info.IsDir() {
+        shared.WriteError(w, http.StatusNotFound, shared.ErrCodeNotFound, "File not available")
         return
     }
-	jobs, err := db.GetAllJobs()
-	if err != nil {
-		log.Printf("ERROR: Failed to get all jobs for admin: %v", err)
-		http.Error(w, "Failed to retrieve jobs", http.StatusInternalServerError)
-		return
-	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(jobs)
+    name := shared.DownloadFilename(cfg.FilenameTemplate, job) + filepath.Ext(a.Key)
+    contentType := a.ContentType
+    if contentType == "" {
+        contentType = shared.ArtifactContentType(a.Key)
+    }
+    w.Header().Set("Content-Type", contentType)
+    w.Header().Set("Content-Disposition", shared.ContentDisposition(name))
+    w.Header().Set("ETag", fileETag(info))
+    http.ServeContent(w, r, name, info.ModTime(), f)
 }
 
-// handleAdminGetJob: Get details for a specific job from the database
-func handleAdminGetJob(w http.ResponseWriter, r *http.Request) {
-	// Auth handled by middleware
-    enableCORS(w)
+// fileETag derives a strong ETag from a file's size and modification time.
+// Output files are written once and never modified in place, so the pair
+// changes whenever the content does.
+func fileETag(info os.FileInfo) string {
+    return fmt.Sprintf("\"%x-%x\"", info.Size(), info.ModTime().UnixNano())
+}
+
+// handleThumbnail: Serves the video thumbnail saved with a completed job
+func handleThumbnail(w http.ResponseWriter, r *http.Request) {
+    enableCORS(w, r)
     if r.Method == http.MethodOptions {
         w.WriteHeader(http.StatusOK)
         return
     }
-    if r.Method != http.MethodGet {
-        http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+    if r.Method != http.MethodGet && r.Method != http.MethodHead {
+        shared.WriteError(w, http.StatusMethodNotAllowed, shared.ErrCodeMethodNotAllowed, "Invalid request method")
+        return
+    }
+    jobID := filepath.Base(r.URL.Path) // Extract job ID from /thumbnail/{job_id}
+    if !verifyDownloadLink(w, r, jobID) {
+        return
+    }
+    job, err := db.GetJob(r.Context(), jobID)
+    if err != nil {
+        writeStoreError(w, err, http.StatusNotFound, shared.ErrCodeNotFound, "Job not found")
+        return
+    }
+    if job.ThumbnailFile == "" {
+        shared.WriteError(w, http.StatusNotFound, shared.ErrCodeNotFound, "No thumbnail for this job")
+        return
+    }
+    if cfg.StorageBackend != shared.StorageBackendLocal {
+        signed, err := store.SignedURL(job.ThumbnailFile, cfg.SignedURLTTL)
+        if err != nil {
+            shared.WithJob(logger, jobID).Error("Failed to sign thumbnail URL", "error", err)
+            shared.WriteError(w, http.StatusInternalServerError, shared.ErrCodeInternal, "Thumbnail not available")
+            return
+        }
+        http.Redirect(w, r, signed, http.StatusFound)
         return
     }
-	jobID := filepath.Base(r.URL.Path) // Extract job ID from /admin/jobs/{job_id}
 
-	job, err := db.GetJob(jobID)
-	if err != nil {
-		http.Error(w, "Job not found", http.StatusNotFound)
-		return
-	}
+    name := filepath.Base(job.ThumbnailFile)
+    f, err := os.Open(filepath.Join(cfg.OutputDir, name))
+    if err != nil {
+        shared.WriteError(w, http.StatusNotFound, shared.ErrCodeNotFound, "No thumbnail for this job")
+        return
+    }
+    defer f.Close()
+    info, err := f.Stat()
+    if err != nil || info.IsDir() {
+        shared.WriteError(w, http.StatusNotFound, shared.ErrCodeNotFound, "No thumbnail for this job")
+        return
+    }
+    if ct := mime.TypeByExtension(filepath.Ext(name)); ct != "" {
+        w.Header().Set("Content-Type", ct)
+    }
+    w.Header().Set("ETag", fileETag(info))
+    http.ServeContent(w, r, name, info.ModTime(), f)
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(job)
+// outputAvailable reports whether a completed job's file can still be downloaded
+func outputAvailable(job *shared.Job) bool {
+    if job.AudioKey() != "" && cfg.StorageBackend != shared.StorageBackendLocal {
+        return true
+    }
+    name := shared.OutputFileName(job.ID, shared.FormatForExt(job.OutputExt).Ext, job.ClipStart, job.ClipEnd)
+    _, err := os.Stat(filepath.Join(cfg.OutputDir, name))
+    return err == nil
 }
 
-// handleAdminDeleteJob: Deletes a job from the database and conceptually removes its file
-func handleAdminDeleteJob(w http.ResponseWriter, r *http.Request) {
-	// Auth handled by middleware
-	if r.Method == http.MethodOptions {
-        w.WriteHeader(http.StatusOK)
-        return
+// downloadURL builds the public download link for a job, signed and valid for
+// cfg.SignedURLTTL when cfg.DownloadSecret is set
+func downloadURL(jobID string) string {
+    return cfg.PublicURL(shared.DownloadPath(cfg.DownloadSecret, jobID, cfg.SignedURLTTL))
+}
+
+// setDownloadEndpoint gives a completed job current download and thumbnail
+// links. Gateway links expire, so the ones the worker stored are replaced.
+func setDownloadEndpoint(job *shared.Job) {
+    if job.Status != shared.JobStatusCompleted {
+        return
+    }
+    if job.DownloadEndpoint == "" || cfg.StorageBackend == shared.StorageBackendLocal {
+        job.DownloadEndpoint = downloadURL(job.ID)
+    }
+    if job.ThumbnailFile != "" {
+        job.ThumbnailEndpoint = cfg.PublicURL(shared.ThumbnailPath(cfg.DownloadSecret, job.ID, cfg.SignedURLTTL))
+    }
+    // Legacy jobs get their artifacts listed too, so clients can rely on them
+    job.Artifacts = job.ArtifactList()
+    for i := range job.Artifacts {
+        a := &job.Artifacts[i]
+        a.DownloadEndpoint = cfg.PublicURL(shared.ArtifactDownloadPath(cfg.DownloadSecret, job.ID, a.Type, cfg.SignedURLTTL))
+    }
+}
+
+// estimatedWaitSeconds estimates how long a job queued now takes to finish.
+// It returns false until some job has finished, as there is nothing to go on.
+func estimatedWaitSeconds(ctx context.Context) (int, bool) {
+    avg, ok, err := db.AverageProcessingTime(ctx)
+    if err != nil || !ok {
+        return 0, false
+    }
+    depth, err := mq.Depth(ctx)
+    if err != nil {
+        return 0, false
+    }
+    wait := shared.EstimateWait(depth, cfg.MaxWorkers, avg)
+    return int(math.Ceil(wait.Seconds())), true
+}
+
+// handleStatus: Checks job status from the database
+func handleStatus(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w, r)
+	if r.Method == http.MethodOptions {
+        w.WriteHeader(http.StatusOK)
+        return
+	}
+    if r.Method != http.MethodGet {
+        shared.WriteError(w, http.StatusMethodNotAllowed, shared.ErrCodeMethodNotAllowed, "Invalid request method")
+        return
+    }
+    if strings.HasSuffix(r.URL.Path, "/stream") {
+        handleStatusStream(w, r)
+        return
+    }
+
+	jobID := filepath.Base(r.URL.Path) // Extract job ID from /status/{job_id}
+
+	job, err := db.GetJob(r.Context(), jobID)
+	if err != nil {
+		writeStoreError(w, err, http.StatusNotFound, shared.ErrCodeNotFound, "Job not found")
+		return
+	}
+
+    // Playlist jobs report the aggregate of their children
+    if job.IsPlaylist() {
+        children := refreshPlaylist(r.Context(), job)
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(struct {
+            *shared.Job
+            Children []playlistChild `json:"children"`
+        }{job, children})
+        return
+    }
+
+    // For completed jobs, include a direct download URL
+    setDownloadEndpoint(job)
+
+	w.Header().Set("Content-Type", "application/json")
+    if job.Status == shared.JobStatusPending {
+        if wait, ok := estimatedWaitSeconds(r.Context()); ok {
+            json.NewEncoder(w).Encode(struct {
+                *shared.Job
+                EstimatedWaitSeconds int `json:"estimated_wait_seconds"`
+            }{job, wait})
+            return
+        }
+    }
+	json.NewEncoder(w).Encode(job)
+}
+
+// handleCancel: Cancels a pending or processing job; the worker stops any running command
+func handleCancel(w http.ResponseWriter, r *http.Request) {
+    enableCORS(w, r)
+    if r.Method == http.MethodOptions {
+        w.WriteHeader(http.StatusOK)
+        return
+    }
+    if r.Method != http.MethodPost {
+        shared.WriteError(w, http.StatusMethodNotAllowed, shared.ErrCodeMethodNotAllowed, "Invalid request method")
+        return
+    }
+
+    jobID := filepath.Base(r.URL.Path) // Extract job ID from /cancel/{job_id}
+
+    job, err := db.GetJob(r.Context(), jobID)
+    if err != nil {
+        writeStoreError(w, err, http.StatusNotFound, shared.ErrCodeNotFound, "Job not found")
+        return
+    }
+    if job.IsPlaylist() {
+        refreshPlaylist(r.Context(), job)
+    }
+    if job.Status.IsTerminal() {
+        shared.WriteError(w, http.StatusConflict, shared.ErrCodeConflict, fmt.Sprintf("Job cannot be cancelled (status: %s)", job.Status))
+        return
+    }
+
+    if job.IsPlaylist() {
+        // Cancel every unfinished child; the playlist status follows from theirs
+        for _, childID := range job.ChildIDs {
+            child, err := db.GetJob(r.Context(), childID)
+            if err != nil || child.Status.IsTerminal() {
+                continue
+            }
+            if err := cancelJob(r.Context(), child); err != nil {
+                shared.WithJob(logger, childID).Error("Failed to cancel playlist child job", "error", err)
+            }
+        }
+        refreshPlaylist(r.Context(), job)
+    } else if err := cancelJob(r.Context(), job); err != nil {
+        shared.WithJob(logger, jobID).Error("Failed to cancel job", "error", err)
+        shared.WriteError(w, http.StatusInternalServerError, shared.ErrCodeInternal, "Failed to cancel job")
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]string{
+        "job_id":  jobID,
+        "status":  string(job.Status),
+        "message": "Job cancellation requested.",
+    })
+}
+
+// cancelJob marks a pending or processing job cancelled. The worker polls for
+// this status and kills yt-dlp/ffmpeg when it sees it.
+func cancelJob(ctx context.Context, job *shared.Job) error {
+    now := time.Now()
+    previous := job.Status
+    job.Status = shared.JobStatusCancelled
+    job.FailureReason = shared.FailureCancelled
+    job.CancelRequestedAt = &now
+    if previous == shared.JobStatusPending {
+        job.CompletedAt = &now // Nothing is running, so the job is done right away
+    }
+    if err := db.UpdateJob(ctx, job); err != nil {
+        return err
+    }
+    recordJobEvent(ctx, job, fmt.Sprintf("cancelled by client while %s", previous))
+    shared.WithJob(logger, job.ID).Info("Job cancelled", "previous_status", previous)
+    return nil
+}
+
+// sseKeepaliveInterval spaces the comment lines sent on a quiet status stream
+// so proxies don't close it as idle
+var sseKeepaliveInterval = 15 * time.Second
+
+// handleStatusStream: Pushes job status changes as Server-Sent Events until
+// the job finishes or the stream has been open for cfg.SSEMaxDuration
+func handleStatusStream(w http.ResponseWriter, r *http.Request) {
+    jobID := filepath.Base(strings.TrimSuffix(r.URL.Path, "/stream")) // Extract job ID from /status/{job_id}/stream
+
+    if _, err := db.GetJob(r.Context(), jobID); err != nil {
+        writeStoreError(w, err, http.StatusNotFound, shared.ErrCodeNotFound, "Job not found")
+        return
+    }
+    flusher, ok := w.(http.Flusher)
+    if !ok {
+        shared.WriteError(w, http.StatusInternalServerError, shared.ErrCodeInternal, "Streaming not supported")
+        return
+    }
+
+    w.Header().Set("Content-Type", "text/event-stream")
+    w.Header().Set("Cache-Control", "no-cache")
+    w.Header().Set("Connection", "keep-alive")
+    w.WriteHeader(http.StatusOK)
+    flusher.Flush()
+
+    ctx, cancel := context.WithCancel(r.Context())
+    if cfg.SSEMaxDuration > 0 {
+        ctx, cancel = context.WithTimeout(r.Context(), cfg.SSEMaxDuration)
+    }
+    defer cancel()
+    keepalive := time.NewTicker(sseKeepaliveInterval)
+    defer keepalive.Stop()
+
+    // The watch stops when the job is terminal, the client disconnects or ctx times out
+    updates := watchJob(ctx, jobID)
+    for {
+        select {
+        case job, ok := <-updates:
+            if !ok {
+                if r.Context().Err() == nil && ctx.Err() == context.DeadlineExceeded {
+                    b, _ := json.Marshal(map[string]any{
+                        "job_id":  jobID,
+                        "message": "Stream closed after its maximum duration; reconnect or poll /status/" + jobID,
+                    })
+                    fmt.Fprintf(w, "event: timeout\ndata: %s\n\n", b)
+                    flusher.Flush()
+                }
+                return
+            }
+            setDownloadEndpoint(job)
+            b, err := json.Marshal(job)
+            if err != nil {
+                shared.WithJob(logger, jobID).Error("Failed to encode job for stream", "error", err)
+                return
+            }
+            fmt.Fprintf(w, "event: status\ndata: %s\n\n", b)
+        case <-keepalive.C:
+            fmt.Fprint(w, ": keepalive\n\n")
+        }
+        flusher.Flush()
+    }
+}
+
+// watchJob sends a job on each status or progress change until it finishes or
+// ctx is done; it backs both the SSE and the WebSocket status endpoints
+func watchJob(ctx context.Context, jobID string) <-chan *shared.Job {
+    // Keyspace notifications only cover jobs stored in Redis
+    notifyClient := redisClient
+    if cfg.PostgresDSN != "" {
+        notifyClient = nil
+    }
+    return shared.WatchJob(ctx, db, notifyClient, jobID)
+}
+
+// handleHealth: Basic health check for the API Gateway
+func handleHealth(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w, r)
+	if r.Method == http.MethodOptions {
+        w.WriteHeader(http.StatusOK)
+        return
+	}
+
+    // Check the dependencies requests rely on; any failure makes the gateway unhealthy
+    checks, healthy := shared.RunHealthChecks(r.Context(), map[string]func(context.Context) error{
+        "database": db.Ping,
+        "queue":    mq.Ping,
+    })
+    status := "ok"
+    w.Header().Set("Content-Type", "application/json")
+    if !healthy {
+        status = "unhealthy"
+        w.WriteHeader(http.StatusServiceUnavailable)
+    }
+    resp := map[string]any{
+        "status": status,
+        "checks": checks,
+    }
+    // Cheap per-status counts; leave them out rather than fail the check
+    if counts, err := db.CountByStatus(r.Context()); err == nil {
+        resp["jobs_by_status"] = counts
+    }
+    json.NewEncoder(w).Encode(resp)
+}
+
+// handleAdminListJobs: Lists all jobs from the database
+func handleAdminListJobs(w http.ResponseWriter, r *http.Request) {
+	// Auth handled by middleware
+    enableCORS(w, r)
+    if r.Method == http.MethodOptions {
+        w.WriteHeader(http.StatusOK)
+        return
+    }
+    if r.Method != http.MethodGet {
+        shared.WriteError(w, http.StatusMethodNotAllowed, shared.ErrCodeMethodNotAllowed, "Invalid request method")
+        return
+    }
+
+    filter, ok := parseJobFilter(w, r)
+    if !ok {
+        return
+    }
+    writeJobList(w, r, filter)
+}
+
+// handleAdminSearchJobs: Lists jobs whose URL or title contains ?q=, ignoring
+// case, with the same paging and filters as /admin/jobs
+func handleAdminSearchJobs(w http.ResponseWriter, r *http.Request) {
+	// Auth handled by middleware
+    enableCORS(w, r)
+    if r.Method == http.MethodOptions {
+        w.WriteHeader(http.StatusOK)
+        return
+    }
+    if r.Method != http.MethodGet {
+        shared.WriteError(w, http.StatusMethodNotAllowed, shared.ErrCodeMethodNotAllowed, "Invalid request method")
+        return
+    }
+    filter, ok := parseJobFilter(w, r)
+    if !ok {
+        return
+    }
+    filter.Query = strings.TrimSpace(r.URL.Query().Get("q"))
+    if filter.Query == "" {
+        shared.WriteError(w, http.StatusBadRequest, shared.ErrCodeInvalidRequest, "Missing search query q")
+        return
+    }
+    writeJobList(w, r, filter)
+}
+
+// parseJobFilter reads the paging and filters of a job listing:
+// ?limit=&offset=&status=&include_deleted=. On a bad value it writes the
+// error response and returns false.
+func parseJobFilter(w http.ResponseWriter, r *http.Request) (shared.JobFilter, bool) {
+    q := r.URL.Query()
+    filter := shared.JobFilter{Limit: shared.DefaultListLimit}
+    if v := q.Get("limit"); v != "" {
+        n, err := strconv.Atoi(v)
+        if err != nil || n <= 0 {
+            shared.WriteError(w, http.StatusBadRequest, shared.ErrCodeInvalidRequest, "Invalid limit")
+            return filter, false
+        }
+        filter.Limit = n
+    }
+    if filter.Limit > shared.MaxListLimit {
+        filter.Limit = shared.MaxListLimit
+    }
+    if v := q.Get("offset"); v != "" {
+        n, err := strconv.Atoi(v)
+        if err != nil || n < 0 {
+            shared.WriteError(w, http.StatusBadRequest, shared.ErrCodeInvalidRequest, "Invalid offset")
+            return filter, false
+        }
+        filter.Offset = n
+    }
+    if v := q.Get("status"); v != "" {
+        st, err := shared.ParseJobStatus(v)
+        if err != nil {
+            shared.WriteError(w, http.StatusBadRequest, shared.ErrCodeInvalidRequest, err.Error())
+            return filter, false
+        }
+        filter.Status = st
+    }
+    if v := q.Get("include_deleted"); v != "" {
+        b, err := strconv.ParseBool(v)
+        if err != nil {
+            shared.WriteError(w, http.StatusBadRequest, shared.ErrCodeInvalidRequest, "Invalid include_deleted")
+            return filter, false
+        }
+        filter.IncludeDeleted = b
+    }
+    return filter, true
+}
+
+// writeJobList responds with the page of jobs selected by filter
+func writeJobList(w http.ResponseWriter, r *http.Request, filter shared.JobFilter) {
+	jobs, total, err := db.ListJobs(r.Context(), filter)
+	if err != nil {
+		logger.Error("Failed to list jobs for admin", "error", err)
+		shared.WriteError(w, http.StatusInternalServerError, shared.ErrCodeInternal, "Failed to retrieve jobs")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"total":  total,
+		"limit":  filter.Limit,
+		"offset": filter.Offset,
+		"jobs":   jobs,
+	})
+}
+
+// handleAdminGetJob: Get details for a specific job from the database
+func handleAdminGetJob(w http.ResponseWriter, r *http.Request) {
+	// Auth handled by middleware
+    enableCORS(w, r)
+    if r.Method == http.MethodOptions {
+        w.WriteHeader(http.StatusOK)
+        return
+    }
+    if strings.HasSuffix(r.URL.Path, "/force-status") {
+        handleAdminForceStatus(w, r)
+        return
+    }
+    if r.Method != http.MethodGet {
+        shared.WriteError(w, http.StatusMethodNotAllowed, shared.ErrCodeMethodNotAllowed, "Invalid request method")
+        return
+    }
+    if strings.HasSuffix(r.URL.Path, "/logs") {
+        handleAdminJobLogs(w, r)
+        return
+    }
+    if strings.HasSuffix(r.URL.Path, "/history") {
+        handleAdminJobHistory(w, r)
+        return
+    }
+    if strings.HasSuffix(r.URL.Path, "/progress/stream") {
+        handleAdminProgressStream(w, r)
+        return
+    }
+	jobID := filepath.Base(r.URL.Path) // Extract job ID from /admin/jobs/{job_id}
+
+	job, err := db.GetJob(r.Context(), jobID)
+	if err != nil {
+		writeStoreError(w, err, http.StatusNotFound, shared.ErrCodeNotFound, "Job not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// handleAdminJobLogs: GET /admin/jobs/{job_id}/logs returns the yt-dlp and
+// ffmpeg output captured by the worker, as plain text
+func handleAdminJobLogs(w http.ResponseWriter, r *http.Request) {
+	// Auth handled by middleware
+	jobID := filepath.Base(strings.TrimSuffix(r.URL.Path, "/logs"))
+	if _, err := db.GetJob(r.Context(), jobID); err != nil {
+		writeStoreError(w, err, http.StatusNotFound, shared.ErrCodeNotFound, "Job not found")
+		return
+	}
+	logs, err := db.GetJobLogs(r.Context(), jobID)
+	if err != nil {
+		shared.WithJob(logger, jobID).Error("Failed to read job logs", "error", err)
+		shared.WriteError(w, http.StatusInternalServerError, shared.ErrCodeInternal, "Failed to read job logs")
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(logs))
+}
+
+// handleAdminJobHistory: GET /admin/jobs/{job_id}/history returns the job's
+// status changes, oldest first
+func handleAdminJobHistory(w http.ResponseWriter, r *http.Request) {
+	// Auth handled by middleware
+	jobID := filepath.Base(strings.TrimSuffix(r.URL.Path, "/history"))
+	if _, err := db.GetJob(r.Context(), jobID); err != nil {
+		writeStoreError(w, err, http.StatusNotFound, shared.ErrCodeNotFound, "Job not found")
+		return
+	}
+	events, err := db.GetJobHistory(r.Context(), jobID)
+	if err != nil {
+		shared.WithJob(logger, jobID).Error("Failed to read job history", "error", err)
+		shared.WriteError(w, http.StatusInternalServerError, shared.ErrCodeInternal, "Failed to read job history")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"job_id": jobID,
+		"events": events,
+	})
+}
+
+// handleAdminDeleteJob: Deletes a job from the database and conceptually removes its file
+func handleAdminDeleteJob(w http.ResponseWriter, r *http.Request) {
+	// Auth handled by middleware
+	if r.Method == http.MethodOptions {
+        w.WriteHeader(http.StatusOK)
+        return
 	}
 	if r.Method != http.MethodDelete {
-		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		shared.WriteError(w, http.StatusMethodNotAllowed, shared.ErrCodeMethodNotAllowed, "Invalid request method")
 		return
 	}
 
 	jobID := filepath.Base(r.URL.Path) // Extract job ID from /admin/delete/{job_id}
+	soft := false
+	if v := r.URL.Query().Get("soft"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			shared.WriteError(w, http.StatusBadRequest, shared.ErrCodeInvalidRequest, "Invalid soft")
+			return
+		}
+		soft = b
+	}
 
-	job, err := db.GetJob(jobID)
+	job, err := db.GetJob(r.Context(), jobID)
 	if err != nil {
-		http.Error(w, "Job not found", http.StatusNotFound)
+		writeStoreError(w, err, http.StatusNotFound, shared.ErrCodeNotFound, "Job not found")
+		return
+	}
+	if soft {
+		softDeleteJob(w, r, job)
 		return
 	}
+	jl := shared.WithJob(logger, jobID)
+
+	deleteJobFiles(r.Context(), job)
+
+	if err := db.DeleteJob(r.Context(), jobID); err != nil {
+		jl.Error("Failed to delete job from DB", "error", err)
+		shared.WriteError(w, http.StatusInternalServerError, shared.ErrCodeInternal, "Failed to delete job")
+		return
+	}
+	jl.Info("Deleted job from DB")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": fmt.Sprintf("Job %s and associated file (if existed) deleted successfully.", jobID),
+	})
+}
+
+// softDeleteJob: Removes a finished job's files but keeps its record, marked
+// deleted, for auditing. Listings skip it unless include_deleted is set; the
+// reaper purges it cfg.JobTTL after the deletion.
+func softDeleteJob(w http.ResponseWriter, r *http.Request, job *shared.Job) {
+	if job.Status == shared.JobStatusDeleted {
+		shared.WriteError(w, http.StatusConflict, shared.ErrCodeConflict, "Job is already deleted")
+		return
+	}
+	if !job.Status.IsTerminal() {
+		// A worker still running it would overwrite the deleted status
+		shared.WriteError(w, http.StatusConflict, shared.ErrCodeConflict,
+			fmt.Sprintf("Job cannot be soft-deleted while %s; cancel it first", job.Status))
+		return
+	}
+	jl := shared.WithJob(logger, job.ID)
+
+	deleteJobFiles(r.Context(), job)
+	previous := job.Status
+	now := time.Now()
+	job.Status = shared.JobStatusDeleted
+	job.DeletedAt = &now
+	job.ExpiresAt = shared.ExpiryAfter(now, cfg.JobTTL) // Soft-deleted jobs are kept a full TTL for auditing
+	job.DownloadEndpoint = ""
+	job.ThumbnailEndpoint = ""
+	job.StorageKey = ""
+	job.FilePath = ""
+	job.ThumbnailFile = ""
+	job.Artifacts = nil
+	if err := db.UpdateJob(r.Context(), job); err != nil {
+		jl.Error("Failed to soft-delete job", "error", err)
+		writeStoreError(w, err, http.StatusInternalServerError, shared.ErrCodeInternal, "Failed to delete job")
+		return
+	}
+	recordJobEvent(r.Context(), job, fmt.Sprintf("soft-deleted by an admin while %s", previous))
+	jl.Info("Soft-deleted job", "previous_status", previous)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": fmt.Sprintf("Job %s marked deleted and its files removed; the record is kept for auditing.", job.ID),
+	})
+}
 
-	// Conceptual file deletion (in a real system, this would interact with Object Storage)
-    if job.FilePath != "" {
-        // Delete the actual stored file
-        fullPath := job.FilePath
+// deleteJobFiles removes a job's stored objects and local file, and reports
+// whether the job had output that is now gone
+func deleteJobFiles(ctx context.Context, job *shared.Job) bool {
+    jl := shared.WithJob(logger, job.ID)
+    audioKey := job.AudioKey()
+    deleted := false
+    for _, key := range job.ArtifactKeys() {
+        ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+        if err := store.Delete(ctx, key); err != nil {
+            jl.Warn("Failed to delete file from storage", "key", key, "error", err)
+        } else if key == audioKey {
+            deleted = true
+        }
+        cancel()
+    }
+    // Delete the local file; JSON-backed stores drop FilePath, so fall back
+    // to the audio's name in OutputDir
+    fullPath := job.FilePath
+    if fullPath == "" && audioKey != "" {
+        fullPath = filepath.Join(cfg.OutputDir, filepath.Base(audioKey))
+    }
+    if fullPath != "" {
         if _, statErr := os.Stat(fullPath); statErr == nil { // Check if file exists
             if rmErr := os.Remove(fullPath); rmErr != nil {
-                log.Printf("WARN: Failed to delete local file %s for job %s: %v", fullPath, jobID, rmErr)
+                jl.Warn("Failed to delete local file", "file", fullPath, "error", rmErr)
             } else {
-                log.Printf("INFO: Deleted local file: %s", fullPath)
+                jl.Info("Deleted local file", "file", fullPath)
+                deleted = true
             }
         }
     }
+    return deleted
+}
+
+// maxBulkDelete caps how many jobs one bulk-delete call removes
+const maxBulkDelete = 1000
+
+// handleAdminBulkDelete: Deletes jobs matching all given filters (status, older_than, ids)
+// along with their files. Jobs already gone are skipped, so repeating a call is safe.
+func handleAdminBulkDelete(w http.ResponseWriter, r *http.Request) {
+	// Auth handled by middleware
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPost {
+		shared.WriteError(w, http.StatusMethodNotAllowed, shared.ErrCodeMethodNotAllowed, "Invalid request method")
+		return
+	}
+
+	var req struct {
+		Status    string   `json:"status"`
+		OlderThan string   `json:"older_than"` // Go duration, e.g. "72h"
+		IDs       []string `json:"ids"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.Status == "" && req.OlderThan == "" && len(req.IDs) == 0 {
+		shared.WriteError(w, http.StatusBadRequest, shared.ErrCodeInvalidRequest, "At least one of status, older_than or ids is required")
+		return
+	}
+	var status shared.JobStatus
+	if req.Status != "" {
+		st, err := shared.ParseJobStatus(req.Status)
+		if err != nil {
+			shared.WriteError(w, http.StatusBadRequest, shared.ErrCodeInvalidRequest, err.Error())
+			return
+		}
+		status = st
+	}
+	var cutoff time.Time
+	if req.OlderThan != "" {
+		d, err := time.ParseDuration(req.OlderThan)
+		if err != nil || d <= 0 {
+			shared.WriteError(w, http.StatusBadRequest, shared.ErrCodeInvalidRequest, "Invalid older_than: use a duration such as 24h")
+			return
+		}
+		cutoff = time.Now().Add(-d)
+	}
+
+	// Collect candidates: the listed IDs, or every job with the status
+	var candidates []*shared.Job
+	if len(req.IDs) > 0 {
+		for _, id := range req.IDs {
+			if job, err := db.GetJob(r.Context(), id); err == nil {
+				candidates = append(candidates, job)
+			}
+		}
+	} else {
+		jobs, _, err := db.ListJobs(r.Context(), shared.JobFilter{Status: status})
+		if err != nil {
+			logger.Error("Failed to list jobs for bulk delete", "error", err)
+			shared.WriteError(w, http.StatusInternalServerError, shared.ErrCodeInternal, "Failed to retrieve jobs")
+			return
+		}
+		candidates = jobs
+	}
+
+	deleted, filesDeleted, matched := 0, 0, 0
+	errs := map[string]string{}
+	for _, job := range candidates {
+		if status != "" && job.Status != status {
+			continue
+		}
+		if !cutoff.IsZero() && !job.CreatedAt.Before(cutoff) {
+			continue
+		}
+		matched++
+		if deleted+len(errs) >= maxBulkDelete {
+			continue // Count the rest so the caller knows to call again
+		}
+		if job.Status == shared.JobStatusProcessing {
+			errs[job.ID] = "job is processing; cancel it first"
+			continue
+		}
+		if deleteJobFiles(r.Context(), job) {
+			filesDeleted++
+		}
+		if err := db.DeleteJob(r.Context(), job.ID); err != nil {
+			errs[job.ID] = err.Error()
+			continue
+		}
+		deleted++
+	}
+	logger.Info("Bulk deleted jobs", "deleted", deleted, "files_deleted", filesDeleted, "matched", matched, "errors", len(errs))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"matched":       matched,
+		"deleted":       deleted,
+		"files_deleted": filesDeleted,
+		"errors":        errs,
+		"truncated":     matched > deleted+len(errs),
+	})
+}
+
+// handleAdminCreateAPIKey: Issues a new API key. The plaintext key is only returned here.
+func handleAdminCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	// Auth handled by middleware
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPost {
+		shared.WriteError(w, http.StatusMethodNotAllowed, shared.ErrCodeMethodNotAllowed, "Invalid request method")
+		return
+	}
+
+	var req struct {
+		Owner      string `json:"owner"`
+		DailyQuota *int   `json:"daily_quota"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if strings.TrimSpace(req.Owner) == "" {
+		shared.WriteError(w, http.StatusBadRequest, shared.ErrCodeInvalidRequest, "Invalid request body: 'owner' is required")
+		return
+	}
+	quota := cfg.APIKeyDailyQuota
+	if req.DailyQuota != nil {
+		if *req.DailyQuota < 0 {
+			shared.WriteError(w, http.StatusBadRequest, shared.ErrCodeInvalidRequest, "Invalid daily_quota")
+			return
+		}
+		quota = *req.DailyQuota
+	}
+
+	plaintext, key, err := apiKeys.Create(strings.TrimSpace(req.Owner), quota)
+	if err != nil {
+		logger.Error("Failed to create API key", "error", err)
+		shared.WriteError(w, http.StatusInternalServerError, shared.ErrCodeInternal, "Failed to create API key")
+		return
+	}
+	logger.Info("Created API key", "key_id", key.ID, "owner", key.Owner)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]any{
+		"key":         plaintext,
+		"id":          key.ID,
+		"owner":       key.Owner,
+		"daily_quota": key.DailyQuota,
+		"created_at":  key.CreatedAt,
+	})
+}
+
+// handleAdminRevokeAPIKey: Revokes the API key with the given ID
+func handleAdminRevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	// Auth handled by middleware
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodDelete {
+		shared.WriteError(w, http.StatusMethodNotAllowed, shared.ErrCodeMethodNotAllowed, "Invalid request method")
+		return
+	}
 
-	if err := db.DeleteJob(jobID); err != nil {
-		log.Printf("ERROR: Failed to delete job %s from DB: %v", jobID, err)
-		http.Error(w, "Failed to delete job", http.StatusInternalServerError)
+	keyID := filepath.Base(r.URL.Path) // Extract key ID from /admin/apikeys/{key_id}
+	if err := apiKeys.Revoke(keyID); err != nil {
+		shared.WriteError(w, http.StatusNotFound, shared.ErrCodeNotFound, "API key not found")
 		return
 	}
-	log.Printf("INFO: Deleted job %s from DB", jobID)
+	logger.Info("Revoked API key", "key_id", keyID)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{
-		"message": fmt.Sprintf("Job %s and associated file (if existed) deleted successfully.", jobID),
+		"message": fmt.Sprintf("API key %s revoked.", keyID),
+	})
+}
+
+// handleAdminStats: Summarizes jobs by status, recent throughput, queue depth and workers
+func handleAdminStats(w http.ResponseWriter, r *http.Request) {
+	// Auth handled by middleware
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodGet {
+		shared.WriteError(w, http.StatusMethodNotAllowed, shared.ErrCodeMethodNotAllowed, "Invalid request method")
+		return
+	}
+
+	stats, err := db.JobStats(r.Context())
+	if err != nil {
+		logger.Error("Failed to compute job stats", "error", err)
+		shared.WriteError(w, http.StatusInternalServerError, shared.ErrCodeInternal, "Failed to retrieve stats")
+		return
+	}
+	total := 0
+	for _, n := range stats.ByStatus {
+		total += n
+	}
+	resp := map[string]any{
+		"jobs_by_status":      stats.ByStatus,
+		"total_jobs":          total,
+		"completed_last_hour": stats.CompletedLastHour,
+		"completed_last_day":  stats.CompletedLastDay,
+	}
+	// The rest is best effort: report what is available rather than failing
+	if avg, ok, err := db.AverageProcessingTime(r.Context()); err == nil && ok {
+		resp["average_processing_seconds"] = math.Round(avg.Seconds()*10) / 10
+	}
+	if depth, err := mq.Depth(r.Context()); err == nil {
+		resp["queue_depth"] = depth
+	} else {
+		logger.Warn("Failed to read queue depth", "error", err)
+	}
+	if n, err := mq.ActiveConsumers(r.Context()); err == nil {
+		resp["active_workers"] = n
+	} else {
+		logger.Warn("Failed to count active workers", "error", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handleAdminListDeadLetters: Lists jobs that failed permanently, newest first
+func handleAdminListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	// Auth handled by middleware
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodGet {
+		shared.WriteError(w, http.StatusMethodNotAllowed, shared.ErrCodeMethodNotAllowed, "Invalid request method")
+		return
+	}
+
+	entries, err := mq.DeadLetters(r.Context())
+	if err != nil {
+		logger.Error("Failed to list dead-lettered jobs", "error", err)
+		shared.WriteError(w, http.StatusInternalServerError, shared.ErrCodeInternal, "Failed to retrieve dead-lettered jobs")
+		return
+	}
+	for i := range entries {
+		entries[i].Message.Cookies = "" // Entries dead-lettered by older workers may still hold them
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"total":   len(entries),
+		"entries": entries,
 	})
 }
+
+// handleAdminRequeueDeadLetter: Re-submits a dead-lettered job via POST /admin/dlq/{job_id}/requeue
+func handleAdminRequeueDeadLetter(w http.ResponseWriter, r *http.Request) {
+	// Auth handled by middleware
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/dlq/"), "/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] != "requeue" {
+		shared.WriteError(w, http.StatusNotFound, shared.ErrCodeNotFound, "Not found")
+		return
+	}
+	if r.Method != http.MethodPost {
+		shared.WriteError(w, http.StatusMethodNotAllowed, shared.ErrCodeMethodNotAllowed, "Invalid request method")
+		return
+	}
+	jobID := parts[0]
+	jl := shared.WithJob(logger, jobID)
+
+	job, err := db.GetJob(r.Context(), jobID)
+	if err != nil {
+		writeStoreError(w, err, http.StatusNotFound, shared.ErrCodeNotFound, "Job not found")
+		return
+	}
+	entry, err := mq.RemoveDeadLetter(r.Context(), jobID)
+	if err != nil {
+		shared.WriteError(w, http.StatusNotFound, shared.ErrCodeNotFound, "Job is not in the dead-letter queue")
+		return
+	}
+
+	resetJob(job)
+	if err := db.UpdateJob(r.Context(), job); err != nil {
+		jl.Error("Failed to reset dead-lettered job", "error", err)
+		mq.DeadLetter(r.Context(), entry.Message, entry.Reason) // Put it back so it isn't lost
+		shared.WriteError(w, http.StatusInternalServerError, shared.ErrCodeInternal, "Failed to requeue job")
+		return
+	}
+	recordJobEvent(r.Context(), job, "requeued from the dead-letter queue by an admin")
+	msg := entry.Message
+	msg.Attempt = 0
+	if err := mq.Publish(r.Context(), msg); err != nil {
+		jl.Error("Failed to publish dead-lettered job", "error", err)
+		mq.DeadLetter(r.Context(), entry.Message, entry.Reason)
+		shared.WriteError(w, http.StatusInternalServerError, shared.ErrCodeInternal, "Failed to requeue job")
+		return
+	}
+	jl.Info("Requeued dead-lettered job")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
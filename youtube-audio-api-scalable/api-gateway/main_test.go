@@ -0,0 +1,1445 @@
+// api-gateway/main_test.go
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+// setupGateway points the gateway's globals at in-memory backends and a temp
+// output directory, as main does with REDIS_ADDR unset
+func setupGateway(t *testing.T) *shared.InMemoryDB {
+	t.Helper()
+	t.Setenv("REDIS_ADDR", "")
+	t.Setenv("DOWNLOAD_SECRET", "")
+	t.Setenv("OUTPUT_DIR", t.TempDir())
+	cfg = shared.LoadConfig()
+	logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	memDB := shared.NewInMemoryDB()
+	db = memDB
+	queue := shared.NewInMemoryQueue(64)
+	t.Cleanup(queue.Close)
+	mq = queue
+	var err error
+	if store, err = shared.NewStorage(cfg); err != nil {
+		t.Fatalf("NewStorage: %v", err)
+	}
+	redisClient = nil
+	rl = shared.NewRateLimiter(cfg, nil)
+	apiKeys = shared.NewAPIKeyStore(nil)
+	metadataCache = shared.NewMetadataCache(nil)
+	activeJobs = shared.NewActiveJobTracker(nil)
+	trustedProxies = nil
+	progressFeed = shared.NewProgressFeed(nil)
+	callbackDLQ = shared.NewCallbackDLQ(nil)
+	return memDB
+}
+
+// seedJob stores job, filling in the fields every stored job has
+func seedJob(t *testing.T, job *shared.Job) *shared.Job {
+	t.Helper()
+	if job.CreatedAt.IsZero() {
+		job.CreatedAt = time.Now()
+	}
+	if job.Status == "" {
+		job.Status = shared.JobStatusPending
+	}
+	if err := db.CreateJob(context.Background(), job); err != nil {
+		t.Fatalf("CreateJob(%s): %v", job.ID, err)
+	}
+	return job
+}
+
+// serve runs handler on a request and returns the recorded response
+func serve(handler http.HandlerFunc, method, target string, body string, headers ...string) *httptest.ResponseRecorder {
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, target, reader)
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+// decodeBody unmarshals a JSON response into v
+func decodeBody(t *testing.T, rec *httptest.ResponseRecorder, v any) {
+	t.Helper()
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("decoding response %q: %v", rec.Body.String(), err)
+	}
+}
+
+// errorCode returns the code of an error envelope
+func errorCode(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+	var env shared.ErrorResponse
+	decodeBody(t, rec, &env)
+	return env.Error.Code
+}
+
+// writeOutput creates a completed job's converted file
+func writeOutput(t *testing.T, job *shared.Job, content string) {
+	t.Helper()
+	af := shared.FormatForExt(job.OutputExt)
+	path := filepath.Join(cfg.OutputDir, shared.OutputFileName(job.ID, af.Ext, job.ClipStart, job.ClipEnd))
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDownloadCompletedJob(t *testing.T) {
+	setupGateway(t)
+	job := seedJob(t, &shared.Job{ID: "done", Status: shared.JobStatusCompleted, OutputExt: "mp3",
+		Metadata: &shared.Metadata{Title: "Song"}})
+	writeOutput(t, job, "ID3 audio bytes")
+
+	rec := serve(handleDownload, http.MethodGet, "/download/done", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	if rec.Body.String() != "ID3 audio bytes" {
+		t.Errorf("body = %q", rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "audio/mpeg" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if cd := rec.Header().Get("Content-Disposition"); !strings.Contains(cd, "Song.mp3") {
+		t.Errorf("Content-Disposition = %q", cd)
+	}
+}
+
+func TestDownloadHeadConditionalAndRange(t *testing.T) {
+	setupGateway(t)
+	job := seedJob(t, &shared.Job{ID: "done", Status: shared.JobStatusCompleted, OutputExt: "mp3"})
+	writeOutput(t, job, "ID3 audio bytes")
+
+	head := serve(handleDownload, http.MethodHead, "/download/done", "")
+	if head.Code != http.StatusOK || head.Body.Len() != 0 {
+		t.Fatalf("HEAD: status %d, %d body bytes", head.Code, head.Body.Len())
+	}
+	if cl := head.Header().Get("Content-Length"); cl != "15" {
+		t.Errorf("HEAD Content-Length = %q, want 15", cl)
+	}
+	if ct := head.Header().Get("Content-Type"); ct != "audio/mpeg" {
+		t.Errorf("HEAD Content-Type = %q", ct)
+	}
+	etag, modified := head.Header().Get("ETag"), head.Header().Get("Last-Modified")
+	if etag == "" || modified == "" {
+		t.Fatalf("HEAD sent ETag %q, Last-Modified %q", etag, modified)
+	}
+
+	for _, h := range [][]string{{"If-None-Match", etag}, {"If-Modified-Since", modified}} {
+		rec := serve(handleDownload, http.MethodGet, "/download/done", "", h...)
+		if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+			t.Errorf("%s: status %d, body %q; want 304", h[0], rec.Code, rec.Body)
+		}
+	}
+	if rec := serve(handleDownload, http.MethodGet, "/download/done", "", "If-None-Match", `"stale"`); rec.Code != http.StatusOK {
+		t.Errorf("stale ETag: status %d, want 200", rec.Code)
+	}
+
+	rec := serve(handleDownload, http.MethodGet, "/download/done", "", "Range", "bytes=4-8")
+	if rec.Code != http.StatusPartialContent || rec.Body.String() != "audio" {
+		t.Errorf("range: status %d, body %q; want 206 \"audio\"", rec.Code, rec.Body)
+	}
+	if cr := rec.Header().Get("Content-Range"); cr != "bytes 4-8/15" {
+		t.Errorf("Content-Range = %q", cr)
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	setupGateway(t)
+	seedJob(t, &shared.Job{ID: "with", Status: shared.JobStatusCompleted, ThumbnailFile: "with.jpg"})
+	seedJob(t, &shared.Job{ID: "without", Status: shared.JobStatusCompleted})
+	if err := os.WriteFile(filepath.Join(cfg.OutputDir, "with.jpg"), []byte("jpeg bytes"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serve(handleThumbnail, http.MethodGet, "/thumbnail/with", "")
+	if rec.Code != http.StatusOK || rec.Body.String() != "jpeg bytes" {
+		t.Fatalf("status %d: %q", rec.Code, rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "image/jpeg" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	for _, id := range []string{"without", "missing"} {
+		if rec := serve(handleThumbnail, http.MethodGet, "/thumbnail/"+id, ""); rec.Code != http.StatusNotFound {
+			t.Errorf("%s: status %d, want 404", id, rec.Code)
+		}
+	}
+}
+
+// signingStorage is a remote Storage that only hands out signed URLs
+type signingStorage struct{ deleted []string }
+
+func (s *signingStorage) Put(ctx context.Context, key string, r io.Reader) (string, error) {
+	return "mem://" + key, nil
+}
+
+func (s *signingStorage) Delete(ctx context.Context, key string) error {
+	s.deleted = append(s.deleted, key)
+	return nil
+}
+
+func (s *signingStorage) SignedURL(key string, ttl time.Duration) (string, error) {
+	return "https://objects.example/" + key + "?expires=" + ttl.String(), nil
+}
+
+func TestDownloadRedirectsToRemoteStorage(t *testing.T) {
+	setupGateway(t)
+	store = &signingStorage{}
+	cfg.StorageBackend = shared.StorageBackendS3
+	seedJob(t, &shared.Job{ID: "remote", Status: shared.JobStatusCompleted, OutputExt: "mp3", StorageKey: "remote.mp3"})
+
+	rec := serve(handleDownload, http.MethodGet, "/download/remote", "")
+	if rec.Code != http.StatusFound {
+		t.Fatalf("status = %d, want 302", rec.Code)
+	}
+	if loc := rec.Header().Get("Location"); !strings.HasPrefix(loc, "https://objects.example/remote.mp3?") {
+		t.Errorf("Location = %q", loc)
+	}
+}
+
+func TestDownloadPendingJob(t *testing.T) {
+	setupGateway(t)
+	seedJob(t, &shared.Job{ID: "waiting"})
+
+	rec := serve(handleDownload, http.MethodGet, "/download/waiting", "")
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want 409", rec.Code)
+	}
+	if code := errorCode(t, rec); code != shared.ErrCodeConflict {
+		t.Errorf("code = %q", code)
+	}
+}
+
+func TestDownloadUnknownJob(t *testing.T) {
+	setupGateway(t)
+
+	rec := serve(handleDownload, http.MethodGet, "/download/missing", "")
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want 404", rec.Code)
+	}
+	if code := errorCode(t, rec); code != shared.ErrCodeNotFound {
+		t.Errorf("code = %q", code)
+	}
+}
+
+func TestRateLimitMiddlewareRejectsRequestOverLimit(t *testing.T) {
+	setupGateway(t)
+	cfg.RateLimitStatusRPM = 3
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	handler := rateLimitMiddleware(shared.RateLimitBucketStatus, ok)
+
+	for i := 1; i <= cfg.RateLimitStatusRPM; i++ {
+		if rec := serve(handler, http.MethodGet, "/status/x", ""); rec.Code != http.StatusOK {
+			t.Fatalf("request %d: status %d", i, rec.Code)
+		}
+	}
+	rec := serve(handler, http.MethodGet, "/status/x", "")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("request %d: status %d, want 429", cfg.RateLimitStatusRPM+1, rec.Code)
+	}
+	if code := errorCode(t, rec); code != shared.ErrCodeRateLimited {
+		t.Errorf("code = %q", code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("no Retry-After header")
+	}
+	if got := rec.Header().Get("X-RateLimit-Remaining"); got != "0" {
+		t.Errorf("X-RateLimit-Remaining = %q", got)
+	}
+}
+
+func TestCancelPendingJob(t *testing.T) {
+	setupGateway(t)
+	seedJob(t, &shared.Job{ID: "queued"})
+
+	rec := serve(handleCancel, http.MethodPost, "/cancel/queued", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	job, err := db.GetJob(context.Background(), "queued")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != shared.JobStatusCancelled || job.FailureReason != shared.FailureCancelled {
+		t.Errorf("job is %s (%s), want cancelled", job.Status, job.FailureReason)
+	}
+	if job.CancelRequestedAt == nil || job.CompletedAt == nil {
+		t.Error("a cancelled pending job should be finished right away")
+	}
+}
+
+func TestCancelCompletedJob(t *testing.T) {
+	setupGateway(t)
+	seedJob(t, &shared.Job{ID: "done", Status: shared.JobStatusCompleted})
+
+	rec := serve(handleCancel, http.MethodPost, "/cancel/done", "")
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want 409", rec.Code)
+	}
+	job, _ := db.GetJob(context.Background(), "done")
+	if job.Status != shared.JobStatusCompleted {
+		t.Errorf("completed job became %s", job.Status)
+	}
+}
+
+func TestCancelUnknownJob(t *testing.T) {
+	setupGateway(t)
+	if rec := serve(handleCancel, http.MethodPost, "/cancel/missing", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", rec.Code)
+	}
+}
+
+func TestExtractReturnsCachedJob(t *testing.T) {
+	setupGateway(t)
+	cached := seedJob(t, &shared.Job{ID: "cached", Status: shared.JobStatusCompleted, VideoID: "dQw4w9WgXcQ",
+		Format: "mp3", Bitrate: shared.DefaultBitrate, OutputExt: "mp3"})
+	writeOutput(t, cached, "audio")
+
+	rec := serve(handleExtract, http.MethodPost, "/extract", `{"url":"https://youtu.be/dQw4w9WgXcQ?si=share"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	var resp struct {
+		JobID  string `json:"job_id"`
+		Cached bool   `json:"cached"`
+	}
+	decodeBody(t, rec, &resp)
+	if resp.JobID != "cached" || !resp.Cached {
+		t.Errorf("response = %+v, want the cached job", resp)
+	}
+	if depth, _ := mq.Depth(context.Background()); depth != 0 {
+		t.Errorf("a cache hit queued %d job(s)", depth)
+	}
+
+	// Other output settings need a conversion of their own
+	rec = serve(handleExtract, http.MethodPost, "/extract", `{"url":"https://youtu.be/dQw4w9WgXcQ","bitrate":"320k"}`)
+	resp.Cached = false
+	decodeBody(t, rec, &resp)
+	if rec.Code != http.StatusOK || resp.Cached || resp.JobID == "cached" {
+		t.Errorf("different bitrate: status %d, response %+v; want a new job", rec.Code, resp)
+	}
+	if depth, _ := mq.Depth(context.Background()); depth != 1 {
+		t.Errorf("queue depth = %d, want 1", depth)
+	}
+}
+
+func TestExtractSkipsCachedJobWithoutFile(t *testing.T) {
+	setupGateway(t)
+	seedJob(t, &shared.Job{ID: "gone", Status: shared.JobStatusCompleted, VideoID: "dQw4w9WgXcQ",
+		Format: "mp3", Bitrate: shared.DefaultBitrate, OutputExt: "mp3"})
+
+	rec := serve(handleExtract, http.MethodPost, "/extract", `{"url":"https://www.youtube.com/watch?v=dQw4w9WgXcQ"}`)
+	var resp struct {
+		JobID  string `json:"job_id"`
+		Cached bool   `json:"cached"`
+	}
+	decodeBody(t, rec, &resp)
+	if resp.Cached || resp.JobID == "gone" {
+		t.Errorf("response = %+v, want a new job when the cached file is missing", resp)
+	}
+}
+
+// sseEvent is one Server-Sent Event, or a comment line when Comment is set
+type sseEvent struct {
+	Event, Data, Comment string
+}
+
+// readSSE reads the next event or comment from a text/event-stream body
+func readSSE(t *testing.T, r *bufio.Reader) (sseEvent, bool) {
+	t.Helper()
+	var ev sseEvent
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return ev, false
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "":
+			if ev != (sseEvent{}) {
+				return ev, true
+			}
+		case strings.HasPrefix(line, ":"):
+			return sseEvent{Comment: strings.TrimSpace(line[1:])}, true
+		case strings.HasPrefix(line, "event: "):
+			ev.Event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			ev.Data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+// setJobStatus moves a stored job to status
+func setJobStatus(t *testing.T, jobID string, status shared.JobStatus) {
+	t.Helper()
+	job, err := db.GetJob(context.Background(), jobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job.Status = status
+	if err := db.UpdateJob(context.Background(), job); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStatusStreamFollowsTransitions(t *testing.T) {
+	setupGateway(t)
+	seedJob(t, &shared.Job{ID: "job-1"})
+	srv := httptest.NewServer(http.HandlerFunc(handleStatus))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/status/job-1/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	body := bufio.NewReader(resp.Body)
+	next := map[shared.JobStatus]shared.JobStatus{
+		shared.JobStatusPending:    shared.JobStatusProcessing,
+		shared.JobStatusProcessing: shared.JobStatusCompleted,
+	}
+	var seen []shared.JobStatus
+	for {
+		ev, ok := readSSE(t, body)
+		if !ok {
+			break // Closed by the server once the job finished
+		}
+		if ev.Event != "status" {
+			continue
+		}
+		var job shared.Job
+		if err := json.Unmarshal([]byte(ev.Data), &job); err != nil {
+			t.Fatalf("bad event data %q: %v", ev.Data, err)
+		}
+		seen = append(seen, job.Status)
+		if status, ok := next[job.Status]; ok {
+			setJobStatus(t, "job-1", status)
+		}
+	}
+	want := []shared.JobStatus{shared.JobStatusPending, shared.JobStatusProcessing, shared.JobStatusCompleted}
+	if !slices.Equal(seen, want) {
+		t.Errorf("streamed statuses %v, want %v", seen, want)
+	}
+}
+
+// jobList is the body of GET /admin/jobs
+type jobList struct {
+	Total  int           `json:"total"`
+	Limit  int           `json:"limit"`
+	Offset int           `json:"offset"`
+	Jobs   []*shared.Job `json:"jobs"`
+}
+
+func TestAdminListJobsFiltersAndPages(t *testing.T) {
+	setupGateway(t)
+	base := time.Now().Add(-time.Hour)
+	for i, st := range []shared.JobStatus{shared.JobStatusFailed, shared.JobStatusCompleted, shared.JobStatusFailed} {
+		seedJob(t, &shared.Job{ID: fmt.Sprintf("job-%d", i), Status: st, CreatedAt: base.Add(time.Duration(i) * time.Minute)})
+	}
+
+	var list jobList
+	rec := serve(handleAdminListJobs, http.MethodGet, "/admin/jobs?status=failed", "")
+	decodeBody(t, rec, &list)
+	if list.Total != 2 || len(list.Jobs) != 2 || list.Jobs[0].ID != "job-2" || list.Jobs[1].ID != "job-0" {
+		t.Errorf("status=failed listed %+v", list)
+	}
+
+	list = jobList{}
+	decodeBody(t, serve(handleAdminListJobs, http.MethodGet, "/admin/jobs?limit=1&offset=2", ""), &list)
+	if list.Total != 3 || list.Offset != 2 || len(list.Jobs) != 1 || list.Jobs[0].ID != "job-0" {
+		t.Errorf("last page listed %+v", list)
+	}
+
+	list = jobList{}
+	decodeBody(t, serve(handleAdminListJobs, http.MethodGet, "/admin/jobs?offset=3", ""), &list)
+	if list.Total != 3 || len(list.Jobs) != 0 {
+		t.Errorf("offset past the end listed %+v", list)
+	}
+
+	list = jobList{}
+	decodeBody(t, serve(handleAdminListJobs, http.MethodGet, fmt.Sprintf("/admin/jobs?limit=%d", shared.MaxListLimit+1), ""), &list)
+	if list.Limit != shared.MaxListLimit {
+		t.Errorf("limit = %d, want it capped at %d", list.Limit, shared.MaxListLimit)
+	}
+
+	for _, query := range []string{"offset=-1", "offset=x", "limit=0", "limit=-5", "status=bogus", "include_deleted=maybe"} {
+		if rec := serve(handleAdminListJobs, http.MethodGet, "/admin/jobs?"+query, ""); rec.Code != http.StatusBadRequest {
+			t.Errorf("?%s: status %d, want 400", query, rec.Code)
+		}
+	}
+}
+
+func TestCORSOrigins(t *testing.T) {
+	setupGateway(t)
+	corsOnly := func(w http.ResponseWriter, r *http.Request) { enableCORS(w, r) }
+	tests := []struct {
+		name        string
+		allowed     []string
+		origin      string
+		wantOrigin  string
+		credentials bool
+	}{
+		{"allowed origin", []string{"https://app.example"}, "https://app.example", "https://app.example", true},
+		{"allowed origin with trailing slash", []string{"https://App.example/"}, "https://app.example", "https://app.example", true},
+		{"disallowed origin", []string{"https://app.example"}, "https://evil.example", "", false},
+		{"no origin", []string{"https://app.example"}, "", "", false},
+		{"wildcard", []string{"*"}, "https://anything.example", "*", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg.AllowedOrigins = tt.allowed
+			rec := serve(corsOnly, http.MethodGet, "/status/job-1", "", "Origin", tt.origin)
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Credentials") == "true"; got != tt.credentials {
+				t.Errorf("Access-Control-Allow-Credentials set = %v, want %v", got, tt.credentials)
+			}
+			if !slices.Contains(rec.Header().Values("Vary"), "Origin") {
+				t.Error("response does not vary on Origin")
+			}
+		})
+	}
+}
+
+func TestCORSPreflightPerRoute(t *testing.T) {
+	t.Setenv("CORS_MAX_AGE_SECONDS", "3600")
+	setupGateway(t)
+	cfg.AllowedOrigins = []string{"https://app.example"}
+	tests := []struct {
+		handler     http.HandlerFunc
+		target      string
+		wantMethods string
+		wantHeader  string // One of the allowed request headers
+	}{
+		{handleExtract, "/extract", "POST, OPTIONS", idempotencyKeyHeader},
+		{handleDownload, "/download/job-1", "GET, HEAD, OPTIONS", "Range"},
+		{handleDownload, "/download/job-1/thumbnail", "GET, HEAD, OPTIONS", "If-None-Match"},
+	}
+	for _, tt := range tests {
+		rec := serve(tt.handler, http.MethodOptions, tt.target, "", "Origin", "https://app.example",
+			"Access-Control-Request-Method", "GET")
+		h := rec.Header()
+		if rec.Code != http.StatusOK || h.Get("Access-Control-Allow-Origin") != "https://app.example" {
+			t.Errorf("%s: status %d, origin %q", tt.target, rec.Code, h.Get("Access-Control-Allow-Origin"))
+		}
+		if got := h.Get("Access-Control-Allow-Methods"); got != tt.wantMethods {
+			t.Errorf("%s: Access-Control-Allow-Methods = %q, want %q", tt.target, got, tt.wantMethods)
+		}
+		if got := h.Get("Access-Control-Allow-Headers"); !strings.Contains(got, tt.wantHeader) {
+			t.Errorf("%s: Access-Control-Allow-Headers = %q, want %s in it", tt.target, got, tt.wantHeader)
+		}
+		if got := h.Get("Access-Control-Max-Age"); got != "3600" {
+			t.Errorf("%s: Access-Control-Max-Age = %q, want 3600", tt.target, got)
+		}
+	}
+
+	// Exact paths win over the prefixes covering them
+	if route, _ := corsRouteFor("/admin/jobs/bulk-delete"); route.methods != "POST, OPTIONS" {
+		t.Errorf("/admin/jobs/bulk-delete allows %q", route.methods)
+	}
+	// Only preflights describe the route, and only to allowed origins
+	rec := serve(handleStatus, http.MethodGet, "/status/job-1", "", "Origin", "https://app.example")
+	if rec.Header().Get("Access-Control-Allow-Methods") != "" || rec.Header().Get("Access-Control-Max-Age") != "" {
+		t.Errorf("plain request got preflight headers %v", rec.Header())
+	}
+	rec = serve(handleExtract, http.MethodOptions, "/extract", "", "Origin", "https://evil.example")
+	if rec.Header().Get("Access-Control-Allow-Methods") != "" {
+		t.Errorf("disallowed origin got preflight headers %v", rec.Header())
+	}
+}
+
+func TestAPIKeyMiddleware(t *testing.T) {
+	setupGateway(t)
+	valid, _, err := apiKeys.Create("alice", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	limited, _, err := apiKeys.Create("bob", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := apiKeyMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	if rec := serve(handler, http.MethodPost, "/extract", "", shared.APIKeyHeader, valid); rec.Code != http.StatusNoContent {
+		t.Errorf("valid key: status %d", rec.Code)
+	}
+	rec := serve(handler, http.MethodPost, "/extract", "", shared.APIKeyHeader, "yt_invalid")
+	if rec.Code != http.StatusUnauthorized || errorCode(t, rec) != shared.ErrCodeUnauthorized {
+		t.Errorf("invalid key: status %d, body %s", rec.Code, rec.Body)
+	}
+
+	rec = serve(handler, http.MethodPost, "/extract", "", shared.APIKeyHeader, limited)
+	if rec.Code != http.StatusNoContent || rec.Header().Get("X-Quota-Remaining") != "0" {
+		t.Errorf("key within quota: status %d, X-Quota-Remaining %q", rec.Code, rec.Header().Get("X-Quota-Remaining"))
+	}
+	rec = serve(handler, http.MethodPost, "/extract", "", shared.APIKeyHeader, limited)
+	if rec.Code != http.StatusTooManyRequests || errorCode(t, rec) != shared.ErrCodeQuotaExceeded {
+		t.Errorf("key over quota: status %d, body %s", rec.Code, rec.Body)
+	}
+
+	if rec := serve(handler, http.MethodPost, "/extract", ""); rec.Code != http.StatusNoContent {
+		t.Errorf("no key while optional: status %d", rec.Code)
+	}
+	cfg.RequireAPIKey = true
+	if rec := serve(handler, http.MethodPost, "/extract", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("no key while required: status %d", rec.Code)
+	}
+}
+
+func TestAdminRequeueDeadLetter(t *testing.T) {
+	setupGateway(t)
+	ctx := context.Background()
+	job := seedJob(t, &shared.Job{ID: "job-1", Status: shared.JobStatusFailed, Error: "yt-dlp failed", Attempts: 3})
+	if err := mq.DeadLetter(ctx, shared.JobMessageFor(job), "yt-dlp failed"); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serve(handleAdminRequeueDeadLetter, http.MethodPost, "/admin/dlq/job-1/requeue", "")
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	stored, err := db.GetJob(ctx, "job-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != shared.JobStatusPending || stored.Error != "" {
+		t.Errorf("requeued job is %s with error %q, want pending without one", stored.Status, stored.Error)
+	}
+	if depth, _ := mq.Depth(ctx); depth != 1 {
+		t.Errorf("queue depth %d, want the job queued", depth)
+	}
+	if entries, _ := mq.DeadLetters(ctx); len(entries) != 0 {
+		t.Errorf("dead-letter queue still holds %+v", entries)
+	}
+
+	rec = serve(handleAdminRequeueDeadLetter, http.MethodPost, "/admin/dlq/job-1/requeue", "")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("requeueing twice: status %d, want 404", rec.Code)
+	}
+}
+
+func TestAdminListDeadLettersOmitsCookies(t *testing.T) {
+	setupGateway(t)
+	// As dead-lettered by a worker that still kept the request's cookies
+	msg := shared.JobMessage{JobID: "job-1", OriginalURL: "https://youtu.be/dQw4w9WgXcQ", Cookies: "c2Vzc2lvbg=="}
+	if err := mq.DeadLetter(context.Background(), msg, "yt-dlp failed"); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serve(handleAdminListDeadLetters, http.MethodGet, "/admin/dlq", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if strings.Contains(rec.Body.String(), msg.Cookies) {
+		t.Errorf("listing exposes the cookies: %s", rec.Body)
+	}
+	var resp struct {
+		Total int `json:"total"`
+	}
+	decodeBody(t, rec, &resp)
+	if resp.Total != 1 {
+		t.Errorf("total = %d, want 1", resp.Total)
+	}
+}
+
+// unreachableDB is a database whose every call fails, as when Redis is down
+type unreachableDB struct{ shared.DatabaseClient }
+
+func (unreachableDB) Ping(ctx context.Context) error {
+	return fmt.Errorf("dial tcp 10.0.0.5:6379: connection refused")
+}
+
+func TestHealthReportsFailingDatabase(t *testing.T) {
+	setupGateway(t)
+	rec := serve(handleHealth, http.MethodGet, "/health", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("healthy gateway: status %d: %s", rec.Code, rec.Body)
+	}
+
+	db = unreachableDB{db}
+	rec = serve(handleHealth, http.MethodGet, "/health", "")
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status %d, want 503", rec.Code)
+	}
+	var resp struct {
+		Status string                        `json:"status"`
+		Checks map[string]shared.HealthCheck `json:"checks"`
+	}
+	decodeBody(t, rec, &resp)
+	if resp.Status != "unhealthy" || resp.Checks["database"].OK || !resp.Checks["queue"].OK {
+		t.Errorf("response %+v, want only the database failing", resp)
+	}
+}
+
+func TestHealthReportsJobCounts(t *testing.T) {
+	setupGateway(t)
+	seedJob(t, &shared.Job{ID: "pending"})
+	seedJob(t, &shared.Job{ID: "done", Status: shared.JobStatusCompleted})
+	seedJob(t, &shared.Job{ID: "gone", Status: shared.JobStatusCompleted})
+	if err := db.DeleteJob(context.Background(), "gone"); err != nil {
+		t.Fatal(err)
+	}
+
+	var resp struct {
+		JobsByStatus map[shared.JobStatus]int `json:"jobs_by_status"`
+	}
+	decodeBody(t, serve(handleHealth, http.MethodGet, "/health", ""), &resp)
+	want := map[shared.JobStatus]int{shared.JobStatusPending: 1, shared.JobStatusProcessing: 0, shared.JobStatusCompleted: 1}
+	for st, n := range want {
+		if resp.JobsByStatus[st] != n {
+			t.Errorf("jobs_by_status %v, want %v", resp.JobsByStatus, want)
+			break
+		}
+	}
+}
+
+// bulkDeleteResult is the body of POST /admin/jobs/bulk-delete
+type bulkDeleteResult struct {
+	Matched      int               `json:"matched"`
+	Deleted      int               `json:"deleted"`
+	FilesDeleted int               `json:"files_deleted"`
+	Errors       map[string]string `json:"errors"`
+}
+
+func TestAdminBulkDeleteCombinesFilters(t *testing.T) {
+	setupGateway(t)
+	ctx := context.Background()
+	old := time.Now().Add(-48 * time.Hour)
+	oldFailed := seedJob(t, &shared.Job{ID: "old-failed", Status: shared.JobStatusFailed, CreatedAt: old, OutputExt: "mp3",
+		FilePath: filepath.Join(cfg.OutputDir, "old-failed.mp3")})
+	writeOutput(t, oldFailed, "partial")
+	seedJob(t, &shared.Job{ID: "old-completed", Status: shared.JobStatusCompleted, CreatedAt: old})
+	seedJob(t, &shared.Job{ID: "new-failed", Status: shared.JobStatusFailed})
+	seedJob(t, &shared.Job{ID: "old-processing", Status: shared.JobStatusProcessing, CreatedAt: old})
+
+	rec := serve(handleAdminBulkDelete, http.MethodPost, "/admin/jobs/bulk-delete", `{"status":"failed","older_than":"24h"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var res bulkDeleteResult
+	decodeBody(t, rec, &res)
+	if res.Matched != 1 || res.Deleted != 1 || res.FilesDeleted != 1 || len(res.Errors) != 0 {
+		t.Errorf("result %+v, want only old-failed deleted with its file", res)
+	}
+	if _, err := os.Stat(oldFailed.FilePath); !os.IsNotExist(err) {
+		t.Error("the deleted job's file was kept")
+	}
+	for id, want := range map[string]bool{"old-failed": false, "old-completed": true, "new-failed": true, "old-processing": true} {
+		if _, err := db.GetJob(ctx, id); (err == nil) != want {
+			t.Errorf("%s kept = %v, want %v", id, err == nil, want)
+		}
+	}
+
+	// Listed IDs are still filtered; a processing job is reported, not deleted
+	rec = serve(handleAdminBulkDelete, http.MethodPost, "/admin/jobs/bulk-delete",
+		`{"ids":["old-completed","new-failed","old-processing","missing"],"older_than":"24h"}`)
+	res = bulkDeleteResult{}
+	decodeBody(t, rec, &res)
+	if res.Matched != 2 || res.Deleted != 1 || res.Errors["old-processing"] == "" {
+		t.Errorf("result %+v, want old-completed deleted and old-processing refused", res)
+	}
+	if _, err := db.GetJob(ctx, "new-failed"); err != nil {
+		t.Error("a job newer than older_than was deleted")
+	}
+
+	// Deleting again is a no-op
+	rec = serve(handleAdminBulkDelete, http.MethodPost, "/admin/jobs/bulk-delete", `{"status":"failed","older_than":"24h"}`)
+	res = bulkDeleteResult{}
+	decodeBody(t, rec, &res)
+	if rec.Code != http.StatusOK || res.Matched != 0 || res.Deleted != 0 {
+		t.Errorf("repeated delete: status %d, result %+v", rec.Code, res)
+	}
+}
+
+func TestAdminBulkDeleteRequiresAFilter(t *testing.T) {
+	setupGateway(t)
+	for _, body := range []string{`{}`, `{"status":"bogus"}`, `{"older_than":"-1h"}`} {
+		rec := serve(handleAdminBulkDelete, http.MethodPost, "/admin/jobs/bulk-delete", body)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", body, rec.Code)
+		}
+	}
+}
+
+func TestExtractIdempotencyKey(t *testing.T) {
+	setupGateway(t)
+	submit := func(key string) (*httptest.ResponseRecorder, string) {
+		rec := serve(handleExtract, http.MethodPost, "/extract", `{"url":"https://youtu.be/dQw4w9WgXcQ"}`, idempotencyKeyHeader, key)
+		var resp struct {
+			JobID string `json:"job_id"`
+		}
+		decodeBody(t, rec, &resp)
+		return rec, resp.JobID
+	}
+
+	rec, first := submit("order-1")
+	if rec.Code != http.StatusOK || first == "" {
+		t.Fatalf("first request: status %d: %s", rec.Code, rec.Body)
+	}
+	rec, replayed := submit("order-1")
+	if replayed != first || rec.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("duplicate request got job %q (replayed %q), want %q", replayed, rec.Header().Get("Idempotent-Replayed"), first)
+	}
+	if _, other := submit("order-2"); other == "" || other == first {
+		t.Errorf("a different key got job %q, want a new one", other)
+	}
+	if depth, _ := mq.Depth(context.Background()); depth != 2 {
+		t.Errorf("queue depth %d, want one job per key", depth)
+	}
+}
+
+// fixedJobIDs makes newJobID hand out ids in order for the rest of the test
+func fixedJobIDs(t *testing.T, ids ...string) {
+	t.Helper()
+	orig := newJobID
+	t.Cleanup(func() { newJobID = orig })
+	newJobID = func() string {
+		if len(ids) == 0 {
+			t.Fatal("newJobID called more often than expected")
+		}
+		id := ids[0]
+		ids = ids[1:]
+		return id
+	}
+}
+
+func TestExtractRecoversFromJobIDCollision(t *testing.T) {
+	setupGateway(t)
+	taken := seedJob(t, &shared.Job{ID: "taken", OriginalURL: "https://youtu.be/aaaaaaaaaaa"})
+	fixedJobIDs(t, "taken", "fresh", "replay")
+
+	rec := serve(handleExtract, http.MethodPost, "/extract", `{"url":"https://youtu.be/dQw4w9WgXcQ"}`, idempotencyKeyHeader, "order-1")
+	var resp struct {
+		JobID string `json:"job_id"`
+	}
+	decodeBody(t, rec, &resp)
+	if rec.Code != http.StatusOK || resp.JobID != "fresh" {
+		t.Fatalf("status %d, job %q: %s", rec.Code, resp.JobID, rec.Body)
+	}
+	if job, err := db.GetJob(context.Background(), "taken"); err != nil || job.OriginalURL != taken.OriginalURL {
+		t.Errorf("the existing job was overwritten: %+v, %v", job, err)
+	}
+	// The key must point at the job that was created, not the colliding ID
+	rec = serve(handleExtract, http.MethodPost, "/extract", `{"url":"https://youtu.be/dQw4w9WgXcQ"}`, idempotencyKeyHeader, "order-1")
+	decodeBody(t, rec, &resp)
+	if resp.JobID != "fresh" || rec.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("replay got job %q (replayed %q), want fresh", resp.JobID, rec.Header().Get("Idempotent-Replayed"))
+	}
+}
+
+func TestExtractGivesUpAfterRepeatedCollisions(t *testing.T) {
+	setupGateway(t)
+	seedJob(t, &shared.Job{ID: "taken"})
+	ids := make([]string, maxJobIDAttempts)
+	for i := range ids {
+		ids[i] = "taken"
+	}
+	fixedJobIDs(t, ids...)
+
+	rec := serve(handleExtract, http.MethodPost, "/extract", `{"url":"https://youtu.be/dQw4w9WgXcQ"}`, idempotencyKeyHeader, "order-1")
+	if rec.Code != http.StatusInternalServerError || errorCode(t, rec) != shared.ErrCodeInternal {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	// The key was released, so the client's retry creates the job
+	fixedJobIDs(t, "fresh")
+	rec = serve(handleExtract, http.MethodPost, "/extract", `{"url":"https://youtu.be/dQw4w9WgXcQ"}`, idempotencyKeyHeader, "order-1")
+	if rec.Code != http.StatusOK || rec.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("retry: status %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestRateLimitBucketsAreSeparate(t *testing.T) {
+	setupGateway(t)
+	cfg.RateLimitExtractRPM = 2
+	cfg.RateLimitStatusRPM = 10
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	extract := rateLimitMiddleware(shared.RateLimitBucketExtract, ok)
+	status := rateLimitMiddleware(shared.RateLimitBucketStatus, ok)
+
+	for i := 1; i <= cfg.RateLimitExtractRPM; i++ {
+		serve(extract, http.MethodPost, "/extract", "")
+	}
+	if rec := serve(extract, http.MethodPost, "/extract", ""); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("extract over its limit: status %d", rec.Code)
+	}
+	rec := serve(status, http.MethodGet, "/status/x", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status after the extract bucket ran out: %d", rec.Code)
+	}
+	if got := rec.Header().Get("X-RateLimit-Remaining"); got != "9" {
+		t.Errorf("status X-RateLimit-Remaining = %q, want 9", got)
+	}
+}
+
+func TestStatusEstimatesWait(t *testing.T) {
+	setupGateway(t)
+	cfg.MaxWorkers = 2
+	ctx := context.Background()
+	seedJob(t, &shared.Job{ID: "job-1"})
+	for _, d := range []time.Duration{20 * time.Second, 40 * time.Second} {
+		db.RecordProcessingTime(ctx, d)
+	}
+	for i := 0; i < 4; i++ {
+		mq.Publish(ctx, shared.JobMessage{JobID: fmt.Sprintf("queued-%d", i)})
+	}
+
+	rec := serve(handleStatus, http.MethodGet, "/status/job-1", "")
+	var resp struct {
+		EstimatedWaitSeconds int `json:"estimated_wait_seconds"`
+	}
+	decodeBody(t, rec, &resp)
+	if resp.EstimatedWaitSeconds != 60 { // 4 queued jobs over 2 workers at 30s each
+		t.Errorf("estimated_wait_seconds = %d, want 60", resp.EstimatedWaitSeconds)
+	}
+}
+
+func TestAdminJobLogs(t *testing.T) {
+	setupGateway(t)
+	seedJob(t, &shared.Job{ID: "job-1", Status: shared.JobStatusFailed})
+	db.SaveJobLogs(context.Background(), "job-1", "=== attempt 1 ===\nERROR: Video unavailable\n")
+
+	rec := serve(handleAdminJobLogs, http.MethodGet, "/admin/jobs/job-1/logs", "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Video unavailable") {
+		t.Errorf("status %d: %q", rec.Code, rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Content-Type %q", ct)
+	}
+	if rec := serve(handleAdminJobLogs, http.MethodGet, "/admin/jobs/missing/logs", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown job: status %d", rec.Code)
+	}
+}
+
+func TestExtractRejectsBadBodies(t *testing.T) {
+	setupGateway(t)
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantCode   string
+	}{
+		{"oversized", `{"url":"https://youtu.be/dQw4w9WgXcQ","client_metadata":{"x":"` + strings.Repeat("a", shared.MaxJSONBodySize) + `"}}`,
+			http.StatusRequestEntityTooLarge, shared.ErrCodeBodyTooLarge},
+		{"unknown field", `{"url":"https://youtu.be/dQw4w9WgXcQ","fromat":"mp3"}`, http.StatusBadRequest, shared.ErrCodeInvalidRequest},
+		{"malformed", `{"url":`, http.StatusBadRequest, shared.ErrCodeInvalidRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(handleExtract, http.MethodPost, "/extract", tt.body)
+			if rec.Code != tt.wantStatus || errorCode(t, rec) != tt.wantCode {
+				t.Errorf("status %d: %s", rec.Code, rec.Body)
+			}
+		})
+	}
+	if depth, _ := mq.Depth(context.Background()); depth != 0 {
+		t.Errorf("rejected bodies queued %d jobs", depth)
+	}
+
+	if rec := serve(handleExtract, http.MethodPost, "/extract", `{"url":"https://youtu.be/dQw4w9WgXcQ","format":"mp3"}`); rec.Code != http.StatusOK {
+		t.Errorf("valid body: status %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestAdminStats(t *testing.T) {
+	setupGateway(t)
+	ctx := context.Background()
+	completed := time.Now().Add(-30 * time.Minute)
+	seedJob(t, &shared.Job{ID: "pending"})
+	seedJob(t, &shared.Job{ID: "failed", Status: shared.JobStatusFailed})
+	seedJob(t, &shared.Job{ID: "done", Status: shared.JobStatusCompleted, CompletedAt: &completed})
+	mq.Publish(ctx, shared.JobMessage{JobID: "pending"})
+	db.RecordProcessingTime(ctx, 10*time.Second)
+	db.RecordProcessingTime(ctx, 20*time.Second)
+
+	rec := serve(handleAdminStats, http.MethodGet, "/admin/stats", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var stats struct {
+		JobsByStatus      map[shared.JobStatus]int `json:"jobs_by_status"`
+		TotalJobs         int                      `json:"total_jobs"`
+		CompletedLastHour int                      `json:"completed_last_hour"`
+		CompletedLastDay  int                      `json:"completed_last_day"`
+		AverageSeconds    float64                  `json:"average_processing_seconds"`
+		QueueDepth        int64                    `json:"queue_depth"`
+	}
+	decodeBody(t, rec, &stats)
+	if stats.TotalJobs != 3 || stats.JobsByStatus[shared.JobStatusPending] != 1 ||
+		stats.JobsByStatus[shared.JobStatusFailed] != 1 || stats.JobsByStatus[shared.JobStatusCompleted] != 1 {
+		t.Errorf("job counts %+v", stats)
+	}
+	if stats.CompletedLastHour != 1 || stats.CompletedLastDay != 1 || stats.AverageSeconds != 15 || stats.QueueDepth != 1 {
+		t.Errorf("stats %+v", stats)
+	}
+}
+
+func TestExtractSampleRateAndChannels(t *testing.T) {
+	setupGateway(t)
+	rec := serve(handleExtract, http.MethodPost, "/extract", `{"url":"https://youtu.be/dQw4w9WgXcQ","sample_rate":22050,"channels":"mono"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	msg, err := mq.Consume(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if queued := <-msg; queued.SampleRate != 22050 || queued.Channels != "mono" {
+		t.Errorf("queued sample rate %d, channels %q", queued.SampleRate, queued.Channels)
+	}
+
+	for _, body := range []string{
+		`{"url":"https://youtu.be/dQw4w9WgXcQ","sample_rate":12345}`,
+		`{"url":"https://youtu.be/dQw4w9WgXcQ","channels":"5.1"}`,
+		`{"url":"https://youtu.be/dQw4w9WgXcQ","format":"opus","sample_rate":22050}`,
+	} {
+		rec := serve(handleExtract, http.MethodPost, "/extract", body)
+		if rec.Code != http.StatusUnprocessableEntity || errorCode(t, rec) != shared.ErrCodeValidationFailed {
+			t.Errorf("%s: status %d: %s", body, rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestExtractFormatID(t *testing.T) {
+	setupGateway(t)
+	rec := serve(handleExtract, http.MethodPost, "/extract", `{"url":"https://youtu.be/dQw4w9WgXcQ","format_id":" 251 "}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	msg, err := mq.Consume(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if queued := <-msg; queued.FormatID != "251" {
+		t.Errorf("queued format ID %q, want 251", queued.FormatID)
+	}
+
+	for _, id := range []string{"bestaudio/best", "137+140", "-f", "251 --exec rm"} {
+		body := fmt.Sprintf(`{"url":"https://youtu.be/dQw4w9WgXcQ","format_id":%q}`, id)
+		rec := serve(handleExtract, http.MethodPost, "/extract", body)
+		if rec.Code != http.StatusUnprocessableEntity || errorCode(t, rec) != shared.ErrCodeValidationFailed {
+			t.Errorf("format_id %q: status %d: %s", id, rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestErrorResponsesUseEnvelope(t *testing.T) {
+	setupGateway(t)
+	seedJob(t, &shared.Job{ID: "done", Status: shared.JobStatusCompleted})
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		method     string
+		target     string
+		body       string
+		wantStatus int
+		wantCode   string
+	}{
+		{"wrong method", handleExtract, http.MethodGet, "/extract", "", http.StatusMethodNotAllowed, shared.ErrCodeMethodNotAllowed},
+		{"invalid fields", handleExtract, http.MethodPost, "/extract", `{"url":"https://youtube.com.evil.com/watch?v=dQw4w9WgXcQ"}`, http.StatusUnprocessableEntity, shared.ErrCodeValidationFailed},
+		{"disallowed host", handleMetadata, http.MethodPost, "/metadata", `{"url":"https://youtube.com.evil.com/watch?v=dQw4w9WgXcQ"}`, http.StatusBadRequest, shared.ErrCodeInvalidURL},
+		{"malformed body", handleExtract, http.MethodPost, "/extract", `{`, http.StatusBadRequest, shared.ErrCodeInvalidRequest},
+		{"unknown job", handleStatus, http.MethodGet, "/status/missing", "", http.StatusNotFound, shared.ErrCodeNotFound},
+		{"wrong state", handleCancel, http.MethodPost, "/cancel/done", "", http.StatusConflict, shared.ErrCodeConflict},
+		{"unknown download", handleDownload, http.MethodGet, "/download/missing", "", http.StatusNotFound, shared.ErrCodeNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(tt.handler, tt.method, tt.target, tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type = %q", ct)
+			}
+			var env map[string]map[string]any
+			decodeBody(t, rec, &env)
+			if len(env) != 1 || env["error"]["code"] != tt.wantCode || env["error"]["message"] == "" {
+				t.Errorf("body %s, want an error envelope with code %s", rec.Body, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestDownloadRequiresValidToken(t *testing.T) {
+	setupGateway(t)
+	cfg.DownloadSecret = "s3cret"
+	job := seedJob(t, &shared.Job{ID: "done", Status: shared.JobStatusCompleted, OutputExt: "mp3"})
+	writeOutput(t, job, "ID3 audio bytes")
+
+	// The link handed out by /status carries a working token
+	status := serve(handleStatus, http.MethodGet, "/status/done", "")
+	var resp struct {
+		DownloadEndpoint string `json:"download_endpoint"`
+	}
+	decodeBody(t, status, &resp)
+	link, err := url.Parse(resp.DownloadEndpoint)
+	if err != nil || link.Query().Get(shared.DownloadTokenParam) == "" {
+		t.Fatalf("download_endpoint %q has no token", resp.DownloadEndpoint)
+	}
+	if rec := serve(handleDownload, http.MethodGet, link.RequestURI(), ""); rec.Code != http.StatusOK {
+		t.Errorf("valid token: status %d: %s", rec.Code, rec.Body)
+	}
+
+	expired := time.Now().Add(-time.Minute)
+	tests := map[string]string{
+		"no token": "/download/done",
+		"expired": fmt.Sprintf("/download/done?token=%s&expires=%d",
+			shared.SignDownload(cfg.DownloadSecret, "done", expired), expired.Unix()),
+		"tampered":  strings.Replace(link.RequestURI(), "/done?", "/done?token=00&", 1),
+		"other job": strings.Replace(link.RequestURI(), "/done?", "/other?", 1),
+	}
+	for name, target := range tests {
+		rec := serve(handleDownload, http.MethodGet, target, "")
+		if rec.Code != http.StatusForbidden || errorCode(t, rec) != shared.ErrCodeForbidden {
+			t.Errorf("%s: status %d: %s", name, rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestThumbnailRequiresValidToken(t *testing.T) {
+	setupGateway(t)
+	cfg.DownloadSecret = "s3cret"
+	seedJob(t, &shared.Job{ID: "done", Status: shared.JobStatusCompleted, OutputExt: "mp3", ThumbnailFile: "done_thumb.jpg",
+		ThumbnailEndpoint: "http://localhost:8080/thumbnail/done"})
+	if err := os.WriteFile(filepath.Join(cfg.OutputDir, "done_thumb.jpg"), []byte("jpeg bytes"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The unsigned link the job was stored with is replaced by a signed one
+	status := serve(handleStatus, http.MethodGet, "/status/done", "")
+	var resp struct {
+		ThumbnailEndpoint string `json:"thumbnail_endpoint"`
+	}
+	decodeBody(t, status, &resp)
+	link, err := url.Parse(resp.ThumbnailEndpoint)
+	if err != nil || link.Path != "/thumbnail/done" || link.Query().Get(shared.DownloadTokenParam) == "" {
+		t.Fatalf("thumbnail_endpoint %q has no token", resp.ThumbnailEndpoint)
+	}
+	if rec := serve(handleThumbnail, http.MethodGet, link.RequestURI(), ""); rec.Code != http.StatusOK || rec.Body.String() != "jpeg bytes" {
+		t.Errorf("valid token: status %d: %s", rec.Code, rec.Body)
+	}
+
+	expired := time.Now().Add(-time.Minute)
+	tests := map[string]string{
+		"no token": "/thumbnail/done",
+		"expired": fmt.Sprintf("/thumbnail/done?token=%s&expires=%d",
+			shared.SignDownload(cfg.DownloadSecret, "done", expired), expired.Unix()),
+		"tampered":  strings.Replace(link.RequestURI(), "/done?", "/done?token=00&", 1),
+		"other job": strings.Replace(link.RequestURI(), "/done?", "/other?", 1),
+	}
+	for name, target := range tests {
+		rec := serve(handleThumbnail, http.MethodGet, target, "")
+		if rec.Code != http.StatusForbidden || errorCode(t, rec) != shared.ErrCodeForbidden {
+			t.Errorf("%s: status %d: %s", name, rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestAdminJobHistoryRecordsTransitions(t *testing.T) {
+	setupGateway(t)
+	rec := serve(handleExtract, http.MethodPost, "/extract", `{"url":"https://youtu.be/dQw4w9WgXcQ"}`)
+	var submitted struct {
+		JobID string `json:"job_id"`
+	}
+	decodeBody(t, rec, &submitted)
+	if rec := serve(handleCancel, http.MethodPost, "/cancel/"+submitted.JobID, ""); rec.Code != http.StatusOK {
+		t.Fatalf("cancel: status %d: %s", rec.Code, rec.Body)
+	}
+
+	var history struct {
+		JobID  string            `json:"job_id"`
+		Events []shared.JobEvent `json:"events"`
+	}
+	rec = serve(handleAdminGetJob, http.MethodGet, "/admin/jobs/"+submitted.JobID+"/history", "")
+	decodeBody(t, rec, &history)
+	var got []string
+	for _, ev := range history.Events {
+		got = append(got, fmt.Sprintf("%s %s: %s", ev.Source, ev.Status, ev.Reason))
+	}
+	want := []string{
+		"api-gateway pending: submitted",
+		"api-gateway cancelled: cancelled by client while pending",
+	}
+	if history.JobID != submitted.JobID || !slices.Equal(got, want) {
+		t.Errorf("history of %s: %q, want %q", history.JobID, got, want)
+	}
+
+	if rec := serve(handleAdminGetJob, http.MethodGet, "/admin/jobs/missing/history", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown job: status %d", rec.Code)
+	}
+}
+
+func TestStatusReportsFailureReason(t *testing.T) {
+	setupGateway(t)
+	seedJob(t, &shared.Job{ID: "failed", Status: shared.JobStatusFailed, Error: "yt-dlp failed: Private video",
+		FailureReason: shared.FailureVideoUnavailable})
+	seedJob(t, &shared.Job{ID: "pending"})
+
+	var resp map[string]any
+	decodeBody(t, serve(handleStatus, http.MethodGet, "/status/failed", ""), &resp)
+	if resp["failure_reason"] != string(shared.FailureVideoUnavailable) {
+		t.Errorf("failed job: failure_reason = %v", resp["failure_reason"])
+	}
+	resp = nil
+	decodeBody(t, serve(handleStatus, http.MethodGet, "/status/pending", ""), &resp)
+	if _, ok := resp["failure_reason"]; ok {
+		t.Errorf("pending job has failure_reason %v", resp["failure_reason"])
+	}
+}
+
+func TestDownloadUsesFilenameTemplate(t *testing.T) {
+	setupGateway(t)
+	cfg.FilenameTemplate = "{uploader} - {title}"
+	tests := []struct {
+		job  *shared.Job
+		want string
+	}{
+		{&shared.Job{ID: "plain", Metadata: &shared.Metadata{Title: "Song/Remix", Uploader: "Artist"}},
+			`attachment; filename="Artist - Song_Remix.mp3"`},
+		{&shared.Job{ID: "unicode", Metadata: &shared.Metadata{Title: "Hoppípolla", Uploader: "Sigur Rós"}},
+			`attachment; filename="Sigur R_s - Hopp_polla.mp3"; filename*=UTF-8''Sigur%20R%C3%B3s%20-%20Hopp%C3%ADpolla.mp3`},
+		{&shared.Job{ID: "untitled"}, `attachment; filename="untitled.mp3"`},
+	}
+	for _, tt := range tests {
+		tt.job.Status, tt.job.OutputExt = shared.JobStatusCompleted, "mp3"
+		writeOutput(t, seedJob(t, tt.job), "audio")
+		rec := serve(handleDownload, http.MethodGet, "/download/"+tt.job.ID, "")
+		if got := rec.Header().Get("Content-Disposition"); rec.Code != http.StatusOK || got != tt.want {
+			t.Errorf("%s: status %d, Content-Disposition %s, want %s", tt.job.ID, rec.Code, got, tt.want)
+		}
+	}
+}
+
+func TestRateLimitAllowlistTrustsOnlyProxies(t *testing.T) {
+	setupGateway(t)
+	cfg.RateLimitStatusRPM = 1
+	if err := rl.SetAllowlist([]string{"192.0.2.0/24"}); err != nil {
+		t.Fatal(err)
+	}
+	var err error
+	if trustedProxies, err = shared.ParseIPNets([]string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	handler := rateLimitMiddleware(shared.RateLimitBucketStatus, ok)
+	statusFrom := func(remoteAddr string, headers ...string) int {
+		req := httptest.NewRequest(http.MethodGet, "/status/x", nil)
+		req.RemoteAddr = remoteAddr
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec.Code
+	}
+
+	for i := 0; i < 3; i++ {
+		if code := statusFrom("192.0.2.7:1000"); code != http.StatusOK {
+			t.Fatalf("allowlisted client, request %d: status %d", i+1, code)
+		}
+		if code := statusFrom("10.0.0.2:1000", "X-Forwarded-For", "192.0.2.8"); code != http.StatusOK {
+			t.Fatalf("allowlisted client via proxy, request %d: status %d", i+1, code)
+		}
+	}
+
+	// An untrusted client can neither claim an allowlisted IP nor spread its
+	// requests over made-up ones
+	if code := statusFrom("203.0.113.5:1000"); code != http.StatusOK {
+		t.Fatalf("first request: status %d", code)
+	}
+	for i, header := range []string{"X-Forwarded-For", "X-Real-IP"} {
+		for _, spoofed := range []string{"192.0.2.9", fmt.Sprintf("198.51.100.%d", i)} {
+			if code := statusFrom("203.0.113.5:1000", header, spoofed); code != http.StatusTooManyRequests {
+				t.Errorf("%s: %s from an untrusted client: status %d, want 429", header, spoofed, code)
+			}
+		}
+	}
+	if code := statusFrom("10.0.0.2:1000", "X-Forwarded-For", "203.0.113.6"); code != http.StatusOK {
+		t.Errorf("another client via proxy: status %d", code)
+	}
+}
+
+func TestStatusStreamSendsKeepalivesAndTimesOut(t *testing.T) {
+	setupGateway(t)
+	cfg.SSEMaxDuration = 300 * time.Millisecond
+	defer func(interval time.Duration) { sseKeepaliveInterval = interval }(sseKeepaliveInterval)
+	sseKeepaliveInterval = 20 * time.Millisecond
+	seedJob(t, &shared.Job{ID: "stuck"}) // Never finishes
+	srv := httptest.NewServer(http.HandlerFunc(handleStatus))
+	defer srv.Close()
+
+	start := time.Now()
+	resp, err := http.Get(srv.URL + "/status/stuck/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body := bufio.NewReader(resp.Body)
+	keepalives := 0
+	var last sseEvent
+	for {
+		ev, ok := readSSE(t, body)
+		if !ok {
+			break
+		}
+		if ev.Comment == "keepalive" {
+			keepalives++
+		} else if ev.Event != "" {
+			last = ev
+		}
+	}
+	if elapsed := time.Since(start); elapsed < cfg.SSEMaxDuration || elapsed > 5*time.Second {
+		t.Errorf("stream closed after %s, want about %s", elapsed, cfg.SSEMaxDuration)
+	}
+	if keepalives < 2 {
+		t.Errorf("got %d keepalive comments, want several", keepalives)
+	}
+	if last.Event != "timeout" || !strings.Contains(last.Data, `"job_id":"stuck"`) {
+		t.Errorf("last event = %+v, want a timeout event for the job", last)
+	}
+}
+
+func TestAdminSearchJobs(t *testing.T) {
+	setupGateway(t)
+	base := time.Now().Add(-time.Hour)
+	seedJob(t, &shared.Job{ID: "rick", OriginalURL: "https://www.youtube.com/watch?v=dQw4w9WgXcQ",
+		Metadata: &shared.Metadata{Title: "Never Gonna Give You Up"}, CreatedAt: base})
+	seedJob(t, &shared.Job{ID: "psy", OriginalURL: "https://youtu.be/9bZkp7q19f0",
+		Metadata: &shared.Metadata{Title: "Gangnam Style"}, CreatedAt: base.Add(time.Minute)})
+
+	for query, want := range map[string]string{
+		"q=watch%3Fv%3DdQw4": "rick", // URL fragment
+		"q=gangnam+STYLE":    "psy",  // Title, any case
+		"q=youtu&limit=1":    "psy",  // Newest first, paged
+	} {
+		var list jobList
+		rec := serve(handleAdminSearchJobs, http.MethodGet, "/admin/jobs/search?"+query, "")
+		decodeBody(t, rec, &list)
+		if rec.Code != http.StatusOK || len(list.Jobs) != 1 || list.Jobs[0].ID != want {
+			t.Errorf("?%s: status %d, listed %+v, want %s", query, rec.Code, list, want)
+		}
+	}
+	for _, query := range []string{"", "q=+", "q=x&status=nope", "q=x&limit=0"} {
+		if rec := serve(handleAdminSearchJobs, http.MethodGet, "/admin/jobs/search?"+query, ""); rec.Code != http.StatusBadRequest {
+			t.Errorf("?%s: status %d, want 400", query, rec.Code)
+		}
+	}
+}
+
+func TestExtractWithSubtitlesSkipsCachedJobWithoutThem(t *testing.T) {
+	setupGateway(t)
+	plain := seedJob(t, &shared.Job{ID: "plain", Status: shared.JobStatusCompleted, VideoID: "dQw4w9WgXcQ",
+		Format: "mp3", Bitrate: shared.DefaultBitrate, OutputExt: "mp3"})
+	writeOutput(t, plain, "audio")
+
+	var resp struct {
+		JobID  string `json:"job_id"`
+		Cached bool   `json:"cached"`
+	}
+	rec := serve(handleExtract, http.MethodPost, "/extract", `{"url":"https://youtu.be/dQw4w9WgXcQ","with_subtitles":true}`)
+	decodeBody(t, rec, &resp)
+	if rec.Code != http.StatusOK || resp.Cached {
+		t.Fatalf("status %d, response %+v; want a new job", rec.Code, resp)
+	}
+	job, err := db.GetJob(context.Background(), resp.JobID)
+	if err != nil || !job.WithSubtitles {
+		t.Fatalf("new job %+v, %v; want with_subtitles set", job, err)
+	}
+
+	// A job that looked for subtitles and found none is still a cache hit
+	plain.WithSubtitles = true
+	if err := db.UpdateJob(context.Background(), plain); err != nil {
+		t.Fatal(err)
+	}
+	rec = serve(handleExtract, http.MethodPost, "/extract", `{"url":"https://youtu.be/dQw4w9WgXcQ","with_subtitles":true}`)
+	resp.Cached = false
+	decodeBody(t, rec, &resp)
+	if resp.JobID != "plain" || !resp.Cached {
+		t.Errorf("response = %+v, want the cached job", resp)
+	}
+}
+
+func TestStatusReportsExpiresAt(t *testing.T) {
+	setupGateway(t)
+	completedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	seedJob(t, &shared.Job{ID: "done", Status: shared.JobStatusCompleted, CompletedAt: &completedAt,
+		ExpiresAt: shared.ExpiryAfter(completedAt, cfg.JobTTL)})
+	seedJob(t, &shared.Job{ID: "pending"})
+
+	var status struct {
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+	decodeBody(t, serve(handleStatus, http.MethodGet, "/status/done", ""), &status)
+	if status.ExpiresAt == nil || !status.ExpiresAt.Equal(completedAt.Add(cfg.JobTTL)) {
+		t.Errorf("expires_at = %v, want completed_at + %s", status.ExpiresAt, cfg.JobTTL)
+	}
+	status.ExpiresAt = nil
+	decodeBody(t, serve(handleStatus, http.MethodGet, "/status/pending", ""), &status)
+	if status.ExpiresAt != nil {
+		t.Errorf("unfinished job expires_at = %v", status.ExpiresAt)
+	}
+}
+
+func TestExtractReportsEveryInvalidField(t *testing.T) {
+	setupGateway(t)
+	rec := serve(handleExtract, http.MethodPost, "/extract",
+		`{"url":"https://youtu.be/dQw4w9WgXcQ","format":"wma","bitrate":"7k","start_time":"30","end_time":"10"}`)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var resp struct {
+		Error struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+			Details struct {
+				Fields []shared.FieldError `json:"fields"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	decodeBody(t, rec, &resp)
+	var fields []string
+	for _, f := range resp.Error.Details.Fields {
+		fields = append(fields, f.Field)
+		if !strings.Contains(resp.Error.Message, f.Field+": "+f.Message) {
+			t.Errorf("message %q doesn't mention %s", resp.Error.Message, f.Field)
+		}
+	}
+	if want := []string{"format", "bitrate", "end_time"}; resp.Error.Code != shared.ErrCodeValidationFailed || !slices.Equal(fields, want) {
+		t.Errorf("code %s, fields %v; want %s, %v", resp.Error.Code, fields, shared.ErrCodeValidationFailed, want)
+	}
+	if depth, _ := mq.Depth(context.Background()); depth != 0 {
+		t.Errorf("an invalid request queued %d jobs", depth)
+	}
+}
@@ -0,0 +1,192 @@
+// api-gateway/metadata.go
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+// metadataFetchTimeout bounds how long yt-dlp may take to describe one video
+const metadataFetchTimeout = 20 * time.Second
+
+// metadataRequest is the body of POST /metadata
+type metadataRequest struct {
+	URL string `json:"url"`
+}
+
+// lookupYtDlp resolves the configured yt-dlp binary
+func lookupYtDlp() (string, error) {
+	yt := cfg.YtDlpPath
+	if strings.TrimSpace(yt) == "" {
+		yt = "yt-dlp"
+	}
+	p, err := exec.LookPath(yt)
+	if err != nil {
+		return "", fmt.Errorf("yt-dlp not available: %w", err)
+	}
+	return p, nil
+}
+
+// fetchMetadata asks yt-dlp for a video's details without downloading anything
+func fetchMetadata(ctx context.Context, videoURL string) (*shared.Metadata, error) {
+	videoURL = canonicalURL(videoURL, true) // The details don't depend on a timestamp
+	ytPath, err := lookupYtDlp()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, metadataFetchTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, ytPath, "-f", "bestaudio", "--dump-single-json", "--no-warnings",
+		"--no-playlist", "--", videoURL)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("yt-dlp timed out after %s", metadataFetchTimeout)
+		}
+		return nil, fmt.Errorf("yt-dlp failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	meta, err := shared.ParseVideoInfo(stdout.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse yt-dlp output: %v", err)
+	}
+	if meta.Formats, err = shared.ParseStreamFormats(stdout.Bytes()); err != nil {
+		return nil, fmt.Errorf("failed to parse yt-dlp formats: %v", err)
+	}
+	return meta, nil
+}
+
+// handleMetadata: Returns a video's title, duration, thumbnail etc. without
+// creating a job. Results are cached by video ID for cfg.MetadataCacheTTL.
+func handleMetadata(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w, r)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPost {
+		shared.WriteError(w, http.StatusMethodNotAllowed, shared.ErrCodeMethodNotAllowed, "Invalid request method")
+		return
+	}
+
+	var req metadataRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.URL == "" {
+		shared.WriteError(w, http.StatusBadRequest, shared.ErrCodeInvalidURL, "Missing YouTube URL")
+		return
+	}
+	if err := shared.ValidateVideoURL(req.URL, cfg.AllowedVideoHosts); err != nil {
+		shared.WriteError(w, http.StatusBadRequest, shared.ErrCodeInvalidURL, fmt.Sprintf("URL not allowed: %v", err))
+		return
+	}
+	if shared.IsPlaylistURL(req.URL) {
+		shared.WriteError(w, http.StatusBadRequest, shared.ErrCodeInvalidRequest, "Playlists are not supported by /metadata")
+		return
+	}
+
+	meta, cached, err := lookupMetadata(r.Context(), req.URL)
+	if err != nil {
+		logger.Warn("Failed to fetch metadata", "url", req.URL, "error", err)
+		shared.WriteError(w, http.StatusBadGateway, shared.ErrCodeUpstream, "Failed to fetch video metadata")
+		return
+	}
+	writeMetadata(w, meta, cached)
+}
+
+// handleFormats: Lists the audio streams a video offers, so clients can pick
+// a format_id for /extract. Shares the metadata cache with /metadata.
+func handleFormats(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w, r)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPost {
+		shared.WriteError(w, http.StatusMethodNotAllowed, shared.ErrCodeMethodNotAllowed, "Invalid request method")
+		return
+	}
+
+	var req metadataRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.URL == "" {
+		shared.WriteError(w, http.StatusBadRequest, shared.ErrCodeInvalidURL, "Missing YouTube URL")
+		return
+	}
+	if err := shared.ValidateVideoURL(req.URL, cfg.AllowedVideoHosts); err != nil {
+		shared.WriteError(w, http.StatusBadRequest, shared.ErrCodeInvalidURL, fmt.Sprintf("URL not allowed: %v", err))
+		return
+	}
+	if shared.IsPlaylistURL(req.URL) {
+		shared.WriteError(w, http.StatusBadRequest, shared.ErrCodeInvalidRequest, "Playlists are not supported by /formats")
+		return
+	}
+
+	meta, cached, err := lookupMetadata(r.Context(), req.URL)
+	if err == nil && cached && meta.Formats == nil {
+		// Cached before formats were recorded
+		meta, err = fetchMetadata(r.Context(), req.URL)
+		cached = false
+	}
+	if err != nil {
+		logger.Warn("Failed to fetch formats", "url", req.URL, "error", err)
+		shared.WriteError(w, http.StatusBadGateway, shared.ErrCodeUpstream, "Failed to fetch video formats")
+		return
+	}
+	videoID, _ := shared.NormalizeVideoID(req.URL)
+	if cached {
+		w.Header().Set("X-Cache", "HIT")
+	} else {
+		w.Header().Set("X-Cache", "MISS")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"video_id": videoID,
+		"title":    meta.Title,
+		"formats":  meta.Formats,
+	})
+}
+
+// lookupMetadata returns videoURL's metadata from the cache, or from yt-dlp
+// and then caches it; cached tells which
+func lookupMetadata(ctx context.Context, videoURL string) (meta *shared.Metadata, cached bool, err error) {
+	videoID, _ := shared.NormalizeVideoID(videoURL)
+	if videoID != "" {
+		if meta, ok := metadataCache.Get(ctx, videoID); ok {
+			return meta, true, nil
+		}
+	}
+	meta, err = fetchMetadata(ctx, videoURL)
+	if err != nil {
+		return nil, false, err
+	}
+	if videoID != "" {
+		if err := metadataCache.Set(ctx, videoID, meta, cfg.MetadataCacheTTL); err != nil {
+			logger.Warn("Failed to cache metadata", "video_id", videoID, "error", err)
+		}
+	}
+	return meta, false, nil
+}
+
+// writeMetadata responds with meta; X-Cache tells whether yt-dlp was skipped
+func writeMetadata(w http.ResponseWriter, meta *shared.Metadata, cached bool) {
+	if cached {
+		w.Header().Set("X-Cache", "HIT")
+	} else {
+		w.Header().Set("X-Cache", "MISS")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(meta)
+}
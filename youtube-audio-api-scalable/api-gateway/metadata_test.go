@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+// fakeVideoInfo is yt-dlp --dump-single-json output for a 212 second video
+const fakeVideoInfo = `{"id":"dQw4w9WgXcQ","title":"Test Song","uploader":"Test Artist","duration":212,` +
+	`"thumbnail":"https://i.ytimg.com/vi/dQw4w9WgXcQ/hqdefault.jpg","live_status":"not_live",` +
+	`"formats":[{"format_id":"251","ext":"webm","acodec":"opus","vcodec":"none","abr":160}]}`
+
+func TestMetadataFetchesAndCaches(t *testing.T) {
+	ytDlp := stubYtDlp(t, fakeVideoInfo)
+	t.Setenv("YTDLP_PATH", ytDlp)
+	setupGateway(t)
+
+	rec := serve(handleMetadata, http.MethodPost, "/metadata", `{"url":"https://www.youtube.com/watch?v=dQw4w9WgXcQ"}`)
+	if rec.Code != http.StatusOK || rec.Header().Get("X-Cache") != "MISS" {
+		t.Fatalf("status %d, X-Cache %q: %s", rec.Code, rec.Header().Get("X-Cache"), rec.Body)
+	}
+	var meta shared.Metadata
+	decodeBody(t, rec, &meta)
+	if meta.Title != "Test Song" || meta.Duration != 212 || meta.Thumbnail == "" {
+		t.Errorf("metadata = %+v", meta)
+	}
+	args, _ := os.ReadFile(ytDlp + ".args")
+	if !strings.Contains(string(args), "--dump-single-json") {
+		t.Errorf("yt-dlp was run with %q", args)
+	}
+
+	// Another URL for the same video must be answered without yt-dlp
+	os.Remove(ytDlp)
+	rec = serve(handleMetadata, http.MethodPost, "/metadata", `{"url":"https://youtu.be/dQw4w9WgXcQ"}`)
+	if rec.Code != http.StatusOK || rec.Header().Get("X-Cache") != "HIT" {
+		t.Fatalf("cached lookup: status %d, X-Cache %q: %s", rec.Code, rec.Header().Get("X-Cache"), rec.Body)
+	}
+	decodeBody(t, rec, &meta)
+	if meta.Title != "Test Song" {
+		t.Errorf("cached metadata = %+v", meta)
+	}
+	if jobs, _ := db.GetAllJobs(context.Background()); len(jobs) != 0 {
+		t.Errorf("/metadata created %d jobs", len(jobs))
+	}
+	if depth, _ := mq.Depth(context.Background()); depth != 0 {
+		t.Errorf("/metadata queued %d jobs", depth)
+	}
+}
+
+func TestMetadataRejectsBadRequests(t *testing.T) {
+	t.Setenv("YTDLP_PATH", stubYtDlp(t, fakeVideoInfo))
+	setupGateway(t)
+	tests := []struct {
+		body       string
+		wantStatus int
+	}{
+		{`{"url":"https://evil.example/watch?v=dQw4w9WgXcQ"}`, http.StatusBadRequest},
+		{`{"url":""}`, http.StatusBadRequest},
+		{`{"url":"https://www.youtube.com/playlist?list=PLtest"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if rec := serve(handleMetadata, http.MethodPost, "/metadata", tt.body); rec.Code != tt.wantStatus {
+			t.Errorf("%s: status %d, want %d", tt.body, rec.Code, tt.wantStatus)
+		}
+	}
+
+	t.Setenv("YTDLP_PATH", stubYtDlp(t, "not json"))
+	cfg = shared.LoadConfig()
+	if rec := serve(handleMetadata, http.MethodPost, "/metadata", `{"url":"https://youtu.be/9bZkp7q19f0"}`); rec.Code != http.StatusBadGateway {
+		t.Errorf("broken yt-dlp output: status %d, want 502", rec.Code)
+	}
+}
+
+// fakeFormatsInfo is yt-dlp output for a video with two audio-only streams,
+// a video-only one and a muxed one
+const fakeFormatsInfo = `{"id":"dQw4w9WgXcQ","title":"Test Song","duration":212,"formats":[
+{"format_id":"139","ext":"m4a","acodec":"mp4a.40.5","vcodec":"none","abr":48.8,"filesize":1300000},
+{"format_id":"251","ext":"webm","acodec":"opus","vcodec":"none","abr":129.5,"filesize_approx":3400000},
+{"format_id":"137","ext":"mp4","acodec":"none","vcodec":"avc1.640028"},
+{"format_id":"18","ext":"mp4","acodec":"mp4a.40.2","vcodec":"avc1.42001E","abr":96}]}`
+
+// formatsResponse is the body of a /formats response
+type formatsResponse struct {
+	VideoID string                `json:"video_id"`
+	Title   string                `json:"title"`
+	Formats []shared.StreamFormat `json:"formats"`
+}
+
+func TestFormatsListsAudioStreams(t *testing.T) {
+	ytDlp := stubYtDlp(t, fakeFormatsInfo)
+	t.Setenv("YTDLP_PATH", ytDlp)
+	setupGateway(t)
+
+	rec := serve(handleFormats, http.MethodPost, "/formats", `{"url":"https://www.youtube.com/watch?v=dQw4w9WgXcQ"}`)
+	if rec.Code != http.StatusOK || rec.Header().Get("X-Cache") != "MISS" {
+		t.Fatalf("status %d, X-Cache %q: %s", rec.Code, rec.Header().Get("X-Cache"), rec.Body)
+	}
+	var resp formatsResponse
+	decodeBody(t, rec, &resp)
+	var ids []string
+	for _, f := range resp.Formats {
+		ids = append(ids, f.FormatID)
+	}
+	if resp.VideoID != "dQw4w9WgXcQ" || resp.Title != "Test Song" || strings.Join(ids, ",") != "139,251,18" {
+		t.Fatalf("response = %+v", resp)
+	}
+	if f := resp.Formats[1]; f.Ext != "webm" || f.Codec != "opus" || f.Abr != 129.5 || f.Filesize != 3400000 || !f.AudioOnly {
+		t.Errorf("format 251 = %+v", f)
+	}
+	if resp.Formats[2].AudioOnly {
+		t.Error("the muxed format is listed as audio only")
+	}
+
+	// The same video is answered from the cache
+	os.Remove(ytDlp)
+	rec = serve(handleFormats, http.MethodPost, "/formats", `{"url":"https://youtu.be/dQw4w9WgXcQ"}`)
+	if rec.Code != http.StatusOK || rec.Header().Get("X-Cache") != "HIT" {
+		t.Fatalf("cached lookup: status %d, X-Cache %q: %s", rec.Code, rec.Header().Get("X-Cache"), rec.Body)
+	}
+	decodeBody(t, rec, &resp)
+	if len(resp.Formats) != 3 {
+		t.Errorf("cached formats = %+v", resp.Formats)
+	}
+}
+
+func TestFormatsRefetchesMetadataCachedWithoutFormats(t *testing.T) {
+	t.Setenv("YTDLP_PATH", stubYtDlp(t, fakeFormatsInfo))
+	setupGateway(t)
+	if err := metadataCache.Set(context.Background(), "dQw4w9WgXcQ", &shared.Metadata{Title: "Test Song"}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serve(handleFormats, http.MethodPost, "/formats", `{"url":"https://www.youtube.com/watch?v=dQw4w9WgXcQ"}`)
+	var resp formatsResponse
+	decodeBody(t, rec, &resp)
+	if rec.Code != http.StatusOK || rec.Header().Get("X-Cache") != "MISS" || len(resp.Formats) != 3 {
+		t.Errorf("status %d, X-Cache %q, formats %+v", rec.Code, rec.Header().Get("X-Cache"), resp.Formats)
+	}
+}
+
+func TestFormatsRejectsBadRequests(t *testing.T) {
+	ytDlp := stubYtDlp(t, fakeFormatsInfo)
+	t.Setenv("YTDLP_PATH", ytDlp)
+	setupGateway(t)
+	for _, body := range []string{
+		`{"url":"https://youtube.com.evil.com/watch?v=dQw4w9WgXcQ"}`,
+		`{"url":""}`,
+		`{"url":"https://www.youtube.com/playlist?list=PLtest"}`,
+	} {
+		if rec := serve(handleFormats, http.MethodPost, "/formats", body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", body, rec.Code)
+		}
+	}
+	if _, err := os.Stat(ytDlp + ".args"); err == nil {
+		t.Error("yt-dlp ran for a rejected request")
+	}
+	if rec := serve(handleFormats, http.MethodGet, "/formats", ""); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: status %d, want 405", rec.Code)
+	}
+}
@@ -0,0 +1,517 @@
+// api-gateway/openapi.go
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+// openAPIVersion is the version of the API described at /openapi.json
+const openAPIVersion = "1.0.0"
+
+// The document is built on first request and served as-is afterwards
+var (
+	openAPIOnce sync.Once
+	openAPIDoc  []byte
+	openAPIErr  error
+)
+
+// handleOpenAPI: GET /openapi.json describes the public and admin routes as
+// an OpenAPI 3 document. Request and response schemas are generated from the
+// Go types the handlers decode and encode, so new fields show up on their own.
+func handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w, r)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		shared.WriteError(w, http.StatusMethodNotAllowed, shared.ErrCodeMethodNotAllowed, "Invalid request method")
+		return
+	}
+	openAPIOnce.Do(func() {
+		openAPIDoc, openAPIErr = json.Marshal(buildOpenAPI())
+	})
+	if openAPIErr != nil {
+		logger.Error("Failed to build OpenAPI document", "error", openAPIErr)
+		shared.WriteError(w, http.StatusInternalServerError, shared.ErrCodeInternal, "Failed to build API description")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPIDoc)
+}
+
+// openAPIEnums lists the values of string types that only take a fixed set
+var openAPIEnums = map[reflect.Type][]string{
+	reflect.TypeOf(shared.JobStatus("")): enumValues(shared.JobStatuses),
+	reflect.TypeOf(shared.Priority("")):  enumValues(shared.Priorities[:]),
+	reflect.TypeOf(shared.ArtifactType("")): {
+		string(shared.ArtifactAudio), string(shared.ArtifactThumbnail), string(shared.ArtifactSubtitles),
+	},
+}
+
+// enumValues converts a list of string constants for openAPIEnums
+func enumValues[T ~string](values []T) []string {
+	out := make([]string, len(values))
+	for i, v := range values {
+		out[i] = string(v)
+	}
+	return out
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage(nil))
+)
+
+// schemaBuilder turns Go types into JSON schemas, following encoding/json's
+// rules for field names. Named structs are added to components once and
+// referenced from then on.
+type schemaBuilder struct {
+	components map[string]any
+}
+
+// schemaFor returns the schema of v's type
+func (b *schemaBuilder) schemaFor(v any) map[string]any {
+	return b.schema(reflect.TypeOf(v))
+}
+
+func (b *schemaBuilder) schema(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t {
+	case timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case rawMessageType:
+		return map[string]any{} // Any JSON value
+	}
+	if values, ok := openAPIEnums[t]; ok {
+		return map[string]any{"type": "string", "enum": values}
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": b.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.object(t)
+		}
+		name := componentName(t)
+		if _, ok := b.components[name]; !ok {
+			b.components[name] = nil // Reserved, in case the type refers to itself
+			b.components[name] = b.object(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]any{} // Interfaces and anything else: any JSON value
+}
+
+// object returns the schema of struct t. Fields without omitempty are
+// listed as required, as they are always present in responses.
+func (b *schemaBuilder) object(t reflect.Type) map[string]any {
+	props := map[string]any{}
+	var required []string
+	b.addFields(t, props, &required)
+	s := map[string]any{"type": "object", "properties": props}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+// addFields adds t's JSON fields to props, flattening embedded structs
+func (b *schemaBuilder) addFields(t reflect.Type, props map[string]any, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" || (!f.IsExported() && !f.Anonymous) {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			b.addFields(f.Type, props, required)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = b.schema(f.Type)
+		if !strings.Contains(opts, "omitempty") && f.Type.Kind() != reflect.Pointer {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// componentName names t's schema, e.g. Job or BatchResult
+func componentName(t reflect.Type) string {
+	name := t.Name()
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// withoutProperty returns a copy of object schema s without the property name
+func withoutProperty(s map[string]any, name string) map[string]any {
+	props := map[string]any{}
+	for k, v := range s["properties"].(map[string]any) {
+		if k != name {
+			props[k] = v
+		}
+	}
+	out := map[string]any{"type": "object", "properties": props}
+	if required, ok := s["required"].([]string); ok {
+		var kept []string
+		for _, r := range required {
+			if r != name {
+				kept = append(kept, r)
+			}
+		}
+		if len(kept) > 0 {
+			out["required"] = kept
+		}
+	}
+	return out
+}
+
+// objectSchema describes a response the handlers build as a map
+func objectSchema(props map[string]any) map[string]any {
+	return map[string]any{"type": "object", "properties": props}
+}
+
+func jsonContent(schema map[string]any) map[string]any {
+	return map[string]any{"application/json": map[string]any{"schema": schema}}
+}
+
+func jsonBody(schema map[string]any) map[string]any {
+	return map[string]any{"required": true, "content": jsonContent(schema)}
+}
+
+func jsonResponse(description string, schema map[string]any) map[string]any {
+	return map[string]any{"description": description, "content": jsonContent(schema)}
+}
+
+func pathParam(name, description string) map[string]any {
+	return map[string]any{"name": name, "in": "path", "required": true, "description": description,
+		"schema": map[string]any{"type": "string"}}
+}
+
+func queryParam(name, typ, description string) map[string]any {
+	return map[string]any{"name": name, "in": "query", "description": description,
+		"schema": map[string]any{"type": typ}}
+}
+
+// operation builds one operation; every one may also answer with an
+// ErrorResponse, whose code tells the cause
+func operation(summary string, params []any, body map[string]any, responses map[string]any) map[string]any {
+	responses["default"] = map[string]any{"$ref": "#/components/responses/Error"}
+	op := map[string]any{"summary": summary, "responses": responses}
+	if len(params) > 0 {
+		op["parameters"] = params
+	}
+	if body != nil {
+		op["requestBody"] = body
+	}
+	return op
+}
+
+// adminOperation is an operation on /admin/, which requires the admin token
+func adminOperation(summary string, params []any, body map[string]any, responses map[string]any) map[string]any {
+	op := operation(summary, params, body, responses)
+	op["security"] = []any{map[string]any{"adminToken": []any{}}}
+	op["tags"] = []string{"admin"}
+	return op
+}
+
+// buildOpenAPI assembles the document served at /openapi.json. Paths are
+// listed by hand, as the handlers route on prefixes; keep them in step with
+// the routes registered in main.
+func buildOpenAPI() map[string]any {
+	b := &schemaBuilder{components: map[string]any{}}
+	str := map[string]any{"type": "string"}
+	integer := map[string]any{"type": "integer"}
+	boolean := map[string]any{"type": "boolean"}
+	message := objectSchema(map[string]any{"message": str})
+	job := b.schemaFor(shared.Job{})
+	jobID := pathParam("job_id", "ID returned when the job was submitted")
+	jobIDs := map[string]any{"type": "array", "items": str}
+
+	// An API key is optional on /extract; it raises quotas and allows priority high
+	optionalAPIKey := []any{map[string]any{}, map[string]any{"apiKey": []any{}}}
+
+	extract := operation("Submit a video or playlist for conversion",
+		[]any{
+			queryParam("dry_run", "boolean", "Only check that the video would be accepted"),
+			map[string]any{"name": idempotencyKeyHeader, "in": "header", "schema": str,
+				"description": "Repeating a submission with the same key returns the original job"},
+		},
+		jsonBody(b.schemaFor(shared.Request{})),
+		map[string]any{
+			"200": jsonResponse("Job queued, served from the result cache, or the dry-run verdict",
+				map[string]any{"oneOf": []any{
+					objectSchema(map[string]any{
+						"job_id": str, "status": str, "message": str, "instructions": str,
+						"estimated_wait_seconds": integer, "cached": boolean, "download_endpoint": str,
+						"child_ids": jobIDs,
+					}),
+					b.schemaFor(dryRunResult{}),
+				}}),
+		})
+	extract["security"] = optionalAPIKey
+
+	batch := operation("Submit several videos with the same options",
+		nil,
+		jsonBody(withoutProperty(b.object(reflect.TypeOf(batchRequest{})), "url")),
+		map[string]any{
+			"200": jsonResponse("One result per URL", objectSchema(map[string]any{
+				"jobs":   map[string]any{"type": "array", "items": b.schemaFor(batchResult{})},
+				"queued": integer,
+				"failed": integer,
+			})),
+		})
+	batch["security"] = optionalAPIKey
+
+	videoURL := jsonBody(b.schemaFor(metadataRequest{}))
+	formats := objectSchema(map[string]any{
+		"video_id": str,
+		"title":    str,
+		"formats":  map[string]any{"type": "array", "items": b.schemaFor(shared.StreamFormat{})},
+	})
+	binary := map[string]any{"description": "The file",
+		"content": map[string]any{"application/octet-stream": map[string]any{
+			"schema": map[string]any{"type": "string", "format": "binary"}}}}
+	listOf := func(key string, items map[string]any) map[string]any {
+		return objectSchema(map[string]any{
+			"total": integer,
+			key:     map[string]any{"type": "array", "items": items},
+		})
+	}
+	jobList := objectSchema(map[string]any{
+		"total": integer, "limit": integer, "offset": integer,
+		"jobs": map[string]any{"type": "array", "items": job},
+	})
+	listParams := []any{
+		queryParam("limit", "integer", "Page size"),
+		queryParam("offset", "integer", "Jobs to skip"),
+		queryParam("status", "string", "Only jobs with this status"),
+		queryParam("include_deleted", "boolean", "Include soft-deleted jobs"),
+	}
+
+	paths := map[string]any{
+		"/openapi.json": map[string]any{
+			"get": operation("This document", nil, nil, map[string]any{
+				"200": jsonResponse("OpenAPI 3 document", map[string]any{"type": "object"}),
+			}),
+		},
+		"/extract":       map[string]any{"post": extract},
+		"/extract/batch": map[string]any{"post": batch},
+		"/metadata": map[string]any{
+			"post": operation("Look up a video's metadata without converting it", nil, videoURL, map[string]any{
+				"200": jsonResponse("The video's metadata", b.schemaFor(shared.Metadata{})),
+			}),
+		},
+		"/formats": map[string]any{
+			"post": operation("List the audio streams a video offers, for format_id", nil, videoURL, map[string]any{
+				"200": jsonResponse("The video's streams with audio", formats),
+			}),
+		},
+		"/status/{job_id}": map[string]any{
+			"get": operation("Get a job's status", []any{jobID}, nil, map[string]any{
+				"200": jsonResponse("The job", job),
+			}),
+		},
+		"/status/{job_id}/stream": map[string]any{
+			"get": operation("Follow a job's status as Server-Sent Events", []any{jobID}, nil, map[string]any{
+				"200": map[string]any{"description": "Event stream of job updates",
+					"content": map[string]any{"text/event-stream": map[string]any{"schema": str}}},
+			}),
+		},
+		"/download/{job_id}": map[string]any{
+			"get": operation("Download a completed job's audio", []any{jobID}, nil, map[string]any{
+				"200": binary,
+				"206": binary,
+			}),
+		},
+		"/download/{job_id}/{artifact}": map[string]any{
+			"get": operation("Download another of a job's artifacts", []any{jobID,
+				pathParam("artifact", "Artifact type, e.g. thumbnail or subtitles")}, nil, map[string]any{
+				"200": binary,
+				"206": binary,
+			}),
+		},
+		"/thumbnail/{job_id}": map[string]any{
+			"get": operation("Download a job's thumbnail", []any{jobID}, nil, map[string]any{"200": binary}),
+		},
+		"/cancel/{job_id}": map[string]any{
+			"post": operation("Cancel a pending or processing job", []any{jobID}, nil, map[string]any{
+				"200": jsonResponse("Cancellation requested", objectSchema(map[string]any{
+					"job_id": str, "status": str, "message": str,
+				})),
+			}),
+		},
+		"/jobs/{job_id}/rerun": map[string]any{
+			"post": operation("Queue a finished job again with its original options", []any{jobID},
+				map[string]any{"content": jsonContent(b.schemaFor(rerunRequest{}))}, map[string]any{
+					"202": jsonResponse("The job, pending again", job),
+				}),
+		},
+		"/health": map[string]any{
+			"get": operation("Check the gateway and its dependencies", nil, nil, map[string]any{
+				"200": jsonResponse("Healthy", objectSchema(map[string]any{
+					"status":         str,
+					"checks":         map[string]any{"type": "object", "additionalProperties": b.schemaFor(shared.HealthCheck{})},
+					"jobs_by_status": map[string]any{"type": "object", "additionalProperties": integer},
+				})),
+			}),
+		},
+
+		"/admin/jobs": map[string]any{
+			"get": adminOperation("List jobs, newest first", listParams, nil, map[string]any{
+				"200": jsonResponse("A page of jobs", jobList),
+			}),
+		},
+		"/admin/jobs/search": map[string]any{
+			"get": adminOperation("Search jobs by URL or title",
+				append([]any{queryParam("q", "string", "Text to find, ignoring case")}, listParams...), nil,
+				map[string]any{"200": jsonResponse("A page of matching jobs", jobList)}),
+		},
+		"/admin/jobs/bulk-delete": map[string]any{
+			"post": adminOperation("Delete jobs matching all the given filters", nil,
+				jsonBody(objectSchema(map[string]any{
+					"status":     str,
+					"older_than": map[string]any{"type": "string", "description": "Go duration, e.g. 72h"},
+					"ids":        jobIDs,
+				})),
+				map[string]any{"200": jsonResponse("What was deleted", map[string]any{"type": "object"})}),
+		},
+		"/admin/jobs/{job_id}": map[string]any{
+			"get": adminOperation("Get a job", []any{jobID}, nil, map[string]any{
+				"200": jsonResponse("The job", job),
+			}),
+		},
+		"/admin/jobs/{job_id}/force-status": map[string]any{
+			"post": adminOperation("Resolve a stuck job by setting its final status", []any{jobID},
+				jsonBody(b.schemaFor(forceStatusRequest{})),
+				map[string]any{"200": jsonResponse("The updated job", job)}),
+		},
+		"/admin/jobs/{job_id}/logs": map[string]any{
+			"get": adminOperation("Get the yt-dlp and ffmpeg output of a job", []any{jobID}, nil, map[string]any{
+				"200": map[string]any{"description": "Captured output",
+					"content": map[string]any{"text/plain": map[string]any{"schema": str}}},
+			}),
+		},
+		"/admin/jobs/{job_id}/history": map[string]any{
+			"get": adminOperation("Get a job's status changes, oldest first", []any{jobID}, nil, map[string]any{
+				"200": jsonResponse("The job's events", objectSchema(map[string]any{
+					"job_id": str,
+					"events": map[string]any{"type": "array", "items": b.schemaFor(shared.JobEvent{})},
+				})),
+			}),
+		},
+		"/admin/jobs/{job_id}/progress/stream": map[string]any{
+			"get": adminOperation("Follow a running job's ffmpeg output as Server-Sent Events", []any{jobID}, nil,
+				map[string]any{"200": map[string]any{"description": "Event stream of progress lines",
+					"content": map[string]any{"text/event-stream": map[string]any{"schema": b.schemaFor(shared.ProgressLine{})}}}}),
+		},
+		"/admin/delete/{job_id}": map[string]any{
+			"delete": adminOperation("Delete a job and its files",
+				[]any{jobID, queryParam("soft", "boolean", "Keep the record, marked deleted")}, nil,
+				map[string]any{"200": jsonResponse("Deleted", message)}),
+		},
+		"/admin/apikeys": map[string]any{
+			"post": adminOperation("Issue an API key", nil,
+				jsonBody(map[string]any{"type": "object", "required": []string{"owner"}, "properties": map[string]any{
+					"owner":       str,
+					"daily_quota": map[string]any{"type": "integer", "description": "0 means unlimited"},
+				}}),
+				map[string]any{"201": jsonResponse("The key; its plaintext is only returned here", objectSchema(map[string]any{
+					"id": str, "key": str, "owner": str, "daily_quota": integer,
+					"created_at": map[string]any{"type": "string", "format": "date-time"},
+				}))}),
+		},
+		"/admin/apikeys/{key_id}": map[string]any{
+			"delete": adminOperation("Revoke an API key", []any{pathParam("key_id", "ID of the key")}, nil,
+				map[string]any{"200": jsonResponse("Revoked", message)}),
+		},
+		"/admin/stats": map[string]any{
+			"get": adminOperation("Summarize jobs, queue depth and workers", nil, nil, map[string]any{
+				"200": jsonResponse("Statistics", objectSchema(map[string]any{
+					"jobs_by_status":             map[string]any{"type": "object", "additionalProperties": integer},
+					"total_jobs":                 integer,
+					"completed_last_hour":        integer,
+					"completed_last_day":         integer,
+					"average_processing_seconds": map[string]any{"type": "number"},
+					"queue_depth":                integer,
+					"active_workers":             integer,
+				})),
+			}),
+		},
+		"/admin/dlq": map[string]any{
+			"get": adminOperation("List dead-lettered jobs, newest first", nil, nil, map[string]any{
+				"200": jsonResponse("Dead letters", listOf("entries", b.schemaFor(shared.DeadLetter{}))),
+			}),
+		},
+		"/admin/dlq/{job_id}/requeue": map[string]any{
+			"post": adminOperation("Re-submit a dead-lettered job", []any{jobID}, nil, map[string]any{
+				"202": jsonResponse("The job, pending again", job),
+			}),
+		},
+		"/admin/callbacks/dlq": map[string]any{
+			"get": adminOperation("List undelivered callbacks, newest first", nil, nil, map[string]any{
+				"200": jsonResponse("Undelivered callbacks", listOf("entries", b.schemaFor(shared.UndeliveredCallback{}))),
+			}),
+		},
+		"/admin/callbacks/dlq/{job_id}/redeliver": map[string]any{
+			"post": adminOperation("Deliver a job's callback again", []any{jobID}, nil, map[string]any{
+				"200": jsonResponse("Delivered", objectSchema(map[string]any{
+					"job_id": str, "delivered": boolean, "last_status": integer,
+				})),
+			}),
+		},
+		"/admin/ratelimit/{ip}": map[string]any{
+			"get": adminOperation("Show a client's rate limit usage", []any{pathParam("ip", "Client IP")}, nil,
+				map[string]any{"200": jsonResponse("Usage per bucket", objectSchema(map[string]any{
+					"ip": str, "strategy": str, "allowlisted": boolean,
+					"buckets": map[string]any{"type": "array", "items": b.schemaFor(shared.RateLimitUsage{})},
+				}))}),
+			"delete": adminOperation("Reset a client's rate limits", []any{pathParam("ip", "Client IP")}, nil,
+				map[string]any{"200": jsonResponse("Reset", objectSchema(map[string]any{"ip": str, "message": str}))}),
+		},
+	}
+
+	errorResponse := b.schemaFor(shared.ErrorResponse{})
+	b.schemaFor(shared.FieldError{}) // Listed under details.fields of validation_failed errors
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       "YouTube Audio API",
+			"version":     openAPIVersion,
+			"description": "Converts YouTube videos to audio files. Jobs are processed asynchronously: submit to /extract, poll /status/{job_id}, then fetch /download/{job_id}.",
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": b.components,
+			"responses": map[string]any{
+				"Error": jsonResponse("Error; code tells the cause", errorResponse),
+			},
+			"securitySchemes": map[string]any{
+				"adminToken": map[string]any{"type": "http", "scheme": "bearer", "description": "ADMIN_TOKEN"},
+				"apiKey":     map[string]any{"type": "apiKey", "in": "header", "name": shared.APIKeyHeader},
+			},
+		},
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// openAPIDocument fetches /openapi.json as a generic JSON tree
+func openAPIDocument(t *testing.T) map[string]any {
+	t.Helper()
+	rec := serve(handleOpenAPI, http.MethodGet, "/openapi.json", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	var doc map[string]any
+	decodeBody(t, rec, &doc)
+	return doc
+}
+
+// lookup follows keys through nested JSON objects, failing if one is missing
+func lookup(t *testing.T, v any, keys ...string) map[string]any {
+	t.Helper()
+	for i, key := range keys {
+		obj, ok := v.(map[string]any)
+		if !ok {
+			t.Fatalf("%s is not an object", strings.Join(keys[:i], "."))
+		}
+		if v, ok = obj[key]; !ok {
+			t.Fatalf("%s is missing", strings.Join(keys[:i+1], "."))
+		}
+	}
+	obj, ok := v.(map[string]any)
+	if !ok {
+		t.Fatalf("%s is not an object", strings.Join(keys, "."))
+	}
+	return obj
+}
+
+// resolveRef returns the component schema refers to, or schema itself
+func resolveRef(t *testing.T, doc, schema map[string]any) map[string]any {
+	t.Helper()
+	ref, ok := schema["$ref"].(string)
+	if !ok {
+		return schema
+	}
+	name, ok := strings.CutPrefix(ref, "#/components/schemas/")
+	if !ok {
+		t.Fatalf("unexpected $ref %q", ref)
+	}
+	return lookup(t, doc, "components", "schemas", name)
+}
+
+func TestOpenAPIDescribesExtractRequest(t *testing.T) {
+	setupGateway(t)
+	doc := openAPIDocument(t)
+
+	if version, _ := doc["openapi"].(string); !strings.HasPrefix(version, "3.") {
+		t.Errorf("openapi = %q, want 3.x", version)
+	}
+	schema := resolveRef(t, doc, lookup(t, doc,
+		"paths", "/extract", "post", "requestBody", "content", "application/json", "schema"))
+	props := lookup(t, schema, "properties")
+	for _, field := range []string{
+		"url", "format", "bitrate", "callback_url", "embed_tags", "start_time", "end_time",
+		"normalize", "sample_rate", "channels", "cookies", "priority", "format_id",
+		"with_subtitles", "client_metadata", "dry_run",
+	} {
+		if _, ok := props[field]; !ok {
+			t.Errorf("/extract request schema lacks %q", field)
+		}
+	}
+
+	if required, _ := schema["required"].([]any); len(required) != 1 || required[0] != "url" {
+		t.Errorf("required = %v, want [url]", schema["required"])
+	}
+	if priority := lookup(t, props, "priority"); priority["type"] != "string" {
+		t.Errorf("priority schema = %v", priority)
+	}
+	if metadata := lookup(t, props, "client_metadata"); metadata["type"] != "object" {
+		t.Errorf("client_metadata schema = %v", metadata)
+	}
+}
+
+func TestOpenAPIRefsResolve(t *testing.T) {
+	setupGateway(t)
+	doc := openAPIDocument(t)
+	components := lookup(t, doc, "components")
+
+	refs := 0
+	var walk func(path string, v any)
+	walk = func(path string, v any) {
+		switch v := v.(type) {
+		case map[string]any:
+			if ref, ok := v["$ref"].(string); ok {
+				refs++
+				kind, name, _ := strings.Cut(strings.TrimPrefix(ref, "#/components/"), "/")
+				if section, _ := components[kind].(map[string]any); section[name] == nil {
+					t.Errorf("%s: $ref %q does not resolve", path, ref)
+				}
+			}
+			for k, child := range v {
+				walk(path+"."+k, child)
+			}
+		case []any:
+			for _, child := range v {
+				walk(path+"[]", child)
+			}
+		}
+	}
+	walk("", doc)
+	if refs == 0 {
+		t.Error("document has no $refs")
+	}
+}
+
+func TestOpenAPIRejectsOtherMethods(t *testing.T) {
+	setupGateway(t)
+	rec := serve(handleOpenAPI, http.MethodPost, "/openapi.json", "{}")
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("status %d, want 405", rec.Code)
+	}
+}
@@ -0,0 +1,309 @@
+// api-gateway/playlist.go
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"youtube-audio-api-scalable/shared"
+
+	"github.com/google/uuid"
+)
+
+// playlistExpandTimeout bounds how long yt-dlp may take to list a playlist
+const playlistExpandTimeout = 60 * time.Second
+
+// playlistEntry is one video listed by yt-dlp --flat-playlist
+type playlistEntry struct {
+	ID    string `json:"id"`
+	URL   string `json:"url"`
+	Title string `json:"title"`
+}
+
+// videoURL returns the entry's watch URL; flat entries may carry only an ID
+func (e playlistEntry) videoURL() string {
+	if strings.HasPrefix(e.URL, "http://") || strings.HasPrefix(e.URL, "https://") {
+		return e.URL
+	}
+	return shared.WatchURL(e.ID)
+}
+
+// expandPlaylist lists up to limit entries of a playlist without resolving each video
+func expandPlaylist(ctx context.Context, playlistURL string, limit int) ([]playlistEntry, error) {
+	ytPath, err := lookupYtDlp()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, playlistExpandTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, ytPath, "--flat-playlist", "--dump-json", "--no-warnings",
+		"--playlist-end", strconv.Itoa(limit), "--", playlistURL)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("yt-dlp failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	var entries []playlistEntry
+	scanner := bufio.NewScanner(&stdout)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var e playlistEntry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return nil, fmt.Errorf("failed to parse yt-dlp output: %v", err)
+		}
+		if e.ID == "" && e.URL == "" {
+			continue
+		}
+		entries = append(entries, e)
+		if len(entries) >= limit {
+			break
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// handlePlaylistExtract creates a parent job for a playlist and queues one child job per entry
+func handlePlaylistExtract(w http.ResponseWriter, r *http.Request, req shared.Request, format string, bitrate string) {
+	parentID := uuid.New().String()
+	release, ok := claimIdempotencyKey(w, r, parentID)
+	if !ok {
+		return
+	}
+	entries, err := expandPlaylist(r.Context(), req.URL, cfg.MaxPlaylistItems)
+	if err != nil {
+		logger.Error("Failed to expand playlist", "url", req.URL, "error", err)
+		release()
+		shared.WriteError(w, http.StatusBadGateway, shared.ErrCodeUpstream, "Failed to read playlist")
+		return
+	}
+	if !allowQueueDepth(w, r, len(entries)) || !allowActiveJobs(w, r, len(entries)) {
+		release()
+		return
+	}
+
+	embedTags := cfg.EmbedTags
+	if req.EmbedTags != nil {
+		embedTags = *req.EmbedTags
+	}
+	now := time.Now()
+	var children []*shared.Job
+	var createErr error // Last child creation failure, to explain an empty playlist
+	for _, e := range entries {
+		childURL := e.videoURL()
+		if err := shared.ValidateVideoURL(childURL, cfg.AllowedVideoHosts); err != nil {
+			logger.Warn("Skipping playlist entry", "parent_job_id", parentID, "url", childURL, "error", err)
+			continue
+		}
+		fetchURL := canonicalURL(childURL, false)
+		videoID, _ := shared.NormalizeVideoID(fetchURL)
+		child := &shared.Job{
+			OriginalURL:    childURL,
+			Status:         shared.JobStatusPending,
+			CreatedAt:      now,
+			Format:         format,
+			Bitrate:        bitrate,
+			OutputExt:      shared.AudioFormats[format].Ext,
+			VideoID:        videoID,
+			CallbackURL:    req.CallbackURL,
+			Normalize:      req.Normalize,
+			SampleRate:     req.SampleRate,
+			Channels:       req.Channels,
+			FormatID:       req.FormatID,
+			EmbedTags:      embedTags,
+			Priority:       shared.Priority(req.Priority),
+			ParentID:       parentID,
+			WithSubtitles:  req.WithSubtitles,
+			ClientMetadata: req.ClientMetadata,
+		}
+		if fetchURL != childURL {
+			child.CanonicalURL = fetchURL
+		}
+		if e.Title != "" {
+			child.Metadata = &shared.Metadata{Title: e.Title}
+		}
+		err := withFreshJobID(func(jobID string) error {
+			child.ID = jobID
+			return db.CreateJob(r.Context(), child)
+		})
+		if err != nil {
+			shared.WithJob(logger, child.ID).Error("Failed to create playlist child job in DB", "error", err)
+			createErr = err
+			continue
+		}
+		recordJobEvent(r.Context(), child, "submitted as part of playlist "+parentID)
+		children = append(children, child)
+	}
+	if len(children) == 0 {
+		release()
+		writeStoreError(w, createErr, http.StatusUnprocessableEntity, shared.ErrCodeUnprocessable, "Playlist has no downloadable entries")
+		return
+	}
+
+	parent := &shared.Job{
+		ID:             parentID,
+		OriginalURL:    req.URL,
+		Status:         shared.JobStatusPending,
+		CreatedAt:      now,
+		Format:         format,
+		Bitrate:        bitrate,
+		OutputExt:      shared.AudioFormats[format].Ext,
+		Priority:       shared.Priority(req.Priority),
+		ClientMetadata: req.ClientMetadata,
+	}
+	for _, c := range children {
+		parent.ChildIDs = append(parent.ChildIDs, c.ID)
+	}
+	jl := shared.WithJob(logger, parentID)
+	if err := db.CreateJob(r.Context(), parent); err != nil {
+		jl.Error("Failed to create playlist job in DB", "error", err)
+		for _, c := range children {
+			db.DeleteJob(r.Context(), c.ID)
+		}
+		release()
+		writeStoreError(w, err, http.StatusInternalServerError, shared.ErrCodeInternal, "Failed to initialize job")
+		return
+	}
+	recordJobEvent(r.Context(), parent, fmt.Sprintf("playlist submitted with %d entries", len(children)))
+
+	queued := 0
+	for _, c := range children {
+		msg := shared.JobMessage{
+			JobID:         c.ID,
+			OriginalURL:   c.FetchURL(),
+			Format:        format,
+			Bitrate:       bitrate,
+			EmbedTags:     embedTags,
+			Normalize:     req.Normalize,
+			SampleRate:    req.SampleRate,
+			Channels:      req.Channels,
+			FormatID:      req.FormatID,
+			Cookies:       req.Cookies,
+			Priority:      c.Priority,
+			WithSubtitles: req.WithSubtitles,
+			// Every child continues the submission's trace
+			TraceContext: shared.InjectTraceContext(r.Context()),
+		}
+		if err := mq.Publish(r.Context(), msg); err != nil {
+			shared.WithJob(logger, c.ID).Error("Failed to publish playlist child job to queue", "error", err)
+			failedNow := time.Now()
+			c.Status = shared.JobStatusFailed
+			c.Error = fmt.Sprintf("Failed to queue job: %v", err)
+			c.CompletedAt = &failedNow
+			if db.UpdateJob(r.Context(), c) == nil {
+				recordJobEvent(r.Context(), c, c.Error)
+			}
+			continue
+		}
+		shared.JobsCreatedTotal.Inc()
+		trackActiveJob(r, c.ID)
+		queued++
+	}
+	jl.Info("Playlist job created", "url", req.URL, "children", len(children), "queued", queued)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"job_id":    parentID,
+		"status":    string(parent.Status),
+		"child_ids": parent.ChildIDs,
+		"message":   fmt.Sprintf("Playlist with %d entries queued. Check status at /status/%s", len(children), parentID),
+	})
+}
+
+// playlistChild summarizes a child job in the playlist status view
+type playlistChild struct {
+	JobID            string               `json:"job_id"`
+	Status           shared.JobStatus     `json:"status"`
+	Title            string               `json:"title,omitempty"`
+	Progress         int                  `json:"progress"`
+	DownloadEndpoint string               `json:"download_endpoint,omitempty"`
+	Error            string               `json:"error,omitempty"`
+	FailureReason    shared.FailureReason `json:"failure_reason,omitempty"`
+}
+
+// refreshPlaylist recomputes a playlist job's status and progress from its
+// children, stores the parent if they changed, and returns the child summaries
+func refreshPlaylist(ctx context.Context, parent *shared.Job) []playlistChild {
+	summaries := make([]playlistChild, 0, len(parent.ChildIDs))
+	counts := map[shared.JobStatus]int{}
+	progress := 0
+	for _, id := range parent.ChildIDs {
+		child, err := db.GetJob(ctx, id)
+		if err != nil || child.Status == shared.JobStatusDeleted {
+			// A child that vanished (e.g. deleted by an admin) counts as failed
+			counts[shared.JobStatusFailed]++
+			progress += 100
+			summaries = append(summaries, playlistChild{JobID: id, Status: shared.JobStatusFailed, Progress: 100, Error: "job not found"})
+			continue
+		}
+		s := playlistChild{JobID: child.ID, Status: child.Status, Progress: child.Progress, Error: child.Error,
+			FailureReason: child.FailureReason}
+		if child.Metadata != nil {
+			s.Title = child.Metadata.Title
+		}
+		if child.Status == shared.JobStatusCompleted {
+			s.DownloadEndpoint = downloadURL(child.ID)
+		}
+		if child.Status.IsTerminal() {
+			s.Progress = 100
+		}
+		counts[child.Status]++
+		progress += s.Progress
+		summaries = append(summaries, s)
+	}
+
+	status := aggregatePlaylistStatus(counts, len(parent.ChildIDs))
+	progress /= len(parent.ChildIDs)
+	if status != parent.Status || progress != parent.Progress {
+		statusChanged := status != parent.Status
+		parent.Status = status
+		parent.Progress = progress
+		now := time.Now()
+		if status != shared.JobStatusPending && parent.StartedAt == nil {
+			parent.StartedAt = &now
+		}
+		if status.IsTerminal() && parent.CompletedAt == nil {
+			parent.CompletedAt = &now
+		}
+		if err := db.UpdateJob(ctx, parent); err != nil {
+			shared.WithJob(logger, parent.ID).Warn("Failed to store playlist status", "error", err)
+		} else if statusChanged {
+			recordJobEvent(ctx, parent, "derived from the status of its entries")
+		}
+	}
+	return summaries
+}
+
+// aggregatePlaylistStatus derives a playlist's status from its children's:
+// pending until any child starts, processing until all are finished, then
+// completed, failed, cancelled, or partial when only some completed
+func aggregatePlaylistStatus(counts map[shared.JobStatus]int, total int) shared.JobStatus {
+	finished := counts[shared.JobStatusCompleted] + counts[shared.JobStatusFailed] + counts[shared.JobStatusCancelled]
+	switch {
+	case counts[shared.JobStatusPending] == total:
+		return shared.JobStatusPending
+	case finished < total:
+		return shared.JobStatusProcessing
+	case counts[shared.JobStatusCompleted] == total:
+		return shared.JobStatusCompleted
+	case counts[shared.JobStatusCancelled] == total:
+		return shared.JobStatusCancelled
+	case counts[shared.JobStatusCompleted] > 0:
+		return shared.JobStatusPartial
+	default:
+		return shared.JobStatusFailed
+	}
+}
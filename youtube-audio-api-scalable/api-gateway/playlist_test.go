@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+// stubYtDlp creates a yt-dlp that prints output and saves its arguments, one
+// per line, next to itself in <path>.args
+func stubYtDlp(t *testing.T, output string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "yt-dlp")
+	script := "#!/bin/sh\nprintf '%s\\n' \"$@\" > \"$0.args\"\ncat <<'JSON'\n" + output + "\nJSON\n"
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// fakePlaylist is yt-dlp --flat-playlist output: two videos, one given only
+// by ID, and an entry on a host that isn't allowed
+const fakePlaylist = `{"id":"dQw4w9WgXcQ","url":"https://www.youtube.com/watch?v=dQw4w9WgXcQ","title":"First"}
+{"id":"9bZkp7q19f0","title":"Second"}
+{"id":"x","url":"https://evil.example/watch?v=x","title":"Elsewhere"}`
+
+func TestExtractPlaylistQueuesChildren(t *testing.T) {
+	ytDlp := stubYtDlp(t, fakePlaylist)
+	t.Setenv("YTDLP_PATH", ytDlp)
+	setupGateway(t)
+	ctx := context.Background()
+
+	rec := serve(handleExtract, http.MethodPost, "/extract", `{"url":"https://www.youtube.com/playlist?list=PLtest"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var resp struct {
+		JobID    string   `json:"job_id"`
+		ChildIDs []string `json:"child_ids"`
+	}
+	decodeBody(t, rec, &resp)
+	if len(resp.ChildIDs) != 2 {
+		t.Fatalf("got %d children, want 2 (the disallowed host skipped)", len(resp.ChildIDs))
+	}
+	args, _ := os.ReadFile(ytDlp + ".args")
+	if !strings.Contains(string(args), "--flat-playlist") {
+		t.Errorf("yt-dlp was run with %q", args)
+	}
+
+	parent, err := db.GetJob(ctx, resp.JobID)
+	if err != nil || !parent.IsPlaylist() {
+		t.Fatalf("parent job %+v, %v", parent, err)
+	}
+	wantURLs := []string{"https://www.youtube.com/watch?v=dQw4w9WgXcQ", shared.WatchURL("9bZkp7q19f0")}
+	for i, id := range resp.ChildIDs {
+		child, err := db.GetJob(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if child.ParentID != resp.JobID || child.OriginalURL != wantURLs[i] {
+			t.Errorf("child %d has parent %q and URL %q", i, child.ParentID, child.OriginalURL)
+		}
+	}
+	if depth, _ := mq.Depth(ctx); depth != 2 {
+		t.Errorf("queue depth %d, want both children queued", depth)
+	}
+}
+
+func TestExtractPlaylistWithoutEntries(t *testing.T) {
+	t.Setenv("YTDLP_PATH", stubYtDlp(t, ""))
+	setupGateway(t)
+
+	rec := serve(handleExtract, http.MethodPost, "/extract", `{"url":"https://www.youtube.com/playlist?list=PLempty"}`)
+	if rec.Code != http.StatusUnprocessableEntity || errorCode(t, rec) != shared.ErrCodeUnprocessable {
+		t.Errorf("status %d: %s", rec.Code, rec.Body)
+	}
+	if depth, _ := mq.Depth(context.Background()); depth != 0 {
+		t.Errorf("queue depth %d, want nothing queued", depth)
+	}
+}
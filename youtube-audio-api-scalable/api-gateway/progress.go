@@ -0,0 +1,107 @@
+// api-gateway/progress.go
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+// handleAdminProgressStream: GET /admin/jobs/{job_id}/progress/stream pushes
+// the job's ffmpeg status lines as Server-Sent Events while it converts, for
+// debugging slow conversions. The stream ends with an "end" event once the
+// job is terminal, or a "timeout" one after cfg.SSEMaxDuration.
+func handleAdminProgressStream(w http.ResponseWriter, r *http.Request) {
+	// Auth handled by middleware
+	jobID := filepath.Base(strings.TrimSuffix(r.URL.Path, "/progress/stream"))
+	if _, err := db.GetJob(r.Context(), jobID); err != nil {
+		writeStoreError(w, err, http.StatusNotFound, shared.ErrCodeNotFound, "Job not found")
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		shared.WriteError(w, http.StatusInternalServerError, shared.ErrCodeInternal, "Streaming not supported")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ctx, cancel := context.WithCancel(r.Context())
+	if cfg.SSEMaxDuration > 0 {
+		ctx, cancel = context.WithTimeout(r.Context(), cfg.SSEMaxDuration)
+	}
+	defer cancel()
+	keepalive := time.NewTicker(sseKeepaliveInterval)
+	defer keepalive.Stop()
+
+	// Subscribe before watching so no line published in between is missed
+	lines := progressFeed.Subscribe(ctx, jobID)
+	updates := watchJob(ctx, jobID)
+	writeLine := func(line shared.ProgressLine) {
+		b, _ := json.Marshal(line)
+		fmt.Fprintf(w, "event: progress\ndata: %s\n\n", b)
+	}
+	var status shared.JobStatus
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				lines = nil // ctx is done; the watch ends too
+				continue
+			}
+			writeLine(line)
+		case job, ok := <-updates:
+			if !ok {
+				// Send the last lines, published just before the job finished
+				for drained := false; !drained; {
+					select {
+					case line, ok := <-lines:
+						if ok {
+							writeLine(line)
+						} else {
+							drained = true
+						}
+					default:
+						drained = true
+					}
+				}
+				writeProgressStreamEnd(w, r, ctx, jobID, status)
+				flusher.Flush()
+				return
+			}
+			status = job.Status
+			continue // Nothing written
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+		}
+		flusher.Flush()
+	}
+}
+
+// writeProgressStreamEnd sends the event closing a progress stream: "end"
+// once the job is terminal, "timeout" once the stream ran for too long
+func writeProgressStreamEnd(w http.ResponseWriter, r *http.Request, ctx context.Context, jobID string, status shared.JobStatus) {
+	switch {
+	case r.Context().Err() != nil:
+		// The client is gone
+	case ctx.Err() == context.DeadlineExceeded:
+		b, _ := json.Marshal(map[string]any{
+			"job_id":  jobID,
+			"message": "Stream closed after its maximum duration; reconnect to keep following the job",
+		})
+		fmt.Fprintf(w, "event: timeout\ndata: %s\n\n", b)
+	default:
+		b, _ := json.Marshal(map[string]any{"job_id": jobID, "status": status})
+		fmt.Fprintf(w, "event: end\ndata: %s\n\n", b)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+func TestAdminProgressStreamRelaysLinesUntilDone(t *testing.T) {
+	setupGateway(t)
+	defer func(interval time.Duration) { sseKeepaliveInterval = interval }(sseKeepaliveInterval)
+	sseKeepaliveInterval = 20 * time.Millisecond
+	seedJob(t, &shared.Job{ID: "job-1", Status: shared.JobStatusProcessing})
+	srv := httptest.NewServer(http.HandlerFunc(handleAdminProgressStream))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/admin/jobs/job-1/progress/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	body := bufio.NewReader(resp.Body)
+	// The first keepalive means the handler has subscribed
+	if ev, ok := readSSE(t, body); !ok || ev.Comment != "keepalive" {
+		t.Fatalf("first event %+v, want a keepalive", ev)
+	}
+
+	published := []shared.ProgressLine{
+		{Line: "size=     256kB time=00:00:10.00 bitrate= 209.7kbits/s speed=20x", Position: 10, Percent: 16},
+		{Line: "size=    1024kB time=00:00:45.50 bitrate= 184.3kbits/s speed=22x", Position: 45.5, Percent: 75},
+		{Line: "size=    1536kB time=00:01:00.00 bitrate= 125.8kbits/s speed=22x", Position: 60, Percent: 100},
+	}
+	for _, line := range published {
+		if err := progressFeed.Publish(context.Background(), "job-1", line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var streamed []shared.ProgressLine
+	for len(streamed) < len(published) {
+		ev, ok := readSSE(t, body)
+		if !ok {
+			t.Fatalf("stream closed after %d lines", len(streamed))
+		}
+		if ev.Event != "progress" {
+			continue
+		}
+		var line shared.ProgressLine
+		if err := json.Unmarshal([]byte(ev.Data), &line); err != nil {
+			t.Fatalf("bad event data %q: %v", ev.Data, err)
+		}
+		streamed = append(streamed, line)
+	}
+	if !slices.Equal(streamed, published) {
+		t.Errorf("streamed %+v, want %+v", streamed, published)
+	}
+
+	setJobStatus(t, "job-1", shared.JobStatusCompleted)
+	var last sseEvent
+	for {
+		ev, ok := readSSE(t, body)
+		if !ok {
+			break // Closed by the server once the job finished
+		}
+		if ev.Event != "" {
+			last = ev
+		}
+	}
+	var end struct {
+		JobID  string           `json:"job_id"`
+		Status shared.JobStatus `json:"status"`
+	}
+	if last.Event != "end" || json.Unmarshal([]byte(last.Data), &end) != nil || end.Status != shared.JobStatusCompleted {
+		t.Errorf("last event %+v, want end with status completed", last)
+	}
+}
+
+func TestAdminProgressStreamUnknownJob(t *testing.T) {
+	setupGateway(t)
+	rec := serve(handleAdminProgressStream, http.MethodGet, "/admin/jobs/missing/progress/stream", "")
+	if rec.Code != http.StatusNotFound || errorCode(t, rec) != shared.ErrCodeNotFound {
+		t.Errorf("status = %d, body %s; want 404", rec.Code, rec.Body)
+	}
+}
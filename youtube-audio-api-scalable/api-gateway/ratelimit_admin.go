@@ -0,0 +1,57 @@
+// api-gateway/ratelimit_admin.go
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+// handleAdminRateLimit: GET /admin/ratelimit/{ip} reports the client's request
+// counts and remaining quota in every bucket; DELETE resets them, e.g. to
+// lift a 429 while troubleshooting
+func handleAdminRateLimit(w http.ResponseWriter, r *http.Request) {
+	// Auth handled by middleware
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	ip := strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/ratelimit/"), "/")
+	if ip == "" || strings.Contains(ip, "/") {
+		shared.WriteError(w, http.StatusNotFound, shared.ErrCodeNotFound, "Not found")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		usage, err := rl.Usage(r.Context(), ip)
+		if err != nil {
+			logger.Error("Failed to read rate limit state", "ip", ip, "error", err)
+			shared.WriteError(w, http.StatusInternalServerError, shared.ErrCodeInternal, "Failed to read rate limit state")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"ip":          ip,
+			"strategy":    cfg.RateLimitStrategy,
+			"allowlisted": rl.Allowlisted(ip),
+			"buckets":     usage,
+		})
+	case http.MethodDelete:
+		if err := rl.Reset(r.Context(), ip); err != nil {
+			logger.Error("Failed to reset rate limit state", "ip", ip, "error", err)
+			shared.WriteError(w, http.StatusInternalServerError, shared.ErrCodeInternal, "Failed to reset rate limit state")
+			return
+		}
+		logger.Info("Rate limit state reset by admin", "ip", ip)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"ip":      ip,
+			"message": "Rate limit counters reset.",
+		})
+	default:
+		shared.WriteError(w, http.StatusMethodNotAllowed, shared.ErrCodeMethodNotAllowed, "Invalid request method")
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+// rateLimitUsage fetches GET /admin/ratelimit/{ip} and returns ip's extract bucket
+func rateLimitUsage(t *testing.T, ip string) shared.RateLimitUsage {
+	t.Helper()
+	rec := serve(handleAdminRateLimit, http.MethodGet, "/admin/ratelimit/"+ip, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var resp struct {
+		IP      string                  `json:"ip"`
+		Buckets []shared.RateLimitUsage `json:"buckets"`
+	}
+	decodeBody(t, rec, &resp)
+	for _, b := range resp.Buckets {
+		if b.Bucket == shared.RateLimitBucketExtract && resp.IP == ip {
+			return b
+		}
+	}
+	t.Fatalf("no extract bucket for %s in %+v", ip, resp)
+	return shared.RateLimitUsage{}
+}
+
+func TestAdminRateLimitInspectAndReset(t *testing.T) {
+	setupGateway(t)
+	cfg.RateLimitExtractRPM = 5
+	for range 3 {
+		rl.Allow(shared.RateLimitBucketExtract, "203.0.113.7")
+	}
+
+	if u := rateLimitUsage(t, "203.0.113.7"); u.Count != 3 || u.Remaining != 2 || u.Limit != 5 {
+		t.Errorf("before reset: %+v, want 3 used of 5", u)
+	}
+	rec := serve(handleAdminRateLimit, http.MethodDelete, "/admin/ratelimit/203.0.113.7", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("reset: status %d: %s", rec.Code, rec.Body)
+	}
+	if u := rateLimitUsage(t, "203.0.113.7"); u.Count != 0 || u.Remaining != 5 {
+		t.Errorf("after reset: %+v, want the full quota", u)
+	}
+}
+
+func TestAdminRateLimitRejectsBadRequests(t *testing.T) {
+	setupGateway(t)
+	for _, tt := range []struct {
+		method, target string
+		want           int
+	}{
+		{http.MethodGet, "/admin/ratelimit/", http.StatusNotFound},
+		{http.MethodGet, "/admin/ratelimit/203.0.113.7/extra", http.StatusNotFound},
+		{http.MethodPost, "/admin/ratelimit/203.0.113.7", http.StatusMethodNotAllowed},
+	} {
+		if rec := serve(handleAdminRateLimit, tt.method, tt.target, ""); rec.Code != tt.want {
+			t.Errorf("%s %s: status %d, want %d", tt.method, tt.target, rec.Code, tt.want)
+		}
+	}
+}
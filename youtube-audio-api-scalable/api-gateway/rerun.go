@@ -0,0 +1,131 @@
+// api-gateway/rerun.go
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+// rerunRequest is the optional body of a rerun. Cookies aren't kept once a
+// job is queued, so a job that needed them has to be sent them again.
+type rerunRequest struct {
+	Cookies string `json:"cookies,omitempty"`
+}
+
+// handleRerun: POST /jobs/{job_id}/rerun queues a finished job again with the
+// options it was submitted with, e.g. after a transient failure
+func handleRerun(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w, r)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/jobs/"), "/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] != "rerun" {
+		shared.WriteError(w, http.StatusNotFound, shared.ErrCodeNotFound, "Not found")
+		return
+	}
+	if r.Method != http.MethodPost {
+		shared.WriteError(w, http.StatusMethodNotAllowed, shared.ErrCodeMethodNotAllowed, "Invalid request method")
+		return
+	}
+	var req rerunRequest
+	if r.ContentLength != 0 && !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.Cookies != "" {
+		if _, err := shared.DecodeCookies(req.Cookies); err != nil {
+			writeValidationErrors(w, []shared.FieldError{{Field: "cookies", Message: err.Error()}})
+			return
+		}
+	}
+	jobID := parts[0]
+	jl := shared.WithJob(logger, jobID)
+
+	job, err := db.GetJob(r.Context(), jobID)
+	if err != nil {
+		writeStoreError(w, err, http.StatusNotFound, shared.ErrCodeNotFound, "Job not found")
+		return
+	}
+	if job.IsPlaylist() {
+		shared.WriteError(w, http.StatusBadRequest, shared.ErrCodeInvalidRequest, "Playlist jobs can't be rerun; rerun their child jobs instead")
+		return
+	}
+	if !job.Status.IsTerminal() || job.Status == shared.JobStatusDeleted {
+		shared.WriteError(w, http.StatusConflict, shared.ErrCodeConflict, fmt.Sprintf("Job cannot be rerun while %s", job.Status))
+		return
+	}
+	if !allowQueueDepth(w, r, 1) || !allowActiveJobs(w, r, 1) {
+		return
+	}
+
+	msg := shared.JobMessageFor(job)
+	msg.Cookies = req.Cookies
+	// A dead-lettered copy of the job is dropped, since it is retried now
+	entry, _ := mq.RemoveDeadLetter(r.Context(), jobID)
+	previous := job.Status
+	if previous == shared.JobStatusCompleted {
+		deleteJobFiles(r.Context(), job) // The rerun writes a fresh file
+	}
+	resetJob(job)
+	if err := db.UpdateJob(r.Context(), job); err != nil {
+		jl.Error("Failed to reset job for rerun", "error", err)
+		if entry != nil {
+			mq.DeadLetter(r.Context(), entry.Message, entry.Reason) // Put it back so it isn't lost
+		}
+		writeStoreError(w, err, http.StatusInternalServerError, shared.ErrCodeInternal, "Failed to rerun job")
+		return
+	}
+	recordJobEvent(r.Context(), job, fmt.Sprintf("rerun by client after %s", previous))
+
+	msg.TraceContext = shared.InjectTraceContext(r.Context())
+	if err := mq.Publish(r.Context(), msg); err != nil {
+		jl.Error("Failed to publish rerun job to queue", "error", err)
+		failedNow := time.Now()
+		job.Status = shared.JobStatusFailed
+		job.Error = fmt.Sprintf("Failed to queue job: %v", err)
+		job.CompletedAt = &failedNow
+		if db.UpdateJob(r.Context(), job) == nil {
+			recordJobEvent(r.Context(), job, job.Error)
+		}
+		writeStoreError(w, err, http.StatusInternalServerError, shared.ErrCodeInternal, "Failed to queue job")
+		return
+	}
+	trackActiveJob(r, jobID)
+	jl.Info("Job rerun", "previous_status", previous)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// resetJob returns a finished job to pending, dropping the results and
+// failure details of its last run but keeping its submitted options
+func resetJob(job *shared.Job) {
+	job.Status = shared.JobStatusPending
+	job.Error = ""
+	job.FailureReason = ""
+	job.Metadata = nil
+	job.Progress = 0
+	job.Attempts = 0
+	job.StartedAt = nil
+	job.CompletedAt = nil
+	job.CancelRequestedAt = nil
+	job.ExpiresAt = nil
+	job.DownloadEndpoint = ""
+	job.FileSize = 0
+	job.Extractor = ""
+	job.OutputDuration = 0
+	job.StorageKey = ""
+	job.FilePath = ""
+	job.ThumbnailEndpoint = ""
+	job.ThumbnailFile = ""
+	job.Artifacts = nil
+	job.CallbackStatus = 0
+	job.CallbackError = ""
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+func TestRerunFailedJob(t *testing.T) {
+	setupGateway(t)
+	ctx := context.Background()
+	finished := time.Now().Add(-time.Minute)
+	seedJob(t, &shared.Job{ID: "failed", OriginalURL: "https://youtu.be/dQw4w9WgXcQ", Status: shared.JobStatusFailed,
+		Format: "opus", Bitrate: "96k", OutputExt: "opus", ClipStart: 10, ClipEnd: 20, FormatID: "251",
+		Error: "yt-dlp failed: HTTP Error 503", FailureReason: shared.FailureExtractFailed, Attempts: 3,
+		Progress: 40, CompletedAt: &finished, Metadata: &shared.Metadata{Title: "stale"}})
+	msg := shared.JobMessage{JobID: "failed", OriginalURL: "https://youtu.be/dQw4w9WgXcQ", Cookies: "cookie-jar"}
+	if err := mq.DeadLetter(ctx, msg, "yt-dlp failed"); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serve(handleRerun, http.MethodPost, "/jobs/failed/rerun", "")
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	job, err := db.GetJob(ctx, "failed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != shared.JobStatusPending || job.Error != "" || job.FailureReason != "" || job.Attempts != 0 ||
+		job.Progress != 0 || job.CompletedAt != nil || job.Metadata != nil {
+		t.Errorf("job not reset: %+v", job)
+	}
+	if job.Format != "opus" || job.Bitrate != "96k" || job.ClipStart != 10 || job.ClipEnd != 20 || job.FormatID != "251" {
+		t.Errorf("job lost its options: %+v", job)
+	}
+
+	queued, err := mq.Consume(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case m := <-queued:
+		if m.JobID != "failed" || m.Format != "opus" || m.ClipEnd != 20 || m.FormatID != "251" || m.Cookies != "" {
+			t.Errorf("queued %+v", m)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the rerun was not queued")
+	}
+	if entries, _ := mq.DeadLetters(ctx); len(entries) != 0 {
+		t.Errorf("dead-letter queue still holds %+v", entries)
+	}
+}
+
+func TestRerunCompletedJobDropsItsFile(t *testing.T) {
+	setupGateway(t)
+	job := seedJob(t, &shared.Job{ID: "done", Status: shared.JobStatusCompleted, OutputExt: "mp3"})
+	writeOutput(t, job, "old audio")
+	path := filepath.Join(cfg.OutputDir, "done.mp3")
+	if _, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if rec := serve(handleRerun, http.MethodPost, "/jobs/done/rerun", ""); rec.Code != http.StatusAccepted {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("the previous output is still at %s", path)
+	}
+}
+
+func TestRerunRejectsUnfinishedJobs(t *testing.T) {
+	setupGateway(t)
+	seedJob(t, &shared.Job{ID: "processing", Status: shared.JobStatusProcessing})
+	seedJob(t, &shared.Job{ID: "pending"})
+	seedJob(t, &shared.Job{ID: "deleted", Status: shared.JobStatusDeleted})
+
+	for _, id := range []string{"processing", "pending", "deleted"} {
+		rec := serve(handleRerun, http.MethodPost, "/jobs/"+id+"/rerun", "")
+		if rec.Code != http.StatusConflict || errorCode(t, rec) != shared.ErrCodeConflict {
+			t.Errorf("%s: status %d: %s", id, rec.Code, rec.Body)
+		}
+	}
+	if job, _ := db.GetJob(context.Background(), "processing"); job.Status != shared.JobStatusProcessing {
+		t.Errorf("rejected rerun changed the job to %s", job.Status)
+	}
+	if depth, _ := mq.Depth(context.Background()); depth != 0 {
+		t.Errorf("queue depth %d after rejected reruns", depth)
+	}
+
+	tests := map[string]struct {
+		method string
+		target string
+		want   int
+	}{
+		"unknown job":  {http.MethodPost, "/jobs/missing/rerun", http.StatusNotFound},
+		"wrong method": {http.MethodGet, "/jobs/processing/rerun", http.StatusMethodNotAllowed},
+		"bad path":     {http.MethodPost, "/jobs/processing/retry", http.StatusNotFound},
+	}
+	for name, tt := range tests {
+		if rec := serve(handleRerun, tt.method, tt.target, ""); rec.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", name, rec.Code, tt.want)
+		}
+	}
+}
+
+func TestRerunTakesCookiesAgain(t *testing.T) {
+	setupGateway(t)
+	ctx := context.Background()
+	seedJob(t, &shared.Job{ID: "failed", OriginalURL: "https://youtu.be/dQw4w9WgXcQ", Status: shared.JobStatusFailed})
+	cookies := base64.StdEncoding.EncodeToString([]byte("# Netscape HTTP Cookie File\n"))
+
+	rec := serve(handleRerun, http.MethodPost, "/jobs/failed/rerun", "{\"cookies\":\"not base64!\"}")
+	if rec.Code != http.StatusUnprocessableEntity || errorCode(t, rec) != shared.ErrCodeValidationFailed {
+		t.Fatalf("invalid cookies: status %d: %s", rec.Code, rec.Body)
+	}
+	if depth, _ := mq.Depth(ctx); depth != 0 {
+		t.Fatalf("queue depth %d after a rejected rerun", depth)
+	}
+
+	rec = serve(handleRerun, http.MethodPost, "/jobs/failed/rerun", `{"cookies":"`+cookies+`"}`)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	queued, err := mq.Consume(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case m := <-queued:
+		if m.Cookies != cookies {
+			t.Errorf("queued cookies %q, want the ones sent with the rerun", m.Cookies)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the rerun was not queued")
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+// runMainInSubprocess runs main in a copy of the test binary, re-entering
+// test, with env added, and returns its output. main exits the process, so it
+// can't run in this one. It fails the test if main keeps running.
+func runMainInSubprocess(t *testing.T, test string, env ...string) ([]byte, error) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^"+test+"$")
+	cmd.Env = append(os.Environ(), "RUN_GATEWAY_MAIN=1", "OUTPUT_DIR="+t.TempDir(), "API_GATEWAY_PORT=0")
+	cmd.Env = append(cmd.Env, env...)
+	done := make(chan struct{})
+	var out []byte
+	var err error
+	go func() {
+		out, err = cmd.CombinedOutput()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(30 * time.Second):
+		cmd.Process.Kill()
+		t.Fatal("the gateway kept running")
+	}
+	return out, err
+}
+
+func TestStartupFailsWithUnreachableRedis(t *testing.T) {
+	if os.Getenv("RUN_GATEWAY_MAIN") == "1" {
+		main()
+		return
+	}
+	out, err := runMainInSubprocess(t, "TestStartupFailsWithUnreachableRedis", "REDIS_ADDR=127.0.0.1:1")
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.Success() {
+		t.Fatalf("gateway exited with %v, want a failure:\n%s", err, out)
+	}
+	if !strings.Contains(string(out), "127.0.0.1:1") {
+		t.Errorf("the failure doesn't name the Redis address:\n%s", out)
+	}
+}
+
+func TestStartupFailsWithMalformedCIDR(t *testing.T) {
+	if os.Getenv("RUN_GATEWAY_MAIN") == "1" {
+		main()
+		return
+	}
+	for _, env := range []string{"RATE_LIMIT_ALLOWLIST", "TRUSTED_PROXIES"} {
+		out, err := runMainInSubprocess(t, "TestStartupFailsWithMalformedCIDR", "REDIS_ADDR=", env+"=10.0.0.0/8,10.0.0.0/33")
+		if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.Success() {
+			t.Fatalf("%s: gateway exited with %v, want a failure:\n%s", env, err, out)
+		}
+		if !strings.Contains(string(out), "Invalid "+env) {
+			t.Errorf("the failure doesn't name %s:\n%s", env, out)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	redis "github.com/redis/go-redis/v9"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+// downRedisDB returns a Redis-backed job store whose server has gone away,
+// so every call fails with a connection error
+func downRedisDB(t *testing.T) shared.DatabaseClient {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+	mr.Close()
+	return shared.NewRedisDB(client, 0, 0)
+}
+
+// redisJobDB returns a job store backed by miniredis, which keeps jobs as
+// JSON the way production does
+func redisJobDB(t *testing.T) shared.DatabaseClient {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return shared.NewRedisDB(client, 0, 0)
+}
+
+func TestDownloadS3JobStoredInRedis(t *testing.T) {
+	setupGateway(t)
+	db = redisJobDB(t)
+	objects := &signingStorage{}
+	store = objects
+	cfg.StorageBackend = shared.StorageBackendS3
+	// As the worker stores a completed S3 job, which has no local copy
+	seedJob(t, &shared.Job{
+		ID: "s3job", Status: shared.JobStatusCompleted, OutputExt: "mp3", StorageKey: "s3job.mp3",
+		Artifacts: []shared.Artifact{{Type: shared.ArtifactAudio, Key: "s3job.mp3", ContentType: "audio/mpeg"}},
+	})
+	job, err := db.GetJob(context.Background(), "s3job")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serve(handleDownload, http.MethodGet, "/download/s3job", "")
+	if rec.Code != http.StatusFound {
+		t.Fatalf("status = %d, want 302: %s", rec.Code, rec.Body)
+	}
+	if loc := rec.Header().Get("Location"); !strings.HasPrefix(loc, "https://objects.example/s3job.mp3?") {
+		t.Errorf("Location = %q", loc)
+	}
+	if !outputAvailable(job) {
+		t.Error("outputAvailable = false for a stored S3 job")
+	}
+
+	if rec := serve(handleAdminDeleteJob, http.MethodDelete, "/admin/delete/s3job", ""); rec.Code != http.StatusOK {
+		t.Fatalf("delete: status %d: %s", rec.Code, rec.Body)
+	}
+	if !slices.Contains(objects.deleted, "s3job.mp3") {
+		t.Errorf("deleted objects = %v, want s3job.mp3", objects.deleted)
+	}
+}
+
+func TestStorageOutageReturns503(t *testing.T) {
+	setupGateway(t)
+	db = downRedisDB(t)
+
+	for _, tc := range []struct {
+		name    string
+		handler http.HandlerFunc
+		method  string
+		target  string
+		body    string
+	}{
+		{"status", handleStatus, http.MethodGet, "/status/job-1", ""},
+		{"extract", handleExtract, http.MethodPost, "/extract", `{"url":"https://www.youtube.com/watch?v=dQw4w9WgXcQ"}`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := serve(tc.handler, tc.method, tc.target, tc.body)
+			if rec.Code != http.StatusServiceUnavailable {
+				t.Fatalf("status %d, want 503: %s", rec.Code, rec.Body)
+			}
+			if code := errorCode(t, rec); code != shared.ErrCodeStorageUnavailable {
+				t.Errorf("error code %q, want %q", code, shared.ErrCodeStorageUnavailable)
+			}
+			if rec.Header().Get("Retry-After") == "" {
+				t.Error("no Retry-After header")
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+// recordSpans installs a tracer provider that keeps finished spans in memory
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+	return recorder
+}
+
+func TestExtractPropagatesTraceToWorker(t *testing.T) {
+	setupGateway(t)
+	recorder := recordSpans(t)
+
+	rec := serve(handleExtract, http.MethodPost, "/extract", `{"url":"https://youtu.be/dQw4w9WgXcQ"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	ended := recorder.Ended()
+	if len(ended) != 1 || ended[0].Name() != "extract" {
+		t.Fatalf("recorded %d spans, want the extract span", len(ended))
+	}
+
+	messages, err := mq.Consume(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := <-messages
+	// The worker starts its span from this context
+	_, workerSpan := shared.Tracer().Start(shared.ExtractTraceContext(msg.TraceContext), "process_job")
+	workerSpan.End()
+	worker := recorder.Ended()[1]
+	if worker.Parent().SpanID() != ended[0].SpanContext().SpanID() || worker.SpanContext().TraceID() != ended[0].SpanContext().TraceID() {
+		t.Errorf("worker span has parent %s, want the extract span %s", worker.Parent().SpanID(), ended[0].SpanContext().SpanID())
+	}
+}
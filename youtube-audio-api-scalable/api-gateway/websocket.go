@@ -0,0 +1,106 @@
+// api-gateway/websocket.go
+package main
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"youtube-audio-api-scalable/shared"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// wsWriteWait bounds each write to a WebSocket client
+	wsWriteWait = 10 * time.Second
+	// wsPongWait is how long a client may stay silent before it is dropped;
+	// pings go out every wsPingPeriod so a live client always answers in time
+	wsPongWait   = 60 * time.Second
+	wsPingPeriod = wsPongWait * 9 / 10
+	// wsMaxMessageSize caps what a client may send; the endpoint only pushes
+	wsMaxMessageSize = 512
+)
+
+// wsUpgrader applies the same origin allowlist as CORS, since browsers send
+// no preflight for WebSocket handshakes
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+	CheckOrigin: func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		return origin == "" || originAllowed("*") || originAllowed(origin)
+	},
+}
+
+// handleStatusWebSocket: Pushes the job as a JSON text frame on each status or
+// progress change, then closes the connection once the job finishes
+func handleStatusWebSocket(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		shared.WriteError(w, http.StatusMethodNotAllowed, shared.ErrCodeMethodNotAllowed, "Invalid request method")
+		return
+	}
+	jobID := filepath.Base(r.URL.Path) // Extract job ID from /ws/status/{job_id}
+	if _, err := db.GetJob(r.Context(), jobID); err != nil {
+		writeStoreError(w, err, http.StatusNotFound, shared.ErrCodeNotFound, "Job not found")
+		return
+	}
+
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return // Upgrade already replied with an error status
+	}
+	defer conn.Close()
+	jl := shared.WithJob(logger, jobID)
+
+	// The request context doesn't notice a hijacked client going away, so the
+	// read loop cancels the watch instead
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go readWebSocket(conn, cancel)
+
+	ping := time.NewTicker(wsPingPeriod)
+	defer ping.Stop()
+	updates := watchJob(ctx, jobID)
+	for {
+		select {
+		case job, ok := <-updates:
+			if !ok {
+				if ctx.Err() != nil {
+					return // Client gone or gateway shutting down
+				}
+				msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "job finished")
+				conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(wsWriteWait))
+				return
+			}
+			setDownloadEndpoint(job)
+			conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := conn.WriteJSON(job); err != nil {
+				jl.Debug("WebSocket write failed", "error", err)
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+				jl.Debug("WebSocket ping failed", "error", err)
+				return
+			}
+		}
+	}
+}
+
+// readWebSocket discards client messages, answering control frames, and calls
+// done once the client disconnects or stops answering pings
+func readWebSocket(conn *websocket.Conn, done context.CancelFunc) {
+	defer done()
+	conn.SetReadLimit(wsMaxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"youtube-audio-api-scalable/shared"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestStatusWebSocketFollowsTransitions(t *testing.T) {
+	setupGateway(t)
+	seedJob(t, &shared.Job{ID: "job-1"})
+	srv := httptest.NewServer(http.HandlerFunc(handleStatusWebSocket))
+	defer srv.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws/status/job-1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	next := map[shared.JobStatus]shared.JobStatus{
+		shared.JobStatusPending:    shared.JobStatusProcessing,
+		shared.JobStatusProcessing: shared.JobStatusCompleted,
+	}
+	var seen []shared.JobStatus
+	for {
+		var job shared.Job
+		if err := conn.ReadJSON(&job); err != nil {
+			var closeErr *websocket.CloseError
+			if !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseNormalClosure {
+				t.Fatalf("read failed: %v", err)
+			}
+			break // Closed by the server once the job finished
+		}
+		if len(seen) > 0 && seen[len(seen)-1] == job.Status {
+			continue // Progress update
+		}
+		seen = append(seen, job.Status)
+		if status, ok := next[job.Status]; ok {
+			setJobStatus(t, "job-1", status)
+		}
+	}
+	want := []shared.JobStatus{shared.JobStatusPending, shared.JobStatusProcessing, shared.JobStatusCompleted}
+	if !slices.Equal(seen, want) {
+		t.Errorf("pushed statuses %v, want %v", seen, want)
+	}
+}
+
+func TestStatusWebSocketRejectsBadRequests(t *testing.T) {
+	setupGateway(t)
+	seedJob(t, &shared.Job{ID: "job-1"})
+	cfg.AllowedOrigins = []string{"https://app.example.com"}
+	srv := httptest.NewServer(http.HandlerFunc(handleStatusWebSocket))
+	defer srv.Close()
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws/status/"
+
+	tests := []struct {
+		name   string
+		job    string
+		origin string
+		want   int
+	}{
+		{"unknown job", "missing", "", http.StatusNotFound},
+		{"disallowed origin", "job-1", "https://evil.example.com", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		header := http.Header{}
+		if tt.origin != "" {
+			header.Set("Origin", tt.origin)
+		}
+		conn, resp, err := websocket.DefaultDialer.Dial(wsURL+tt.job, header)
+		if err == nil {
+			conn.Close()
+			t.Errorf("%s: handshake succeeded", tt.name)
+			continue
+		}
+		if resp == nil || resp.StatusCode != tt.want {
+			t.Errorf("%s: handshake response %v, want status %d", tt.name, resp, tt.want)
+		}
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL+"job-1", http.Header{"Origin": {"https://app.example.com"}})
+	if err != nil {
+		t.Fatalf("allowed origin: %v", err)
+	}
+	conn.Close()
+}
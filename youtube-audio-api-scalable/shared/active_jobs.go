@@ -0,0 +1,108 @@
+// shared/active_jobs.go
+package shared
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	redis "github.com/redis/go-redis/v9"
+)
+
+// activeJobsKeyTTL expires an IP's set once it has submitted nothing for this
+// long, so IPs that never check their count again don't linger
+const activeJobsKeyTTL = 24 * time.Hour
+
+// ActiveJobTracker remembers the jobs each client IP submitted, so the gateway
+// can cap how many of them are pending or processing at once. Nothing reports
+// finished jobs: Count looks each job up and drops those that are terminal or
+// gone, wherever they were finished.
+type ActiveJobTracker interface {
+	Add(ctx context.Context, ip, jobID string) error
+	// Count returns how many of ip's jobs db still has pending or processing
+	Count(ctx context.Context, db DatabaseClient, ip string) (int, error)
+}
+
+// NewActiveJobTracker returns a Redis-backed tracker when client is set, in-memory otherwise
+func NewActiveJobTracker(client *redis.Client) ActiveJobTracker {
+	if client != nil {
+		return &RedisActiveJobTracker{client: client}
+	}
+	return &InMemoryActiveJobTracker{jobs: make(map[string]map[string]struct{})}
+}
+
+// jobActive reports whether jobID still counts against its client's limit
+func jobActive(ctx context.Context, db DatabaseClient, jobID string) bool {
+	job, err := db.GetJob(ctx, jobID)
+	return err == nil && !job.Status.IsTerminal()
+}
+
+// RedisActiveJobTracker keeps each IP's job IDs in the set activejobs:<ip>
+type RedisActiveJobTracker struct {
+	client *redis.Client
+}
+
+func (t *RedisActiveJobTracker) key(ip string) string { return fmt.Sprintf("activejobs:%s", ip) }
+
+func (t *RedisActiveJobTracker) Add(ctx context.Context, ip, jobID string) error {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	pipe := t.client.TxPipeline()
+	pipe.SAdd(ctx, t.key(ip), jobID)
+	pipe.Expire(ctx, t.key(ip), activeJobsKeyTTL)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (t *RedisActiveJobTracker) Count(ctx context.Context, db DatabaseClient, ip string) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	ids, err := t.client.SMembers(ctx, t.key(ip)).Result()
+	if err != nil {
+		return 0, err
+	}
+	var done []any
+	for _, id := range ids {
+		if !jobActive(ctx, db, id) {
+			done = append(done, id)
+		}
+	}
+	if len(done) > 0 {
+		if err := t.client.SRem(ctx, t.key(ip), done...).Err(); err != nil {
+			return 0, err
+		}
+	}
+	return len(ids) - len(done), nil
+}
+
+// InMemoryActiveJobTracker is the single-process tracker used without Redis
+type InMemoryActiveJobTracker struct {
+	mu   sync.Mutex
+	jobs map[string]map[string]struct{} // IP => job IDs
+}
+
+func (t *InMemoryActiveJobTracker) Add(ctx context.Context, ip, jobID string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.jobs[ip] == nil {
+		t.jobs[ip] = make(map[string]struct{})
+	}
+	t.jobs[ip][jobID] = struct{}{}
+	return nil
+}
+
+func (t *InMemoryActiveJobTracker) Count(ctx context.Context, db DatabaseClient, ip string) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for id := range t.jobs[ip] {
+		if !jobActive(ctx, db, id) {
+			delete(t.jobs[ip], id)
+		}
+	}
+	n := len(t.jobs[ip])
+	if n == 0 {
+		delete(t.jobs, ip)
+	}
+	return n, nil
+}
@@ -0,0 +1,236 @@
+// shared/apikey.go
+package shared
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	redis "github.com/redis/go-redis/v9"
+)
+
+// APIKeyHeader is the request header clients send their API key in
+const APIKeyHeader = "X-API-Key"
+
+// APIKey describes an issued key. Only the SHA-256 hash of the key is stored.
+type APIKey struct {
+	ID         string    `json:"id"`
+	Owner      string    `json:"owner"`
+	DailyQuota int       `json:"daily_quota"` // 0 means unlimited
+	CreatedAt  time.Time `json:"created_at"`
+	Hash       string    `json:"-"`
+}
+
+// APIKeyStore manages API keys and their daily usage
+type APIKeyStore interface {
+	// Create issues a new key and returns its plaintext value, which is not stored
+	Create(owner string, dailyQuota int) (string, *APIKey, error)
+	// Lookup returns the key matching a plaintext value
+	Lookup(plaintext string) (*APIKey, error)
+	Revoke(id string) error
+	// IncrementUsage counts one request against today's quota and returns today's total
+	IncrementUsage(key *APIKey) (int, error)
+}
+
+// NewAPIKeyStore returns a Redis-backed store when client is set, in-memory otherwise
+func NewAPIKeyStore(client *redis.Client) APIKeyStore {
+	if client != nil {
+		return NewRedisAPIKeyStore(client)
+	}
+	return NewInMemoryAPIKeyStore()
+}
+
+// HashAPIKey returns the stored form of a plaintext key
+func HashAPIKey(plaintext string) string {
+	sum := sha256.Sum256([]byte(plaintext))
+	return hex.EncodeToString(sum[:])
+}
+
+// generateAPIKey returns a new random plaintext key
+func generateAPIKey() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "yt_" + hex.EncodeToString(b), nil
+}
+
+func newAPIKey(owner string, dailyQuota int) (string, *APIKey, error) {
+	plaintext, err := generateAPIKey()
+	if err != nil {
+		return "", nil, err
+	}
+	return plaintext, &APIKey{
+		ID:         uuid.New().String(),
+		Owner:      owner,
+		DailyQuota: dailyQuota,
+		CreatedAt:  time.Now(),
+		Hash:       HashAPIKey(plaintext),
+	}, nil
+}
+
+// usageDay is the UTC day usage counters are bucketed by
+func usageDay(t time.Time) string {
+	return t.UTC().Format("20060102")
+}
+
+// InMemoryAPIKeyStore implements APIKeyStore in process memory
+type InMemoryAPIKeyStore struct {
+	mu     sync.Mutex
+	byHash map[string]*APIKey
+	byID   map[string]*APIKey
+	usage  map[string]apiKeyUsage // key: API key ID
+}
+
+type apiKeyUsage struct {
+	day   string
+	count int
+}
+
+func NewInMemoryAPIKeyStore() *InMemoryAPIKeyStore {
+	return &InMemoryAPIKeyStore{
+		byHash: map[string]*APIKey{},
+		byID:   map[string]*APIKey{},
+		usage:  map[string]apiKeyUsage{},
+	}
+}
+
+func (s *InMemoryAPIKeyStore) Create(owner string, dailyQuota int) (string, *APIKey, error) {
+	plaintext, key, err := newAPIKey(owner, dailyQuota)
+	if err != nil {
+		return "", nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.byHash[key.Hash] = key
+	s.byID[key.ID] = key
+	copied := *key
+	return plaintext, &copied, nil
+}
+
+func (s *InMemoryAPIKeyStore) Lookup(plaintext string) (*APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.byHash[HashAPIKey(plaintext)]
+	if !ok {
+		return nil, fmt.Errorf("unknown API key")
+	}
+	copied := *key
+	return &copied, nil
+}
+
+func (s *InMemoryAPIKeyStore) Revoke(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.byID[id]
+	if !ok {
+		return fmt.Errorf("API key %s not found", id)
+	}
+	delete(s.byID, id)
+	delete(s.byHash, key.Hash)
+	delete(s.usage, id)
+	return nil
+}
+
+func (s *InMemoryAPIKeyStore) IncrementUsage(key *APIKey) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	day := usageDay(time.Now())
+	u := s.usage[key.ID]
+	if u.day != day {
+		u = apiKeyUsage{day: day}
+	}
+	u.count++
+	s.usage[key.ID] = u
+	return u.count, nil
+}
+
+// RedisAPIKeyStore implements APIKeyStore in Redis
+// Keys: apikey:<hash> => JSON(APIKey), apikey_id:<id> => hash,
+// apikey_usage:<id>:<day> => request count (expires after two days)
+type RedisAPIKeyStore struct {
+	client *redis.Client
+}
+
+func NewRedisAPIKeyStore(client *redis.Client) *RedisAPIKeyStore {
+	return &RedisAPIKeyStore{client: client}
+}
+
+func (s *RedisAPIKeyStore) Create(owner string, dailyQuota int) (string, *APIKey, error) {
+	plaintext, key, err := newAPIKey(owner, dailyQuota)
+	if err != nil {
+		return "", nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	b, err := json.Marshal(key)
+	if err != nil {
+		return "", nil, err
+	}
+	pipe := s.client.TxPipeline()
+	pipe.Set(ctx, "apikey:"+key.Hash, b, 0)
+	pipe.Set(ctx, "apikey_id:"+key.ID, key.Hash, 0)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return "", nil, err
+	}
+	return plaintext, key, nil
+}
+
+func (s *RedisAPIKeyStore) Lookup(plaintext string) (*APIKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	hash := HashAPIKey(plaintext)
+	val, err := s.client.Get(ctx, "apikey:"+hash).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, fmt.Errorf("unknown API key")
+		}
+		return nil, err
+	}
+	var key APIKey
+	if err := json.Unmarshal(val, &key); err != nil {
+		return nil, fmt.Errorf("failed to decode API key: %w", err)
+	}
+	if key.ID == "" {
+		return nil, fmt.Errorf("stored API key has no ID")
+	}
+	key.Hash = hash
+	return &key, nil
+}
+
+func (s *RedisAPIKeyStore) Revoke(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	hash, err := s.client.Get(ctx, "apikey_id:"+id).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return fmt.Errorf("API key %s not found", id)
+		}
+		return err
+	}
+	pipe := s.client.TxPipeline()
+	pipe.Del(ctx, "apikey:"+hash)
+	pipe.Del(ctx, "apikey_id:"+id)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (s *RedisAPIKeyStore) IncrementUsage(key *APIKey) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	counter := fmt.Sprintf("apikey_usage:%s:%s", key.ID, usageDay(time.Now()))
+	n, err := s.client.Incr(ctx, counter).Result()
+	if err != nil {
+		return 0, err
+	}
+	if n == 1 {
+		_ = s.client.Expire(ctx, counter, 48*time.Hour).Err()
+	}
+	return int(n), nil
+}
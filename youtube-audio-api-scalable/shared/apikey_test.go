@@ -0,0 +1,37 @@
+package shared
+
+import "testing"
+
+func TestAPIKeyStores(t *testing.T) {
+	client, _ := newTestRedis(t)
+	stores := map[string]APIKeyStore{
+		"memory": NewInMemoryAPIKeyStore(),
+		"redis":  NewRedisAPIKeyStore(client),
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			plaintext, created, err := store.Create("alice", 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			key, err := store.Lookup(plaintext)
+			if err != nil || key.ID != created.ID || key.Owner != "alice" {
+				t.Fatalf("Lookup = %+v, %v; want the created key", key, err)
+			}
+			if _, err := store.Lookup("yt_not-a-key"); err == nil {
+				t.Error("Lookup accepted an unknown key")
+			}
+			for want := 1; want <= 3; want++ {
+				if used, err := store.IncrementUsage(key); err != nil || used != want {
+					t.Fatalf("IncrementUsage = %d, %v; want %d", used, err, want)
+				}
+			}
+			if err := store.Revoke(key.ID); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := store.Lookup(plaintext); err == nil {
+				t.Error("Lookup accepted a revoked key")
+			}
+		})
+	}
+}
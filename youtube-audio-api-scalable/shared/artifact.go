@@ -0,0 +1,96 @@
+// shared/artifact.go
+package shared
+
+import (
+	"mime"
+	"path/filepath"
+)
+
+// ArtifactType names one kind of file a job produces
+type ArtifactType string
+
+const (
+	ArtifactAudio     ArtifactType = "audio"     // The converted audio; every completed job has one
+	ArtifactThumbnail ArtifactType = "thumbnail" // The video's thumbnail, when it could be saved
+	ArtifactSubtitles ArtifactType = "subtitles" // WebVTT captions, for jobs requested with them
+)
+
+// Artifact is one file a completed job produced
+type Artifact struct {
+	Type ArtifactType `json:"type"`
+	// Key is the file's name in OutputDir and its key in Storage
+	Key         string `json:"key"`
+	Size        int64  `json:"size,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Language    string `json:"language,omitempty"` // Subtitles only, e.g. en or en-orig
+	// DownloadEndpoint is set by the gateway when it returns the job, since
+	// download links may be signed and expire
+	DownloadEndpoint string `json:"download_endpoint,omitempty"`
+}
+
+// ArtifactContentType guesses the MIME type of a file from its name
+func ArtifactContentType(key string) string {
+	if ct := mime.TypeByExtension(filepath.Ext(key)); ct != "" {
+		return ct
+	}
+	return "application/octet-stream"
+}
+
+// ArtifactList returns the files job produced. Jobs completed before
+// artifacts were recorded get them rebuilt from their output file and thumbnail.
+func (j *Job) ArtifactList() []Artifact {
+	if len(j.Artifacts) > 0 || j.Status != JobStatusCompleted {
+		return j.Artifacts
+	}
+	af := FormatForExt(j.OutputExt)
+	key := j.StorageKey
+	if key == "" {
+		key = OutputFileName(j.ID, af.Ext, j.ClipStart, j.ClipEnd)
+	}
+	artifacts := []Artifact{{Type: ArtifactAudio, Key: key, Size: j.FileSize, ContentType: af.ContentType}}
+	if j.ThumbnailFile != "" {
+		artifacts = append(artifacts, Artifact{
+			Type:        ArtifactThumbnail,
+			Key:         j.ThumbnailFile,
+			ContentType: ArtifactContentType(j.ThumbnailFile),
+		})
+	}
+	return artifacts
+}
+
+// ArtifactKeys returns the storage keys of every file job produced, without
+// duplicates. StorageKey and ThumbnailFile are included even when the job
+// didn't complete, as a failed run may have stored them.
+func (j *Job) ArtifactKeys() []string {
+	seen := map[string]bool{}
+	var keys []string
+	add := func(key string) {
+		if key != "" && !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	for _, a := range j.ArtifactList() {
+		add(a.Key)
+	}
+	add(j.StorageKey)
+	add(j.ThumbnailFile)
+	return keys
+}
+
+// Artifact returns the file of type t that job produced, if any
+func (j *Job) Artifact(t ArtifactType) (Artifact, bool) {
+	for _, a := range j.ArtifactList() {
+		if a.Type == t {
+			return a, true
+		}
+	}
+	return Artifact{}, false
+}
+
+// AudioKey returns the storage key of job's converted audio, or "" before it
+// completes. Use it rather than StorageKey, which JSON-backed stores drop.
+func (j *Job) AudioKey() string {
+	a, _ := j.Artifact(ArtifactAudio)
+	return a.Key
+}
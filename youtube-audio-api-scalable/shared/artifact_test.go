@@ -0,0 +1,65 @@
+package shared
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestArtifactList(t *testing.T) {
+	// Completed before artifacts were recorded: rebuilt from the old fields
+	legacy := &Job{ID: "old", Status: JobStatusCompleted, OutputExt: "mp3", FileSize: 42, ThumbnailFile: "old_thumb.jpg"}
+	got := legacy.ArtifactList()
+	want := []Artifact{
+		{Type: ArtifactAudio, Key: "old.mp3", Size: 42, ContentType: "audio/mpeg"},
+		{Type: ArtifactThumbnail, Key: "old_thumb.jpg", ContentType: "image/jpeg"},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("legacy artifacts = %+v, want %+v", got, want)
+	}
+	if a, ok := legacy.Artifact(ArtifactThumbnail); !ok || a.Key != "old_thumb.jpg" {
+		t.Errorf("legacy thumbnail = %+v, %v", a, ok)
+	}
+	if _, ok := legacy.Artifact(ArtifactSubtitles); ok {
+		t.Error("legacy job has subtitles")
+	}
+
+	// Recorded artifacts are returned as they are
+	recorded := &Job{ID: "new", Status: JobStatusCompleted, StorageKey: "new.opus", Artifacts: []Artifact{
+		{Type: ArtifactAudio, Key: "new.opus"},
+		{Type: ArtifactSubtitles, Key: "new.en.vtt", Language: "en"},
+	}}
+	if got := recorded.ArtifactList(); len(got) != 2 || got[1].Language != "en" {
+		t.Errorf("recorded artifacts = %+v", got)
+	}
+	// StorageKey duplicates the audio artifact's key
+	if keys := recorded.ArtifactKeys(); !slices.Equal(keys, []string{"new.opus", "new.en.vtt"}) {
+		t.Errorf("ArtifactKeys = %v", keys)
+	}
+
+	// A failed run lists no artifacts but its stored files are still cleaned up
+	failed := &Job{ID: "bad", Status: JobStatusFailed, StorageKey: "bad.mp3", ThumbnailFile: "bad_thumb.jpg"}
+	if got := failed.ArtifactList(); len(got) != 0 {
+		t.Errorf("failed job artifacts = %+v", got)
+	}
+	if keys := failed.ArtifactKeys(); !slices.Equal(keys, []string{"bad.mp3", "bad_thumb.jpg"}) {
+		t.Errorf("failed job ArtifactKeys = %v", keys)
+	}
+}
+
+func TestAudioKey(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		job  *Job
+		want string
+	}{
+		{"recorded artifact", &Job{ID: "a", Status: JobStatusCompleted, Artifacts: []Artifact{
+			{Type: ArtifactThumbnail, Key: "a_thumb.jpg"}, {Type: ArtifactAudio, Key: "a_clip_10-20.opus"},
+		}}, "a_clip_10-20.opus"},
+		{"legacy completed job", &Job{ID: "b", Status: JobStatusCompleted, OutputExt: "m4a"}, "b.m4a"},
+		{"pending job", &Job{ID: "c", Status: JobStatusPending, StorageKey: "c.mp3"}, ""},
+	} {
+		if got := tc.job.AudioKey(); got != tc.want {
+			t.Errorf("%s: AudioKey() = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
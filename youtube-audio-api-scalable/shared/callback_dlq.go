@@ -0,0 +1,147 @@
+// shared/callback_dlq.go
+package shared
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	redis "github.com/redis/go-redis/v9"
+)
+
+// CallbackDLQKey is the Redis list holding undelivered callbacks, newest first
+const CallbackDLQKey = "callbacks:dlq"
+
+// DefaultCallbackDLQMaxLength bounds how many undelivered callbacks are kept
+const DefaultCallbackDLQMaxLength = 1000
+
+// UndeliveredCallback is a job notification whose callback URL still failed
+// after every retry. Payload is the body that was sent, so a redelivery
+// reports the job as it was when it finished.
+type UndeliveredCallback struct {
+	JobID       string          `json:"job_id"`
+	CallbackURL string          `json:"callback_url"`
+	Payload     json.RawMessage `json:"payload"`
+	LastStatus  int             `json:"last_status,omitempty"` // HTTP status of the last attempt; 0 when there was no response
+	Error       string          `json:"error"`
+	Attempts    int             `json:"attempts"`
+	FailedAt    time.Time       `json:"failed_at"`
+}
+
+// CallbackDLQ parks undelivered callbacks until an admin redelivers them
+type CallbackDLQ interface {
+	Add(ctx context.Context, cb UndeliveredCallback) error
+	// List returns the undelivered callbacks, newest first
+	List(ctx context.Context) ([]UndeliveredCallback, error)
+	// Remove takes the newest entry for jobID out of the queue
+	Remove(ctx context.Context, jobID string) (*UndeliveredCallback, error)
+}
+
+// NewCallbackDLQ returns a Redis-backed queue when client is set, in-memory otherwise
+func NewCallbackDLQ(client *redis.Client) CallbackDLQ {
+	if client != nil {
+		return &RedisCallbackDLQ{client: client}
+	}
+	return &InMemoryCallbackDLQ{}
+}
+
+// RedisCallbackDLQ keeps the entries as JSON in the list CallbackDLQKey
+type RedisCallbackDLQ struct {
+	client *redis.Client
+}
+
+func (q *RedisCallbackDLQ) Add(ctx context.Context, cb UndeliveredCallback) error {
+	b, err := json.Marshal(cb)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	pipe := q.client.TxPipeline()
+	pipe.LPush(ctx, CallbackDLQKey, b)
+	pipe.LTrim(ctx, CallbackDLQKey, 0, DefaultCallbackDLQMaxLength-1)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (q *RedisCallbackDLQ) List(ctx context.Context) ([]UndeliveredCallback, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	raws, err := q.client.LRange(ctx, CallbackDLQKey, 0, -1).Result()
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	out := make([]UndeliveredCallback, 0, len(raws))
+	for _, raw := range raws {
+		var cb UndeliveredCallback
+		if json.Unmarshal([]byte(raw), &cb) == nil {
+			out = append(out, cb)
+		}
+	}
+	return out, nil
+}
+
+func (q *RedisCallbackDLQ) Remove(ctx context.Context, jobID string) (*UndeliveredCallback, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	raws, err := q.client.LRange(ctx, CallbackDLQKey, 0, -1).Result()
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	for _, raw := range raws {
+		var cb UndeliveredCallback
+		if json.Unmarshal([]byte(raw), &cb) != nil || cb.JobID != jobID {
+			continue
+		}
+		n, err := q.client.LRem(ctx, CallbackDLQKey, 1, raw).Result()
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			continue // Removed concurrently, e.g. by another redelivery
+		}
+		return &cb, nil
+	}
+	return nil, fmt.Errorf("job %s has no undelivered callback", jobID)
+}
+
+// InMemoryCallbackDLQ keeps the entries in process memory
+type InMemoryCallbackDLQ struct {
+	mu      sync.Mutex
+	entries []UndeliveredCallback // Oldest first, bounded to DefaultCallbackDLQMaxLength
+}
+
+func (q *InMemoryCallbackDLQ) Add(ctx context.Context, cb UndeliveredCallback) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.entries) >= DefaultCallbackDLQMaxLength {
+		q.entries = q.entries[1:]
+	}
+	q.entries = append(q.entries, cb)
+	return nil
+}
+
+func (q *InMemoryCallbackDLQ) List(ctx context.Context) ([]UndeliveredCallback, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	out := make([]UndeliveredCallback, 0, len(q.entries))
+	for i := len(q.entries) - 1; i >= 0; i-- {
+		out = append(out, q.entries[i])
+	}
+	return out, nil
+}
+
+func (q *InMemoryCallbackDLQ) Remove(ctx context.Context, jobID string) (*UndeliveredCallback, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i := len(q.entries) - 1; i >= 0; i-- {
+		if q.entries[i].JobID == jobID {
+			cb := q.entries[i]
+			q.entries = append(q.entries[:i], q.entries[i+1:]...)
+			return &cb, nil
+		}
+	}
+	return nil, fmt.Errorf("job %s has no undelivered callback", jobID)
+}
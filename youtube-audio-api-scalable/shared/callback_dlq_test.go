@@ -0,0 +1,41 @@
+package shared
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCallbackDLQ(t *testing.T) {
+	client, _ := newTestRedis(t)
+	for name, q := range map[string]CallbackDLQ{
+		"memory": NewCallbackDLQ(nil),
+		"redis":  NewCallbackDLQ(client),
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			for _, cb := range []UndeliveredCallback{
+				{JobID: "job-1", CallbackURL: "https://example.com/a", Payload: []byte(`{"id":"job-1"}`), LastStatus: 500, Attempts: 4},
+				{JobID: "job-2", CallbackURL: "https://example.com/b", Payload: []byte(`{"id":"job-2"}`), Attempts: 4},
+			} {
+				if err := q.Add(ctx, cb); err != nil {
+					t.Fatal(err)
+				}
+			}
+			entries, err := q.List(ctx)
+			if err != nil || len(entries) != 2 || entries[0].JobID != "job-2" || entries[1].JobID != "job-1" {
+				t.Fatalf("List = %+v, %v; want job-2 then job-1", entries, err)
+			}
+
+			cb, err := q.Remove(ctx, "job-1")
+			if err != nil || cb.CallbackURL != "https://example.com/a" || string(cb.Payload) != `{"id":"job-1"}` || cb.LastStatus != 500 {
+				t.Fatalf("Remove = %+v, %v", cb, err)
+			}
+			if _, err := q.Remove(ctx, "job-1"); err == nil {
+				t.Error("removed job-1 twice")
+			}
+			if entries, _ := q.List(ctx); len(entries) != 1 || entries[0].JobID != "job-2" {
+				t.Errorf("List after Remove = %+v", entries)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+// shared/clip.go
+package shared
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseClipTime parses a clip boundary given as seconds ("90", "90.5") or as
+// "MM:SS" / "HH:MM:SS" (seconds may have a fractional part)
+func ParseClipTime(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, fmt.Errorf("empty time")
+	}
+	parts := strings.Split(s, ":")
+	if len(parts) > 3 {
+		return 0, fmt.Errorf("invalid time %q: use seconds or HH:MM:SS", s)
+	}
+	total := 0.0
+	for i, p := range parts {
+		last := i == len(parts)-1
+		var v float64
+		var err error
+		if last {
+			v, err = strconv.ParseFloat(p, 64)
+		} else {
+			var n int
+			n, err = strconv.Atoi(p)
+			v = float64(n)
+		}
+		if err != nil || v < 0 {
+			return 0, fmt.Errorf("invalid time %q: use seconds or HH:MM:SS", s)
+		}
+		// Minutes and seconds below an hour/minute field must be under 60
+		if i > 0 && v >= 60 {
+			return 0, fmt.Errorf("invalid time %q: minutes and seconds must be below 60", s)
+		}
+		total = total*60 + v
+	}
+	return total, nil
+}
+
+// ValidateClipRange parses optional start and end times. An empty start means
+// the beginning and an empty end means the end of the video (returned as 0).
+func ValidateClipRange(startTime, endTime string) (float64, float64, error) {
+	var start, end float64
+	var err error
+	if strings.TrimSpace(startTime) != "" {
+		if start, err = ParseClipTime(startTime); err != nil {
+			return 0, 0, fmt.Errorf("start_time: %v", err)
+		}
+	}
+	if strings.TrimSpace(endTime) != "" {
+		if end, err = ParseClipTime(endTime); err != nil {
+			return 0, 0, fmt.Errorf("end_time: %v", err)
+		}
+		if end <= start {
+			return 0, 0, fmt.Errorf("end_time must be after start_time")
+		}
+	}
+	return start, end, nil
+}
+
+// CheckClipWithinDuration verifies a clip range against the video's duration.
+// A zero duration (unknown) is not checked.
+func CheckClipWithinDuration(start, end, duration float64) error {
+	if duration <= 0 {
+		return nil
+	}
+	if start >= duration {
+		return fmt.Errorf("clip start %s is beyond the video duration %s", formatSeconds(start), formatSeconds(duration))
+	}
+	if end > duration {
+		return fmt.Errorf("clip end %s is beyond the video duration %s", formatSeconds(end), formatSeconds(duration))
+	}
+	return nil
+}
+
+// ClipSuffix names a clip range for use in file names, e.g. "30-90" or
+// "30-end"; it is empty when the range covers the whole video
+func ClipSuffix(start, end float64) string {
+	if start <= 0 && end <= 0 {
+		return ""
+	}
+	if end <= 0 {
+		return formatSeconds(start) + "-end"
+	}
+	return formatSeconds(start) + "-" + formatSeconds(end)
+}
+
+// OutputFileName is the name of a job's converted file in Config.OutputDir. Clips
+// carry their range so they can't be mistaken for full conversions.
+func OutputFileName(jobID, ext string, clipStart, clipEnd float64) string {
+	if suffix := ClipSuffix(clipStart, clipEnd); suffix != "" {
+		return fmt.Sprintf("%s_clip_%s.%s", jobID, suffix, ext)
+	}
+	return jobID + "." + ext
+}
+
+func formatSeconds(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
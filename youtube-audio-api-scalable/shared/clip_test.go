@@ -0,0 +1,63 @@
+package shared
+
+import "testing"
+
+func TestValidateClipRange(t *testing.T) {
+	tests := []struct {
+		start, end         string
+		wantStart, wantEnd float64
+		wantErr            bool
+	}{
+		{"", "", 0, 0, false},
+		{"30", "", 30, 0, false},
+		{"1:30", "2:00", 90, 120, false},
+		{"0:00:10.5", "00:01:00", 10.5, 60, false},
+		{"90", "30", 0, 0, true},    // Inverted
+		{"30", "30", 0, 0, true},    // Empty
+		{"1:75", "", 0, 0, true},    // Seconds out of range
+		{"-5", "", 0, 0, true},      // Negative
+		{"", "abc", 0, 0, true},     // Not a time
+		{"1:2:3:4", "", 0, 0, true}, // Too many fields
+	}
+	for _, tt := range tests {
+		start, end, err := ValidateClipRange(tt.start, tt.end)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ValidateClipRange(%q, %q) error = %v, wantErr %v", tt.start, tt.end, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && (start != tt.wantStart || end != tt.wantEnd) {
+			t.Errorf("ValidateClipRange(%q, %q) = %v, %v; want %v, %v", tt.start, tt.end, start, end, tt.wantStart, tt.wantEnd)
+		}
+	}
+}
+
+func TestCheckClipWithinDuration(t *testing.T) {
+	tests := []struct {
+		start, end, duration float64
+		wantErr              bool
+	}{
+		{30, 90, 120, false},
+		{30, 120, 120, false},
+		{30, 0, 120, false},  // To the end
+		{30, 150, 120, true}, // End beyond the video
+		{130, 0, 120, true},  // Start beyond the video
+		{130, 200, 0, false}, // Unknown duration isn't checked
+	}
+	for _, tt := range tests {
+		if err := CheckClipWithinDuration(tt.start, tt.end, tt.duration); (err != nil) != tt.wantErr {
+			t.Errorf("CheckClipWithinDuration(%v, %v, %v) = %v, wantErr %v", tt.start, tt.end, tt.duration, err, tt.wantErr)
+		}
+	}
+}
+
+func TestOutputFileName(t *testing.T) {
+	if got := OutputFileName("job-1", "mp3", 0, 0); got != "job-1.mp3" {
+		t.Errorf("full conversion named %q", got)
+	}
+	if got := OutputFileName("job-1", "mp3", 30, 90.5); got != "job-1_clip_30-90.5.mp3" {
+		t.Errorf("clip named %q", got)
+	}
+	if got := OutputFileName("job-1", "mp3", 30, 0); got != "job-1_clip_30-end.mp3" {
+		t.Errorf("open-ended clip named %q", got)
+	}
+}
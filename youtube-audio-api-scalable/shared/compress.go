@@ -0,0 +1,192 @@
+// shared/compress.go
+package shared
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// CompressionMinSize is the smallest JSON response CompressionMiddleware
+// compresses; below it the encoding overhead isn't worth it
+const CompressionMinSize = 1024
+
+// CompressionMiddleware gzips (or deflates) JSON responses of at least
+// CompressionMinSize bytes for clients that accept it. Everything else,
+// including audio downloads and event streams, passes through untouched.
+func CompressionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding}
+		defer cw.Close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// negotiateEncoding picks gzip or deflate from an Accept-Encoding header,
+// preferring gzip, or returns "" if neither is acceptable
+func negotiateEncoding(header string) string {
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		accepted[name] = q > 0
+	}
+	for _, enc := range []string{"gzip", "deflate"} {
+		if ok, listed := accepted[enc]; ok || (!listed && accepted["*"]) {
+			return enc
+		}
+	}
+	return ""
+}
+
+// compressWriter holds back the start of a JSON response until it knows
+// whether the body reaches CompressionMinSize, then either compresses the
+// rest or writes it through. Non-JSON responses are never buffered.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+
+	status    int
+	buffering bool // Set while a JSON body is still below the threshold
+	decided   bool // Set once passthrough or compression has been chosen
+	buf       bytes.Buffer
+	zw        io.WriteCloser // Non-nil when compressing
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.status == 0 {
+		cw.status = status
+	}
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	if !cw.decided {
+		if !cw.buffering && !cw.compressible() {
+			if err := cw.passthrough(); err != nil {
+				return 0, err
+			}
+		} else {
+			cw.buffering = true
+			cw.buf.Write(p)
+			if cw.buf.Len() >= CompressionMinSize {
+				if err := cw.startCompression(); err != nil {
+					return 0, err
+				}
+			}
+			return len(p), nil
+		}
+	}
+	if cw.zw != nil {
+		return cw.zw.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// compressible reports whether the response so far is a JSON body that may
+// be compressed
+func (cw *compressWriter) compressible() bool {
+	h := cw.Header()
+	if h.Get("Content-Encoding") != "" || h.Get("Content-Range") != "" {
+		return false
+	}
+	if cw.status < http.StatusOK || cw.status == http.StatusNoContent || cw.status == http.StatusNotModified {
+		return false
+	}
+	mediaType, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	if mediaType != "application/json" {
+		return false
+	}
+	h.Add("Vary", "Accept-Encoding")
+	return true
+}
+
+// passthrough sends the headers and anything buffered without compression
+func (cw *compressWriter) passthrough() error {
+	cw.decided = true
+	cw.ResponseWriter.WriteHeader(cw.status)
+	if cw.buf.Len() == 0 {
+		return nil
+	}
+	_, err := cw.ResponseWriter.Write(cw.buf.Bytes())
+	cw.buf.Reset()
+	return err
+}
+
+func (cw *compressWriter) startCompression() error {
+	cw.decided = true
+	h := cw.Header()
+	h.Set("Content-Encoding", cw.encoding)
+	h.Del("Content-Length")
+	cw.ResponseWriter.WriteHeader(cw.status)
+	if cw.encoding == "gzip" {
+		cw.zw = gzip.NewWriter(cw.ResponseWriter)
+	} else {
+		cw.zw, _ = flate.NewWriter(cw.ResponseWriter, flate.DefaultCompression)
+	}
+	_, err := cw.zw.Write(cw.buf.Bytes())
+	cw.buf.Reset()
+	return err
+}
+
+// Flush sends what has been written so far. A JSON body still below the
+// threshold is sent uncompressed.
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		if cw.status == 0 {
+			cw.status = http.StatusOK
+		}
+		cw.passthrough()
+	}
+	if f, ok := cw.zw.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack lets WebSocket upgrades reach the underlying connection
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(cw.ResponseWriter).Hijack()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// Close finishes the response: short bodies are written as they are and a
+// compressed stream is terminated
+func (cw *compressWriter) Close() error {
+	if !cw.decided {
+		if cw.status == 0 {
+			return nil // Nothing was written; net/http sends an empty 200
+		}
+		return cw.passthrough()
+	}
+	if cw.zw != nil {
+		return cw.zw.Close()
+	}
+	return nil
+}
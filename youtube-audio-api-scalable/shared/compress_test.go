@@ -0,0 +1,83 @@
+package shared
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// respond serves body with contentType through CompressionMiddleware for a
+// client sending acceptEncoding
+func respond(contentType, body, acceptEncoding string) *httptest.ResponseRecorder {
+	h := CompressionMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		// Written in pieces, as json.Encoder and io.Copy do
+		for len(body) > 0 {
+			n := min(len(body), 300)
+			io.WriteString(w, body[:n])
+			body = body[n:]
+		}
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if acceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestCompressionMiddleware(t *testing.T) {
+	large := `{"jobs":[` + strings.Repeat(`{"status":"completed"},`, 200) + `{}]}`
+	small := `{"status":"pending"}`
+	audio := strings.Repeat("ID3 audio bytes ", 200)
+
+	tests := []struct {
+		name           string
+		contentType    string
+		body           string
+		acceptEncoding string
+		wantEncoding   string
+	}{
+		{"large JSON", "application/json", large, "gzip, deflate", "gzip"},
+		{"large JSON, deflate only", "application/json; charset=utf-8", large, "deflate", "deflate"},
+		{"large JSON, gzip refused", "application/json", large, "gzip;q=0, deflate", "deflate"},
+		{"large JSON, no Accept-Encoding", "application/json", large, "", ""},
+		{"small JSON", "application/json", small, "gzip", ""},
+		{"audio", "audio/mpeg", audio, "gzip", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := respond(tt.contentType, tt.body, tt.acceptEncoding)
+			if got := rec.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Fatalf("Content-Encoding = %q, want %q", got, tt.wantEncoding)
+			}
+			var r io.Reader = rec.Body
+			switch tt.wantEncoding {
+			case "gzip":
+				zr, err := gzip.NewReader(rec.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				r = zr
+			case "deflate":
+				r = flate.NewReader(rec.Body)
+			}
+			if tt.wantEncoding != "" && rec.Body.Len() >= len(tt.body) {
+				t.Errorf("compressed body is %d bytes, uncompressed %d", rec.Body.Len(), len(tt.body))
+			}
+			got, err := io.ReadAll(r)
+			if err != nil || string(got) != tt.body {
+				t.Errorf("body mismatch (%d of %d bytes), %v", len(got), len(tt.body), err)
+			}
+			if strings.HasPrefix(tt.contentType, "application/json") && tt.acceptEncoding != "" &&
+				!strings.Contains(rec.Header().Get("Vary"), "Accept-Encoding") {
+				t.Errorf("Vary = %q", rec.Header().Get("Vary"))
+			}
+		})
+	}
+}
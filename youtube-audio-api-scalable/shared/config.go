@@ -4,8 +4,10 @@ package shared
 import (
 	"log"
 	"os"
+	"runtime"
 	"strconv"
     "strings"
+    "time"
 )
 
 const (
@@ -14,10 +16,40 @@ const (
 	DefaultMaxWorkers     = 3
 	DefaultAdminToken     = "super-secret-admin-token-change-me" // CHANGE THIS IN PRODUCTION
     DefaultAllowedOrigins = "*"
+    DefaultCORSMaxAge     = 10 * time.Minute
     DefaultAllowedVideoHosts = "youtube.com,youtu.be"
     DefaultRateLimitRPM   = 300
     DefaultMaxVideoDurationSeconds = 1200 // 20 minutes
     DefaultQueueName      = "jobs"
+    DefaultConsumerGroup  = "workers"
+    DefaultClaimMinIdle   = 5 * time.Minute
+    DefaultClaimInterval  = 30 * time.Second
+    DefaultWebhookTimeout = 10 * time.Second
+    DefaultWebhookMaxRetries = 3
+    DefaultWebhookRetryBackoff = time.Second
+    DefaultShutdownTimeout = 30 * time.Second
+    DefaultSignedURLTTL    = time.Hour
+    DefaultJobTTL          = 24 * time.Hour
+    DefaultCleanupInterval = 10 * time.Minute
+    DefaultInMemoryQueueSize = 100
+    DefaultAPIKeyDailyQuota  = 1000
+    DefaultMaxJobAttempts    = 3
+    DefaultMaxPlaylistItems  = 50
+    DefaultMaxBatchSize      = 50
+    DefaultIdempotencyTTL    = 24 * time.Hour
+    DefaultLoudnessTarget    = -16.0 // Integrated loudness in LUFS, as used by most podcast platforms
+    DefaultYtDlpTimeout      = 2 * time.Minute
+    DefaultFFmpegTimeout     = 30 * time.Minute
+    DefaultStaleProcessingTimeout = time.Hour
+    DefaultMetadataCacheTTL  = 10 * time.Minute
+    DefaultSSEMaxDuration    = 30 * time.Minute
+    DefaultOutputDir         = "./downloads"
+    DefaultMinFreeDiskBytes  = 256 << 20
+    DefaultFilenameTemplate  = "{title}"
+    DefaultYtDlpBreakerThreshold = 5
+    DefaultYtDlpBreakerWindow    = 5 * time.Minute
+    DefaultYtDlpBreakerCooldown  = time.Minute
+    DefaultRedisJobCompressMinSize = 4 << 10
 )
 
 // Config holds global configuration for the services
@@ -26,25 +58,155 @@ type Config struct {
 	WorkerPort     string
 	MaxWorkers     int
 	AdminToken     string
+	LogLevel       string // debug, info, warn or error
     // Redis (optional). If RedisAddr is empty, in-memory implementations are used.
     RedisAddr      string
     RedisPassword  string
     RedisDB        int
+    // Connection pool of each Redis client (0 keeps go-redis's defaults:
+    // 10 connections per CPU and no idle minimum)
+    RedisPoolSize     int
+    RedisMinIdleConns int
+    // Jobs stored in Redis are gzipped once their JSON reaches
+    // RedisJobCompressMinSize bytes, e.g. playlists (0 never compresses)
+    RedisJobCompressMinSize int
+    // Postgres (optional). When set, job data is stored there instead of Redis;
+    // the queue and rate limits still use Redis if RedisAddr is set.
+    PostgresDSN    string
     // Queue configuration
     QueueName      string
     QueueMaxLength int
+    ConsumerGroup  string // Redis Streams consumer group shared by all workers
+    // Submissions are refused with a 503 while more than MaxQueueDepth jobs
+    // are waiting, rather than queued behind hours of work (0 means no limit)
+    MaxQueueDepth  int
+    // Pending-message recovery: entries idle longer than ClaimMinIdle are
+    // reclaimed from crashed consumers every ClaimInterval. Live consumers
+    // refresh their own entries as often, so it must be the shorter one.
+    ClaimMinIdle  time.Duration
+    ClaimInterval time.Duration
     // CORS and URL validation
     AllowedOrigins     []string
     AllowedVideoHosts  []string
-    // Rate limiting (requests per minute per IP)
-    RateLimitRPM int
+    // CanonicalizeURLs reduces submitted YouTube URLs to their watch?v= form
+    // before they are fetched, dropping tracking and playlist parameters
+    CanonicalizeURLs bool
+    // How long browsers may cache a preflight response (Access-Control-Max-Age)
+    CORSMaxAge time.Duration
+    // Hosts, IPs or CIDRs that extracted stream URLs may point to even though
+    // they are not public (for testing against local servers)
+    StreamHostAllowlist []string
+    // Rate limiting (requests per minute per IP). RateLimitStrategy is "fixed"
+    // (per calendar minute) or "sliding" (over the last 60 seconds). Each
+    // endpoint group has its own bucket, defaulting to RateLimitRPM.
+    RateLimitRPM         int
+    RateLimitExtractRPM  int
+    RateLimitStatusRPM   int
+    RateLimitDownloadRPM int
+    RateLimitStrategy    string
+    // IPs or CIDRs (e.g. internal services, monitoring) that are never rate
+    // limited. They match the client IP the limiter sees, which comes from
+    // X-Forwarded-For only when the request arrives through TrustedProxies.
+    RateLimitAllowlist []string
+    // IPs or CIDRs of the reverse proxies in front of the gateway. Only
+    // requests from these may set the client IP via X-Forwarded-For or
+    // X-Real-IP; anyone else is identified by the connection's address.
+    TrustedProxies []string
     // Public base URL for API (used by worker for download link construction)
     PublicAPIBaseURL string
     // External binaries configuration
     YtDlpPath  string
     FFmpegPath string
+    // Extractor run once more when yt-dlp fails in a way a retry might fix,
+    // e.g. a patched yt-dlp fork taking the same arguments (empty disables)
+    FallbackExtractorPath string
+    // ffprobe checks converted files; without it only their size is checked
+    FFprobePath string
+    // Netscape-format cookies file passed to yt-dlp for videos that need a login
+    CookiesFilePath string
+    // Proxies for yt-dlp traffic (http, https or socks5 URLs); jobs rotate among them
+    YtDlpProxy []string
+    // Longest a single yt-dlp or ffmpeg run may take before it is killed (0 means no limit)
+    YtDlpTimeout  time.Duration
+    FFmpegTimeout time.Duration
+    // ffmpeg's -threads per conversion, by default half the CPUs so conversions
+    // don't starve the HTTP server (0 lets ffmpeg decide). FFmpegNice, when
+    // 1-19, runs ffmpeg under nice(1) at that niceness.
+    FFmpegThreads int
+    FFmpegNice    int
+    // Longest a whole job (extraction and conversion together) may take before
+    // it is stopped and failed (0 means no limit)
+    JobTotalTimeout time.Duration
+    // Jobs still processing StaleProcessingTimeout after they started, e.g.
+    // because their worker crashed, are re-queued when a worker starts (0 disables it)
+    StaleProcessingTimeout time.Duration
+    // Circuit breaker: after YtDlpBreakerThreshold consecutive yt-dlp failures
+    // within YtDlpBreakerWindow, jobs are held back for YtDlpBreakerCooldown
+    // before a single probe job tries again (0 threshold disables it)
+    YtDlpBreakerThreshold int
+    YtDlpBreakerWindow    time.Duration
+    YtDlpBreakerCooldown  time.Duration
+    // How long POST /metadata results are reused. Kept short because the
+    // stream URL in them expires.
+    MetadataCacheTTL time.Duration
+    // Longest a /status/{id}/stream connection stays open; the client is then
+    // sent a final timeout event and may reconnect (0 means no limit)
+    SSEMaxDuration time.Duration
     // Content limits
     MaxVideoDurationSeconds int
+    MaxPlaylistItems        int // Playlist submissions are cut to this many entries
+    MaxBatchSize            int // Most URLs accepted by one POST /extract/batch
+    MaxOutputBytes          int64 // Converted files may not reach this size (0 means no limit)
+    MaxActiveJobsPerIP      int   // Pending and processing jobs one client IP may have at once (0 means no limit)
+    // Output tagging: EmbedTags is the default for requests that don't say;
+    // EmbedCoverArt also attaches the video thumbnail to MP3 output
+    EmbedTags     bool
+    EmbedCoverArt bool
+    // Target integrated loudness (LUFS) for requests with normalize set
+    LoudnessTarget float64
+    // Webhook callbacks: payloads are signed with WebhookSecret (HMAC-SHA256)
+    WebhookSecret     string
+    WebhookTimeout    time.Duration
+    WebhookMaxRetries int
+    // Wait before the first callback retry; it doubles for each further one
+    WebhookRetryBackoff time.Duration
+    // Hosts, IPs or CIDRs that callback URLs may point to even though they
+    // are not public (for testing against local servers)
+    CallbackHostAllowlist []string
+    // Graceful shutdown: how long to wait for in-flight requests and jobs
+    ShutdownTimeout time.Duration
+    // Directory converted files are written to, and served from with local storage
+    OutputDir string
+    // The worker reports itself unhealthy while OutputDir has less free space
+    // than this, so no more jobs are routed to it (0 disables the check)
+    MinFreeDiskBytes int64
+    // Name downloads are saved as, e.g. "{title} - {uploader}"; see DownloadFilename
+    FilenameTemplate string
+    // Output storage: "local" (OutputDir, served by the gateway) or "s3"
+    StorageBackend string
+    S3Bucket       string
+    S3Region       string
+    S3Endpoint     string // For S3-compatible services such as MinIO
+    S3AccessKey    string
+    S3SecretKey    string
+    S3Prefix       string
+    S3UsePathStyle bool
+    SignedURLTTL   time.Duration
+    // Download links served by the gateway are signed with DownloadSecret
+    // (HMAC-SHA256) and expire after SignedURLTTL; unset keeps bare job ID links
+    DownloadSecret string
+    // Retention: finished jobs and their files are removed JobTTL after completion (0 keeps them forever)
+    JobTTL          time.Duration
+    CleanupInterval time.Duration
+    // How long an Idempotency-Key on /extract keeps mapping to its job
+    IdempotencyTTL time.Duration
+    // Failed jobs are retried until they have been tried MaxJobAttempts times,
+    // then moved to the dead-letter queue
+    MaxJobAttempts int
+    // API keys: when RequireAPIKey is set, /extract needs a valid X-API-Key.
+    // New keys get APIKeyDailyQuota requests per UTC day unless one is given.
+    RequireAPIKey    bool
+    APIKeyDailyQuota int
 	// Database connection string, Queue connection string, S3 bucket name etc. would go here
 	// For this example, we'll keep them simple as in-memory stubs
 }
@@ -65,6 +227,23 @@ func LoadConfig() *Config {
             redisDB = n
         }
     }
+    redisPoolSize, redisMinIdle := 0, 0
+    if v := os.Getenv("REDIS_POOL_SIZE"); v != "" {
+        if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+            redisPoolSize = n
+        }
+    }
+    if v := os.Getenv("REDIS_MIN_IDLE_CONNS"); v != "" {
+        if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+            redisMinIdle = n
+        }
+    }
+    redisJobCompressMinSize := DefaultRedisJobCompressMinSize
+    if v := os.Getenv("REDIS_JOB_COMPRESS_MIN_BYTES"); v != "" {
+        if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+            redisJobCompressMinSize = n
+        }
+    }
 
     // Rate limit
     rateLimit := DefaultRateLimitRPM
@@ -73,6 +252,17 @@ func LoadConfig() *Config {
             rateLimit = n
         }
     }
+    bucketRPM := func(name string) int {
+        if n, err := strconv.Atoi(os.Getenv(name)); err == nil && n > 0 {
+            return n
+        }
+        return rateLimit
+    }
+    rateLimitStrategy := strings.ToLower(valueOrDefault(os.Getenv("RATE_LIMIT_STRATEGY"), RateLimitStrategyFixed))
+    if rateLimitStrategy != RateLimitStrategyFixed && rateLimitStrategy != RateLimitStrategySliding {
+        log.Printf("WARN: Unknown RATE_LIMIT_STRATEGY %q, using %s", rateLimitStrategy, RateLimitStrategyFixed)
+        rateLimitStrategy = RateLimitStrategyFixed
+    }
 
     // Queue length (optional)
     queueMaxLen := 0
@@ -81,6 +271,30 @@ func LoadConfig() *Config {
             queueMaxLen = n
         }
     }
+    maxQueueDepth := 0
+    if v := os.Getenv("MAX_QUEUE_DEPTH"); v != "" {
+        if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+            maxQueueDepth = n
+        }
+    }
+
+    // Pending-message recovery
+    claimMinIdle := DefaultClaimMinIdle
+    if v := os.Getenv("CLAIM_MIN_IDLE_SECONDS"); v != "" {
+        if n, err := strconv.Atoi(v); err == nil && n > 0 {
+            claimMinIdle = time.Duration(n) * time.Second
+        }
+    }
+    claimInterval := DefaultClaimInterval
+    if v := os.Getenv("CLAIM_INTERVAL_SECONDS"); v != "" {
+        if n, err := strconv.Atoi(v); err == nil && n > 0 {
+            claimInterval = time.Duration(n) * time.Second
+        }
+    }
+    if claimInterval >= claimMinIdle {
+        claimInterval = claimMinIdle / 2
+        log.Printf("WARN: CLAIM_INTERVAL_SECONDS must be below CLAIM_MIN_IDLE_SECONDS; using %s", claimInterval)
+    }
 
     // Max video duration seconds
     maxDur := DefaultMaxVideoDurationSeconds
@@ -90,6 +304,197 @@ func LoadConfig() *Config {
         }
     }
 
+    // Webhooks
+    webhookTimeout := DefaultWebhookTimeout
+    if v := os.Getenv("WEBHOOK_TIMEOUT_SECONDS"); v != "" {
+        if n, err := strconv.Atoi(v); err == nil && n > 0 {
+            webhookTimeout = time.Duration(n) * time.Second
+        }
+    }
+    ytDlpTimeout := DefaultYtDlpTimeout
+    if v := os.Getenv("YTDLP_TIMEOUT_SECONDS"); v != "" {
+        if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+            ytDlpTimeout = time.Duration(n) * time.Second
+        }
+    }
+    ffmpegTimeout := DefaultFFmpegTimeout
+    if v := os.Getenv("FFMPEG_TIMEOUT_SECONDS"); v != "" {
+        if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+            ffmpegTimeout = time.Duration(n) * time.Second
+        }
+    }
+    ffmpegThreads := max(1, runtime.NumCPU()/2)
+    if v := os.Getenv("FFMPEG_THREADS"); v != "" {
+        if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+            ffmpegThreads = n
+        }
+    }
+    ffmpegNice := 0
+    if v := os.Getenv("FFMPEG_NICE"); v != "" {
+        if n, err := strconv.Atoi(v); err == nil && n >= 0 && n <= 19 {
+            ffmpegNice = n
+        } else {
+            log.Printf("WARN: FFMPEG_NICE must be 0-19, not %q; running ffmpeg at normal priority", v)
+        }
+    }
+    metadataCacheTTL := DefaultMetadataCacheTTL
+    if v := os.Getenv("METADATA_CACHE_TTL_SECONDS"); v != "" {
+        if n, err := strconv.Atoi(v); err == nil && n > 0 {
+            metadataCacheTTL = time.Duration(n) * time.Second
+        }
+    }
+    sseMaxDuration := DefaultSSEMaxDuration
+    if v := os.Getenv("SSE_MAX_DURATION_SECONDS"); v != "" {
+        if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+            sseMaxDuration = time.Duration(n) * time.Second
+        }
+    }
+    var jobTotalTimeout time.Duration
+    if v := os.Getenv("JOB_TOTAL_TIMEOUT_SECONDS"); v != "" {
+        if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+            jobTotalTimeout = time.Duration(n) * time.Second
+        }
+    }
+    staleProcessingTimeout := DefaultStaleProcessingTimeout
+    if v := os.Getenv("STALE_PROCESSING_TIMEOUT_SECONDS"); v != "" {
+        if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+            staleProcessingTimeout = time.Duration(n) * time.Second
+        }
+    }
+    breakerThreshold := DefaultYtDlpBreakerThreshold
+    if v := os.Getenv("YTDLP_BREAKER_THRESHOLD"); v != "" {
+        if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+            breakerThreshold = n
+        }
+    }
+    breakerWindow := DefaultYtDlpBreakerWindow
+    if v := os.Getenv("YTDLP_BREAKER_WINDOW_SECONDS"); v != "" {
+        if n, err := strconv.Atoi(v); err == nil && n > 0 {
+            breakerWindow = time.Duration(n) * time.Second
+        }
+    }
+    breakerCooldown := DefaultYtDlpBreakerCooldown
+    if v := os.Getenv("YTDLP_BREAKER_COOLDOWN_SECONDS"); v != "" {
+        if n, err := strconv.Atoi(v); err == nil && n > 0 {
+            breakerCooldown = time.Duration(n) * time.Second
+        }
+    }
+    webhookRetries := DefaultWebhookMaxRetries
+    if v := os.Getenv("WEBHOOK_MAX_RETRIES"); v != "" {
+        if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+            webhookRetries = n
+        }
+    }
+    webhookRetryBackoff := DefaultWebhookRetryBackoff
+    if v := os.Getenv("WEBHOOK_RETRY_BACKOFF_SECONDS"); v != "" {
+        if n, err := strconv.Atoi(v); err == nil && n > 0 {
+            webhookRetryBackoff = time.Duration(n) * time.Second
+        }
+    }
+
+    // Graceful shutdown
+    shutdownTimeout := DefaultShutdownTimeout
+    if v := os.Getenv("SHUTDOWN_TIMEOUT_SECONDS"); v != "" {
+        if n, err := strconv.Atoi(v); err == nil && n > 0 {
+            shutdownTimeout = time.Duration(n) * time.Second
+        }
+    }
+
+    // Storage
+    signedURLTTL := DefaultSignedURLTTL
+    if v := os.Getenv("SIGNED_URL_TTL_SECONDS"); v != "" {
+        if n, err := strconv.Atoi(v); err == nil && n > 0 {
+            signedURLTTL = time.Duration(n) * time.Second
+        }
+    }
+    s3PathStyle, _ := strconv.ParseBool(os.Getenv("S3_USE_PATH_STYLE"))
+
+    // Retention
+    jobTTL := DefaultJobTTL
+    if v := os.Getenv("JOB_TTL_SECONDS"); v != "" {
+        if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+            jobTTL = time.Duration(n) * time.Second
+        }
+    }
+    cleanupInterval := DefaultCleanupInterval
+    if v := os.Getenv("CLEANUP_INTERVAL_SECONDS"); v != "" {
+        if n, err := strconv.Atoi(v); err == nil && n > 0 {
+            cleanupInterval = time.Duration(n) * time.Second
+        }
+    }
+
+    maxPlaylistItems := DefaultMaxPlaylistItems
+    if v := os.Getenv("MAX_PLAYLIST_ITEMS"); v != "" {
+        if n, err := strconv.Atoi(v); err == nil && n > 0 {
+            maxPlaylistItems = n
+        }
+    }
+    minFreeDiskBytes := int64(DefaultMinFreeDiskBytes)
+    if v := os.Getenv("MIN_FREE_DISK_BYTES"); v != "" {
+        if n, err := strconv.ParseInt(v, 10, 64); err == nil && n >= 0 {
+            minFreeDiskBytes = n
+        }
+    }
+    var maxOutputBytes int64
+    if v := os.Getenv("MAX_OUTPUT_BYTES"); v != "" {
+        if n, err := strconv.ParseInt(v, 10, 64); err == nil && n >= 0 {
+            maxOutputBytes = n
+        }
+    }
+    maxActiveJobsPerIP := 0
+    if v := os.Getenv("MAX_ACTIVE_JOBS_PER_IP"); v != "" {
+        if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+            maxActiveJobsPerIP = n
+        }
+    }
+    maxBatchSize := DefaultMaxBatchSize
+    if v := os.Getenv("MAX_BATCH_SIZE"); v != "" {
+        if n, err := strconv.Atoi(v); err == nil && n > 0 {
+            maxBatchSize = n
+        }
+    }
+
+    // Output tagging (tags default on, cover art off)
+    embedTags := true
+    if v := os.Getenv("EMBED_TAGS"); v != "" {
+        if b, err := strconv.ParseBool(v); err == nil {
+            embedTags = b
+        }
+    }
+    embedCoverArt, _ := strconv.ParseBool(os.Getenv("EMBED_COVER_ART"))
+
+    idempotencyTTL := DefaultIdempotencyTTL
+    if v := os.Getenv("IDEMPOTENCY_TTL_SECONDS"); v != "" {
+        if n, err := strconv.Atoi(v); err == nil && n > 0 {
+            idempotencyTTL = time.Duration(n) * time.Second
+        }
+    }
+
+    // Loudness normalization target
+    loudnessTarget := DefaultLoudnessTarget
+    if v := os.Getenv("LOUDNORM_TARGET_LUFS"); v != "" {
+        if f, err := strconv.ParseFloat(v, 64); err == nil && f >= -70 && f <= -5 {
+            loudnessTarget = f
+        }
+    }
+
+    // Job retries
+    maxAttempts := DefaultMaxJobAttempts
+    if v := os.Getenv("MAX_JOB_ATTEMPTS"); v != "" {
+        if n, err := strconv.Atoi(v); err == nil && n > 0 {
+            maxAttempts = n
+        }
+    }
+
+    // API keys
+    requireAPIKey, _ := strconv.ParseBool(os.Getenv("REQUIRE_API_KEY"))
+    apiKeyQuota := DefaultAPIKeyDailyQuota
+    if v := os.Getenv("API_KEY_DAILY_QUOTA"); v != "" {
+        if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+            apiKeyQuota = n
+        }
+    }
+
     // Admin token defaulting
     adminToken := os.Getenv("ADMIN_TOKEN")
     if strings.TrimSpace(adminToken) == "" {
@@ -103,6 +508,12 @@ func LoadConfig() *Config {
         allowedOriginsCSV = DefaultAllowedOrigins
     }
     allowedOrigins := splitAndClean(allowedOriginsCSV)
+    corsMaxAge := DefaultCORSMaxAge
+    if v := os.Getenv("CORS_MAX_AGE_SECONDS"); v != "" {
+        if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+            corsMaxAge = time.Duration(n) * time.Second
+        }
+    }
 
     allowedHostsCSV := os.Getenv("ALLOWED_VIDEO_HOSTS")
     if strings.TrimSpace(allowedHostsCSV) == "" {
@@ -110,26 +521,109 @@ func LoadConfig() *Config {
     }
     allowedVideoHosts := splitAndClean(allowedHostsCSV)
 
+    // URL canonicalization (default on)
+    canonicalizeURLs := true
+    if v := os.Getenv("CANONICALIZE_URLS"); v != "" {
+        if b, err := strconv.ParseBool(v); err == nil {
+            canonicalizeURLs = b
+        }
+    }
+
 	return &Config{
 		APIGatewayPort: os.Getenv("API_GATEWAY_PORT"),
 		WorkerPort:     os.Getenv("WORKER_PORT"),
 		MaxWorkers:     maxWorkers,
         AdminToken:     adminToken,
+        LogLevel:       valueOrDefault(os.Getenv("LOG_LEVEL"), "info"),
         RedisAddr:      os.Getenv("REDIS_ADDR"),
         RedisPassword:  os.Getenv("REDIS_PASSWORD"),
         RedisDB:        redisDB,
+        RedisPoolSize:     redisPoolSize,
+        RedisMinIdleConns: redisMinIdle,
+        RedisJobCompressMinSize: redisJobCompressMinSize,
+        PostgresDSN:    os.Getenv("POSTGRES_DSN"),
         QueueName:      valueOrDefault(os.Getenv("QUEUE_NAME"), DefaultQueueName),
         QueueMaxLength: queueMaxLen,
+        MaxQueueDepth:  maxQueueDepth,
+        ConsumerGroup:  valueOrDefault(os.Getenv("CONSUMER_GROUP"), DefaultConsumerGroup),
+        ClaimMinIdle:   claimMinIdle,
+        ClaimInterval:  claimInterval,
         AllowedOrigins:    allowedOrigins,
+        CORSMaxAge:        corsMaxAge,
         AllowedVideoHosts: allowedVideoHosts,
+        CanonicalizeURLs:  canonicalizeURLs,
+        StreamHostAllowlist: splitAndClean(os.Getenv("STREAM_HOST_ALLOWLIST")),
         RateLimitRPM:      rateLimit,
+        RateLimitExtractRPM:  bucketRPM("RATE_LIMIT_EXTRACT_RPM"),
+        RateLimitStatusRPM:   bucketRPM("RATE_LIMIT_STATUS_RPM"),
+        RateLimitDownloadRPM: bucketRPM("RATE_LIMIT_DOWNLOAD_RPM"),
+        RateLimitStrategy: rateLimitStrategy,
+        RateLimitAllowlist: splitAndClean(os.Getenv("RATE_LIMIT_ALLOWLIST")),
+        TrustedProxies:    splitAndClean(os.Getenv("TRUSTED_PROXIES")),
         PublicAPIBaseURL:  os.Getenv("PUBLIC_API_BASE_URL"),
         YtDlpPath:         os.Getenv("YTDLP_PATH"),
         FFmpegPath:        os.Getenv("FFMPEG_PATH"),
+        FallbackExtractorPath: os.Getenv("FALLBACK_EXTRACTOR_PATH"),
+        FFprobePath:       os.Getenv("FFPROBE_PATH"),
+        CookiesFilePath:   os.Getenv("YTDLP_COOKIES_FILE"),
+        YtDlpProxy:        splitAndClean(os.Getenv("YTDLP_PROXY")),
+        YtDlpTimeout:      ytDlpTimeout,
+        FFmpegTimeout:     ffmpegTimeout,
+        FFmpegThreads:     ffmpegThreads,
+        FFmpegNice:        ffmpegNice,
+        JobTotalTimeout:   jobTotalTimeout,
+        StaleProcessingTimeout: staleProcessingTimeout,
+        YtDlpBreakerThreshold: breakerThreshold,
+        YtDlpBreakerWindow:    breakerWindow,
+        YtDlpBreakerCooldown:  breakerCooldown,
+        MetadataCacheTTL:  metadataCacheTTL,
+        SSEMaxDuration:    sseMaxDuration,
         MaxVideoDurationSeconds: maxDur,
+        MaxPlaylistItems:  maxPlaylistItems,
+        MaxBatchSize:      maxBatchSize,
+        MaxOutputBytes:    maxOutputBytes,
+        MaxActiveJobsPerIP: maxActiveJobsPerIP,
+        EmbedTags:         embedTags,
+        EmbedCoverArt:     embedCoverArt,
+        LoudnessTarget:    loudnessTarget,
+        WebhookSecret:     os.Getenv("WEBHOOK_SECRET"),
+        WebhookTimeout:    webhookTimeout,
+        WebhookMaxRetries: webhookRetries,
+        WebhookRetryBackoff: webhookRetryBackoff,
+        CallbackHostAllowlist: splitAndClean(os.Getenv("CALLBACK_HOST_ALLOWLIST")),
+        ShutdownTimeout:   shutdownTimeout,
+        OutputDir:         valueOrDefault(os.Getenv("OUTPUT_DIR"), DefaultOutputDir),
+        MinFreeDiskBytes:  minFreeDiskBytes,
+        FilenameTemplate:  valueOrDefault(os.Getenv("FILENAME_TEMPLATE"), DefaultFilenameTemplate),
+        StorageBackend:    strings.ToLower(valueOrDefault(os.Getenv("STORAGE_BACKEND"), StorageBackendLocal)),
+        S3Bucket:          os.Getenv("S3_BUCKET"),
+        S3Region:          os.Getenv("S3_REGION"),
+        S3Endpoint:        os.Getenv("S3_ENDPOINT"),
+        S3AccessKey:       os.Getenv("S3_ACCESS_KEY_ID"),
+        S3SecretKey:       os.Getenv("S3_SECRET_ACCESS_KEY"),
+        S3Prefix:          os.Getenv("S3_PREFIX"),
+        S3UsePathStyle:    s3PathStyle,
+        SignedURLTTL:      signedURLTTL,
+        DownloadSecret:    os.Getenv("DOWNLOAD_SECRET"),
+        JobTTL:            jobTTL,
+        CleanupInterval:   cleanupInterval,
+        IdempotencyTTL:    idempotencyTTL,
+        MaxJobAttempts:    maxAttempts,
+        RequireAPIKey:     requireAPIKey,
+        APIKeyDailyQuota:  apiKeyQuota,
 	}
 }
 
+// PublicURL joins path onto the API Gateway's public base URL, falling back
+// to localhost when PUBLIC_API_BASE_URL is not set
+func (c *Config) PublicURL(path string) string {
+    base := c.PublicAPIBaseURL
+    if strings.TrimSpace(base) == "" {
+        base = "http://localhost:" + valueOrDefault(c.APIGatewayPort, DefaultAPIGatewayPort)
+    }
+    return strings.TrimRight(base, "/") + path
+}
+
 // valueOrDefault returns fallback if s is empty
 func valueOrDefault(s string, fallback string) string {
     if strings.TrimSpace(s) == "" {
@@ -2,46 +2,157 @@
 package shared
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 )
 
+const (
+	DefaultListLimit = 50
+	MaxListLimit     = 500
+)
+
+// ErrJobExists is returned by CreateJob when a job with the same ID is already
+// stored. Callers can recover by picking another ID.
+var ErrJobExists = errors.New("job already exists")
+
+// JobStats summarizes the jobs in the database for the admin dashboard
+type JobStats struct {
+	ByStatus          map[JobStatus]int // Every status is present, possibly as 0
+	CompletedLastHour int
+	CompletedLastDay  int
+}
+
+// newJobStats returns JobStats with a zero count for every status
+func newJobStats() *JobStats {
+	s := &JobStats{ByStatus: make(map[JobStatus]int, len(JobStatuses))}
+	for _, st := range JobStatuses {
+		s.ByStatus[st] = 0
+	}
+	return s
+}
+
+// JobFilter selects a page of jobs, newest first. An empty Status matches all
+// jobs except soft-deleted ones, unless IncludeDeleted is set.
+type JobFilter struct {
+	Status         JobStatus
+	Limit          int
+	Offset         int
+	IncludeDeleted bool
+	// Query, if set, must occur in the job's OriginalURL or title, ignoring case
+	Query string
+}
+
+// Matches reports whether job is selected by the filter
+func (f JobFilter) Matches(job *Job) bool {
+	if f.Status != "" {
+		if job.Status != f.Status {
+			return false
+		}
+	} else if !f.IncludeDeleted && job.Status == JobStatusDeleted {
+		return false
+	}
+	if f.Query == "" {
+		return true
+	}
+	q := strings.ToLower(f.Query)
+	return strings.Contains(strings.ToLower(job.OriginalURL), q) ||
+		job.Metadata != nil && strings.Contains(strings.ToLower(job.Metadata.Title), q)
+}
+
 // DatabaseClient is a conceptual interface for interacting with job data
 type DatabaseClient interface {
-	CreateJob(job *Job) error
-	GetJob(jobID string) (*Job, error)
-	UpdateJob(job *Job) error
-	DeleteJob(jobID string) error
-	GetAllJobs() ([]*Job, error) // For admin purposes
+	CreateJob(ctx context.Context, job *Job) error
+	GetJob(ctx context.Context, jobID string) (*Job, error)
+	UpdateJob(ctx context.Context, job *Job) error
+	DeleteJob(ctx context.Context, jobID string) error
+	GetAllJobs(ctx context.Context) ([]*Job, error) // For admin purposes
+	// ListJobs returns one page of jobs matching filter and the total number of matches
+	ListJobs(ctx context.Context, filter JobFilter) ([]*Job, int, error)
+	// FindCompletedJob returns a completed job for the same video and output settings
+	FindCompletedJob(ctx context.Context, videoID, format, bitrate string) (*Job, error)
+	// Ping checks that the database can be reached
+	Ping(ctx context.Context) error
+	// ClaimIdempotencyKey atomically maps key to jobID for ttl unless the key is
+	// already mapped. It returns the job ID the key maps to and whether this call claimed it.
+	ClaimIdempotencyKey(ctx context.Context, key, jobID string, ttl time.Duration) (string, bool, error)
+	// ReleaseIdempotencyKey removes a claim whose job was never created
+	ReleaseIdempotencyKey(ctx context.Context, key string) error
+	// RecordProcessingTime adds a finished job's processing time to the rolling
+	// sample of the last ProcessingTimeSamples jobs
+	RecordProcessingTime(ctx context.Context, d time.Duration) error
+	// AverageProcessingTime returns the mean of the sample; ok is false until
+	// a job has finished
+	AverageProcessingTime(ctx context.Context) (avg time.Duration, ok bool, err error)
+	// SaveJobLogs stores the command output captured while processing jobID,
+	// replacing any earlier logs. They are removed along with the job.
+	SaveJobLogs(ctx context.Context, jobID string, logs string) error
+	// GetJobLogs returns the logs stored for jobID, or "" if there are none
+	GetJobLogs(ctx context.Context, jobID string) (string, error)
+	// AppendJobEvent atomically adds event to jobID's history, keeping the
+	// newest MaxJobEvents. The history is removed along with the job.
+	AppendJobEvent(ctx context.Context, jobID string, event JobEvent) error
+	// GetJobHistory returns jobID's events, oldest first
+	GetJobHistory(ctx context.Context, jobID string) ([]JobEvent, error)
+	// CountByStatus counts jobs per status without loading them; every status
+	// is present, possibly as 0
+	CountByStatus(ctx context.Context) (map[JobStatus]int, error)
+	// JobStats counts jobs by status and recent completions
+	JobStats(ctx context.Context) (*JobStats, error)
 }
 
+// ProcessingTimeSamples is how many recent jobs the processing time average covers
+const ProcessingTimeSamples = 100
+
 // InMemoryDB implements DatabaseClient using an in-memory map
 type InMemoryDB struct {
 	jobs      map[string]*Job
 	jobsMutex sync.RWMutex
+
+	idempotencyKeys map[string]idempotencyClaim
+	processingTimes []time.Duration // Newest last
+	logs            map[string]string
+	events          map[string][]JobEvent
+}
+
+type idempotencyClaim struct {
+	jobID   string
+	expires time.Time
 }
 
 // NewInMemoryDB creates a new in-memory database instance
 func NewInMemoryDB() *InMemoryDB {
 	return &InMemoryDB{
-		jobs: make(map[string]*Job),
+		jobs:            make(map[string]*Job),
+		idempotencyKeys: make(map[string]idempotencyClaim),
+		logs:            make(map[string]string),
+		events:          make(map[string][]JobEvent),
 	}
 }
 
 // CreateJob adds a new job to the database
-func (db *InMemoryDB) CreateJob(job *Job) error {
+func (db *InMemoryDB) CreateJob(ctx context.Context, job *Job) error {
+	if err := ctx.Err(); err != nil { // Don't apply writes for abandoned requests
+		return err
+	}
 	db.jobsMutex.Lock()
 	defer db.jobsMutex.Unlock()
 
 	if _, exists := db.jobs[job.ID]; exists {
-		return fmt.Errorf("job with ID %s already exists", job.ID)
+		return fmt.Errorf("job with ID %s: %w", job.ID, ErrJobExists)
 	}
-	db.jobs[job.ID] = job
+	// Store a copy, as the caller may keep changing job
+	copiedJob := *job
+	db.jobs[job.ID] = &copiedJob
 	return nil
 }
 
 // GetJob retrieves a job by its ID
-func (db *InMemoryDB) GetJob(jobID string) (*Job, error) {
+func (db *InMemoryDB) GetJob(ctx context.Context, jobID string) (*Job, error) {
 	db.jobsMutex.RLock()
 	defer db.jobsMutex.RUnlock()
 
@@ -55,19 +166,26 @@ func (db *InMemoryDB) GetJob(jobID string) (*Job, error) {
 }
 
 // UpdateJob updates an existing job in the database
-func (db *InMemoryDB) UpdateJob(job *Job) error {
+func (db *InMemoryDB) UpdateJob(ctx context.Context, job *Job) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	db.jobsMutex.Lock()
 	defer db.jobsMutex.Unlock()
 
 	if _, exists := db.jobs[job.ID]; !exists {
 		return fmt.Errorf("job with ID %s not found for update", job.ID)
 	}
-	db.jobs[job.ID] = job
+	copiedJob := *job
+	db.jobs[job.ID] = &copiedJob
 	return nil
 }
 
 // DeleteJob removes a job from the database
-func (db *InMemoryDB) DeleteJob(jobID string) error {
+func (db *InMemoryDB) DeleteJob(ctx context.Context, jobID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	db.jobsMutex.Lock()
 	defer db.jobsMutex.Unlock()
 
@@ -75,11 +193,13 @@ func (db *InMemoryDB) DeleteJob(jobID string) error {
 		return fmt.Errorf("job with ID %s not found for deletion", jobID)
 	}
 	delete(db.jobs, jobID)
+	delete(db.logs, jobID)
+	delete(db.events, jobID)
 	return nil
 }
 
 // GetAllJobs retrieves all jobs (for admin/monitoring)
-func (db *InMemoryDB) GetAllJobs() ([]*Job, error) {
+func (db *InMemoryDB) GetAllJobs(ctx context.Context) ([]*Job, error) {
 	db.jobsMutex.RLock()
 	defer db.jobsMutex.RUnlock()
 
@@ -90,3 +210,177 @@ func (db *InMemoryDB) GetAllJobs() ([]*Job, error) {
 	}
 	return allJobs, nil
 }
+
+// ListJobs returns one page of jobs matching filter, newest first, and the total number of matches
+func (db *InMemoryDB) ListJobs(ctx context.Context, filter JobFilter) ([]*Job, int, error) {
+	db.jobsMutex.RLock()
+	matched := make([]*Job, 0, len(db.jobs))
+	for _, job := range db.jobs {
+		if filter.Matches(job) {
+			copiedJob := *job
+			matched = append(matched, &copiedJob)
+		}
+	}
+	db.jobsMutex.RUnlock()
+
+	sort.Slice(matched, func(i, j int) bool { return matched[i].CreatedAt.After(matched[j].CreatedAt) })
+	total := len(matched)
+	if filter.Offset >= total {
+		return []*Job{}, total, nil
+	}
+	end := total
+	if filter.Limit > 0 && filter.Offset+filter.Limit < end {
+		end = filter.Offset + filter.Limit
+	}
+	return matched[filter.Offset:end], total, nil
+}
+
+// FindCompletedJob returns a completed job for the same video and output settings
+func (db *InMemoryDB) FindCompletedJob(ctx context.Context, videoID, format, bitrate string) (*Job, error) {
+	db.jobsMutex.RLock()
+	defer db.jobsMutex.RUnlock()
+
+	for _, job := range db.jobs {
+		if job.Status == JobStatusCompleted && job.Cacheable() && job.VideoID == videoID && job.Format == format && job.Bitrate == bitrate {
+			copiedJob := *job
+			return &copiedJob, nil
+		}
+	}
+	return nil, fmt.Errorf("no completed job for video %s", videoID)
+}
+
+// Ping always succeeds for the in-memory database
+func (db *InMemoryDB) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (db *InMemoryDB) ClaimIdempotencyKey(ctx context.Context, key, jobID string, ttl time.Duration) (string, bool, error) {
+	db.jobsMutex.Lock()
+	defer db.jobsMutex.Unlock()
+	now := time.Now()
+	if c, ok := db.idempotencyKeys[key]; ok && now.Before(c.expires) {
+		return c.jobID, false, nil
+	}
+	for k, c := range db.idempotencyKeys {
+		if !now.Before(c.expires) {
+			delete(db.idempotencyKeys, k)
+		}
+	}
+	db.idempotencyKeys[key] = idempotencyClaim{jobID: jobID, expires: now.Add(ttl)}
+	return jobID, true, nil
+}
+
+func (db *InMemoryDB) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	db.jobsMutex.Lock()
+	defer db.jobsMutex.Unlock()
+	delete(db.idempotencyKeys, key)
+	return nil
+}
+
+func (db *InMemoryDB) RecordProcessingTime(ctx context.Context, d time.Duration) error {
+	db.jobsMutex.Lock()
+	defer db.jobsMutex.Unlock()
+	if len(db.processingTimes) >= ProcessingTimeSamples {
+		db.processingTimes = db.processingTimes[1:]
+	}
+	db.processingTimes = append(db.processingTimes, d)
+	return nil
+}
+
+func (db *InMemoryDB) AverageProcessingTime(ctx context.Context) (time.Duration, bool, error) {
+	db.jobsMutex.RLock()
+	defer db.jobsMutex.RUnlock()
+	return averageDuration(db.processingTimes)
+}
+
+func (db *InMemoryDB) SaveJobLogs(ctx context.Context, jobID string, logs string) error {
+	db.jobsMutex.Lock()
+	defer db.jobsMutex.Unlock()
+	db.logs[jobID] = logs
+	return nil
+}
+
+func (db *InMemoryDB) GetJobLogs(ctx context.Context, jobID string) (string, error) {
+	db.jobsMutex.RLock()
+	defer db.jobsMutex.RUnlock()
+	return db.logs[jobID], nil
+}
+
+func (db *InMemoryDB) AppendJobEvent(ctx context.Context, jobID string, event JobEvent) error {
+	db.jobsMutex.Lock()
+	defer db.jobsMutex.Unlock()
+	db.events[jobID] = appendCapped(db.events[jobID], event)
+	return nil
+}
+
+func (db *InMemoryDB) GetJobHistory(ctx context.Context, jobID string) ([]JobEvent, error) {
+	db.jobsMutex.RLock()
+	defer db.jobsMutex.RUnlock()
+	return append([]JobEvent{}, db.events[jobID]...), nil
+}
+
+// CountByStatus tallies the jobs in the map by status
+func (db *InMemoryDB) CountByStatus(ctx context.Context) (map[JobStatus]int, error) {
+	db.jobsMutex.RLock()
+	defer db.jobsMutex.RUnlock()
+	counts := newJobStats().ByStatus
+	for _, job := range db.jobs {
+		counts[job.Status]++
+	}
+	return counts, nil
+}
+
+// JobStats counts the jobs in the map
+func (db *InMemoryDB) JobStats(ctx context.Context) (*JobStats, error) {
+	db.jobsMutex.RLock()
+	defer db.jobsMutex.RUnlock()
+	stats := newJobStats()
+	now := time.Now()
+	for _, job := range db.jobs {
+		stats.ByStatus[job.Status]++
+		if job.Status != JobStatusCompleted || job.CompletedAt == nil {
+			continue
+		}
+		if age := now.Sub(*job.CompletedAt); age <= 24*time.Hour {
+			stats.CompletedLastDay++
+			if age <= time.Hour {
+				stats.CompletedLastHour++
+			}
+		}
+	}
+	return stats, nil
+}
+
+// averageDuration returns the mean of ds, or false when ds is empty
+func averageDuration(ds []time.Duration) (time.Duration, bool, error) {
+	if len(ds) == 0 {
+		return 0, false, nil
+	}
+	var sum time.Duration
+	for _, d := range ds {
+		sum += d
+	}
+	return sum / time.Duration(len(ds)), true, nil
+}
+
+// NewDatabaseClient returns a Postgres-backed DatabaseClient when
+// cfg.PostgresDSN is set, a Redis-backed one when cfg.RedisAddr is set, and an
+// in-memory one otherwise. The backend is pinged before it is used.
+func NewDatabaseClient(cfg *Config) (DatabaseClient, error) {
+	if cfg.PostgresDSN != "" {
+		p, err := NewPostgresDB(cfg.PostgresDSN)
+		if err != nil {
+			return nil, fmt.Errorf("postgres unreachable: %w", err)
+		}
+		return p, nil
+	}
+	client := NewRedisClient(cfg)
+	if client == nil {
+		return NewInMemoryDB(), nil
+	}
+	if err := PingRedis(client); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("redis at %s unreachable: %w", cfg.RedisAddr, err)
+	}
+	return NewRedisDB(client, cfg.JobTTL, cfg.RedisJobCompressMinSize), nil
+}
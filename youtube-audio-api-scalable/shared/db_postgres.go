@@ -0,0 +1,402 @@
+// shared/db_postgres.go
+package shared
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "github.com/lib/pq" // Registers the "postgres" driver
+)
+
+// PostgresSchema creates the tables PostgresDB uses; see postgres_schema.sql
+//
+//go:embed postgres_schema.sql
+var PostgresSchema string
+
+// PostgresDB implements DatabaseClient on Postgres, for durable job history.
+// Queried fields have their own columns; the rest of the job is kept in the
+// data JSONB column. Unlike RedisDB, finished jobs don't expire on their own;
+// the worker's reaper removes them after cfg.JobTTL.
+type PostgresDB struct {
+	db *sql.DB
+}
+
+// NewPostgresDB connects to dsn and applies PostgresSchema
+func NewPostgresDB(dsn string) (*PostgresDB, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if _, err := db.ExecContext(ctx, PostgresSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to apply schema: %w", err)
+	}
+	return &PostgresDB{db: db}, nil
+}
+
+// jobColumns is the column list read by scanJob, in order
+const jobColumns = `id, status, original_url, video_id, format, bitrate, parent_id, error,
+	metadata, storage_key, file_path, created_at, started_at, completed_at, data`
+
+// jobArgs returns job's values for the columns of an insert or update, in
+// the order of jobColumns
+func jobArgs(job *Job) ([]any, error) {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode job %s: %w", job.ID, err)
+	}
+	var metadata any
+	if job.Metadata != nil {
+		b, err := json.Marshal(job.Metadata)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode metadata of job %s: %w", job.ID, err)
+		}
+		metadata = string(b) // lib/pq sends []byte as bytea, which jsonb rejects
+	}
+	return []any{
+		job.ID, string(job.Status), job.OriginalURL, job.VideoID, job.Format, job.Bitrate,
+		job.ParentID, job.Error, metadata, job.StorageKey, job.FilePath,
+		job.CreatedAt, nullTime(job.StartedAt), nullTime(job.CompletedAt), string(data),
+		job.Cacheable(),
+	}, nil
+}
+
+// nullTime maps a nil time to SQL NULL
+func nullTime(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return *t
+}
+
+// scanJob reads a row selected with jobColumns
+func scanJob(row interface{ Scan(...any) error }) (*Job, error) {
+	var (
+		j                      Job
+		status                 string
+		metadata, data         []byte
+		startedAt, completedAt sql.NullTime
+	)
+	err := row.Scan(&j.ID, &status, &j.OriginalURL, &j.VideoID, &j.Format, &j.Bitrate, &j.ParentID, &j.Error,
+		&metadata, &j.StorageKey, &j.FilePath, &j.CreatedAt, &startedAt, &completedAt, &data)
+	if err != nil {
+		return nil, err
+	}
+	// Fill in the remaining fields from data, then let the columns win
+	cols := j
+	if err := json.Unmarshal(data, &j); err != nil {
+		return nil, fmt.Errorf("failed to decode job %s: %w", cols.ID, err)
+	}
+	j.ID, j.OriginalURL, j.VideoID, j.Format, j.Bitrate = cols.ID, cols.OriginalURL, cols.VideoID, cols.Format, cols.Bitrate
+	j.ParentID, j.Error, j.StorageKey, j.FilePath, j.CreatedAt = cols.ParentID, cols.Error, cols.StorageKey, cols.FilePath, cols.CreatedAt
+	j.Status = JobStatus(status)
+	j.Metadata = nil
+	if len(metadata) > 0 {
+		if err := json.Unmarshal(metadata, &j.Metadata); err != nil {
+			return nil, fmt.Errorf("failed to decode metadata of job %s: %w", j.ID, err)
+		}
+	}
+	j.StartedAt, j.CompletedAt = nil, nil
+	if startedAt.Valid {
+		j.StartedAt = &startedAt.Time
+	}
+	if completedAt.Valid {
+		j.CompletedAt = &completedAt.Time
+	}
+	return &j, nil
+}
+
+// queryJobs runs query, which must select jobColumns, and scans every row
+func (p *PostgresDB) queryJobs(ctx context.Context, query string, args ...any) ([]*Job, error) {
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	jobs := []*Job{}
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+func (p *PostgresDB) CreateJob(ctx context.Context, job *Job) error {
+	if job.ID == "" {
+		return fmt.Errorf("job has no ID")
+	}
+	args, err := jobArgs(job)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	res, err := p.db.ExecContext(ctx, `INSERT INTO jobs (`+jobColumns+`, cacheable)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+		ON CONFLICT (id) DO NOTHING`, args...)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("job with ID %s: %w", job.ID, ErrJobExists)
+	}
+	return nil
+}
+
+func (p *PostgresDB) GetJob(ctx context.Context, jobID string) (*Job, error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	job, err := scanJob(p.db.QueryRowContext(ctx, `SELECT `+jobColumns+` FROM jobs WHERE id = $1`, jobID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("job with ID %s not found", jobID)
+	}
+	return job, err
+}
+
+func (p *PostgresDB) UpdateJob(ctx context.Context, job *Job) error {
+	args, err := jobArgs(job)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	res, err := p.db.ExecContext(ctx, `UPDATE jobs SET status = $2, original_url = $3, video_id = $4,
+		format = $5, bitrate = $6, parent_id = $7, error = $8, metadata = $9, storage_key = $10,
+		file_path = $11, created_at = $12, started_at = $13, completed_at = $14, data = $15, cacheable = $16
+		WHERE id = $1`, args...)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("job with ID %s not found for update", job.ID)
+	}
+	return nil
+}
+
+func (p *PostgresDB) DeleteJob(ctx context.Context, jobID string) error {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	res, err := p.db.ExecContext(ctx, `DELETE FROM jobs WHERE id = $1`, jobID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("job with ID %s not found for deletion", jobID)
+	}
+	return nil
+}
+
+// GetAllJobs returns every job, oldest first
+func (p *PostgresDB) GetAllJobs(ctx context.Context) ([]*Job, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	return p.queryJobs(ctx, `SELECT `+jobColumns+` FROM jobs ORDER BY created_at`)
+}
+
+func (p *PostgresDB) ListJobs(ctx context.Context, filter JobFilter) ([]*Job, int, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	var total int
+	// With no status, soft-deleted jobs only match when asked for
+	const where = `WHERE (status = $1 OR ($1 = '' AND ($2 OR status <> 'deleted')))
+		AND ($3 = '' OR original_url ILIKE $3 OR metadata->>'title' ILIKE $3)`
+	pattern := ""
+	if filter.Query != "" {
+		pattern = "%" + likeEscaper.Replace(filter.Query) + "%"
+	}
+	err := p.db.QueryRowContext(ctx, `SELECT count(*) FROM jobs `+where,
+		string(filter.Status), filter.IncludeDeleted, pattern).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+	var limit any // NULL means no limit
+	if filter.Limit > 0 {
+		limit = filter.Limit
+	}
+	jobs, err := p.queryJobs(ctx, `SELECT `+jobColumns+` FROM jobs `+where+`
+		ORDER BY created_at DESC LIMIT $4 OFFSET $5`, string(filter.Status), filter.IncludeDeleted, pattern, limit, filter.Offset)
+	return jobs, total, err
+}
+
+// likeEscaper escapes LIKE wildcards (with the default escape character \)
+// so a search matches them literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func (p *PostgresDB) FindCompletedJob(ctx context.Context, videoID, format, bitrate string) (*Job, error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	job, err := scanJob(p.db.QueryRowContext(ctx, `SELECT `+jobColumns+` FROM jobs
+		WHERE status = 'completed' AND cacheable AND video_id = $1 AND format = $2 AND bitrate = $3
+		ORDER BY completed_at DESC NULLS LAST LIMIT 1`, videoID, format, bitrate))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("no completed job for video %s", videoID)
+	}
+	return job, err
+}
+
+func (p *PostgresDB) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	return p.db.PingContext(ctx)
+}
+
+// ClaimIdempotencyKey inserts the key, or takes it over if it has expired;
+// otherwise it returns the job ID already stored
+func (p *PostgresDB) ClaimIdempotencyKey(ctx context.Context, key, jobID string, ttl time.Duration) (string, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	now := time.Now()
+	var claimed string
+	err := p.db.QueryRowContext(ctx, `INSERT INTO idempotency_keys (key, job_id, expires_at) VALUES ($1, $2, $3)
+		ON CONFLICT (key) DO UPDATE SET job_id = EXCLUDED.job_id, expires_at = EXCLUDED.expires_at
+		WHERE idempotency_keys.expires_at <= $4
+		RETURNING job_id`, key, jobID, now.Add(ttl), now).Scan(&claimed)
+	if err == nil {
+		return claimed, true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return "", false, err
+	}
+	var existing string
+	if err := p.db.QueryRowContext(ctx, `SELECT job_id FROM idempotency_keys WHERE key = $1`, key).Scan(&existing); err != nil {
+		return "", false, err
+	}
+	return existing, false, nil
+}
+
+func (p *PostgresDB) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	_, err := p.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE key = $1`, key)
+	return err
+}
+
+func (p *PostgresDB) RecordProcessingTime(ctx context.Context, d time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	if _, err := p.db.ExecContext(ctx, `INSERT INTO processing_times (duration_ms) VALUES ($1)`, d.Milliseconds()); err != nil {
+		return err
+	}
+	_, err := p.db.ExecContext(ctx, `DELETE FROM processing_times WHERE id <=
+		(SELECT id FROM processing_times ORDER BY id DESC OFFSET $1 LIMIT 1)`, ProcessingTimeSamples)
+	return err
+}
+
+func (p *PostgresDB) AverageProcessingTime(ctx context.Context) (time.Duration, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	var avg sql.NullFloat64
+	if err := p.db.QueryRowContext(ctx, `SELECT avg(duration_ms) FROM processing_times`).Scan(&avg); err != nil {
+		return 0, false, err
+	}
+	if !avg.Valid {
+		return 0, false, nil
+	}
+	return time.Duration(avg.Float64 * float64(time.Millisecond)), true, nil
+}
+
+func (p *PostgresDB) SaveJobLogs(ctx context.Context, jobID string, logs string) error {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	_, err := p.db.ExecContext(ctx, `INSERT INTO job_logs (job_id, logs) VALUES ($1, $2)
+		ON CONFLICT (job_id) DO UPDATE SET logs = EXCLUDED.logs`, jobID, logs)
+	return err
+}
+
+func (p *PostgresDB) GetJobLogs(ctx context.Context, jobID string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	var logs string
+	err := p.db.QueryRowContext(ctx, `SELECT logs FROM job_logs WHERE job_id = $1`, jobID).Scan(&logs)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return logs, err
+}
+
+// AppendJobEvent inserts the event and drops those beyond MaxJobEvents in
+// one statement. The DELETE runs on the snapshot from before the INSERT, so it
+// keeps one fewer of the existing events.
+func (p *PostgresDB) AppendJobEvent(ctx context.Context, jobID string, event JobEvent) error {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	_, err := p.db.ExecContext(ctx, `WITH added AS (
+			INSERT INTO job_events (job_id, at, status, reason, source) VALUES ($1, $2, $3, $4, $5)
+		)
+		DELETE FROM job_events WHERE job_id = $1 AND id NOT IN (
+			SELECT id FROM job_events WHERE job_id = $1 ORDER BY id DESC LIMIT $6 - 1)`,
+		jobID, event.At, string(event.Status), event.Reason, event.Source, MaxJobEvents)
+	return err
+}
+
+func (p *PostgresDB) GetJobHistory(ctx context.Context, jobID string) ([]JobEvent, error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	rows, err := p.db.QueryContext(ctx, `SELECT at, status, reason, source FROM job_events
+		WHERE job_id = $1 ORDER BY id`, jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	events := []JobEvent{}
+	for rows.Next() {
+		var e JobEvent
+		var status string
+		if err := rows.Scan(&e.At, &status, &e.Reason, &e.Source); err != nil {
+			return nil, err
+		}
+		e.Status = JobStatus(status)
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+func (p *PostgresDB) CountByStatus(ctx context.Context) (map[JobStatus]int, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	rows, err := p.db.QueryContext(ctx, `SELECT status, count(*) FROM jobs GROUP BY status`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	counts := newJobStats().ByStatus
+	for rows.Next() {
+		var status string
+		var n int
+		if err := rows.Scan(&status, &n); err != nil {
+			return nil, err
+		}
+		counts[JobStatus(status)] = n
+	}
+	return counts, rows.Err()
+}
+
+func (p *PostgresDB) JobStats(ctx context.Context) (*JobStats, error) {
+	counts, err := p.CountByStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	stats := &JobStats{ByStatus: counts}
+	now := time.Now()
+	err = p.db.QueryRowContext(ctx, `SELECT count(*) FILTER (WHERE completed_at >= $1), count(*)
+		FROM jobs WHERE status = 'completed' AND completed_at >= $2`,
+		now.Add(-time.Hour), now.Add(-24*time.Hour)).Scan(&stats.CompletedLastHour, &stats.CompletedLastDay)
+	return stats, err
+}
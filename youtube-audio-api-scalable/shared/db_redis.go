@@ -1,9 +1,13 @@
 package shared
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"strconv"
 	"time"
 
 	redis "github.com/redis/go-redis/v9"
@@ -12,39 +16,151 @@ import (
 // RedisDB implements DatabaseClient using Redis as a key-value store
 // Keys: job:<id> => JSON(Job)
 // Sorted set for listing: jobs (score: createdAt unix)
+// Sorted sets for stats: jobs:status:<status> (score: unix time the job entered
+// that status; completed jobs use completedAt)
+// Result cache index: video:<videoID>:<format>:<bitrate> => job ID of a completed job
+// Idempotency keys: idem:<key> => job ID (SETNX with a TTL)
+// Processing times: stats:processing_ms => list of recent durations in ms
+// Job logs: joblogs:<id> => captured command output
+// Job history: jobevents:<id> => list of JSON(JobEvent), oldest first
+// Finished jobs expire after jobTTL (if set); stale IDs are pruned from the sorted set on read.
+// Job JSON of at least compressMinSize bytes is stored gzipped (see encodeJob).
 type RedisDB struct {
-	client *redis.Client
+	client          *redis.Client
+	jobTTL          time.Duration
+	compressMinSize int // 0 stores every job as plain JSON
 }
 
-func NewRedisDB(client *redis.Client) *RedisDB {
-	return &RedisDB{client: client}
+func NewRedisDB(client *redis.Client, jobTTL time.Duration, compressMinSize int) *RedisDB {
+	return &RedisDB{client: client, jobTTL: jobTTL, compressMinSize: compressMinSize}
+}
+
+// jobValueGzip is the header byte of a stored job whose JSON is gzipped.
+// Plain JSON values, including every one written before compression was
+// added, start with '{' instead.
+const jobValueGzip byte = 0x01
+
+// encodeJob serializes job for its job:<id> key, compressed when large
+func (r *RedisDB) encodeJob(job *Job) ([]byte, error) {
+	b, err := json.Marshal(job)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode job %s: %w", job.ID, err)
+	}
+	if r.compressMinSize <= 0 || len(b) < r.compressMinSize {
+		return b, nil
+	}
+	var buf bytes.Buffer
+	buf.WriteByte(jobValueGzip)
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(b); err != nil {
+		return nil, fmt.Errorf("failed to compress job %s: %w", job.ID, err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress job %s: %w", job.ID, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeJob reads a stored job value written by encodeJob, compressed or not
+func decodeJob(val []byte, j *Job) error {
+	if len(val) > 0 && val[0] == jobValueGzip {
+		zr, err := gzip.NewReader(bytes.NewReader(val[1:]))
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		if val, err = io.ReadAll(zr); err != nil {
+			return err
+		}
+	}
+	return json.Unmarshal(val, j)
 }
 
 func (r *RedisDB) jobKey(id string) string { return fmt.Sprintf("job:%s", id) }
 
-func (r *RedisDB) CreateJob(job *Job) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-	defer cancel()
-	key := r.jobKey(job.ID)
-	exists, err := r.client.Exists(ctx, key).Result()
+func (r *RedisDB) logsKey(id string) string { return fmt.Sprintf("joblogs:%s", id) }
+
+func (r *RedisDB) eventsKey(id string) string { return fmt.Sprintf("jobevents:%s", id) }
+
+func (r *RedisDB) statusKey(status JobStatus) string { return fmt.Sprintf("jobs:status:%s", status) }
+
+// trackStatus queues commands moving job into its status set. ZADD NX keeps
+// the time it first entered the status across progress updates.
+func (r *RedisDB) trackStatus(ctx context.Context, pipe redis.Pipeliner, job *Job) {
+	for _, st := range JobStatuses {
+		if st != job.Status {
+			pipe.ZRem(ctx, r.statusKey(st), job.ID)
+		}
+	}
+	pipe.ZAddNX(ctx, r.statusKey(job.Status), redis.Z{Score: float64(statusSince(job).Unix()), Member: job.ID})
+}
+
+// statusSince is when job entered its status, as scored in the status sets
+func statusSince(job *Job) time.Time {
+	if job.Status == JobStatusCompleted && job.CompletedAt != nil {
+		return *job.CompletedAt
+	}
+	return time.Now()
+}
+
+func (r *RedisDB) videoKey(videoID, format, bitrate string) string {
+	return fmt.Sprintf("video:%s:%s:%s", videoID, format, bitrate)
+}
+
+// The job calls below go through withRedisRetry, so a Redis restart shows up
+// as ErrStorageUnavailable rather than an opaque network error
+
+// createJobScript stores a new job and indexes it, unless its key is taken.
+// A key already holding the same value is the caller's own write, seen again
+// when a retry follows a lost reply, and counts as created. Returns 1 when
+// created. KEYS: job key, jobs, the job's status set, then the other status
+// sets. ARGV: value, created at, job ID, status since.
+var createJobScript = redis.NewScript(`
+local current = redis.call("GET", KEYS[1])
+if current then
+	if current == ARGV[1] then
+		return 1
+	end
+	return 0
+end
+redis.call("SET", KEYS[1], ARGV[1])
+redis.call("ZADD", KEYS[2], ARGV[2], ARGV[3])
+for i = 4, #KEYS do
+	redis.call("ZREM", KEYS[i], ARGV[3])
+end
+redis.call("ZADD", KEYS[3], "NX", ARGV[4], ARGV[3])
+return 1`)
+
+func (r *RedisDB) CreateJob(ctx context.Context, job *Job) error {
+	b, err := r.encodeJob(job)
 	if err != nil {
 		return err
 	}
-	if exists > 0 {
-		return fmt.Errorf("job with ID %s already exists", job.ID)
+	keys := []string{r.jobKey(job.ID), "jobs", r.statusKey(job.Status)}
+	for _, st := range JobStatuses {
+		if st != job.Status {
+			keys = append(keys, r.statusKey(st))
+		}
 	}
-	b, _ := json.Marshal(job)
-	pipe := r.client.TxPipeline()
-	pipe.Set(ctx, key, b, 0)
-	pipe.ZAdd(ctx, "jobs", redis.Z{Score: float64(job.CreatedAt.Unix()), Member: job.ID})
-	_, err = pipe.Exec(ctx)
-	return err
+	return withRedisRetry(ctx, "create_job", func(ctx context.Context) error {
+		created, err := createJobScript.Run(ctx, r.client, keys,
+			b, job.CreatedAt.Unix(), job.ID, statusSince(job).Unix()).Int()
+		if err != nil {
+			return err
+		}
+		if created == 0 {
+			return fmt.Errorf("job with ID %s: %w", job.ID, ErrJobExists)
+		}
+		return nil
+	})
 }
 
-func (r *RedisDB) GetJob(jobID string) (*Job, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-	defer cancel()
-	val, err := r.client.Get(ctx, r.jobKey(jobID)).Bytes()
+func (r *RedisDB) GetJob(ctx context.Context, jobID string) (*Job, error) {
+	var val []byte
+	err := withRedisRetry(ctx, "get_job", func(ctx context.Context) (err error) {
+		val, err = r.client.Get(ctx, r.jobKey(jobID)).Bytes()
+		return err
+	})
 	if err != nil {
 		if err == redis.Nil {
 			return nil, fmt.Errorf("job with ID %s not found", jobID)
@@ -52,50 +168,370 @@ func (r *RedisDB) GetJob(jobID string) (*Job, error) {
 		return nil, err
 	}
 	var j Job
-	if err := json.Unmarshal(val, &j); err != nil {
-		return nil, err
+	if err := decodeJob(val, &j); err != nil {
+		return nil, fmt.Errorf("failed to decode job %s: %w", jobID, err)
+	}
+	if j.ID == "" {
+		return nil, fmt.Errorf("stored job %s has no ID", jobID)
 	}
 	return &j, nil
 }
 
-func (r *RedisDB) UpdateJob(job *Job) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-	defer cancel()
+func (r *RedisDB) UpdateJob(ctx context.Context, job *Job) error {
 	key := r.jobKey(job.ID)
-	exists, err := r.client.Exists(ctx, key).Result()
+	b, err := r.encodeJob(job)
 	if err != nil {
 		return err
 	}
-	if exists == 0 {
-		return fmt.Errorf("job with ID %s not found for update", job.ID)
+	var expiration time.Duration
+	if job.Status.IsTerminal() {
+		expiration = r.jobTTL // Finished jobs self-clean; the reaper removes their files
+		if job.ExpiresAt != nil {
+			// Later updates, e.g. the callback result, mustn't push it back
+			expiration = max(time.Until(*job.ExpiresAt), time.Second)
+		}
 	}
-	b, _ := json.Marshal(job)
-	return r.client.Set(ctx, key, b, 0).Err()
+	return withRedisRetry(ctx, "update_job", func(ctx context.Context) error {
+		exists, err := r.client.Exists(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		if exists == 0 {
+			return fmt.Errorf("job with ID %s not found for update", job.ID)
+		}
+		pipe := r.client.TxPipeline()
+		pipe.Set(ctx, key, b, expiration)
+		if job.Status == JobStatusCompleted && job.VideoID != "" && job.Cacheable() { // Clips and normalized files aren't reused
+			pipe.Set(ctx, r.videoKey(job.VideoID, job.Format, job.Bitrate), job.ID, expiration)
+		}
+		r.trackStatus(ctx, pipe, job)
+		_, err = pipe.Exec(ctx)
+		return err
+	})
 }
 
-func (r *RedisDB) DeleteJob(jobID string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+func (r *RedisDB) DeleteJob(ctx context.Context, jobID string) error {
+	job, _ := r.GetJob(ctx, jobID)
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
 	defer cancel()
 	pipe := r.client.TxPipeline()
-	pipe.Del(ctx, r.jobKey(jobID))
+	pipe.Del(ctx, r.jobKey(jobID), r.logsKey(jobID), r.eventsKey(jobID))
+	if job != nil && job.VideoID != "" {
+		// Only drop the cache index if it still points at this job
+		vk := r.videoKey(job.VideoID, job.Format, job.Bitrate)
+		if cur, err := r.client.Get(ctx, vk).Result(); err == nil && cur == jobID {
+			pipe.Del(ctx, vk)
+		}
+	}
 	pipe.ZRem(ctx, "jobs", jobID)
+	for _, st := range JobStatuses {
+		pipe.ZRem(ctx, r.statusKey(st), jobID)
+	}
 	_, err := pipe.Exec(ctx)
 	return err
 }
 
-func (r *RedisDB) GetAllJobs() ([]*Job, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (r *RedisDB) GetAllJobs(ctx context.Context) ([]*Job, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 	ids, err := r.client.ZRevRange(ctx, "jobs", 0, -1).Result()
 	if err != nil {
 		return nil, err
 	}
-	jobs := make([]*Job, 0, len(ids))
-	for _, id := range ids {
-		j, err := r.GetJob(id)
-		if err == nil {
-			jobs = append(jobs, j)
+	return r.getJobs(ctx, ids)
+}
+
+func (r *RedisDB) FindCompletedJob(ctx context.Context, videoID, format, bitrate string) (*Job, error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	id, err := r.client.Get(ctx, r.videoKey(videoID, format, bitrate)).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, fmt.Errorf("no completed job for video %s", videoID)
+		}
+		return nil, err
+	}
+	job, err := r.GetJob(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status != JobStatusCompleted {
+		return nil, fmt.Errorf("no completed job for video %s", videoID)
+	}
+	return job, nil
+}
+
+func (r *RedisDB) Ping(ctx context.Context) error {
+	return PingRedis(r.client)
+}
+
+func (r *RedisDB) idempotencyKey(key string) string { return fmt.Sprintf("idem:%s", key) }
+
+// ClaimIdempotencyKey uses SETNX so concurrent requests with the same key
+// agree on a single job
+func (r *RedisDB) ClaimIdempotencyKey(ctx context.Context, key, jobID string, ttl time.Duration) (string, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	ok, err := r.client.SetNX(ctx, r.idempotencyKey(key), jobID, ttl).Result()
+	if err != nil {
+		return "", false, err
+	}
+	if ok {
+		return jobID, true, nil
+	}
+	existing, err := r.client.Get(ctx, r.idempotencyKey(key)).Result()
+	if err == redis.Nil {
+		// Expired between SETNX and GET; try once more
+		ok, err = r.client.SetNX(ctx, r.idempotencyKey(key), jobID, ttl).Result()
+		if err != nil {
+			return "", false, err
+		}
+		if ok {
+			return jobID, true, nil
+		}
+		existing, err = r.client.Get(ctx, r.idempotencyKey(key)).Result()
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return existing, false, nil
+}
+
+func (r *RedisDB) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	return r.client.Del(ctx, r.idempotencyKey(key)).Err()
+}
+
+// processingTimesKey is a list of recent processing times in milliseconds, newest first
+const processingTimesKey = "stats:processing_ms"
+
+func (r *RedisDB) RecordProcessingTime(ctx context.Context, d time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	pipe := r.client.TxPipeline()
+	pipe.LPush(ctx, processingTimesKey, d.Milliseconds())
+	pipe.LTrim(ctx, processingTimesKey, 0, ProcessingTimeSamples-1)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (r *RedisDB) AverageProcessingTime(ctx context.Context) (time.Duration, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	vals, err := r.client.LRange(ctx, processingTimesKey, 0, -1).Result()
+	if err != nil && err != redis.Nil {
+		return 0, false, err
+	}
+	ds := make([]time.Duration, 0, len(vals))
+	for _, v := range vals {
+		if ms, err := strconv.ParseInt(v, 10, 64); err == nil {
+			ds = append(ds, time.Duration(ms)*time.Millisecond)
+		}
+	}
+	return averageDuration(ds)
+}
+
+// SaveJobLogs stores logs with the same expiry as finished jobs
+func (r *RedisDB) SaveJobLogs(ctx context.Context, jobID string, logs string) error {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	return r.client.Set(ctx, r.logsKey(jobID), logs, r.jobTTL).Err()
+}
+
+// AppendJobEvent pushes and trims in one MULTI so concurrent writers can't
+// leave the list over the cap. It expires like job logs.
+func (r *RedisDB) AppendJobEvent(ctx context.Context, jobID string, event JobEvent) error {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	b, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	key := r.eventsKey(jobID)
+	pipe := r.client.TxPipeline()
+	pipe.RPush(ctx, key, b)
+	pipe.LTrim(ctx, key, -MaxJobEvents, -1)
+	if r.jobTTL > 0 {
+		pipe.Expire(ctx, key, r.jobTTL)
+	}
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (r *RedisDB) GetJobHistory(ctx context.Context, jobID string) ([]JobEvent, error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	vals, err := r.client.LRange(ctx, r.eventsKey(jobID), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	events := make([]JobEvent, 0, len(vals))
+	for _, v := range vals {
+		var e JobEvent
+		if err := json.Unmarshal([]byte(v), &e); err != nil {
+			return nil, fmt.Errorf("failed to decode event of job %s: %w", jobID, err)
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+func (r *RedisDB) GetJobLogs(ctx context.Context, jobID string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	logs, err := r.client.Get(ctx, r.logsKey(jobID)).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return logs, err
+}
+
+// ListJobs pages through the jobs sorted set newest first. Without a status
+// filter or query it reads just the requested range; with one it scans in batches.
+func (r *RedisDB) ListJobs(ctx context.Context, filter JobFilter) ([]*Job, int, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	unfiltered := filter.Status == "" && filter.Query == ""
+	allJobs := unfiltered && filter.IncludeDeleted
+	if unfiltered && !filter.IncludeDeleted {
+		// Soft-deleted jobs are rare, so only filter them out when there are any
+		deleted, err := r.client.ZCard(ctx, r.statusKey(JobStatusDeleted)).Result()
+		if err != nil {
+			return nil, 0, err
+		}
+		allJobs = deleted == 0
+	}
+	if allJobs {
+		total, err := r.client.ZCard(ctx, "jobs").Result()
+		if err != nil {
+			return nil, 0, err
+		}
+		stop := int64(-1)
+		if filter.Limit > 0 {
+			stop = int64(filter.Offset + filter.Limit - 1)
+		}
+		ids, err := r.client.ZRevRange(ctx, "jobs", int64(filter.Offset), stop).Result()
+		if err != nil {
+			return nil, 0, err
+		}
+		jobs, err := r.getJobs(ctx, ids)
+		return jobs, int(total), err
+	}
+
+	const batch = 500
+	jobs := []*Job{}
+	total := 0
+	for start := int64(0); ; start += batch {
+		ids, err := r.client.ZRevRange(ctx, "jobs", start, start+batch-1).Result()
+		if err != nil {
+			return nil, 0, err
+		}
+		page, err := r.getJobs(ctx, ids)
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, j := range page {
+			if !filter.Matches(j) {
+				continue
+			}
+			if total >= filter.Offset && (filter.Limit <= 0 || len(jobs) < filter.Limit) {
+				jobs = append(jobs, j)
+			}
+			total++
+		}
+		if len(ids) < batch {
+			return jobs, total, nil
+		}
+	}
+}
+
+// getJobs loads several jobs with one MGET. IDs whose key has expired are
+// skipped and removed from the jobs sorted set.
+func (r *RedisDB) getJobs(ctx context.Context, ids []string) ([]*Job, error) {
+	if len(ids) == 0 {
+		return []*Job{}, nil
+	}
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = r.jobKey(id)
+	}
+	vals, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	jobs := make([]*Job, 0, len(vals))
+	var missing []any
+	for i, v := range vals {
+		raw, ok := v.(string)
+		if !ok {
+			missing = append(missing, ids[i])
+			continue
 		}
+		var j Job
+		if err := decodeJob([]byte(raw), &j); err == nil && j.ID != "" {
+			jobs = append(jobs, &j)
+		}
+	}
+	if len(missing) > 0 {
+		_ = r.client.ZRem(ctx, "jobs", missing...).Err()
 	}
 	return jobs, nil
 }
+
+// countStatuses queues commands counting the per-status sets, which every
+// create, update and delete keeps in step with the jobs. Finished jobs whose
+// keys have expired are pruned from their set first.
+func (r *RedisDB) countStatuses(ctx context.Context, pipe redis.Pipeliner, now time.Time) map[JobStatus]*redis.IntCmd {
+	if r.jobTTL > 0 {
+		cutoff := strconv.FormatInt(now.Add(-r.jobTTL).Unix(), 10)
+		for _, st := range JobStatuses {
+			if st.IsTerminal() {
+				pipe.ZRemRangeByScore(ctx, r.statusKey(st), "-inf", "("+cutoff)
+			}
+		}
+	}
+	counts := make(map[JobStatus]*redis.IntCmd, len(JobStatuses))
+	for _, st := range JobStatuses {
+		counts[st] = pipe.ZCard(ctx, r.statusKey(st))
+	}
+	return counts
+}
+
+// CountByStatus reads the sizes of the per-status sets
+func (r *RedisDB) CountByStatus(ctx context.Context) (map[JobStatus]int, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	pipe := r.client.Pipeline()
+	cmds := r.countStatuses(ctx, pipe, time.Now())
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	counts := make(map[JobStatus]int, len(cmds))
+	for st, cmd := range cmds {
+		counts[st] = int(cmd.Val())
+	}
+	return counts, nil
+}
+
+// JobStats reads the per-status sets instead of loading jobs
+func (r *RedisDB) JobStats(ctx context.Context) (*JobStats, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	now := time.Now()
+	pipe := r.client.Pipeline()
+	counts := r.countStatuses(ctx, pipe, now)
+	since := func(d time.Duration) string { return strconv.FormatInt(now.Add(-d).Unix(), 10) }
+	lastHour := pipe.ZCount(ctx, r.statusKey(JobStatusCompleted), since(time.Hour), "+inf")
+	lastDay := pipe.ZCount(ctx, r.statusKey(JobStatusCompleted), since(24*time.Hour), "+inf")
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	stats := newJobStats()
+	for st, cmd := range counts {
+		stats.ByStatus[st] = int(cmd.Val())
+	}
+	stats.CompletedLastHour = int(lastHour.Val())
+	stats.CompletedLastDay = int(lastDay.Val())
+	return stats, nil
+}
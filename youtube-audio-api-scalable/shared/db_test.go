@@ -0,0 +1,548 @@
+// shared/db_test.go
+package shared
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNewDatabaseClientSelectsBackend(t *testing.T) {
+	_, mr := newTestRedis(t)
+
+	db, err := NewDatabaseClient(&Config{})
+	if err != nil {
+		t.Fatalf("NewDatabaseClient without Redis: %v", err)
+	}
+	if _, ok := db.(*InMemoryDB); !ok {
+		t.Errorf("without REDIS_ADDR got %T, want *InMemoryDB", db)
+	}
+
+	db, err = NewDatabaseClient(&Config{RedisAddr: mr.Addr()})
+	if err != nil {
+		t.Fatalf("NewDatabaseClient with Redis: %v", err)
+	}
+	if _, ok := db.(*RedisDB); !ok {
+		t.Errorf("with REDIS_ADDR got %T, want *RedisDB", db)
+	}
+
+	if _, err := NewDatabaseClient(&Config{RedisAddr: "127.0.0.1:1"}); err == nil {
+		t.Error("NewDatabaseClient succeeded with Redis unreachable")
+	}
+}
+
+// testDatabases returns an in-memory and a Redis-backed DatabaseClient, and a
+// Postgres-backed one when POSTGRES_TEST_DSN is set
+func testDatabases(t *testing.T) map[string]DatabaseClient {
+	t.Helper()
+	client, _ := newTestRedis(t)
+	dbs := map[string]DatabaseClient{
+		"in-memory": NewInMemoryDB(),
+		"redis":     NewRedisDB(client, 0, 0),
+	}
+	if os.Getenv("POSTGRES_TEST_DSN") != "" {
+		dbs["postgres"] = testPostgres(t)
+	}
+	return dbs
+}
+
+// jobIDs returns the IDs of jobs in order
+func jobIDs(jobs []*Job) []string {
+	ids := make([]string, len(jobs))
+	for i, j := range jobs {
+		ids[i] = j.ID
+	}
+	return ids
+}
+
+func TestListJobsFiltersAndPages(t *testing.T) {
+	for name, db := range testDatabases(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			base := time.Now().Add(-time.Hour)
+			statuses := []JobStatus{JobStatusPending, JobStatusCompleted, JobStatusPending, JobStatusFailed, JobStatusPending, JobStatusDeleted}
+			for i, st := range statuses {
+				job := &Job{ID: fmt.Sprintf("job-%d", i), Status: st, CreatedAt: base.Add(time.Duration(i) * time.Minute)}
+				if err := db.CreateJob(ctx, job); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			tests := []struct {
+				filter    JobFilter
+				wantIDs   []string
+				wantTotal int
+			}{
+				// Newest first, soft-deleted jobs hidden by default
+				{JobFilter{Limit: 10}, []string{"job-4", "job-3", "job-2", "job-1", "job-0"}, 5},
+				{JobFilter{Limit: 10, IncludeDeleted: true}, []string{"job-5", "job-4", "job-3", "job-2", "job-1", "job-0"}, 6},
+				{JobFilter{Limit: 10, Status: JobStatusPending}, []string{"job-4", "job-2", "job-0"}, 3},
+				{JobFilter{Limit: 10, Status: JobStatusDeleted}, []string{"job-5"}, 1},
+				{JobFilter{Limit: 10, Status: JobStatusCancelled}, []string{}, 0},
+				{JobFilter{Limit: 2, Status: JobStatusPending}, []string{"job-4", "job-2"}, 3},
+				{JobFilter{Limit: 2, Offset: 2, Status: JobStatusPending}, []string{"job-0"}, 3},
+				// Offsets at and past the end give an empty page but the full total
+				{JobFilter{Limit: 2, Offset: 3, Status: JobStatusPending}, []string{}, 3},
+				{JobFilter{Limit: 2, Offset: 100}, []string{}, 5},
+				{JobFilter{Limit: 1, Offset: 4}, []string{"job-0"}, 5},
+			}
+			for _, tt := range tests {
+				jobs, total, err := db.ListJobs(ctx, tt.filter)
+				if err != nil {
+					t.Fatalf("ListJobs(%+v): %v", tt.filter, err)
+				}
+				if got := jobIDs(jobs); total != tt.wantTotal || !slices.Equal(got, tt.wantIDs) {
+					t.Errorf("ListJobs(%+v) = %v (total %d), want %v (total %d)", tt.filter, got, total, tt.wantIDs, tt.wantTotal)
+				}
+			}
+		})
+	}
+}
+
+func TestClaimIdempotencyKeyIsRaceSafe(t *testing.T) {
+	for name, db := range testDatabases(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			const racers = 10
+			var wg sync.WaitGroup
+			claims := make(chan string, racers)
+			for i := 0; i < racers; i++ {
+				wg.Add(1)
+				go func(jobID string) {
+					defer wg.Done()
+					existing, claimed, err := db.ClaimIdempotencyKey(ctx, "client:key-1", jobID, time.Minute)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					if claimed {
+						claims <- jobID
+					} else if existing == "" {
+						t.Error("an unclaimed key returned no existing job")
+					}
+				}(fmt.Sprintf("job-%d", i))
+			}
+			wg.Wait()
+			close(claims)
+			if n := len(claims); n != 1 {
+				t.Fatalf("%d requests claimed the key, want 1", n)
+			}
+			winner := <-claims
+			if existing, claimed, _ := db.ClaimIdempotencyKey(ctx, "client:key-1", "job-late", time.Minute); claimed || existing != winner {
+				t.Errorf("late claim = %q, %v; want %q", existing, claimed, winner)
+			}
+
+			if err := db.ReleaseIdempotencyKey(ctx, "client:key-1"); err != nil {
+				t.Fatal(err)
+			}
+			if _, claimed, _ := db.ClaimIdempotencyKey(ctx, "client:key-1", "job-retry", time.Minute); !claimed {
+				t.Error("a released key could not be claimed again")
+			}
+		})
+	}
+}
+
+func TestCreateJobClaimsIDOnce(t *testing.T) {
+	for name, db := range testDatabases(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			const racers = 10
+			var wg sync.WaitGroup
+			created := make(chan string, racers)
+			for i := 0; i < racers; i++ {
+				wg.Add(1)
+				go func(url string) {
+					defer wg.Done()
+					err := db.CreateJob(ctx, &Job{ID: "job-1", OriginalURL: url, Status: JobStatusPending, CreatedAt: time.Now()})
+					switch {
+					case err == nil:
+						created <- url
+					case !errors.Is(err, ErrJobExists):
+						t.Error(err)
+					}
+				}(fmt.Sprintf("https://youtu.be/racer%d", i))
+			}
+			wg.Wait()
+			close(created)
+			if n := len(created); n != 1 {
+				t.Fatalf("%d requests created job-1, want 1", n)
+			}
+			winner := <-created
+			if job, err := db.GetJob(ctx, "job-1"); err != nil || job.OriginalURL != winner {
+				t.Errorf("stored job = %+v, %v; want the one created by %s", job, err, winner)
+			}
+		})
+	}
+}
+
+func TestRedisDBCreateJobRetryAfterLostReply(t *testing.T) {
+	client, _ := newTestRedis(t)
+	db := NewRedisDB(client, 0, 0)
+	ctx := context.Background()
+	job := &Job{ID: "job-1", OriginalURL: "https://youtu.be/dQw4w9WgXcQ", Status: JobStatusPending, CreatedAt: time.Now()}
+	if err := db.CreateJob(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+
+	// A retry whose first attempt was stored finds its own job
+	if err := db.CreateJob(ctx, job); err != nil {
+		t.Errorf("repeating the create: %v", err)
+	}
+	other := *job
+	other.OriginalURL = "https://youtu.be/other"
+	if err := db.CreateJob(ctx, &other); !errors.Is(err, ErrJobExists) {
+		t.Errorf("creating a different job with a taken ID: %v, want ErrJobExists", err)
+	}
+	if n := client.ZCard(ctx, "jobs").Val(); n != 1 {
+		t.Errorf("jobs index holds %d entries, want 1", n)
+	}
+	if n := client.ZCard(ctx, "jobs:status:pending").Val(); n != 1 {
+		t.Errorf("pending index holds %d entries, want 1", n)
+	}
+}
+
+func TestRedisDBSurfacesEncodeErrors(t *testing.T) {
+	client, _ := newTestRedis(t)
+	ctx := context.Background()
+	db := NewRedisDB(client, 0, 0)
+	// encoding/json refuses NaN, so a job carrying one can't be encoded
+	job := &Job{ID: "job-1", Status: JobStatusPending, CreatedAt: time.Now(), Metadata: &Metadata{Duration: math.NaN()}}
+
+	if err := db.CreateJob(ctx, job); err == nil || !strings.Contains(err.Error(), "failed to encode job job-1") {
+		t.Errorf("CreateJob = %v, want the encode error", err)
+	}
+	if n, _ := client.Exists(ctx, "job:job-1").Result(); n != 0 {
+		t.Error("CreateJob stored a value for an unencodable job")
+	}
+	job.Metadata = nil
+	if err := db.CreateJob(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+	job.Metadata = &Metadata{Duration: math.NaN()}
+	if err := db.UpdateJob(ctx, job); err == nil {
+		t.Error("UpdateJob accepted an unencodable job")
+	}
+}
+
+func TestRedisDBRejectsStoredJobWithoutID(t *testing.T) {
+	client, _ := newTestRedis(t)
+	db := NewRedisDB(client, 0, 0)
+	client.Set(context.Background(), "job:broken", `{"status":"pending"}`, 0)
+	if _, err := db.GetJob(context.Background(), "broken"); err == nil {
+		t.Error("GetJob accepted a record without an ID")
+	}
+}
+
+func TestJobStatsAggregatesStatusesAndCompletions(t *testing.T) {
+	for name, db := range testDatabases(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Now()
+			completedAgo := func(d time.Duration) *time.Time {
+				at := now.Add(-d)
+				return &at
+			}
+			jobs := []*Job{
+				{ID: "pending-1", Status: JobStatusPending},
+				{ID: "pending-2", Status: JobStatusPending},
+				{ID: "processing", Status: JobStatusProcessing},
+				{ID: "failed", Status: JobStatusFailed},
+				{ID: "done-recent", Status: JobStatusCompleted, CompletedAt: completedAgo(10 * time.Minute)},
+				{ID: "done-today", Status: JobStatusCompleted, CompletedAt: completedAgo(5 * time.Hour)},
+				{ID: "done-old", Status: JobStatusCompleted, CompletedAt: completedAgo(48 * time.Hour)},
+			}
+			for _, job := range jobs {
+				job.CreatedAt = now.Add(-72 * time.Hour)
+				if err := db.CreateJob(ctx, job); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// Counters must follow status changes and deletions
+			jobs[2].Status, jobs[2].CompletedAt = JobStatusCompleted, completedAgo(time.Minute)
+			if err := db.UpdateJob(ctx, jobs[2]); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.DeleteJob(ctx, "pending-2"); err != nil {
+				t.Fatal(err)
+			}
+
+			stats, err := db.JobStats(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := map[JobStatus]int{JobStatusPending: 1, JobStatusProcessing: 0, JobStatusFailed: 1, JobStatusCompleted: 4}
+			for st, n := range want {
+				if stats.ByStatus[st] != n {
+					t.Errorf("%s: %d jobs, want %d", st, stats.ByStatus[st], n)
+				}
+			}
+			if len(stats.ByStatus) != len(JobStatuses) {
+				t.Errorf("ByStatus has %d statuses, want all %d", len(stats.ByStatus), len(JobStatuses))
+			}
+			if stats.CompletedLastHour != 2 || stats.CompletedLastDay != 3 {
+				t.Errorf("completed in the last hour %d, day %d; want 2, 3", stats.CompletedLastHour, stats.CompletedLastDay)
+			}
+		})
+	}
+}
+
+func TestCountByStatusFollowsTransitions(t *testing.T) {
+	for name, db := range testDatabases(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			expect := func(step string, want map[JobStatus]int) {
+				t.Helper()
+				counts, err := db.CountByStatus(ctx)
+				if err != nil {
+					t.Fatalf("%s: %v", step, err)
+				}
+				for _, st := range JobStatuses {
+					if counts[st] != want[st] {
+						t.Errorf("%s: %d %s jobs, want %d (counts %v)", step, counts[st], st, want[st], counts)
+					}
+				}
+			}
+			update := func(job *Job, status JobStatus) {
+				t.Helper()
+				job.Status = status
+				if status == JobStatusCompleted {
+					now := time.Now()
+					job.CompletedAt = &now
+				}
+				if err := db.UpdateJob(ctx, job); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			expect("empty", nil)
+			a := &Job{ID: "a", Status: JobStatusPending, CreatedAt: time.Now()}
+			b := &Job{ID: "b", Status: JobStatusPending, CreatedAt: time.Now()}
+			for _, job := range []*Job{a, b} {
+				if err := db.CreateJob(ctx, job); err != nil {
+					t.Fatal(err)
+				}
+			}
+			expect("created", map[JobStatus]int{JobStatusPending: 2})
+			update(a, JobStatusProcessing)
+			expect("processing", map[JobStatus]int{JobStatusPending: 1, JobStatusProcessing: 1})
+			update(a, JobStatusProcessing) // A progress update keeps the status
+			expect("progress", map[JobStatus]int{JobStatusPending: 1, JobStatusProcessing: 1})
+			update(a, JobStatusCompleted)
+			expect("completed", map[JobStatus]int{JobStatusPending: 1, JobStatusCompleted: 1})
+			if err := db.DeleteJob(ctx, "a"); err != nil {
+				t.Fatal(err)
+			}
+			expect("deleted", map[JobStatus]int{JobStatusPending: 1})
+			db.DeleteJob(ctx, "a") // Deleting again must not count twice
+			expect("deleted twice", map[JobStatus]int{JobStatusPending: 1})
+			update(b, JobStatusFailed)
+			expect("failed", map[JobStatus]int{JobStatusFailed: 1})
+		})
+	}
+}
+
+func TestJobHistoryKeepsNewestEvents(t *testing.T) {
+	for name, db := range testDatabases(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			if err := db.CreateJob(ctx, &Job{ID: "job-1", Status: JobStatusPending, CreatedAt: time.Now()}); err != nil {
+				t.Fatal(err)
+			}
+			start := time.Now().UTC().Truncate(time.Second)
+			for i := 0; i < MaxJobEvents+5; i++ {
+				ev := JobEvent{At: start.Add(time.Duration(i) * time.Second), Status: JobStatusProcessing, Reason: fmt.Sprintf("event %d", i), Source: "worker"}
+				if err := db.AppendJobEvent(ctx, "job-1", ev); err != nil {
+					t.Fatal(err)
+				}
+			}
+			events, err := db.GetJobHistory(ctx, "job-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(events) != MaxJobEvents {
+				t.Fatalf("kept %d events, want %d", len(events), MaxJobEvents)
+			}
+			if events[0].Reason != "event 5" || events[len(events)-1].Reason != fmt.Sprintf("event %d", MaxJobEvents+4) {
+				t.Errorf("kept events %q to %q, want the newest", events[0].Reason, events[len(events)-1].Reason)
+			}
+			if !events[0].At.Equal(start.Add(5*time.Second)) || events[0].Source != "worker" {
+				t.Errorf("first event %+v didn't round-trip", events[0])
+			}
+			if other, err := db.GetJobHistory(ctx, "job-2"); err != nil || len(other) != 0 {
+				t.Errorf("history of a job without events = %v, %v", other, err)
+			}
+		})
+	}
+}
+
+func TestListJobsSearchesURLAndTitle(t *testing.T) {
+	for name, db := range testDatabases(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			base := time.Now().Add(-time.Hour)
+			jobs := []*Job{
+				{ID: "job-0", OriginalURL: "https://www.youtube.com/watch?v=dQw4w9WgXcQ", Metadata: &Metadata{Title: "Never Gonna Give You Up"}},
+				{ID: "job-1", OriginalURL: "https://youtu.be/dQw4w9WgXcQ", Status: JobStatusFailed},
+				{ID: "job-2", OriginalURL: "https://youtu.be/9bZkp7q19f0", Metadata: &Metadata{Title: "Gangnam Style"}},
+				{ID: "job-3", OriginalURL: "https://youtu.be/kJQP7kiw5Fk", Metadata: &Metadata{Title: "100%_Despacito"}},
+				{ID: "job-4", OriginalURL: "https://youtu.be/dQw4w9WgXcQ?t=1", Status: JobStatusDeleted},
+			}
+			for i, job := range jobs {
+				job.CreatedAt = base.Add(time.Duration(i) * time.Minute)
+				if job.Status == "" {
+					job.Status = JobStatusCompleted
+				}
+				if err := db.CreateJob(ctx, job); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			tests := []struct {
+				filter    JobFilter
+				wantIDs   []string
+				wantTotal int
+			}{
+				{JobFilter{Limit: 10, Query: "dqw4w9"}, []string{"job-1", "job-0"}, 2},
+				{JobFilter{Limit: 10, Query: "gangnam"}, []string{"job-2"}, 1},
+				{JobFilter{Limit: 10, Query: "GIVE YOU"}, []string{"job-0"}, 1},
+				{JobFilter{Limit: 10, Query: "dQw4w9", Status: JobStatusFailed}, []string{"job-1"}, 1},
+				{JobFilter{Limit: 10, Query: "dQw4w9", IncludeDeleted: true}, []string{"job-4", "job-1", "job-0"}, 3},
+				{JobFilter{Limit: 1, Offset: 1, Query: "youtu"}, []string{"job-2"}, 4},
+				// LIKE wildcards match only themselves
+				{JobFilter{Limit: 10, Query: "%_d"}, []string{"job-3"}, 1},
+				{JobFilter{Limit: 10, Query: "_"}, []string{"job-3"}, 1},
+				{JobFilter{Limit: 10, Query: "no such video"}, []string{}, 0},
+			}
+			for _, tt := range tests {
+				got, total, err := db.ListJobs(ctx, tt.filter)
+				if err != nil {
+					t.Fatalf("ListJobs(%+v): %v", tt.filter, err)
+				}
+				if ids := jobIDs(got); total != tt.wantTotal || !slices.Equal(ids, tt.wantIDs) {
+					t.Errorf("ListJobs(%+v) = %v (total %d), want %v (total %d)", tt.filter, ids, total, tt.wantIDs, tt.wantTotal)
+				}
+			}
+		})
+	}
+}
+
+func TestExpiryAfter(t *testing.T) {
+	completedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	if got := ExpiryAfter(completedAt, 24*time.Hour); got == nil || !got.Equal(completedAt.Add(24*time.Hour)) {
+		t.Errorf("ExpiryAfter(24h) = %v", got)
+	}
+	if got := ExpiryAfter(completedAt, 0); got != nil {
+		t.Errorf("ExpiryAfter(0) = %v, want nil: finished jobs are kept", got)
+	}
+}
+
+func TestRedisDBExpiresJobAtExpiresAt(t *testing.T) {
+	client, mr := newTestRedis(t)
+	db := NewRedisDB(client, 24*time.Hour, 0)
+	ctx := context.Background()
+	job := &Job{ID: "job-1", Status: JobStatusProcessing, CreatedAt: time.Now()}
+	if err := db.CreateJob(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+
+	// Finished 50 minutes ago with a 1h TTL, e.g. updated again with the
+	// callback result: the key lives the 10 minutes left, not another TTL
+	completedAt := time.Now().Add(-50 * time.Minute)
+	job.Status = JobStatusCompleted
+	job.CompletedAt = &completedAt
+	job.ExpiresAt = ExpiryAfter(completedAt, time.Hour)
+	if err := db.UpdateJob(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := mr.TTL("job:job-1"); ttl > 10*time.Minute || ttl < 9*time.Minute {
+		t.Errorf("key TTL %s, want the 10m left until expires_at", ttl)
+	}
+	mr.FastForward(10 * time.Minute)
+	if _, err := db.GetJob(ctx, "job-1"); err == nil {
+		t.Error("job kept past expires_at")
+	}
+}
+
+func TestRedisDBCompressesLargeJobs(t *testing.T) {
+	client, mr := newTestRedis(t)
+	db := NewRedisDB(client, 0, 512)
+	ctx := context.Background()
+	children := make([]string, 100)
+	for i := range children {
+		children[i] = fmt.Sprintf("playlist-entry-%03d", i)
+	}
+	small := &Job{ID: "small", Status: JobStatusPending, CreatedAt: time.Now().Round(0)}
+	large := &Job{ID: "large", Status: JobStatusProcessing, CreatedAt: time.Now().Round(0), ChildIDs: children,
+		Metadata: &Metadata{Title: "Mix", Uploader: strings.Repeat("Various Artists ", 20)}}
+	for _, job := range []*Job{small, large} {
+		if err := db.CreateJob(ctx, job); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	raw, _ := mr.Get("job:small")
+	if !strings.HasPrefix(raw, "{") {
+		t.Errorf("small job stored as %q, want plain JSON", raw)
+	}
+	raw, _ = mr.Get("job:large")
+	plain, _ := json.Marshal(large)
+	if raw[0] != jobValueGzip || len(raw) >= len(plain) {
+		t.Errorf("large job stored in %d bytes starting %#x; want gzipped, smaller than its %d bytes of JSON", len(raw), raw[0], len(plain))
+	}
+
+	got, err := db.GetJob(ctx, "large")
+	if err != nil || !slices.Equal(got.ChildIDs, children) || got.Metadata.Uploader != large.Metadata.Uploader {
+		t.Fatalf("GetJob = %+v, %v", got, err)
+	}
+	all, err := db.GetAllJobs(ctx)
+	if err != nil || len(all) != 2 {
+		t.Errorf("GetAllJobs = %v, %v; want both jobs", jobIDs(all), err)
+	}
+
+	// An update that shrinks the job stores it plainly again
+	got.ChildIDs, got.Metadata = nil, nil
+	if err := db.UpdateJob(ctx, got); err != nil {
+		t.Fatal(err)
+	}
+	if raw, _ := mr.Get("job:large"); !strings.HasPrefix(raw, "{") {
+		t.Errorf("shrunk job stored as %q, want plain JSON", raw)
+	}
+}
+
+func TestRedisDBReadsLegacyAndCompressedJobs(t *testing.T) {
+	client, mr := newTestRedis(t)
+	ctx := context.Background()
+	// Written before compression existed
+	legacy := `{"job_id":"legacy","original_url":"https://youtu.be/dQw4w9WgXcQ","status":"completed","created_at":"2024-05-01T12:00:00Z"}`
+	mr.Set("job:legacy", legacy)
+	// Written by a node with compression on, read by one with it off
+	writer := NewRedisDB(client, 0, 1)
+	if err := writer.CreateJob(ctx, &Job{ID: "packed", Status: JobStatusFailed, Error: "boom", CreatedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, db := range map[string]*RedisDB{"compressing": NewRedisDB(client, 0, 1), "plain": NewRedisDB(client, 0, 0)} {
+		job, err := db.GetJob(ctx, "legacy")
+		if err != nil || job.Status != JobStatusCompleted || job.OriginalURL != "https://youtu.be/dQw4w9WgXcQ" {
+			t.Errorf("%s: legacy job %+v, %v", name, job, err)
+		}
+		job, err = db.GetJob(ctx, "packed")
+		if err != nil || job.Status != JobStatusFailed || job.Error != "boom" {
+			t.Errorf("%s: compressed job %+v, %v", name, job, err)
+		}
+	}
+
+	// A corrupt compressed value is an error, not an empty job
+	mr.Set("job:broken", string([]byte{jobValueGzip, 'n', 'o', 't', ' ', 'g', 'z'}))
+	if job, err := NewRedisDB(client, 0, 0).GetJob(ctx, "broken"); err == nil {
+		t.Errorf("GetJob(broken) = %+v, want an error", job)
+	}
+}
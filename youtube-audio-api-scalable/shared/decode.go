@@ -0,0 +1,83 @@
+// shared/decode.go
+package shared
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// MaxJSONBodySize limits the size of JSON request bodies
+const MaxJSONBodySize = 64 << 10
+
+// BodyError is a request body problem to report to the client with Status
+type BodyError struct {
+	Status int
+	Msg    string
+}
+
+func (e *BodyError) Error() string { return e.Msg }
+
+// Code is the error response code for e
+func (e *BodyError) Code() string {
+	if e.Status == http.StatusRequestEntityTooLarge {
+		return ErrCodeBodyTooLarge
+	}
+	return ErrCodeInvalidRequest
+}
+
+// Write sends e as an error response
+func (e *BodyError) Write(w http.ResponseWriter) {
+	WriteError(w, e.Status, e.Code(), e.Msg)
+}
+
+// DecodeJSONBody decodes the JSON object in r's body into v. Bodies larger than
+// maxBytes, unknown fields and trailing data are rejected with a message fit
+// for the client.
+func DecodeJSONBody(w http.ResponseWriter, r *http.Request, v any, maxBytes int64) *BodyError {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return bodyError(err, maxBytes)
+	}
+	if err := dec.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			return bodyError(err, maxBytes)
+		}
+		return &BodyError{http.StatusBadRequest, "Request body must contain a single JSON object"}
+	}
+	return nil
+}
+
+func bodyError(err error, maxBytes int64) *BodyError {
+	var (
+		syntaxErr *json.SyntaxError
+		typeErr   *json.UnmarshalTypeError
+		maxErr    *http.MaxBytesError
+	)
+	switch {
+	case errors.As(err, &maxErr):
+		return &BodyError{http.StatusRequestEntityTooLarge, fmt.Sprintf("Request body must not exceed %d bytes", maxBytes)}
+	case errors.Is(err, io.EOF):
+		return &BodyError{http.StatusBadRequest, "Request body is empty"}
+	case errors.As(err, &syntaxErr):
+		return &BodyError{http.StatusBadRequest, fmt.Sprintf("Malformed JSON at position %d", syntaxErr.Offset)}
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return &BodyError{http.StatusBadRequest, "Malformed JSON: body ended unexpectedly"}
+	case errors.As(err, &typeErr):
+		if typeErr.Field != "" {
+			return &BodyError{http.StatusBadRequest, fmt.Sprintf("Field %q must be of type %s", typeErr.Field, typeErr.Type)}
+		}
+		return &BodyError{http.StatusBadRequest, "Request body must be a JSON object"}
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json has no typed error for this
+		return &BodyError{http.StatusBadRequest, "Unknown field " + strings.TrimPrefix(err.Error(), "json: unknown field ")}
+	default:
+		return &BodyError{http.StatusBadRequest, "Invalid JSON: " + err.Error()}
+	}
+}
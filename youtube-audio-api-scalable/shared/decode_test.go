@@ -0,0 +1,52 @@
+package shared
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDecodeJSONBody(t *testing.T) {
+	type request struct {
+		URL    string `json:"url"`
+		Format string `json:"format"`
+	}
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int // 0 means the body decodes
+		wantMsg    string
+	}{
+		{"valid", `{"url":"https://youtu.be/x","format":"mp3"}`, 0, ""},
+		{"oversized", `{"url":"` + strings.Repeat("a", 100) + `"}`, http.StatusRequestEntityTooLarge, "must not exceed 64 bytes"},
+		{"unknown field", `{"url":"https://youtu.be/x","bitrte":"320k"}`, http.StatusBadRequest, `Unknown field "bitrte"`},
+		{"malformed", `{"url":}`, http.StatusBadRequest, "Malformed JSON at position"},
+		{"truncated", `{"url":"https://you`, http.StatusBadRequest, "ended unexpectedly"},
+		{"empty", ``, http.StatusBadRequest, "empty"},
+		{"wrong type", `{"url":42}`, http.StatusBadRequest, `Field "url" must be of type string`},
+		{"trailing data", `{"url":"a"} {"url":"b"}`, http.StatusBadRequest, "single JSON object"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/extract", strings.NewReader(tt.body))
+			var v request
+			bodyErr := DecodeJSONBody(httptest.NewRecorder(), req, &v, 64)
+			if tt.wantStatus == 0 {
+				if bodyErr != nil {
+					t.Fatalf("DecodeJSONBody = %v", bodyErr)
+				}
+				if v.URL != "https://youtu.be/x" || v.Format != "mp3" {
+					t.Errorf("decoded %+v", v)
+				}
+				return
+			}
+			if bodyErr == nil {
+				t.Fatalf("DecodeJSONBody accepted %q", tt.body)
+			}
+			if bodyErr.Status != tt.wantStatus || !strings.Contains(bodyErr.Msg, tt.wantMsg) {
+				t.Errorf("DecodeJSONBody = %d %q, want %d containing %q", bodyErr.Status, bodyErr.Msg, tt.wantStatus, tt.wantMsg)
+			}
+		})
+	}
+}
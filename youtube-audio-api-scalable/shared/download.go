@@ -0,0 +1,85 @@
+// shared/download.go
+package shared
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Query parameters of a signed download link
+const (
+	DownloadTokenParam   = "token"
+	DownloadExpiresParam = "expires" // Unix seconds
+)
+
+var (
+	// ErrDownloadTokenInvalid is returned by VerifyDownloadToken for a missing or tampered token
+	ErrDownloadTokenInvalid = errors.New("invalid download token")
+	// ErrDownloadTokenExpired is returned by VerifyDownloadToken once the link's expiry has passed
+	ErrDownloadTokenExpired = errors.New("download link expired")
+)
+
+// SignDownload returns the token that lets jobID be downloaded until expires
+func SignDownload(secret, jobID string, expires time.Time) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s\n%d", jobID, expires.Unix())
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// DownloadPath returns the gateway path that downloads jobID. With a secret the
+// path carries a token valid for ttl; without one it is the bare job ID link.
+func DownloadPath(secret, jobID string, ttl time.Duration) string {
+	return ArtifactDownloadPath(secret, jobID, "", ttl)
+}
+
+// ArtifactDownloadPath is DownloadPath for one of jobID's artifacts; an empty
+// artifact means the audio. A token covers all of a job's artifacts.
+func ArtifactDownloadPath(secret, jobID string, artifact ArtifactType, ttl time.Duration) string {
+	path := "/download/" + url.PathEscape(jobID)
+	if artifact != "" {
+		path += "/" + url.PathEscape(string(artifact))
+	}
+	return withDownloadToken(path, secret, jobID, ttl)
+}
+
+// ThumbnailPath is DownloadPath for the /thumbnail/{job_id} route
+func ThumbnailPath(secret, jobID string, ttl time.Duration) string {
+	return withDownloadToken("/thumbnail/"+url.PathEscape(jobID), secret, jobID, ttl)
+}
+
+// withDownloadToken appends a token for jobID, valid for ttl, to path when
+// secret is set
+func withDownloadToken(path, secret, jobID string, ttl time.Duration) string {
+	if secret == "" {
+		return path
+	}
+	expires := time.Now().Add(ttl)
+	q := url.Values{}
+	q.Set(DownloadTokenParam, SignDownload(secret, jobID, expires))
+	q.Set(DownloadExpiresParam, strconv.FormatInt(expires.Unix(), 10))
+	return path + "?" + q.Encode()
+}
+
+// VerifyDownloadToken checks the token and expires parameters of a download
+// request for jobID against secret
+func VerifyDownloadToken(secret, jobID string, query url.Values, now time.Time) error {
+	token := query.Get(DownloadTokenParam)
+	unix, err := strconv.ParseInt(query.Get(DownloadExpiresParam), 10, 64)
+	if token == "" || err != nil {
+		return ErrDownloadTokenInvalid
+	}
+	expires := time.Unix(unix, 0)
+	if !hmac.Equal([]byte(token), []byte(SignDownload(secret, jobID, expires))) {
+		return ErrDownloadTokenInvalid
+	}
+	if !now.Before(expires) {
+		return ErrDownloadTokenExpired
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package shared
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyDownloadToken(t *testing.T) {
+	const secret = "s3cret"
+	now := time.Now()
+	expires := now.Add(time.Hour)
+	valid := url.Values{
+		DownloadTokenParam:   {SignDownload(secret, "job-1", expires)},
+		DownloadExpiresParam: {strconv.FormatInt(expires.Unix(), 10)},
+	}
+	with := func(key, value string) url.Values {
+		q := url.Values{}
+		for k, v := range valid {
+			q[k] = v
+		}
+		q.Set(key, value)
+		return q
+	}
+	token := valid.Get(DownloadTokenParam)
+	flipped := "0"
+	if token[0] == '0' {
+		flipped = "1"
+	}
+
+	tests := []struct {
+		name    string
+		jobID   string
+		query   url.Values
+		now     time.Time
+		wantErr error
+	}{
+		{"valid", "job-1", valid, now, nil},
+		{"expired", "job-1", valid, expires, ErrDownloadTokenExpired},
+		{"tampered token", "job-1", with(DownloadTokenParam, flipped+token[1:]), now, ErrDownloadTokenInvalid},
+		{"extended expiry", "job-1", with(DownloadExpiresParam, strconv.FormatInt(expires.Add(time.Hour).Unix(), 10)), now, ErrDownloadTokenInvalid},
+		{"other job", "job-2", valid, now, ErrDownloadTokenInvalid},
+		{"missing token", "job-1", with(DownloadTokenParam, ""), now, ErrDownloadTokenInvalid},
+		{"bad expiry", "job-1", with(DownloadExpiresParam, "soon"), now, ErrDownloadTokenInvalid},
+	}
+	for _, tt := range tests {
+		err := VerifyDownloadToken(secret, tt.jobID, tt.query, tt.now)
+		if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+			t.Errorf("%s: VerifyDownloadToken = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+	if err := VerifyDownloadToken("other secret", "job-1", valid, now); !errors.Is(err, ErrDownloadTokenInvalid) {
+		t.Errorf("another secret: VerifyDownloadToken = %v", err)
+	}
+}
+
+func TestDownloadPath(t *testing.T) {
+	if p := DownloadPath("", "job-1", time.Hour); p != "/download/job-1" {
+		t.Errorf("unsigned path = %q", p)
+	}
+	p := DownloadPath("s3cret", "job-1", time.Hour)
+	path, rawQuery, _ := strings.Cut(p, "?")
+	q, _ := url.ParseQuery(rawQuery)
+	if path != "/download/job-1" || VerifyDownloadToken("s3cret", "job-1", q, time.Now()) != nil {
+		t.Errorf("signed path %q doesn't verify", p)
+	}
+	if VerifyDownloadToken("s3cret", "job-1", q, time.Now().Add(time.Hour+time.Second)) == nil {
+		t.Errorf("signed path %q outlives its ttl", p)
+	}
+}
+
+func TestThumbnailPath(t *testing.T) {
+	if p := ThumbnailPath("", "job-1", time.Hour); p != "/thumbnail/job-1" {
+		t.Errorf("unsigned path = %q", p)
+	}
+	p := ThumbnailPath("s3cret", "job-1", time.Hour)
+	path, rawQuery, _ := strings.Cut(p, "?")
+	q, _ := url.ParseQuery(rawQuery)
+	if path != "/thumbnail/job-1" || VerifyDownloadToken("s3cret", "job-1", q, time.Now()) != nil {
+		t.Errorf("signed path %q doesn't verify", p)
+	}
+}
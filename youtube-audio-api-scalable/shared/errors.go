@@ -0,0 +1,59 @@
+// shared/errors.go
+package shared
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Error codes sent in the "code" field of error responses. Clients may match
+// on them, so existing codes must not change.
+const (
+	ErrCodeInvalidRequest     = "invalid_request"     // Malformed body or invalid parameter
+	ErrCodeValidationFailed   = "validation_failed"   // Body fields are invalid; details.fields lists each
+	ErrCodeInvalidURL         = "invalid_url"         // Missing, malformed or disallowed video URL
+	ErrCodeBodyTooLarge       = "body_too_large"      // Request body over MaxJSONBodySize
+	ErrCodeMethodNotAllowed   = "method_not_allowed"  // HTTP method not supported by the endpoint
+	ErrCodeUnauthorized       = "unauthorized"        // Missing or invalid credentials
+	ErrCodeForbidden          = "forbidden"           // Credentials lack access to the option
+	ErrCodeNotFound           = "not_found"           // Unknown job, key or resource
+	ErrCodeConflict           = "conflict"            // Job is in the wrong state for the request
+	ErrCodeRateLimited        = "rate_limited"        // Per-IP request limit reached
+	ErrCodeQuotaExceeded      = "quota_exceeded"      // API key daily quota used up
+	ErrCodeTooManyJobs        = "too_many_jobs"       // Client already has MaxActiveJobsPerIP jobs running
+	ErrCodeQueueFull          = "queue_full"          // More than MaxQueueDepth jobs are waiting; retry later
+	ErrCodeUnprocessable      = "unprocessable"       // Valid request with nothing to process
+	ErrCodeUpstream           = "upstream_error"      // yt-dlp or another dependency failed
+	ErrCodeUnavailable        = "unavailable"         // Feature not configured on this server
+	ErrCodeStorageUnavailable = "storage_unavailable" // Job store or queue unreachable for now; retry later
+	ErrCodeInternal           = "internal_error"      // Anything else that went wrong server-side
+)
+
+// ErrorResponse is the body of every error response:
+// {"error": {"code": "...", "message": "..."}}
+type ErrorResponse struct {
+	Error ErrorDetail `json:"error"`
+}
+
+// ErrorDetail describes one error. Details carries extra machine-readable
+// fields, such as retry_after for rate limiting.
+type ErrorDetail struct {
+	Code    string         `json:"code"`
+	Message string         `json:"message"`
+	Details map[string]any `json:"details,omitempty"`
+}
+
+// WriteError writes an error response with status, a stable code and a human-readable message
+func WriteError(w http.ResponseWriter, status int, code, message string) {
+	WriteErrorDetails(w, status, code, message, nil)
+}
+
+// WriteErrorDetails is WriteError with extra fields under "details"
+func WriteErrorDetails(w http.ResponseWriter, status int, code, message string, details map[string]any) {
+	h := w.Header()
+	h.Del("Content-Length")
+	h.Set("Content-Type", "application/json")
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorResponse{Error: ErrorDetail{Code: code, Message: message, Details: details}})
+}
@@ -0,0 +1,46 @@
+package shared
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWriteErrorEnvelope(t *testing.T) {
+	rec := httptest.NewRecorder()
+	rec.Header().Set("Content-Length", "123") // Left over from a response that was abandoned
+	WriteErrorDetails(rec, http.StatusTooManyRequests, ErrCodeRateLimited, "Slow down", map[string]any{"retry_after": 30})
+
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("status %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if rec.Header().Get("Content-Length") != "" {
+		t.Error("a stale Content-Length was kept")
+	}
+	var body map[string]map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("body %q: %v", rec.Body, err)
+	}
+	e, ok := body["error"]
+	if len(body) != 1 || !ok {
+		t.Fatalf("body %v, want only an error object", body)
+	}
+	if e["code"] != ErrCodeRateLimited || e["message"] != "Slow down" {
+		t.Errorf("error %v", e)
+	}
+	if details, _ := e["details"].(map[string]any); details["retry_after"] != float64(30) {
+		t.Errorf("details %v", e["details"])
+	}
+
+	rec = httptest.NewRecorder()
+	WriteError(rec, http.StatusNotFound, ErrCodeNotFound, "Job not found")
+	var plain map[string]map[string]any
+	json.Unmarshal(rec.Body.Bytes(), &plain)
+	if _, ok := plain["error"]["details"]; ok || len(plain["error"]) != 2 {
+		t.Errorf("error without details = %v", plain["error"])
+	}
+}
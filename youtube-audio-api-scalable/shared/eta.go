@@ -0,0 +1,17 @@
+// shared/eta.go
+package shared
+
+import "time"
+
+// EstimateWait returns roughly how long a newly queued job waits before it
+// finishes: the jobs ahead of it spread over the workers, times the average
+// processing time. The job itself is counted as part of the queue.
+func EstimateWait(queueDepth int64, workers int, avg time.Duration) time.Duration {
+	if workers <= 0 {
+		workers = 1
+	}
+	if queueDepth < 0 {
+		queueDepth = 0
+	}
+	return time.Duration(float64(queueDepth) / float64(workers) * float64(avg))
+}
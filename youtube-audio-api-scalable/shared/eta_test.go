@@ -0,0 +1,54 @@
+package shared
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestEstimateWait(t *testing.T) {
+	tests := []struct {
+		depth   int64
+		workers int
+		avg     time.Duration
+		want    time.Duration
+	}{
+		{0, 3, 30 * time.Second, 0},
+		{1, 1, 30 * time.Second, 30 * time.Second},
+		{6, 3, 30 * time.Second, time.Minute},
+		{5, 2, 10 * time.Second, 25 * time.Second},
+		{4, 0, 10 * time.Second, 40 * time.Second}, // Unknown worker count counts as one
+		{-2, 3, 10 * time.Second, 0},
+	}
+	for _, tt := range tests {
+		if got := EstimateWait(tt.depth, tt.workers, tt.avg); got != tt.want {
+			t.Errorf("EstimateWait(%d, %d, %s) = %s, want %s", tt.depth, tt.workers, tt.avg, got, tt.want)
+		}
+	}
+}
+
+func TestAverageProcessingTime(t *testing.T) {
+	for name, db := range testDatabases(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			if _, ok, err := db.AverageProcessingTime(ctx); err != nil || ok {
+				t.Fatalf("empty sample: ok %v, err %v", ok, err)
+			}
+			for _, d := range []time.Duration{10 * time.Second, 20 * time.Second, 30 * time.Second} {
+				if err := db.RecordProcessingTime(ctx, d); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if avg, ok, err := db.AverageProcessingTime(ctx); err != nil || !ok || avg != 20*time.Second {
+				t.Errorf("AverageProcessingTime = %s, %v, %v; want 20s", avg, ok, err)
+			}
+			// Only the newest ProcessingTimeSamples count
+			for i := 0; i < ProcessingTimeSamples; i++ {
+				db.RecordProcessingTime(ctx, 4*time.Second)
+			}
+			if avg, _, _ := db.AverageProcessingTime(ctx); avg != 4*time.Second {
+				t.Errorf("average %s after the sample rolled over, want 4s", avg)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+// shared/failure.go
+package shared
+
+import (
+	"errors"
+	"strings"
+)
+
+// FailureReason classifies why a job failed, for clients that need more than
+// the freeform Job.Error
+type FailureReason string
+
+const (
+	FailureURLInvalid       FailureReason = "url_invalid"       // yt-dlp doesn't recognise the URL
+	FailureExtractFailed    FailureReason = "extract_failed"    // yt-dlp couldn't get a usable stream
+	FailureVideoUnavailable FailureReason = "video_unavailable" // Private, removed, region-locked, live...
+	FailureTooLong          FailureReason = "too_long"          // Over the duration or output size limit
+	FailureConvertFailed    FailureReason = "convert_failed"    // ffmpeg or storing the output failed
+	FailureTimeout          FailureReason = "timeout"           // A command or the job's time budget ran out
+	FailureCancelled        FailureReason = "cancelled"
+)
+
+// ytDlpFailurePatterns maps lower-cased fragments of yt-dlp's error output to
+// a reason; the first match wins
+var ytDlpFailurePatterns = []struct {
+	fragment string
+	reason   FailureReason
+}{
+	{"unsupported url", FailureURLInvalid},
+	{"is not a valid url", FailureURLInvalid},
+	{"incomplete youtube id", FailureURLInvalid},
+	{"video unavailable", FailureVideoUnavailable},
+	{"private video", FailureVideoUnavailable},
+	{"this video has been removed", FailureVideoUnavailable},
+	{"this video is not available", FailureVideoUnavailable},
+	{"not made this video available in your country", FailureVideoUnavailable},
+	{"members-only", FailureVideoUnavailable},
+	{"join this channel", FailureVideoUnavailable},
+	{"sign in to confirm your age", FailureVideoUnavailable},
+	{"account associated with this video has been terminated", FailureVideoUnavailable},
+	{"premieres in", FailureVideoUnavailable},
+	{"this live event will begin", FailureVideoUnavailable},
+	{"timed out", FailureTimeout},
+}
+
+// ClassifyYtDlpError returns the FailureReason for an error from running
+// yt-dlp, judged by the sentinel it wraps or else by yt-dlp's output in its
+// message. Anything unrecognised is FailureExtractFailed.
+func ClassifyYtDlpError(err error) FailureReason {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, ErrLiveStream):
+		return FailureVideoUnavailable
+	case errors.Is(err, ErrFormatUnavailable):
+		return FailureExtractFailed
+	}
+	msg := strings.ToLower(err.Error())
+	for _, p := range ytDlpFailurePatterns {
+		if strings.Contains(msg, p.fragment) {
+			return p.reason
+		}
+	}
+	return FailureExtractFailed
+}
@@ -0,0 +1,50 @@
+package shared
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestClassifyYtDlpError(t *testing.T) {
+	tests := []struct {
+		output string
+		want   FailureReason
+	}{
+		{"ERROR: Unsupported URL: https://example.com/watch", FailureURLInvalid},
+		{"ERROR: 'not-a-url' is not a valid URL. Set --default-search", FailureURLInvalid},
+		{"ERROR: [youtube:truncated_id] dQw4w9: Incomplete YouTube ID dQw4w9", FailureURLInvalid},
+		{"ERROR: [youtube] dQw4w9WgXcQ: Video unavailable", FailureVideoUnavailable},
+		{"ERROR: [youtube] dQw4w9WgXcQ: Private video. Sign in if you've been granted access to this video", FailureVideoUnavailable},
+		{"ERROR: [youtube] dQw4w9WgXcQ: Video unavailable. This video has been removed by the uploader", FailureVideoUnavailable},
+		{"ERROR: [youtube] dQw4w9WgXcQ: The uploader has not made this video available in your country", FailureVideoUnavailable},
+		{"ERROR: [youtube] dQw4w9WgXcQ: Join this channel to get access to members-only content like this video", FailureVideoUnavailable},
+		{"ERROR: [youtube] dQw4w9WgXcQ: Sign in to confirm your age. This video may be inappropriate for some users.", FailureVideoUnavailable},
+		{"ERROR: [youtube] dQw4w9WgXcQ: This video is no longer available because the YouTube account associated with this video has been terminated.", FailureVideoUnavailable},
+		{"ERROR: [youtube] dQw4w9WgXcQ: Premieres in 2 hours", FailureVideoUnavailable},
+		{"ERROR: [youtube] dQw4w9WgXcQ: This live event will begin in a few moments.", FailureVideoUnavailable},
+		{"ERROR: [youtube] dQw4w9WgXcQ: Unable to download webpage: The read operation timed out", FailureTimeout},
+		{"ERROR: [youtube] dQw4w9WgXcQ: Unable to download webpage: HTTP Error 429: Too Many Requests", FailureExtractFailed},
+		{"ERROR: [youtube] dQw4w9WgXcQ: Sign in to confirm you're not a bot", FailureExtractFailed},
+		{"", FailureExtractFailed},
+	}
+	for _, tt := range tests {
+		err := fmt.Errorf("yt-dlp failed: exit status 1\nOutput: %s", tt.output)
+		if got := ClassifyYtDlpError(err); got != tt.want {
+			t.Errorf("%q classified as %s, want %s", tt.output, got, tt.want)
+		}
+	}
+
+	if got := ClassifyYtDlpError(nil); got != "" {
+		t.Errorf("nil classified as %q", got)
+	}
+	if got := ClassifyYtDlpError(fmt.Errorf("checking stream: %w", ErrLiveStream)); got != FailureVideoUnavailable {
+		t.Errorf("live stream classified as %s", got)
+	}
+	if got := ClassifyYtDlpError(fmt.Errorf("%w: \"999\"", ErrFormatUnavailable)); got != FailureExtractFailed {
+		t.Errorf("unavailable format classified as %s", got)
+	}
+	if got := ClassifyYtDlpError(errors.New("JSON parse error: unexpected end of JSON input")); got != FailureExtractFailed {
+		t.Errorf("parse error classified as %s", got)
+	}
+}
@@ -0,0 +1,94 @@
+// shared/filename.go
+package shared
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxFilenameRunes caps the length of a download filename, before the extension
+const maxFilenameRunes = 150
+
+// DownloadFilename expands template (Config.FilenameTemplate) for job into the
+// name, without extension, that a download is saved as. Placeholders are
+// {title}, {uploader}, {id}, {video_id}, {format} and {bitrate}; ones the job
+// has no value for expand to nothing, and if nothing usable is left the job ID
+// is used. Clips get their range appended as in OutputFileName.
+func DownloadFilename(template string, job *Job) string {
+	title, uploader := "", ""
+	if job.Metadata != nil {
+		title, uploader = job.Metadata.Title, job.Metadata.Uploader
+	}
+	name := strings.NewReplacer(
+		"{title}", title,
+		"{uploader}", uploader,
+		"{id}", job.ID,
+		"{video_id}", job.VideoID,
+		"{format}", job.Format,
+		"{bitrate}", job.Bitrate,
+	).Replace(template)
+	// Separators around a missing field would be left dangling
+	name = strings.Trim(SanitizeFilename(name), " -_.")
+	if name == "" {
+		name = job.ID
+	}
+	if suffix := ClipSuffix(job.ClipStart, job.ClipEnd); suffix != "" {
+		name += "_" + suffix
+	}
+	return name
+}
+
+// SanitizeFilename strips characters that are unsafe in a Content-Disposition filename
+func SanitizeFilename(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		switch {
+		case c < 0x20 || c == 0x7f:
+			continue
+		case strings.ContainsRune(`"\/:*?<>|;`, c):
+			b.WriteRune('_')
+		default:
+			b.WriteRune(c)
+		}
+	}
+	out := []rune(strings.TrimSpace(b.String()))
+	if len(out) > maxFilenameRunes {
+		out = out[:maxFilenameRunes]
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// ContentDisposition returns an attachment Content-Disposition for filename.
+// Names that aren't plain ASCII also get the RFC 5987 filename* form, with
+// an ASCII approximation in filename for clients that don't support it.
+func ContentDisposition(filename string) string {
+	var ascii strings.Builder
+	plain := true
+	for _, c := range filename {
+		if c >= 0x80 {
+			ascii.WriteRune('_')
+			plain = false
+		} else {
+			ascii.WriteRune(c)
+		}
+	}
+	if plain {
+		return fmt.Sprintf("attachment; filename=\"%s\"", filename)
+	}
+	return fmt.Sprintf("attachment; filename=\"%s\"; filename*=UTF-8''%s", ascii.String(), encodeRFC5987(filename))
+}
+
+// encodeRFC5987 percent-encodes every byte of s outside RFC 5987's attr-char
+func encodeRFC5987(s string) string {
+	const attrChars = "!#$&+-.^_`|~"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.IndexByte(attrChars, c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
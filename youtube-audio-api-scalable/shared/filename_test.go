@@ -0,0 +1,53 @@
+package shared
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDownloadFilename(t *testing.T) {
+	song := &Metadata{Title: "Song", Uploader: "Artist"}
+	tests := []struct {
+		name     string
+		template string
+		job      *Job
+		want     string
+	}{
+		{"title and uploader", "{title} - {uploader}", &Job{ID: "job-1", Metadata: song}, "Song - Artist"},
+		{"every field", "{video_id}_{id}_{format}_{bitrate}", &Job{ID: "job-1", VideoID: "dQw4w9WgXcQ", Format: "mp3", Bitrate: "192k"}, "dQw4w9WgXcQ_job-1_mp3_192k"},
+		{"path separators", "{title}", &Job{ID: "job-1", Metadata: &Metadata{Title: `AC/DC: Back in Black? "Live" <1980> \ a|b;c*`}}, `AC_DC_ Back in Black_ _Live_ _1980_ _ a_b_c`},
+		{"control characters", "{title}", &Job{ID: "job-1", Metadata: &Metadata{Title: "Line\r\nBreak\x00\x7f"}}, "LineBreak"},
+		{"unicode kept", "{title}", &Job{ID: "job-1", Metadata: &Metadata{Title: "Sigur Rós – Hoppípolla 🎵"}}, "Sigur Rós – Hoppípolla 🎵"},
+		{"missing uploader", "{title} - {uploader}", &Job{ID: "job-1", Metadata: &Metadata{Title: "Song"}}, "Song"},
+		{"missing title", "{title} - {uploader}", &Job{ID: "job-1", Metadata: &Metadata{Uploader: "Artist"}}, "Artist"},
+		{"no metadata", "{title} - {uploader}", &Job{ID: "job-1"}, "job-1"},
+		{"only unsafe characters", "{title}", &Job{ID: "job-1", Metadata: &Metadata{Title: "\x01\x02"}}, "job-1"},
+		{"clip", "{title}", &Job{ID: "job-1", Metadata: song, ClipStart: 10, ClipEnd: 20}, "Song_" + ClipSuffix(10, 20)},
+	}
+	for _, tt := range tests {
+		if got := DownloadFilename(tt.template, tt.job); got != tt.want {
+			t.Errorf("%s: DownloadFilename(%q) = %q, want %q", tt.name, tt.template, got, tt.want)
+		}
+	}
+
+	long := DownloadFilename("{title}", &Job{ID: "job-1", Metadata: &Metadata{Title: strings.Repeat("é", 400)}})
+	if n := len([]rune(long)); n != maxFilenameRunes {
+		t.Errorf("long title gave %d runes, want %d", n, maxFilenameRunes)
+	}
+}
+
+func TestContentDisposition(t *testing.T) {
+	tests := []struct {
+		filename string
+		want     string
+	}{
+		{"Song - Artist.mp3", `attachment; filename="Song - Artist.mp3"`},
+		{"Hoppípolla.mp3", `attachment; filename="Hopp_polla.mp3"; filename*=UTF-8''Hopp%C3%ADpolla.mp3`},
+		{"🎵 (live).opus", `attachment; filename="_ (live).opus"; filename*=UTF-8''%F0%9F%8E%B5%20%28live%29.opus`},
+	}
+	for _, tt := range tests {
+		if got := ContentDisposition(tt.filename); got != tt.want {
+			t.Errorf("ContentDisposition(%q) = %s, want %s", tt.filename, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+// shared/format.go
+package shared
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultOutputFormat = "mp3"
+	DefaultBitrate      = "192k"
+)
+
+// AudioFormat describes how ffmpeg produces one output format
+type AudioFormat struct {
+	Ext         string // File extension, without the dot
+	ContentType string // MIME type used when serving the file
+	Codec       string // ffmpeg -c:a value
+	Muxer       string // ffmpeg -f value
+	SampleRate  string // Default ffmpeg -ar value
+	Lossless    bool   // Lossless formats ignore the requested bitrate
+	// SampleRates restricts the sample rates a client may request, for
+	// encoders that support fewer than AllowedSampleRates
+	SampleRates []int
+}
+
+// AudioFormats lists the output formats a client may request
+var AudioFormats = map[string]AudioFormat{
+	"mp3":  {Ext: "mp3", ContentType: "audio/mpeg", Codec: "libmp3lame", Muxer: "mp3", SampleRate: "44100"},
+	"opus": {Ext: "opus", ContentType: "audio/ogg", Codec: "libopus", Muxer: "opus", SampleRate: "48000", SampleRates: []int{8000, 16000, 24000, 48000}},
+	"m4a":  {Ext: "m4a", ContentType: "audio/mp4", Codec: "aac", Muxer: "ipod", SampleRate: "44100"},
+	"flac": {Ext: "flac", ContentType: "audio/flac", Codec: "flac", Muxer: "flac", SampleRate: "44100", Lossless: true},
+	"wav":  {Ext: "wav", ContentType: "audio/wav", Codec: "pcm_s16le", Muxer: "wav", SampleRate: "44100", Lossless: true},
+}
+
+// AllowedBitrates lists the bitrates a client may request for lossy formats
+var AllowedBitrates = []string{"64k", "96k", "128k", "160k", "192k", "256k", "320k"}
+
+// AllowedSampleRates lists the sample rates in Hz a client may request
+var AllowedSampleRates = []int{8000, 16000, 22050, 24000, 32000, 44100, 48000}
+
+// ChannelLayouts maps the channel layouts a client may request to ffmpeg's -ac value
+var ChannelLayouts = map[string]string{
+	"mono":   "1",
+	"stereo": "2",
+}
+
+// ValidateOutputFormat normalizes a requested format and bitrate, applying
+// defaults for empty values. Lossless formats always get an empty bitrate.
+func ValidateOutputFormat(format, bitrate string) (string, string, error) {
+	format = strings.ToLower(strings.TrimSpace(format))
+	if format == "" {
+		format = DefaultOutputFormat
+	}
+	af, ok := AudioFormats[format]
+	if !ok {
+		return "", "", fmt.Errorf("unsupported format %q", format)
+	}
+	if af.Lossless {
+		return format, "", nil
+	}
+	bitrate = strings.ToLower(strings.TrimSpace(bitrate))
+	if bitrate == "" {
+		return format, DefaultBitrate, nil
+	}
+	for _, b := range AllowedBitrates {
+		if b == bitrate {
+			return format, bitrate, nil
+		}
+	}
+	return "", "", fmt.Errorf("unsupported bitrate %q (allowed: %s)", bitrate, strings.Join(AllowedBitrates, ", "))
+}
+
+// ValidateAudioLayout checks a requested sample rate and channel layout for
+// an already validated format. Zero and empty mean the format's defaults, and
+// a sample rate equal to the default is returned as 0 so such requests can
+// share cached results.
+func ValidateAudioLayout(format string, sampleRate int, channels string) (int, string, error) {
+	af := AudioFormats[format]
+	allowed := AllowedSampleRates
+	if af.SampleRates != nil {
+		allowed = af.SampleRates
+	}
+	if sampleRate != 0 {
+		if !slices.Contains(allowed, sampleRate) {
+			names := make([]string, len(allowed))
+			for i, r := range allowed {
+				names[i] = strconv.Itoa(r)
+			}
+			return 0, "", fmt.Errorf("unsupported sample_rate %d for %s (allowed: %s)", sampleRate, format, strings.Join(names, ", "))
+		}
+		if strconv.Itoa(sampleRate) == af.SampleRate {
+			sampleRate = 0
+		}
+	}
+	channels = strings.ToLower(strings.TrimSpace(channels))
+	if _, ok := ChannelLayouts[channels]; channels != "" && !ok {
+		return 0, "", fmt.Errorf("unsupported channels %q (use mono or stereo)", channels)
+	}
+	return sampleRate, channels, nil
+}
+
+// FormatForExt returns the AudioFormat for a stored extension, defaulting to MP3
+func FormatForExt(ext string) AudioFormat {
+	if af, ok := AudioFormats[ext]; ok {
+		return af
+	}
+	return AudioFormats[DefaultOutputFormat]
+}
@@ -0,0 +1,84 @@
+// shared/format_test.go
+package shared
+
+import "testing"
+
+func TestValidateOutputFormat(t *testing.T) {
+	tests := []struct {
+		format, bitrate         string
+		wantFormat, wantBitrate string
+		ok                      bool
+	}{
+		{"", "", "mp3", DefaultBitrate, true},
+		{"mp3", "320k", "mp3", "320k", true},
+		{" MP3 ", "128K", "mp3", "128k", true},
+		{"opus", "", "opus", DefaultBitrate, true},
+		{"opus", "96k", "opus", "96k", true},
+		{"m4a", "256k", "m4a", "256k", true},
+		{"flac", "", "flac", "", true},
+		{"flac", "320k", "flac", "", true}, // Lossless ignores the bitrate
+		{"wav", "", "wav", "", true},
+		{"ogg", "", "", "", false},
+		{"mp4", "", "", "", false},
+		{"mp3", "1000k", "", "", false},
+		{"mp3", "192", "", "", false},
+	}
+	for _, tt := range tests {
+		format, bitrate, err := ValidateOutputFormat(tt.format, tt.bitrate)
+		if (err == nil) != tt.ok {
+			t.Errorf("ValidateOutputFormat(%q, %q) error = %v, want ok %v", tt.format, tt.bitrate, err, tt.ok)
+			continue
+		}
+		if format != tt.wantFormat || bitrate != tt.wantBitrate {
+			t.Errorf("ValidateOutputFormat(%q, %q) = %q, %q; want %q, %q",
+				tt.format, tt.bitrate, format, bitrate, tt.wantFormat, tt.wantBitrate)
+		}
+	}
+}
+
+func TestFormatForExt(t *testing.T) {
+	for name, af := range AudioFormats {
+		if got := FormatForExt(af.Ext); got.Ext != af.Ext {
+			t.Errorf("FormatForExt(%q) = %q", af.Ext, got.Ext)
+		}
+		if af.Codec == "" || af.Muxer == "" || af.ContentType == "" || af.SampleRate == "" {
+			t.Errorf("format %s is missing ffmpeg settings: %+v", name, af)
+		}
+	}
+	if got := FormatForExt(""); got.Ext != "mp3" {
+		t.Errorf("FormatForExt(\"\") = %q, want the mp3 default for old jobs", got.Ext)
+	}
+}
+
+func TestValidateAudioLayout(t *testing.T) {
+	tests := []struct {
+		format       string
+		sampleRate   int
+		channels     string
+		wantRate     int
+		wantChannels string
+		ok           bool
+	}{
+		{"mp3", 0, "", 0, "", true},
+		{"mp3", 22050, "mono", 22050, "mono", true},
+		{"mp3", 48000, " Stereo ", 48000, "stereo", true},
+		{"mp3", 44100, "", 0, "", true}, // The default, so results can be shared
+		{"opus", 16000, "mono", 16000, "mono", true},
+		{"opus", 48000, "", 0, "", true},
+		{"opus", 22050, "", 0, "", false}, // Not an Opus rate
+		{"mp3", 12345, "", 0, "", false},
+		{"mp3", -1, "", 0, "", false},
+		{"mp3", 0, "5.1", 0, "", false},
+		{"wav", 8000, "surround", 0, "", false},
+	}
+	for _, tt := range tests {
+		rate, channels, err := ValidateAudioLayout(tt.format, tt.sampleRate, tt.channels)
+		if (err == nil) != tt.ok {
+			t.Errorf("ValidateAudioLayout(%q, %d, %q) error = %v, want ok %v", tt.format, tt.sampleRate, tt.channels, err, tt.ok)
+			continue
+		}
+		if tt.ok && (rate != tt.wantRate || channels != tt.wantChannels) {
+			t.Errorf("ValidateAudioLayout(%q, %d, %q) = %d, %q; want %d, %q", tt.format, tt.sampleRate, tt.channels, rate, channels, tt.wantRate, tt.wantChannels)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+// shared/health.go
+package shared
+
+import "context"
+
+// HealthCheck is the result of checking one dependency
+type HealthCheck struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// RunHealthChecks runs each named check and reports whether all of them passed
+func RunHealthChecks(ctx context.Context, checks map[string]func(context.Context) error) (map[string]HealthCheck, bool) {
+	results := make(map[string]HealthCheck, len(checks))
+	healthy := true
+	for name, check := range checks {
+		if err := check(ctx); err != nil {
+			results[name] = HealthCheck{OK: false, Error: err.Error()}
+			healthy = false
+			continue
+		}
+		results[name] = HealthCheck{OK: true}
+	}
+	return results, healthy
+}
@@ -2,21 +2,72 @@
 package shared
 
 import (
+	"fmt"
+	"strings"
 	"time"
 )
 
 // Metadata structure for response
 type Metadata struct {
-	Title    string  `json:"title"`
-	Uploader string  `json:"uploader"`
-	Duration float64 `json:"duration"`
-	AudioURL string  `json:"audio_url"` // Direct audio stream URL from yt-dlp
-	Ext      string  `json:"ext"`
-	Abr      int     `json:"abr"`
+	Title     string  `json:"title"`
+	Uploader  string  `json:"uploader"`
+	Duration  float64 `json:"duration"`
+	AudioURL  string  `json:"audio_url"` // Direct audio stream URL from yt-dlp
+	Ext       string  `json:"ext"`
+	Abr       int     `json:"abr"`
+	Thumbnail string  `json:"thumbnail,omitempty"`
+	// LiveStatus is yt-dlp's live_status: not_live, is_live, is_upcoming, was_live or post_live
+	LiveStatus string `json:"live_status,omitempty"`
+	// Formats lists the streams with audio, as used for FormatID; only set by
+	// the gateway's metadata lookups, never on jobs
+	Formats []StreamFormat `json:"formats,omitempty"`
+}
+
+// StreamFormat is one stream a video offers that carries audio
+type StreamFormat struct {
+	FormatID  string  `json:"format_id"`
+	Ext       string  `json:"ext"`
+	Codec     string  `json:"codec"`
+	Abr       float64 `json:"abr,omitempty"`      // Audio bitrate in kbit/s, when known
+	Filesize  int64   `json:"filesize,omitempty"` // Bytes, exact or estimated; 0 when unknown
+	AudioOnly bool    `json:"audio_only"`         // False for streams that also carry video
 }
 
 type Request struct {
-	URL string `json:"url"`
+	URL     string `json:"url"`
+	Format  string `json:"format,omitempty"`  // Output format: mp3 (default), opus, m4a, flac, wav
+	Bitrate string `json:"bitrate,omitempty"` // Output bitrate for lossy formats, e.g. 128k
+	// CallbackURL, if set, receives a POST with the job JSON when the job finishes
+	CallbackURL string `json:"callback_url,omitempty"`
+	// EmbedTags writes title, artist and source URL tags into the file; defaults to Config.EmbedTags
+	EmbedTags *bool `json:"embed_tags,omitempty"`
+	// StartTime and EndTime cut a clip, as seconds or HH:MM:SS; both are optional
+	StartTime string `json:"start_time,omitempty"`
+	EndTime   string `json:"end_time,omitempty"`
+	// Normalize evens out loudness with ffmpeg's loudnorm filter
+	Normalize bool `json:"normalize,omitempty"`
+	// SampleRate in Hz (e.g. 22050) and Channels (mono or stereo) override the
+	// format's defaults; mono 22050 suits speech and keeps files small
+	SampleRate int    `json:"sample_rate,omitempty"`
+	Channels   string `json:"channels,omitempty"`
+	// Cookies is a base64-encoded Netscape cookies.txt used instead of the
+	// configured one, for age-restricted or members-only videos
+	Cookies string `json:"cookies,omitempty"`
+	// Priority is low, normal (default) or high; high requires an API key
+	Priority string `json:"priority,omitempty"`
+	// FormatID picks the yt-dlp stream to convert (as listed by yt-dlp -F)
+	// instead of the best audio-only one
+	FormatID string `json:"format_id,omitempty"`
+	// WithSubtitles also saves the video's captions, when it has any, as a
+	// subtitles artifact
+	WithSubtitles bool `json:"with_subtitles,omitempty"`
+	// ClientMetadata is the caller's own data, e.g. a user or order ID, stored
+	// with the job and returned in its status and callbacks. It never affects
+	// processing.
+	ClientMetadata map[string]string `json:"client_metadata,omitempty"`
+	// DryRun only checks that the video would be accepted; no job is created.
+	// Also settable with ?dry_run=true.
+	DryRun bool `json:"dry_run,omitempty"`
 }
 
 type JobStatus string
@@ -26,18 +77,118 @@ const (
 	JobStatusProcessing JobStatus = "processing"
 	JobStatusCompleted  JobStatus = "completed"
 	JobStatusFailed     JobStatus = "failed"
+	JobStatusCancelled  JobStatus = "cancelled"
+	// JobStatusPartial is used by playlist jobs where some children completed and others did not
+	JobStatusPartial JobStatus = "partial"
+	// JobStatusDeleted marks a job soft-deleted by an admin: its files are gone
+	// but the record is kept for auditing until the reaper purges it
+	JobStatusDeleted JobStatus = "deleted"
 )
 
+// JobStatuses lists every job status
+var JobStatuses = []JobStatus{
+	JobStatusPending, JobStatusProcessing, JobStatusCompleted,
+	JobStatusFailed, JobStatusCancelled, JobStatusPartial, JobStatusDeleted,
+}
+
+// ParseJobStatus validates a status name, e.g. from a query parameter
+func ParseJobStatus(s string) (JobStatus, error) {
+	switch st := JobStatus(strings.ToLower(strings.TrimSpace(s))); st {
+	case JobStatusPending, JobStatusProcessing, JobStatusCompleted, JobStatusFailed, JobStatusCancelled, JobStatusPartial, JobStatusDeleted:
+		return st, nil
+	}
+	return "", fmt.Errorf("unknown job status %q", s)
+}
+
+// IsClip reports whether the job converts only part of the video
+func (j *Job) IsClip() bool {
+	return j.ClipStart > 0 || j.ClipEnd > 0
+}
+
+// Cacheable reports whether the job's output is a plain full conversion that
+// can be reused for other requests for the same video and format
+func (j *Job) Cacheable() bool {
+	return !j.IsClip() && !j.Normalize && j.SampleRate == 0 && j.Channels == "" && j.FormatID == ""
+}
+
+// IsPlaylist reports whether the job is a playlist parent whose work is done by child jobs
+func (j *Job) IsPlaylist() bool {
+	return len(j.ChildIDs) > 0
+}
+
+// ExpiryAfter returns when a job finished at finishedAt expires, ttl later,
+// or nil when ttl is 0 and finished jobs are kept forever
+func ExpiryAfter(finishedAt time.Time, ttl time.Duration) *time.Time {
+	if ttl <= 0 {
+		return nil
+	}
+	expiresAt := finishedAt.Add(ttl)
+	return &expiresAt
+}
+
+// FetchURL returns the URL the worker downloads the job's video from
+func (j *Job) FetchURL() string {
+	if j.CanonicalURL != "" {
+		return j.CanonicalURL
+	}
+	return j.OriginalURL
+}
+
+// IsTerminal reports whether no further work will happen for a job in this status
+func (s JobStatus) IsTerminal() bool {
+	return s == JobStatusCompleted || s == JobStatusFailed || s == JobStatusCancelled || s == JobStatusPartial ||
+		s == JobStatusDeleted
+}
+
 // Job represents the state of an audio extraction and conversion task
 type Job struct {
-	ID               string     `json:"job_id"`
-	OriginalURL      string     `json:"original_url"` // The YouTube URL submitted by the user
-	Status           JobStatus  `json:"status"`
-	Metadata         *Metadata  `json:"metadata,omitempty"`
-	DownloadEndpoint string     `json:"download_endpoint,omitempty"` // URL to the converted MP3
-	Error            string     `json:"error,omitempty"`
-	CreatedAt        time.Time  `json:"created_at"`
-	StartedAt        *time.Time `json:"started_at,omitempty"`
-	CompletedAt      *time.Time `json:"completed_at,omitempty"`
-	FilePath         string     `json:"-"` // Internal path to the file, not exposed via API
+	ID                string        `json:"job_id"`
+	OriginalURL       string        `json:"original_url"`            // The YouTube URL submitted by the user
+	CanonicalURL      string        `json:"canonical_url,omitempty"` // OriginalURL reduced by CanonicalizeURL; fetched instead when set
+	Status            JobStatus     `json:"status"`
+	Metadata          *Metadata     `json:"metadata,omitempty"`
+	DownloadEndpoint  string        `json:"download_endpoint,omitempty"` // URL to the converted audio, as in Artifacts
+	Error             string        `json:"error,omitempty"`
+	FailureReason     FailureReason `json:"failure_reason,omitempty"` // Set along with Error when the job fails
+	CreatedAt         time.Time     `json:"created_at"`
+	StartedAt         *time.Time    `json:"started_at,omitempty"`
+	CompletedAt       *time.Time    `json:"completed_at,omitempty"`
+	CancelRequestedAt *time.Time    `json:"cancel_requested_at,omitempty"`
+	DeletedAt         *time.Time    `json:"deleted_at,omitempty"` // Set when an admin soft-deletes the job
+	ExpiresAt         *time.Time    `json:"expires_at,omitempty"` // When the reaper removes the job and its files
+	Format            string        `json:"format,omitempty"`
+	Bitrate           string        `json:"bitrate,omitempty"`
+	OutputExt         string        `json:"output_ext,omitempty"`      // Extension of the converted file
+	FileSize          int64         `json:"file_size,omitempty"`       // Size of the converted file in bytes
+	OutputDuration    float64       `json:"output_duration,omitempty"` // Length of the converted file in seconds, as verified by ffprobe
+	VideoID           string        `json:"video_id,omitempty"`        // Normalized YouTube video ID, used for result caching
+	CallbackURL       string        `json:"callback_url,omitempty"`
+	CallbackStatus    int           `json:"callback_status,omitempty"` // HTTP status of the last delivery attempt
+	CallbackError     string        `json:"callback_error,omitempty"`  // Set when the callback couldn't be delivered
+	Progress          int           `json:"progress"`                  // Conversion progress, 0-100
+	Attempts          int           `json:"attempts,omitempty"`        // Failed processing attempts so far
+	ClipStart         float64       `json:"clip_start,omitempty"`      // Clip range in seconds; 0 end means to the end
+	ClipEnd           float64       `json:"clip_end,omitempty"`
+	Normalize         bool          `json:"normalize,omitempty"`
+	SampleRate        int           `json:"sample_rate,omitempty"` // 0 means the format's default
+	Channels          string        `json:"channels,omitempty"`    // Empty keeps the source's channels
+	FormatID          string        `json:"format_id,omitempty"`   // yt-dlp stream converted; empty means bestaudio
+	Extractor         string        `json:"extractor,omitempty"`   // What extracted the stream: yt-dlp or fallback
+	EmbedTags         bool          `json:"embed_tags,omitempty"`  // Whether tags are written into the file
+	WithSubtitles     bool          `json:"with_subtitles,omitempty"`
+	Priority          Priority      `json:"priority,omitempty"`
+	ParentID          string        `json:"parent_id,omitempty"` // Playlist job this job belongs to
+	ChildIDs          []string      `json:"child_ids,omitempty"` // Set on playlist jobs; their status aggregates the children
+	StorageKey        string        `json:"-"`                   // Key of the converted file in Storage; only Postgres keeps it, see AudioKey
+	FilePath          string        `json:"-"`                   // Internal path to the file, not exposed via API; only Postgres keeps it
+	// ThumbnailEndpoint serves the video's thumbnail, when one was saved under
+	// ThumbnailFile (its name in OutputDir and key in Storage)
+	ThumbnailEndpoint string `json:"thumbnail_endpoint,omitempty"`
+	ThumbnailFile     string `json:"thumbnail_file,omitempty"`
+	// Artifacts lists every file the job produced, the audio first. The
+	// single-file fields above still describe the audio and thumbnail for
+	// existing clients.
+	Artifacts []Artifact `json:"artifacts,omitempty"`
+	// ClientMetadata is echoed verbatim from the request
+	ClientMetadata map[string]string `json:"client_metadata,omitempty"`
 }
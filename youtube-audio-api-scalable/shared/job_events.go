@@ -0,0 +1,37 @@
+// shared/job_events.go
+package shared
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// MaxJobEvents caps the history kept per job; the oldest events are dropped first
+const MaxJobEvents = 100
+
+// JobEvent records one status change of a job
+type JobEvent struct {
+	At     time.Time `json:"at"`
+	Status JobStatus `json:"status"`
+	Reason string    `json:"reason,omitempty"`
+	Source string    `json:"source"` // Service that made the change: api-gateway or worker
+}
+
+// RecordJobEvent appends job's current status to its history. History is for
+// auditing only, so a failure to store it is logged rather than returned.
+func RecordJobEvent(ctx context.Context, db DatabaseClient, l *slog.Logger, source string, job *Job, reason string) {
+	event := JobEvent{At: time.Now().UTC(), Status: job.Status, Reason: reason, Source: source}
+	if err := db.AppendJobEvent(ctx, job.ID, event); err != nil {
+		WithJob(l, job.ID).Warn("Failed to record job event", "status", job.Status, "error", err)
+	}
+}
+
+// appendCapped appends event to events, keeping the newest MaxJobEvents
+func appendCapped(events []JobEvent, event JobEvent) []JobEvent {
+	events = append(events, event)
+	if len(events) > MaxJobEvents {
+		events = append([]JobEvent(nil), events[len(events)-MaxJobEvents:]...)
+	}
+	return events
+}
@@ -0,0 +1,89 @@
+// shared/lock.go
+package shared
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	redis "github.com/redis/go-redis/v9"
+)
+
+// Locker hands out named locks so a task runs on only one instance at a time.
+// A lock expires after its ttl even if never released, so a holder that
+// crashes doesn't block the task forever.
+type Locker interface {
+	// TryLock takes name for ttl if it is free. ok is false if another holder
+	// has it; release gives it up early and is safe to call more than once.
+	TryLock(ctx context.Context, name string, ttl time.Duration) (release func(), ok bool, err error)
+}
+
+// NewLocker returns a Redis-backed locker when client is set, in-memory otherwise
+func NewLocker(client *redis.Client) Locker {
+	if client != nil {
+		return &RedisLocker{client: client}
+	}
+	return &InMemoryLocker{held: make(map[string]time.Time)}
+}
+
+// RedisLocker holds each lock as the key lock:<name>, set with NX to a token
+// unique to the holder
+type RedisLocker struct {
+	client *redis.Client
+}
+
+// releaseLockScript deletes a lock only if it still holds the caller's token,
+// so a holder whose lock expired can't release its successor's
+var releaseLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+func (l *RedisLocker) TryLock(ctx context.Context, name string, ttl time.Duration) (func(), bool, error) {
+	key, token := "lock:"+name, uuid.New().String()
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	ok, err := l.client.SetNX(ctx, key, token, ttl).Result()
+	if err != nil || !ok {
+		return func() {}, false, err
+	}
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			releaseLockScript.Run(ctx, l.client, []string{key}, token)
+		})
+	}
+	return release, true, nil
+}
+
+// InMemoryLocker only excludes holders within this process
+type InMemoryLocker struct {
+	mu   sync.Mutex
+	held map[string]time.Time // Name => expiry
+}
+
+func (l *InMemoryLocker) TryLock(ctx context.Context, name string, ttl time.Duration) (func(), bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if expires, ok := l.held[name]; ok && now.Before(expires) {
+		return func() {}, false, nil
+	}
+	expires := now.Add(ttl)
+	l.held[name] = expires
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			if l.held[name].Equal(expires) { // Still ours
+				delete(l.held, name)
+			}
+		})
+	}
+	return release, true, nil
+}
@@ -0,0 +1,54 @@
+// shared/logger.go
+package shared
+
+import (
+	"log"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// NewLogger builds a JSON logger that tags every line with the service name and
+// installs it as the default, so remaining log.Printf calls are emitted as JSON too.
+// Lines carry the fields service, level, msg and, for job-scoped loggers, job_id.
+func NewLogger(service string, level string) *slog.Logger {
+	handler := slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: ParseLogLevel(level)})
+	logger := slog.New(handler).With("service", service)
+	slog.SetDefault(logger)
+	log.SetFlags(0) // slog adds its own timestamp
+	return logger
+}
+
+// ParseLogLevel maps LOG_LEVEL values (debug, info, warn, error) to a slog level, defaulting to info
+func ParseLogLevel(s string) slog.Level {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// WithJob returns l with the job_id correlation field attached
+func WithJob(l *slog.Logger, jobID string) *slog.Logger {
+	return l.With("job_id", jobID)
+}
+
+var (
+	// urlQueryPattern matches http(s) URLs that have a query string, which for
+	// signed stream URLs carries access tokens
+	urlQueryPattern = regexp.MustCompile(`(https?://[^\s?#"'<>]+)\?[^\s"'<>]*`)
+	// urlUserinfoPattern matches credentials in URLs such as proxy settings
+	urlUserinfoPattern = regexp.MustCompile(`([a-z][a-z0-9+.-]*://)[^\s/@"'<>]+@`)
+)
+
+// RedactURLs replaces the query string and any credentials of every URL in s with REDACTED
+func RedactURLs(s string) string {
+	s = urlUserinfoPattern.ReplaceAllString(s, "${1}REDACTED@")
+	return urlQueryPattern.ReplaceAllString(s, "${1}?REDACTED")
+}
@@ -0,0 +1,239 @@
+// shared/metadata_cache.go
+package shared
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	redis "github.com/redis/go-redis/v9"
+)
+
+// maxInMemoryMetadataEntries bounds the in-memory metadata cache
+const maxInMemoryMetadataEntries = 1000
+
+// MetadataCache keeps video metadata fetched by /metadata, keyed by video ID
+type MetadataCache interface {
+	// Get returns the cached metadata for videoID, or false if there is none
+	Get(ctx context.Context, videoID string) (*Metadata, bool)
+	Set(ctx context.Context, videoID string, meta *Metadata, ttl time.Duration) error
+}
+
+// NewMetadataCache returns a Redis-backed cache when client is set, in-memory otherwise
+func NewMetadataCache(client *redis.Client) MetadataCache {
+	if client != nil {
+		return NewRedisMetadataCache(client)
+	}
+	return NewInMemoryMetadataCache()
+}
+
+// ParseVideoInfo decodes the JSON printed by yt-dlp --dump-single-json
+func ParseVideoInfo(b []byte) (*Metadata, error) {
+	var data struct {
+		Title      string  `json:"title"`
+		Uploader   string  `json:"uploader"`
+		Duration   float64 `json:"duration"`
+		URL        string  `json:"url"` // Direct stream URL of the selected format
+		Ext        string  `json:"ext"`
+		Abr        int     `json:"abr"`
+		Thumbnail  string  `json:"thumbnail"`
+		LiveStatus string  `json:"live_status"`
+		IsLive     bool    `json:"is_live"` // Older yt-dlp versions only report this
+	}
+	if err := json.Unmarshal(b, &data); err != nil {
+		return nil, err
+	}
+	liveStatus := data.LiveStatus
+	if liveStatus == "" && data.IsLive {
+		liveStatus = LiveStatusLive
+	}
+	return &Metadata{
+		Title:      data.Title,
+		Uploader:   data.Uploader,
+		Duration:   data.Duration,
+		AudioURL:   data.URL,
+		Ext:        data.Ext,
+		Abr:        data.Abr,
+		Thumbnail:  data.Thumbnail,
+		LiveStatus: liveStatus,
+	}, nil
+}
+
+// yt-dlp live_status values for streams that can't be converted
+const (
+	LiveStatusLive     = "is_live"
+	LiveStatusUpcoming = "is_upcoming"
+)
+
+// ErrLiveStream is returned for videos that are live or not yet broadcast.
+// Converting them would never finish (or fail), and retrying doesn't help.
+var ErrLiveStream = errors.New("live streams and upcoming premieres can't be converted")
+
+// CheckNotLive returns an error wrapping ErrLiveStream for live and upcoming streams
+func CheckNotLive(meta *Metadata) error {
+	switch meta.LiveStatus {
+	case LiveStatusLive:
+		return fmt.Errorf("%w: the video is live right now", ErrLiveStream)
+	case LiveStatusUpcoming:
+		return fmt.Errorf("%w: the video has not premiered yet", ErrLiveStream)
+	}
+	return nil
+}
+
+// ErrFormatUnavailable is returned by SelectFormat when the video doesn't
+// offer the requested format with audio; retrying doesn't help
+var ErrFormatUnavailable = errors.New("requested format is not available")
+
+// SelectFormat points meta at the stream formatID from b, the yt-dlp
+// --dump-single-json output meta was parsed from, instead of the one yt-dlp
+// selected. The stream must carry audio.
+func SelectFormat(meta *Metadata, b []byte, formatID string) error {
+	var data struct {
+		Formats []struct {
+			ID     string  `json:"format_id"`
+			URL    string  `json:"url"`
+			Ext    string  `json:"ext"`
+			ACodec string  `json:"acodec"`
+			Abr    float64 `json:"abr"`
+		} `json:"formats"`
+	}
+	if err := json.Unmarshal(b, &data); err != nil {
+		return err
+	}
+	ids := make([]string, 0, len(data.Formats))
+	for _, f := range data.Formats {
+		if f.ACodec == "none" || f.URL == "" {
+			continue
+		}
+		if f.ID == formatID {
+			meta.AudioURL, meta.Ext, meta.Abr = f.URL, f.Ext, int(f.Abr)
+			return nil
+		}
+		ids = append(ids, f.ID)
+	}
+	return fmt.Errorf("%w: %q is not one of the video's audio formats (%s)", ErrFormatUnavailable, formatID, strings.Join(ids, ", "))
+}
+
+// ParseStreamFormats lists the streams with audio in b, yt-dlp's
+// --dump-single-json output, in yt-dlp's order (worst first)
+func ParseStreamFormats(b []byte) ([]StreamFormat, error) {
+	var data struct {
+		Formats []struct {
+			ID             string  `json:"format_id"`
+			Ext            string  `json:"ext"`
+			ACodec         string  `json:"acodec"`
+			VCodec         string  `json:"vcodec"`
+			Abr            float64 `json:"abr"`
+			Filesize       float64 `json:"filesize"`
+			FilesizeApprox float64 `json:"filesize_approx"`
+		} `json:"formats"`
+	}
+	if err := json.Unmarshal(b, &data); err != nil {
+		return nil, err
+	}
+	formats := make([]StreamFormat, 0, len(data.Formats))
+	for _, f := range data.Formats {
+		if f.ACodec == "none" || f.ID == "" {
+			continue
+		}
+		size := f.Filesize
+		if size == 0 {
+			size = f.FilesizeApprox
+		}
+		formats = append(formats, StreamFormat{
+			FormatID:  f.ID,
+			Ext:       f.Ext,
+			Codec:     f.ACodec,
+			Abr:       f.Abr,
+			Filesize:  int64(size),
+			AudioOnly: f.VCodec == "none",
+		})
+	}
+	return formats, nil
+}
+
+// InMemoryMetadataCache implements MetadataCache in process memory
+type InMemoryMetadataCache struct {
+	mu      sync.Mutex
+	entries map[string]metadataEntry
+}
+
+type metadataEntry struct {
+	meta    Metadata
+	expires time.Time
+}
+
+func NewInMemoryMetadataCache() *InMemoryMetadataCache {
+	return &InMemoryMetadataCache{entries: map[string]metadataEntry{}}
+}
+
+func (c *InMemoryMetadataCache) Get(ctx context.Context, videoID string) (*Metadata, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[videoID]
+	if !ok || time.Now().After(e.expires) {
+		return nil, false
+	}
+	meta := e.meta
+	return &meta, true
+}
+
+func (c *InMemoryMetadataCache) Set(ctx context.Context, videoID string, meta *Metadata, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if len(c.entries) >= maxInMemoryMetadataEntries {
+		for id, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, id)
+			}
+		}
+	}
+	if len(c.entries) >= maxInMemoryMetadataEntries {
+		// Still full: drop an arbitrary entry rather than grow without bound
+		for id := range c.entries {
+			delete(c.entries, id)
+			break
+		}
+	}
+	c.entries[videoID] = metadataEntry{meta: *meta, expires: now.Add(ttl)}
+	return nil
+}
+
+// RedisMetadataCache implements MetadataCache in Redis
+// Keys: metadata:<video_id> => JSON(Metadata), expiring after the TTL
+type RedisMetadataCache struct {
+	client *redis.Client
+}
+
+func NewRedisMetadataCache(client *redis.Client) *RedisMetadataCache {
+	return &RedisMetadataCache{client: client}
+}
+
+func (c *RedisMetadataCache) Get(ctx context.Context, videoID string) (*Metadata, bool) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	b, err := c.client.Get(ctx, "metadata:"+videoID).Bytes()
+	if err != nil {
+		return nil, false
+	}
+	var meta Metadata
+	if err := json.Unmarshal(b, &meta); err != nil {
+		return nil, false
+	}
+	return &meta, true
+}
+
+func (c *RedisMetadataCache) Set(ctx context.Context, videoID string, meta *Metadata, ttl time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	b, err := json.Marshal(meta)
+	if err != nil {
+		return fmt.Errorf("failed to encode metadata for %s: %w", videoID, err)
+	}
+	return c.client.Set(ctx, "metadata:"+videoID, b, ttl).Err()
+}
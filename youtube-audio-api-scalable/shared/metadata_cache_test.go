@@ -0,0 +1,62 @@
+package shared
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestCheckNotLive(t *testing.T) {
+	tests := []struct {
+		info     string
+		wantLive bool
+	}{
+		{`{"title":"a","live_status":"not_live"}`, false},
+		{`{"title":"a","live_status":"was_live"}`, false},
+		{`{"title":"a","live_status":"post_live"}`, false},
+		{`{"title":"a"}`, false},
+		{`{"title":"a","live_status":"is_live"}`, true},
+		{`{"title":"a","live_status":"is_upcoming"}`, true},
+		{`{"title":"a","is_live":true}`, true}, // Older yt-dlp versions
+	}
+	for _, tt := range tests {
+		meta, err := ParseVideoInfo([]byte(tt.info))
+		if err != nil {
+			t.Fatalf("ParseVideoInfo(%s): %v", tt.info, err)
+		}
+		err = CheckNotLive(meta)
+		if live := errors.Is(err, ErrLiveStream); live != tt.wantLive {
+			t.Errorf("%s: CheckNotLive = %v, want live %v", tt.info, err, tt.wantLive)
+		}
+	}
+}
+
+func TestParseStreamFormats(t *testing.T) {
+	info := `{"title":"a","formats":[
+		{"format_id":"sb0","ext":"mhtml","acodec":"none","vcodec":"none"},
+		{"format_id":"139","ext":"m4a","acodec":"mp4a.40.5","vcodec":"none","abr":48.8,"filesize":1300000},
+		{"format_id":"251","ext":"webm","acodec":"opus","vcodec":"none","abr":129.5,"filesize_approx":3400000.6},
+		{"format_id":"137","ext":"mp4","acodec":"none","vcodec":"avc1.640028"},
+		{"format_id":"18","ext":"mp4","acodec":"mp4a.40.2","vcodec":"avc1.42001E","abr":96},
+		{"ext":"m4a","acodec":"mp4a.40.2"}
+	]}`
+	formats, err := ParseStreamFormats([]byte(info))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []StreamFormat{
+		{FormatID: "139", Ext: "m4a", Codec: "mp4a.40.5", Abr: 48.8, Filesize: 1300000, AudioOnly: true},
+		{FormatID: "251", Ext: "webm", Codec: "opus", Abr: 129.5, Filesize: 3400000, AudioOnly: true},
+		{FormatID: "18", Ext: "mp4", Codec: "mp4a.40.2", Abr: 96},
+	}
+	if !slices.Equal(formats, want) {
+		t.Errorf("ParseStreamFormats =\n%+v\nwant\n%+v", formats, want)
+	}
+
+	if formats, err := ParseStreamFormats([]byte(`{"title":"no formats"}`)); err != nil || len(formats) != 0 {
+		t.Errorf("no formats: %+v, %v", formats, err)
+	}
+	if _, err := ParseStreamFormats([]byte(`not json`)); err == nil {
+		t.Error("invalid JSON was accepted")
+	}
+}
@@ -0,0 +1,66 @@
+// shared/metrics.go
+package shared
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Prometheus metrics shared by the API Gateway and Worker. Each service only
+// updates the ones relevant to it; all are exposed on /metrics.
+var (
+	JobsCreatedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "jobs_created_total",
+		Help: "Total number of jobs accepted by the API Gateway.",
+	})
+	JobsCompletedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "jobs_completed_total",
+		Help: "Total number of jobs completed by workers.",
+	})
+	JobsFailedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "jobs_failed_total",
+		Help: "Total number of jobs that failed.",
+	})
+	JobProcessingDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "job_processing_duration_seconds",
+		Help:    "Time spent converting audio with ffmpeg.",
+		Buckets: []float64{1, 2.5, 5, 10, 30, 60, 120, 300, 600},
+	})
+	JobQueueWaitDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "job_queue_wait_seconds",
+		Help:    "Time from a job's submission to a worker starting it, by format and failure reason.",
+		Buckets: []float64{0.5, 1, 5, 15, 30, 60, 120, 300, 600, 1800},
+	}, []string{"format", "failure_reason"})
+	JobRunDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "job_run_duration_seconds",
+		Help:    "Time from a worker starting a job to it finishing, by format and failure reason.",
+		Buckets: []float64{1, 2.5, 5, 10, 30, 60, 120, 300, 600, 1200},
+	}, []string{"format", "failure_reason"})
+	RedisErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "redis_errors_total",
+		Help: "Redis calls that failed because Redis was unreachable, by operation.",
+	}, []string{"operation"})
+)
+
+var registerQueueDepthOnce sync.Once
+
+// RegisterQueueDepthMetric exposes the queue_depth gauge, read from mq on each scrape
+func RegisterQueueDepthMetric(mq MessageQueueClient) {
+	registerQueueDepthOnce.Do(func() {
+		promauto.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "queue_depth",
+			Help: "Number of jobs waiting in the queue.",
+		}, func() float64 {
+			n, err := mq.Depth(context.Background())
+			if err != nil {
+				log.Printf("WARN: Failed to read queue depth: %v", err)
+				return 0
+			}
+			return float64(n)
+		})
+	})
+}
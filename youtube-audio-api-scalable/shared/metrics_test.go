@@ -0,0 +1,42 @@
+// shared/metrics_test.go
+package shared
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+func TestMetricsEndpointExposesJobMetrics(t *testing.T) {
+	mq := NewInMemoryQueue(10)
+	defer mq.Close()
+	RegisterQueueDepthMetric(mq)
+	// Labelled metrics only show up once they have a series
+	JobQueueWaitDuration.WithLabelValues("mp3", "none").Observe(1)
+	JobRunDuration.WithLabelValues("mp3", "none").Observe(1)
+	RedisErrorsTotal.WithLabelValues("test").Add(0)
+
+	rec := httptest.NewRecorder()
+	promhttp.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("/metrics status = %d", rec.Code)
+	}
+	body := rec.Body.String()
+	for _, name := range []string{
+		"jobs_created_total",
+		"jobs_completed_total",
+		"jobs_failed_total",
+		"job_processing_duration_seconds_bucket",
+		"job_queue_wait_seconds_bucket",
+		"job_run_duration_seconds_bucket",
+		"redis_errors_total",
+		"queue_depth",
+	} {
+		if !strings.Contains(body, "\n"+name) {
+			t.Errorf("/metrics has no %s", name)
+		}
+	}
+}
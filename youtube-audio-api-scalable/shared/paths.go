@@ -1,4 +1,26 @@
 package shared
 
-// OutputDir defines where worker jobs will save generated MP3 files
-var OutputDir = "./downloads"
+import (
+	"fmt"
+	"os"
+)
+
+// EnsureOutputDir creates dir if needed and checks that files can be written
+// to it, so a bad mount fails at startup rather than on the first job
+func EnsureOutputDir(dir string) error {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, ".write-check-*")
+	if err != nil {
+		return fmt.Errorf("%s is not writable: %w", dir, err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// ThumbnailFileName is the name of a job's thumbnail in Config.OutputDir; ext
+// includes the dot. The _ keeps it attributable to the job like clip files.
+func ThumbnailFileName(jobID, ext string) string {
+	return jobID + "_thumb" + ext
+}
@@ -0,0 +1,39 @@
+package shared
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadConfigOutputDir(t *testing.T) {
+	t.Setenv("OUTPUT_DIR", "")
+	if dir := LoadConfig().OutputDir; dir != DefaultOutputDir {
+		t.Errorf("OutputDir = %q, want the default %q", dir, DefaultOutputDir)
+	}
+	t.Setenv("OUTPUT_DIR", "/srv/audio")
+	if dir := LoadConfig().OutputDir; dir != "/srv/audio" {
+		t.Errorf("OutputDir = %q, want OUTPUT_DIR", dir)
+	}
+}
+
+func TestEnsureOutputDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "nested", "downloads")
+	if err := EnsureOutputDir(dir); err != nil {
+		t.Fatalf("EnsureOutputDir(%s): %v", dir, err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("the write check left %d file(s) behind", len(entries))
+	}
+
+	// A path under a regular file can never be created
+	file := filepath.Join(t.TempDir(), "file")
+	os.WriteFile(file, nil, 0o644)
+	if err := EnsureOutputDir(filepath.Join(file, "downloads")); err == nil {
+		t.Error("EnsureOutputDir succeeded under a regular file")
+	}
+}
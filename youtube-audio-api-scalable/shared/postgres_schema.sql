@@ -0,0 +1,54 @@
+-- Schema for the Postgres DatabaseClient. Applied by NewPostgresDB on startup;
+-- every statement is idempotent so it is safe to run repeatedly.
+
+CREATE TABLE IF NOT EXISTS jobs (
+    id           TEXT PRIMARY KEY,
+    status       TEXT NOT NULL,
+    original_url TEXT NOT NULL,
+    video_id     TEXT NOT NULL DEFAULT '',
+    format       TEXT NOT NULL DEFAULT '',
+    bitrate      TEXT NOT NULL DEFAULT '',
+    cacheable    BOOLEAN NOT NULL DEFAULT TRUE,
+    parent_id    TEXT NOT NULL DEFAULT '',
+    error        TEXT NOT NULL DEFAULT '',
+    metadata     JSONB,
+    storage_key  TEXT NOT NULL DEFAULT '',
+    file_path    TEXT NOT NULL DEFAULT '',
+    created_at   TIMESTAMPTZ NOT NULL,
+    started_at   TIMESTAMPTZ,
+    completed_at TIMESTAMPTZ,
+    -- The full job as JSON, for the fields without a column of their own
+    data         JSONB NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS jobs_created_at_idx ON jobs (created_at DESC);
+CREATE INDEX IF NOT EXISTS jobs_status_created_at_idx ON jobs (status, created_at DESC);
+CREATE INDEX IF NOT EXISTS jobs_completed_at_idx ON jobs (completed_at) WHERE status = 'completed';
+CREATE INDEX IF NOT EXISTS jobs_cache_idx ON jobs (video_id, format, bitrate) WHERE status = 'completed' AND cacheable;
+
+CREATE TABLE IF NOT EXISTS job_logs (
+    job_id TEXT PRIMARY KEY REFERENCES jobs (id) ON DELETE CASCADE,
+    logs   TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    key        TEXT PRIMARY KEY,
+    job_id     TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS processing_times (
+    id          BIGSERIAL PRIMARY KEY,
+    duration_ms BIGINT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS job_events (
+    id     BIGSERIAL PRIMARY KEY,
+    job_id TEXT NOT NULL REFERENCES jobs (id) ON DELETE CASCADE,
+    at     TIMESTAMPTZ NOT NULL,
+    status TEXT NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    source TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS job_events_job_id_idx ON job_events (job_id, id);
@@ -0,0 +1,96 @@
+// shared/priority.go
+package shared
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Priority decides how soon a queued job is picked up relative to others
+type Priority string
+
+const (
+	PriorityLow    Priority = "low"
+	PriorityNormal Priority = "normal"
+	PriorityHigh   Priority = "high"
+)
+
+// Priorities lists every priority, highest first
+var Priorities = [...]Priority{PriorityHigh, PriorityNormal, PriorityLow}
+
+// PriorityStarvationLimit is how many higher-priority messages may be consumed
+// in a row before a lower priority that is still waiting gets a turn
+const PriorityStarvationLimit = 10
+
+// ParsePriority validates a priority name; empty means PriorityNormal
+func ParsePriority(s string) (Priority, error) {
+	switch p := Priority(strings.ToLower(strings.TrimSpace(s))); p {
+	case "":
+		return PriorityNormal, nil
+	case PriorityLow, PriorityNormal, PriorityHigh:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown priority %q (use low, normal or high)", s)
+}
+
+// index is p's position in Priorities; unknown priorities count as normal
+func (p Priority) index() int {
+	for i, q := range Priorities {
+		if q == p {
+			return i
+		}
+	}
+	return 1
+}
+
+// QueuePriority is the priority the message is queued at. Messages published
+// before priorities existed have none and are treated as normal.
+func (m JobMessage) QueuePriority() Priority {
+	return Priorities[m.Priority.index()]
+}
+
+// priorityScheduler decides the order in which the per-priority queues are
+// checked. Higher priorities come first, except that priorities passed over
+// PriorityStarvationLimit times in a row are moved to the front, longest
+// waiting first, so low priority jobs are delayed but never starved. It is not
+// safe for concurrent use.
+type priorityScheduler struct {
+	passed [len(Priorities)]int
+}
+
+// order returns the priorities to check, in order. Every starved priority
+// goes first: one that turns out to be empty must not use up the turn of
+// another behind it.
+func (s *priorityScheduler) order() []Priority {
+	out := make([]Priority, 0, len(Priorities))
+	for _, p := range Priorities {
+		if s.passed[p.index()] >= PriorityStarvationLimit {
+			out = append(out, p)
+		}
+	}
+	if len(out) == 0 {
+		return Priorities[:]
+	}
+	slices.SortStableFunc(out, func(a, b Priority) int { return s.passed[b.index()] - s.passed[a.index()] })
+	for _, p := range Priorities {
+		if s.passed[p.index()] < PriorityStarvationLimit {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// served records that a message of priority p was consumed
+func (s *priorityScheduler) served(p Priority) {
+	i := p.index()
+	s.passed[i] = 0
+	for j := i + 1; j < len(s.passed); j++ {
+		s.passed[j]++
+	}
+}
+
+// empty records that p had nothing waiting, so it is not being starved
+func (s *priorityScheduler) empty(p Priority) {
+	s.passed[p.index()] = 0
+}
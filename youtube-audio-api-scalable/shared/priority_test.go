@@ -0,0 +1,82 @@
+package shared
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"testing"
+	"time"
+)
+
+// testQueues returns an in-memory and a Redis-backed queue
+func testQueues(t *testing.T) map[string]MessageQueueClient {
+	t.Helper()
+	client, _ := newTestRedis(t)
+	mem := NewInMemoryQueue(64)
+	t.Cleanup(mem.Close)
+	return map[string]MessageQueueClient{
+		"in-memory": mem,
+		"redis":     newTestRedisQueue(t, client, "worker", 0, 0),
+	}
+}
+
+// consumeIDs consumes n messages from q and returns their job IDs in order
+func consumeIDs(t *testing.T, q MessageQueueClient, n int) []string {
+	t.Helper()
+	ch, err := q.Consume(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]string, 0, n)
+	for len(ids) < n {
+		msg, ok := receive(t, ch, 5*time.Second)
+		if !ok {
+			t.Fatalf("received only %v", ids)
+		}
+		ids = append(ids, msg.JobID)
+		q.Ack(context.Background(), msg)
+	}
+	return ids
+}
+
+func TestQueueConsumesHighPriorityFirst(t *testing.T) {
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	for name, q := range testQueues(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			for i, p := range []Priority{PriorityLow, PriorityNormal, PriorityHigh, "", PriorityLow, PriorityHigh} {
+				if err := q.Publish(ctx, JobMessage{JobID: fmt.Sprintf("%d-%s", i, p), Priority: p}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// Messages without a priority count as normal; each priority stays FIFO
+			want := []string{"2-high", "5-high", "1-normal", "3-", "0-low", "4-low"}
+			if got := consumeIDs(t, q, len(want)); !slices.Equal(got, want) {
+				t.Errorf("consumed %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestQueueDoesNotStarveLowPriority(t *testing.T) {
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	for name, q := range testQueues(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			q.Publish(ctx, JobMessage{JobID: "low", Priority: PriorityLow})
+			const high = 2 * PriorityStarvationLimit
+			for i := 0; i < high; i++ {
+				q.Publish(ctx, JobMessage{JobID: fmt.Sprintf("high-%d", i), Priority: PriorityHigh})
+			}
+			got := consumeIDs(t, q, high+1)
+			if i := slices.Index(got, "low"); i != PriorityStarvationLimit {
+				t.Errorf("low priority job consumed at position %d, want %d: %v", i, PriorityStarvationLimit, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+// shared/progress_feed.go
+package shared
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	redis "github.com/redis/go-redis/v9"
+)
+
+// ProgressLine is one ffmpeg status line of a running conversion
+type ProgressLine struct {
+	Line     string    `json:"line"`
+	Position float64   `json:"position_seconds"`  // How far into the audio ffmpeg is
+	Percent  int       `json:"percent,omitempty"` // Of the expected duration; 0 when unknown
+	Time     time.Time `json:"time"`
+}
+
+// progressFeedBuffer is how many lines a slow subscriber may fall behind
+// before further ones are dropped for it
+const progressFeedBuffer = 64
+
+// ProgressFeed carries the ffmpeg status lines of running jobs from workers to
+// whoever is watching. Lines are not stored: subscribers only see those
+// published while they listen.
+type ProgressFeed interface {
+	Publish(ctx context.Context, jobID string, line ProgressLine) error
+	// Subscribe sends jobID's lines on the returned channel until ctx is done,
+	// then closes it
+	Subscribe(ctx context.Context, jobID string) <-chan ProgressLine
+}
+
+// NewProgressFeed returns a Redis pub/sub feed when client is set, in-memory otherwise
+func NewProgressFeed(client *redis.Client) ProgressFeed {
+	if client != nil {
+		return &RedisProgressFeed{client: client}
+	}
+	return &InMemoryProgressFeed{subs: make(map[string]map[chan ProgressLine]struct{})}
+}
+
+// RedisProgressFeed publishes each job's lines as JSON on the channel progress:<jobID>
+type RedisProgressFeed struct {
+	client *redis.Client
+}
+
+func (f *RedisProgressFeed) channel(jobID string) string { return "progress:" + jobID }
+
+func (f *RedisProgressFeed) Publish(ctx context.Context, jobID string, line ProgressLine) error {
+	b, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	return f.client.Publish(ctx, f.channel(jobID), b).Err()
+}
+
+func (f *RedisProgressFeed) Subscribe(ctx context.Context, jobID string) <-chan ProgressLine {
+	out := make(chan ProgressLine, progressFeedBuffer)
+	sub := f.client.Subscribe(ctx, f.channel(jobID))
+	go func() {
+		defer close(out)
+		defer sub.Close()
+		msgs := sub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-msgs:
+				if !ok {
+					return
+				}
+				var line ProgressLine
+				if json.Unmarshal([]byte(msg.Payload), &line) != nil {
+					continue
+				}
+				select {
+				case out <- line:
+				default: // Subscriber is behind; drop the line
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// InMemoryProgressFeed only reaches subscribers in the publishing process
+type InMemoryProgressFeed struct {
+	mu   sync.Mutex
+	subs map[string]map[chan ProgressLine]struct{} // Job ID => subscriber channels
+}
+
+func (f *InMemoryProgressFeed) Publish(ctx context.Context, jobID string, line ProgressLine) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for ch := range f.subs[jobID] {
+		select {
+		case ch <- line:
+		default: // Subscriber is behind; drop the line
+		}
+	}
+	return nil
+}
+
+func (f *InMemoryProgressFeed) Subscribe(ctx context.Context, jobID string) <-chan ProgressLine {
+	ch := make(chan ProgressLine, progressFeedBuffer)
+	f.mu.Lock()
+	if f.subs[jobID] == nil {
+		f.subs[jobID] = make(map[chan ProgressLine]struct{})
+	}
+	f.subs[jobID][ch] = struct{}{}
+	f.mu.Unlock()
+	go func() {
+		<-ctx.Done()
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		delete(f.subs[jobID], ch)
+		if len(f.subs[jobID]) == 0 {
+			delete(f.subs, jobID)
+		}
+		close(ch)
+	}()
+	return ch
+}
@@ -2,63 +2,348 @@
 package shared
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// DefaultDeadLetterMaxLength bounds how many dead-lettered jobs are kept
+const DefaultDeadLetterMaxLength = 1000
+
 // JobMessage represents the data sent through the queue for a job
 type JobMessage struct {
 	JobID       string
 	OriginalURL string
+	Format      string
+	Bitrate     string
+	Attempt     int // Number of earlier failed attempts at this job
+	EmbedTags   bool
+	ClipStart   float64
+	ClipEnd     float64
+	Normalize   bool
+	SampleRate  int    `json:",omitempty"`
+	Channels    string `json:",omitempty"`
+	FormatID    string `json:",omitempty"` // yt-dlp format ID; empty means bestaudio
+	Cookies     string `json:",omitempty"` // Base64 cookies.txt from the request; never stored on the Job
+	Priority    Priority `json:",omitempty"`
+	WithSubtitles bool `json:",omitempty"`
+
+	// TraceContext carries the submitting request's trace (W3C traceparent) to the worker
+	TraceContext map[string]string `json:",omitempty"`
+
+	// stream and entryID locate the Redis entry the message was read from, so
+	// Ack can acknowledge it; empty for in-memory messages
+	stream  string
+	entryID string
+}
+
+// JobMessageFor rebuilds the queue message for job from the options stored
+// on it, e.g. to run it again. Cookies aren't stored, so they are lost.
+func JobMessageFor(job *Job) JobMessage {
+	return JobMessage{
+		JobID:         job.ID,
+		OriginalURL:   job.FetchURL(),
+		Format:        job.Format,
+		Bitrate:       job.Bitrate,
+		EmbedTags:     job.EmbedTags,
+		ClipStart:     job.ClipStart,
+		ClipEnd:       job.ClipEnd,
+		Normalize:     job.Normalize,
+		SampleRate:    job.SampleRate,
+		Channels:      job.Channels,
+		FormatID:      job.FormatID,
+		Priority:      job.Priority,
+		WithSubtitles: job.WithSubtitles,
+	}
+}
+
+// DeadLetter records a job that failed permanently
+type DeadLetter struct {
+	Message  JobMessage `json:"message"`
+	Reason   string     `json:"reason"`
+	FailedAt time.Time  `json:"failed_at"`
 }
 
 // MessageQueueClient is a conceptual interface for a message queue
 type MessageQueueClient interface {
-	Publish(message JobMessage) error
-	Consume() (<-chan JobMessage, error)
+	Publish(ctx context.Context, message JobMessage) error
+	Consume(ctx context.Context) (<-chan JobMessage, error)
+	// Ack tells the queue a consumed message has been handled, i.e. processed
+	// or published again. Until then a Redis entry stays pending, and is
+	// redelivered to another worker if this one dies.
+	Ack(ctx context.Context, message JobMessage) error
+	Depth(ctx context.Context) (int64, error) // Number of messages waiting to be consumed
+	// ActiveConsumers counts the workers currently consuming the queue
+	ActiveConsumers(ctx context.Context) (int, error)
+	// DeadLetter parks a message that exhausted its retries for inspection
+	DeadLetter(ctx context.Context, message JobMessage, reason string) error
+	// DeadLetters lists dead-lettered messages, newest first
+	DeadLetters(ctx context.Context) ([]DeadLetter, error)
+	// RemoveDeadLetter takes the entry for jobID out of the dead-letter queue
+	RemoveDeadLetter(ctx context.Context, jobID string) (*DeadLetter, error)
+	Ping(ctx context.Context) error // Checks the connection to the queue
+	// Drain stops accepting messages, waits until consumers have received
+	// everything already queued in this process (or ctx is done), then closes
+	Drain(ctx context.Context) error
 	Close() // In a real queue, this would close connections
 }
 
-// InMemoryQueue implements MessageQueueClient using a Go channel
+// InMemoryQueue implements MessageQueueClient using one Go channel per
+// priority. Consume hands out messages from the highest-priority channel
+// that has one, within the limits of PriorityStarvationLimit.
 type InMemoryQueue struct {
-	queue chan JobMessage
-	stop  chan struct{}
-	once  sync.Once
+	queues  map[Priority]chan JobMessage
+	size    int64
+	pending atomic.Int64 // Published but not yet handed to the consumer
+	notify  chan struct{} // Signalled on every publish to wake the dispatcher
+	stop    chan struct{}
+	once    sync.Once
+
+	consumeOnce sync.Once
+	out         chan JobMessage
+
+	// mu guards closed and out: publishers hold it for reading while they
+	// send, so Close can't close the channels under them. Drain sets closed early.
+	mu     sync.RWMutex
+	closed bool
+
+	dlqMu sync.Mutex
+	dlq   []DeadLetter // Oldest first, bounded to DefaultDeadLetterMaxLength
 }
 
-// NewInMemoryQueue creates a new in-memory queue instance
+// NewInMemoryQueue creates a new in-memory queue holding up to bufferSize
+// messages across all priorities
 func NewInMemoryQueue(bufferSize int) *InMemoryQueue {
-	return &InMemoryQueue{
-		queue: make(chan JobMessage, bufferSize),
-		stop:  make(chan struct{}),
+	q := &InMemoryQueue{
+		queues: make(map[Priority]chan JobMessage, len(Priorities)),
+		size:   int64(bufferSize),
+		notify: make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+	}
+	for _, p := range Priorities {
+		q.queues[p] = make(chan JobMessage, bufferSize)
 	}
+	return q
 }
 
 // Publish sends a message to the queue
-func (q *InMemoryQueue) Publish(message JobMessage) error {
+func (q *InMemoryQueue) Publish(ctx context.Context, message JobMessage) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return fmt.Errorf("queue is closed, cannot publish")
+	}
+	if q.pending.Add(1) > q.size {
+		q.pending.Add(-1)
+		return fmt.Errorf("queue is full, cannot publish job %s", message.JobID)
+	}
 	select {
-	case q.queue <- message:
+	case q.queues[message.QueuePriority()] <- message:
 		log.Printf("Queue: Published job %s", message.JobID)
-		return nil
-	case <-q.stop:
-		return fmt.Errorf("queue is closed, cannot publish")
 	default:
+		q.pending.Add(-1)
 		return fmt.Errorf("queue is full, cannot publish job %s", message.JobID)
 	}
+	select {
+	case q.notify <- struct{}{}:
+	default: // The dispatcher already has a wake-up pending
+	}
+	return nil
+}
+
+// Consume returns a channel from which messages can be received, highest
+// priority first. It is closed, after any buffered messages, once the queue is
+// closed or ctx is cancelled. Every call returns the same channel.
+func (q *InMemoryQueue) Consume(ctx context.Context) (<-chan JobMessage, error) {
+	q.consumeOnce.Do(func() {
+		q.mu.Lock()
+		q.out = make(chan JobMessage)
+		q.mu.Unlock()
+		go q.dispatch(ctx)
+	})
+	return q.out, nil
+}
+
+// dispatch moves messages from the per-priority channels to out until every
+// channel is closed and empty
+func (q *InMemoryQueue) dispatch(ctx context.Context) {
+	defer close(q.out)
+	var sched priorityScheduler
+	done := make(map[Priority]bool, len(Priorities))
+	for len(done) < len(Priorities) {
+		msg, ok := q.next(&sched, done)
+		if !ok {
+			// Nothing buffered: wait for a publish or for the queue to close
+			select {
+			case <-q.notify:
+			case <-q.stop:
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+		select {
+		case q.out <- msg:
+			q.pending.Add(-1)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// next takes a message from the first channel in sched's order that has one.
+// Channels found closed and empty are added to done.
+func (q *InMemoryQueue) next(sched *priorityScheduler, done map[Priority]bool) (JobMessage, bool) {
+	for _, p := range sched.order() {
+		if done[p] {
+			sched.empty(p)
+			continue
+		}
+		select {
+		case msg, ok := <-q.queues[p]:
+			if ok {
+				sched.served(p)
+				return msg, true
+			}
+			done[p] = true
+		default:
+		}
+		sched.empty(p)
+	}
+	return JobMessage{}, false
 }
 
-// Consume returns a channel from which messages can be received
-func (q *InMemoryQueue) Consume() (<-chan JobMessage, error) {
-	return q.queue, nil
+// Ack does nothing: an in-memory message is gone once it is received
+func (q *InMemoryQueue) Ack(ctx context.Context, message JobMessage) error {
+	return nil
 }
 
-// Close stops the queue from accepting new messages and closes the underlying channel
+// Depth returns the number of buffered messages
+func (q *InMemoryQueue) Depth(ctx context.Context) (int64, error) {
+	return q.pending.Load(), nil
+}
+
+// ActiveConsumers is 1 once this process has started consuming the queue
+// and it is still open; other processes can't see an in-memory queue
+func (q *InMemoryQueue) ActiveConsumers(ctx context.Context) (int, error) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.out == nil || q.closed {
+		return 0, nil
+	}
+	return 1, nil
+}
+
+// Ping reports an error once the queue has been closed
+func (q *InMemoryQueue) Ping(ctx context.Context) error {
+	select {
+	case <-q.stop:
+		return fmt.Errorf("queue is closed")
+	default:
+		return nil
+	}
+}
+
+// DeadLetter appends message to the dead-letter list, dropping the oldest entry when full
+func (q *InMemoryQueue) DeadLetter(ctx context.Context, message JobMessage, reason string) error {
+	q.dlqMu.Lock()
+	defer q.dlqMu.Unlock()
+	if len(q.dlq) >= DefaultDeadLetterMaxLength {
+		q.dlq = q.dlq[1:]
+	}
+	q.dlq = append(q.dlq, DeadLetter{Message: message, Reason: reason, FailedAt: time.Now()})
+	log.Printf("Queue: Dead-lettered job %s: %s", message.JobID, reason)
+	return nil
+}
+
+// DeadLetters returns the dead-lettered messages, newest first
+func (q *InMemoryQueue) DeadLetters(ctx context.Context) ([]DeadLetter, error) {
+	q.dlqMu.Lock()
+	defer q.dlqMu.Unlock()
+	out := make([]DeadLetter, 0, len(q.dlq))
+	for i := len(q.dlq) - 1; i >= 0; i-- {
+		out = append(out, q.dlq[i])
+	}
+	return out, nil
+}
+
+// RemoveDeadLetter removes and returns the newest dead-letter entry for jobID
+func (q *InMemoryQueue) RemoveDeadLetter(ctx context.Context, jobID string) (*DeadLetter, error) {
+	q.dlqMu.Lock()
+	defer q.dlqMu.Unlock()
+	for i := len(q.dlq) - 1; i >= 0; i-- {
+		if q.dlq[i].Message.JobID == jobID {
+			dl := q.dlq[i]
+			q.dlq = append(q.dlq[:i], q.dlq[i+1:]...)
+			return &dl, nil
+		}
+	}
+	return nil, fmt.Errorf("job %s is not in the dead-letter queue", jobID)
+}
+
+// drainPollInterval is how often Drain checks whether the buffer is empty
+const drainPollInterval = 50 * time.Millisecond
+
+// Drain rejects new publishes, waits for the consumer to take every buffered
+// message, and then closes the queue. If ctx ends first, the queue is closed
+// anyway and the messages still buffered are returned by Consume's channel
+// without anyone waiting for them.
+func (q *InMemoryQueue) Drain(ctx context.Context) error {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	defer q.Close()
+
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for q.pending.Load() > 0 {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("queue drain stopped with %d message(s) left: %w", q.pending.Load(), ctx.Err())
+		case <-q.stop:
+			return nil
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// Close stops the queue from accepting new messages and closes the underlying channels
 func (q *InMemoryQueue) Close() {
 	q.once.Do(func() {
 		log.Println("Queue: Closing...")
 		close(q.stop)
-        // Do not close the queue channel abruptly to avoid panics in publishers.
-        // Let the process exit or GC collect when no references remain.
+		// Publish never blocks while holding the read lock, so this only waits
+		// for in-progress sends; later publishes see closed and return an error
+		q.mu.Lock()
+		q.closed = true
+		for _, ch := range q.queues {
+			close(ch)
+		}
+		q.mu.Unlock()
 	})
 }
+
+// NewMessageQueueClient returns a Redis Streams queue when cfg.RedisAddr is set,
+// and an in-memory one otherwise. Redis is pinged before it is used.
+func NewMessageQueueClient(cfg *Config) (MessageQueueClient, error) {
+	client := NewRedisClient(cfg)
+	if client == nil {
+		size := DefaultInMemoryQueueSize
+		if cfg != nil && cfg.QueueMaxLength > 0 {
+			size = cfg.QueueMaxLength
+		}
+		return NewInMemoryQueue(size), nil
+	}
+	if err := PingRedis(client); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("redis at %s unreachable: %w", cfg.RedisAddr, err)
+	}
+	return NewRedisQueue(client, cfg), nil
+}
@@ -4,65 +4,558 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	redis "github.com/redis/go-redis/v9"
 )
 
-// RedisQueue implements MessageQueueClient using Redis streams (XADD/XREAD)
-// Stream: cfg.QueueName
-// Consumer group could be added later for scaling workers.
+// RedisQueue implements MessageQueueClient using Redis streams (XADD/XREADGROUP)
+// Streams: cfg.QueueName for normal priority, <QueueName>:high and <QueueName>:low
+// All workers share the consumer group cfg.ConsumerGroup, so each message is
+// delivered to exactly one of them. An entry is acknowledged only once the
+// worker has handled it (see Ack); until then the consumer keeps resetting its
+// idle time, so entries left pending by a crashed consumer are the ones that
+// go idle, and are reclaimed with XAUTOCLAIM after cfg.ClaimMinIdle.
+// Dead-lettered messages go to the stream <QueueName>:dlq.
 type RedisQueue struct {
-	client *redis.Client
-	name   string
-	maxLen int
+	client        *redis.Client
+	name          string
+	maxLen        int
+	group         string
+	consumer      string
+	claimMinIdle  time.Duration
+	claimInterval time.Duration
+	stop          chan struct{}
+	once          sync.Once
+	sched         priorityScheduler // Only used by readLoop
+
+	inflightMu sync.Mutex
+	inflight   map[streamEntry]bool // Entries read but not acknowledged yet
+}
+
+// streamEntry identifies one entry of one stream
+type streamEntry struct {
+	stream string
+	id     string
+}
+
+func NewRedisQueue(client *redis.Client, cfg *Config) *RedisQueue {
+	return &RedisQueue{
+		client:        client,
+		name:          cfg.QueueName,
+		maxLen:        cfg.QueueMaxLength,
+		group:         cfg.ConsumerGroup,
+		consumer:      consumerName(),
+		claimMinIdle:  cfg.ClaimMinIdle,
+		claimInterval: cfg.ClaimInterval,
+		stop:          make(chan struct{}),
+		inflight:      make(map[streamEntry]bool),
+	}
 }
 
-func NewRedisQueue(client *redis.Client, name string, maxLen int) *RedisQueue {
-	return &RedisQueue{client: client, name: name, maxLen: maxLen}
+// consumerName identifies this process within the consumer group
+func consumerName() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "worker"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// streamFor returns the stream holding messages of priority p. Normal
+// priority keeps the plain queue name, so entries queued before priorities
+// existed are still consumed.
+func (q *RedisQueue) streamFor(p Priority) string {
+	if p == PriorityNormal {
+		return q.name
+	}
+	return q.name + ":" + string(p)
 }
 
-func (q *RedisQueue) Publish(message JobMessage) error {
+func (q *RedisQueue) Publish(ctx context.Context, message JobMessage) error {
 	if q.client == nil {
 		return fmt.Errorf("redis client is nil")
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-	defer cancel()
-	b, _ := json.Marshal(message)
-	args := &redis.XAddArgs{Stream: q.name, MaxLenApprox: int64(q.maxLen), Values: map[string]any{"data": b}}
-	return q.client.XAdd(ctx, args).Err()
+	b, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to encode message for job %s: %w", message.JobID, err)
+	}
+	args := &redis.XAddArgs{Stream: q.streamFor(message.QueuePriority()), MaxLen: int64(q.maxLen), Approx: true, Values: map[string]any{"data": b}}
+	// A retried XADD may queue the job twice if only the reply was lost; the
+	// stream is at-least-once anyway, as the claim loop can redeliver too
+	return withRedisRetry(ctx, "publish", func(ctx context.Context) error {
+		return q.client.XAdd(ctx, args).Err()
+	})
 }
 
-func (q *RedisQueue) Consume() (<-chan JobMessage, error) {
+// ensureGroup creates the consumer group (and the streams) if it does not exist yet
+func (q *RedisQueue) ensureGroup(ctx context.Context) error {
+	for _, p := range Priorities {
+		// Start from "0" so jobs published before the first worker came up are not lost
+		err := q.client.XGroupCreateMkStream(ctx, q.streamFor(p), q.group, "0").Err()
+		if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			return err
+		}
+	}
+	return nil
+}
+
+func (q *RedisQueue) Consume(ctx context.Context) (<-chan JobMessage, error) {
 	out := make(chan JobMessage)
 	if q.client == nil {
 		close(out)
 		return out, fmt.Errorf("redis client is nil")
 	}
+	setupCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	err := q.ensureGroup(setupCtx)
+	cancel()
+	if err != nil {
+		close(out)
+		return out, fmt.Errorf("failed to create consumer group %s: %w", q.group, err)
+	}
+	log.Printf("Queue: Consuming stream %s as %s in group %s", q.name, q.consumer, q.group)
+	var wg sync.WaitGroup
+	wg.Add(2)
 	go func() {
-		defer close(out)
-		ctx := context.Background()
-		lastID := "$" // start from new messages
-		for {
-			res, err := q.client.XRead(ctx, &redis.XReadArgs{Streams: []string{q.name, lastID}, Block: 0, Count: 10}).Result()
-			if err != nil {
-				// on context cancel or close, exit
+		defer wg.Done()
+		q.readLoop(ctx, out)
+	}()
+	go func() {
+		defer wg.Done()
+		q.claimLoop(ctx, out)
+	}()
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out, nil
+}
+
+// readLoop delivers new stream entries assigned to this consumer, highest
+// priority first, until the queue is closed or ctx is cancelled. Failed reads
+// are retried after a backoff that doubles up to readRetryMaxBackoff, so the
+// loop outlives a Redis restart.
+func (q *RedisQueue) readLoop(ctx context.Context, out chan<- JobMessage) {
+	backoff := redisRetryBackoff
+	for {
+		select {
+		case <-q.stop:
+			return
+		case <-ctx.Done():
+			return
+		default:
+		}
+		res, err := q.readNext(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
 				return
 			}
-			for _, stream := range res {
-				for _, msg := range stream.Messages {
-					lastID = msg.ID
-					if raw, ok := msg.Values["data"].(string); ok {
-						var jm JobMessage
-						if err := json.Unmarshal([]byte(raw), &jm); err == nil {
-							out <- jm
-						}
-					}
+			log.Printf("Queue: Read from stream %s failed, retrying in %s: %v", q.name, backoff, err)
+			if isRedisUnavailable(err) {
+				RedisErrorsTotal.WithLabelValues("read").Inc()
+			} else if strings.HasPrefix(err.Error(), "NOGROUP") {
+				// Redis came back without our data; recreate the group and streams
+				setupCtx, cancel := context.WithTimeout(ctx, redisCallTimeout)
+				if err := q.ensureGroup(setupCtx); err != nil {
+					log.Printf("Queue: Failed to recreate consumer group %s: %v", q.group, err)
 				}
+				cancel()
 			}
+			select {
+			case <-time.After(backoff):
+			case <-q.stop:
+				return
+			case <-ctx.Done():
+				return
+			}
+			backoff = min(2*backoff, readRetryMaxBackoff)
+			continue
 		}
-	}()
+		backoff = redisRetryBackoff
+		for _, stream := range res {
+			for _, msg := range stream.Messages {
+				if !q.deliver(ctx, stream.Stream, msg, out) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// readNext reads one entry from the first stream in the scheduler's order
+// that has one. When all are empty it blocks on every stream for a while and
+// returns whatever arrives first, ordered highest priority first.
+func (q *RedisQueue) readNext(ctx context.Context) ([]redis.XStream, error) {
+	for _, p := range q.sched.order() {
+		res, err := q.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    q.group,
+			Consumer: q.consumer,
+			Streams:  []string{q.streamFor(p), ">"},
+			Block:    -1, // Don't block
+			Count:    1,
+		}).Result()
+		if err != nil && err != redis.Nil {
+			return nil, err
+		}
+		if len(res) > 0 && len(res[0].Messages) > 0 {
+			q.sched.served(p)
+			return res, nil
+		}
+		q.sched.empty(p)
+	}
+
+	streams := make([]string, 0, 2*len(Priorities))
+	for _, p := range Priorities {
+		streams = append(streams, q.streamFor(p))
+	}
+	for range Priorities {
+		streams = append(streams, ">")
+	}
+	res, err := q.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    q.group,
+		Consumer: q.consumer,
+		Streams:  streams,
+		Block:    5 * time.Second,
+		Count:    1,
+	}).Result()
+	if err == redis.Nil {
+		return nil, nil // block timed out with no new messages
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return q.streamPriority(res[i].Stream).index() < q.streamPriority(res[j].Stream).index()
+	})
+	for _, stream := range res {
+		if len(stream.Messages) > 0 {
+			q.sched.served(q.streamPriority(stream.Stream))
+		}
+	}
+	return res, nil
+}
+
+// streamPriority is the inverse of streamFor
+func (q *RedisQueue) streamPriority(stream string) Priority {
+	for _, p := range Priorities {
+		if q.streamFor(p) == stream {
+			return p
+		}
+	}
+	return PriorityNormal
+}
+
+// claimLoop periodically refreshes the entries this consumer is working on,
+// then takes over entries that another consumer read but never acknowledged
+// (e.g. because it crashed) and delivers them again
+func (q *RedisQueue) claimLoop(ctx context.Context, out chan<- JobMessage) {
+	if q.claimInterval <= 0 || q.claimMinIdle <= 0 {
+		return
+	}
+	ticker := time.NewTicker(q.claimInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-q.stop:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		q.refreshInFlight(ctx)
+		for _, p := range Priorities {
+			if !q.claimStream(ctx, q.streamFor(p), out) {
+				return
+			}
+		}
+	}
+}
+
+// claimStream reclaims and delivers the idle pending entries of one stream.
+// It returns false when the queue was closed (or ctx cancelled) meanwhile.
+func (q *RedisQueue) claimStream(ctx context.Context, stream string, out chan<- JobMessage) bool {
+	start := "0-0"
+	for {
+		claimCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		msgs, next, err := q.client.XAutoClaim(claimCtx, &redis.XAutoClaimArgs{
+			Stream:   stream,
+			Group:    q.group,
+			Consumer: q.consumer,
+			MinIdle:  q.claimMinIdle,
+			Start:    start,
+			Count:    10,
+		}).Result()
+		cancel()
+		if err != nil {
+			log.Printf("Queue: XAUTOCLAIM on %s failed: %v", stream, err)
+			return true
+		}
+		for _, msg := range msgs {
+			if q.isInFlight(streamEntry{stream, msg.ID}) {
+				continue // Ours already; its refresh came too late
+			}
+			log.Printf("Queue: Reclaimed pending message %s", msg.ID)
+			if !q.deliver(ctx, stream, msg, out) {
+				return false
+			}
+		}
+		if next == "0-0" || next == "" {
+			return true
+		}
+		start = next
+	}
+}
+
+// deliver decodes msg and hands it to out; the consumer acknowledges it with
+// Ack once handled. It returns false when the queue was closed (or ctx
+// cancelled) before the message could be handed off.
+func (q *RedisQueue) deliver(ctx context.Context, stream string, msg redis.XMessage, out chan<- JobMessage) bool {
+	raw, ok := msg.Values["data"].(string)
+	var jm JobMessage
+	if !ok || json.Unmarshal([]byte(raw), &jm) != nil || jm.JobID == "" {
+		// Malformed entries would never succeed; ack them so they don't linger
+		log.Printf("Queue: Dropping malformed message %s", msg.ID)
+		if err := q.ack(ctx, stream, msg.ID); err != nil {
+			log.Printf("Queue: Failed to ack message %s: %v", msg.ID, err)
+		}
+		return true
+	}
+	jm.stream, jm.entryID = stream, msg.ID
+	entry := streamEntry{stream, msg.ID}
+	// Tracked from now on, so it isn't reclaimed while waiting for a free worker
+	q.inflightMu.Lock()
+	q.inflight[entry] = true
+	q.inflightMu.Unlock()
+	select {
+	case out <- jm:
+		return true
+	case <-q.stop:
+	case <-ctx.Done():
+	}
+	// Never handed off: let it go idle so another worker reclaims it
+	q.inflightMu.Lock()
+	delete(q.inflight, entry)
+	q.inflightMu.Unlock()
+	return false
+}
+
+// Ack acknowledges the entry message was read from, so it is not delivered again
+func (q *RedisQueue) Ack(ctx context.Context, message JobMessage) error {
+	if message.entryID == "" {
+		return nil // Not read from this queue
+	}
+	q.inflightMu.Lock()
+	delete(q.inflight, streamEntry{message.stream, message.entryID})
+	q.inflightMu.Unlock()
+	if err := q.ack(ctx, message.stream, message.entryID); err != nil {
+		return fmt.Errorf("failed to ack message %s of job %s: %w", message.entryID, message.JobID, err)
+	}
+	return nil
+}
+
+func (q *RedisQueue) ack(ctx context.Context, stream, id string) error {
+	return withRedisRetry(ctx, "ack", func(ctx context.Context) error {
+		return q.client.XAck(ctx, stream, q.group, id).Err()
+	})
+}
+
+// isInFlight reports whether this consumer read entry and hasn't acknowledged it
+func (q *RedisQueue) isInFlight(entry streamEntry) bool {
+	q.inflightMu.Lock()
+	defer q.inflightMu.Unlock()
+	return q.inflight[entry]
+}
+
+// refreshInFlight resets the idle time of the entries this consumer is still
+// working on by claiming them for itself again, so that other consumers leave
+// them alone however long their jobs take
+func (q *RedisQueue) refreshInFlight(ctx context.Context) {
+	byStream := map[string][]string{}
+	q.inflightMu.Lock()
+	for e := range q.inflight {
+		byStream[e.stream] = append(byStream[e.stream], e.id)
+	}
+	q.inflightMu.Unlock()
+	for stream, ids := range byStream {
+		claimCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		err := q.client.XClaimJustID(claimCtx, &redis.XClaimArgs{
+			Stream:   stream,
+			Group:    q.group,
+			Consumer: q.consumer,
+			Messages: ids,
+		}).Err()
+		cancel()
+		if err != nil {
+			log.Printf("Queue: Failed to refresh %d in-flight message(s) on %s: %v", len(ids), stream, err)
+		}
+	}
+}
+
+// Depth returns the consumer group's lag (entries not yet delivered to any
+// worker) summed over the priority streams
+func (q *RedisQueue) Depth(ctx context.Context) (int64, error) {
+	if q.client == nil {
+		return 0, fmt.Errorf("redis client is nil")
+	}
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	var total int64
+	for _, p := range Priorities {
+		n, err := q.streamDepth(ctx, q.streamFor(p))
+		if err != nil {
+			return 0, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// streamDepth returns the group's lag on stream, or the stream length when
+// the group does not exist yet
+func (q *RedisQueue) streamDepth(ctx context.Context, stream string) (int64, error) {
+	if groups, err := q.client.XInfoGroups(ctx, stream).Result(); err == nil {
+		for _, g := range groups {
+			if g.Name == q.group {
+				return g.Lag, nil
+			}
+		}
+	}
+	n, err := q.client.XLen(ctx, stream).Result()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return n, err
+}
+
+// activeConsumerIdle is how long a consumer may go without reading before it
+// no longer counts as active. Consumers read at least every few seconds while
+// they have capacity, and hold an unacknowledged entry while they don't.
+const activeConsumerIdle = time.Minute
+
+// ActiveConsumers counts the group's consumers that read recently or are
+// holding an entry they have not acknowledged yet
+func (q *RedisQueue) ActiveConsumers(ctx context.Context) (int, error) {
+	if q.client == nil {
+		return 0, fmt.Errorf("redis client is nil")
+	}
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	consumers, err := q.client.XInfoConsumers(ctx, q.name, q.group).Result()
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "NOGROUP") || strings.Contains(err.Error(), "no such key") {
+			return 0, nil // No worker has started yet
+		}
+		return 0, err
+	}
+	active := 0
+	for _, c := range consumers {
+		if c.Idle < activeConsumerIdle || c.Pending > 0 {
+			active++
+		}
+	}
+	return active, nil
+}
+
+func (q *RedisQueue) Ping(ctx context.Context) error {
+	if q.client == nil {
+		return fmt.Errorf("redis client is nil")
+	}
+	return PingRedis(q.client)
+}
+
+func (q *RedisQueue) dlqName() string { return q.name + ":dlq" }
+
+// DeadLetter adds message to the dead-letter stream
+func (q *RedisQueue) DeadLetter(ctx context.Context, message JobMessage, reason string) error {
+	if q.client == nil {
+		return fmt.Errorf("redis client is nil")
+	}
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	b, err := json.Marshal(DeadLetter{Message: message, Reason: reason, FailedAt: time.Now()})
+	if err != nil {
+		return err
+	}
+	args := &redis.XAddArgs{
+		Stream: q.dlqName(),
+		MaxLen: DefaultDeadLetterMaxLength,
+		Approx: true,
+		Values: map[string]any{"job_id": message.JobID, "data": b},
+	}
+	return q.client.XAdd(ctx, args).Err()
+}
+
+// DeadLetters returns the dead-letter stream, newest first
+func (q *RedisQueue) DeadLetters(ctx context.Context) ([]DeadLetter, error) {
+	if q.client == nil {
+		return nil, fmt.Errorf("redis client is nil")
+	}
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	msgs, err := q.client.XRevRange(ctx, q.dlqName(), "+", "-").Result()
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	out := make([]DeadLetter, 0, len(msgs))
+	for _, msg := range msgs {
+		if dl, ok := decodeDeadLetter(msg); ok {
+			out = append(out, dl)
+		}
+	}
 	return out, nil
 }
 
-func (q *RedisQueue) Close() {}
+// RemoveDeadLetter deletes the newest dead-letter entry for jobID and returns it
+func (q *RedisQueue) RemoveDeadLetter(ctx context.Context, jobID string) (*DeadLetter, error) {
+	if q.client == nil {
+		return nil, fmt.Errorf("redis client is nil")
+	}
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	msgs, err := q.client.XRevRange(ctx, q.dlqName(), "+", "-").Result()
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	for _, msg := range msgs {
+		if id, _ := msg.Values["job_id"].(string); id != jobID {
+			continue
+		}
+		dl, ok := decodeDeadLetter(msg)
+		if !ok {
+			continue
+		}
+		if err := q.client.XDel(ctx, q.dlqName(), msg.ID).Err(); err != nil {
+			return nil, err
+		}
+		return &dl, nil
+	}
+	return nil, fmt.Errorf("job %s is not in the dead-letter queue", jobID)
+}
+
+func decodeDeadLetter(msg redis.XMessage) (DeadLetter, bool) {
+	var dl DeadLetter
+	raw, ok := msg.Values["data"].(string)
+	if !ok || json.Unmarshal([]byte(raw), &dl) != nil || dl.Message.JobID == "" {
+		return dl, false
+	}
+	return dl, true
+}
+
+// Drain stops the consumer loop. Messages stay in the stream, and any this
+// consumer read but never acknowledged are reclaimed by other workers.
+func (q *RedisQueue) Drain(ctx context.Context) error {
+	q.Close()
+	return nil
+}
+
+// Close stops the consumer loop; the underlying Redis client is left open
+func (q *RedisQueue) Close() {
+	q.once.Do(func() {
+		close(q.stop)
+	})
+}
@@ -0,0 +1,273 @@
+// shared/queue_redis_test.go
+package shared
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	redis "github.com/redis/go-redis/v9"
+)
+
+// newTestRedisQueue returns a queue on client consuming as consumer, with the
+// claim settings given
+func newTestRedisQueue(t *testing.T, client *redis.Client, consumer string, minIdle, interval time.Duration) *RedisQueue {
+	t.Helper()
+	q := NewRedisQueue(client, &Config{
+		QueueName:      "jobs-test",
+		QueueMaxLength: 100,
+		ConsumerGroup:  "workers",
+		ClaimMinIdle:   minIdle,
+		ClaimInterval:  interval,
+	})
+	q.consumer = consumer
+	t.Cleanup(q.Close)
+	return q
+}
+
+// receive waits up to timeout for a message on ch
+func receive(t *testing.T, ch <-chan JobMessage, timeout time.Duration) (JobMessage, bool) {
+	t.Helper()
+	select {
+	case msg, ok := <-ch:
+		return msg, ok
+	case <-time.After(timeout):
+		return JobMessage{}, false
+	}
+}
+
+// pendingCount returns how many entries of stream the group has not had acknowledged
+func pendingCount(t *testing.T, client *redis.Client, stream string) int64 {
+	t.Helper()
+	p, err := client.XPending(context.Background(), stream, "workers").Result()
+	if err != nil {
+		t.Fatalf("XPENDING: %v", err)
+	}
+	return p.Count
+}
+
+func TestRedisQueueConsumersInGroupSplitMessages(t *testing.T) {
+	client, _ := newTestRedis(t)
+	ctx := context.Background()
+	const total = 10
+
+	first := newTestRedisQueue(t, client, "first", 0, 0)
+	second := newTestRedisQueue(t, client, "second", 0, 0)
+	firstMsgs, err := first.Consume(ctx)
+	if err != nil {
+		t.Fatalf("Consume: %v", err)
+	}
+	secondMsgs, err := second.Consume(ctx)
+	if err != nil {
+		t.Fatalf("Consume: %v", err)
+	}
+	for i := 0; i < total; i++ {
+		if err := first.Publish(ctx, JobMessage{JobID: fmt.Sprintf("job-%d", i)}); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+	}
+
+	seen := map[string]string{}
+	record := func(name string, q *RedisQueue, msg JobMessage) {
+		if other, dup := seen[msg.JobID]; dup {
+			t.Fatalf("%s delivered to both %s and %s", msg.JobID, other, name)
+		}
+		seen[msg.JobID] = name
+		if err := q.Ack(ctx, msg); err != nil {
+			t.Fatalf("Ack: %v", err)
+		}
+	}
+	take := func(name string, q *RedisQueue, msgs <-chan JobMessage) {
+		msg, ok := receive(t, msgs, 2*time.Second)
+		if !ok {
+			t.Fatalf("%s consumer got nothing", name)
+		}
+		record(name, q, msg)
+	}
+	// The first consumer is busy with one job while the second takes the rest
+	take("first", first, firstMsgs)
+	for len(seen) < total-2 {
+		take("second", second, secondMsgs)
+	}
+	// One more may be waiting in either consumer for its hand-off
+	for len(seen) < total {
+		select {
+		case msg := <-firstMsgs:
+			record("first", first, msg)
+		case msg := <-secondMsgs:
+			record("second", second, msg)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("only %d of %d messages delivered", len(seen), total)
+		}
+	}
+	counts := map[string]int{}
+	for _, name := range seen {
+		counts[name]++
+	}
+	if counts["first"] == 0 || counts["second"] == 0 {
+		t.Errorf("messages per consumer = %v, want both to get some", counts)
+	}
+	if n := pendingCount(t, client, "jobs-test"); n != 0 {
+		t.Errorf("pending entries = %d after acking everything, want 0", n)
+	}
+}
+
+func TestRedisQueueReclaimsMessagesOfCrashedConsumer(t *testing.T) {
+	client, _ := newTestRedis(t)
+	ctx := context.Background()
+
+	crashed := newTestRedisQueue(t, client, "crashed", 0, 0) // No claim loop
+	msgs, err := crashed.Consume(ctx)
+	if err != nil {
+		t.Fatalf("Consume: %v", err)
+	}
+	if err := crashed.Publish(ctx, JobMessage{JobID: "job-1"}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if msg, ok := receive(t, msgs, 2*time.Second); !ok || msg.JobID != "job-1" {
+		t.Fatalf("first consumer got %+v, %v; want job-1", msg, ok)
+	}
+	// The consumer dies mid-job: the entry stays pending
+	crashed.Close()
+	if n := pendingCount(t, client, "jobs-test"); n != 1 {
+		t.Fatalf("pending entries = %d, want 1 before the message is acknowledged", n)
+	}
+
+	survivor := newTestRedisQueue(t, client, "survivor", 100*time.Millisecond, 20*time.Millisecond)
+	msgs, err = survivor.Consume(ctx)
+	if err != nil {
+		t.Fatalf("Consume: %v", err)
+	}
+	msg, ok := receive(t, msgs, 2*time.Second)
+	if !ok || msg.JobID != "job-1" {
+		t.Fatalf("survivor got %+v, %v; want job-1 reclaimed", msg, ok)
+	}
+	if err := survivor.Ack(ctx, msg); err != nil {
+		t.Fatalf("Ack: %v", err)
+	}
+	if n := pendingCount(t, client, "jobs-test"); n != 0 {
+		t.Errorf("pending entries = %d after Ack, want 0", n)
+	}
+}
+
+func TestRedisQueueKeepsMessagesOfLiveConsumer(t *testing.T) {
+	client, _ := newTestRedis(t)
+	ctx := context.Background()
+
+	busy := newTestRedisQueue(t, client, "busy", 100*time.Millisecond, 20*time.Millisecond)
+	busyMsgs, err := busy.Consume(ctx)
+	if err != nil {
+		t.Fatalf("Consume: %v", err)
+	}
+	if err := busy.Publish(ctx, JobMessage{JobID: "job-1"}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	msg, ok := receive(t, busyMsgs, 2*time.Second)
+	if !ok {
+		t.Fatal("no message delivered")
+	}
+
+	// A job running far longer than the idle limit must not be taken over
+	idle := newTestRedisQueue(t, client, "idle", 100*time.Millisecond, 20*time.Millisecond)
+	idleMsgs, err := idle.Consume(ctx)
+	if err != nil {
+		t.Fatalf("Consume: %v", err)
+	}
+	if got, ok := receive(t, idleMsgs, 500*time.Millisecond); ok {
+		t.Fatalf("second consumer reclaimed %s while the first was still working on it", got.JobID)
+	}
+
+	if err := busy.Ack(ctx, msg); err != nil {
+		t.Fatalf("Ack: %v", err)
+	}
+	if n := pendingCount(t, client, "jobs-test"); n != 0 {
+		t.Errorf("pending entries = %d after Ack, want 0", n)
+	}
+}
+
+func TestRedisQueueAcksMalformedMessages(t *testing.T) {
+	client, _ := newTestRedis(t)
+	ctx := context.Background()
+
+	q := newTestRedisQueue(t, client, "worker", 0, 0)
+	msgs, err := q.Consume(ctx)
+	if err != nil {
+		t.Fatalf("Consume: %v", err)
+	}
+	if err := client.XAdd(ctx, &redis.XAddArgs{Stream: "jobs-test", Values: map[string]any{"data": "not json"}}).Err(); err != nil {
+		t.Fatalf("XADD: %v", err)
+	}
+	if err := q.Publish(ctx, JobMessage{JobID: "job-1"}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if msg, ok := receive(t, msgs, 2*time.Second); !ok || msg.JobID != "job-1" {
+		t.Fatalf("got %+v, %v; want job-1 after the malformed entry", msg, ok)
+	}
+	if n := pendingCount(t, client, "jobs-test"); n != 1 {
+		t.Errorf("pending entries = %d, want only job-1's", n)
+	}
+}
+
+func TestRedisQueuePublishSurfacesEncodeErrors(t *testing.T) {
+	client, _ := newTestRedis(t)
+	q := newTestRedisQueue(t, client, "worker-1", time.Minute, time.Minute)
+	// encoding/json refuses NaN, so this message can't be encoded
+	err := q.Publish(context.Background(), JobMessage{JobID: "job-1", ClipStart: math.NaN()})
+	if err == nil || !strings.Contains(err.Error(), "failed to encode message for job job-1") {
+		t.Errorf("Publish = %v, want the encode error", err)
+	}
+	if n, _ := client.XLen(context.Background(), "jobs-test").Result(); n != 0 {
+		t.Errorf("%d entries were queued", n)
+	}
+}
+
+func TestRedisQueueReadLoopSurvivesRedisRestart(t *testing.T) {
+	client, mr := newTestRedis(t)
+	q := newTestRedisQueue(t, client, "worker-a", 0, 0)
+	ch, err := q.Consume(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	mr.Close()
+	time.Sleep(300 * time.Millisecond) // A few failed reads
+	if err := mr.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Publish(ctx, JobMessage{JobID: "after-restart"}); err != nil {
+		t.Fatal(err)
+	}
+	if msg, ok := receive(t, ch, 5*time.Second); !ok || msg.JobID != "after-restart" {
+		t.Fatalf("after a restart got %+v (ok=%v), want job after-restart", msg, ok)
+	}
+
+	// Redis came back empty: the consumer group is recreated
+	mr.FlushAll()
+	if err := q.Publish(ctx, JobMessage{JobID: "after-flush"}); err != nil {
+		t.Fatal(err)
+	}
+	if msg, ok := receive(t, ch, 5*time.Second); !ok || msg.JobID != "after-flush" {
+		t.Fatalf("after a flush got %+v (ok=%v), want job after-flush", msg, ok)
+	}
+}
+
+func TestRedisQueueDepthCountsEveryPriority(t *testing.T) {
+	client, _ := newTestRedis(t)
+	q := newTestRedisQueue(t, client, "worker-a", 0, 0)
+	ctx := context.Background()
+	for i, p := range []Priority{PriorityHigh, PriorityNormal, PriorityLow} {
+		if err := q.Publish(ctx, JobMessage{JobID: fmt.Sprintf("job-%d", i), Priority: p}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// No consumer group yet: every entry of every priority is waiting.
+	// (miniredis reports a group's lag as the stream length, so the lag path
+	// can't be checked here.)
+	if depth, err := q.Depth(ctx); err != nil || depth != 3 {
+		t.Fatalf("Depth = %d, %v; want 3", depth, err)
+	}
+}
@@ -0,0 +1,166 @@
+// shared/queue_test.go
+package shared
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNewMessageQueueClientSelectsBackend(t *testing.T) {
+	_, mr := newTestRedis(t)
+
+	mq, err := NewMessageQueueClient(&Config{QueueMaxLength: 7})
+	if err != nil {
+		t.Fatalf("NewMessageQueueClient without Redis: %v", err)
+	}
+	defer mq.Close()
+	mem, ok := mq.(*InMemoryQueue)
+	if !ok {
+		t.Fatalf("without REDIS_ADDR got %T, want *InMemoryQueue", mq)
+	}
+	if mem.size != 7 {
+		t.Errorf("in-memory queue holds %d messages, want QueueMaxLength 7", mem.size)
+	}
+
+	mq, err = NewMessageQueueClient(&Config{RedisAddr: mr.Addr(), QueueName: "jobqueue", ConsumerGroup: "workers"})
+	if err != nil {
+		t.Fatalf("NewMessageQueueClient with Redis: %v", err)
+	}
+	defer mq.Close()
+	if _, ok := mq.(*RedisQueue); !ok {
+		t.Errorf("with REDIS_ADDR got %T, want *RedisQueue", mq)
+	}
+
+	if _, err := NewMessageQueueClient(&Config{RedisAddr: "127.0.0.1:1"}); err == nil {
+		t.Error("NewMessageQueueClient succeeded with Redis unreachable")
+	}
+}
+
+func TestInMemoryQueueCloseDuringPublishes(t *testing.T) {
+	log.SetOutput(io.Discard) // Every publish is logged
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	const publishers, perPublisher = 8, 200
+	q := NewInMemoryQueue(publishers * perPublisher)
+	messages, err := q.Consume(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := make(chan int)
+	go func() {
+		n := 0
+		for range messages {
+			n++
+		}
+		received <- n
+	}()
+
+	var published atomic.Int64
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for p := 0; p < publishers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			<-start
+			for i := 0; i < perPublisher; i++ {
+				err := q.Publish(context.Background(), JobMessage{JobID: fmt.Sprintf("job-%d-%d", p, i)})
+				if err == nil {
+					published.Add(1)
+				} else if !strings.Contains(err.Error(), "queue is closed") {
+					t.Errorf("Publish: %v", err)
+				}
+			}
+		}(p)
+	}
+	close(start)
+	time.Sleep(time.Millisecond)
+	q.Close()
+	wg.Wait()
+
+	if err := q.Publish(context.Background(), JobMessage{JobID: "late"}); err == nil {
+		t.Error("Publish after Close succeeded")
+	}
+	select {
+	case n := <-received:
+		if int64(n) != published.Load() {
+			t.Errorf("consumer received %d of %d published messages", n, published.Load())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the consumer channel was not closed")
+	}
+}
+
+func TestInMemoryQueueDrainDeliversBufferedMessages(t *testing.T) {
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	const buffered = 20
+	q := NewInMemoryQueue(buffered)
+	for i := 0; i < buffered; i++ {
+		if err := q.Publish(context.Background(), JobMessage{JobID: fmt.Sprintf("job-%d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	messages, err := q.Consume(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := make(chan int)
+	go func() {
+		n := 0
+		for range messages {
+			time.Sleep(5 * time.Millisecond) // A slow worker
+			n++
+		}
+		received <- n
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := q.Drain(ctx); err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+	if depth, _ := q.Depth(context.Background()); depth != 0 {
+		t.Errorf("Drain returned with %d message(s) buffered", depth)
+	}
+	if err := q.Publish(context.Background(), JobMessage{JobID: "late"}); err == nil {
+		t.Error("Publish after Drain succeeded")
+	}
+	select {
+	case n := <-received:
+		if n != buffered {
+			t.Errorf("consumer received %d of %d buffered messages", n, buffered)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the consumer channel was not closed after Drain")
+	}
+}
+
+func TestInMemoryQueueDrainStopsAtDeadline(t *testing.T) {
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	q := NewInMemoryQueue(4)
+	q.Publish(context.Background(), JobMessage{JobID: "job-1"})
+
+	// Nobody consumes, so the message is never taken
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := q.Drain(ctx)
+	if err == nil || !strings.Contains(err.Error(), "1 message(s) left") {
+		t.Errorf("Drain = %v, want the messages left", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Drain took %s past its deadline", elapsed)
+	}
+	if err := q.Publish(context.Background(), JobMessage{JobID: "late"}); err == nil {
+		t.Error("Publish after Drain succeeded")
+	}
+}
@@ -3,8 +3,10 @@ package shared
 import (
 	"context"
 	"fmt"
+	"math/rand"
 	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -12,51 +14,173 @@ import (
 	redis "github.com/redis/go-redis/v9"
 )
 
-// RateLimiter provides per-IP rate limiting with optional Redis backend
+const (
+	RateLimitStrategyFixed   = "fixed"
+	RateLimitStrategySliding = "sliding"
+)
+
+// Rate limit buckets; each has its own limit and counters
+const (
+	RateLimitBucketExtract  = "extract"
+	RateLimitBucketStatus   = "status"
+	RateLimitBucketDownload = "download"
+)
+
+// RateLimitBuckets lists every bucket, e.g. for reporting a client's usage
+var RateLimitBuckets = []string{RateLimitBucketExtract, RateLimitBucketStatus, RateLimitBucketDownload}
+
+const rateLimitWindow = time.Minute
+
+// RateLimiter provides per-IP rate limiting with optional Redis backend.
+// The fixed strategy counts requests per calendar minute, which lets a client
+// burst up to twice the limit across a minute boundary; the sliding strategy
+// keeps a log of request times and counts those in the last minute.
 type RateLimiter struct {
 	cfg        *Config
 	redis      *redis.Client
 	inMemMu    sync.Mutex
 	inMemCount map[string]int
+	inMemLog   map[string][]time.Time
 	inMemTTL   time.Time
+	allowlist  []*net.IPNet // Never limited; see SetAllowlist
+	now        func() time.Time
 }
 
 func NewRateLimiter(cfg *Config, redisClient *redis.Client) *RateLimiter {
-	return &RateLimiter{cfg: cfg, redis: redisClient, inMemCount: map[string]int{}}
+	return &RateLimiter{cfg: cfg, redis: redisClient, inMemCount: map[string]int{}, inMemLog: map[string][]time.Time{}, now: time.Now}
+}
+
+// SetAllowlist exempts clients whose IP is in one of entries, each a CIDR or
+// a single IP, from every bucket. It fails on a malformed entry.
+func (r *RateLimiter) SetAllowlist(entries []string) error {
+	nets, err := ParseIPNets(entries)
+	if err != nil {
+		return err
+	}
+	r.allowlist = nets
+	return nil
+}
+
+// ParseIPNets parses entries, each a CIDR or a single IP. It fails on a
+// malformed entry.
+func ParseIPNets(entries []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(entries))
+	for _, entry := range entries {
+		if ip := net.ParseIP(entry); ip != nil {
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP or CIDR %q", entry)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
 }
 
-// key for the current minute window
-func minuteKey(ip string) string {
-	return fmt.Sprintf("ratelimit:%s:%d", ip, time.Now().Unix()/60)
+// ipInNets reports whether ip parses and falls in one of nets
+func ipInNets(ip string, nets []*net.IPNet) bool {
+	if len(nets) == 0 {
+		return false
+	}
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, n := range nets {
+		if n.Contains(parsed) {
+			return true
+		}
+	}
+	return false
 }
 
-// Allow returns whether the request is allowed and remaining quota (best-effort)
-func (r *RateLimiter) Allow(ip string) (bool, int) {
-	rpm := r.cfg.RateLimitRPM
-	if rpm <= 0 {
+// Allowlisted reports whether ip is exempt from rate limiting
+func (r *RateLimiter) Allowlisted(ip string) bool {
+	return ipInNets(ip, r.allowlist)
+}
+
+// key for the minute window holding now; id is "<bucket>:<ip>"
+func minuteKey(id string, now time.Time) string {
+	return fmt.Sprintf("ratelimit:%s:%d", id, now.Unix()/60)
+}
+
+// slidingKey holds the sorted set of request timestamps for id
+func slidingKey(id string) string {
+	return fmt.Sprintf("ratelimit:%s:sliding", id)
+}
+
+// Limit returns the requests per minute allowed in bucket
+func (r *RateLimiter) Limit(bucket string) int {
+	switch bucket {
+	case RateLimitBucketExtract:
+		return r.cfg.RateLimitExtractRPM
+	case RateLimitBucketStatus:
+		return r.cfg.RateLimitStatusRPM
+	case RateLimitBucketDownload:
+		return r.cfg.RateLimitDownloadRPM
+	default:
+		return r.cfg.RateLimitRPM
+	}
+}
+
+// Allow returns whether a request from ip to bucket is allowed and the
+// remaining quota (best-effort)
+func (r *RateLimiter) Allow(bucket string, ip string) (bool, int) {
+	return r.AllowN(bucket, ip, 1)
+}
+
+// AllowN is Allow for n requests at once, e.g. a batch submission. Either
+// all n are allowed or none.
+func (r *RateLimiter) AllowN(bucket string, ip string, n int) (bool, int) {
+	rpm := r.Limit(bucket)
+	if rpm <= 0 || r.Allowlisted(ip) {
 		return true, rpm
 	}
+	id := bucket + ":" + ip
+	if r.cfg.RateLimitStrategy == RateLimitStrategySliding {
+		return r.allowSliding(id, rpm, n)
+	}
 	if r.redis != nil {
 		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
 		defer cancel()
-		key := minuteKey(ip)
-		n, err := r.redis.Incr(ctx, key).Result()
-		if err != nil {
+		// Expire ~65 seconds after the window opens, past the end of the minute
+		res, err := fixedScript.Run(ctx, r.redis, []string{minuteKey(id, r.now())},
+			rpm, n, (65 * time.Second).Milliseconds()).Int64Slice()
+		if err != nil || len(res) != 2 {
 			// Fallback to in-memory on error
-			return r.allowInMem(ip, rpm)
-		}
-		// Ensure expiry ~65 seconds for the rolling window minute
-		if n == 1 {
-			_ = r.redis.Expire(ctx, key, 65*time.Second).Err()
+			return r.allowInMem(id, rpm, n)
 		}
-		remaining := rpm - int(n)
-		return int(n) <= rpm, remaining
+		return res[0] == 1, rpm - int(res[1])
 	}
-	return r.allowInMem(ip, rpm)
+	return r.allowInMem(id, rpm, n)
 }
 
-func (r *RateLimiter) allowInMem(ip string, rpm int) (bool, int) {
-	now := time.Now()
+// fixedScript counts ARGV[2] requests in the window's counter only if they
+// all fit under the limit, so rejected requests don't use up the quota.
+// Returns {allowed, count}.
+var fixedScript = redis.NewScript(`
+local key = KEYS[1]
+local limit = tonumber(ARGV[1])
+local count = tonumber(ARGV[2])
+local n = tonumber(redis.call('GET', key) or '0')
+if n + count > limit then
+	return {0, n}
+end
+n = redis.call('INCRBY', key, count)
+if n == count then
+	redis.call('PEXPIRE', key, ARGV[3])
+end
+return {1, n}
+`)
+
+func (r *RateLimiter) allowInMem(id string, rpm int, n int) (bool, int) {
+	now := r.now()
 	// Reset counts on minute boundary
 	r.inMemMu.Lock()
 	defer r.inMemMu.Unlock()
@@ -64,28 +188,192 @@ func (r *RateLimiter) allowInMem(ip string, rpm int) (bool, int) {
 		r.inMemCount = map[string]int{}
 		r.inMemTTL = now
 	}
-	r.inMemCount[ip]++
-	n := r.inMemCount[ip]
-	remaining := rpm - n
-	return n <= rpm, remaining
+	count := r.inMemCount[id]
+	if count+n > rpm {
+		return false, rpm - count // Rejected requests aren't counted
+	}
+	count += n
+	r.inMemCount[id] = count
+	return true, rpm - count
 }
 
-// GetClientIP extracts client IP from headers or RemoteAddr
-func GetClientIP(r *http.Request) string {
-	// Try common proxy headers
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		// Use the first IP in the list
-		parts := strings.Split(xff, ",")
-		if len(parts) > 0 {
-			return strings.TrimSpace(parts[0])
+// slidingScript drops timestamps older than the window and records the
+// ARGV[5] requests only if they all fit under the limit, so rejected requests
+// don't extend the ban. Returns {allowed, count}.
+var slidingScript = redis.NewScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+local count = tonumber(ARGV[5])
+redis.call('ZREMRANGEBYSCORE', key, '-inf', now - window)
+local n = redis.call('ZCARD', key)
+if n + count > limit then
+	return {0, n}
+end
+for i = 1, count do
+	redis.call('ZADD', key, now, ARGV[4] .. ':' .. i)
+end
+redis.call('PEXPIRE', key, window)
+return {1, n + count}
+`)
+
+func (r *RateLimiter) allowSliding(id string, rpm int, n int) (bool, int) {
+	if r.redis == nil {
+		return r.allowSlidingInMem(id, rpm, n, r.now())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	now := r.now()
+	// Members must be unique even when two requests share a millisecond
+	member := fmt.Sprintf("%d-%d", now.UnixNano(), rand.Int63())
+	res, err := slidingScript.Run(ctx, r.redis, []string{slidingKey(id)},
+		now.UnixMilli(), rateLimitWindow.Milliseconds(), rpm, member, n).Int64Slice()
+	if err != nil || len(res) != 2 {
+		// Fallback to in-memory on error
+		return r.allowSlidingInMem(id, rpm, n, now)
+	}
+	return res[0] == 1, rpm - int(res[1])
+}
+
+func (r *RateLimiter) allowSlidingInMem(id string, rpm int, n int, now time.Time) (bool, int) {
+	r.inMemMu.Lock()
+	defer r.inMemMu.Unlock()
+	cutoff := now.Add(-rateLimitWindow)
+	// Forget clients that have been idle for a whole window
+	if now.Sub(r.inMemTTL) > rateLimitWindow {
+		for k, times := range r.inMemLog {
+			if len(times) == 0 || !times[len(times)-1].After(cutoff) {
+				delete(r.inMemLog, k)
+			}
+		}
+		r.inMemTTL = now
+	}
+	times := r.inMemLog[id]
+	i := 0
+	for i < len(times) && !times[i].After(cutoff) {
+		i++
+	}
+	times = times[i:]
+	if len(times)+n > rpm {
+		r.inMemLog[id] = times
+		return false, rpm - len(times)
+	}
+	for j := 0; j < n; j++ {
+		times = append(times, now)
+	}
+	r.inMemLog[id] = times
+	return true, rpm - len(times)
+}
+
+// RateLimitUsage is a client's standing in one bucket
+type RateLimitUsage struct {
+	Bucket    string `json:"bucket"`
+	Limit     int    `json:"limit"`     // Requests per minute; 0 means unlimited
+	Count     int    `json:"count"`     // Requests counted in the current window
+	Remaining int    `json:"remaining"` // Never below 0
+}
+
+// Usage returns ip's request counts in every bucket without counting a request
+func (r *RateLimiter) Usage(ctx context.Context, ip string) ([]RateLimitUsage, error) {
+	usage := make([]RateLimitUsage, 0, len(RateLimitBuckets))
+	for _, bucket := range RateLimitBuckets {
+		count, err := r.count(ctx, bucket+":"+ip, r.now())
+		if err != nil {
+			return nil, err
+		}
+		limit := r.Limit(bucket)
+		usage = append(usage, RateLimitUsage{Bucket: bucket, Limit: limit, Count: count, Remaining: max(limit-count, 0)})
+	}
+	return usage, nil
+}
+
+// count returns how many requests id has made in the current window
+func (r *RateLimiter) count(ctx context.Context, id string, now time.Time) (int, error) {
+	sliding := r.cfg.RateLimitStrategy == RateLimitStrategySliding
+	if r.redis != nil {
+		ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		defer cancel()
+		if sliding {
+			cutoff := strconv.FormatInt(now.Add(-rateLimitWindow).UnixMilli(), 10)
+			n, err := r.redis.ZCount(ctx, slidingKey(id), "("+cutoff, "+inf").Result()
+			return int(n), err
+		}
+		n, err := r.redis.Get(ctx, minuteKey(id, now)).Int()
+		if err == redis.Nil {
+			return 0, nil
+		}
+		return n, err
+	}
+	r.inMemMu.Lock()
+	defer r.inMemMu.Unlock()
+	if sliding {
+		cutoff := now.Add(-rateLimitWindow)
+		n := 0
+		for _, t := range r.inMemLog[id] {
+			if t.After(cutoff) {
+				n++
+			}
 		}
+		return n, nil
+	}
+	if now.Sub(r.inMemTTL) > 60*time.Second {
+		return 0, nil // The counts are reset on the next request
 	}
-	if rip := r.Header.Get("X-Real-IP"); rip != "" {
-		return strings.TrimSpace(rip)
+	return r.inMemCount[id], nil
+}
+
+// Reset forgets ip's requests in every bucket, so its next ones get the full
+// limit again. In-memory counts are cleared too, as they stand in while
+// Redis is unreachable.
+func (r *RateLimiter) Reset(ctx context.Context, ip string) error {
+	r.inMemMu.Lock()
+	for _, bucket := range RateLimitBuckets {
+		delete(r.inMemCount, bucket+":"+ip)
+		delete(r.inMemLog, bucket+":"+ip)
+	}
+	r.inMemMu.Unlock()
+	if r.redis == nil {
+		return nil
+	}
+	keys := make([]string, 0, 2*len(RateLimitBuckets))
+	for _, bucket := range RateLimitBuckets {
+		keys = append(keys, minuteKey(bucket+":"+ip, r.now()), slidingKey(bucket+":"+ip))
+	}
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	return r.redis.Del(ctx, keys...).Err()
+}
+
+// ClientIP returns the IP of the client that sent r. X-Forwarded-For and
+// X-Real-IP are only believed when r comes from one of trusted, as anyone
+// else could set them to pick the IP they are limited by. X-Forwarded-For is
+// read right to left and the first hop that isn't a trusted proxy wins, so a
+// client can't get a spoofed entry past the proxy by prepending it.
+func ClientIP(r *http.Request, trusted []*net.IPNet) string {
+	client := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil && host != "" {
+		client = host
+	}
+	if !ipInNets(client, trusted) {
+		return client
+	}
+	if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+		hops := strings.Split(strings.Join(xff, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if net.ParseIP(hop) == nil {
+				break // Garbage; keep the last hop we could vouch for
+			}
+			client = hop
+			if !ipInNets(hop, trusted) {
+				break
+			}
+		}
+		return client
 	}
-	host, _, err := net.SplitHostPort(r.RemoteAddr)
-	if err == nil && host != "" {
-		return host
+	if rip := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(rip) != nil {
+		return rip
 	}
-	return r.RemoteAddr
+	return client
 }
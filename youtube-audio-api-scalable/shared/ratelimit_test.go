@@ -0,0 +1,235 @@
+// shared/ratelimit_test.go
+package shared
+
+import (
+	"context"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+// rateLimitTestConfig limits every bucket to rpm requests per minute
+func rateLimitTestConfig(strategy string, rpm int) *Config {
+	return &Config{
+		RateLimitStrategy:    strategy,
+		RateLimitRPM:         rpm,
+		RateLimitExtractRPM:  rpm,
+		RateLimitStatusRPM:   rpm,
+		RateLimitDownloadRPM: rpm,
+	}
+}
+
+func TestRateLimiterRejectsRequestOverLimit(t *testing.T) {
+	const limit = 5
+	client, _ := newTestRedis(t)
+	limiters := map[string]*RateLimiter{
+		"in-memory": NewRateLimiter(rateLimitTestConfig(RateLimitStrategyFixed, limit), nil),
+		"redis":     NewRateLimiter(rateLimitTestConfig(RateLimitStrategyFixed, limit), client),
+	}
+	for name, rl := range limiters {
+		t.Run(name, func(t *testing.T) {
+			for i := 1; i <= limit; i++ {
+				ok, remaining := rl.Allow(RateLimitBucketExtract, "203.0.113.7")
+				if !ok || remaining != limit-i {
+					t.Fatalf("request %d: allowed %v, remaining %d", i, ok, remaining)
+				}
+			}
+			if ok, _ := rl.Allow(RateLimitBucketExtract, "203.0.113.7"); ok {
+				t.Errorf("request %d was allowed", limit+1)
+			}
+			if ok, _ := rl.Allow(RateLimitBucketExtract, "203.0.113.8"); !ok {
+				t.Error("another IP was limited")
+			}
+		})
+	}
+}
+
+func TestRateLimiterRejectedBatchUsesNoQuota(t *testing.T) {
+	const limit = 5
+	for _, strategy := range []string{RateLimitStrategyFixed, RateLimitStrategySliding} {
+		client, _ := newTestRedis(t)
+		limiters := map[string]*RateLimiter{
+			"in-memory": NewRateLimiter(rateLimitTestConfig(strategy, limit), nil),
+			"redis":     NewRateLimiter(rateLimitTestConfig(strategy, limit), client),
+		}
+		for name, rl := range limiters {
+			t.Run(strategy+"/"+name, func(t *testing.T) {
+				if ok, remaining := rl.AllowN(RateLimitBucketExtract, "203.0.113.7", 3); !ok || remaining != 2 {
+					t.Fatalf("first batch: allowed %v, remaining %d", ok, remaining)
+				}
+				if ok, remaining := rl.AllowN(RateLimitBucketExtract, "203.0.113.7", 3); ok || remaining != 2 {
+					t.Fatalf("batch over the limit: allowed %v, remaining %d", ok, remaining)
+				}
+				if ok, remaining := rl.AllowN(RateLimitBucketExtract, "203.0.113.7", 2); !ok || remaining != 0 {
+					t.Errorf("batch fitting the rest of the quota: allowed %v, remaining %d", ok, remaining)
+				}
+			})
+		}
+	}
+}
+
+func TestRateLimiterStrategiesAcrossWindowBoundary(t *testing.T) {
+	const limit = 5
+	windowStart := time.Unix(60*29000000, 0) // On a minute boundary
+	tests := []struct {
+		strategy    string
+		allowsBurst bool // A second burst just after the boundary
+	}{
+		{RateLimitStrategyFixed, true},
+		{RateLimitStrategySliding, false},
+	}
+	for _, tt := range tests {
+		client, _ := newTestRedis(t)
+		limiters := map[string]*RateLimiter{
+			"in-memory": NewRateLimiter(rateLimitTestConfig(tt.strategy, limit), nil),
+			"redis":     NewRateLimiter(rateLimitTestConfig(tt.strategy, limit), client),
+		}
+		for name, rl := range limiters {
+			t.Run(tt.strategy+"/"+name, func(t *testing.T) {
+				now := windowStart
+				rl.now = func() time.Time { return now }
+				rl.Allow(RateLimitBucketExtract, "203.0.113.7") // Opens the in-memory window
+
+				now = windowStart.Add(59 * time.Second)
+				if ok, _ := rl.AllowN(RateLimitBucketExtract, "203.0.113.7", limit-1); !ok {
+					t.Fatal("the first burst was rejected")
+				}
+				now = windowStart.Add(61 * time.Second)
+				if ok, _ := rl.AllowN(RateLimitBucketExtract, "203.0.113.7", limit); ok != tt.allowsBurst {
+					t.Errorf("burst across the boundary allowed = %v, want %v", ok, tt.allowsBurst)
+				}
+			})
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	trusted, err := ParseIPNets([]string{"10.0.0.0/8", "192.0.2.10"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		remote  string
+		headers map[string]string
+		want    string
+	}{
+		{"direct", "203.0.113.5:4321", nil, "203.0.113.5"},
+		{"spoofed forwarded-for", "203.0.113.5:4321", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "203.0.113.5"},
+		{"spoofed real-ip", "203.0.113.5:4321", map[string]string{"X-Real-IP": "198.51.100.1"}, "203.0.113.5"},
+		{"trusted proxy", "10.1.2.3:80", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "198.51.100.1"},
+		{"prepended spoof", "10.1.2.3:80", map[string]string{"X-Forwarded-For": "1.1.1.1, 198.51.100.1"}, "198.51.100.1"},
+		{"proxy chain", "192.0.2.10:80", map[string]string{"X-Forwarded-For": "198.51.100.1, 10.9.9.9"}, "198.51.100.1"},
+		{"garbage hop", "10.1.2.3:80", map[string]string{"X-Forwarded-For": "not-an-ip"}, "10.1.2.3"},
+		{"trusted real-ip", "10.1.2.3:80", map[string]string{"X-Real-IP": "198.51.100.1"}, "198.51.100.1"},
+		{"trusted without headers", "10.1.2.3:80", nil, "10.1.2.3"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tt.remote
+		for k, v := range tt.headers {
+			r.Header.Set(k, v)
+		}
+		if got := ClientIP(r, trusted); got != tt.want {
+			t.Errorf("%s: ClientIP = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseIPNetsRejectsMalformedEntries(t *testing.T) {
+	for _, entry := range []string{"10.0.0.0/33", "10.0.0", "example.com", "::1/129"} {
+		if _, err := ParseIPNets([]string{"10.0.0.0/8", entry}); err == nil {
+			t.Errorf("ParseIPNets accepted %q", entry)
+		}
+	}
+	nets, err := ParseIPNets([]string{"10.0.0.0/8", "192.0.2.1", "2001:db8::/32"})
+	if err != nil || len(nets) != 3 {
+		t.Fatalf("ParseIPNets = %v, %v", nets, err)
+	}
+}
+
+func TestRateLimiterAllowlist(t *testing.T) {
+	const limit = 2
+	rl := NewRateLimiter(rateLimitTestConfig(RateLimitStrategyFixed, limit), nil)
+	if err := rl.SetAllowlist([]string{"10.0.0.0/8", "192.0.2.1", "2001:db8::/32"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, ip := range []string{"10.1.2.3", "192.0.2.1", "2001:db8::5"} {
+		for i := 1; i <= limit+3; i++ {
+			if ok, _ := rl.Allow(RateLimitBucketExtract, ip); !ok {
+				t.Fatalf("allowlisted %s was limited at request %d", ip, i)
+			}
+		}
+	}
+	for _, ip := range []string{"192.0.2.2", "11.0.0.1"} {
+		for i := 1; i <= limit; i++ {
+			if ok, _ := rl.Allow(RateLimitBucketExtract, ip); !ok {
+				t.Fatalf("%s was limited at request %d", ip, i)
+			}
+		}
+		if ok, _ := rl.Allow(RateLimitBucketExtract, ip); ok {
+			t.Errorf("%s, not allowlisted, was allowed past the limit", ip)
+		}
+	}
+
+	// A malformed entry is rejected and leaves the allowlist as it was
+	if err := rl.SetAllowlist([]string{"172.16.0.0/12", "10.0.0.0/33"}); err == nil {
+		t.Error("SetAllowlist accepted 10.0.0.0/33")
+	}
+	if !rl.Allowlisted("10.1.2.3") || rl.Allowlisted("172.16.0.1") {
+		t.Error("a rejected allowlist replaced the previous one")
+	}
+}
+
+func TestRateLimiterUsageAndReset(t *testing.T) {
+	const limit = 5
+	for _, strategy := range []string{RateLimitStrategyFixed, RateLimitStrategySliding} {
+		client, _ := newTestRedis(t)
+		limiters := map[string]*RateLimiter{
+			"in-memory": NewRateLimiter(rateLimitTestConfig(strategy, limit), nil),
+			"redis":     NewRateLimiter(rateLimitTestConfig(strategy, limit), client),
+		}
+		for name, rl := range limiters {
+			t.Run(strategy+"/"+name, func(t *testing.T) {
+				ctx := context.Background()
+				rl.AllowN(RateLimitBucketExtract, "203.0.113.7", 3)
+				rl.Allow(RateLimitBucketStatus, "203.0.113.7")
+				rl.Allow(RateLimitBucketExtract, "203.0.113.8")
+
+				usage, err := rl.Usage(ctx, "203.0.113.7")
+				if err != nil {
+					t.Fatal(err)
+				}
+				want := []RateLimitUsage{
+					{Bucket: RateLimitBucketExtract, Limit: limit, Count: 3, Remaining: 2},
+					{Bucket: RateLimitBucketStatus, Limit: limit, Count: 1, Remaining: 4},
+					{Bucket: RateLimitBucketDownload, Limit: limit, Count: 0, Remaining: 5},
+				}
+				if !slices.Equal(usage, want) {
+					t.Fatalf("Usage = %+v, want %+v", usage, want)
+				}
+				// Reading counts no request
+				if again, _ := rl.Usage(ctx, "203.0.113.7"); !slices.Equal(again, want) {
+					t.Errorf("Usage changed on a second read: %+v", again)
+				}
+
+				if err := rl.Reset(ctx, "203.0.113.7"); err != nil {
+					t.Fatal(err)
+				}
+				usage, _ = rl.Usage(ctx, "203.0.113.7")
+				for _, u := range usage {
+					if u.Count != 0 || u.Remaining != limit {
+						t.Errorf("after Reset: %+v", u)
+					}
+				}
+				if ok, remaining := rl.Allow(RateLimitBucketExtract, "203.0.113.7"); !ok || remaining != limit-1 {
+					t.Errorf("after Reset: allowed %v, remaining %d; want the full limit", ok, remaining)
+				}
+				if other, _ := rl.Usage(ctx, "203.0.113.8"); other[0].Count != 1 {
+					t.Errorf("Reset cleared another IP: %+v", other)
+				}
+			})
+		}
+	}
+}
@@ -2,11 +2,29 @@ package shared
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
 	"time"
 
 	redis "github.com/redis/go-redis/v9"
 )
 
+// ErrStorageUnavailable wraps the error of a Redis call that kept failing
+// because Redis couldn't be reached, as opposed to an error in its reply
+var ErrStorageUnavailable = errors.New("storage temporarily unavailable")
+
+const (
+	// redisCallAttempts and redisCallTimeout bound each call made through
+	// withRedisRetry; attempts are redisRetryBackoff apart, growing linearly
+	redisCallAttempts = 3
+	redisCallTimeout  = 2 * time.Second
+	redisRetryBackoff = 100 * time.Millisecond
+	// readRetryMaxBackoff caps the wait between the consumer's failed reads
+	readRetryMaxBackoff = 10 * time.Second
+)
+
 // NewRedisClient constructs a go-redis client from Config
 func NewRedisClient(cfg *Config) *redis.Client {
 	if cfg == nil || cfg.RedisAddr == "" {
@@ -16,13 +34,65 @@ func NewRedisClient(cfg *Config) *redis.Client {
 		Addr:     cfg.RedisAddr,
 		Password: cfg.RedisPassword,
 		DB:       cfg.RedisDB,
+		// Zero values fall back to go-redis's defaults
+		PoolSize:     cfg.RedisPoolSize,
+		MinIdleConns: cfg.RedisMinIdleConns,
 		// Reasonable timeouts
 		DialTimeout:  5 * time.Second,
 		ReadTimeout:  3 * time.Second,
 		WriteTimeout: 3 * time.Second,
+		// Stop waiting on Redis once the caller's context is done
+		ContextTimeoutEnabled: true,
 	})
 }
 
+// withRedisRetry runs fn with a per-attempt timeout, trying again after errors
+// that mean Redis is unreachable, e.g. while it restarts. Those errors count
+// toward redis_errors_total; if the last attempt still fails with one, it is
+// returned wrapped with ErrStorageUnavailable. Other errors return right away.
+// fn may run more than once, so it must be safe to repeat, and may still be
+// running when a cancelled call returns.
+func withRedisRetry(ctx context.Context, op string, fn func(ctx context.Context) error) error {
+	var err error
+	for attempt := 1; attempt <= redisCallAttempts; attempt++ {
+		callCtx, cancel := context.WithTimeout(ctx, redisCallTimeout)
+		// go-redis only notices deadlines, not cancellation, while it waits on
+		// the socket; don't keep the caller waiting once ctx is done. The call
+		// itself ends by its deadline.
+		done := make(chan error, 1)
+		go func() { done <- fn(callCtx) }()
+		select {
+		case err = <-done:
+		case <-ctx.Done():
+			cancel()
+			return ctx.Err()
+		}
+		cancel()
+		if err == nil || !isRedisUnavailable(err) {
+			return err
+		}
+		RedisErrorsTotal.WithLabelValues(op).Inc()
+		if attempt == redisCallAttempts || ctx.Err() != nil {
+			break
+		}
+		select {
+		case <-time.After(time.Duration(attempt) * redisRetryBackoff):
+		case <-ctx.Done():
+		}
+	}
+	return fmt.Errorf("%w: %s: %w", ErrStorageUnavailable, op, err)
+}
+
+// isRedisUnavailable reports whether err means Redis couldn't be reached or
+// didn't answer in time, rather than that it rejected the command
+func isRedisUnavailable(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, redis.ErrClosed)
+}
+
 // PingRedis validates the connection.
 func PingRedis(client *redis.Client) error {
 	if client == nil {
@@ -0,0 +1,131 @@
+// shared/redis_client_test.go
+package shared
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	redis "github.com/redis/go-redis/v9"
+)
+
+// newTestRedis starts a miniredis server for the test and returns a client for it
+func newTestRedis(t *testing.T) (*redis.Client, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return client, mr
+}
+
+// unresponsiveRedis accepts connections and never answers, like a hung server
+func unresponsiveRedis(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	var conns []net.Conn
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+		}
+	}()
+	t.Cleanup(func() {
+		ln.Close()
+		mu.Lock()
+		defer mu.Unlock()
+		for _, c := range conns {
+			c.Close()
+		}
+	})
+	return ln.Addr().String()
+}
+
+func TestRedisCallsReturnOnCancel(t *testing.T) {
+	client := NewRedisClient(&Config{RedisAddr: unresponsiveRedis(t)})
+	t.Cleanup(func() { client.Close() })
+	db := NewRedisDB(client, 0, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	_, err := db.GetJob(ctx, "job-1")
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("GetJob returned %s after the context was cancelled", elapsed-50*time.Millisecond)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("GetJob = %v, want context.Canceled", err)
+	}
+}
+
+func TestNewRedisClientUsesPoolSettings(t *testing.T) {
+	if NewRedisClient(&Config{}) != nil {
+		t.Error("a client was created without REDIS_ADDR")
+	}
+	t.Setenv("REDIS_ADDR", "redis:6379")
+	t.Setenv("REDIS_POOL_SIZE", "32")
+	t.Setenv("REDIS_MIN_IDLE_CONNS", "4")
+	client := NewRedisClient(LoadConfig())
+	defer client.Close()
+	if opts := client.Options(); opts.Addr != "redis:6379" || opts.PoolSize != 32 || opts.MinIdleConns != 4 {
+		t.Errorf("client options: addr %s, pool %d, min idle %d", opts.Addr, opts.PoolSize, opts.MinIdleConns)
+	}
+}
+
+func TestRedisBackendsFailOnUnreachableAddress(t *testing.T) {
+	_, mr := newTestRedis(t)
+	if err := PingRedis(NewRedisClient(&Config{RedisAddr: mr.Addr()})); err != nil {
+		t.Errorf("PingRedis with a live server: %v", err)
+	}
+	if err := PingRedis(nil); err != nil {
+		t.Errorf("PingRedis without Redis configured: %v", err)
+	}
+
+	bad := &Config{RedisAddr: "127.0.0.1:1", QueueName: "jobs", ConsumerGroup: "workers"}
+	if err := PingRedis(NewRedisClient(bad)); err == nil {
+		t.Error("PingRedis succeeded with nothing listening")
+	}
+	if _, err := NewMessageQueueClient(bad); err == nil {
+		t.Error("NewMessageQueueClient fell back instead of failing")
+	}
+	if _, err := NewDatabaseClient(bad); err == nil {
+		t.Error("NewDatabaseClient fell back instead of failing")
+	}
+}
+
+func TestRedisDBReportsStorageUnavailable(t *testing.T) {
+	client, mr := newTestRedis(t)
+	db := NewRedisDB(client, 0, 0)
+	if err := db.CreateJob(context.Background(), &Job{ID: "job-1", Status: JobStatusPending}); err != nil {
+		t.Fatal(err)
+	}
+
+	mr.Close()
+	if _, err := db.GetJob(context.Background(), "job-1"); !errors.Is(err, ErrStorageUnavailable) {
+		t.Errorf("GetJob with Redis down = %v, want ErrStorageUnavailable", err)
+	}
+	err := db.UpdateJob(context.Background(), &Job{ID: "job-1", Status: JobStatusFailed})
+	if !errors.Is(err, ErrStorageUnavailable) {
+		t.Errorf("UpdateJob with Redis down = %v, want ErrStorageUnavailable", err)
+	}
+
+	// Not found is still reported as such once Redis is back
+	if err := mr.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.GetJob(context.Background(), "job-2"); err == nil || errors.Is(err, ErrStorageUnavailable) {
+		t.Errorf("GetJob of a missing job = %v, want a not found error", err)
+	}
+}
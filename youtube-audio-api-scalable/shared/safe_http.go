@@ -0,0 +1,60 @@
+// shared/safe_http.go
+package shared
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// maxSafeRedirects caps the redirects a safe client follows
+const maxSafeRedirects = 5
+
+// SafeDialContext returns a DialContext that resolves the host itself and
+// connects only to the addresses it checked, as IsSafeRemoteURL does. Checking
+// a URL up front isn't enough on its own: the host may resolve to an internal
+// address by the time it is connected to (DNS rebinding). Hosts, IPs or CIDRs
+// listed in allowlist may be internal.
+func SafeDialContext(allowlist ...string) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		ips, err := resolveSafeIPs(ctx, host, allowlist)
+		if err != nil {
+			return nil, err
+		}
+		var lastErr error
+		for _, ip := range ips {
+			conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+		}
+		return nil, lastErr
+	}
+}
+
+// NewSafeHTTPClient returns a client for URLs that come from clients or from
+// the extractor: it connects through SafeDialContext, ignores proxy settings,
+// which would hide the real destination, and checks every redirect target
+func NewSafeHTTPClient(timeout time.Duration, allowlist ...string) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = SafeDialContext(allowlist...)
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxSafeRedirects {
+				return fmt.Errorf("too many redirects")
+			}
+			return IsSafeRemoteURL(req.URL.String(), allowlist...)
+		},
+	}
+}
@@ -0,0 +1,104 @@
+// shared/storage.go
+package shared
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	StorageBackendLocal = "local"
+	StorageBackendS3    = "s3"
+)
+
+// Storage is where converted files live once a job completes
+type Storage interface {
+	// Put stores the contents of r under key and returns the stored object's location
+	Put(ctx context.Context, key string, r io.Reader) (string, error)
+	Delete(ctx context.Context, key string) error
+	// SignedURL returns a URL that can fetch key for the next ttl
+	SignedURL(key string, ttl time.Duration) (string, error)
+}
+
+// NewStorage returns the Storage backend selected by cfg.StorageBackend
+func NewStorage(cfg *Config) (Storage, error) {
+	switch cfg.StorageBackend {
+	case "", StorageBackendLocal:
+		return NewLocalStorage(cfg.OutputDir, cfg.PublicAPIBaseURL, cfg.APIGatewayPort, cfg.DownloadSecret), nil
+	case StorageBackendS3:
+		return NewS3Storage(cfg)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.StorageBackend)
+	}
+}
+
+// LocalStorage keeps files in a local directory served by the API Gateway
+type LocalStorage struct {
+	dir     string
+	baseURL string
+	secret  string // Signs download links; see DownloadPath
+}
+
+// NewLocalStorage creates a LocalStorage rooted at dir. Download links point at
+// baseURL, or at localhost:port when no public base URL is configured, and
+// are signed with secret when it is set.
+func NewLocalStorage(dir string, baseURL string, port string, secret string) *LocalStorage {
+	if strings.TrimSpace(baseURL) == "" {
+		if port == "" {
+			port = DefaultAPIGatewayPort
+		}
+		baseURL = fmt.Sprintf("http://localhost:%s", port)
+	}
+	return &LocalStorage{dir: dir, baseURL: strings.TrimRight(baseURL, "/"), secret: secret}
+}
+
+func (s *LocalStorage) path(key string) string {
+	return filepath.Join(s.dir, filepath.Base(key))
+}
+
+// Put writes to a temp file and renames it into place, so storing a file that
+// already lives at the destination (the worker's output) is safe
+func (s *LocalStorage) Put(ctx context.Context, key string, r io.Reader) (string, error) {
+	if err := os.MkdirAll(s.dir, os.ModePerm); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(s.dir, ".upload-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	dst := s.path(key)
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		return "", err
+	}
+	return dst, nil
+}
+
+func (s *LocalStorage) Delete(ctx context.Context, key string) error {
+	err := os.Remove(s.path(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// SignedURL returns the gateway's download link; local files are served by job ID
+func (s *LocalStorage) SignedURL(key string, ttl time.Duration) (string, error) {
+	jobID := strings.TrimSuffix(filepath.Base(key), filepath.Ext(key))
+	if i := strings.IndexByte(jobID, '_'); i >= 0 {
+		jobID = jobID[:i] // Clips are named <jobID>_clip_<range>
+	}
+	return s.baseURL + DownloadPath(s.secret, jobID, ttl), nil
+}
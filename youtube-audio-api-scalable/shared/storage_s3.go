@@ -0,0 +1,98 @@
+package shared
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// S3Storage implements Storage on Amazon S3 or any S3-compatible service
+// (MinIO, R2, ...). Objects are stored as <S3Prefix>/<key> in S3Bucket.
+type S3Storage struct {
+	client  *s3.Client
+	presign *s3.PresignClient
+	bucket  string
+	prefix  string
+}
+
+func NewS3Storage(cfg *Config) (*S3Storage, error) {
+	if cfg.S3Bucket == "" {
+		return nil, fmt.Errorf("S3_BUCKET is required for the s3 storage backend")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	opts := []func(*awsconfig.LoadOptions) error{}
+	if cfg.S3Region != "" {
+		opts = append(opts, awsconfig.WithRegion(cfg.S3Region))
+	}
+	if cfg.S3AccessKey != "" {
+		opts = append(opts, awsconfig.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(cfg.S3AccessKey, cfg.S3SecretKey, "")))
+	}
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	client := s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+		if cfg.S3Endpoint != "" {
+			o.BaseEndpoint = aws.String(cfg.S3Endpoint)
+		}
+		o.UsePathStyle = cfg.S3UsePathStyle
+	})
+	return &S3Storage{
+		client:  client,
+		presign: s3.NewPresignClient(client),
+		bucket:  cfg.S3Bucket,
+		prefix:  cfg.S3Prefix,
+	}, nil
+}
+
+func (s *S3Storage) objectKey(key string) string {
+	if s.prefix == "" {
+		return key
+	}
+	return path.Join(s.prefix, key)
+}
+
+func (s *S3Storage) Put(ctx context.Context, key string, r io.Reader) (string, error) {
+	k := s.objectKey(key)
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(k),
+		Body:        r,
+		ContentType: aws.String(FormatForExt(strings.TrimPrefix(path.Ext(key), ".")).ContentType),
+	})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("s3://%s/%s", s.bucket, k), nil
+}
+
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.objectKey(key)),
+	})
+	return err
+}
+
+func (s *S3Storage) SignedURL(key string, ttl time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := s.presign.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.objectKey(key)),
+	}, s3.WithPresignExpires(ttl))
+	if err != nil {
+		return "", err
+	}
+	return req.URL, nil
+}
@@ -0,0 +1,63 @@
+// shared/storage_test.go
+package shared
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalStorage(t *testing.T) {
+	dir := t.TempDir()
+	s := NewLocalStorage(dir, "https://api.example.com/", "", "")
+	ctx := context.Background()
+
+	location, err := s.Put(ctx, "job-1.mp3", strings.NewReader("audio"))
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if location != filepath.Join(dir, "job-1.mp3") {
+		t.Errorf("Put location = %q", location)
+	}
+	if b, _ := os.ReadFile(location); string(b) != "audio" {
+		t.Errorf("stored %q", b)
+	}
+	// Keys never escape the directory
+	if location, _ := s.Put(ctx, "../escape.mp3", strings.NewReader("x")); filepath.Dir(location) != dir {
+		t.Errorf("Put wrote outside the storage dir: %s", location)
+	}
+
+	for key, want := range map[string]string{
+		"job-1.mp3":             "https://api.example.com/download/job-1",
+		"job-2_clip_10-20.opus": "https://api.example.com/download/job-2",
+		"outputs/job-3.flac":    "https://api.example.com/download/job-3",
+	} {
+		if got, _ := s.SignedURL(key, time.Hour); got != want {
+			t.Errorf("SignedURL(%q) = %q, want %q", key, got, want)
+		}
+	}
+
+	if err := s.Delete(ctx, "job-1.mp3"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := os.Stat(location); !os.IsNotExist(err) {
+		t.Error("Delete left the file")
+	}
+	if err := s.Delete(ctx, "job-1.mp3"); err != nil {
+		t.Errorf("Delete of a missing file: %v", err)
+	}
+}
+
+func TestNewStorageRejectsUnknownBackend(t *testing.T) {
+	if _, err := NewStorage(&Config{StorageBackend: "ftp"}); err == nil {
+		t.Error("NewStorage accepted an unknown backend")
+	}
+	if s, err := NewStorage(&Config{OutputDir: t.TempDir()}); err != nil {
+		t.Errorf("NewStorage with the default backend: %v", err)
+	} else if _, ok := s.(*LocalStorage); !ok {
+		t.Errorf("default backend is %T, want *LocalStorage", s)
+	}
+}
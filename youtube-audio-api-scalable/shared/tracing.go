@@ -0,0 +1,74 @@
+// shared/tracing.go
+package shared
+
+import (
+	"context"
+	"log"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName identifies spans created by this module
+const tracerName = "youtube-audio-api-scalable"
+
+// InitTracing installs a global tracer provider that exports spans over OTLP/HTTP
+// when OTEL_EXPORTER_OTLP_ENDPOINT is set; otherwise spans are no-ops. The
+// exporter reads the standard OTEL_EXPORTER_OTLP_* variables itself. The
+// returned func flushes pending spans and must be called on shutdown.
+func InitTracing(service string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	if strings.TrimSpace(os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")) == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	exporter, err := otlptracehttp.New(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(service)))
+	if err != nil {
+		return nil, err
+	}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(tp)
+	log.Printf("INFO: Exporting traces to %s", os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"))
+	return tp.Shutdown, nil
+}
+
+// Tracer returns the tracer for spans created by this module
+func Tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// InjectTraceContext serializes the span context in ctx for a JobMessage
+func InjectTraceContext(ctx context.Context) map[string]string {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return nil
+	}
+	return carrier
+}
+
+// ExtractTraceContext returns a context carrying the span context serialized
+// by InjectTraceContext, so spans started from it continue the trace
+func ExtractTraceContext(carrier map[string]string) context.Context {
+	return otel.GetTextMapPropagator().Extract(context.Background(), propagation.MapCarrier(carrier))
+}
+
+// EndSpan records err (if any) on span and ends it
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,348 @@
+// shared/validate.go
+package shared
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxCookiesSize limits the decoded size of per-request cookies; base64
+// encoded, they must still fit in a MaxJSONBodySize request
+const MaxCookiesSize = 32 << 10
+
+// DecodeCookies decodes a base64 cookies file sent with a request
+func DecodeCookies(b64 string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(b64))
+	if err != nil {
+		return nil, fmt.Errorf("cookies must be base64-encoded: %v", err)
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("cookies are empty")
+	}
+	if len(data) > MaxCookiesSize {
+		return nil, fmt.Errorf("cookies exceed %d bytes", MaxCookiesSize)
+	}
+	return data, nil
+}
+
+// Limits on client metadata, which is stored with every job it is sent with
+const (
+	MaxClientMetadataKeys   = 20
+	MaxClientMetadataSize   = 4 << 10 // Keys and values together, in bytes
+	maxClientMetadataKeyLen = 64
+)
+
+// ValidateClientMetadata checks the client_metadata of a request against the limits above
+func ValidateClientMetadata(m map[string]string) error {
+	if len(m) > MaxClientMetadataKeys {
+		return fmt.Errorf("client_metadata has more than %d keys", MaxClientMetadataKeys)
+	}
+	size := 0
+	for k, v := range m {
+		if k == "" || len(k) > maxClientMetadataKeyLen {
+			return fmt.Errorf("client_metadata keys must be 1 to %d bytes", maxClientMetadataKeyLen)
+		}
+		size += len(k) + len(v)
+	}
+	if size > MaxClientMetadataSize {
+		return fmt.Errorf("client_metadata exceeds %d bytes", MaxClientMetadataSize)
+	}
+	return nil
+}
+
+// ValidateProxyURL checks that rawURL is a proxy URL yt-dlp understands
+func ValidateProxyURL(rawURL string) error {
+	parsed, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return fmt.Errorf("invalid proxy URL: %v", err)
+	}
+	switch strings.ToLower(parsed.Scheme) {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return fmt.Errorf("unsupported proxy scheme %q (want http, https or socks5)", parsed.Scheme)
+	}
+	if parsed.Hostname() == "" {
+		return fmt.Errorf("proxy URL has no host")
+	}
+	return nil
+}
+
+// hostAliases maps an allowed host to other hosts that serve the same content
+var hostAliases = map[string][]string{
+	"youtube.com": {"youtu.be", "youtube-nocookie.com"},
+}
+
+// ValidateVideoURL checks that rawURL is an http(s) URL whose host is one of
+// allowedHosts or a subdomain of one. An entry of "*" allows any host.
+func ValidateVideoURL(rawURL string, allowedHosts []string) error {
+	parsed, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return fmt.Errorf("invalid URL: %v", err)
+	}
+	scheme := strings.ToLower(parsed.Scheme)
+	if scheme != "http" && scheme != "https" {
+		return fmt.Errorf("unsupported URL scheme %q", parsed.Scheme)
+	}
+	host := strings.TrimSuffix(strings.ToLower(parsed.Hostname()), ".")
+	if host == "" {
+		return fmt.Errorf("URL has no host")
+	}
+	for _, h := range allowedHosts {
+		h = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(h)), ".")
+		if h == "*" {
+			return nil
+		}
+		if hostMatches(host, h) {
+			return nil
+		}
+		for _, alias := range hostAliases[h] {
+			if hostMatches(host, alias) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("host %q is not allowed", host)
+}
+
+// hostMatches reports whether host equals allowed or is a subdomain of it
+func hostMatches(host, allowed string) bool {
+	if allowed == "" {
+		return false
+	}
+	return host == allowed || strings.HasSuffix(host, "."+allowed)
+}
+
+// videoIDPattern matches a canonical 11-character YouTube video ID
+var videoIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{11}$`)
+
+// NormalizeVideoID extracts the canonical YouTube video ID from the common URL
+// forms: youtube.com/watch?v=ID, youtu.be/ID, and /shorts/, /embed/, /live/, /v/ paths.
+func NormalizeVideoID(rawURL string) (string, error) {
+	parsed, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return "", fmt.Errorf("invalid URL: %v", err)
+	}
+	host := strings.TrimPrefix(strings.ToLower(parsed.Hostname()), "www.")
+	host = strings.TrimPrefix(host, "m.")
+	host = strings.TrimPrefix(host, "music.")
+	segments := strings.Split(strings.Trim(parsed.Path, "/"), "/")
+
+	var id string
+	switch host {
+	case "youtu.be":
+		id = segments[0]
+	case "youtube.com", "youtube-nocookie.com":
+		if segments[0] == "watch" {
+			id = parsed.Query().Get("v")
+		} else if len(segments) >= 2 {
+			switch segments[0] {
+			case "shorts", "embed", "live", "v":
+				id = segments[1]
+			}
+		}
+	default:
+		return "", fmt.Errorf("host %q is not a YouTube host", host)
+	}
+	if !videoIDPattern.MatchString(id) {
+		return "", fmt.Errorf("no video ID found in URL")
+	}
+	return id, nil
+}
+
+// WatchURL returns the canonical watch URL of a YouTube video
+func WatchURL(videoID string) string {
+	return "https://www.youtube.com/watch?v=" + videoID
+}
+
+// CanonicalizeURL reduces a YouTube video URL in any form NormalizeVideoID
+// accepts to https://www.youtube.com/watch?v=ID. Every other parameter, e.g.
+// si, feature or a playlist's list and index, is dropped, except a start
+// timestamp (t, or start on embeds), which is kept as t in whole seconds.
+func CanonicalizeURL(raw string) (string, error) {
+	id, err := NormalizeVideoID(raw)
+	if err != nil {
+		return "", err
+	}
+	canonical := WatchURL(id)
+	parsed, _ := url.Parse(strings.TrimSpace(raw)) // Parsed fine in NormalizeVideoID
+	q := parsed.Query()
+	t := q.Get("t")
+	if t == "" {
+		t = q.Get("start")
+	}
+	if secs, ok := parseTimestamp(t); ok && secs > 0 {
+		canonical += "&t=" + strconv.Itoa(secs)
+	}
+	return canonical, nil
+}
+
+// timestampPattern matches YouTube's t= forms: 90, 90s, 1m30s, 1h2m3s
+var timestampPattern = regexp.MustCompile(`^(?:(\d+)h)?(?:(\d+)m)?(?:(\d+)s?)?$`)
+
+// parseTimestamp converts a t= value to seconds
+func parseTimestamp(t string) (int, bool) {
+	m := timestampPattern.FindStringSubmatch(strings.ToLower(t))
+	if t == "" || m == nil {
+		return 0, false
+	}
+	secs := 0
+	for i, unit := range []int{3600, 60, 1} {
+		if m[i+1] == "" {
+			continue
+		}
+		n, err := strconv.Atoi(m[i+1])
+		if err != nil {
+			return 0, false
+		}
+		secs += n * unit
+	}
+	return secs, true
+}
+
+// formatIDPattern matches a single yt-dlp format ID such as 251, 140-drc or
+// hls-audio_eng=128000. Selectors (bestaudio, 251/140, 137+140) are not IDs.
+var formatIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._=-]{0,63}$`)
+
+// ValidateFormatID checks the syntax of a requested yt-dlp format ID. Whether
+// the video offers it is only known once the worker asks yt-dlp.
+func ValidateFormatID(id string) error {
+	if !formatIDPattern.MatchString(id) {
+		return fmt.Errorf("invalid format_id %q", id)
+	}
+	return nil
+}
+
+// blockedNetworks are ranges not covered by the net.IP helpers that a remote
+// media URL must never point into
+var blockedNetworks = mustParseCIDRs(
+	"0.0.0.0/8",     // "this" network
+	"100.64.0.0/10", // carrier-grade NAT
+	"192.0.0.0/24",  // IETF protocol assignments
+	"198.18.0.0/15", // benchmarking
+)
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+// isPublicIP reports whether ip is a routable public address. Loopback,
+// private, link-local (which includes the 169.254.169.254 metadata endpoint),
+// multicast and unspecified addresses are rejected.
+func isPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	for _, n := range blockedNetworks {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsSafeRemoteURL checks that rawURL is an http(s) URL whose host resolves only
+// to public addresses, so a URL returned by the extractor cannot make ffmpeg
+// reach internal services. Hosts, IPs or CIDRs listed in allowlist skip the check.
+func IsSafeRemoteURL(rawURL string, allowlist ...string) error {
+	parsed, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return fmt.Errorf("invalid URL: %v", err)
+	}
+	scheme := strings.ToLower(parsed.Scheme)
+	if scheme != "http" && scheme != "https" {
+		return fmt.Errorf("unsupported URL scheme %q", parsed.Scheme)
+	}
+	if parsed.Hostname() == "" {
+		return fmt.Errorf("URL has no host")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = resolveSafeIPs(ctx, parsed.Hostname(), allowlist)
+	return err
+}
+
+// resolveSafeIPs resolves host and returns its addresses, failing if any of
+// them is neither public nor allowlisted
+func resolveSafeIPs(ctx context.Context, host string, allowlist []string) ([]net.IP, error) {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IP{ip}
+	} else {
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %s: %v", host, err)
+		}
+		for _, a := range addrs {
+			ips = append(ips, a.IP)
+		}
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("%s did not resolve to any address", host)
+	}
+
+	for _, ip := range ips {
+		if isPublicIP(ip) || inAllowlist(host, ip, allowlist) {
+			continue
+		}
+		return nil, fmt.Errorf("%s resolves to non-public address %s", host, ip)
+	}
+	return ips, nil
+}
+
+// inAllowlist reports whether host or ip matches an allowlist entry
+func inAllowlist(host string, ip net.IP, allowlist []string) bool {
+	for _, entry := range allowlist {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if _, n, err := net.ParseCIDR(entry); err == nil {
+			if n.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		if allowed := net.ParseIP(entry); allowed != nil {
+			if allowed.Equal(ip) {
+				return true
+			}
+			continue
+		}
+		if hostMatches(host, entry) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsPlaylistURL reports whether rawURL names a whole playlist: a /playlist
+// page, or a list= parameter without a specific video. A watch URL that also
+// carries list= is treated as the single video.
+func IsPlaylistURL(rawURL string) bool {
+	parsed, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return false
+	}
+	q := parsed.Query()
+	if q.Get("list") == "" {
+		return false
+	}
+	return strings.Trim(parsed.Path, "/") == "playlist" || q.Get("v") == ""
+}
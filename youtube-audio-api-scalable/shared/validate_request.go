@@ -0,0 +1,97 @@
+// shared/validate_request.go
+package shared
+
+import (
+	"errors"
+	"strings"
+)
+
+// FieldError reports one invalid field of a request body
+type FieldError struct {
+	Field   string `json:"field"` // JSON name of the field, e.g. bitrate
+	Message string `json:"message"`
+}
+
+// ValidateRequest checks every field of an extraction request and returns all
+// the problems found, rather than only the first. Fields that pass are
+// normalized in place: format and bitrate get their defaults, format_id is
+// trimmed, and sample_rate, channels and priority are made canonical.
+func ValidateRequest(req *Request, cfg *Config) []FieldError {
+	var errs []FieldError
+	add := func(field string, err error) {
+		errs = append(errs, FieldError{Field: field, Message: err.Error()})
+	}
+
+	if strings.TrimSpace(req.URL) == "" {
+		add("url", errors.New("missing YouTube URL"))
+	} else if err := ValidateVideoURL(req.URL, cfg.AllowedVideoHosts); err != nil {
+		add("url", err)
+	}
+	if req.CallbackURL != "" {
+		if err := ValidateCallbackURL(req.CallbackURL, cfg.CallbackHostAllowlist...); err != nil {
+			add("callback_url", err)
+		}
+	}
+	if req.Cookies != "" {
+		if _, err := DecodeCookies(req.Cookies); err != nil {
+			add("cookies", err)
+		}
+	}
+	if err := ValidateClientMetadata(req.ClientMetadata); err != nil {
+		add("client_metadata", err)
+	}
+
+	// Format and bitrate are checked apart so a bad one doesn't hide the other
+	format, _, formatErr := ValidateOutputFormat(req.Format, "")
+	if formatErr != nil {
+		add("format", formatErr)
+		format = DefaultOutputFormat // Still check the bitrate, as for any lossy format
+	}
+	if _, bitrate, err := ValidateOutputFormat(format, req.Bitrate); err != nil {
+		add("bitrate", err)
+	} else if formatErr == nil {
+		req.Format, req.Bitrate = format, bitrate
+	}
+	// Which sample rates are allowed depends on the format
+	if formatErr == nil {
+		if sampleRate, _, err := ValidateAudioLayout(format, req.SampleRate, ""); err != nil {
+			add("sample_rate", err)
+		} else {
+			req.SampleRate = sampleRate
+		}
+	}
+	if _, channels, err := ValidateAudioLayout(format, 0, req.Channels); err != nil {
+		add("channels", err)
+	} else {
+		req.Channels = channels
+	}
+	req.FormatID = strings.TrimSpace(req.FormatID)
+	if req.FormatID != "" {
+		if err := ValidateFormatID(req.FormatID); err != nil {
+			add("format_id", err)
+		}
+	}
+
+	// Clip range: each end on its own, then their order
+	var start, end float64
+	var startErr, endErr error
+	if strings.TrimSpace(req.StartTime) != "" {
+		if start, startErr = ParseClipTime(req.StartTime); startErr != nil {
+			add("start_time", startErr)
+		}
+	}
+	if strings.TrimSpace(req.EndTime) != "" {
+		if end, endErr = ParseClipTime(req.EndTime); endErr != nil {
+			add("end_time", endErr)
+		} else if startErr == nil && end <= start {
+			add("end_time", errors.New("end_time must be after start_time"))
+		}
+	}
+
+	if priority, err := ParsePriority(req.Priority); err != nil {
+		add("priority", err)
+	} else {
+		req.Priority = string(priority)
+	}
+	return errs
+}
@@ -0,0 +1,60 @@
+package shared
+
+import (
+	"slices"
+	"testing"
+)
+
+// fieldNames returns the fields of errs in order
+func fieldNames(errs []FieldError) []string {
+	names := make([]string, len(errs))
+	for i, e := range errs {
+		names[i] = e.Field
+	}
+	return names
+}
+
+func TestValidateRequestNormalizesValidRequest(t *testing.T) {
+	cfg := &Config{AllowedVideoHosts: []string{"youtube.com", "youtu.be"}}
+	req := &Request{URL: "https://youtu.be/dQw4w9WgXcQ", Format: "MP3", Channels: "Mono", FormatID: " 251 ",
+		StartTime: "0:10", EndTime: "0:20", Priority: "HIGH"}
+	if errs := ValidateRequest(req, cfg); len(errs) != 0 {
+		t.Fatalf("ValidateRequest = %+v, want no errors", errs)
+	}
+	if req.Format != "mp3" || req.Bitrate != DefaultBitrate || req.Channels != "mono" || req.FormatID != "251" || req.Priority != "high" {
+		t.Errorf("normalized to %+v", req)
+	}
+}
+
+func TestValidateRequestReportsEveryError(t *testing.T) {
+	cfg := &Config{AllowedVideoHosts: []string{"youtube.com", "youtu.be"}}
+	tests := []struct {
+		name string
+		req  Request
+		want []string
+	}{
+		{"format, bitrate and times", Request{URL: "https://youtu.be/dQw4w9WgXcQ", Format: "wma", Bitrate: "7k",
+			StartTime: "soon", EndTime: "-5"}, []string{"format", "bitrate", "start_time", "end_time"}},
+		{"inverted range", Request{URL: "https://youtu.be/dQw4w9WgXcQ", StartTime: "30", EndTime: "10"}, []string{"end_time"}},
+		{"host, callback and priority", Request{URL: "https://vimeo.com/123", CallbackURL: "ftp://example.com/hook",
+			Priority: "urgent"}, []string{"url", "callback_url", "priority"}},
+		{"missing url, layout and format id", Request{Channels: "5.1", SampleRate: 12345, FormatID: "251/140"},
+			[]string{"url", "sample_rate", "channels", "format_id"}},
+		{"cookies and metadata", Request{URL: "https://youtu.be/dQw4w9WgXcQ", Cookies: "not base64!",
+			ClientMetadata: map[string]string{"": "x"}}, []string{"cookies", "client_metadata"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := tt.req
+			errs := ValidateRequest(&req, cfg)
+			if got := fieldNames(errs); !slices.Equal(got, tt.want) {
+				t.Errorf("fields %v, want %v (%+v)", got, tt.want, errs)
+			}
+			for _, e := range errs {
+				if e.Message == "" {
+					t.Errorf("%s has no message", e.Field)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+// shared/validate_test.go
+package shared
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestValidateVideoURL(t *testing.T) {
+	allowed := []string{"youtube.com", "youtu.be"}
+	tests := []struct {
+		url string
+		ok  bool
+	}{
+		{"https://www.youtube.com/watch?v=dQw4w9WgXcQ", true},
+		{"https://youtube.com/watch?v=dQw4w9WgXcQ", true},
+		{"https://m.youtube.com/watch?v=dQw4w9WgXcQ", true},
+		{"https://music.youtube.com/watch?v=dQw4w9WgXcQ", true},
+		{"https://youtu.be/dQw4w9WgXcQ", true},
+		{"https://www.youtube-nocookie.com/embed/dQw4w9WgXcQ", true},
+		{"HTTPS://WWW.YOUTUBE.COM/watch?v=dQw4w9WgXcQ", true},
+		{"https://youtube.com./watch?v=dQw4w9WgXcQ", true},
+		{"http://youtube.com/watch?v=dQw4w9WgXcQ", true},
+		// Spoofed hosts
+		{"https://youtube.com.evil.com/watch?v=dQw4w9WgXcQ", false},
+		{"https://evilyoutube.com/watch?v=dQw4w9WgXcQ", false},
+		{"https://youtube.co/watch?v=dQw4w9WgXcQ", false},
+		{"https://evil.com/youtube.com/watch?v=dQw4w9WgXcQ", false},
+		{"https://evil.com/?u=https://youtube.com/watch", false},
+		{"https://youtube.com@evil.com/watch?v=dQw4w9WgXcQ", false},
+		{"https://evil.com#youtube.com", false},
+		{"https://notyoutu.be/dQw4w9WgXcQ", false},
+		// Not http(s) or no host
+		{"ftp://youtube.com/watch?v=dQw4w9WgXcQ", false},
+		{"javascript:alert(1)//youtube.com", false},
+		{"youtube.com/watch?v=dQw4w9WgXcQ", false},
+		{"https:///watch?v=dQw4w9WgXcQ", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		err := ValidateVideoURL(tt.url, allowed)
+		if (err == nil) != tt.ok {
+			t.Errorf("ValidateVideoURL(%q) = %v, want ok %v", tt.url, err, tt.ok)
+		}
+	}
+}
+
+func TestValidateVideoURLWildcard(t *testing.T) {
+	if err := ValidateVideoURL("https://vimeo.com/123", []string{"*"}); err != nil {
+		t.Errorf("wildcard rejected a host: %v", err)
+	}
+	if err := ValidateVideoURL("https://vimeo.com/123", nil); err == nil {
+		t.Error("empty allowlist accepted a host")
+	}
+}
+
+func TestNormalizeVideoID(t *testing.T) {
+	const id = "dQw4w9WgXcQ"
+	valid := []string{
+		"https://www.youtube.com/watch?v=" + id,
+		"https://youtube.com/watch?v=" + id + "&t=42s",
+		"https://m.youtube.com/watch?feature=share&v=" + id,
+		"https://music.youtube.com/watch?v=" + id + "&list=RDAMVM" + id,
+		"http://www.youtube.com/watch?v=" + id,
+		"https://youtu.be/" + id,
+		"https://youtu.be/" + id + "?si=abc123&t=10",
+		"https://www.youtube.com/shorts/" + id,
+		"https://www.youtube.com/embed/" + id + "?start=5",
+		"https://www.youtube-nocookie.com/embed/" + id,
+		"https://www.youtube.com/live/" + id,
+		"https://www.youtube.com/v/" + id,
+		"  https://www.youtube.com/watch?v=" + id + "  ",
+	}
+	for _, u := range valid {
+		got, err := NormalizeVideoID(u)
+		if err != nil || got != id {
+			t.Errorf("NormalizeVideoID(%q) = %q, %v; want %q", u, got, err, id)
+		}
+	}
+	invalid := []string{
+		"https://www.youtube.com/watch?v=short",
+		"https://www.youtube.com/watch",
+		"https://www.youtube.com/channel/UC1234567890",
+		"https://www.youtube.com/playlist?list=PL123",
+		"https://youtu.be/",
+		"https://vimeo.com/" + id,
+		"https://youtube.com.evil.com/watch?v=" + id,
+	}
+	for _, u := range invalid {
+		if got, err := NormalizeVideoID(u); err == nil {
+			t.Errorf("NormalizeVideoID(%q) = %q, want an error", u, got)
+		}
+	}
+}
+
+func TestIsSafeRemoteURL(t *testing.T) {
+	tests := []struct {
+		name      string
+		url       string
+		allowlist []string
+		wantErr   bool
+	}{
+		{"public host", "https://93.184.216.34/audio.webm", nil, false},
+		{"cloud metadata endpoint", "http://169.254.169.254/latest/meta-data/", nil, true},
+		{"loopback", "http://127.0.0.1:6379/", nil, true},
+		{"private 10/8", "http://10.1.2.3/audio.webm", nil, true},
+		{"IPv6 loopback", "http://[::1]/audio.webm", nil, true},
+		{"unsupported scheme", "file:///etc/passwd", nil, true},
+		{"allowlisted IP", "http://127.0.0.1:8080/audio.webm", []string{"127.0.0.1"}, false},
+		{"allowlisted CIDR", "http://10.1.2.3/audio.webm", []string{"10.0.0.0/8"}, false},
+		{"CIDR not covering the host", "http://10.1.2.3/audio.webm", []string{"192.168.0.0/16"}, true},
+		{"metadata endpoint with another entry allowlisted", "http://169.254.169.254/", []string{"10.0.0.0/8"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := IsSafeRemoteURL(tt.url, tt.allowlist...)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("IsSafeRemoteURL(%q, %v) = %v, wantErr %v", tt.url, tt.allowlist, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateProxyURL(t *testing.T) {
+	for _, p := range []string{"http://proxy:3128", "https://user:pw@proxy", "socks5://127.0.0.1:1080", "socks5h://proxy:1080"} {
+		if err := ValidateProxyURL(p); err != nil {
+			t.Errorf("ValidateProxyURL(%q) = %v", p, err)
+		}
+	}
+	// Each of these stops the worker at startup
+	for _, p := range []string{"proxy:3128", "ftp://proxy", "http://", "http://%zz"} {
+		if err := ValidateProxyURL(p); err == nil {
+			t.Errorf("ValidateProxyURL(%q) accepted an invalid proxy", p)
+		}
+	}
+}
+
+func TestValidateClientMetadata(t *testing.T) {
+	tooMany := map[string]string{}
+	for i := 0; i <= MaxClientMetadataKeys; i++ {
+		tooMany[fmt.Sprintf("key%d", i)] = "v"
+	}
+	tests := []struct {
+		name string
+		m    map[string]string
+		ok   bool
+	}{
+		{"none", nil, true},
+		{"ids", map[string]string{"user_id": "42", "order_id": "A-1001"}, true},
+		{"empty value", map[string]string{"note": ""}, true},
+		{"too many keys", tooMany, false},
+		{"empty key", map[string]string{"": "x"}, false},
+		{"long key", map[string]string{strings.Repeat("k", 65): "x"}, false},
+		{"too large", map[string]string{"blob": strings.Repeat("x", MaxClientMetadataSize)}, false},
+	}
+	for _, tt := range tests {
+		if err := ValidateClientMetadata(tt.m); (err == nil) != tt.ok {
+			t.Errorf("%s: ValidateClientMetadata = %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestCanonicalizeURL(t *testing.T) {
+	const id = "dQw4w9WgXcQ"
+	const watch = "https://www.youtube.com/watch?v=" + id
+	tests := []struct {
+		raw, want string
+	}{
+		{watch, watch},
+		{"http://youtube.com/watch?v=" + id, watch},
+		{"https://m.youtube.com/watch?feature=share&v=" + id, watch},
+		{"https://music.youtube.com/watch?v=" + id + "&list=RDAMVM" + id, watch},
+		{"https://www.youtube.com/watch?v=" + id + "&list=PL123&index=4&pp=ygUE", watch},
+		{"https://youtu.be/" + id + "?si=abc123", watch},
+		{"https://youtu.be/" + id + "?si=abc123&t=42", watch + "&t=42"},
+		{"https://www.youtube.com/watch?v=" + id + "&t=42s", watch + "&t=42"},
+		{"https://www.youtube.com/watch?v=" + id + "&t=1m30s", watch + "&t=90"},
+		{"https://www.youtube.com/watch?v=" + id + "&t=1H2M3S", watch + "&t=3723"},
+		{"https://www.youtube.com/watch?v=" + id + "&t=0", watch},
+		{"https://www.youtube.com/watch?v=" + id + "&t=later", watch},
+		{"https://www.youtube.com/shorts/" + id + "?feature=share", watch},
+		{"https://www.youtube.com/embed/" + id + "?start=5&autoplay=1", watch + "&t=5"},
+		{"https://www.youtube-nocookie.com/embed/" + id, watch},
+		{"https://www.youtube.com/live/" + id + "?si=x", watch},
+		{"https://www.youtube.com/v/" + id, watch},
+		{"  https://youtu.be/" + id + "  ", watch},
+	}
+	for _, tt := range tests {
+		got, err := CanonicalizeURL(tt.raw)
+		if err != nil || got != tt.want {
+			t.Errorf("CanonicalizeURL(%q) = %q, %v; want %q", tt.raw, got, err, tt.want)
+		}
+	}
+	for _, raw := range []string{
+		"https://www.youtube.com/playlist?list=PL123",
+		"https://www.youtube.com/channel/UC1234567890",
+		"https://vimeo.com/" + id,
+		"https://youtube.com.evil.com/watch?v=" + id,
+	} {
+		if got, err := CanonicalizeURL(raw); err == nil {
+			t.Errorf("CanonicalizeURL(%q) = %q, want an error", raw, got)
+		}
+	}
+}
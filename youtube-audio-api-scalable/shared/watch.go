@@ -0,0 +1,71 @@
+// shared/watch.go
+package shared
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	redis "github.com/redis/go-redis/v9"
+)
+
+// DefaultWatchPollInterval is how often WatchJob re-reads a job when it has no
+// change notifications to rely on
+const DefaultWatchPollInterval = time.Second
+
+// WatchJob sends the job on the returned channel whenever its status or progress changes,
+// starting with its current state. The channel is closed once the job reaches a
+// terminal state, disappears, or ctx is done.
+//
+// When redisClient is set, WatchJob subscribes to the keyspace notifications for
+// the job key (requires notify-keyspace-events to include "K$") and falls back
+// to a slow poll in case notifications are disabled. Otherwise it polls db.
+func WatchJob(ctx context.Context, db DatabaseClient, redisClient *redis.Client, jobID string) <-chan *Job {
+	out := make(chan *Job)
+	go func() {
+		defer close(out)
+
+		var notify <-chan *redis.Message
+		pollInterval := DefaultWatchPollInterval
+		if redisClient != nil {
+			channel := fmt.Sprintf("__keyspace@%d__:job:%s", redisClient.Options().DB, jobID)
+			sub := redisClient.Subscribe(ctx, channel)
+			defer sub.Close()
+			notify = sub.Channel()
+			pollInterval = 5 * DefaultWatchPollInterval
+		}
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+
+		var last *Job
+		for {
+			job, err := db.GetJob(ctx, jobID)
+			if err != nil {
+				return
+			}
+			if last == nil || jobChanged(last, job) {
+				select {
+				case out <- job:
+				case <-ctx.Done():
+					return
+				}
+				last = job
+			}
+			if job.Status.IsTerminal() {
+				return
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-notify:
+			}
+		}
+	}()
+	return out
+}
+
+// jobChanged reports whether b differs from a in a way clients care about
+func jobChanged(a, b *Job) bool {
+	return a.Status != b.Status || a.Progress != b.Progress
+}
@@ -0,0 +1,96 @@
+// shared/webhook.go
+package shared
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// WebhookSignatureHeader carries the hex HMAC-SHA256 of the request body, keyed with Config.WebhookSecret
+const WebhookSignatureHeader = "X-Webhook-Signature"
+
+// ValidateCallbackURL checks that a client-supplied callback is an absolute
+// http(s) URL on a public address, so callbacks can't be used to reach
+// internal services. Hosts, IPs or CIDRs listed in allowlist may be internal.
+func ValidateCallbackURL(rawURL string, allowlist ...string) error {
+	parsed, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return fmt.Errorf("invalid callback URL: %v", err)
+	}
+	scheme := strings.ToLower(parsed.Scheme)
+	if (scheme != "http" && scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("callback URL must be an absolute http(s) URL")
+	}
+	if err := IsSafeRemoteURL(rawURL, allowlist...); err != nil {
+		return fmt.Errorf("callback URL not allowed: %v", err)
+	}
+	return nil
+}
+
+// SignWebhookPayload returns the value of WebhookSignatureHeader for body
+func SignWebhookPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// WebhookResult describes a callback delivery
+type WebhookResult struct {
+	Attempts   int
+	LastStatus int // HTTP status of the last attempt; 0 when there was no response
+}
+
+// DeliverWebhook POSTs body to callbackURL, retrying failed attempts up to
+// maxRetries times. The wait before a retry starts at cfg.WebhookRetryBackoff
+// and doubles each time. The URL is checked again before sending, and so are
+// the addresses connected to and any redirects, as DNS may have changed since
+// the job was submitted.
+func DeliverWebhook(cfg *Config, callbackURL string, body []byte, maxRetries int) (WebhookResult, error) {
+	var result WebhookResult
+	if err := ValidateCallbackURL(callbackURL, cfg.CallbackHostAllowlist...); err != nil {
+		return result, err
+	}
+	client := NewSafeHTTPClient(cfg.WebhookTimeout, cfg.CallbackHostAllowlist...)
+	backoff := cfg.WebhookRetryBackoff
+	for {
+		status, err := postWebhook(client, cfg.WebhookSecret, callbackURL, body)
+		result.Attempts++
+		result.LastStatus = status
+		if err == nil {
+			return result, nil
+		}
+		if result.Attempts > maxRetries {
+			return result, fmt.Errorf("webhook failed after %d attempts: %w", result.Attempts, err)
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// postWebhook makes one delivery attempt and returns the response status, if any
+func postWebhook(client *http.Client, secret, callbackURL string, body []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, callbackURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret != "" {
+		req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(secret, body))
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("callback returned %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
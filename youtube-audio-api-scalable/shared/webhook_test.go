@@ -0,0 +1,174 @@
+// shared/webhook_test.go
+package shared
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// webhookTestConfig allows callbacks to the local test servers
+func webhookTestConfig() *Config {
+	return &Config{
+		WebhookSecret:         "s3cret",
+		WebhookTimeout:        2 * time.Second,
+		WebhookRetryBackoff:   time.Millisecond,
+		CallbackHostAllowlist: []string{"127.0.0.1"},
+	}
+}
+
+func TestDeliverWebhookSignsPayload(t *testing.T) {
+	cfg := webhookTestConfig()
+	body := []byte(`{"job_id":"job-1","status":"completed"}`)
+	var got []byte
+	var signature, contentType string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = io.ReadAll(r.Body)
+		signature = r.Header.Get(WebhookSignatureHeader)
+		contentType = r.Header.Get("Content-Type")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	result, err := DeliverWebhook(cfg, srv.URL, body, 0)
+	if err != nil {
+		t.Fatalf("DeliverWebhook: %v", err)
+	}
+	if result.Attempts != 1 || result.LastStatus != http.StatusNoContent {
+		t.Errorf("result = %+v, want 1 attempt with status 204", result)
+	}
+	if string(got) != string(body) {
+		t.Errorf("callback received %s, want %s", got, body)
+	}
+	if contentType != "application/json" {
+		t.Errorf("Content-Type = %q", contentType)
+	}
+	if want := SignWebhookPayload(cfg.WebhookSecret, body); signature != want {
+		t.Errorf("signature = %q, want %q", signature, want)
+	}
+}
+
+func TestDeliverWebhookReportsFailureStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	result, err := DeliverWebhook(webhookTestConfig(), srv.URL, []byte(`{}`), 2)
+	if err == nil {
+		t.Fatal("DeliverWebhook succeeded against a failing server")
+	}
+	if result.Attempts != 3 || result.LastStatus != http.StatusInternalServerError {
+		t.Errorf("result = %+v, want 3 attempts ending in 500", result)
+	}
+}
+
+func TestValidateCallbackURL(t *testing.T) {
+	tests := []struct {
+		url       string
+		allowlist []string
+		ok        bool
+	}{
+		{"https://93.184.216.34/hook", nil, true},
+		{"ftp://93.184.216.34/hook", nil, false},
+		{"/relative/hook", nil, false},
+		{"http://169.254.169.254/latest/meta-data/", nil, false},
+		{"http://127.0.0.1:6379/", nil, false},
+		{"http://localhost:8080/hook", nil, false},
+		{"http://10.1.2.3/hook", nil, false},
+		{"http://[::1]/hook", nil, false},
+		{"http://127.0.0.1:8080/hook", []string{"127.0.0.1"}, true},
+	}
+	for _, tt := range tests {
+		err := ValidateCallbackURL(tt.url, tt.allowlist...)
+		if (err == nil) != tt.ok {
+			t.Errorf("ValidateCallbackURL(%q, %v) = %v, want ok %v", tt.url, tt.allowlist, err, tt.ok)
+		}
+	}
+}
+
+func TestDeliverWebhookRefusesInternalAddresses(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	defer srv.Close()
+
+	cfg := webhookTestConfig()
+	cfg.CallbackHostAllowlist = nil
+	if _, err := DeliverWebhook(cfg, srv.URL, []byte(`{}`), 0); err == nil {
+		t.Error("DeliverWebhook posted to a loopback address")
+	}
+	if hits.Load() != 0 {
+		t.Errorf("internal server was hit %d times", hits.Load())
+	}
+}
+
+func TestDeliverWebhookRefusesRedirectToInternalAddress(t *testing.T) {
+	var internalHits atomic.Int32
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		internalHits.Add(1)
+	}))
+	defer internal.Close()
+	// Only the redirecting host is allowed, by name; the target is its loopback address
+	redirector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, internal.URL+"/steal", http.StatusTemporaryRedirect)
+	}))
+	defer redirector.Close()
+
+	cfg := webhookTestConfig()
+	cfg.CallbackHostAllowlist = []string{"localhost"}
+	callbackURL := strings.Replace(redirector.URL, "127.0.0.1", "localhost", 1)
+	if _, err := DeliverWebhook(cfg, callbackURL, []byte(`{}`), 0); err == nil {
+		t.Error("DeliverWebhook followed a redirect to an internal address")
+	}
+	if internalHits.Load() != 0 {
+		t.Errorf("internal server was hit %d times", internalHits.Load())
+	}
+}
+
+func TestDeliverWebhookRetriesFlappingServer(t *testing.T) {
+	cfg := webhookTestConfig()
+	cfg.WebhookRetryBackoff = 20 * time.Millisecond
+	var calls atomic.Int32
+	var mu sync.Mutex
+	var times []time.Time
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		times = append(times, time.Now())
+		mu.Unlock()
+		if calls.Add(1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable) // Down for the first two attempts
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	result, err := DeliverWebhook(cfg, srv.URL, []byte(`{}`), 3)
+	if err != nil {
+		t.Fatalf("DeliverWebhook: %v", err)
+	}
+	if result.Attempts != 3 || result.LastStatus != http.StatusOK {
+		t.Errorf("result = %+v, want 3 attempts ending in 200", result)
+	}
+	// The wait doubles after each failure
+	mu.Lock()
+	first, second := times[1].Sub(times[0]), times[2].Sub(times[1])
+	mu.Unlock()
+	if first < 20*time.Millisecond || second < 40*time.Millisecond {
+		t.Errorf("waited %s then %s between attempts, want at least 20ms then 40ms", first, second)
+	}
+
+	// With fewer retries than the outage lasts, the delivery fails
+	calls.Store(0)
+	result, err = DeliverWebhook(cfg, srv.URL, []byte(`{}`), 1)
+	if err == nil || result.Attempts != 2 || result.LastStatus != http.StatusServiceUnavailable {
+		t.Errorf("result = %+v, %v; want 2 attempts ending in 503", result, err)
+	}
+}
@@ -0,0 +1,182 @@
+// worker/breaker.go
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// breakerState is the state of a circuitBreaker
+type breakerState string
+
+const (
+	breakerClosed   breakerState = "closed"    // Calls go through
+	breakerOpen     breakerState = "open"      // Calls are held back until the cooldown passes
+	breakerHalfOpen breakerState = "half_open" // One probe call decides whether to close again
+)
+
+// circuitBreaker stops calls to a dependency that keeps failing. It opens
+// after threshold consecutive failures within window, lets a single probe
+// through once cooldown has passed, and closes again when a call succeeds.
+// A threshold of 0 disables it.
+type circuitBreaker struct {
+	threshold int
+	window    time.Duration
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu           sync.Mutex
+	state        breakerState
+	failures     int       // Consecutive failures so far
+	firstFailure time.Time // When the current run of failures started
+	openedAt     time.Time
+	probeStarted time.Time     // Zero while no probe is in flight
+	closed       chan struct{} // Closed and replaced whenever the breaker closes, to wake Wait
+}
+
+func newCircuitBreaker(threshold int, window, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		window:    window,
+		cooldown:  cooldown,
+		now:       time.Now,
+		state:     breakerClosed,
+		closed:    make(chan struct{}),
+	}
+}
+
+// Wait blocks while Allow would turn calls away, so the consumer doesn't take
+// jobs (and worker slots) only to hand them back. It doesn't let a probe
+// through itself. It returns false if stop is closed first.
+func (b *circuitBreaker) Wait(stop <-chan struct{}) bool {
+	for {
+		wait, closed := b.holdFor()
+		if wait <= 0 {
+			return true
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-closed:
+			timer.Stop()
+		case <-stop:
+			timer.Stop()
+			return false
+		}
+	}
+}
+
+// holdFor returns how long Allow will keep turning calls away, without
+// changing the state, and the channel closed when the breaker next closes
+func (b *circuitBreaker) holdFor() (time.Duration, <-chan struct{}) {
+	if b.threshold <= 0 {
+		return 0, nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	switch b.state {
+	case breakerOpen:
+		return b.openedAt.Add(b.cooldown).Sub(now), b.closed
+	case breakerHalfOpen:
+		if !b.probeStarted.IsZero() {
+			return b.probeStarted.Add(b.cooldown).Sub(now), b.closed
+		}
+	}
+	return 0, b.closed
+}
+
+// Allow reports whether a call may go ahead. While the breaker is open it
+// returns false and how long until a probe will be let through.
+func (b *circuitBreaker) Allow() (bool, time.Duration) {
+	if b.threshold <= 0 {
+		return true, 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	switch b.state {
+	case breakerOpen:
+		if wait := b.openedAt.Add(b.cooldown).Sub(now); wait > 0 {
+			return false, wait
+		}
+		b.state = breakerHalfOpen
+		b.probeStarted = now
+		return true, 0
+	case breakerHalfOpen:
+		// A probe that never reported back (e.g. its job was cancelled) must
+		// not keep the breaker half-open forever
+		if !b.probeStarted.IsZero() && now.Sub(b.probeStarted) < b.cooldown {
+			return false, b.probeStarted.Add(b.cooldown).Sub(now)
+		}
+		b.probeStarted = now
+		return true, 0
+	}
+	return true, 0
+}
+
+// Success records a successful call, closing the breaker
+func (b *circuitBreaker) Success() {
+	if b.threshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state != breakerClosed {
+		close(b.closed)
+		b.closed = make(chan struct{})
+	}
+	b.state = breakerClosed
+	b.failures = 0
+	b.probeStarted = time.Time{}
+}
+
+// Failure records a failed call. A failed probe re-opens the breaker for
+// another cooldown.
+func (b *circuitBreaker) Failure() {
+	if b.threshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	switch b.state {
+	case breakerHalfOpen:
+		b.open(now)
+		return
+	case breakerOpen:
+		return // A call let through before the breaker opened
+	}
+	if b.failures == 0 || now.Sub(b.firstFailure) > b.window {
+		b.failures = 0
+		b.firstFailure = now
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.open(now)
+	}
+}
+
+func (b *circuitBreaker) open(now time.Time) {
+	b.state = breakerOpen
+	b.openedAt = now
+	b.probeStarted = time.Time{}
+}
+
+// Status describes the breaker for /health
+func (b *circuitBreaker) Status() map[string]any {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.threshold <= 0 {
+		return map[string]any{"state": "disabled"}
+	}
+	status := map[string]any{
+		"state":                string(b.state),
+		"consecutive_failures": b.failures,
+		"threshold":            b.threshold,
+	}
+	if b.state == breakerOpen {
+		status["retry_at"] = b.openedAt.Add(b.cooldown).UTC()
+	}
+	return status
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+// fakeClock is a settable time source for circuitBreaker.now
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func TestCircuitBreakerOpensProbesAndCloses(t *testing.T) {
+	clock := &fakeClock{t: time.Now()}
+	b := newCircuitBreaker(3, time.Minute, 30*time.Second)
+	b.now = clock.now
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := b.Allow(); !ok {
+			t.Fatalf("call %d turned away before the threshold", i+1)
+		}
+		b.Failure()
+	}
+	if ok, wait := b.Allow(); ok || wait != 30*time.Second {
+		t.Fatalf("open breaker: Allow = %v, %s; want false, 30s", ok, wait)
+	}
+	if st := b.Status()["state"]; st != string(breakerOpen) {
+		t.Errorf("state %v, want open", st)
+	}
+
+	// After the cooldown exactly one probe goes through; a failed one re-opens
+	clock.advance(30 * time.Second)
+	if ok, _ := b.Allow(); !ok {
+		t.Fatal("no probe let through after the cooldown")
+	}
+	if ok, _ := b.Allow(); ok {
+		t.Error("a second call went through while the probe was in flight")
+	}
+	b.Failure()
+	if ok, wait := b.Allow(); ok || wait != 30*time.Second {
+		t.Errorf("after a failed probe: Allow = %v, %s; want false, 30s", ok, wait)
+	}
+
+	clock.advance(30 * time.Second)
+	if ok, _ := b.Allow(); !ok {
+		t.Fatal("no second probe let through")
+	}
+	b.Success()
+	if st := b.Status()["state"]; st != string(breakerClosed) {
+		t.Errorf("state %v after a successful probe, want closed", st)
+	}
+	if ok, _ := b.Allow(); !ok {
+		t.Error("closed breaker turned a call away")
+	}
+}
+
+func TestCircuitBreakerForgetsFailuresOutsideWindow(t *testing.T) {
+	clock := &fakeClock{t: time.Now()}
+	b := newCircuitBreaker(3, time.Minute, 30*time.Second)
+	b.now = clock.now
+	for i := 0; i < 5; i++ {
+		b.Failure()
+		b.Failure()
+		clock.advance(2 * time.Minute)
+	}
+	if ok, _ := b.Allow(); !ok {
+		t.Error("failures spread over many windows opened the breaker")
+	}
+}
+
+func TestCircuitBreakerWaitHoldsUntilClosed(t *testing.T) {
+	b := newCircuitBreaker(1, time.Minute, time.Hour)
+	b.Failure()
+
+	done := make(chan bool)
+	go func() { done <- b.Wait(nil) }()
+	select {
+	case <-done:
+		t.Fatal("Wait returned while the breaker was open")
+	case <-time.After(50 * time.Millisecond):
+	}
+	b.Success()
+	select {
+	case ok := <-done:
+		if !ok {
+			t.Error("Wait = false after the breaker closed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Wait did not return after the breaker closed")
+	}
+
+	b.Failure()
+	stop := make(chan struct{})
+	close(stop)
+	if b.Wait(stop) {
+		t.Error("Wait = true after stop was closed")
+	}
+}
+
+func TestProcessJobFastFailsWhileBreakerOpen(t *testing.T) {
+	// Every yt-dlp run is recorded in runs
+	runs := t.TempDir() + "/runs"
+	failing := writeStub(t, "yt-dlp", `echo run >> `+runs+`
+echo "ERROR: Unable to extract player response" >&2
+exit 1`)
+	t.Setenv("YTDLP_PATH", failing)
+	t.Setenv("FFMPEG_PATH", stubFFmpeg(t, "converted"))
+	t.Setenv("YTDLP_BREAKER_THRESHOLD", "2")
+	t.Setenv("YTDLP_BREAKER_COOLDOWN", "1h")
+	setupWorker(t)
+	clock := &fakeClock{t: time.Now()}
+	ytDlpBreaker.now = clock.now
+	ctx := context.Background()
+
+	processJob(seedJob(t, "job-1", "https://youtu.be/dQw4w9WgXcQ"))
+	processJob(seedJob(t, "job-2", "https://youtu.be/9bZkp7q19f0"))
+	if st := ytDlpBreaker.Status()["state"]; st != string(breakerOpen) {
+		t.Fatalf("breaker %v after %d failures, want open", st, cfg.YtDlpBreakerThreshold)
+	}
+
+	// Held back at once: no yt-dlp run, no sleep, no attempt used up
+	start := time.Now()
+	processJob(seedJob(t, "job-3", "https://youtu.be/kJQP7kiw5Fk"))
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("fast-fail took %s", elapsed)
+	}
+	b, _ := os.ReadFile(runs)
+	if n := strings.Count(string(b), "run"); n != 2 {
+		t.Errorf("yt-dlp ran %d times, want 2", n)
+	}
+	job, _ := db.GetJob(ctx, "job-3")
+	if job.Status != shared.JobStatusPending || job.Attempts != 0 {
+		t.Errorf("held back job %s with %d attempts, want pending with none", job.Status, job.Attempts)
+	}
+
+	// Once the cooldown passes, a successful probe closes the breaker
+	clock.advance(time.Hour)
+	cfg.YtDlpPath = stubYtDlp(t, videoInfoJSON)
+	processJob(seedJob(t, "job-4", "https://youtu.be/OPf0YbXqDm0"))
+	if job, _ := db.GetJob(ctx, "job-4"); job.Status != shared.JobStatusCompleted {
+		t.Errorf("probe job %s: %s", job.Status, job.Error)
+	}
+	if st := ytDlpBreaker.Status()["state"]; st != string(breakerClosed) {
+		t.Errorf("breaker %v after a successful probe, want closed", st)
+	}
+}
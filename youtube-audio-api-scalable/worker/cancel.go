@@ -0,0 +1,258 @@
+// worker/cancel.go
+package main
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"sync"
+	"time"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+// cancelPollInterval is how often a running job re-reads its status to notice cancellation
+var cancelPollInterval = 2 * time.Second
+
+var (
+	// errJobCancelled is returned by runTracked when the job was cancelled
+	errJobCancelled = errors.New("job cancelled")
+	// errJobInterrupted is returned by runTracked when the worker is shutting down
+	errJobInterrupted = errors.New("job interrupted by shutdown")
+	// errJobOverBudget is returned by runTracked once the job has run longer than cfg.JobTotalTimeout
+	errJobOverBudget = errors.New("exceeded total time budget")
+)
+
+// isJobStop reports whether err means the job was stopped from outside
+// rather than the command failing on its own
+func isJobStop(err error) bool {
+	return err == errJobCancelled || err == errJobInterrupted || err == errJobOverBudget
+}
+
+// runningJob tracks the external command currently executing for a job
+type runningJob struct {
+	msg         shared.JobMessage
+	cmd         *exec.Cmd
+	cancelled   bool
+	interrupted bool    // Set on shutdown; the job is re-queued instead of finished
+	overBudget  bool    // Set once the job has used up cfg.JobTotalTimeout
+	log         *jobLog // Output of every command run for the job
+}
+
+var (
+	runningJobs   = map[string]*runningJob{}
+	runningJobsMu sync.Mutex
+)
+
+// trackJob registers the job as running and starts watching the DB for a
+// cancellation request, and the clock for cfg.JobTotalTimeout. The returned
+// func must be called when the job ends; it returns once the watch has stopped.
+func trackJob(msg shared.JobMessage) func() {
+	jobID := msg.JobID
+	runningJobsMu.Lock()
+	runningJobs[jobID] = &runningJob{msg: msg, log: &jobLog{}}
+	runningJobsMu.Unlock()
+
+	done := make(chan struct{})
+	watching := make(chan struct{})
+	go func() {
+		defer close(watching)
+		watchCancellation(jobID, done)
+	}()
+	stopBudget := func() bool { return false }
+	if cfg.JobTotalTimeout > 0 {
+		budget, cancel := context.WithTimeout(context.Background(), cfg.JobTotalTimeout)
+		stop := context.AfterFunc(budget, func() {
+			if errors.Is(budget.Err(), context.DeadlineExceeded) {
+				stopOverBudgetJob(jobID)
+			}
+		})
+		stopBudget = func() bool { cancel(); return stop() }
+	}
+	return func() {
+		close(done)
+		<-watching // A poll already under way must not outlive the job
+		stopBudget()
+		runningJobsMu.Lock()
+		delete(runningJobs, jobID)
+		runningJobsMu.Unlock()
+	}
+}
+
+// watchCancellation polls the job until done is closed and kills its command
+// once it is cancelled, or an admin forced it to another final status
+func watchCancellation(jobID string, done <-chan struct{}) {
+	ticker := time.NewTicker(cancelPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		job, err := db.GetJob(context.Background(), jobID)
+		if err != nil {
+			continue
+		}
+		if job.Status.IsTerminal() {
+			cancelRunningJob(jobID)
+			return
+		}
+	}
+}
+
+// cancelRunningJob marks jobID cancelled and kills its current command, if any
+func cancelRunningJob(jobID string) {
+	runningJobsMu.Lock()
+	defer runningJobsMu.Unlock()
+	rj, ok := runningJobs[jobID]
+	if !ok {
+		return
+	}
+	rj.cancelled = true
+	if rj.cmd != nil && rj.cmd.Process != nil {
+		jl := shared.WithJob(logger, jobID)
+		jl.Info("Killing running command for cancelled job")
+		if err := killCommand(rj.cmd); err != nil {
+			jl.Warn("Failed to kill command", "error", err)
+		}
+	}
+}
+
+// stopOverBudgetJob marks jobID over its time budget and kills its current command, if any
+func stopOverBudgetJob(jobID string) {
+	runningJobsMu.Lock()
+	defer runningJobsMu.Unlock()
+	rj, ok := runningJobs[jobID]
+	if !ok {
+		return
+	}
+	rj.overBudget = true
+	jl := shared.WithJob(logger, jobID)
+	jl.Warn("Job exceeded its total time budget, stopping it", "budget", cfg.JobTotalTimeout.String())
+	if rj.cmd != nil && rj.cmd.Process != nil {
+		if err := killCommand(rj.cmd); err != nil {
+			jl.Warn("Failed to kill command", "error", err)
+		}
+	}
+}
+
+// interruptRunningJobs kills every running command so the jobs can be
+// re-queued on shutdown, and returns their messages
+func interruptRunningJobs() []shared.JobMessage {
+	runningJobsMu.Lock()
+	defer runningJobsMu.Unlock()
+	msgs := make([]shared.JobMessage, 0, len(runningJobs))
+	for _, rj := range runningJobs {
+		rj.interrupted = true
+		if rj.cmd != nil && rj.cmd.Process != nil {
+			killCommand(rj.cmd)
+		}
+		msgs = append(msgs, rj.msg)
+	}
+	return msgs
+}
+
+// isJobInterrupted reports whether jobID was interrupted by shutdown
+func isJobInterrupted(jobID string) bool {
+	runningJobsMu.Lock()
+	defer runningJobsMu.Unlock()
+	rj, ok := runningJobs[jobID]
+	return ok && rj.interrupted
+}
+
+// isJobOverBudget reports whether jobID has run longer than cfg.JobTotalTimeout
+func isJobOverBudget(jobID string) bool {
+	runningJobsMu.Lock()
+	defer runningJobsMu.Unlock()
+	rj, ok := runningJobs[jobID]
+	return ok && rj.overBudget
+}
+
+// isJobCancelled reports whether a cancellation was observed for jobID
+func isJobCancelled(jobID string) bool {
+	runningJobsMu.Lock()
+	defer runningJobsMu.Unlock()
+	rj, ok := runningJobs[jobID]
+	return ok && rj.cancelled
+}
+
+// isJobRunning reports whether this worker is processing jobID
+func isJobRunning(jobID string) bool {
+	runningJobsMu.Lock()
+	defer runningJobsMu.Unlock()
+	_, ok := runningJobs[jobID]
+	return ok
+}
+
+// runTracked runs cmd as the current command of jobID so it can be killed on cancellation
+func runTracked(jobID string, cmd *exec.Cmd) error {
+	runningJobsMu.Lock()
+	rj := runningJobs[jobID]
+	if rj != nil && rj.cancelled {
+		runningJobsMu.Unlock()
+		return errJobCancelled
+	}
+	if rj != nil && rj.interrupted {
+		runningJobsMu.Unlock()
+		return errJobInterrupted
+	}
+	if rj != nil && rj.overBudget {
+		runningJobsMu.Unlock()
+		return errJobOverBudget
+	}
+	if err := cmd.Start(); err != nil {
+		runningJobsMu.Unlock()
+		return err
+	}
+	if rj != nil {
+		rj.cmd = cmd
+	}
+	runningJobsMu.Unlock()
+
+	err := cmd.Wait()
+
+	runningJobsMu.Lock()
+	cancelled, interrupted, overBudget := false, false, false
+	if rj != nil {
+		rj.cmd = nil
+		cancelled, interrupted, overBudget = rj.cancelled, rj.interrupted, rj.overBudget
+	}
+	runningJobsMu.Unlock()
+	if cancelled {
+		return errJobCancelled
+	}
+	if interrupted {
+		return errJobInterrupted
+	}
+	if overBudget {
+		return errJobOverBudget
+	}
+	return err
+}
+
+// handleJobCancelled records that the worker stopped a cancelled job. A job
+// an admin forced to failed or completed keeps that status.
+func handleJobCancelled(ctx context.Context, job *shared.Job) {
+	if stored, err := db.GetJob(ctx, job.ID); err == nil && stored.Status.IsTerminal() &&
+		stored.Status != shared.JobStatusCancelled {
+		shared.WithJob(logger, job.ID).Info("Job stopped after its status was forced", "status", stored.Status)
+		return
+	}
+	cancelledNow := time.Now()
+	job.Status = shared.JobStatusCancelled
+	job.FailureReason = shared.FailureCancelled
+	job.CompletedAt = &cancelledNow
+	if job.CancelRequestedAt == nil {
+		job.CancelRequestedAt = &cancelledNow
+	}
+	jl := shared.WithJob(logger, job.ID)
+	if err := db.UpdateJob(ctx, job); err != nil {
+		jl.Error("Worker failed to update job status to cancelled in DB", "error", err)
+	} else {
+		recordJobEvent(ctx, job, "stopped by the worker after a cancel request")
+	}
+	observeJobTimings(job)
+	jl.Info("Job cancelled")
+	notifyWebhook(job)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+func TestForcedStatusKillsRunningJob(t *testing.T) {
+	defer func(interval time.Duration) { cancelPollInterval = interval }(cancelPollInterval)
+	cancelPollInterval = 20 * time.Millisecond
+	t.Setenv("YTDLP_PATH", stubYtDlp(t, videoInfoJSON))
+	ffmpeg := writeStub(t, "ffmpeg", `touch "$0.started"; exec sleep 30`)
+	t.Setenv("FFMPEG_PATH", ffmpeg)
+	setupWorker(t)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		processJob(seedJob(t, "job-1", "https://youtu.be/dQw4w9WgXcQ"))
+	}()
+	waitFor(t, 5*time.Second, "ffmpeg to start", func() bool {
+		_, err := os.Stat(ffmpeg + ".started")
+		return err == nil
+	})
+
+	// What POST /admin/jobs/{id}/force-status writes
+	ctx := context.Background()
+	job, err := db.GetJob(ctx, "job-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	job.Status = shared.JobStatusFailed
+	job.Error = "stuck converting"
+	job.CompletedAt = &now
+	if err := db.UpdateJob(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the running job was not stopped")
+	}
+	job, _ = db.GetJob(ctx, "job-1")
+	if job.Status != shared.JobStatusFailed || job.Error != "stuck converting" {
+		t.Errorf("job %s (%q), want the forced failure kept", job.Status, job.Error)
+	}
+	if isJobRunning("job-1") {
+		t.Error("job still tracked as running")
+	}
+}
+
+func TestProcessJobSkipsForcedJob(t *testing.T) {
+	ytDlp := stubYtDlp(t, videoInfoJSON)
+	t.Setenv("YTDLP_PATH", ytDlp)
+	setupWorker(t)
+	msg := seedJob(t, "job-1", "https://youtu.be/dQw4w9WgXcQ")
+	job, _ := db.GetJob(context.Background(), "job-1")
+	job.Status = shared.JobStatusCompleted
+	db.UpdateJob(context.Background(), job)
+
+	processJob(msg)
+
+	if _, err := os.Stat(ytDlp + ".args"); err == nil {
+		t.Error("yt-dlp ran for a job forced to completed")
+	}
+}
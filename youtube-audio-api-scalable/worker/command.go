@@ -0,0 +1,66 @@
+// worker/command.go
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// commandWaitDelay bounds how long Wait keeps reading output after the
+// command is killed, in case a grandchild still holds its stdout open
+const commandWaitDelay = 5 * time.Second
+
+// nicePath is nice(1), resolved at startup when cfg.FFmpegNice is set
+var nicePath string
+
+// withNice returns the command line that runs name with args under nice(1)
+// at cfg.FFmpegNice, or name and args unchanged when that is off. nice execs
+// the command in place, so killCommand still reaches it.
+func withNice(name string, args []string) (string, []string) {
+	if cfg.FFmpegNice <= 0 || nicePath == "" {
+		return name, args
+	}
+	return nicePath, append([]string{"-n", strconv.Itoa(cfg.FFmpegNice), name}, args...)
+}
+
+// errCommandTimedOut is returned by runCommand when the command ran too long
+var errCommandTimedOut = errors.New("timed out")
+
+// runCommand runs name with args as the current command of jobID, writing its
+// stdout and stderr to out. The command and any processes it started are
+// killed once timeout passes; 0 means no limit.
+func runCommand(jobID string, timeout time.Duration, out io.Writer, name string, args ...string) error {
+	ctx, cancel := context.Background(), context.CancelFunc(func() {})
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	defer cancel()
+
+	// Everything the command prints also goes to the job's logs
+	log := jobLogWriter(jobID)
+	fmt.Fprintf(log, "$ %s %s\n", filepath.Base(name), strings.Join(args, " "))
+	out = io.MultiWriter(out, log)
+
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	startProcessGroup(cmd)
+	cmd.Cancel = func() error { return killCommand(cmd) }
+	cmd.WaitDelay = commandWaitDelay
+
+	err := runTracked(jobID, cmd)
+	if err != nil && !isJobStop(err) && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("%w after %s", errCommandTimedOut, timeout)
+	}
+	if err != nil {
+		fmt.Fprintf(log, "[%s exited: %v]\n", filepath.Base(name), err)
+	}
+	return err
+}
@@ -0,0 +1,17 @@
+//go:build !unix
+
+// worker/command_other.go
+package main
+
+import "os/exec"
+
+// startProcessGroup is a no-op where process groups aren't available
+func startProcessGroup(cmd *exec.Cmd) {}
+
+// killCommand kills cmd's process
+func killCommand(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return cmd.Process.Kill()
+}
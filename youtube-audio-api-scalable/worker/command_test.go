@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+func TestRunCommandKillsCommandPastTimeout(t *testing.T) {
+	setupWorker(t)
+	// The stub starts a child that would outlive it unless the whole group is killed
+	marker := filepath.Join(t.TempDir(), "survived")
+	stub := writeStub(t, "slow", `(sleep 1; touch "`+marker+`") &
+sleep 30`)
+
+	start := time.Now()
+	var out bytes.Buffer
+	err := runCommand("job-1", 100*time.Millisecond, &out, stub)
+	if !errors.Is(err, errCommandTimedOut) {
+		t.Fatalf("runCommand = %v, want errCommandTimedOut", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("runCommand returned after %s", elapsed)
+	}
+	time.Sleep(1500 * time.Millisecond)
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("a child of the timed-out command kept running")
+	}
+}
+
+func TestProcessJobFailsOnYtDlpTimeout(t *testing.T) {
+	t.Setenv("YTDLP_PATH", writeStub(t, "yt-dlp", "exec sleep 30"))
+	t.Setenv("FFMPEG_PATH", stubFFmpeg(t, "converted"))
+	t.Setenv("YTDLP_TIMEOUT_SECONDS", "1")
+	t.Setenv("MAX_JOB_ATTEMPTS", "1")
+	setupWorker(t)
+
+	processJob(seedJob(t, "job-1", "https://youtu.be/dQw4w9WgXcQ"))
+
+	job, err := db.GetJob(context.Background(), "job-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != shared.JobStatusFailed || job.FailureReason != shared.FailureTimeout {
+		t.Errorf("job is %s (%s): %s; want failed with a timeout", job.Status, job.FailureReason, job.Error)
+	}
+}
+
+func TestProcessJobFailsPastTotalBudget(t *testing.T) {
+	// Neither command reaches its own timeout, but together they pass the budget
+	t.Setenv("YTDLP_PATH", writeStub(t, "yt-dlp", `sleep 1.2
+cat <<'JSON'
+`+videoInfoJSON+`
+JSON`))
+	t.Setenv("FFMPEG_PATH", writeStub(t, "ffmpeg", "exec sleep 30"))
+	t.Setenv("JOB_TOTAL_TIMEOUT_SECONDS", "2")
+	t.Setenv("MAX_JOB_ATTEMPTS", "1")
+	setupWorker(t)
+
+	start := time.Now()
+	processJob(seedJob(t, "job-1", "https://youtu.be/dQw4w9WgXcQ"))
+	// processJob returning is what frees the worker slot
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("processJob returned after %s", elapsed)
+	}
+
+	job, err := db.GetJob(context.Background(), "job-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != shared.JobStatusFailed || !strings.Contains(job.Error, "exceeded total time budget") {
+		t.Errorf("job is %s: %q; want failed over budget", job.Status, job.Error)
+	}
+	if entries, _ := os.ReadDir(cfg.OutputDir); len(entries) != 0 {
+		t.Errorf("output dir holds %d file(s)", len(entries))
+	}
+}
+
+func TestFFmpegThreadsFromConfig(t *testing.T) {
+	tests := []struct {
+		env  string // FFMPEG_THREADS; "unset" leaves it unset
+		want string // "" when -threads must be absent
+	}{
+		{"unset", strconv.Itoa(max(1, runtime.NumCPU()/2))},
+		{"3", "3"},
+		{"0", ""},
+		{"many", strconv.Itoa(max(1, runtime.NumCPU()/2))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.env, func(t *testing.T) {
+			ffmpeg := stubFFmpeg(t, "converted")
+			t.Setenv("YTDLP_PATH", stubYtDlp(t, videoInfoJSON))
+			t.Setenv("FFMPEG_PATH", ffmpeg)
+			t.Setenv("FFMPEG_THREADS", tt.env)
+			if tt.env == "unset" {
+				os.Unsetenv("FFMPEG_THREADS")
+			}
+			setupWorker(t)
+
+			processJob(seedJob(t, "job-1", "https://youtu.be/dQw4w9WgXcQ"))
+
+			args := stubArgs(t, ffmpeg)
+			threads, ok := argValue(args, "-threads")
+			if threads != tt.want || ok != (tt.want != "") {
+				t.Errorf("-threads %q (present %v), want %q in %v", threads, ok, tt.want, args)
+			}
+			// -threads applies to the encoder, so it must come after the input
+			if ok && slices.Index(args, "-threads") < slices.Index(args, "-i") {
+				t.Errorf("-threads comes before the input: %v", args)
+			}
+		})
+	}
+}
+
+func TestWithNice(t *testing.T) {
+	setupWorker(t)
+	if name, args := withNice("/usr/bin/ffmpeg", []string{"-i", "in"}); name != "/usr/bin/ffmpeg" || len(args) != 2 {
+		t.Errorf("niceness off: %s %v", name, args)
+	}
+	cfg.FFmpegNice = 10
+	nicePath = "/usr/bin/nice"
+	name, args := withNice("/usr/bin/ffmpeg", []string{"-i", "in"})
+	if want := []string{"-n", "10", "/usr/bin/ffmpeg", "-i", "in"}; name != "/usr/bin/nice" || !slices.Equal(args, want) {
+		t.Errorf("niceness 10: %s %v, want /usr/bin/nice %v", name, args, want)
+	}
+	// nice wasn't found at startup
+	nicePath = ""
+	if name, _ := withNice("/usr/bin/ffmpeg", nil); name != "/usr/bin/ffmpeg" {
+		t.Errorf("without nice: ran %s", name)
+	}
+}
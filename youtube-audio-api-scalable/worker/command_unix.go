@@ -0,0 +1,26 @@
+//go:build unix
+
+// worker/command_unix.go
+package main
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// startProcessGroup makes cmd the leader of a new process group, so
+// killCommand also reaches anything it spawns (e.g. ffmpeg under yt-dlp)
+func startProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// killCommand kills cmd's whole process group
+func killCommand(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL); err != nil {
+		return cmd.Process.Kill()
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+// worker/concurrency.go
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+// maxConcurrencyLimit caps what POST /admin/concurrency accepts
+const maxConcurrencyLimit = 256
+
+// concurrencyLimiter is a semaphore whose size can change while jobs hold it.
+// Growing lets waiting acquirers in immediately; shrinking never interrupts
+// running jobs, new ones simply wait until enough of them have finished.
+type concurrencyLimiter struct {
+	mu     sync.Mutex
+	limit  int
+	active int
+	wake   chan struct{} // Closed and replaced whenever a slot may have opened
+}
+
+func newConcurrencyLimiter(limit int) *concurrencyLimiter {
+	return &concurrencyLimiter{limit: limit, wake: make(chan struct{})}
+}
+
+// Acquire blocks until a slot is free and takes it. It returns false if stop
+// is closed first.
+func (l *concurrencyLimiter) Acquire(stop <-chan struct{}) bool {
+	for {
+		l.mu.Lock()
+		if l.active < l.limit {
+			l.active++
+			l.mu.Unlock()
+			return true
+		}
+		wake := l.wake
+		l.mu.Unlock()
+		select {
+		case <-wake:
+		case <-stop:
+			return false
+		}
+	}
+}
+
+// Release gives back a slot taken by Acquire
+func (l *concurrencyLimiter) Release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active--
+	l.broadcast()
+}
+
+// SetLimit changes the number of slots and returns the previous limit
+func (l *concurrencyLimiter) SetLimit(n int) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	prev := l.limit
+	l.limit = n
+	l.broadcast()
+	return prev
+}
+
+// Usage returns the number of running jobs and the current limit. Right
+// after a shrink, active can exceed limit until running jobs finish.
+func (l *concurrencyLimiter) Usage() (active int, limit int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.active, l.limit
+}
+
+// broadcast wakes every waiting Acquire; l.mu must be held
+func (l *concurrencyLimiter) broadcast() {
+	close(l.wake)
+	l.wake = make(chan struct{})
+}
+
+// handleAdminConcurrency reports (GET) or changes (POST {"max_workers": n})
+// how many jobs this worker runs at once
+func handleAdminConcurrency(w http.ResponseWriter, r *http.Request) {
+	// Auth handled by middleware
+	previous := 0
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var req struct {
+			MaxWorkers int `json:"max_workers"`
+		}
+		if err := shared.DecodeJSONBody(w, r, &req, shared.MaxJSONBodySize); err != nil {
+			err.Write(w)
+			return
+		}
+		if req.MaxWorkers < 1 || req.MaxWorkers > maxConcurrencyLimit {
+			shared.WriteError(w, http.StatusBadRequest, shared.ErrCodeInvalidRequest, fmt.Sprintf("max_workers must be between 1 and %d", maxConcurrencyLimit))
+			return
+		}
+		previous = workerLimiter.SetLimit(req.MaxWorkers)
+		log.Printf("INFO: Worker concurrency changed from %d to %d", previous, req.MaxWorkers)
+	default:
+		shared.WriteError(w, http.StatusMethodNotAllowed, shared.ErrCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	active, limit := workerLimiter.Usage()
+	resp := map[string]any{
+		"current_concurrency": active,
+		"target_concurrency":  limit,
+	}
+	if previous > 0 {
+		resp["previous_target_concurrency"] = previous
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
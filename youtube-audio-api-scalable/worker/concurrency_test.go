@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tryAcquire takes a slot from l if one frees up within a short wait
+func tryAcquire(l *concurrencyLimiter) bool {
+	stop := make(chan struct{})
+	timer := time.AfterFunc(50*time.Millisecond, func() { close(stop) })
+	defer timer.Stop()
+	return l.Acquire(stop)
+}
+
+func TestConcurrencyLimiterGrowsAndShrinks(t *testing.T) {
+	l := newConcurrencyLimiter(2)
+	if !tryAcquire(l) || !tryAcquire(l) {
+		t.Fatal("could not take both slots")
+	}
+	if tryAcquire(l) {
+		t.Fatal("took a third slot with a limit of 2")
+	}
+
+	// Growing lets a waiting job in right away
+	acquired := make(chan bool)
+	go func() { acquired <- l.Acquire(make(chan struct{})) }()
+	if prev := l.SetLimit(3); prev != 2 {
+		t.Errorf("SetLimit returned %d, want the previous limit 2", prev)
+	}
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("a waiting job was not let in after growing")
+	}
+
+	// Shrinking keeps running jobs but makes new ones wait for enough to finish
+	l.SetLimit(1)
+	if active, limit := l.Usage(); active != 3 || limit != 1 {
+		t.Errorf("Usage = %d/%d after shrinking, want 3/1", active, limit)
+	}
+	l.Release()
+	l.Release()
+	if tryAcquire(l) {
+		t.Error("took a slot with 1 job running and a limit of 1")
+	}
+	l.Release()
+	if !tryAcquire(l) {
+		t.Error("could not take the only slot once every job finished")
+	}
+}
+
+func TestAdminConcurrencyChangesLimit(t *testing.T) {
+	setupWorker(t)
+	post := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handleAdminConcurrency(rec, httptest.NewRequest(http.MethodPost, "/admin/concurrency", strings.NewReader(body)))
+		return rec
+	}
+	if rec := post(`{"max_workers":7}`); rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if _, limit := workerLimiter.Usage(); limit != 7 {
+		t.Errorf("limit %d, want 7", limit)
+	}
+	for _, body := range []string{`{"max_workers":0}`, `{"max_workers":100000}`} {
+		if rec := post(body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", body, rec.Code)
+		}
+	}
+	if _, limit := workerLimiter.Usage(); limit != 7 {
+		t.Errorf("a rejected change moved the limit to %d", limit)
+	}
+}
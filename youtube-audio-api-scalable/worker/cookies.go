@@ -0,0 +1,47 @@
+// worker/cookies.go
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+// cookiesFileFor returns the cookies file yt-dlp should use for msg, or "" for
+// none, and a func that cleans up. Cookies sent with the request are written
+// to a temp file readable only by the worker, which cleanup removes.
+func cookiesFileFor(msg shared.JobMessage) (string, func(), error) {
+	if msg.Cookies == "" {
+		return cfg.CookiesFilePath, func() {}, nil
+	}
+	data, err := shared.DecodeCookies(msg.Cookies)
+	if err != nil {
+		return "", nil, err
+	}
+	f, err := os.CreateTemp("", "cookies-"+msg.JobID+"-*.txt")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create cookies file: %v", err)
+	}
+	path := f.Name()
+	cleanup := func() {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			shared.WithJob(logger, msg.JobID).Warn("Failed to remove cookies file", "error", err)
+		}
+	}
+	if err := f.Chmod(0o600); err != nil {
+		f.Close()
+		cleanup()
+		return "", nil, fmt.Errorf("failed to restrict cookies file: %v", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		cleanup()
+		return "", nil, fmt.Errorf("failed to write cookies file: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to write cookies file: %v", err)
+	}
+	return path, cleanup, nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/base64"
+	"os"
+	"slices"
+	"testing"
+)
+
+func TestGetAudioStreamPassesCookies(t *testing.T) {
+	ytDlp := stubYtDlp(t, videoInfoJSON)
+	setupWorker(t)
+
+	if _, _, err := getAudioStream(ytDlp, "https://youtu.be/dQw4w9WgXcQ", "job-1", ytDlpOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if args := stubArgs(t, ytDlp); slices.Contains(args, "--cookies") {
+		t.Errorf("--cookies passed without a cookies file: %v", args)
+	}
+
+	if _, _, err := getAudioStream(ytDlp, "https://youtu.be/dQw4w9WgXcQ", "job-1", ytDlpOptions{CookiesPath: "/etc/yt/cookies.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	if path, _ := argValue(stubArgs(t, ytDlp), "--cookies"); path != "/etc/yt/cookies.txt" {
+		t.Errorf("--cookies %q, want the configured file", path)
+	}
+}
+
+func TestCookiesFileForRequestCookies(t *testing.T) {
+	setupWorker(t)
+	cfg.CookiesFilePath = "/etc/yt/cookies.txt"
+	if path, cleanup, err := cookiesFileFor(seedJob(t, "job-1", "https://youtu.be/dQw4w9WgXcQ")); err != nil || path != cfg.CookiesFilePath {
+		t.Errorf("without request cookies got %q, %v; want the configured file", path, err)
+	} else {
+		cleanup()
+	}
+
+	msg := seedJob(t, "job-2", "https://youtu.be/dQw4w9WgXcQ")
+	msg.Cookies = base64.StdEncoding.EncodeToString([]byte("# Netscape HTTP Cookie File\n"))
+	path, cleanup, err := cookiesFileFor(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("cookies file mode %v, want 0600", info.Mode().Perm())
+	}
+	if b, _ := os.ReadFile(path); string(b) != "# Netscape HTTP Cookie File\n" {
+		t.Errorf("cookies file holds %q", b)
+	}
+	cleanup()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("cleanup left the cookies file behind")
+	}
+
+	msg.Cookies = "not base64!"
+	if _, _, err := cookiesFileFor(msg); err == nil {
+		t.Error("accepted cookies that aren't base64")
+	}
+}
@@ -0,0 +1,37 @@
+// worker/disk.go
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// diskStatus is the OutputDir part of the worker's health report
+type diskStatus struct {
+	Path         string `json:"path"`
+	FreeBytes    uint64 `json:"free_bytes"`
+	TotalBytes   uint64 `json:"total_bytes"`
+	MinFreeBytes int64  `json:"min_free_bytes"` // 0 when the check is off
+}
+
+// statDisk measures the filesystem holding a path; tests replace it to fake a
+// full disk
+var statDisk = statFilesystem
+
+// checkDiskSpace reports the space in cfg.OutputDir and fails when less than
+// cfg.MinFreeDiskBytes is free, as conversions would soon fail to write. It
+// returns a nil status where the space can't be measured.
+func checkDiskSpace() (*diskStatus, error) {
+	free, total, err := statDisk(cfg.OutputDir)
+	if errors.Is(err, errors.ErrUnsupported) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	st := &diskStatus{Path: cfg.OutputDir, FreeBytes: free, TotalBytes: total, MinFreeBytes: cfg.MinFreeDiskBytes}
+	if cfg.MinFreeDiskBytes > 0 && free < uint64(cfg.MinFreeDiskBytes) {
+		return st, fmt.Errorf("%d bytes free in %s, below MIN_FREE_DISK_BYTES (%d)", free, cfg.OutputDir, cfg.MinFreeDiskBytes)
+	}
+	return st, nil
+}
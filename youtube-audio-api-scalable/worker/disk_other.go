@@ -0,0 +1,11 @@
+//go:build !(linux || darwin || freebsd)
+
+// worker/disk_other.go
+package main
+
+import "errors"
+
+// statFilesystem is not implemented here; the disk space check is skipped
+func statFilesystem(path string) (free, total uint64, err error) {
+	return 0, 0, errors.ErrUnsupported
+}
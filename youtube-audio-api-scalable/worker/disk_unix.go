@@ -0,0 +1,16 @@
+//go:build linux || darwin || freebsd
+
+// worker/disk_unix.go
+package main
+
+import "syscall"
+
+// statFilesystem returns the space available to unprivileged users and the
+// total size, in bytes, of the filesystem holding path
+func statFilesystem(path string) (free, total uint64, err error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, 0, err
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), uint64(st.Blocks) * uint64(st.Bsize), nil
+}
@@ -0,0 +1,63 @@
+// worker/drain.go
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+// drained is set once POST /admin/drain has finished waiting for running
+// jobs; /health then reports the worker not ready until it is resumed
+var drained atomic.Bool
+
+// handleAdminDrain: Prepares the worker to exit, e.g. from a Kubernetes
+// preStop hook. It pauses queue consumption, waits until running jobs finish
+// or ?timeout= seconds pass (default cfg.ShutdownTimeout), and then fails
+// /health so the load balancer stops routing to the worker. It responds 200
+// once no job is running, 503 if the timeout came first.
+func handleAdminDrain(w http.ResponseWriter, r *http.Request) {
+	// Auth handled by middleware
+	if r.Method != http.MethodPost {
+		shared.WriteError(w, http.StatusMethodNotAllowed, shared.ErrCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+	timeout := cfg.ShutdownTimeout
+	if v := r.URL.Query().Get("timeout"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			shared.WriteError(w, http.StatusBadRequest, shared.ErrCodeInvalidRequest, "timeout must be a positive number of seconds")
+			return
+		}
+		timeout = time.Duration(n) * time.Second
+	}
+
+	consumerPause.Pause()
+	active, _ := workerLimiter.Usage()
+	log.Printf("INFO: Draining worker: queue consumption paused, waiting up to %s for %d job(s)", timeout, active)
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	finished := drainWorkers(ctx)
+	drained.Store(true)
+	active, _ = workerLimiter.Usage()
+	if finished {
+		log.Println("INFO: Worker drained; all in-flight jobs finished.")
+	} else {
+		log.Printf("WARN: Drain timeout reached with %d job(s) still running", active)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !finished {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(map[string]any{
+		"drained":        finished,
+		"active_workers": active,
+	})
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type drainResult struct {
+	code          int
+	Drained       bool `json:"drained"`
+	ActiveWorkers int  `json:"active_workers"`
+}
+
+// startDrain calls POST /admin/drain in the background; the result arrives once it returns
+func startDrain(t *testing.T, query string) <-chan drainResult {
+	t.Helper()
+	done := make(chan drainResult, 1)
+	go func() {
+		rec := httptest.NewRecorder()
+		handleAdminDrain(rec, httptest.NewRequest(http.MethodPost, "/admin/drain"+query, nil))
+		res := drainResult{code: rec.Code}
+		json.Unmarshal(rec.Body.Bytes(), &res)
+		done <- res
+	}()
+	return done
+}
+
+func TestDrainWaitsForRunningJobs(t *testing.T) {
+	t.Setenv("YTDLP_PATH", stubYtDlp(t, videoInfoJSON))
+	t.Setenv("FFMPEG_PATH", stubFFmpeg(t, ""))
+	setupWorker(t)
+	workerLimiter.Acquire(nil) // A job in progress
+
+	done := startDrain(t, "?timeout=10")
+	waitFor(t, 2*time.Second, "consumption to pause", func() bool {
+		paused, _ := consumerPause.State()
+		return paused
+	})
+	select {
+	case res := <-done:
+		t.Fatalf("drain returned %+v while a job was running", res)
+	case <-time.After(300 * time.Millisecond):
+	}
+	if code, _ := healthChecks(t); code != http.StatusOK {
+		t.Errorf("health status %d while draining, want 200 until the jobs finish", code)
+	}
+
+	workerLimiter.Release()
+	select {
+	case res := <-done:
+		if res.code != http.StatusOK || !res.Drained || res.ActiveWorkers != 0 {
+			t.Errorf("drain = %+v, want 200 with nothing running", res)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("drain did not return once the job finished")
+	}
+	if code, _ := healthChecks(t); code != http.StatusServiceUnavailable {
+		t.Errorf("health status %d after draining, want 503", code)
+	}
+
+	// Resuming makes the worker ready again
+	handleAdminResume(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/admin/resume", nil))
+	if code, _ := healthChecks(t); code != http.StatusOK {
+		t.Errorf("health status %d after resuming, want 200", code)
+	}
+}
+
+func TestDrainTimesOut(t *testing.T) {
+	t.Setenv("YTDLP_PATH", stubYtDlp(t, videoInfoJSON))
+	t.Setenv("FFMPEG_PATH", stubFFmpeg(t, ""))
+	setupWorker(t)
+	workerLimiter.Acquire(nil)
+	defer workerLimiter.Release()
+
+	start := time.Now()
+	select {
+	case res := <-startDrain(t, "?timeout=1"):
+		if elapsed := time.Since(start); elapsed < time.Second {
+			t.Errorf("drain returned after %s, before its timeout", elapsed)
+		}
+		if res.code != http.StatusServiceUnavailable || res.Drained || res.ActiveWorkers != 1 {
+			t.Errorf("drain = %+v, want 503 with the job still running", res)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("drain ignored its timeout")
+	}
+	// Not ready either way: the worker is about to be stopped
+	if code, _ := healthChecks(t); code != http.StatusServiceUnavailable {
+		t.Errorf("health status %d after the drain timed out, want 503", code)
+	}
+}
+
+func TestDrainRejectsBadRequests(t *testing.T) {
+	setupWorker(t)
+	for _, tt := range []struct {
+		method, target string
+		want           int
+	}{
+		{http.MethodGet, "/admin/drain", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/admin/drain?timeout=soon", http.StatusBadRequest},
+		{http.MethodPost, "/admin/drain?timeout=0", http.StatusBadRequest},
+	} {
+		rec := httptest.NewRecorder()
+		handleAdminDrain(rec, httptest.NewRequest(tt.method, tt.target, nil))
+		if rec.Code != tt.want {
+			t.Errorf("%s %s: status %d, want %d", tt.method, tt.target, rec.Code, tt.want)
+		}
+	}
+	if paused, _ := consumerPause.State(); paused {
+		t.Error("a rejected drain paused the worker")
+	}
+}
@@ -0,0 +1,39 @@
+// worker/extractor.go
+package main
+
+import (
+	"errors"
+	"log/slog"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+// Extractor names recorded on jobs; paths are kept out of the public status
+const (
+	extractorPrimary  = "yt-dlp"
+	extractorFallback = "fallback"
+)
+
+// extractAudioStream gets the job's audio stream with yt-dlp and, when that
+// fails in a way a retry might fix, once more with cfg.FallbackExtractorPath
+// (e.g. a patched yt-dlp fork). extractor names the one that ran last.
+func extractAudioStream(jl *slog.Logger, videoURL string, jobID string, opts ytDlpOptions) (audioURL string, meta *shared.Metadata, extractor string, err error) {
+	audioURL, meta, err = getAudioStream(cfg.YtDlpPath, videoURL, jobID, opts)
+	if err == nil || cfg.FallbackExtractorPath == "" || !isRetryableExtractError(jobID, err) {
+		return audioURL, meta, extractorPrimary, err
+	}
+	jl.Warn("yt-dlp failed, trying the fallback extractor", "extractor", cfg.FallbackExtractorPath, "error", err)
+	audioURL, meta, err = getAudioStream(cfg.FallbackExtractorPath, videoURL, jobID, opts)
+	return audioURL, meta, extractorFallback, err
+}
+
+// isRetryableExtractError reports whether err from getAudioStream is one the
+// job is retried after, rather than the job being stopped or the video being
+// one that fails the same way every time
+func isRetryableExtractError(jobID string, err error) bool {
+	if isJobCancelled(jobID) || isJobInterrupted(jobID) || isJobOverBudget(jobID) {
+		return false
+	}
+	return !errors.Is(err, shared.ErrLiveStream) && !errors.Is(err, shared.ErrFormatUnavailable) &&
+		!errors.Is(err, errVideoTooLong)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+// failingExtractor creates an extractor that saves its arguments and fails as
+// yt-dlp does when YouTube blocks it
+func failingExtractor(t *testing.T, name string) string {
+	t.Helper()
+	return writeStub(t, name, `printf '%s\n' "$@" > "$0.args"
+echo "ERROR: [youtube] dQw4w9WgXcQ: HTTP Error 403: Forbidden" >&2
+exit 1`)
+}
+
+// fallbackExtractor creates a working extractor like stubYtDlp under another name
+func fallbackExtractor(t *testing.T, output string) string {
+	t.Helper()
+	return writeStub(t, "yt-dlp-fork", `printf '%s\n' "$@" > "$0.args"
+cat <<'JSON'
+`+output+`
+JSON`)
+}
+
+func TestFallbackExtractorAfterPrimaryFails(t *testing.T) {
+	primary := failingExtractor(t, "yt-dlp")
+	fallback := fallbackExtractor(t, videoInfoJSON)
+	t.Setenv("YTDLP_PATH", primary)
+	t.Setenv("FALLBACK_EXTRACTOR_PATH", fallback)
+	t.Setenv("FFMPEG_PATH", stubFFmpeg(t, "converted"))
+	setupWorker(t)
+
+	processJob(seedJob(t, "job-1", "https://youtu.be/dQw4w9WgXcQ"))
+
+	job, _ := db.GetJob(context.Background(), "job-1")
+	if job.Status != shared.JobStatusCompleted || job.Extractor != extractorFallback {
+		t.Fatalf("job %s (%s) extracted by %q, want completed by %q", job.Status, job.Error, job.Extractor, extractorFallback)
+	}
+	if job.Metadata == nil || job.Metadata.Title != "Test Song" {
+		t.Errorf("metadata %+v, want the fallback's", job.Metadata)
+	}
+	// The fallback takes the same arguments
+	if got, want := stubArgs(t, fallback), stubArgs(t, primary); !slices.Equal(got, want) {
+		t.Errorf("fallback run with %q, primary with %q", got, want)
+	}
+}
+
+func TestFallbackExtractorNotRunAfterSuccess(t *testing.T) {
+	fallback := fallbackExtractor(t, videoInfoJSON)
+	t.Setenv("YTDLP_PATH", stubYtDlp(t, videoInfoJSON))
+	t.Setenv("FALLBACK_EXTRACTOR_PATH", fallback)
+	t.Setenv("FFMPEG_PATH", stubFFmpeg(t, "converted"))
+	setupWorker(t)
+
+	processJob(seedJob(t, "job-1", "https://youtu.be/dQw4w9WgXcQ"))
+
+	job, _ := db.GetJob(context.Background(), "job-1")
+	if job.Status != shared.JobStatusCompleted || job.Extractor != extractorPrimary {
+		t.Errorf("job %s extracted by %q, want completed by %q", job.Status, job.Extractor, extractorPrimary)
+	}
+	if _, err := os.Stat(fallback + ".args"); err == nil {
+		t.Error("the fallback ran although yt-dlp succeeded")
+	}
+}
+
+func TestFallbackExtractorSkippedForPermanentFailures(t *testing.T) {
+	live := strings.Replace(videoInfoJSON, `"live_status":"not_live"`, `"live_status":"is_live"`, 1)
+	fallback := fallbackExtractor(t, videoInfoJSON)
+	t.Setenv("YTDLP_PATH", stubYtDlp(t, live))
+	t.Setenv("FALLBACK_EXTRACTOR_PATH", fallback)
+	t.Setenv("MAX_JOB_ATTEMPTS", "1")
+	setupWorker(t)
+
+	processJob(seedJob(t, "job-1", "https://youtu.be/dQw4w9WgXcQ"))
+
+	if job, _ := db.GetJob(context.Background(), "job-1"); job.Status != shared.JobStatusFailed {
+		t.Errorf("live video job %s, want failed", job.Status)
+	}
+	if _, err := os.Stat(fallback + ".args"); err == nil {
+		t.Error("the fallback ran for a live stream, which fails the same way every time")
+	}
+}
+
+func TestFallbackExtractorFailsToo(t *testing.T) {
+	fallback := failingExtractor(t, "yt-dlp-fork")
+	t.Setenv("YTDLP_PATH", failingExtractor(t, "yt-dlp"))
+	t.Setenv("FALLBACK_EXTRACTOR_PATH", fallback)
+	t.Setenv("MAX_JOB_ATTEMPTS", "1")
+	setupWorker(t)
+
+	processJob(seedJob(t, "job-1", "https://youtu.be/dQw4w9WgXcQ"))
+
+	job, _ := db.GetJob(context.Background(), "job-1")
+	if job.Status != shared.JobStatusFailed || !strings.Contains(job.Error, "403") || job.Extractor != "" {
+		t.Errorf("job %s (%q) extracted by %q, want failed with the fallback's error", job.Status, job.Error, job.Extractor)
+	}
+	stubArgs(t, fallback) // Fails the test if the fallback didn't run
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+func TestProcessJobRecordsFailureReason(t *testing.T) {
+	tests := []struct {
+		name   string
+		ytDlp  string // Stub script
+		maxDur string
+		want   shared.FailureReason
+	}{
+		{"unsupported url", `echo "ERROR: Unsupported URL: https://youtu.be/dQw4w9WgXcQ"; exit 1`, "", shared.FailureURLInvalid},
+		{"private video", `echo "ERROR: [youtube] dQw4w9WgXcQ: Private video. Sign in if you've been granted access to this video"; exit 1`, "", shared.FailureVideoUnavailable},
+		{"network error", `echo "ERROR: Unable to download webpage: HTTP Error 503"; exit 1`, "", shared.FailureExtractFailed},
+		{"too long", "cat <<'JSON'\n" + videoInfoJSON + "\nJSON", "30", shared.FailureTooLong},
+		{"ffmpeg crash", "cat <<'JSON'\n" + videoInfoJSON + "\nJSON", "", shared.FailureConvertFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("YTDLP_PATH", writeStub(t, "yt-dlp", tt.ytDlp))
+			t.Setenv("FFMPEG_PATH", writeStub(t, "ffmpeg", `echo "Conversion failed!"; exit 1`))
+			t.Setenv("MAX_JOB_ATTEMPTS", "1")
+			t.Setenv("MAX_VIDEO_DURATION_SECONDS", tt.maxDur)
+			setupWorker(t)
+
+			processJob(seedJob(t, "job-1", "https://youtu.be/dQw4w9WgXcQ"))
+
+			job, err := db.GetJob(context.Background(), "job-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if job.Status != shared.JobStatusFailed || job.FailureReason != tt.want {
+				t.Errorf("job is %s with reason %q, want failed with %q: %s", job.Status, job.FailureReason, tt.want, job.Error)
+			}
+		})
+	}
+}
+
+func TestYtDlpFailure(t *testing.T) {
+	if got := ytDlpFailure(fmt.Errorf("%w: 90s > 60s", errVideoTooLong)); got != shared.FailureTooLong {
+		t.Errorf("video too long classified as %s", got)
+	}
+	if got := ytDlpFailure(fmt.Errorf("yt-dlp failed: exit status 1\nOutput: ERROR: Video unavailable")); got != shared.FailureVideoUnavailable {
+		t.Errorf("unavailable video classified as %s", got)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+// formatsInfoJSON is videoInfoJSON listing an audio-only, a video-only and a
+// muxed stream
+var formatsInfoJSON = strings.TrimSuffix(videoInfoJSON, "}") + `,"formats":[` +
+	`{"format_id":"140","url":"https://93.184.216.34/140.m4a","ext":"m4a","acodec":"mp4a.40.2","vcodec":"none","abr":129},` +
+	`{"format_id":"137","url":"https://93.184.216.34/137.mp4","ext":"mp4","acodec":"none","vcodec":"avc1"},` +
+	`{"format_id":"18","url":"https://93.184.216.34/18.mp4","ext":"mp4","acodec":"mp4a.40.2","vcodec":"avc1","abr":96}]}`
+
+func TestGetAudioStreamSelectsFormat(t *testing.T) {
+	t.Setenv("YTDLP_PATH", stubYtDlp(t, formatsInfoJSON))
+	setupWorker(t)
+
+	tests := []struct {
+		formatID string
+		wantURL  string // Empty means the format is rejected
+		wantExt  string
+	}{
+		{"", "https://93.184.216.34/audio.webm", "webm"},
+		{"140", "https://93.184.216.34/140.m4a", "m4a"},
+		{"18", "https://93.184.216.34/18.mp4", "mp4"},
+		{"137", "", ""}, // Video only
+		{"999", "", ""},
+	}
+	for _, tt := range tests {
+		audioURL, meta, err := getAudioStream(cfg.YtDlpPath, "https://youtu.be/dQw4w9WgXcQ", "job-1", ytDlpOptions{FormatID: tt.formatID})
+		if tt.wantURL == "" {
+			if !errors.Is(err, shared.ErrFormatUnavailable) {
+				t.Errorf("format %q: err = %v, want ErrFormatUnavailable", tt.formatID, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("format %q: %v", tt.formatID, err)
+			continue
+		}
+		if audioURL != tt.wantURL || meta.Ext != tt.wantExt {
+			t.Errorf("format %q: got %s (%s), want %s (%s)", tt.formatID, audioURL, meta.Ext, tt.wantURL, tt.wantExt)
+		}
+	}
+}
+
+func TestProcessJobFailsOnUnavailableFormat(t *testing.T) {
+	ffmpeg := stubFFmpeg(t, "converted")
+	t.Setenv("YTDLP_PATH", stubYtDlp(t, formatsInfoJSON))
+	t.Setenv("FFMPEG_PATH", ffmpeg)
+	setupWorker(t)
+
+	msg := seedJob(t, "job-1", "https://youtu.be/dQw4w9WgXcQ")
+	msg.FormatID = "999"
+	processJob(msg)
+
+	job, err := db.GetJob(context.Background(), "job-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != shared.JobStatusFailed || !strings.Contains(job.Error, `"999" is not one of the video's audio formats (140, 18)`) {
+		t.Errorf("job is %s: %s", job.Status, job.Error)
+	}
+	if job.Attempts > 1 {
+		t.Errorf("unavailable format was retried %d times", job.Attempts)
+	}
+	if _, err := os.Stat(ffmpeg + ".args"); err == nil {
+		t.Error("ffmpeg ran for an unavailable format")
+	}
+}
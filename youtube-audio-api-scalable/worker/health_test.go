@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+// unreachableDB is a database whose every call fails, as when Redis is down
+type unreachableDB struct{ shared.DatabaseClient }
+
+func (unreachableDB) Ping(ctx context.Context) error {
+	return fmt.Errorf("dial tcp 10.0.0.5:6379: connection refused")
+}
+
+// healthChecks fetches /health and returns its status code and checks
+func healthChecks(t *testing.T) (int, map[string]shared.HealthCheck) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handleHealth(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	var resp struct {
+		Checks map[string]shared.HealthCheck `json:"checks"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding %q: %v", rec.Body, err)
+	}
+	return rec.Code, resp.Checks
+}
+
+func TestHealthReportsFailingDependencies(t *testing.T) {
+	t.Setenv("YTDLP_PATH", stubYtDlp(t, videoInfoJSON))
+	t.Setenv("FFMPEG_PATH", stubFFmpeg(t, ""))
+	setupWorker(t)
+	if code, checks := healthChecks(t); code != http.StatusOK {
+		t.Fatalf("healthy worker: status %d, checks %+v", code, checks)
+	}
+
+	db = unreachableDB{db}
+	code, checks := healthChecks(t)
+	if code != http.StatusServiceUnavailable || checks["database"].OK || !checks["queue"].OK {
+		t.Errorf("failing database: status %d, checks %+v", code, checks)
+	}
+
+	db = shared.NewInMemoryDB()
+	cfg.FFmpegPath = filepath.Join(t.TempDir(), "ffmpeg")
+	code, checks = healthChecks(t)
+	if code != http.StatusServiceUnavailable || checks["ffmpeg"].OK || !checks["yt-dlp"].OK {
+		t.Errorf("missing ffmpeg: status %d, checks %+v", code, checks)
+	}
+}
+
+func TestHealthReportsStoppedConsumer(t *testing.T) {
+	t.Setenv("YTDLP_PATH", stubYtDlp(t, videoInfoJSON))
+	t.Setenv("FFMPEG_PATH", stubFFmpeg(t, ""))
+	setupWorker(t)
+	runConsumer(t)
+	if code, checks := healthChecks(t); code != http.StatusOK || !checks["consumer"].OK {
+		t.Fatalf("consuming worker: status %d, checks %+v", code, checks)
+	}
+
+	mq.Close()
+	waitFor(t, 5*time.Second, "the consumer to stop", consumerStopped.Load)
+	code, checks := healthChecks(t)
+	if code != http.StatusServiceUnavailable || checks["consumer"].OK {
+		t.Errorf("stopped consumer: status %d, checks %+v", code, checks)
+	}
+}
+
+func TestHealthReportsDiskSpace(t *testing.T) {
+	t.Setenv("YTDLP_PATH", stubYtDlp(t, videoInfoJSON))
+	t.Setenv("FFMPEG_PATH", stubFFmpeg(t, ""))
+	t.Setenv("MIN_FREE_DISK_BYTES", "1000")
+	setupWorker(t)
+	defer func(stat func(string) (uint64, uint64, error)) { statDisk = stat }(statDisk)
+	var statted string
+	free := uint64(5000)
+	statDisk = func(path string) (uint64, uint64, error) {
+		statted = path
+		return free, 10000, nil
+	}
+
+	health := func() (int, map[string]shared.HealthCheck, diskStatus) {
+		rec := httptest.NewRecorder()
+		handleHealth(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+		var resp struct {
+			Checks map[string]shared.HealthCheck `json:"checks"`
+			Disk   diskStatus                    `json:"disk"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decoding %q: %v", rec.Body, err)
+		}
+		return rec.Code, resp.Checks, resp.Disk
+	}
+	code, checks, disk := health()
+	if code != http.StatusOK || !checks["disk"].OK {
+		t.Fatalf("enough space: status %d, checks %+v", code, checks)
+	}
+	want := diskStatus{Path: cfg.OutputDir, FreeBytes: 5000, TotalBytes: 10000, MinFreeBytes: 1000}
+	if disk != want || statted != cfg.OutputDir {
+		t.Errorf("disk %+v (statted %s), want %+v", disk, statted, want)
+	}
+
+	free = 999
+	if code, checks, disk := health(); code != http.StatusServiceUnavailable || checks["disk"].OK || disk.FreeBytes != 999 {
+		t.Errorf("nearly full: status %d, checks %+v, disk %+v", code, checks, disk)
+	}
+
+	// Unmeasurable space doesn't fail the worker
+	statDisk = func(string) (uint64, uint64, error) { return 0, 0, errors.ErrUnsupported }
+	if code, checks, _ := health(); code != http.StatusOK || !checks["disk"].OK {
+		t.Errorf("unsupported: status %d, checks %+v", code, checks)
+	}
+}
+
+func TestCheckDiskSpaceMeasuresOutputDir(t *testing.T) {
+	setupWorker(t)
+	st, err := checkDiskSpace() // Fails only when the real disk is nearly full
+	if st == nil {
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Skip("disk space can't be measured on this platform")
+	}
+	if st.Path != cfg.OutputDir || st.TotalBytes == 0 || st.FreeBytes > st.TotalBytes {
+		t.Errorf("disk status %+v", st)
+	}
+}
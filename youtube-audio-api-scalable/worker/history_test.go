@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+func TestProcessJobRecordsTransitions(t *testing.T) {
+	// Fails once, as a flaky network would, then succeeds
+	t.Setenv("YTDLP_PATH", writeStub(t, "yt-dlp", `if [ ! -e "$0.failed" ]; then
+  touch "$0.failed"
+  echo "ERROR: Unable to download webpage: Connection reset by peer"
+  exit 1
+fi
+cat <<'JSON'
+`+videoInfoJSON+`
+JSON`))
+	t.Setenv("FFMPEG_PATH", stubFFmpeg(t, "converted"))
+	t.Setenv("MAX_JOB_ATTEMPTS", "3")
+	setupWorker(t)
+	ctx := context.Background()
+
+	msg := seedJob(t, "job-1", "https://youtu.be/dQw4w9WgXcQ")
+	processJob(msg)
+	msg.Attempt = 1
+	processJob(msg)
+
+	events, err := db.GetJobHistory(ctx, "job-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var statuses []shared.JobStatus
+	for i, ev := range events {
+		statuses = append(statuses, ev.Status)
+		if ev.Source != "worker" || ev.At.IsZero() {
+			t.Errorf("event %d: %+v", i, ev)
+		}
+		if i > 0 && ev.At.Before(events[i-1].At) {
+			t.Errorf("event %d is older than the one before it", i)
+		}
+	}
+	want := []shared.JobStatus{shared.JobStatusProcessing, shared.JobStatusPending, shared.JobStatusProcessing, shared.JobStatusCompleted}
+	if !slices.Equal(statuses, want) {
+		t.Fatalf("recorded %v, want %v", statuses, want)
+	}
+	if events[0].Reason != "attempt 1 of 3" || events[2].Reason != "attempt 2 of 3" {
+		t.Errorf("attempt reasons %q, %q", events[0].Reason, events[2].Reason)
+	}
+	if !strings.Contains(events[1].Reason, "Connection reset by peer") {
+		t.Errorf("retry reason %q doesn't say what failed", events[1].Reason)
+	}
+}
@@ -0,0 +1,82 @@
+// worker/joblog.go
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+// maxJobLogSize caps the stored logs of a job; older output is dropped first
+const maxJobLogSize = 64 << 10
+
+// jobLog collects the output of every command run for a job, keeping only
+// the last maxJobLogSize bytes
+type jobLog struct {
+	mu        sync.Mutex
+	buf       []byte
+	truncated bool
+}
+
+func (l *jobLog) Write(b []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.buf = append(l.buf, b...)
+	if over := len(l.buf) - maxJobLogSize; over > 0 {
+		l.buf = append(l.buf[:0], l.buf[over:]...)
+		l.truncated = true
+	}
+	return len(b), nil
+}
+
+func (l *jobLog) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.truncated {
+		return "[earlier output truncated]\n" + string(l.buf)
+	}
+	return string(l.buf)
+}
+
+// jobLogWriter returns the log of the running job jobID, or io.Discard if it isn't tracked
+func jobLogWriter(jobID string) io.Writer {
+	runningJobsMu.Lock()
+	defer runningJobsMu.Unlock()
+	if rj, ok := runningJobs[jobID]; ok && rj.log != nil {
+		return rj.log
+	}
+	return io.Discard
+}
+
+// saveJobLogs stores what the commands of this attempt printed after the logs of
+// earlier attempts, with URL query strings (stream tokens) and credentials redacted
+func saveJobLogs(ctx context.Context, msg shared.JobMessage) {
+	runningJobsMu.Lock()
+	rj, ok := runningJobs[msg.JobID]
+	runningJobsMu.Unlock()
+	if !ok || rj.log == nil {
+		return
+	}
+	jl := shared.WithJob(logger, msg.JobID)
+	prev, err := db.GetJobLogs(ctx, msg.JobID)
+	if err != nil {
+		jl.Warn("Failed to read earlier job logs", "error", err)
+	}
+	var b strings.Builder
+	if msg.Attempt > 0 {
+		b.WriteString(prev)
+	}
+	fmt.Fprintf(&b, "=== attempt %d ===\n", msg.Attempt+1)
+	b.WriteString(rj.log.String())
+	logs := shared.RedactURLs(b.String())
+	if len(logs) > maxJobLogSize {
+		logs = "[earlier output truncated]\n" + logs[len(logs)-maxJobLogSize:]
+	}
+	if err := db.SaveJobLogs(ctx, msg.JobID, logs); err != nil {
+		jl.Warn("Failed to store job logs", "error", err)
+	}
+}
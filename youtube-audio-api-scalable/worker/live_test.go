@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+func TestProcessJobRejectsLiveStreamsBeforeFFmpeg(t *testing.T) {
+	tests := []struct {
+		name       string
+		liveStatus string
+		wantErr    string // Empty means the job completes
+	}{
+		{"live", "is_live", "live right now"},
+		{"upcoming", "is_upcoming", "not premiered"},
+		{"past broadcast", "was_live", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := strings.Replace(videoInfoJSON, `"live_status":"not_live"`, `"live_status":"`+tt.liveStatus+`"`, 1)
+			ffmpeg := stubFFmpeg(t, "converted")
+			t.Setenv("YTDLP_PATH", stubYtDlp(t, info))
+			t.Setenv("FFMPEG_PATH", ffmpeg)
+			setupWorker(t)
+
+			processJob(seedJob(t, "job-1", "https://youtu.be/dQw4w9WgXcQ"))
+
+			job, err := db.GetJob(context.Background(), "job-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, statErr := os.Stat(ffmpeg + ".args")
+			ffmpegRan := statErr == nil
+			if tt.wantErr == "" {
+				if job.Status != shared.JobStatusCompleted || !ffmpegRan {
+					t.Errorf("job %s (%s), ffmpeg run %v", job.Status, job.Error, ffmpegRan)
+				}
+				return
+			}
+			if job.Status != shared.JobStatusFailed || !strings.Contains(job.Error, tt.wantErr) {
+				t.Errorf("job %s: %q, want failed with %q", job.Status, job.Error, tt.wantErr)
+			}
+			if ffmpegRan {
+				t.Error("ffmpeg was run for a live stream")
+			}
+		})
+	}
+}
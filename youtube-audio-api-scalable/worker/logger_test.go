@@ -0,0 +1,35 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+func TestProcessJobLogsCarryJobID(t *testing.T) {
+	t.Setenv("YTDLP_PATH", stubYtDlp(t, videoInfoJSON))
+	t.Setenv("FFMPEG_PATH", stubFFmpeg(t, "converted"))
+	setupWorker(t)
+	var buf bytes.Buffer
+	logger = slog.New(slog.NewJSONHandler(&buf, nil))
+
+	processJob(seedJob(t, "job-1", "https://youtu.be/dQw4w9WgXcQ"))
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if len(lines) == 0 || len(lines[0]) == 0 {
+		t.Fatal("processJob logged nothing")
+	}
+	for _, line := range lines {
+		var entry struct {
+			Msg   string `json:"msg"`
+			JobID string `json:"job_id"`
+		}
+		if err := json.Unmarshal(line, &entry); err != nil {
+			t.Fatalf("log line is not JSON: %s", line)
+		}
+		if entry.JobID != "job-1" {
+			t.Errorf("%q has job_id %q, want job-1", entry.Msg, entry.JobID)
+		}
+	}
+}
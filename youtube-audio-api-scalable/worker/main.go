@@ -3,17 +3,29 @@ package main
 
 import (
     "bytes"
+    "context"
     "encoding/json"
+    "errors"
     "fmt"
     "log"
+    "log/slog"
     "net/http"
     "os"
     "os/exec"
     "path/filepath"
+    "sort"
+    "strconv"
     "strings"
+    "sync"
+    "sync/atomic"
     "time"
+    "unicode"
 
     "youtube-audio-api-scalable/shared" // Import shared package
+
+    "github.com/prometheus/client_golang/prometheus/promhttp"
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/trace"
 )
 
 // Global instances for our conceptual database and message queue
@@ -21,63 +33,207 @@ var (
 	cfg           *shared.Config
 	db            shared.DatabaseClient
 	mq            shared.MessageQueueClient
-	workerLimiter chan struct{} // Semaphore to limit concurrent processing tasks
+	workerLimiter *concurrencyLimiter // Limits concurrent processing tasks; resizable via /admin/concurrency
+	ytDlpBreaker  *circuitBreaker     // Holds jobs back while yt-dlp fails for everything
+	consumerPause = newPauseGate()    // Holds the queue consumer while paused via /admin/pause
+	store         shared.Storage
+	locker        shared.Locker       // Shared with other workers when Redis is configured
+	progressFeed  shared.ProgressFeed // Carries ffmpeg status lines to the gateway
+	callbackDLQ   shared.CallbackDLQ  // Callbacks that failed every retry, for admins to redeliver
+	logger        *slog.Logger
 )
 
 func main() {
 	cfg = shared.LoadConfig()
+	logger = shared.NewLogger("worker", cfg.LogLevel)
+	shutdownTracing, err := shared.InitTracing("worker")
+	if err != nil {
+		log.Fatalf("Failed to initialize tracing: %v", err)
+	}
 	if cfg.WorkerPort == "" {
 		cfg.WorkerPort = shared.DefaultWorkerPort
 	}
 	log.Printf("Worker Service starting on port %s with %d max concurrent jobs", cfg.WorkerPort, cfg.MaxWorkers)
 
-    // Initialize DB and Queue (prefer Redis when configured)
+    // Select DB and Queue backends from config (Redis when REDIS_ADDR is set)
+    if db, err = shared.NewDatabaseClient(cfg); err != nil {
+        log.Fatalf("Failed to initialize database: %v", err)
+    }
+    if mq, err = shared.NewMessageQueueClient(cfg); err != nil {
+        log.Fatalf("Failed to initialize message queue: %v", err)
+    }
+    log.Printf("Initialized DB (%T) and Queue (%T) for worker.", db, mq)
     redisClient := shared.NewRedisClient(cfg)
-    if err := shared.PingRedis(redisClient); err == nil && redisClient != nil {
-        db = shared.NewRedisDB(redisClient)
-        mq = shared.NewRedisQueue(redisClient, cfg.QueueName, cfg.QueueMaxLength)
-        log.Println("Initialized Redis-backed DB and Queue for worker.")
-    } else {
-        db = shared.NewInMemoryDB()
-        mq = shared.NewInMemoryQueue(100)
-        log.Println("Initialized in-memory DB and Queue for worker (Redis not configured/reachable).")
+    locker = shared.NewLocker(redisClient)
+    progressFeed = shared.NewProgressFeed(redisClient)
+    callbackDLQ = shared.NewCallbackDLQ(redisClient)
+    if store, err = shared.NewStorage(cfg); err != nil {
+        log.Fatalf("Failed to initialize storage: %v", err)
+    }
+    log.Printf("Using %s storage for converted files.", cfg.StorageBackend)
+    if err := shared.EnsureOutputDir(cfg.OutputDir); err != nil {
+        log.Fatalf("FATAL: Failed to prepare output dir (OUTPUT_DIR): %v", err)
     }
-    defer mq.Close()
 
-	// Create a buffered channel to act as a semaphore for limiting concurrent workers
-	workerLimiter = make(chan struct{}, cfg.MaxWorkers)
+    // Resolve external binaries once so a missing install fails at startup, not per job
+    if cfg.YtDlpPath, err = resolveBinary(cfg.YtDlpPath, "yt-dlp"); err != nil {
+        log.Fatalf("FATAL: yt-dlp not found (set YTDLP_PATH): %v", err)
+    }
+    if cfg.FFmpegPath, err = resolveBinary(cfg.FFmpegPath, "ffmpeg"); err != nil {
+        log.Fatalf("FATAL: ffmpeg not found (set FFMPEG_PATH): %v", err)
+    }
+    log.Printf("INFO: Using yt-dlp at %s and ffmpeg at %s", cfg.YtDlpPath, cfg.FFmpegPath)
+    if cfg.FFmpegNice > 0 {
+        if nicePath, err = resolveBinary("", "nice"); err != nil {
+            cfg.FFmpegNice = 0
+            log.Printf("WARN: nice not found, running ffmpeg at normal priority (FFMPEG_NICE): %v", err)
+        } else {
+            log.Printf("INFO: Running ffmpeg at niceness %d", cfg.FFmpegNice)
+        }
+    }
+    if cfg.FallbackExtractorPath != "" {
+        if cfg.FallbackExtractorPath, err = resolveBinary(cfg.FallbackExtractorPath, ""); err != nil {
+            log.Fatalf("FATAL: Fallback extractor not found (FALLBACK_EXTRACTOR_PATH): %v", err)
+        }
+        log.Printf("INFO: Retrying failed extractions with %s", cfg.FallbackExtractorPath)
+    }
+    if cfg.FFprobePath, err = resolveBinary(cfg.FFprobePath, "ffprobe"); err != nil {
+        cfg.FFprobePath = ""
+        log.Printf("WARN: ffprobe not found (set FFPROBE_PATH), converted files will only be checked for size: %v", err)
+    }
+    if cfg.CookiesFilePath != "" {
+        if _, err := os.Stat(cfg.CookiesFilePath); err != nil {
+            log.Fatalf("FATAL: Cookies file unreadable (YTDLP_COOKIES_FILE): %v", err)
+        }
+        log.Printf("INFO: Passing cookies from %s to yt-dlp", cfg.CookiesFilePath)
+    }
+    for _, p := range cfg.YtDlpProxy {
+        if err := shared.ValidateProxyURL(p); err != nil {
+            log.Fatalf("FATAL: Invalid YTDLP_PROXY entry %s: %v", redactProxy(p), err)
+        }
+    }
+    if len(cfg.YtDlpProxy) > 0 {
+        log.Printf("INFO: Routing yt-dlp through %d proxy(ies)", len(cfg.YtDlpProxy))
+    }
+
+	// Limit concurrent jobs to MaxWorkers; admins can change it at runtime
+	workerLimiter = newConcurrencyLimiter(cfg.MaxWorkers)
+	ytDlpBreaker = newCircuitBreaker(cfg.YtDlpBreakerThreshold, cfg.YtDlpBreakerWindow, cfg.YtDlpBreakerCooldown)
 
 	// Start consuming messages from the queue in a goroutine
 	go startQueueConsumer()
+	go startReaper()
+	go recoverStaleJobs(context.Background(), time.Now())
 
 	// --- Worker Service HTTP Endpoints (e.g., for health checks or admin) ---
 	http.HandleFunc("/health", handleHealth)
-
+	http.Handle("/metrics", promhttp.Handler())
+	http.Handle("/admin/concurrency", adminAuthMiddleware(http.HandlerFunc(handleAdminConcurrency)))
+	http.Handle("/admin/pause", adminAuthMiddleware(http.HandlerFunc(handleAdminPause)))
+	http.Handle("/admin/resume", adminAuthMiddleware(http.HandlerFunc(handleAdminResume)))
+	http.Handle("/admin/drain", adminAuthMiddleware(http.HandlerFunc(handleAdminDrain)))
+	shared.RegisterQueueDepthMetric(mq)
+
+	server := &http.Server{Addr: ":" + cfg.WorkerPort}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("FATAL: Worker HTTP server failed: %v", err)
+		}
+	}()
 	fmt.Printf("⚙️ Worker Service running on http://localhost:%s\n", cfg.WorkerPort)
-	log.Fatal(http.ListenAndServe(":"+cfg.WorkerPort, nil))
+
+	waitForShutdown(server)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := shutdownTracing(ctx); err != nil {
+		log.Printf("WARN: Failed to flush traces: %v", err)
+	}
+	log.Println("INFO: Worker stopped.")
 }
 
-// startQueueConsumer continuously consumes messages from the queue
+// resolveBinary returns the absolute path of the configured binary, or of
+// defaultName looked up on PATH when nothing is configured
+func resolveBinary(configured string, defaultName string) (string, error) {
+	name := strings.TrimSpace(configured)
+	if name == "" {
+		name = defaultName
+	}
+	p, err := exec.LookPath(name)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Abs(p)
+}
+
+// consumerStopped is set when the queue stopped delivering messages while
+// the worker was still running; /health then reports the worker unhealthy
+var consumerStopped atomic.Bool
+
+// startQueueConsumer continuously consumes messages from the queue. Once the
+// queue closes or the worker shuts down, it returns after the jobs it started.
 func startQueueConsumer() {
-	messages, err := mq.Consume()
+	messages, err := mq.Consume(context.Background())
 	if err != nil {
 		log.Fatalf("FATAL: Failed to start consuming from queue: %v", err)
 	}
 	log.Println("INFO: Worker started consuming messages from queue...")
-
-	for msg := range messages {
-		// Acquire a token from the limiter channel. This will block if MaxWorkers are already busy.
-		workerLimiter <- struct{}{}
-		log.Printf("INFO: Worker acquired token for job %s. Current active jobs: %d/%d", msg.JobID, len(workerLimiter), cfg.MaxWorkers)
+	var jobs sync.WaitGroup
+	defer jobs.Wait()
+
+	for {
+		// While paused, leave messages in the queue. A Redis entry already read
+		// ahead waits for the resume, or is reclaimed by other workers once this
+		// one shuts down.
+		if !consumerPause.Wait(shuttingDown) {
+			break
+		}
+		// Likewise while the yt-dlp breaker is open: jobs taken now would
+		// only be handed back
+		if !ytDlpBreaker.Wait(shuttingDown) {
+			break
+		}
+		msg, ok := <-messages
+		if !ok {
+			if !isShuttingDown() {
+				consumerStopped.Store(true)
+				log.Println("ERROR: Queue closed unexpectedly; no more jobs will be consumed.")
+			}
+			break
+		}
+		if paused, _ := consumerPause.State(); paused {
+			// Paused (e.g. drained) while waiting for this message; don't start it
+			requeueJob(context.Background(), msg, "received while the worker was paused")
+			ackMessage(msg)
+			continue
+		}
+		// Acquire a slot from the limiter. This will block if all workers are already busy.
+		if !workerLimiter.Acquire(shuttingDown) {
+			// Received but never started: hand it back for another worker
+			requeueJob(context.Background(), msg, "received while the worker was shutting down")
+			ackMessage(msg)
+			return
+		}
+		if isShuttingDown() {
+			workerLimiter.Release()
+			requeueJob(context.Background(), msg, "received while the worker was shutting down")
+			ackMessage(msg)
+			return
+		}
+		active, limit := workerLimiter.Usage()
+		shared.WithJob(logger, msg.JobID).Info("Worker acquired token", "active_workers", active, "max_workers", limit)
 
 		// Process the job in a new goroutine so the consumer doesn't block
+		jobs.Add(1)
 		go func(jobMessage shared.JobMessage) {
+			defer jobs.Done()
 			defer func() {
-				// Release the token back to the limiter channel when the job is done
-				<-workerLimiter
-				log.Printf("INFO: Worker released token for job %s. Remaining active jobs: %d/%d", jobMessage.JobID, len(workerLimiter), cfg.MaxWorkers)
+				// Release the slot back to the limiter when the job is done
+				workerLimiter.Release()
+				active, limit := workerLimiter.Usage()
+				shared.WithJob(logger, jobMessage.JobID).Info("Worker released token", "active_workers", active, "max_workers", limit)
 			}()
 			processJob(jobMessage)
+			ackMessage(jobMessage)
 		}(msg)
 	}
 	log.Println("INFO: Queue consumer stopped.")
@@ -87,160 +243,670 @@ func startQueueConsumer() {
 func processJob(jobMessage shared.JobMessage) {
 	jobID := jobMessage.JobID
 	originalURL := jobMessage.OriginalURL
-	log.Printf("🛠️ Worker processing job %s for URL: %s", jobID, originalURL)
+	jl := shared.WithJob(logger, jobID)
+	jl.Info("Worker processing job", "url", originalURL)
+
+	// Continue the trace started by the gateway when the job was submitted
+	ctx, span := shared.Tracer().Start(shared.ExtractTraceContext(jobMessage.TraceContext), "process_job",
+		trace.WithAttributes(attribute.String("job.id", jobID), attribute.Int("job.attempt", jobMessage.Attempt)))
+	defer span.End()
 
 	// Retrieve job from DB to get its current state (optional, but good practice)
-	job, err := db.GetJob(jobID)
+	job, err := db.GetJob(ctx, jobID)
 	if err != nil {
-		log.Printf("ERROR: Worker failed to retrieve job %s from DB: %v", jobID, err)
+		jl.Error("Worker failed to retrieve job from DB", "error", err)
 		// Try to log/handle, but can't update status without the job
 		return
 	}
+	if job.Status.IsTerminal() {
+		jl.Info("Job already finished before processing started, skipping", "status", job.Status)
+		return
+	}
+	// While yt-dlp fails for everything (e.g. after a YouTube change), hold
+	// jobs back instead of burning through their attempts. The consumer waits
+	// for the breaker before taking jobs, so this only catches jobs that lost
+	// the race for the probe; hand them straight back rather than sleeping
+	// on a worker slot.
+	if ok, wait := ytDlpBreaker.Allow(); !ok {
+		jl.Warn("yt-dlp circuit breaker is open, re-queueing job", "retry_in", wait.Round(time.Second).String())
+		requeueJob(ctx, jobMessage, "yt-dlp circuit breaker is open")
+		return
+	}
+
+	// Watch for cancellation while this job runs
+	untrack := trackJob(jobMessage)
+	defer untrack()
+	defer saveJobLogs(ctx, jobMessage)
 
 	// Update job status to processing
 	now := time.Now()
 	job.Status = shared.JobStatusProcessing
 	job.StartedAt = &now
-	if err := db.UpdateJob(job); err != nil {
-		log.Printf("ERROR: Worker failed to update job %s status to Processing in DB: %v", jobID, err)
+	if err := db.UpdateJob(ctx, job); err != nil {
+		jl.Error("Worker failed to update job status to processing in DB", "error", err)
 		// Continue processing, but DB might be inconsistent
+	} else {
+		recordJobEvent(ctx, job, fmt.Sprintf("attempt %d of %d", jobMessage.Attempt+1, cfg.MaxJobAttempts))
 	}
 
 	// --- Step 1: Extract direct audio stream URL via yt-dlp ---
-	audioURL, meta, ytDlpErr := getAudioStream(originalURL)
+	cookiesPath, removeCookies, err := cookiesFileFor(jobMessage)
+	if err != nil {
+		handleJobFailure(ctx, job, shared.FailureExtractFailed, err.Error())
+		deadLetterJob(ctx, jobMessage, err.Error())
+		return
+	}
+	defer removeCookies()
+	_, extractSpan := shared.Tracer().Start(ctx, "get_audio_stream")
+	proxy := proxyFor(jobMessage)
+	if proxy != "" {
+		jl.Debug("Using yt-dlp proxy", "proxy", redactProxy(proxy))
+	}
+	ytOpts := ytDlpOptions{
+		CookiesPath: cookiesPath,
+		Proxy:       proxy,
+		FormatID:    jobMessage.FormatID,
+	}
+	audioURL, meta, extractor, ytDlpErr := extractAudioStream(jl, originalURL, jobID, ytOpts)
+	shared.EndSpan(extractSpan, ytDlpErr)
+	if isJobInterrupted(jobID) {
+		return // Re-queued by shutdown
+	}
+	if isJobCancelled(jobID) {
+		handleJobCancelled(ctx, job)
+		return
+	}
+	if isJobOverBudget(jobID) {
+		failOverBudget(ctx, job, jobMessage)
+		return
+	}
+	if errors.Is(ytDlpErr, shared.ErrLiveStream) || errors.Is(ytDlpErr, shared.ErrFormatUnavailable) ||
+		errors.Is(ytDlpErr, errVideoTooLong) {
+		// Fails the same way on every attempt, so skip the retries
+		handleJobFailure(ctx, job, ytDlpFailure(ytDlpErr), ytDlpErr.Error())
+		deadLetterJob(ctx, jobMessage, ytDlpErr.Error())
+		return
+	}
 	if ytDlpErr != nil {
-		handleJobFailure(job, fmt.Sprintf("yt-dlp failed: %v", ytDlpErr))
+		retryOrFail(ctx, job, jobMessage, ytDlpFailure(ytDlpErr), fmt.Sprintf("yt-dlp failed: %v", ytDlpErr))
+		return
+	}
+	jl.Info("Audio stream extracted successfully", "audio_url", audioURL, "extractor", extractor)
+	job.Extractor = extractor
+	if err := shared.IsSafeRemoteURL(audioURL, cfg.StreamHostAllowlist...); err != nil {
+		// Never hand ffmpeg a URL into the internal network; retrying won't change it
+		reason := fmt.Sprintf("unsafe audio stream URL: %v", err)
+		handleJobFailure(ctx, job, shared.FailureExtractFailed, reason)
+		deadLetterJob(ctx, jobMessage, reason)
 		return
 	}
-	log.Printf("INFO: Job %s - Audio stream extracted successfully: %s", jobID, audioURL)
 
 	// --- Step 2: Convert stream to MP3 file using ffmpeg ---
-	filePath, ffmpegErr := convertToMP3(audioURL, jobID) // Pass jobID for consistent naming
+	format, bitrate, fmtErr := shared.ValidateOutputFormat(jobMessage.Format, jobMessage.Bitrate)
+	if fmtErr != nil {
+		// An invalid format never succeeds, so skip the retries
+		handleJobFailure(ctx, job, shared.FailureConvertFailed, fmtErr.Error())
+		deadLetterJob(ctx, jobMessage, fmtErr.Error())
+		return
+	}
+	sampleRate, channels, layoutErr := shared.ValidateAudioLayout(format, jobMessage.SampleRate, jobMessage.Channels)
+	if layoutErr != nil {
+		handleJobFailure(ctx, job, shared.FailureConvertFailed, layoutErr.Error())
+		deadLetterJob(ctx, jobMessage, layoutErr.Error())
+		return
+	}
+	if err := shared.CheckClipWithinDuration(jobMessage.ClipStart, jobMessage.ClipEnd, meta.Duration); err != nil {
+		handleJobFailure(ctx, job, shared.FailureConvertFailed, err.Error())
+		deadLetterJob(ctx, jobMessage, err.Error())
+		return
+	}
+	conv := conversion{
+		AudioURL:   audioURL,
+		Format:     format,
+		Bitrate:    bitrate,
+		ClipStart:  jobMessage.ClipStart,
+		ClipEnd:    jobMessage.ClipEnd,
+		Normalize:  jobMessage.Normalize,
+		SampleRate: sampleRate,
+		Channels:   channels,
+	}
+	if jobMessage.EmbedTags {
+		conv.Tags = map[string]string{
+			"title":   meta.Title,
+			"artist":  meta.Uploader,
+			"comment": originalURL,
+		}
+		if cfg.EmbedCoverArt && format == "mp3" && meta.Thumbnail != "" {
+			if err := shared.IsSafeRemoteURL(meta.Thumbnail, cfg.StreamHostAllowlist...); err == nil {
+				conv.CoverURL = meta.Thumbnail
+			} else {
+				jl.Warn("Skipping cover art", "thumbnail", meta.Thumbnail, "error", err)
+			}
+		}
+	}
+	_, convertSpan := shared.Tracer().Start(ctx, "convert_audio",
+		trace.WithAttributes(attribute.String("audio.format", format), attribute.String("audio.bitrate", bitrate)))
+	filePath, output, ffmpegErr := convertAudio(jobID, conv, meta.Duration) // Pass jobID for consistent naming
+	shared.EndSpan(convertSpan, ffmpegErr)
+	if isJobInterrupted(jobID) {
+		os.Remove(outputPathFor(jobID, conv)) // Drop any partial output; the job is re-queued
+		return
+	}
+	if isJobCancelled(jobID) {
+		os.Remove(outputPathFor(jobID, conv)) // Drop any partial output
+		handleJobCancelled(ctx, job)
+		return
+	}
+	if isJobOverBudget(jobID) {
+		failOverBudget(ctx, job, jobMessage)
+		return
+	}
+	if errors.Is(ffmpegErr, errOutputTooLarge) {
+		// The same video and settings give the same size, so skip the retries
+		handleJobFailure(ctx, job, shared.FailureTooLong, ffmpegErr.Error())
+		deadLetterJob(ctx, jobMessage, ffmpegErr.Error())
+		return
+	}
 	if ffmpegErr != nil {
-		handleJobFailure(job, fmt.Sprintf("ffmpeg failed: %v", ffmpegErr))
+		reason := shared.FailureConvertFailed
+		if errors.Is(ffmpegErr, errCommandTimedOut) {
+			reason = shared.FailureTimeout
+		}
+		retryOrFail(ctx, job, jobMessage, reason, fmt.Sprintf("ffmpeg failed: %v", ffmpegErr))
 		return
 	}
-	log.Printf("INFO: Job %s - Conversion completed successfully: %s", jobID, filePath)
+	jl.Info("Conversion completed successfully", "file", filePath)
 
-    // --- Step 3: Job completed successfully - Update DB ---
+	// --- Step 3: Store the converted file ---
+	storageKey := filepath.Base(filePath)
+	if err := storeOutput(jl, filePath, storageKey); err != nil {
+		retryOrFail(ctx, job, jobMessage, shared.FailureConvertFailed, fmt.Sprintf("storage upload failed: %v", err))
+		return
+	}
+	downloadEndpoint, err := store.SignedURL(storageKey, cfg.SignedURLTTL)
+	if err != nil {
+		retryOrFail(ctx, job, jobMessage, shared.FailureConvertFailed, fmt.Sprintf("failed to sign download URL: %v", err))
+		return
+	}
+	if cfg.StorageBackend == shared.StorageBackendS3 {
+		os.Remove(filePath) // The object store now holds the only copy
+		filePath = ""
+	}
+	artifacts := []shared.Artifact{{
+		Type:        shared.ArtifactAudio,
+		Key:         storageKey,
+		Size:        output.Size,
+		ContentType: shared.AudioFormats[format].ContentType,
+	}}
+	// Album art for frontends; a missing thumbnail never fails the job
+	thumbFile := ""
+	if meta.Thumbnail != "" {
+		if thumb, err := saveThumbnail(ctx, jl, jobID, meta.Thumbnail); err != nil {
+			jl.Warn("Failed to save thumbnail", "thumbnail", meta.Thumbnail, "error", err)
+		} else {
+			thumbFile = thumb.Key
+			artifacts = append(artifacts, thumb)
+		}
+	}
+	// Likewise captions; many videos have none
+	if jobMessage.WithSubtitles {
+		if subs, ok, err := saveSubtitles(jl, jobID, originalURL, ytOpts); err != nil {
+			jl.Warn("Failed to save subtitles", "error", err)
+		} else if !ok {
+			jl.Info("Video has no subtitles")
+		} else {
+			artifacts = append(artifacts, subs)
+		}
+	}
+
+    // --- Step 4: Job completed successfully - Update DB ---
     completedNow := time.Now()
     job.Status = shared.JobStatusCompleted
     job.Metadata = meta
     job.FilePath = filePath
-    // Construct public download endpoint using configured base URL if available
-    base := cfg.PublicAPIBaseURL
-    if strings.TrimSpace(base) == "" {
-        base = fmt.Sprintf("http://localhost:%s", cfg.APIGatewayPort)
+    job.Progress = 100
+    job.Format = format
+    job.Bitrate = bitrate
+    job.OutputExt = shared.AudioFormats[format].Ext
+    job.FileSize = output.Size
+    job.OutputDuration = output.Duration
+    job.StorageKey = storageKey
+    job.DownloadEndpoint = downloadEndpoint
+    job.ThumbnailFile = thumbFile
+    if thumbFile != "" {
+        job.ThumbnailEndpoint = cfg.PublicURL(shared.ThumbnailPath(cfg.DownloadSecret, jobID, cfg.SignedURLTTL))
     }
-    job.DownloadEndpoint = fmt.Sprintf("%s/download/%s", strings.TrimRight(base, "/"), jobID)
+    job.Artifacts = artifacts
     job.CompletedAt = &completedNow
+    job.ExpiresAt = shared.ExpiryAfter(completedNow, cfg.JobTTL)
 
-	if err := db.UpdateJob(job); err != nil {
-		log.Printf("ERROR: Worker failed to update job %s status to Completed in DB: %v", jobID, err)
+	if err := db.UpdateJob(ctx, job); err != nil {
+		jl.Error("Worker failed to update job status to completed in DB", "error", err)
 		// If DB update fails, the job might remain "processing" or get stuck. Requires monitoring.
 	} else {
-		log.Printf("✅ Job %s completed. Download endpoint: %s", jobID, job.DownloadEndpoint)
+		shared.JobsCompletedTotal.Inc()
+		observeJobTimings(job)
+		recordJobEvent(ctx, job, "")
+		jl.Info("Job completed", "download_endpoint", job.DownloadEndpoint)
+		// Feed the wait-time estimate shown to clients submitting new jobs
+		if job.StartedAt != nil {
+			if err := db.RecordProcessingTime(ctx, completedNow.Sub(*job.StartedAt)); err != nil {
+				jl.Warn("Failed to record processing time", "error", err)
+			}
+		}
+	}
+	notifyWebhook(job)
+}
+
+// storeOutput uploads the converted file at filePath to storage under key
+func storeOutput(jl *slog.Logger, filePath string, key string) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	location, err := store.Put(ctx, key, f)
+	if err != nil {
+		return err
 	}
+	jl.Info("Stored converted file", "key", key, "location", location)
+	return nil
+}
+
+// recordJobEvent adds the job's new status to its history
+func recordJobEvent(ctx context.Context, job *shared.Job, reason string) {
+	shared.RecordJobEvent(ctx, db, logger, "worker", job, reason)
+}
+
+// observeJobTimings records how long a finished job waited in the queue and
+// then ran. failure_reason is "none" for completed jobs.
+func observeJobTimings(job *shared.Job) {
+	if job.StartedAt == nil || job.CompletedAt == nil {
+		return // Never started, so there is nothing to split
+	}
+	reason := string(job.FailureReason)
+	if reason == "" {
+		reason = "none"
+	}
+	shared.JobQueueWaitDuration.WithLabelValues(job.Format, reason).Observe(job.StartedAt.Sub(job.CreatedAt).Seconds())
+	shared.JobRunDuration.WithLabelValues(job.Format, reason).Observe(job.CompletedAt.Sub(*job.StartedAt).Seconds())
 }
 
 // handleJobFailure updates a job's status to failed in the database
-func handleJobFailure(job *shared.Job, errMsg string) {
+func handleJobFailure(ctx context.Context, job *shared.Job, reason shared.FailureReason, errMsg string) {
 	failedNow := time.Now()
 	job.Status = shared.JobStatusFailed
 	job.Error = errMsg
+	job.FailureReason = reason
 	job.CompletedAt = &failedNow // Mark completion time even for failures
-	if err := db.UpdateJob(job); err != nil {
-		log.Printf("ERROR: Worker failed to update job %s status to Failed in DB: %v", job.ID, err)
+	jl := shared.WithJob(logger, job.ID)
+	if err := db.UpdateJob(ctx, job); err != nil {
+		jl.Error("Worker failed to update job status to failed in DB", "error", err)
+	} else {
+		recordJobEvent(ctx, job, errMsg)
 	}
-	log.Printf("❌ Job %s failed: %s", job.ID, errMsg)
+	shared.JobsFailedTotal.Inc()
+	observeJobTimings(job)
+	jl.Warn("Job failed", "failure_reason", reason, "error", errMsg)
+	notifyWebhook(job)
 }
 
-// getAudioStream: Retrieves audio stream URL and metadata using yt-dlp
-func getAudioStream(videoURL string) (string, *shared.Metadata, error) {
-    yt := cfg.YtDlpPath
-    if strings.TrimSpace(yt) == "" {
-        if p, err := exec.LookPath("yt-dlp"); err == nil {
-            yt = p
-        } else {
-            yt = "./yt-dlp"
-        }
-    }
+// failOverBudget fails a job stopped for running longer than
+// cfg.JobTotalTimeout; another attempt would take as long, so it isn't retried
+func failOverBudget(ctx context.Context, job *shared.Job, msg shared.JobMessage) {
+	reason := fmt.Sprintf("%v of %s", errJobOverBudget, cfg.JobTotalTimeout)
+	handleJobFailure(ctx, job, shared.FailureTimeout, reason)
+	deadLetterJob(ctx, msg, reason)
+}
+
+// retryOrFail re-queues a job after a failed attempt, or fails it and moves it
+// to the dead-letter queue once it has been tried cfg.MaxJobAttempts times
+func retryOrFail(ctx context.Context, job *shared.Job, msg shared.JobMessage, reason shared.FailureReason, errMsg string) {
+	jl := shared.WithJob(logger, job.ID)
+	job.Attempts = msg.Attempt + 1
+	if job.Attempts < cfg.MaxJobAttempts && !isShuttingDown() {
+		retry := msg
+		retry.Attempt = job.Attempts
+		job.Status = shared.JobStatusPending
+		job.StartedAt = nil
+		job.Progress = 0
+		if err := db.UpdateJob(ctx, job); err != nil {
+			jl.Error("Failed to reset job to pending for retry", "error", err)
+		} else if err := mq.Publish(ctx, retry); err != nil {
+			jl.Error("Failed to re-publish job for retry", "error", err)
+		} else {
+			recordJobEvent(ctx, job, "retrying after: "+errMsg)
+			jl.Warn("Job attempt failed, retrying", "error", errMsg, "attempt", job.Attempts, "max_attempts", cfg.MaxJobAttempts)
+			return
+		}
+	}
+	handleJobFailure(ctx, job, reason, errMsg)
+	deadLetterJob(ctx, msg, errMsg)
+}
+
+// deadLetterJob parks a permanently failed job in the dead-letter queue
+func deadLetterJob(ctx context.Context, msg shared.JobMessage, reason string) {
+	jl := shared.WithJob(logger, msg.JobID)
+	// Dead letters are kept indefinitely and listed by the admin API, so the
+	// request's session cookies stay out; a rerun has to send them again
+	msg.Cookies = ""
+	if err := mq.DeadLetter(ctx, msg, reason); err != nil {
+		jl.Error("Failed to dead-letter job", "error", err)
+		return
+	}
+	jl.Info("Job moved to dead-letter queue")
+}
+
+// notifyWebhook delivers the job to its callback URL, if any, without blocking
+// the caller. The outcome is recorded on the job; a callback that still fails
+// after every retry is parked in the callback dead-letter queue.
+func notifyWebhook(job *shared.Job) {
+	if job.CallbackURL == "" {
+		return
+	}
+	jl := shared.WithJob(logger, job.ID).With("callback_url", job.CallbackURL)
+	body, err := json.Marshal(job)
+	if err != nil {
+		jl.Error("Failed to encode webhook payload", "error", err)
+		return
+	}
+	jobID, callbackURL := job.ID, job.CallbackURL
+	go func() {
+		result, err := shared.DeliverWebhook(cfg, callbackURL, body, cfg.WebhookMaxRetries)
+		ctx := context.Background()
+		recordCallbackResult(ctx, jobID, result, err)
+		if err == nil {
+			jl.Info("Webhook delivered")
+			return
+		}
+		jl.Warn("Webhook delivery failed", "error", err, "attempts", result.Attempts)
+		cb := shared.UndeliveredCallback{
+			JobID:       jobID,
+			CallbackURL: callbackURL,
+			Payload:     body,
+			LastStatus:  result.LastStatus,
+			Error:       err.Error(),
+			Attempts:    result.Attempts,
+			FailedAt:    time.Now(),
+		}
+		if err := callbackDLQ.Add(ctx, cb); err != nil {
+			jl.Error("Failed to dead-letter undelivered callback", "error", err)
+		}
+	}()
+}
+
+// recordCallbackResult stores how delivering jobID's callback went on the job
+func recordCallbackResult(ctx context.Context, jobID string, result shared.WebhookResult, deliveryErr error) {
+	job, err := db.GetJob(ctx, jobID)
+	if err != nil {
+		return // Deleted meanwhile
+	}
+	job.CallbackStatus = result.LastStatus
+	job.CallbackError = ""
+	if deliveryErr != nil {
+		job.CallbackError = deliveryErr.Error()
+	}
+	if err := db.UpdateJob(ctx, job); err != nil {
+		shared.WithJob(logger, jobID).Warn("Failed to record callback result", "error", err)
+	}
+}
+
+// ytDlpOptions are per-job additions to the yt-dlp command line
+type ytDlpOptions struct {
+	CookiesPath string // --cookies, when set
+	Proxy       string // --proxy, when set
+	FormatID    string // Stream to convert instead of bestaudio, when set
+}
+
+// errVideoTooLong is returned by getAudioStream for videos over cfg.MaxVideoDurationSeconds
+var errVideoTooLong = errors.New("video duration exceeds limit")
+
+// ytDlpFailure classifies an error from getAudioStream
+func ytDlpFailure(err error) shared.FailureReason {
+	if errors.Is(err, errVideoTooLong) {
+		return shared.FailureTooLong
+	}
+	return shared.ClassifyYtDlpError(err)
+}
+
+// getAudioStream: Retrieves audio stream URL and metadata using yt-dlp, or
+// the compatible extractor at yt (resolved to an absolute path at startup)
+func getAudioStream(yt string, videoURL string, jobID string, opts ytDlpOptions) (string, *shared.Metadata, error) {
     // Respect max duration if configured
     // We use --max-filesize as proxy is not suitable; yt-dlp supports --max-duration only via filters; here we parse metadata instead
-    cmd := exec.Command(yt, "-f", "bestaudio", "--dump-single-json", "--no-warnings", "--", videoURL)
+    args := []string{"-f", "bestaudio", "--dump-single-json", "--no-warnings"}
+    if opts.CookiesPath != "" {
+        args = append(args, "--cookies", opts.CookiesPath)
+    }
+    if opts.Proxy != "" {
+        args = append(args, "--proxy", opts.Proxy)
+    }
+    args = append(args, "--", videoURL)
 	var out bytes.Buffer
-	cmd.Stdout = &out
-	cmd.Stderr = &out
-
-	if err := cmd.Run(); err != nil {
+	if err := runCommand(jobID, cfg.YtDlpTimeout, &out, yt, args...); err != nil {
+		if !isJobStop(err) {
+			ytDlpBreaker.Failure()
+		}
 		return "", nil, fmt.Errorf("yt-dlp failed: %v\nOutput: %s", err, out.String())
 	}
 
-	// Temporary struct to unmarshal yt-dlp's output
-	var data struct {
-		Title    string  `json:"title"`
-		Uploader string  `json:"uploader"`
-		Duration float64 `json:"duration"`
-		URL      string  `json:"url"` // This is the direct audio stream URL
-		Ext      string  `json:"ext"`
-		Abr      int     `json:"abr"`
-	}
-
-	if err := json.Unmarshal(out.Bytes(), &data); err != nil {
+	meta, err := shared.ParseVideoInfo(out.Bytes())
+	if err != nil {
+		ytDlpBreaker.Failure()
 		return "", nil, fmt.Errorf("JSON parse error: %v\nOutput: %s", err, out.String())
 	}
-
-    // Assign to our Metadata struct
-	meta := &shared.Metadata{
-		Title:    data.Title,
-		Uploader: data.Uploader,
-		Duration: data.Duration,
-		AudioURL: data.URL, // Assign the direct stream URL here
-		Ext:      data.Ext,
-		Abr:      data.Abr,
+	ytDlpBreaker.Success()
+	// A live stream has no end for ffmpeg to reach
+	if err := shared.CheckNotLive(meta); err != nil {
+		return "", nil, err
+	}
+	// The dump lists every format, so a requested one needs no second yt-dlp run
+	if opts.FormatID != "" {
+		if err := shared.SelectFormat(meta, out.Bytes(), opts.FormatID); err != nil {
+			return "", nil, err
+		}
 	}
 
     // Enforce maximum duration
-    if cfg.MaxVideoDurationSeconds > 0 && int(data.Duration) > cfg.MaxVideoDurationSeconds {
-        return "", nil, fmt.Errorf("video duration exceeds limit: %ds > %ds", int(data.Duration), cfg.MaxVideoDurationSeconds)
+    if cfg.MaxVideoDurationSeconds > 0 && int(meta.Duration) > cfg.MaxVideoDurationSeconds {
+        return "", nil, fmt.Errorf("%w: %ds > %ds", errVideoTooLong, int(meta.Duration), cfg.MaxVideoDurationSeconds)
     }
 
-	return data.URL, meta, nil
+	return meta.AudioURL, meta, nil
+}
+
+// tempOutputSuffix marks a conversion still in progress; see convertAudio
+const tempOutputSuffix = ".tmp"
+
+// outputPathFor returns where the converted file for jobID is written
+func outputPathFor(jobID string, c conversion) string {
+	name := shared.OutputFileName(jobID, shared.AudioFormats[c.Format].Ext, c.ClipStart, c.ClipEnd)
+	return filepath.Join(cfg.OutputDir, name)
+}
+
+// conversion describes one ffmpeg run
+type conversion struct {
+	AudioURL string
+	Format   string
+	Bitrate  string
+	Tags     map[string]string // Written with -metadata; empty values are skipped
+	CoverURL string            // Image attached as cover art (MP3 only)
+	// Clip range in seconds; ClipEnd 0 means the end of the input
+	ClipStart float64
+	ClipEnd   float64
+	Normalize bool // Apply loudnorm towards cfg.LoudnessTarget
+	// SampleRate 0 and empty Channels keep the format's defaults
+	SampleRate int
+	Channels   string
 }
 
-// convertToMP3: Converts audio stream URL to MP3 file, uses jobID for naming
-func convertToMP3(audioURL string, jobID string) (string, error) {
-	outputDir := shared.OutputDir
-	outputPath := filepath.Join(outputDir, jobID+".mp3")
+// maxTagLength caps the length of a single metadata tag value
+const maxTagLength = 256
+
+// sanitizeTag strips control characters (newlines, NULs) from a tag value and caps its length
+func sanitizeTag(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, s)
+	s = strings.TrimSpace(s)
+	if r := []rune(s); len(r) > maxTagLength {
+		s = string(r[:maxTagLength])
+	}
+	return s
+}
+
+// ffmpegArgs builds the ffmpeg argument list for c writing to outputPath.
+// Each tag is passed as its own key=value argument, never through a shell.
+func ffmpegArgs(c conversion, outputPath string) []string {
+	af := shared.AudioFormats[c.Format]
+	args := []string{"-y"}
+	// As input options, -ss seeks before decoding and -to stops reading at the absolute position
+	if c.ClipStart > 0 {
+		args = append(args, "-ss", strconv.FormatFloat(c.ClipStart, 'f', -1, 64))
+	}
+	if c.ClipEnd > 0 {
+		args = append(args, "-to", strconv.FormatFloat(c.ClipEnd, 'f', -1, 64))
+	}
+	args = append(args, "-i", c.AudioURL)
+	if c.CoverURL != "" {
+		args = append(args, "-i", c.CoverURL, "-map", "0:a:0", "-map", "1:v:0",
+			"-c:v", "mjpeg", "-disposition:v", "attached_pic", "-metadata:s:v", "title=Album cover")
+	} else {
+		args = append(args, "-vn")
+	}
+	if c.Normalize {
+		// Single-pass loudnorm: the filter measures as it goes and adjusts
+		// dynamically, so it is less exact than a two-pass run (measure, then
+		// apply linear gain) but needs only one read of the stream. It applies
+		// after the input seek, so clips are normalized on their own.
+		args = append(args, "-af", loudnormFilter(cfg.LoudnessTarget))
+	}
+	args = append(args, "-c:a", af.Codec)
+	if !af.Lossless && c.Bitrate != "" {
+		args = append(args, "-b:a", c.Bitrate)
+	}
+	keys := make([]string, 0, len(c.Tags))
+	for k := range c.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if v := sanitizeTag(c.Tags[k]); v != "" {
+			args = append(args, "-metadata", k+"="+v)
+		}
+	}
+	if af.Muxer == "mp3" && len(keys) > 0 {
+		args = append(args, "-id3v2_version", "3") // ID3v2.3 is what most players read
+	}
+	sampleRate := af.SampleRate
+	if c.SampleRate != 0 {
+		sampleRate = strconv.Itoa(c.SampleRate)
+	}
+	args = append(args, "-ar", sampleRate)
+	if ac, ok := shared.ChannelLayouts[c.Channels]; ok {
+		args = append(args, "-ac", ac)
+	}
+	if cfg.MaxOutputBytes > 0 {
+		args = append(args, "-fs", strconv.FormatInt(cfg.MaxOutputBytes, 10))
+	}
+	if cfg.FFmpegThreads > 0 {
+		args = append(args, "-threads", strconv.Itoa(cfg.FFmpegThreads))
+	}
+	return append(args, "-f", af.Muxer, outputPath)
+}
+
+// loudnormFilter returns the loudnorm filter for an integrated loudness target in LUFS
+func loudnormFilter(target float64) string {
+	return fmt.Sprintf("loudnorm=I=%s:TP=-1.5:LRA=11", strconv.FormatFloat(target, 'f', -1, 64))
+}
+
+// convertAudio: Converts audio stream URL to the requested format, uses jobID for naming
+// Progress is parsed from ffmpeg's output against duration and stored on the job.
+func convertAudio(jobID string, c conversion, duration float64) (string, outputInfo, error) {
+	outputDir := cfg.OutputDir
+	outputPath := outputPathFor(jobID, c)
+	// Progress is measured against the length of the output, not the whole video
+	if c.ClipEnd > 0 {
+		duration = c.ClipEnd - c.ClipStart
+	} else if c.ClipStart > 0 && duration > c.ClipStart {
+		duration -= c.ClipStart
+	}
 
 	// Ensure output directory exists (created by API Gateway already, but good for resilience)
 	if err := os.MkdirAll(outputDir, os.ModePerm); err != nil {
-		return "", fmt.Errorf("failed to create output directory: %w", err)
+		return "", outputInfo{}, fmt.Errorf("failed to create output directory: %w", err)
 	}
 
-	start := time.Now()
+	// ffmpeg reads remote inputs through the relay, never straight from the network
+	relay, err := startStreamRelay()
+	if err != nil {
+		return "", outputInfo{}, fmt.Errorf("failed to start stream relay: %w", err)
+	}
+	defer relay.Close()
+	c.AudioURL = relay.Add(c.AudioURL)
+	if c.CoverURL != "" {
+		c.CoverURL = relay.Add(c.CoverURL)
+	}
 
-    ff := cfg.FFmpegPath
-    if strings.TrimSpace(ff) == "" {
-        if p, err := exec.LookPath("ffmpeg"); err == nil {
-            ff = p
-        } else {
-            ff = "./ffmpeg"
-        }
-    }
-    cmd := exec.Command(ff, "-y", "-i", audioURL, "-vn", "-ab", "192k", "-ar", "44100", "-f", "mp3", outputPath)
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	cmd.Stderr = &out
+	start := time.Now()
 
-	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("ffmpeg error: %v\nOutput: %s", err, out.String())
+	// ffmpeg writes next to the final path, which only appears once the file
+	// is complete and verified, so a crash never leaves a partial download
+	tmpPath := outputPath + tempOutputSuffix
+	defer os.Remove(tmpPath) // No-op after the rename
+
+    ff := cfg.FFmpegPath // Resolved to an absolute path at startup
+	out := newProgressWriter(duration, jobProgressReporter(jobID))
+	out.onLine = jobProgressPublisher(jobID)
+	name, args := withNice(ff, ffmpegArgs(c, tmpPath))
+	err = runCommand(jobID, cfg.FFmpegTimeout, out, name, args...)
+	if err != nil && c.CoverURL != "" && !isJobStop(err) && !errors.Is(err, errCommandTimedOut) {
+		// A broken thumbnail shouldn't fail the job; convert again without it
+		shared.WithJob(logger, jobID).Warn("Conversion with cover art failed, retrying without it", "error", err)
+		c.CoverURL = ""
+		out = newProgressWriter(duration, jobProgressReporter(jobID))
+		out.onLine = jobProgressPublisher(jobID)
+		name, args = withNice(ff, ffmpegArgs(c, tmpPath))
+		err = runCommand(jobID, cfg.FFmpegTimeout, out, name, args...)
+	}
+	if err != nil {
+		return "", outputInfo{}, fmt.Errorf("ffmpeg error: %w\nOutput: %s", err, out.String())
+	}
+	// ffmpeg can exit cleanly after writing a truncated file, e.g. when the stream drops
+	info, err := verifyOutput(jobID, tmpPath, duration)
+	if err != nil {
+		return "", outputInfo{}, err
+	}
+	if err := os.Rename(tmpPath, outputPath); err != nil {
+		return "", outputInfo{}, fmt.Errorf("failed to move output into place: %w", err)
 	}
 
 	elapsed := time.Since(start)
-	log.Printf("⏱️ Conversion time for job %s: %.2fs", jobID, elapsed.Seconds())
+	shared.JobProcessingDuration.Observe(elapsed.Seconds())
+	shared.WithJob(logger, jobID).Info("Conversion finished", "duration_seconds", elapsed.Seconds(),
+		"size_bytes", info.Size, "output_duration_seconds", info.Duration)
+
+	return outputPath, info, nil
+}
 
-	return outputPath, nil
+// adminAuthMiddleware checks the admin bearer token, as on the API Gateway
+func adminAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.TrimSpace(cfg.AdminToken) == "" {
+			shared.WriteError(w, http.StatusServiceUnavailable, shared.ErrCodeUnavailable, "Admin token not configured")
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer "+cfg.AdminToken {
+			shared.WriteError(w, http.StatusUnauthorized, shared.ErrCodeUnauthorized, "Unauthorized")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
 }
 
 // handleHealth: Basic health check for the Worker Service
@@ -256,18 +922,60 @@ func handleHealth(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// In a real system, you'd check DB/MQ connections and if workers are actively processing
+	// Check the DB, the queue, that the external binaries are still executable
+	// and that there is room for their output
+	disk, diskErr := checkDiskSpace()
+	checks, healthy := shared.RunHealthChecks(r.Context(), map[string]func(context.Context) error{
+		"database": db.Ping,
+		"queue":    mq.Ping,
+		"yt-dlp":   func(context.Context) error { _, err := exec.LookPath(cfg.YtDlpPath); return err },
+		"ffmpeg":   func(context.Context) error { _, err := exec.LookPath(cfg.FFmpegPath); return err },
+		"disk":     func(context.Context) error { return diskErr },
+		"consumer": func(context.Context) error {
+			if consumerStopped.Load() {
+				return errors.New("queue consumer loop has stopped")
+			}
+			return nil
+		},
+	})
 	status := "ok"
 	message := "Worker Service is healthy and consuming from queue."
-	if len(workerLimiter) == cfg.MaxWorkers {
+	active, limit := workerLimiter.Usage()
+	paused, pausedSince := consumerPause.State()
+	if paused {
+		message = "Worker Service is healthy but paused; no new jobs are taken from the queue."
+	} else if active >= limit {
 		message = "Worker Service is healthy but all workers are currently busy."
 	}
-	// (Optional: Check if the message queue connection is active)
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
+	if !healthy {
+		status = "unhealthy"
+		message = "Worker Service has failing dependencies."
+		w.WriteHeader(http.StatusServiceUnavailable)
+	} else if drained.Load() {
+		// Not ready: the worker was drained and is about to be stopped
+		status = "drained"
+		message = "Worker Service is drained and takes no new jobs."
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	resp := map[string]any{
 		"status":         status,
 		"message":        message,
-		"active_workers": fmt.Sprintf("%d/%d", len(workerLimiter), cfg.MaxWorkers),
-	})
+		"active_workers": fmt.Sprintf("%d/%d", active, limit),
+		"concurrency": map[string]int{
+			"current": active,
+			"target":  limit,
+		},
+		"checks":         checks,
+		"ytdlp_breaker":  ytDlpBreaker.Status(),
+		"paused":         paused,
+	}
+	if paused {
+		resp["paused_since"] = pausedSince
+	}
+	if disk != nil {
+		resp["disk"] = disk
+	}
+	json.NewEncoder(w).Encode(resp)
 }
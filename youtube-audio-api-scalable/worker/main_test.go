@@ -0,0 +1,484 @@
+// worker/main_test.go
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	redis "github.com/redis/go-redis/v9"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+// setupWorker points the worker's globals at in-memory backends and a temp
+// output directory, as main does with REDIS_ADDR unset
+func setupWorker(t *testing.T) *shared.InMemoryDB {
+	t.Helper()
+	t.Setenv("REDIS_ADDR", "")
+	t.Setenv("OUTPUT_DIR", t.TempDir())
+	cfg = shared.LoadConfig()
+	logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	memDB := shared.NewInMemoryDB()
+	db = memDB
+	queue := shared.NewInMemoryQueue(64)
+	t.Cleanup(queue.Close)
+	mq = queue
+	var err error
+	if store, err = shared.NewStorage(cfg); err != nil {
+		t.Fatalf("NewStorage: %v", err)
+	}
+	locker = shared.NewLocker(nil)
+	progressFeed = shared.NewProgressFeed(nil)
+	callbackDLQ = shared.NewCallbackDLQ(nil)
+	workerLimiter = newConcurrencyLimiter(cfg.MaxWorkers)
+	ytDlpBreaker = newCircuitBreaker(cfg.YtDlpBreakerThreshold, cfg.YtDlpBreakerWindow, cfg.YtDlpBreakerCooldown)
+	consumerPause = newPauseGate()
+	shuttingDown = make(chan struct{})
+	drained.Store(false)
+	consumerStopped.Store(false)
+	nicePath = ""
+	return memDB
+}
+
+// writeStub creates an executable shell script named name running script
+func writeStub(t *testing.T, name, script string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// videoInfoJSON is what the yt-dlp stubs print: a 60 second public video
+const videoInfoJSON = `{"title":"Test Song","uploader":"Test Artist","duration":60,` +
+	`"url":"https://93.184.216.34/audio.webm","ext":"webm","abr":160,"live_status":"not_live"}`
+
+// stubYtDlp creates a yt-dlp that prints output and saves its arguments, one
+// per line, next to itself in <path>.args
+func stubYtDlp(t *testing.T, output string) string {
+	t.Helper()
+	return writeStub(t, "yt-dlp", `printf '%s\n' "$@" > "$0.args"
+cat <<'JSON'
+`+output+`
+JSON`)
+}
+
+// stubFFmpeg creates an ffmpeg that saves its arguments in <path>.args and
+// writes content to the output file, its last argument
+func stubFFmpeg(t *testing.T, content string) string {
+	t.Helper()
+	return writeStub(t, "ffmpeg", `printf '%s\n' "$@" > "$0.args"
+for out; do :; done
+printf '%s' '`+content+`' > "$out"`)
+}
+
+// stubArgs returns the arguments the stub at path was last run with
+func stubArgs(t *testing.T, path string) []string {
+	t.Helper()
+	b, err := os.ReadFile(path + ".args")
+	if err != nil {
+		t.Fatalf("%s was not run: %v", filepath.Base(path), err)
+	}
+	return strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+}
+
+// argValue returns the argument following flag in args, if flag is present
+func argValue(args []string, flag string) (string, bool) {
+	i := slices.Index(args, flag)
+	if i < 0 || i+1 >= len(args) {
+		return "", false
+	}
+	return args[i+1], true
+}
+
+func TestFFmpegArgsPerFormat(t *testing.T) {
+	setupWorker(t)
+	for name, af := range shared.AudioFormats {
+		args := ffmpegArgs(conversion{AudioURL: "https://stream.example/a", Format: name, Bitrate: "128k"}, "/out/file")
+		if codec, _ := argValue(args, "-c:a"); codec != af.Codec {
+			t.Errorf("%s: -c:a %q, want %q", name, codec, af.Codec)
+		}
+		if muxer, _ := argValue(args, "-f"); muxer != af.Muxer {
+			t.Errorf("%s: -f %q, want %q", name, muxer, af.Muxer)
+		}
+		if rate, _ := argValue(args, "-ar"); rate != af.SampleRate {
+			t.Errorf("%s: -ar %q, want %q", name, rate, af.SampleRate)
+		}
+		bitrate, ok := argValue(args, "-b:a")
+		if af.Lossless && ok {
+			t.Errorf("%s: lossless format got -b:a %s", name, bitrate)
+		}
+		if !af.Lossless && bitrate != "128k" {
+			t.Errorf("%s: -b:a %q, want 128k", name, bitrate)
+		}
+		if args[len(args)-1] != "/out/file" {
+			t.Errorf("%s: output path is not last: %v", name, args)
+		}
+	}
+}
+
+func TestConfiguredBinariesAreRun(t *testing.T) {
+	ytDlp := stubYtDlp(t, videoInfoJSON)
+	ffmpeg := stubFFmpeg(t, "converted")
+	t.Setenv("YTDLP_PATH", ytDlp)
+	t.Setenv("FFMPEG_PATH", ffmpeg)
+	setupWorker(t)
+
+	resolved, err := resolveBinary(cfg.YtDlpPath, "yt-dlp")
+	if err != nil || resolved != ytDlp {
+		t.Fatalf("resolveBinary(YTDLP_PATH) = %q, %v; want %q", resolved, err, ytDlp)
+	}
+	if resolved, err := resolveBinary(cfg.FFmpegPath, "ffmpeg"); err != nil || resolved != ffmpeg {
+		t.Fatalf("resolveBinary(FFMPEG_PATH) = %q, %v; want %q", resolved, err, ffmpeg)
+	}
+	if _, err := resolveBinary(filepath.Join(t.TempDir(), "missing"), "yt-dlp"); err == nil {
+		t.Error("resolveBinary accepted a missing binary")
+	}
+
+	audioURL, meta, err := getAudioStream(cfg.YtDlpPath, "https://youtu.be/dQw4w9WgXcQ", "job-1", ytDlpOptions{})
+	if err != nil {
+		t.Fatalf("getAudioStream: %v", err)
+	}
+	if audioURL != "https://93.184.216.34/audio.webm" || meta.Title != "Test Song" {
+		t.Errorf("got %q, %+v from the stub", audioURL, meta)
+	}
+	if args := stubArgs(t, ytDlp); args[len(args)-1] != "https://youtu.be/dQw4w9WgXcQ" {
+		t.Errorf("yt-dlp args = %v, want the video URL last", args)
+	}
+
+	path, info, err := convertAudio("job-1", conversion{AudioURL: audioURL, Format: "mp3", Bitrate: "192k"}, meta.Duration)
+	if err != nil {
+		t.Fatalf("convertAudio: %v", err)
+	}
+	if info.Size != int64(len("converted")) || filepath.Dir(path) != cfg.OutputDir {
+		t.Errorf("convertAudio wrote %s (%d bytes)", path, info.Size)
+	}
+	if input, _ := argValue(stubArgs(t, ffmpeg), "-i"); !strings.HasPrefix(input, "http://127.0.0.1:") {
+		t.Errorf("ffmpeg input = %q, want the loopback stream relay", input)
+	}
+}
+
+// memStorage is a Storage keeping objects in memory, standing in for S3
+type memStorage struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func newMemStorage() *memStorage {
+	return &memStorage{objects: map[string][]byte{}}
+}
+
+func (s *memStorage) Put(ctx context.Context, key string, r io.Reader) (string, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[key] = b
+	return "mem://" + key, nil
+}
+
+func (s *memStorage) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.objects, key)
+	return nil
+}
+
+func (s *memStorage) SignedURL(key string, ttl time.Duration) (string, error) {
+	return "https://objects.example/" + key + "?expires=" + ttl.String(), nil
+}
+
+func (s *memStorage) object(key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.objects[key]
+	return b, ok
+}
+
+// seedJob stores a pending job for videoURL and returns its queue message
+func seedJob(t *testing.T, id string, videoURL string) shared.JobMessage {
+	t.Helper()
+	job := &shared.Job{ID: id, OriginalURL: videoURL, Status: shared.JobStatusPending, CreatedAt: time.Now()}
+	if err := db.CreateJob(context.Background(), job); err != nil {
+		t.Fatal(err)
+	}
+	return shared.JobMessageFor(job)
+}
+
+func TestProcessJobUploadsToStorage(t *testing.T) {
+	t.Setenv("YTDLP_PATH", stubYtDlp(t, videoInfoJSON))
+	t.Setenv("FFMPEG_PATH", stubFFmpeg(t, "converted"))
+	setupWorker(t)
+	objects := newMemStorage()
+	store = objects
+	cfg.StorageBackend = shared.StorageBackendS3
+
+	processJob(seedJob(t, "job-1", "https://youtu.be/dQw4w9WgXcQ"))
+
+	job, err := db.GetJob(context.Background(), "job-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != shared.JobStatusCompleted {
+		t.Fatalf("job is %s: %s", job.Status, job.Error)
+	}
+	if b, ok := objects.object("job-1.mp3"); !ok || string(b) != "converted" {
+		t.Errorf("storage holds %q, %v; want the converted file", b, ok)
+	}
+	if job.StorageKey != "job-1.mp3" || !strings.HasPrefix(job.DownloadEndpoint, "https://objects.example/job-1.mp3") {
+		t.Errorf("job has key %q and download endpoint %q", job.StorageKey, job.DownloadEndpoint)
+	}
+	if _, err := os.Stat(filepath.Join(cfg.OutputDir, "job-1.mp3")); !os.IsNotExist(err) {
+		t.Error("the local copy was kept after uploading")
+	}
+}
+
+func TestProcessJobS3ResultSurvivesRedis(t *testing.T) {
+	t.Setenv("YTDLP_PATH", stubYtDlp(t, videoInfoJSON))
+	t.Setenv("FFMPEG_PATH", stubFFmpeg(t, "converted"))
+	setupWorker(t)
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	db = shared.NewRedisDB(client, 0, 0)
+	store = newMemStorage()
+	cfg.StorageBackend = shared.StorageBackendS3
+
+	processJob(seedJob(t, "job-1", "https://youtu.be/dQw4w9WgXcQ"))
+
+	job, err := db.GetJob(context.Background(), "job-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != shared.JobStatusCompleted {
+		t.Fatalf("job is %s: %s", job.Status, job.Error)
+	}
+	if key := job.AudioKey(); key != "job-1.mp3" {
+		t.Errorf("AudioKey() = %q after a Redis round trip, want job-1.mp3", key)
+	}
+}
+
+func TestFFmpegArgsSampleRateAndChannels(t *testing.T) {
+	setupWorker(t)
+	tests := []struct {
+		sampleRate int
+		channels   string
+		wantRate   string
+		wantAC     string // Empty means no -ac
+	}{
+		{0, "", "44100", ""},
+		{22050, "mono", "22050", "1"},
+		{48000, "stereo", "48000", "2"},
+	}
+	for _, tt := range tests {
+		args := ffmpegArgs(conversion{AudioURL: "https://stream.example/a", Format: "mp3", Bitrate: "64k",
+			SampleRate: tt.sampleRate, Channels: tt.channels}, "/out/file")
+		if rate, _ := argValue(args, "-ar"); rate != tt.wantRate {
+			t.Errorf("%d/%q: -ar %q, want %q", tt.sampleRate, tt.channels, rate, tt.wantRate)
+		}
+		if ac, _ := argValue(args, "-ac"); ac != tt.wantAC {
+			t.Errorf("%d/%q: -ac %q, want %q", tt.sampleRate, tt.channels, ac, tt.wantAC)
+		}
+	}
+}
+
+func TestFFmpegArgsPassTags(t *testing.T) {
+	setupWorker(t)
+	tags := map[string]string{"title": "Song\nwith newline", "artist": "Artist", "comment": ""}
+	args := ffmpegArgs(conversion{AudioURL: "https://stream.example/a", Format: "mp3", Bitrate: "192k", Tags: tags}, "/out/file")
+
+	var metadata []string
+	for i, arg := range args {
+		if arg == "-metadata" && i+1 < len(args) {
+			metadata = append(metadata, args[i+1])
+		}
+	}
+	want := []string{"artist=Artist", "title=Song with newline"}
+	if !slices.Equal(metadata, want) {
+		t.Errorf("-metadata values %q, want %q", metadata, want)
+	}
+	if v, _ := argValue(args, "-id3v2_version"); v != "3" {
+		t.Errorf("-id3v2_version %q, want 3", v)
+	}
+
+	args = ffmpegArgs(conversion{AudioURL: "https://stream.example/a", Format: "mp3", Bitrate: "192k"}, "/out/file")
+	if slices.Contains(args, "-metadata") {
+		t.Errorf("untagged conversion got -metadata: %v", args)
+	}
+}
+
+func TestProcessJobRejectsClipBeyondDuration(t *testing.T) {
+	ffmpeg := stubFFmpeg(t, "converted")
+	t.Setenv("YTDLP_PATH", stubYtDlp(t, videoInfoJSON))
+	t.Setenv("FFMPEG_PATH", ffmpeg)
+	setupWorker(t)
+	msg := seedJob(t, "job-1", "https://youtu.be/dQw4w9WgXcQ")
+	msg.ClipStart, msg.ClipEnd = 30, 90 // The stub video is 60 seconds long
+
+	processJob(msg)
+
+	job, err := db.GetJob(context.Background(), "job-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != shared.JobStatusFailed || !strings.Contains(job.Error, "beyond the video duration") {
+		t.Errorf("job is %s with error %q, want failed for the clip range", job.Status, job.Error)
+	}
+	if _, err := os.Stat(ffmpeg + ".args"); err == nil {
+		t.Error("ffmpeg ran for an invalid clip")
+	}
+}
+
+func TestFFmpegArgsClipRange(t *testing.T) {
+	setupWorker(t)
+	args := ffmpegArgs(conversion{AudioURL: "https://stream.example/a", Format: "mp3", ClipStart: 30, ClipEnd: 90.5}, "/out/file")
+	ss, _ := argValue(args, "-ss")
+	to, _ := argValue(args, "-to")
+	if ss != "30" || to != "90.5" {
+		t.Errorf("-ss %q -to %q, want 30 and 90.5", ss, to)
+	}
+	if slices.Index(args, "-ss") > slices.Index(args, "-i") {
+		t.Errorf("-ss is not an input option: %v", args)
+	}
+}
+
+func TestFFmpegArgsLoudnorm(t *testing.T) {
+	setupWorker(t)
+	cfg.LoudnessTarget = -16
+	args := ffmpegArgs(conversion{AudioURL: "https://stream.example/a", Format: "mp3", Normalize: true}, "/out/file")
+	if filter, _ := argValue(args, "-af"); filter != "loudnorm=I=-16:TP=-1.5:LRA=11" {
+		t.Errorf("-af %q, want loudnorm towards -16 LUFS", filter)
+	}
+	args = ffmpegArgs(conversion{AudioURL: "https://stream.example/a", Format: "mp3"}, "/out/file")
+	if slices.Contains(args, "-af") {
+		t.Errorf("unnormalized conversion got a filter: %v", args)
+	}
+}
+
+func TestCallbackEchoesClientMetadata(t *testing.T) {
+	t.Setenv("YTDLP_PATH", stubYtDlp(t, videoInfoJSON))
+	t.Setenv("FFMPEG_PATH", stubFFmpeg(t, "converted"))
+	t.Setenv("CALLBACK_HOST_ALLOWLIST", "127.0.0.1")
+	setupWorker(t)
+	bodies := make(chan []byte, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		bodies <- b
+	}))
+	defer srv.Close()
+
+	metadata := map[string]string{"user_id": "42", "order_id": "A-1001"}
+	job := &shared.Job{ID: "job-1", OriginalURL: "https://youtu.be/dQw4w9WgXcQ", Status: shared.JobStatusPending,
+		CreatedAt: time.Now(), CallbackURL: srv.URL, ClientMetadata: metadata}
+	if err := db.CreateJob(context.Background(), job); err != nil {
+		t.Fatal(err)
+	}
+	processJob(shared.JobMessageFor(job))
+
+	select {
+	case b := <-bodies:
+		var got shared.Job
+		if err := json.Unmarshal(b, &got); err != nil {
+			t.Fatalf("bad callback body %s: %v", b, err)
+		}
+		if got.Status != shared.JobStatusCompleted || !maps.Equal(got.ClientMetadata, metadata) {
+			t.Errorf("callback status %s, client_metadata %v; want completed, %v", got.Status, got.ClientMetadata, metadata)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("callback was not delivered")
+	}
+	// Let the delivery finish recording its result before the next test
+	waitFor(t, 5*time.Second, "the callback result", func() bool {
+		job, _ := db.GetJob(context.Background(), "job-1")
+		return job.CallbackStatus != 0
+	})
+}
+
+// flappingCallbackServer answers 503 to the first failures callbacks and 204 after that
+func flappingCallbackServer(t *testing.T, failures int32) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func TestCallbackRetriesFlappingServer(t *testing.T) {
+	t.Setenv("CALLBACK_HOST_ALLOWLIST", "127.0.0.1")
+	t.Setenv("WEBHOOK_MAX_RETRIES", "3")
+	setupWorker(t)
+	cfg.WebhookRetryBackoff = time.Millisecond
+	srv, calls := flappingCallbackServer(t, 2)
+	job := &shared.Job{ID: "job-1", Status: shared.JobStatusCompleted, CallbackURL: srv.URL}
+	if err := db.CreateJob(context.Background(), job); err != nil {
+		t.Fatal(err)
+	}
+
+	notifyWebhook(job)
+	waitFor(t, 5*time.Second, "the callback result", func() bool {
+		job, _ := db.GetJob(context.Background(), "job-1")
+		return job.CallbackStatus != 0
+	})
+	job, _ = db.GetJob(context.Background(), "job-1")
+	if job.CallbackStatus != http.StatusNoContent || job.CallbackError != "" || calls.Load() != 3 {
+		t.Errorf("callback status %d, error %q after %d calls; want 204 on the third", job.CallbackStatus, job.CallbackError, calls.Load())
+	}
+	if entries, _ := callbackDLQ.List(context.Background()); len(entries) != 0 {
+		t.Errorf("delivered callback dead-lettered: %+v", entries)
+	}
+}
+
+func TestCallbackDeadLetteredAfterRetries(t *testing.T) {
+	t.Setenv("CALLBACK_HOST_ALLOWLIST", "127.0.0.1")
+	t.Setenv("WEBHOOK_MAX_RETRIES", "2")
+	setupWorker(t)
+	cfg.WebhookRetryBackoff = time.Millisecond
+	srv, calls := flappingCallbackServer(t, 5) // Recovers only after the retries run out
+	job := &shared.Job{ID: "job-1", Status: shared.JobStatusFailed, CallbackURL: srv.URL}
+	if err := db.CreateJob(context.Background(), job); err != nil {
+		t.Fatal(err)
+	}
+
+	notifyWebhook(job)
+	var entries []shared.UndeliveredCallback
+	waitFor(t, 5*time.Second, "the callback to be dead-lettered", func() bool {
+		entries, _ = callbackDLQ.List(context.Background())
+		return len(entries) > 0
+	})
+	cb := entries[0]
+	if cb.JobID != "job-1" || cb.CallbackURL != srv.URL || cb.Attempts != 3 || cb.LastStatus != http.StatusServiceUnavailable || calls.Load() != 3 {
+		t.Errorf("dead-lettered %+v after %d calls", cb, calls.Load())
+	}
+	var payload shared.Job
+	if err := json.Unmarshal(cb.Payload, &payload); err != nil || payload.ID != "job-1" || payload.Status != shared.JobStatusFailed {
+		t.Errorf("payload %s: %v", cb.Payload, err)
+	}
+	job, _ = db.GetJob(context.Background(), "job-1")
+	if job.CallbackStatus != http.StatusServiceUnavailable || job.CallbackError == "" {
+		t.Errorf("job callback status %d, error %q", job.CallbackStatus, job.CallbackError)
+	}
+}
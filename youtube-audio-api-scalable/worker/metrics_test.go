@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+// histogramSamples returns the observation count and sum of the series of
+// histogram name with the given format and failure_reason labels
+func histogramSamples(t *testing.T, name, format, reason string) (uint64, float64) {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range families {
+		if mf.GetName() != name {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			labels := map[string]string{}
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			if labels["format"] == format && labels["failure_reason"] == reason {
+				return m.GetHistogram().GetSampleCount(), m.GetHistogram().GetSampleSum()
+			}
+		}
+	}
+	return 0, 0
+}
+
+// seedWaitingJob stores a job submitted wait ago in format
+func seedWaitingJob(t *testing.T, id, format string, wait time.Duration) shared.JobMessage {
+	t.Helper()
+	job := &shared.Job{ID: id, OriginalURL: "https://youtu.be/dQw4w9WgXcQ", Status: shared.JobStatusPending,
+		CreatedAt: time.Now().Add(-wait), Format: format}
+	if err := db.CreateJob(context.Background(), job); err != nil {
+		t.Fatal(err)
+	}
+	return shared.JobMessageFor(job)
+}
+
+func TestProcessJobRecordsTimingHistograms(t *testing.T) {
+	t.Setenv("FFMPEG_PATH", stubFFmpeg(t, "converted"))
+	t.Setenv("YTDLP_PATH", stubYtDlp(t, videoInfoJSON))
+	t.Setenv("MAX_JOB_ATTEMPTS", "1")
+	setupWorker(t)
+
+	waitCount, waitSum := histogramSamples(t, "job_queue_wait_seconds", "opus", "none")
+	runCount, _ := histogramSamples(t, "job_run_duration_seconds", "opus", "none")
+	processJob(seedWaitingJob(t, "job-ok", "opus", 90*time.Second))
+
+	if job, _ := db.GetJob(context.Background(), "job-ok"); job == nil || job.Status != shared.JobStatusCompleted {
+		t.Fatalf("job = %+v, want it completed", job)
+	}
+	count, sum := histogramSamples(t, "job_queue_wait_seconds", "opus", "none")
+	if count != waitCount+1 {
+		t.Errorf("queue wait observations = %d, want %d", count, waitCount+1)
+	}
+	if wait := sum - waitSum; wait < 90 || wait > 120 {
+		t.Errorf("queue wait observed %.1fs, want about 90s", wait)
+	}
+	if count, _ := histogramSamples(t, "job_run_duration_seconds", "opus", "none"); count != runCount+1 {
+		t.Errorf("run duration observations = %d, want %d", count, runCount+1)
+	}
+
+	// A failed job is labelled with its failure reason
+	cfg.YtDlpPath = writeStub(t, "yt-dlp", `echo "ERROR: [youtube] dQw4w9WgXcQ: Private video"; exit 1`)
+	failedCount, _ := histogramSamples(t, "job_run_duration_seconds", "opus", string(shared.FailureVideoUnavailable))
+	processJob(seedWaitingJob(t, "job-failed", "opus", time.Second))
+	if count, _ := histogramSamples(t, "job_run_duration_seconds", "opus", string(shared.FailureVideoUnavailable)); count != failedCount+1 {
+		t.Errorf("failed run observations = %d, want %d", count, failedCount+1)
+	}
+}
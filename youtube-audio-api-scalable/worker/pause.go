@@ -0,0 +1,120 @@
+// worker/pause.go
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+// pauseGate holds the queue consumer while an operator has paused the worker.
+// Running jobs are not affected; the worker just stops taking new messages.
+type pauseGate struct {
+	mu     sync.Mutex
+	paused bool
+	since  time.Time
+	resume chan struct{} // Closed by Resume to let a waiting consumer through
+}
+
+func newPauseGate() *pauseGate {
+	return &pauseGate{}
+}
+
+// Pause stops new messages from being taken. It reports whether the worker
+// was running before.
+func (g *pauseGate) Pause() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.paused {
+		return false
+	}
+	g.paused = true
+	g.since = time.Now().UTC()
+	g.resume = make(chan struct{})
+	return true
+}
+
+// Resume lets the consumer take messages again. It reports whether the
+// worker was paused before.
+func (g *pauseGate) Resume() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.paused {
+		return false
+	}
+	g.paused = false
+	g.since = time.Time{}
+	close(g.resume)
+	return true
+}
+
+// State returns whether the worker is paused and since when
+func (g *pauseGate) State() (paused bool, since time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.paused, g.since
+}
+
+// Wait blocks while the worker is paused. It returns false if stop is closed first.
+func (g *pauseGate) Wait(stop <-chan struct{}) bool {
+	for {
+		g.mu.Lock()
+		paused, resume := g.paused, g.resume
+		g.mu.Unlock()
+		if !paused {
+			return true
+		}
+		select {
+		case <-resume:
+		case <-stop:
+			return false
+		}
+	}
+}
+
+// handleAdminPause: Stops this worker from starting new jobs until resumed
+func handleAdminPause(w http.ResponseWriter, r *http.Request) {
+	// Auth handled by middleware
+	if r.Method != http.MethodPost {
+		shared.WriteError(w, http.StatusMethodNotAllowed, shared.ErrCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if consumerPause.Pause() {
+		active, _ := workerLimiter.Usage()
+		log.Printf("INFO: Queue consumption paused by admin (%d job(s) still running)", active)
+	}
+	writePauseState(w)
+}
+
+// handleAdminResume: Lets a paused worker take jobs from the queue again
+func handleAdminResume(w http.ResponseWriter, r *http.Request) {
+	// Auth handled by middleware
+	if r.Method != http.MethodPost {
+		shared.WriteError(w, http.StatusMethodNotAllowed, shared.ErrCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if consumerPause.Resume() {
+		log.Println("INFO: Queue consumption resumed by admin")
+	}
+	drained.Store(false) // Ready again, in case the worker was drained
+	writePauseState(w)
+}
+
+// writePauseState responds with the pause state and the running jobs
+func writePauseState(w http.ResponseWriter) {
+	paused, since := consumerPause.State()
+	active, _ := workerLimiter.Usage()
+	resp := map[string]any{
+		"paused":         paused,
+		"active_workers": active,
+	}
+	if paused {
+		resp["paused_since"] = since
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
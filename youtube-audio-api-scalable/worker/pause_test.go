@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+// runConsumer runs startQueueConsumer for the rest of the test, then stops it
+// and waits for the jobs it started
+func runConsumer(t *testing.T) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		startQueueConsumer()
+	}()
+	t.Cleanup(func() {
+		close(shuttingDown)
+		mq.Close()
+		<-done
+	})
+}
+
+// jobStatus returns the stored status of jobID
+func jobStatus(t *testing.T, jobID string) shared.JobStatus {
+	t.Helper()
+	job, err := db.GetJob(context.Background(), jobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return job.Status
+}
+
+func TestPauseHoldsJobsUntilResume(t *testing.T) {
+	t.Setenv("YTDLP_PATH", stubYtDlp(t, videoInfoJSON))
+	t.Setenv("FFMPEG_PATH", stubFFmpeg(t, "converted"))
+	setupWorker(t)
+	ctx := context.Background()
+
+	rec := httptest.NewRecorder()
+	handleAdminPause(rec, httptest.NewRequest(http.MethodPost, "/admin/pause", nil))
+	if paused, _ := consumerPause.State(); rec.Code != http.StatusOK || !paused {
+		t.Fatalf("pause: status %d, paused %v", rec.Code, paused)
+	}
+	runConsumer(t)
+	if err := mq.Publish(ctx, seedJob(t, "job-1", "https://youtu.be/dQw4w9WgXcQ")); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+	if st := jobStatus(t, "job-1"); st != shared.JobStatusPending {
+		t.Fatalf("job is %s while paused, want pending", st)
+	}
+	if depth, _ := mq.Depth(ctx); depth != 1 {
+		t.Errorf("queue depth %d while paused, want the job left queued", depth)
+	}
+	var health struct {
+		Paused      bool      `json:"paused"`
+		PausedSince time.Time `json:"paused_since"`
+	}
+	rec = httptest.NewRecorder()
+	handleHealth(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if err := json.Unmarshal(rec.Body.Bytes(), &health); err != nil || !health.Paused || health.PausedSince.IsZero() {
+		t.Errorf("health while paused: %s", rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	handleAdminResume(rec, httptest.NewRequest(http.MethodPost, "/admin/resume", nil))
+	if paused, _ := consumerPause.State(); rec.Code != http.StatusOK || paused {
+		t.Fatalf("resume: status %d, paused %v", rec.Code, paused)
+	}
+	waitFor(t, 5*time.Second, "the job to complete after resuming", func() bool {
+		return jobStatus(t, "job-1") == shared.JobStatusCompleted
+	})
+}
+
+func TestPauseAndResumeRequirePost(t *testing.T) {
+	setupWorker(t)
+	for path, handler := range map[string]http.HandlerFunc{"/admin/pause": handleAdminPause, "/admin/resume": handleAdminResume} {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("GET %s: status %d", path, rec.Code)
+		}
+	}
+	if paused, _ := consumerPause.State(); paused {
+		t.Error("a GET paused the worker")
+	}
+}
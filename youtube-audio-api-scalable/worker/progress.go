@@ -0,0 +1,129 @@
+// worker/progress.go
+package main
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+// progressUpdateInterval limits how often conversion progress is written to the DB
+const progressUpdateInterval = time.Second
+
+// ffmpegTimePattern matches the "time=HH:MM:SS.xx" field of ffmpeg's status line
+var ffmpegTimePattern = regexp.MustCompile(`time=(\d+):(\d{2}):(\d{2}(?:\.\d+)?)`)
+
+// parseFFmpegTime returns the position in seconds reported by an ffmpeg status line
+func parseFFmpegTime(line []byte) (float64, bool) {
+	m := ffmpegTimePattern.FindSubmatch(line)
+	if m == nil {
+		return 0, false
+	}
+	h, _ := strconv.Atoi(string(m[1]))
+	min, _ := strconv.Atoi(string(m[2]))
+	sec, err := strconv.ParseFloat(string(m[3]), 64)
+	if err != nil {
+		return 0, false
+	}
+	return float64(h*3600+min*60) + sec, true
+}
+
+// progressWriter captures ffmpeg output and reports the conversion percentage
+// (0-100) as status lines arrive. ffmpeg separates status lines with '\r'.
+type progressWriter struct {
+	mu         sync.Mutex
+	out        bytes.Buffer // Full output, kept for error messages
+	line       []byte       // Current incomplete line
+	duration   float64
+	last       int
+	onProgress func(percent int)
+	onLine     func(line shared.ProgressLine) // Every status line, when set
+}
+
+func newProgressWriter(duration float64, onProgress func(percent int)) *progressWriter {
+	return &progressWriter{duration: duration, last: -1, onProgress: onProgress}
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.out.Write(b)
+	for _, c := range b {
+		if c != '\r' && c != '\n' {
+			p.line = append(p.line, c)
+			continue
+		}
+		p.handleLine(p.line)
+		p.line = p.line[:0]
+	}
+	return len(b), nil
+}
+
+func (p *progressWriter) handleLine(line []byte) {
+	t, ok := parseFFmpegTime(line)
+	if !ok {
+		return
+	}
+	pct := 0
+	if p.duration > 0 {
+		pct = min(int(t/p.duration*100), 100)
+	}
+	if p.onLine != nil {
+		p.onLine(shared.ProgressLine{Line: string(line), Position: t, Percent: pct, Time: time.Now()})
+	}
+	if p.duration <= 0 || p.onProgress == nil {
+		return
+	}
+	// Only report forward progress so values are monotonic
+	if pct > p.last {
+		p.last = pct
+		p.onProgress(pct)
+	}
+}
+
+// String returns everything ffmpeg wrote
+func (p *progressWriter) String() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.out.String()
+}
+
+// jobProgressPublisher returns a callback that passes jobID's status lines to
+// progressFeed for admins watching the conversion. Each is published in the
+// background so a slow Redis never holds up ffmpeg.
+func jobProgressPublisher(jobID string) func(shared.ProgressLine) {
+	return func(line shared.ProgressLine) {
+		go func() {
+			if err := progressFeed.Publish(context.Background(), jobID, line); err != nil {
+				shared.WithJob(logger, jobID).Debug("Failed to publish progress line", "error", err)
+			}
+		}()
+	}
+}
+
+// jobProgressReporter returns a callback that stores progress on the job at
+// most once per progressUpdateInterval
+func jobProgressReporter(jobID string) func(int) {
+	var lastUpdate time.Time
+	return func(percent int) {
+		if time.Since(lastUpdate) < progressUpdateInterval {
+			return
+		}
+		lastUpdate = time.Now()
+		// Re-read the job so a concurrent cancellation is not overwritten
+		ctx := context.Background()
+		job, err := db.GetJob(ctx, jobID)
+		if err != nil || job.Status != shared.JobStatusProcessing {
+			return
+		}
+		job.Progress = percent
+		if err := db.UpdateJob(ctx, job); err != nil {
+			shared.WithJob(logger, jobID).Warn("Failed to store progress", "error", err)
+		}
+	}
+}
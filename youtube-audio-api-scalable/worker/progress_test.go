@@ -0,0 +1,120 @@
+// worker/progress_test.go
+package main
+
+import (
+	"cmp"
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+// cannedFFmpegOutput is ffmpeg's stderr for a 100 second input: a banner, then
+// '\r'-separated status lines, one of them going backwards as after a seek
+const cannedFFmpegOutput = "ffmpeg version 6.1 Copyright (c) 2000-2023 the FFmpeg developers\n" +
+	"Input #0, matroska,webm, from 'https://example.com/a.webm':\n" +
+	"  Duration: 00:01:40.00, start: 0.000000, bitrate: 128 kb/s\n" +
+	"size=     256kB time=00:00:10.00 bitrate= 209.7kbits/s speed=20x\r" +
+	"size=     512kB time=00:00:25.50 bitrate= 164.5kbits/s speed=21x\r" +
+	"size=     480kB time=00:00:20.00 bitrate= 196.6kbits/s speed=20x\r" +
+	"size=    1024kB time=00:01:05.25 bitrate= 128.6kbits/s speed=22x\r" +
+	"size=    1536kB time=00:01:40.00 bitrate= 125.8kbits/s speed=22x\r" +
+	"size=    1537kB time=00:01:41.20 bitrate= 124.4kbits/s speed=22x\n" +
+	"video:0kB audio:1537kB subtitle:0kB other streams:0kB global headers:0kB\n"
+
+func TestParseFFmpegTime(t *testing.T) {
+	tests := []struct {
+		line string
+		want float64
+		ok   bool
+	}{
+		{"size=     256kB time=00:00:10.00 bitrate= 209.7kbits/s", 10, true},
+		{"size=1kB time=01:02:03.50 bitrate=1kbits/s", 3723.5, true},
+		{"time=00:00:07 speed=1x", 7, true},
+		{"size=N/A time=N/A bitrate=N/A", 0, false},
+		{"Duration: 00:01:40.00, start: 0.000000", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseFFmpegTime([]byte(tt.line))
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("parseFFmpegTime(%q) = %v, %v; want %v, %v", tt.line, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestProgressWriterIsMonotonic(t *testing.T) {
+	var reported []int
+	p := newProgressWriter(100, func(percent int) { reported = append(reported, percent) })
+	// Written in small chunks, as a pipe delivers it
+	for b := []byte(cannedFFmpegOutput); len(b) > 0; {
+		n := min(7, len(b))
+		p.Write(b[:n])
+		b = b[n:]
+	}
+
+	if want := []int{10, 25, 65, 100}; !slices.Equal(reported, want) {
+		t.Errorf("reported %v, want %v", reported, want)
+	}
+	if p.String() != cannedFFmpegOutput {
+		t.Error("the full output was not kept")
+	}
+}
+
+func TestProgressWriterWithoutDuration(t *testing.T) {
+	called := false
+	p := newProgressWriter(0, func(int) { called = true })
+	p.Write([]byte(cannedFFmpegOutput))
+	if called {
+		t.Error("progress reported without a known duration")
+	}
+}
+
+func TestConversionPublishesProgressLines(t *testing.T) {
+	canned := filepath.Join(t.TempDir(), "ffmpeg-output")
+	if err := os.WriteFile(canned, []byte(cannedFFmpegOutput), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("YTDLP_PATH", stubYtDlp(t, videoInfoJSON))
+	t.Setenv("FFMPEG_PATH", writeStub(t, "ffmpeg", `cat '`+canned+`' >&2
+for out; do :; done
+printf converted > "$out"`))
+	setupWorker(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lines := progressFeed.Subscribe(ctx, "job-1")
+	processJob(seedJob(t, "job-1", "https://youtu.be/dQw4w9WgXcQ"))
+
+	// Lines are published in the background, so they may arrive out of order
+	var got []shared.ProgressLine
+	timeout := time.After(2 * time.Second)
+	for len(got) < 6 {
+		select {
+		case line := <-lines:
+			got = append(got, line)
+		case <-timeout:
+			t.Fatalf("got %d progress lines, want 6", len(got))
+		}
+	}
+	slices.SortFunc(got, func(a, b shared.ProgressLine) int { return cmp.Compare(a.Position, b.Position) })
+	var positions []float64
+	for _, line := range got {
+		positions = append(positions, line.Position)
+		if !strings.Contains(line.Line, "time=") || strings.ContainsAny(line.Line, "\r\n") || line.Time.IsZero() {
+			t.Errorf("progress line %+v", line)
+		}
+	}
+	if want := []float64{10, 20, 25.5, 65.25, 100, 101.2}; !slices.Equal(positions, want) {
+		t.Errorf("positions %v, want %v", positions, want)
+	}
+	// The stub video is 60 seconds long
+	if got[0].Percent != 16 || got[len(got)-1].Percent != 100 {
+		t.Errorf("percentages %d..%d, want 16..100", got[0].Percent, got[len(got)-1].Percent)
+	}
+}
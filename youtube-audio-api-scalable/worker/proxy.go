@@ -0,0 +1,31 @@
+// worker/proxy.go
+package main
+
+import (
+	"hash/fnv"
+	"net/url"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+// proxyFor picks the yt-dlp proxy for msg from cfg.YtDlpProxy, or "" for none.
+// A job keeps its proxy across the worker but moves to the next one on each
+// retry, so a blocked proxy doesn't fail every attempt.
+func proxyFor(msg shared.JobMessage) string {
+	if len(cfg.YtDlpProxy) == 0 {
+		return ""
+	}
+	h := fnv.New32a()
+	h.Write([]byte(msg.JobID))
+	i := (int(h.Sum32()%uint32(len(cfg.YtDlpProxy))) + msg.Attempt) % len(cfg.YtDlpProxy)
+	return cfg.YtDlpProxy[i]
+}
+
+// redactProxy hides any credentials in a proxy URL for logging
+func redactProxy(proxy string) string {
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return "(invalid)"
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,123 @@
+// worker/reaper.go
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+// startReaper periodically removes finished jobs older than cfg.JobTTL along
+// with their files, and deletes files in OutputDir that no job refers to
+func startReaper() {
+	if cfg.JobTTL <= 0 {
+		log.Println("INFO: JOB_TTL_SECONDS is 0; finished jobs are kept forever.")
+		return
+	}
+	log.Printf("INFO: Reaper removing finished jobs older than %s every %s", cfg.JobTTL, cfg.CleanupInterval)
+	ticker := time.NewTicker(cfg.CleanupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-shuttingDown:
+			return
+		case <-ticker.C:
+		}
+		reapExpiredJobs(context.Background(), time.Now())
+		reapOrphanedFiles(context.Background(), time.Now())
+	}
+}
+
+// reapExpiredJobs deletes finished jobs once their ExpiresAt has passed. Jobs
+// without one expire a TTL after their CompletedAt, or DeletedAt for
+// soft-deleted ones.
+func reapExpiredJobs(ctx context.Context, now time.Time) {
+	jobs, err := db.GetAllJobs(ctx)
+	if err != nil {
+		log.Printf("WARN: Reaper failed to list jobs: %v", err)
+		return
+	}
+	removed := 0
+	for _, job := range jobs {
+		expiresAt := job.ExpiresAt
+		if expiresAt == nil {
+			finishedAt := job.CompletedAt
+			if job.Status == shared.JobStatusDeleted {
+				finishedAt = job.DeletedAt // Soft-deleted jobs are kept a full TTL for auditing
+			}
+			if finishedAt != nil {
+				expiresAt = shared.ExpiryAfter(*finishedAt, cfg.JobTTL)
+			}
+		}
+		if !job.Status.IsTerminal() || expiresAt == nil || now.Before(*expiresAt) {
+			continue
+		}
+		removeJobFiles(job)
+		if err := db.DeleteJob(ctx, job.ID); err != nil {
+			log.Printf("WARN: Reaper failed to delete job %s: %v", job.ID, err)
+			continue
+		}
+		removed++
+	}
+	if removed > 0 {
+		log.Printf("INFO: Reaper removed %d expired job(s)", removed)
+	}
+}
+
+// removeJobFiles deletes a job's stored objects and local file, if any
+func removeJobFiles(job *shared.Job) {
+	for _, key := range job.ArtifactKeys() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		if err := store.Delete(ctx, key); err != nil {
+			log.Printf("WARN: Reaper failed to delete %s from storage: %v", key, err)
+		}
+		cancel()
+	}
+	// Jobs read back from Redis have no FilePath; the audio is named after its key
+	path := job.FilePath
+	if key := job.AudioKey(); path == "" && key != "" {
+		path = filepath.Join(cfg.OutputDir, filepath.Base(key))
+	}
+	if path != "" {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Printf("WARN: Reaper failed to delete %s: %v", path, err)
+		}
+	}
+}
+
+// reapOrphanedFiles removes files older than the TTL whose job no longer
+// exists, e.g. because its Redis key expired
+func reapOrphanedFiles(ctx context.Context, now time.Time) {
+	entries, err := os.ReadDir(cfg.OutputDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("WARN: Reaper failed to read %s: %v", cfg.OutputDir, err)
+		}
+		return
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || now.Sub(info.ModTime()) < cfg.JobTTL {
+			continue
+		}
+		name := e.Name()
+		jobID := strings.TrimSuffix(name, filepath.Ext(name))
+		if i := strings.IndexByte(jobID, '_'); i >= 0 {
+			jobID = jobID[:i] // Clips are named <jobID>_clip_<range>
+		}
+		if _, err := db.GetJob(ctx, jobID); err == nil {
+			continue
+		}
+		if err := os.Remove(filepath.Join(cfg.OutputDir, name)); err == nil {
+			log.Printf("INFO: Reaper removed orphaned file %s", name)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+// seedFinishedJob stores a completed job whose output file exists and
+// returns the file's path
+func seedFinishedJob(t *testing.T, id string, expiresAt time.Time) string {
+	t.Helper()
+	path := filepath.Join(cfg.OutputDir, id+".mp3")
+	if err := os.WriteFile(path, []byte("audio"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	completedAt := expiresAt.Add(-time.Hour)
+	job := &shared.Job{
+		ID:          id,
+		Status:      shared.JobStatusCompleted,
+		CreatedAt:   completedAt,
+		CompletedAt: &completedAt,
+		ExpiresAt:   &expiresAt,
+		FilePath:    path,
+	}
+	if err := db.CreateJob(context.Background(), job); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReaperRemovesExpiredJobsOnly(t *testing.T) {
+	setupWorker(t)
+	now := time.Now()
+	expiredFile := seedFinishedJob(t, "expired", now.Add(-time.Minute))
+	freshFile := seedFinishedJob(t, "fresh", now.Add(time.Hour))
+
+	reapExpiredJobs(context.Background(), now)
+
+	if _, err := db.GetJob(context.Background(), "expired"); err == nil {
+		t.Error("the expired job was kept")
+	}
+	if _, err := os.Stat(expiredFile); !os.IsNotExist(err) {
+		t.Error("the expired job's file was kept")
+	}
+	if _, err := db.GetJob(context.Background(), "fresh"); err != nil {
+		t.Errorf("the fresh job was removed: %v", err)
+	}
+	if _, err := os.Stat(freshFile); err != nil {
+		t.Errorf("the fresh job's file was removed: %v", err)
+	}
+}
+
+func TestReaperRemovesOrphanedFiles(t *testing.T) {
+	setupWorker(t)
+	cfg.JobTTL = time.Hour
+	now := time.Now()
+	kept := seedFinishedJob(t, "known", now.Add(time.Hour))
+	orphan := filepath.Join(cfg.OutputDir, "gone.mp3")
+	if err := os.WriteFile(orphan, []byte("audio"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	reapOrphanedFiles(context.Background(), now.Add(2*time.Hour))
+
+	if _, err := os.Stat(orphan); !os.IsNotExist(err) {
+		t.Error("a file without a job was kept")
+	}
+	if _, err := os.Stat(kept); err != nil {
+		t.Errorf("a job's file was removed: %v", err)
+	}
+}
+
+func TestReaperPurgesSoftDeletedJobsAfterTTL(t *testing.T) {
+	setupWorker(t)
+	now := time.Now()
+	longAgo := now.Add(-10 * cfg.JobTTL)
+	for id, deletedAt := range map[string]time.Time{"old": now.Add(-cfg.JobTTL - time.Minute), "recent": now.Add(-time.Minute)} {
+		// Completed long ago: only DeletedAt keeps the recent one around
+		job := &shared.Job{ID: id, Status: shared.JobStatusDeleted, CreatedAt: longAgo, CompletedAt: &longAgo, DeletedAt: &deletedAt}
+		if err := db.CreateJob(context.Background(), job); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reapExpiredJobs(context.Background(), now)
+
+	if _, err := db.GetJob(context.Background(), "old"); err == nil {
+		t.Error("the job soft-deleted over a TTL ago was kept")
+	}
+	if _, err := db.GetJob(context.Background(), "recent"); err != nil {
+		t.Errorf("the recently soft-deleted job was purged: %v", err)
+	}
+}
+
+func TestCompletedJobExpiresAfterTTL(t *testing.T) {
+	t.Setenv("YTDLP_PATH", stubYtDlp(t, videoInfoJSON))
+	t.Setenv("FFMPEG_PATH", stubFFmpeg(t, "converted"))
+	t.Setenv("JOB_TTL_SECONDS", "3600")
+	setupWorker(t)
+	processJob(seedJob(t, "job-1", "https://youtu.be/dQw4w9WgXcQ"))
+
+	ctx := context.Background()
+	job, err := db.GetJob(ctx, "job-1")
+	if err != nil || job.Status != shared.JobStatusCompleted {
+		t.Fatalf("job %+v, %v", job, err)
+	}
+	if job.ExpiresAt == nil || !job.ExpiresAt.Equal(job.CompletedAt.Add(time.Hour)) {
+		t.Fatalf("expires_at %v, want completed_at %v + 1h", job.ExpiresAt, job.CompletedAt)
+	}
+
+	// Kept until exactly expires_at, then removed with its file
+	reapExpiredJobs(ctx, job.ExpiresAt.Add(-time.Millisecond))
+	if _, err := db.GetJob(ctx, "job-1"); err != nil {
+		t.Fatalf("removed before expires_at: %v", err)
+	}
+	reapExpiredJobs(ctx, *job.ExpiresAt)
+	if _, err := db.GetJob(ctx, "job-1"); err == nil {
+		t.Error("kept at expires_at")
+	}
+	if _, err := os.Stat(job.FilePath); !os.IsNotExist(err) {
+		t.Errorf("output file kept at expires_at: %v", err)
+	}
+}
+
+func TestReaperExpiresJobsWithoutExpiresAtAfterTTL(t *testing.T) {
+	setupWorker(t)
+	cfg.JobTTL = time.Hour
+	ctx := context.Background()
+	completedAt := time.Now().Add(-2 * time.Hour)
+	job := &shared.Job{ID: "legacy", Status: shared.JobStatusCompleted, CreatedAt: completedAt, CompletedAt: &completedAt}
+	if err := db.CreateJob(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+
+	reapExpiredJobs(ctx, completedAt.Add(time.Hour-time.Millisecond))
+	if _, err := db.GetJob(ctx, "legacy"); err != nil {
+		t.Fatalf("removed before its TTL: %v", err)
+	}
+	reapExpiredJobs(ctx, completedAt.Add(time.Hour))
+	if _, err := db.GetJob(ctx, "legacy"); err == nil {
+		t.Error("kept past its TTL")
+	}
+}
@@ -0,0 +1,64 @@
+// worker/recover.go
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+// The stale recovery lock keeps workers starting together from recovering
+// the same jobs twice; it expires in case its holder dies mid-scan
+const (
+	staleRecoveryLock    = "recover-stale-jobs"
+	staleRecoveryLockTTL = 5 * time.Minute
+)
+
+// recoverStaleJobs re-queues jobs left processing for longer than
+// cfg.StaleProcessingTimeout, which the worker that took them will never
+// finish, e.g. because it crashed. An in-memory queue lost their messages with
+// the worker; a Redis entry is normally reclaimed from the dead worker first,
+// so this catches the jobs that slipped through. The lost run counts as an
+// attempt, so a job that keeps killing its worker ends up dead-lettered.
+func recoverStaleJobs(ctx context.Context, now time.Time) {
+	if cfg.StaleProcessingTimeout <= 0 {
+		return
+	}
+	release, ok, err := locker.TryLock(ctx, staleRecoveryLock, staleRecoveryLockTTL)
+	if err != nil {
+		log.Printf("WARN: Skipping stale job recovery, failed to take its lock: %v", err)
+		return
+	}
+	if !ok {
+		log.Println("INFO: Another worker is recovering stale jobs.")
+		return
+	}
+	defer release()
+
+	jobs, _, err := db.ListJobs(ctx, shared.JobFilter{Status: shared.JobStatusProcessing})
+	if err != nil {
+		log.Printf("WARN: Stale job recovery failed to list processing jobs: %v", err)
+		return
+	}
+	recovered := 0
+	for _, job := range jobs {
+		startedAt := job.CreatedAt
+		if job.StartedAt != nil {
+			startedAt = *job.StartedAt
+		}
+		if now.Sub(startedAt) < cfg.StaleProcessingTimeout || isJobRunning(job.ID) {
+			continue
+		}
+		msg := shared.JobMessageFor(job)
+		msg.Attempt = job.Attempts
+		shared.WithJob(logger, job.ID).Warn("Recovering job stuck in processing", "started_at", startedAt)
+		retryOrFail(ctx, job, msg, shared.FailureTimeout,
+			"worker stopped processing the job, e.g. because it crashed")
+		recovered++
+	}
+	if recovered > 0 {
+		log.Printf("INFO: Recovered %d stale processing job(s)", recovered)
+	}
+}
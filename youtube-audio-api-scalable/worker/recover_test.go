@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+// seedProcessingJob stores a job a worker started at startedAt
+func seedProcessingJob(t *testing.T, id string, startedAt time.Time, attempts int) {
+	t.Helper()
+	job := &shared.Job{ID: id, OriginalURL: "https://youtu.be/dQw4w9WgXcQ", Status: shared.JobStatusProcessing,
+		CreatedAt: startedAt.Add(-time.Minute), StartedAt: &startedAt, Attempts: attempts}
+	if err := db.CreateJob(context.Background(), job); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRecoverStaleJobsRequeuesThem(t *testing.T) {
+	t.Setenv("STALE_PROCESSING_TIMEOUT_SECONDS", "600")
+	t.Setenv("MAX_JOB_ATTEMPTS", "3")
+	setupWorker(t)
+	now := time.Now()
+	seedProcessingJob(t, "stale", now.Add(-time.Hour), 0)
+	seedProcessingJob(t, "fresh", now.Add(-time.Minute), 0)
+	seedProcessingJob(t, "running", now.Add(-time.Hour), 0)
+	runningJobsMu.Lock()
+	runningJobs["running"] = &runningJob{log: &jobLog{}}
+	runningJobsMu.Unlock()
+	t.Cleanup(func() {
+		runningJobsMu.Lock()
+		delete(runningJobs, "running")
+		runningJobsMu.Unlock()
+	})
+
+	recoverStaleJobs(context.Background(), now)
+
+	if status := jobStatus(t, "stale"); status != shared.JobStatusPending {
+		t.Errorf("stale job is %s, want pending", status)
+	}
+	if job, _ := db.GetJob(context.Background(), "stale"); job.Attempts != 1 || job.StartedAt != nil {
+		t.Errorf("recovered job = %+v, want one attempt counted and no start time", job)
+	}
+	for _, id := range []string{"fresh", "running"} {
+		if status := jobStatus(t, id); status != shared.JobStatusProcessing {
+			t.Errorf("%s job is %s, want it left processing", id, status)
+		}
+	}
+	if depth, _ := mq.Depth(context.Background()); depth != 1 {
+		t.Errorf("queue depth = %d, want only the stale job re-queued", depth)
+	}
+}
+
+func TestRecoverStaleJobsDeadLettersExhaustedJobs(t *testing.T) {
+	t.Setenv("STALE_PROCESSING_TIMEOUT_SECONDS", "600")
+	t.Setenv("MAX_JOB_ATTEMPTS", "2")
+	setupWorker(t)
+	now := time.Now()
+	seedProcessingJob(t, "stale", now.Add(-time.Hour), 1) // Its last attempt was lost
+
+	recoverStaleJobs(context.Background(), now)
+
+	job, err := db.GetJob(context.Background(), "stale")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != shared.JobStatusFailed || job.FailureReason != shared.FailureTimeout {
+		t.Errorf("job is %s with reason %q, want failed with %q", job.Status, job.FailureReason, shared.FailureTimeout)
+	}
+	if dls, _ := mq.DeadLetters(context.Background()); len(dls) != 1 || dls[0].Message.JobID != "stale" {
+		t.Errorf("dead letters = %+v, want the stale job", dls)
+	}
+}
+
+func TestRecoverStaleJobsSkipsWhileLocked(t *testing.T) {
+	t.Setenv("STALE_PROCESSING_TIMEOUT_SECONDS", "600")
+	setupWorker(t)
+	now := time.Now()
+	seedProcessingJob(t, "stale", now.Add(-time.Hour), 0)
+
+	// Another worker is recovering
+	release, ok, err := locker.TryLock(context.Background(), staleRecoveryLock, time.Minute)
+	if err != nil || !ok {
+		t.Fatalf("TryLock = %v, %v", ok, err)
+	}
+	recoverStaleJobs(context.Background(), now)
+	if status := jobStatus(t, "stale"); status != shared.JobStatusProcessing {
+		t.Errorf("stale job is %s while another worker holds the lock, want processing", status)
+	}
+
+	release()
+	recoverStaleJobs(context.Background(), now)
+	if status := jobStatus(t, "stale"); status != shared.JobStatusPending {
+		t.Errorf("stale job is %s once the lock is free, want pending", status)
+	}
+}
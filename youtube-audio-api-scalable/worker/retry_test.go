@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+func TestFailedJobIsRetriedThenDeadLettered(t *testing.T) {
+	t.Setenv("YTDLP_PATH", writeStub(t, "yt-dlp", `echo "ERROR: Unable to download webpage: Connection reset by peer" >&2; exit 1`))
+	t.Setenv("FFMPEG_PATH", stubFFmpeg(t, "converted"))
+	t.Setenv("MAX_JOB_ATTEMPTS", "2")
+	setupWorker(t)
+	ctx := context.Background()
+	msg := seedJob(t, "job-1", "https://youtu.be/dQw4w9WgXcQ")
+	msg.Cookies = base64.StdEncoding.EncodeToString([]byte("# Netscape HTTP Cookie File\n"))
+
+	processJob(msg)
+
+	job, err := db.GetJob(ctx, "job-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != shared.JobStatusPending || job.Attempts != 1 {
+		t.Fatalf("after the first attempt the job is %s with %d attempts, want pending with 1", job.Status, job.Attempts)
+	}
+	if depth, _ := mq.Depth(ctx); depth != 1 {
+		t.Fatalf("queue depth %d after the first attempt, want the retry queued", depth)
+	}
+
+	msg.Attempt = 1
+	processJob(msg)
+
+	if job, err = db.GetJob(ctx, "job-1"); err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != shared.JobStatusFailed || job.Attempts != 2 {
+		t.Errorf("after the last attempt the job is %s with %d attempts, want failed with 2", job.Status, job.Attempts)
+	}
+	entries, err := mq.DeadLetters(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Message.JobID != "job-1" || entries[0].Reason == "" {
+		t.Errorf("dead-letter queue holds %+v, want job-1 with a reason", entries)
+	}
+	if len(entries) == 1 && entries[0].Message.Cookies != "" {
+		t.Error("the dead letter kept the request's cookies")
+	}
+}
@@ -0,0 +1,118 @@
+// worker/shutdown.go
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+// shuttingDown is closed once a termination signal is received
+var shuttingDown = make(chan struct{})
+
+// isShuttingDown reports whether the worker has begun shutting down
+func isShuttingDown() bool {
+	select {
+	case <-shuttingDown:
+		return true
+	default:
+		return false
+	}
+}
+
+// waitForShutdown blocks until SIGINT/SIGTERM, then shuts the worker down
+func waitForShutdown(server *http.Server) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	s := <-sig
+	log.Printf("INFO: Received %s, shutting down worker...", s)
+	shutdown(server)
+}
+
+// shutdown stops the HTTP server, drains the queue, waits for in-flight jobs
+// and re-queues any that don't finish within cfg.ShutdownTimeout
+func shutdown(server *http.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("WARN: HTTP server shutdown: %v", err)
+	}
+
+	// Let the consumer pick up messages already queued in this process, then
+	// stop taking new ones and give running jobs until the deadline to finish
+	if err := mq.Drain(ctx); err != nil {
+		log.Printf("WARN: %v", err)
+	}
+	close(shuttingDown)
+	if drainWorkers(ctx) {
+		log.Println("INFO: All in-flight jobs finished.")
+		return
+	}
+
+	msgs := interruptRunningJobs()
+	log.Printf("WARN: Shutdown timeout reached with %d job(s) still running; re-queueing them", len(msgs))
+	for _, msg := range msgs {
+		// ctx has expired by now, so re-queue without it
+		requeueJob(context.Background(), msg, "interrupted by worker shutdown")
+		ackMessage(msg)
+	}
+}
+
+// drainWorkers waits until no jobs hold a worker token, or ctx is done
+func drainWorkers(ctx context.Context) bool {
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		if active, _ := workerLimiter.Usage(); active == 0 {
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+	}
+}
+
+// ackMessage tells the queue msg has been handled. A failed ack only means the
+// message may be delivered again, and processJob skips jobs already finished.
+func ackMessage(msg shared.JobMessage) {
+	if err := mq.Ack(context.Background(), msg); err != nil {
+		shared.WithJob(logger, msg.JobID).Warn("Failed to acknowledge queue message", "error", err)
+	}
+}
+
+// requeueJob puts an unfinished job back to pending and publishes it again;
+// reason goes into the job's history
+func requeueJob(ctx context.Context, msg shared.JobMessage, reason string) {
+	jl := shared.WithJob(logger, msg.JobID)
+	job, err := db.GetJob(ctx, msg.JobID)
+	if err != nil {
+		jl.Error("Failed to load job for re-queue", "error", err)
+		return
+	}
+	if job.Status.IsTerminal() {
+		return
+	}
+	wasPending := job.Status == shared.JobStatusPending
+	job.Status = shared.JobStatusPending
+	job.StartedAt = nil
+	if err := db.UpdateJob(ctx, job); err != nil {
+		jl.Error("Failed to reset job to pending", "error", err)
+		return
+	}
+	if !wasPending {
+		recordJobEvent(ctx, job, reason)
+	}
+	if err := mq.Publish(ctx, msg); err != nil {
+		jl.Error("Failed to re-publish job", "error", err)
+		return
+	}
+	jl.Info("Job re-queued")
+}
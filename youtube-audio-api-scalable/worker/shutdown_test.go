@@ -0,0 +1,80 @@
+// worker/shutdown_test.go
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+// waitFor polls cond every 10ms until it holds or timeout passes
+func waitFor(t *testing.T, timeout time.Duration, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestShutdownMidJobRequeuesIt(t *testing.T) {
+	t.Setenv("YTDLP_PATH", stubYtDlp(t, videoInfoJSON))
+	ffmpeg := writeStub(t, "ffmpeg", `printf '%s\n' "$@" > "$0.args"
+exec sleep 30`)
+	t.Setenv("FFMPEG_PATH", ffmpeg)
+	setupWorker(t)
+	cfg.ShutdownTimeout = 200 * time.Millisecond
+	ctx := context.Background()
+	job := &shared.Job{ID: "job-1", OriginalURL: "https://youtu.be/dQw4w9WgXcQ", Status: shared.JobStatusPending, CreatedAt: time.Now()}
+	if err := db.CreateJob(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+
+	// Run the job as the queue consumer would
+	if !workerLimiter.Acquire(shuttingDown) {
+		t.Fatal("no worker slot")
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer workerLimiter.Release()
+		processJob(shared.JobMessageFor(job))
+	}()
+	waitFor(t, 5*time.Second, "ffmpeg to start", func() bool {
+		_, err := os.Stat(ffmpeg + ".args")
+		return err == nil
+	})
+
+	start := time.Now()
+	shutdown(&http.Server{})
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the job kept running after shutdown")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("shutdown took %s", elapsed)
+	}
+
+	stored, err := db.GetJob(ctx, "job-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != shared.JobStatusPending || stored.StartedAt != nil || stored.CompletedAt != nil {
+		t.Errorf("job left as %s (started %v, completed %v), want pending for another worker",
+			stored.Status, stored.StartedAt, stored.CompletedAt)
+	}
+	if stored.Error != "" || stored.FailureReason != "" {
+		t.Errorf("interrupted job recorded a failure: %q (%s)", stored.Error, stored.FailureReason)
+	}
+	entries, _ := os.ReadDir(cfg.OutputDir)
+	for _, e := range entries {
+		t.Errorf("partial output %s left behind", e.Name())
+	}
+}
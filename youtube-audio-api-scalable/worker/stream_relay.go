@@ -0,0 +1,106 @@
+// worker/stream_relay.go
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+// relayedHeaders are the request and response headers passed through the
+// relay; Range and friends let ffmpeg seek in the remote stream
+var (
+	relayedRequestHeaders  = []string{"Range", "If-Range", "User-Agent"}
+	relayedResponseHeaders = []string{"Accept-Ranges", "Content-Length", "Content-Range", "Content-Type", "ETag", "Last-Modified"}
+)
+
+// streamRelay serves remote URLs to ffmpeg from a loopback address. Handing
+// ffmpeg the remote URL would let it resolve the host again and follow
+// redirects on its own, past the IsSafeRemoteURL check (DNS rebinding); the
+// relay fetches through shared.NewSafeHTTPClient instead, which connects only
+// to addresses it checked and checks every redirect.
+type streamRelay struct {
+	listener net.Listener
+	server   *http.Server
+	client   *http.Client
+
+	mu   sync.Mutex
+	urls map[string]string // Path token -> remote URL
+}
+
+// startStreamRelay listens on a random loopback port until Close
+func startStreamRelay() (*streamRelay, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	r := &streamRelay{
+		listener: listener,
+		client:   shared.NewSafeHTTPClient(0, cfg.StreamHostAllowlist...), // Streams run as long as ffmpeg reads
+		urls:     map[string]string{},
+	}
+	r.server = &http.Server{Handler: r, ReadHeaderTimeout: 10 * time.Second}
+	go r.server.Serve(listener)
+	return r, nil
+}
+
+// Add registers remoteURL and returns the loopback URL ffmpeg should read it from.
+// The path is random, so other local processes can't guess it.
+func (r *streamRelay) Add(remoteURL string) string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	token := hex.EncodeToString(b)
+	r.mu.Lock()
+	r.urls["/"+token] = remoteURL
+	r.mu.Unlock()
+	return "http://" + r.listener.Addr().String() + "/" + token
+}
+
+// Close stops the relay and any transfers in progress
+func (r *streamRelay) Close() {
+	r.server.Close()
+}
+
+func (r *streamRelay) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	remoteURL, ok := r.urls[req.URL.Path]
+	r.mu.Unlock()
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	upstream, err := http.NewRequestWithContext(req.Context(), req.Method, remoteURL, nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	for _, h := range relayedRequestHeaders {
+		if v := req.Header.Get(h); v != "" {
+			upstream.Header.Set(h, v)
+		}
+	}
+	resp, err := r.client.Do(upstream)
+	if err != nil {
+		logger.Warn("Stream relay failed to fetch remote URL", "url", shared.RedactURLs(remoteURL), "error", err)
+		http.Error(w, "upstream request failed", http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	for _, h := range relayedResponseHeaders {
+		if v := resp.Header.Get(h); v != "" {
+			w.Header().Set(h, v)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// fetchRelayed reads url through a fresh relay with header set on the request
+func fetchRelayed(t *testing.T, url string, header ...string) *http.Response {
+	t.Helper()
+	relay, err := startStreamRelay()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(relay.Close)
+	req, err := http.NewRequest(http.MethodGet, relay.Add(url), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestStreamRelayPassesRangeRequests(t *testing.T) {
+	setupWorker(t)
+	cfg.StreamHostAllowlist = []string{"127.0.0.1"}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "bytes=5-" {
+			t.Errorf("upstream got Range %q", r.Header.Get("Range"))
+		}
+		w.Header().Set("Content-Type", "audio/webm")
+		w.Header().Set("Content-Range", "bytes 5-9/10")
+		w.WriteHeader(http.StatusPartialContent)
+		io.WriteString(w, "56789")
+	}))
+	defer srv.Close()
+
+	resp := fetchRelayed(t, srv.URL+"/audio.webm", "Range", "bytes=5-")
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusPartialContent || string(body) != "56789" {
+		t.Errorf("got %d %q, want 206 56789", resp.StatusCode, body)
+	}
+	if resp.Header.Get("Content-Range") != "bytes 5-9/10" || resp.Header.Get("Content-Type") != "audio/webm" {
+		t.Errorf("relay dropped headers: %v", resp.Header)
+	}
+}
+
+func TestStreamRelayRefusesInternalAddresses(t *testing.T) {
+	setupWorker(t)
+	var reached atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached.Store(true)
+	}))
+	defer srv.Close()
+
+	if resp := fetchRelayed(t, srv.URL+"/audio.webm"); resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("status %d, want 502", resp.StatusCode)
+	}
+	if reached.Load() {
+		t.Error("the relay connected to a loopback address")
+	}
+}
+
+func TestStreamRelayRefusesRedirectToInternalAddress(t *testing.T) {
+	setupWorker(t)
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the relay followed a redirect to a loopback address")
+	}))
+	defer target.Close()
+	redirector := httptest.NewServer(http.RedirectHandler(target.URL+"/latest/meta-data/", http.StatusFound))
+	defer redirector.Close()
+	cfg.StreamHostAllowlist = []string{"localhost"} // The redirector, not the 127.0.0.1 target
+
+	resp := fetchRelayed(t, strings.Replace(redirector.URL, "127.0.0.1", "localhost", 1))
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("status %d, want 502", resp.StatusCode)
+	}
+}
+
+func TestStreamRelayUnknownPath(t *testing.T) {
+	setupWorker(t)
+	relay, err := startStreamRelay()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer relay.Close()
+	relay.Add("https://93.184.216.34/audio.webm")
+
+	resp, err := http.Get("http://" + relay.listener.Addr().String() + "/guessed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("status %d, want 404", resp.StatusCode)
+	}
+}
@@ -0,0 +1,83 @@
+// worker/subtitles.go
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+// subtitlesContentType is the MIME type of the WebVTT captions yt-dlp writes
+const subtitlesContentType = "text/vtt; charset=utf-8"
+
+// saveSubtitles has yt-dlp write the video's captions as WebVTT next to the
+// job's output and stores them, returning them as an artifact. Uploaded
+// captions are preferred over automatic ones; yt-dlp picks English when
+// offered, else the first language. ok is false when the video has none.
+func saveSubtitles(jl *slog.Logger, jobID string, videoURL string, opts ytDlpOptions) (a shared.Artifact, ok bool, err error) {
+	prefix := filepath.Join(cfg.OutputDir, jobID+"_subs")
+	args := []string{
+		"--skip-download", "--write-subs", "--write-auto-subs", "--sub-format", "vtt",
+		"--no-warnings", "-o", prefix + ".%(ext)s",
+	}
+	if opts.CookiesPath != "" {
+		args = append(args, "--cookies", opts.CookiesPath)
+	}
+	if opts.Proxy != "" {
+		args = append(args, "--proxy", opts.Proxy)
+	}
+	args = append(args, "--", videoURL)
+	var out bytes.Buffer
+	if err := runCommand(jobID, cfg.YtDlpTimeout, &out, cfg.YtDlpPath, args...); err != nil {
+		removeSubtitleFiles(prefix)
+		return shared.Artifact{}, false, fmt.Errorf("yt-dlp failed: %v\nOutput: %s", err, out.String())
+	}
+
+	// yt-dlp names the file <prefix>.<language>.vtt
+	written, _ := filepath.Glob(prefix + ".*.vtt")
+	if len(written) == 0 {
+		return shared.Artifact{}, false, nil
+	}
+	sort.Strings(written)
+	lang := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(written[0]), jobID+"_subs."), ".vtt")
+	path := prefix + ".vtt"
+	err = os.Rename(written[0], path)
+	removeSubtitleFiles(prefix)
+	if err != nil {
+		return shared.Artifact{}, false, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return shared.Artifact{}, false, err
+	}
+	name := filepath.Base(path)
+	if err := storeOutput(jl, path, name); err != nil {
+		os.Remove(path)
+		return shared.Artifact{}, false, err
+	}
+	if cfg.StorageBackend == shared.StorageBackendS3 {
+		os.Remove(path) // The object store now holds the only copy
+	}
+	return shared.Artifact{
+		Type:        shared.ArtifactSubtitles,
+		Key:         name,
+		Size:        info.Size(),
+		ContentType: subtitlesContentType,
+		Language:    lang,
+	}, true, nil
+}
+
+// removeSubtitleFiles deletes caption files yt-dlp left under prefix, e.g.
+// further languages or partial downloads
+func removeSubtitleFiles(prefix string) {
+	leftover, _ := filepath.Glob(prefix + ".*.*")
+	for _, f := range leftover {
+		os.Remove(f)
+	}
+}
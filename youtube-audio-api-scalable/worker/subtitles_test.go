@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+// stubYtDlpWithSubtitles creates a yt-dlp that prints videoInfoJSON, and when
+// run with --skip-download instead runs subs with $prefix set to where the
+// captions go (the -o template without its .%(ext)s)
+func stubYtDlpWithSubtitles(t *testing.T, subs string) string {
+	t.Helper()
+	return writeStub(t, "yt-dlp", `for arg; do
+  [ "$prev" = "-o" ] && prefix="${arg%.*}"
+  prev="$arg"
+done
+case " $* " in
+*" --skip-download "*)
+  echo "$*" >> "$0.subs-args"
+  `+subs+`
+  exit 0 ;;
+esac
+cat <<'JSON'
+`+videoInfoJSON+`
+JSON`)
+}
+
+func TestProcessJobSavesSubtitles(t *testing.T) {
+	tests := []struct {
+		name     string
+		subs     string // Stub script for the subtitles run
+		wantLang string // "" when no subtitles artifact is expected
+	}{
+		{"english and german", `printf 'WEBVTT\n\nde' > "$prefix.de.vtt"; printf 'WEBVTT\n\nen' > "$prefix.en.vtt"`, "de"},
+		{"auto captions only", `printf 'WEBVTT\n\nen' > "$prefix.en-orig.vtt"`, "en-orig"},
+		{"no captions", `echo "[info] There are no subtitles for the requested languages"`, ""},
+		{"yt-dlp fails", `echo "ERROR: Unable to download video subtitles"; exit 1`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ytDlp := stubYtDlpWithSubtitles(t, tt.subs)
+			t.Setenv("YTDLP_PATH", ytDlp)
+			t.Setenv("FFMPEG_PATH", stubFFmpeg(t, "converted"))
+			setupWorker(t)
+
+			msg := seedJob(t, "job-1", "https://youtu.be/dQw4w9WgXcQ")
+			msg.WithSubtitles = true
+			processJob(msg)
+
+			job, err := db.GetJob(context.Background(), "job-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Missing or broken captions never fail the job
+			if job.Status != shared.JobStatusCompleted {
+				t.Fatalf("job %s: %s", job.Status, job.Error)
+			}
+			args, _ := os.ReadFile(ytDlp + ".subs-args")
+			if !strings.Contains(string(args), "--write-auto-subs") || !strings.Contains(string(args), "--sub-format vtt") {
+				t.Errorf("subtitles run with %q", args)
+			}
+			subs, ok := job.Artifact(shared.ArtifactSubtitles)
+			if tt.wantLang == "" {
+				if ok {
+					t.Errorf("got a subtitles artifact %+v", subs)
+				}
+			} else {
+				if !ok || subs.Key != "job-1_subs.vtt" || subs.Language != tt.wantLang || subs.ContentType != subtitlesContentType {
+					t.Fatalf("subtitles artifact %+v (%v), want language %s", subs, ok, tt.wantLang)
+				}
+				b, err := os.ReadFile(filepath.Join(cfg.OutputDir, subs.Key))
+				if err != nil || !strings.HasPrefix(string(b), "WEBVTT") || int64(len(b)) != subs.Size {
+					t.Errorf("saved subtitles %q, %v", b, err)
+				}
+			}
+			// Other languages and partial files are cleaned up
+			if left, _ := filepath.Glob(filepath.Join(cfg.OutputDir, "job-1_subs.*.*")); len(left) != 0 {
+				t.Errorf("left behind %v", left)
+			}
+		})
+	}
+}
+
+func TestProcessJobSkipsSubtitlesUnlessAsked(t *testing.T) {
+	ytDlp := stubYtDlpWithSubtitles(t, `printf 'WEBVTT' > "$prefix.en.vtt"`)
+	t.Setenv("YTDLP_PATH", ytDlp)
+	t.Setenv("FFMPEG_PATH", stubFFmpeg(t, "converted"))
+	setupWorker(t)
+
+	processJob(seedJob(t, "job-1", "https://youtu.be/dQw4w9WgXcQ"))
+
+	if _, err := os.Stat(ytDlp + ".subs-args"); err == nil {
+		t.Error("yt-dlp was run for subtitles")
+	}
+	job, _ := db.GetJob(context.Background(), "job-1")
+	if _, ok := job.Artifact(shared.ArtifactSubtitles); ok || job.Status != shared.JobStatusCompleted {
+		t.Errorf("job %s with artifacts %+v", job.Status, job.Artifacts)
+	}
+}
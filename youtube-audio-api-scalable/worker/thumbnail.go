@@ -0,0 +1,109 @@
+// worker/thumbnail.go
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+const (
+	// maxThumbnailSize caps a downloaded thumbnail
+	maxThumbnailSize = 5 << 20
+	// thumbnailTimeout bounds the whole thumbnail download
+	thumbnailTimeout = 30 * time.Second
+)
+
+// thumbnailExts maps the image types thumbnails are accepted in to the
+// extension they are saved with
+var thumbnailExts = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/webp": ".webp",
+}
+
+// saveThumbnail downloads the video thumbnail at thumbURL next to the job's
+// output and stores it, returning it as an artifact
+func saveThumbnail(ctx context.Context, jl *slog.Logger, jobID string, thumbURL string) (shared.Artifact, error) {
+	if err := shared.IsSafeRemoteURL(thumbURL, cfg.StreamHostAllowlist...); err != nil {
+		return shared.Artifact{}, err
+	}
+	path, err := downloadThumbnail(ctx, jobID, thumbURL)
+	if err != nil {
+		return shared.Artifact{}, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return shared.Artifact{}, err
+	}
+	name := filepath.Base(path)
+	if err := storeOutput(jl, path, name); err != nil {
+		os.Remove(path)
+		return shared.Artifact{}, err
+	}
+	if cfg.StorageBackend == shared.StorageBackendS3 {
+		os.Remove(path) // The object store now holds the only copy
+	}
+	return shared.Artifact{
+		Type:        shared.ArtifactThumbnail,
+		Key:         name,
+		Size:        info.Size(),
+		ContentType: shared.ArtifactContentType(name),
+	}, nil
+}
+
+// downloadThumbnail fetches thumbURL into OutputDir and returns the file's path
+func downloadThumbnail(ctx context.Context, jobID string, thumbURL string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, thumbnailTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, thumbURL, nil)
+	if err != nil {
+		return "", err
+	}
+	// The safe client connects only to checked addresses and checks redirects too
+	resp, err := shared.NewSafeHTTPClient(thumbnailTimeout, cfg.StreamHostAllowlist...).Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("thumbnail download returned %s", resp.Status)
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	ext, ok := thumbnailExts[mediaType]
+	if !ok {
+		return "", fmt.Errorf("unsupported thumbnail type %q", mediaType)
+	}
+
+	if err := os.MkdirAll(cfg.OutputDir, os.ModePerm); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(cfg.OutputDir, ".thumb-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	n, err := io.Copy(tmp, io.LimitReader(resp.Body, maxThumbnailSize+1))
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", err
+	}
+	if n > maxThumbnailSize {
+		return "", fmt.Errorf("thumbnail is larger than %d bytes", maxThumbnailSize)
+	}
+	path := filepath.Join(cfg.OutputDir, shared.ThumbnailFileName(jobID, ext))
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
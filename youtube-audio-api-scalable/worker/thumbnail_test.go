@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+// videoInfoWithThumbnail is videoInfoJSON with a thumbnail at thumbURL
+func videoInfoWithThumbnail(thumbURL string) string {
+	return strings.Replace(videoInfoJSON, `"ext":"webm"`, `"ext":"webm","thumbnail":"`+thumbURL+`"`, 1)
+}
+
+func TestProcessJobSavesThumbnail(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/hqdefault.jpg" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write([]byte("\xff\xd8\xff jpeg bytes"))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name      string
+		thumbnail string // Empty means the video has none
+		wantSaved bool
+	}{
+		{"with thumbnail", srv.URL + "/hqdefault.jpg", true},
+		{"without thumbnail", "", false},
+		{"broken thumbnail", srv.URL + "/missing.jpg", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := videoInfoJSON
+			if tt.thumbnail != "" {
+				info = videoInfoWithThumbnail(tt.thumbnail)
+			}
+			t.Setenv("YTDLP_PATH", stubYtDlp(t, info))
+			t.Setenv("FFMPEG_PATH", stubFFmpeg(t, "converted"))
+			setupWorker(t)
+			cfg.StreamHostAllowlist = []string{"127.0.0.1"} // The test server
+
+			processJob(seedJob(t, "job-1", "https://youtu.be/dQw4w9WgXcQ"))
+
+			job, err := db.GetJob(context.Background(), "job-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			// A missing or broken thumbnail never fails the job
+			if job.Status != shared.JobStatusCompleted {
+				t.Fatalf("job %s: %s", job.Status, job.Error)
+			}
+			if !tt.wantSaved {
+				if job.ThumbnailFile != "" || job.ThumbnailEndpoint != "" || len(job.Artifacts) != 1 {
+					t.Errorf("job has thumbnail %q (%q), artifacts %+v", job.ThumbnailFile, job.ThumbnailEndpoint, job.Artifacts)
+				}
+				return
+			}
+			if job.ThumbnailFile != "job-1_thumb.jpg" || !strings.HasSuffix(job.ThumbnailEndpoint, "/thumbnail/job-1") {
+				t.Errorf("thumbnail %q served at %q", job.ThumbnailFile, job.ThumbnailEndpoint)
+			}
+			b, err := os.ReadFile(filepath.Join(cfg.OutputDir, job.ThumbnailFile))
+			if err != nil || string(b) != "\xff\xd8\xff jpeg bytes" {
+				t.Errorf("saved thumbnail %q, %v", b, err)
+			}
+			if len(job.Artifacts) != 2 || job.Artifacts[1].Type != shared.ArtifactThumbnail || job.Artifacts[1].ContentType != "image/jpeg" {
+				t.Errorf("artifacts %+v", job.Artifacts)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+// recordSpans installs a tracer provider that keeps finished spans in memory
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+	return recorder
+}
+
+func TestProcessJobContinuesGatewayTrace(t *testing.T) {
+	t.Setenv("YTDLP_PATH", stubYtDlp(t, videoInfoJSON))
+	t.Setenv("FFMPEG_PATH", stubFFmpeg(t, "converted"))
+	setupWorker(t)
+	recorder := recordSpans(t)
+
+	// Stand in for the gateway's extract span, which travels in the message
+	ctx, gatewaySpan := shared.Tracer().Start(context.Background(), "extract")
+	msg := seedJob(t, "job-1", "https://youtu.be/dQw4w9WgXcQ")
+	msg.TraceContext = shared.InjectTraceContext(ctx)
+	gatewaySpan.End()
+
+	processJob(msg)
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, s := range recorder.Ended() {
+		spans[s.Name()] = s
+	}
+	job, ok := spans["process_job"]
+	if !ok {
+		t.Fatalf("no process_job span among %d", len(spans))
+	}
+	if job.Parent().SpanID() != gatewaySpan.SpanContext().SpanID() || job.SpanContext().TraceID() != gatewaySpan.SpanContext().TraceID() {
+		t.Errorf("process_job has parent %s in trace %s, want the gateway span", job.Parent().SpanID(), job.SpanContext().TraceID())
+	}
+	for _, name := range []string{"get_audio_stream", "convert_audio"} {
+		if s, ok := spans[name]; !ok || s.Parent().SpanID() != job.SpanContext().SpanID() {
+			t.Errorf("%s is not a child of process_job", name)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+// worker/verify.go
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	// ffprobeTimeout bounds the ffprobe run on one converted file
+	ffprobeTimeout = time.Minute
+	// Verified durations may differ from the expected one by this much, or by
+	// durationToleranceRatio of it when that is larger, since encoders pad
+	// and trim a little
+	durationTolerance      = 3 * time.Second
+	durationToleranceRatio = 0.02
+)
+
+var (
+	// errInvalidOutput is returned by verifyOutput for a missing, empty or broken file
+	errInvalidOutput = errors.New("invalid output file")
+	// errOutputTooLarge is returned by verifyOutput for a file that reached cfg.MaxOutputBytes
+	errOutputTooLarge = errors.New("output file too large")
+)
+
+// outputInfo describes a verified output file
+type outputInfo struct {
+	Size     int64
+	Duration float64 // Seconds, as measured by ffprobe; 0 when ffprobe isn't available
+}
+
+// verifyOutput checks that the file ffmpeg wrote at path is complete: it must
+// be non-empty and, when ffprobe is available, contain an audio stream whose
+// duration is close to expected (skipped when expected is 0)
+func verifyOutput(jobID string, path string, expected float64) (outputInfo, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return outputInfo{}, fmt.Errorf("%w: %v", errInvalidOutput, err)
+	}
+	if fi.Size() == 0 {
+		return outputInfo{}, fmt.Errorf("%w: file is empty", errInvalidOutput)
+	}
+	// ffmpeg stops writing at the limit (-fs), so a file that reached it is cut short
+	if cfg.MaxOutputBytes > 0 && fi.Size() >= cfg.MaxOutputBytes {
+		return outputInfo{}, fmt.Errorf("%w: reached the limit of %d bytes", errOutputTooLarge, cfg.MaxOutputBytes)
+	}
+	info := outputInfo{Size: fi.Size()}
+	if cfg.FFprobePath == "" {
+		return info, nil
+	}
+
+	info.Duration, err = probeAudioDuration(jobID, path)
+	if err != nil {
+		return outputInfo{}, err
+	}
+	if expected > 0 {
+		tolerance := math.Max(durationTolerance.Seconds(), expected*durationToleranceRatio)
+		if math.Abs(info.Duration-expected) > tolerance {
+			return outputInfo{}, fmt.Errorf("%w: duration is %.1fs, expected about %.1fs", errInvalidOutput, info.Duration, expected)
+		}
+	}
+	return info, nil
+}
+
+// probeAudioDuration runs ffprobe on path and returns the duration of the
+// file, failing if it has no audio stream
+func probeAudioDuration(jobID string, path string) (float64, error) {
+	var out bytes.Buffer
+	err := runCommand(jobID, ffprobeTimeout, &out, cfg.FFprobePath,
+		"-v", "error", "-select_streams", "a:0", "-show_entries", "stream=codec_type:format=duration",
+		"-of", "json", path)
+	if isJobStop(err) {
+		return 0, err
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%w: ffprobe failed: %v: %s", errInvalidOutput, err, bytes.TrimSpace(out.Bytes()))
+	}
+	var probe struct {
+		Streams []struct {
+			CodecType string `json:"codec_type"`
+		} `json:"streams"`
+		Format struct {
+			Duration string `json:"duration"`
+		} `json:"format"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &probe); err != nil {
+		return 0, fmt.Errorf("%w: unreadable ffprobe output: %v", errInvalidOutput, err)
+	}
+	if len(probe.Streams) == 0 || probe.Streams[0].CodecType != "audio" {
+		return 0, fmt.Errorf("%w: no audio stream", errInvalidOutput)
+	}
+	d, err := strconv.ParseFloat(probe.Format.Duration, 64)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("%w: no duration", errInvalidOutput)
+	}
+	return d, nil
+}
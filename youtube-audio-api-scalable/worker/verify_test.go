@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"youtube-audio-api-scalable/shared"
+)
+
+// stubFFprobe creates an ffprobe that prints output
+func stubFFprobe(t *testing.T, output string) string {
+	t.Helper()
+	return writeStub(t, "ffprobe", "cat <<'JSON'\n"+output+"\nJSON")
+}
+
+func TestVerifyOutput(t *testing.T) {
+	const audio60s = `{"streams":[{"codec_type":"audio"}],"format":{"duration":"60.04"}}`
+	tests := []struct {
+		name         string
+		content      string
+		ffprobe      string // Output of the ffprobe stub; empty means no ffprobe
+		wantErr      bool
+		wantDuration float64
+	}{
+		{"valid without ffprobe", "audio", "", false, 0},
+		{"empty", "", "", true, 0},
+		{"valid", "audio", audio60s, false, 60.04},
+		{"empty with ffprobe", "", audio60s, true, 0},
+		{"truncated", "audio", `{"streams":[{"codec_type":"audio"}],"format":{"duration":"31.5"}}`, true, 0},
+		{"no audio stream", "audio", `{"streams":[{"codec_type":"video"}],"format":{"duration":"60"}}`, true, 0},
+		{"unreadable probe", "audio", `not json`, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupWorker(t)
+			cfg.FFprobePath = ""
+			if tt.ffprobe != "" {
+				cfg.FFprobePath = stubFFprobe(t, tt.ffprobe)
+			}
+			path := filepath.Join(t.TempDir(), "out.mp3")
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			info, err := verifyOutput("job-1", path, 60)
+			if tt.wantErr {
+				if !errors.Is(err, errInvalidOutput) {
+					t.Errorf("verifyOutput = %+v, %v; want errInvalidOutput", info, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Size != int64(len(tt.content)) || info.Duration != tt.wantDuration {
+				t.Errorf("verifyOutput = %+v", info)
+			}
+		})
+	}
+}
+
+func TestProcessJobFailsOnEmptyOutput(t *testing.T) {
+	t.Setenv("YTDLP_PATH", stubYtDlp(t, videoInfoJSON))
+	t.Setenv("FFMPEG_PATH", stubFFmpeg(t, "")) // Exits cleanly without writing audio
+	t.Setenv("MAX_JOB_ATTEMPTS", "1")
+	setupWorker(t)
+
+	processJob(seedJob(t, "job-1", "https://youtu.be/dQw4w9WgXcQ"))
+
+	job, err := db.GetJob(context.Background(), "job-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != shared.JobStatusFailed || job.FileSize != 0 || job.DownloadEndpoint != "" {
+		t.Errorf("job %s (%q), size %d, download %q", job.Status, job.Error, job.FileSize, job.DownloadEndpoint)
+	}
+	if entries, _ := os.ReadDir(cfg.OutputDir); len(entries) != 0 {
+		t.Errorf("output dir holds %d file(s) after a failed conversion", len(entries))
+	}
+}
+
+func TestFailingFFmpegLeavesNoFile(t *testing.T) {
+	t.Setenv("YTDLP_PATH", stubYtDlp(t, videoInfoJSON))
+	// Writes half a file, then crashes
+	t.Setenv("FFMPEG_PATH", writeStub(t, "ffmpeg", `for out; do :; done
+printf 'partial audio' > "$out"
+exit 1`))
+	t.Setenv("MAX_JOB_ATTEMPTS", "1")
+	setupWorker(t)
+
+	processJob(seedJob(t, "job-1", "https://youtu.be/dQw4w9WgXcQ"))
+
+	job, err := db.GetJob(context.Background(), "job-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != shared.JobStatusFailed {
+		t.Errorf("job %s, want failed", job.Status)
+	}
+	entries, _ := os.ReadDir(cfg.OutputDir)
+	for _, e := range entries {
+		t.Errorf("%s left in the output dir", e.Name())
+	}
+}
+
+func TestConvertedFileIsRenamedIntoPlace(t *testing.T) {
+	ffmpeg := stubFFmpeg(t, "converted")
+	t.Setenv("YTDLP_PATH", stubYtDlp(t, videoInfoJSON))
+	t.Setenv("FFMPEG_PATH", ffmpeg)
+	setupWorker(t)
+
+	processJob(seedJob(t, "job-1", "https://youtu.be/dQw4w9WgXcQ"))
+
+	// ffmpeg wrote next to the final path, which only exists once it's done
+	args := stubArgs(t, ffmpeg)
+	final := filepath.Join(cfg.OutputDir, "job-1.mp3")
+	if written := args[len(args)-1]; written != final+tempOutputSuffix {
+		t.Errorf("ffmpeg wrote %s, want %s", written, final+tempOutputSuffix)
+	}
+	if b, err := os.ReadFile(final); err != nil || string(b) != "converted" {
+		t.Errorf("final file %q, %v", b, err)
+	}
+	if _, err := os.Stat(final + tempOutputSuffix); !os.IsNotExist(err) {
+		t.Errorf("temp file still exists: %v", err)
+	}
+}
+
+func TestOutputLandsInConfiguredDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "audio")
+	t.Setenv("YTDLP_PATH", stubYtDlp(t, videoInfoJSON))
+	t.Setenv("FFMPEG_PATH", stubFFmpeg(t, "converted"))
+	setupWorker(t)
+	t.Setenv("OUTPUT_DIR", dir)
+	cfg = shared.LoadConfig()
+	if err := shared.EnsureOutputDir(cfg.OutputDir); err != nil {
+		t.Fatal(err)
+	}
+
+	processJob(seedJob(t, "job-1", "https://youtu.be/dQw4w9WgXcQ"))
+
+	job, err := db.GetJob(context.Background(), "job-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.FilePath != filepath.Join(dir, "job-1.mp3") {
+		t.Errorf("FilePath = %q, want it in %s", job.FilePath, dir)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "job-1.mp3")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestProcessJobRejectsOversizedOutput(t *testing.T) {
+	ffmpeg := stubFFmpeg(t, strings.Repeat("x", 2048)) // Runs up to the -fs limit
+	t.Setenv("YTDLP_PATH", stubYtDlp(t, videoInfoJSON))
+	t.Setenv("FFMPEG_PATH", ffmpeg)
+	t.Setenv("MAX_OUTPUT_BYTES", "2048")
+	setupWorker(t)
+
+	processJob(seedJob(t, "job-1", "https://youtu.be/dQw4w9WgXcQ"))
+
+	if limit, _ := argValue(stubArgs(t, ffmpeg), "-fs"); limit != "2048" {
+		t.Errorf("ffmpeg -fs %q, want 2048", limit)
+	}
+	job, err := db.GetJob(context.Background(), "job-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != shared.JobStatusFailed || job.FailureReason != shared.FailureTooLong ||
+		!strings.Contains(job.Error, "output file too large") {
+		t.Errorf("job %s (%s): %q", job.Status, job.FailureReason, job.Error)
+	}
+	// Not retried: the same video gives the same size
+	if dead, _ := mq.DeadLetters(context.Background()); len(dead) != 1 {
+		t.Errorf("%d dead letters, want the job dead-lettered at once", len(dead))
+	}
+	if entries, _ := os.ReadDir(cfg.OutputDir); len(entries) != 0 {
+		t.Errorf("output dir holds %d file(s)", len(entries))
+	}
+}
+
+func TestProcessJobAcceptsOutputBelowLimit(t *testing.T) {
+	t.Setenv("YTDLP_PATH", stubYtDlp(t, videoInfoJSON))
+	t.Setenv("FFMPEG_PATH", stubFFmpeg(t, strings.Repeat("x", 2047)))
+	t.Setenv("MAX_OUTPUT_BYTES", "2048")
+	setupWorker(t)
+
+	processJob(seedJob(t, "job-1", "https://youtu.be/dQw4w9WgXcQ"))
+
+	if job, _ := db.GetJob(context.Background(), "job-1"); job.Status != shared.JobStatusCompleted || job.FileSize != 2047 {
+		t.Errorf("job %s (%q), size %d", job.Status, job.Error, job.FileSize)
+	}
+}